@@ -0,0 +1,235 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"sort"
+	"time"
+
+	"github.com/benbjohnson/application-development-using-boltdb/keys"
+	"github.com/boltdb/bolt"
+)
+
+// ActivityRollupPeriod is the period that old activity samples are rolled up
+// into. See RetainActivity.
+const ActivityRollupPeriod = time.Hour
+
+// Activity is a count of a kind of activity by a user at a point in time.
+type Activity struct {
+	Time  time.Time
+	Kind  string
+	Count int
+}
+
+// Each user has a bucket nested within "Activity" that holds a count for
+// each time and kind of activity, keyed by the time followed by the kind so
+// a range of time can be read with one cursor. Rolled up activity is kept
+// the same way within "ActivityRollups", keyed by the start of each period.
+
+// RecordActivity records an activity of the given kind by a user at t.
+// Returns ErrUserNotFound if the user does not exist.
+func (s *Store) RecordActivity(userID int, t time.Time, kind string) error {
+	if kind == "" {
+		return ErrActivityKindRequired
+	}
+
+	return s.update("RecordActivity", func(tx *Tx) error {
+		if tx.Bucket([]byte("Users")).Get(keys.Int(userID)) == nil {
+			return keyError("user", userID, ErrUserNotFound)
+		}
+
+		tx.recordWrite("Activity", nil)
+		bkt, err := tx.Bucket([]byte("Activity")).CreateBucketIfNotExists(keys.Int(userID))
+		if err != nil {
+			return err
+		}
+		return addActivity(bkt, keys.Join(keys.Time(t), keys.String(kind)), 1)
+	})
+}
+
+// ActivityRange returns the activity of a user from start up to but not
+// including end, ordered by time and kind. Activity that has been rolled up
+// is returned with the start of its period as its time and is included if
+// that time is within the range.
+func (s *Store) ActivityRange(userID int, start, end time.Time) ([]*Activity, error) {
+	a := []*Activity{}
+	if err := s.view("ActivityRange", func(tx *Tx) error {
+		for _, name := range []string{"ActivityRollups", "Activity"} {
+			bkt := tx.Bucket([]byte(name)).Bucket(keys.Int(userID))
+			if bkt == nil {
+				continue
+			}
+
+			c := bkt.Cursor()
+			for k, v := c.Seek(keys.Time(start)); k != nil; k, v = c.Next() {
+				r := keys.NewReader(k)
+				act := &Activity{Time: r.ReadTime(), Kind: r.ReadString()}
+				if err := r.Err(); err != nil {
+					return err
+				} else if !act.Time.Before(end) {
+					break
+				}
+				tx.recordRead(name, v)
+				act.Count = int(decodeActivityCount(v))
+				a = append(a, act)
+			}
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(a, func(i, j int) bool {
+		if !a[i].Time.Equal(a[j].Time) {
+			return a[i].Time.Before(a[j].Time)
+		}
+		return a[i].Kind < a[j].Kind
+	})
+	return a, nil
+}
+
+// RollupActivity combines the activity samples recorded before t into counts
+// per ActivityRollupPeriod and returns the number of samples rolled up. Only
+// whole periods before t are rolled up.
+//
+// This is called automatically by EnforceRetention for the RetainActivity
+// target.
+func (s *Store) RollupActivity(t time.Time) (int, error) {
+	var n int
+	if err := s.update("RollupActivity", func(tx *Tx) error {
+		var err error
+		n, err = rollupActivity(tx, t)
+		return err
+	}); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+// purgeActivity rolls up activity older than the policy's MaxAge.
+func purgeActivity(tx *Tx, p RetentionPolicy, now time.Time) (int, error) {
+	if p.MaxAge <= 0 {
+		return 0, nil
+	}
+	return rollupActivity(tx, now.Add(-p.MaxAge))
+}
+
+// rollupActivity rolls up the samples of every user recorded before the
+// period containing t.
+func rollupActivity(tx *Tx, t time.Time) (int, error) {
+	cutoff := keys.Time(t.Truncate(ActivityRollupPeriod))
+	raw, rollups := tx.Bucket([]byte("Activity")), tx.Bucket([]byte("ActivityRollups"))
+
+	var n int
+	for _, id := range nestedBuckets(raw) {
+		bkt := raw.Bucket(id)
+
+		// Sum the samples of each period. Keys are collected first since
+		// the bucket cannot be modified while iterating.
+		var expired [][]byte
+		sums := make(map[string]uint64)
+		c := bkt.Cursor()
+		for k, v := c.First(); k != nil && bytes.Compare(k, cutoff) < 0; k, v = c.Next() {
+			tx.recordRead("Activity", v)
+
+			r := keys.NewReader(k)
+			at, kind := r.ReadTime(), r.ReadString()
+			if err := r.Err(); err != nil {
+				return n, err
+			}
+			key := keys.Join(keys.Time(at.Truncate(ActivityRollupPeriod)), keys.String(kind))
+			sums[string(key)] += decodeActivityCount(v)
+			expired = append(expired, append([]byte{}, k...))
+		}
+		if len(expired) == 0 {
+			continue
+		}
+
+		tx.recordWrite("ActivityRollups", nil)
+		dst, err := rollups.CreateBucketIfNotExists(id)
+		if err != nil {
+			return n, err
+		}
+		for key, sum := range sums {
+			if err := addActivity(dst, []byte(key), sum); err != nil {
+				return n, err
+			}
+		}
+
+		for _, k := range expired {
+			tx.recordDelete("Activity")
+			if err := bkt.Delete(k); err != nil {
+				return n, err
+			}
+		}
+		n += len(expired)
+
+		if k, _ := bkt.Cursor().First(); k == nil {
+			tx.recordDelete("Activity")
+			if err := raw.DeleteBucket(id); err != nil {
+				return n, err
+			}
+		}
+	}
+	return n, nil
+}
+
+// addActivity adds delta to the count stored under key in bkt.
+func addActivity(bkt *bolt.Bucket, key []byte, delta uint64) error {
+	buf := make([]byte, 8)
+	binary.BigEndian.PutUint64(buf, decodeActivityCount(bkt.Get(key))+delta)
+	return bkt.Put(key, buf)
+}
+
+// decodeActivityCount returns the count encoded in v or zero if v is unset.
+func decodeActivityCount(v []byte) uint64 {
+	if len(v) != 8 {
+		return 0
+	}
+	return binary.BigEndian.Uint64(v)
+}
+
+// userActivity returns every count of a user in the named bucket ordered
+// by time and kind.
+func userActivity(tx *Tx, name string, id int) ([]*Activity, error) {
+	bkt := tx.Bucket([]byte(name)).Bucket(keys.Int(id))
+	if bkt == nil {
+		return nil, nil
+	}
+
+	var a []*Activity
+	if err := bkt.ForEach(func(k, v []byte) error {
+		tx.recordRead(name, v)
+
+		r := keys.NewReader(k)
+		act := &Activity{Time: r.ReadTime(), Kind: r.ReadString(), Count: int(decodeActivityCount(v))}
+		if err := r.Err(); err != nil {
+			return err
+		}
+		a = append(a, act)
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// deleteActivity removes the activity of a user.
+func deleteActivity(tx *Tx, id int) error {
+	for _, name := range []string{"Activity", "ActivityRollups"} {
+		bkt := tx.Bucket([]byte(name))
+		if bkt.Bucket(keys.Int(id)) == nil {
+			continue
+		}
+		tx.recordDelete(name)
+		if err := bkt.DeleteBucket(keys.Int(id)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Activity related errors.
+var (
+	ErrActivityKindRequired = &Error{Code: EINVALID, Message: "activity kind required"}
+)
@@ -0,0 +1,112 @@
+package main_test
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	main "github.com/benbjohnson/application-development-using-boltdb"
+)
+
+// Ensure activity can be recorded and read back by time range.
+func TestStore_RecordActivity(t *testing.T) {
+	s := OpenStore()
+	defer s.Close()
+
+	if err := s.CreateUser(&main.User{Username: "susy"}); err != nil {
+		t.Fatal(err)
+	}
+
+	t0 := time.Date(2016, time.June, 1, 10, 0, 0, 0, time.UTC)
+	for _, sample := range []struct {
+		t    time.Time
+		kind string
+	}{
+		{t0, "login"},
+		{t0, "login"},
+		{t0.Add(time.Minute), "view"},
+		{t0.Add(2 * time.Hour), "view"},
+	} {
+		if err := s.RecordActivity(1, sample.t, sample.kind); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if a, err := s.ActivityRange(1, t0, t0.Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	} else if !reflect.DeepEqual(a, []*main.Activity{
+		{Time: t0, Kind: "login", Count: 2},
+		{Time: t0.Add(time.Minute), Kind: "view", Count: 1},
+	}) {
+		t.Fatalf("unexpected activity: %#v", a)
+	} else if a, err := s.ActivityRange(2, t0, t0.Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	} else if len(a) != 0 {
+		t.Fatalf("unexpected activity: %#v", a)
+	}
+
+	if err := s.RecordActivity(2, t0, "login"); !errors.Is(err, main.ErrUserNotFound) {
+		t.Fatalf("unexpected error: %v", err)
+	} else if err := s.RecordActivity(1, t0, ""); err != main.ErrActivityKindRequired {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// Activity is removed with the user.
+	if err := s.DeleteUser(1); err != nil {
+		t.Fatal(err)
+	} else if a, err := s.ActivityRange(1, t0, t0.Add(24*time.Hour)); err != nil {
+		t.Fatal(err)
+	} else if len(a) != 0 {
+		t.Fatalf("unexpected activity: %#v", a)
+	}
+}
+
+// Ensure old activity is rolled up into hourly counts.
+func TestStore_RollupActivity(t *testing.T) {
+	s := OpenStore()
+	defer s.Close()
+
+	if err := s.CreateUser(&main.User{Username: "susy"}); err != nil {
+		t.Fatal(err)
+	}
+
+	t0 := time.Date(2016, time.June, 1, 10, 0, 0, 0, time.UTC)
+	for _, offset := range []time.Duration{5 * time.Minute, 20 * time.Minute, 70 * time.Minute, 150 * time.Minute} {
+		if err := s.RecordActivity(1, t0.Add(offset), "view"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Only whole hours before the time are rolled up.
+	if n, err := s.RollupActivity(t0.Add(150 * time.Minute)); err != nil {
+		t.Fatal(err)
+	} else if n != 3 {
+		t.Fatalf("unexpected count: %d", n)
+	} else if a, err := s.ActivityRange(1, t0, t0.Add(24*time.Hour)); err != nil {
+		t.Fatal(err)
+	} else if !reflect.DeepEqual(a, []*main.Activity{
+		{Time: t0, Kind: "view", Count: 2},
+		{Time: t0.Add(time.Hour), Kind: "view", Count: 1},
+		{Time: t0.Add(150 * time.Minute), Kind: "view", Count: 1},
+	}) {
+		t.Fatalf("unexpected activity: %#v", a)
+	}
+
+	// Late samples are added to existing rollups.
+	if err := s.RecordActivity(1, t0.Add(30*time.Minute), "view"); err != nil {
+		t.Fatal(err)
+	} else if n, err := s.RollupActivity(t0.Add(24 * time.Hour)); err != nil {
+		t.Fatal(err)
+	} else if n != 2 {
+		t.Fatalf("unexpected count: %d", n)
+	} else if a, err := s.ActivityRange(1, t0, t0.Add(24*time.Hour)); err != nil {
+		t.Fatal(err)
+	} else if !reflect.DeepEqual(a, []*main.Activity{
+		{Time: t0, Kind: "view", Count: 3},
+		{Time: t0.Add(time.Hour), Kind: "view", Count: 1},
+		{Time: t0.Add(2 * time.Hour), Kind: "view", Count: 1},
+	}) {
+		t.Fatalf("unexpected activity: %#v", a)
+	}
+}
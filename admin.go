@@ -0,0 +1,119 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// NewAdminHandler returns a handler for the administrative endpoints of s:
+//
+//	GET    /admin/maintenance  reports whether the store is frozen
+//	POST   /admin/maintenance  freezes the store, see Freeze
+//	DELETE /admin/maintenance  unfreezes the store
+//	GET    /admin/flags        lists feature flags
+//	GET    /admin/flags/{name} reads a flag
+//	PUT    /admin/flags/{name} creates or replaces a flag from a JSON body
+//	DELETE /admin/flags/{name} removes a flag
+//	GET    /admin/leases        lists held leases
+//	POST   /admin/leases/{name} acquires a lease for ?ttl=, e.g. "30s"
+//	PUT    /admin/leases/{name} renews the lease with fencing ?token=
+//	DELETE /admin/leases/{name} releases the lease with fencing ?token=
+//
+// Maintenance endpoints respond with {"frozen": bool} and flag and lease
+// endpoints with the JSON encoding of the flags and leases. Lease endpoints
+// let processes that share the store through the server coordinate. The handler performs no
+// authentication so it must only be reachable by operators.
+func NewAdminHandler(s *Store) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /admin/maintenance", func(w http.ResponseWriter, r *http.Request) {
+		writeMaintenance(w, s, nil)
+	})
+	mux.HandleFunc("POST /admin/maintenance", func(w http.ResponseWriter, r *http.Request) {
+		writeMaintenance(w, s, s.Freeze())
+	})
+	mux.HandleFunc("DELETE /admin/maintenance", func(w http.ResponseWriter, r *http.Request) {
+		writeMaintenance(w, s, s.Unfreeze())
+	})
+
+	mux.HandleFunc("GET /admin/flags", func(w http.ResponseWriter, r *http.Request) {
+		a, err := s.Flags()
+		writeJSON(w, a, err)
+	})
+	mux.HandleFunc("GET /admin/flags/{name}", func(w http.ResponseWriter, r *http.Request) {
+		f, err := s.Flag(r.PathValue("name"))
+		if err == nil && f == nil {
+			err = keyError("flag", r.PathValue("name"), ErrFlagNotFound)
+		}
+		writeJSON(w, f, err)
+	})
+	mux.HandleFunc("PUT /admin/flags/{name}", func(w http.ResponseWriter, r *http.Request) {
+		var f Flag
+		if err := json.NewDecoder(r.Body).Decode(&f); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		f.Name = r.PathValue("name")
+		writeJSON(w, &f, s.SetFlag(&f))
+	})
+	mux.HandleFunc("DELETE /admin/flags/{name}", func(w http.ResponseWriter, r *http.Request) {
+		if err := s.DeleteFlag(r.PathValue("name")); err != nil {
+			http.Error(w, err.Error(), HTTPStatus(err))
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	mux.HandleFunc("GET /admin/leases", func(w http.ResponseWriter, r *http.Request) {
+		a, err := s.Leases()
+		writeJSON(w, a, err)
+	})
+	mux.HandleFunc("POST /admin/leases/{name}", func(w http.ResponseWriter, r *http.Request) {
+		ttl, err := time.ParseDuration(r.URL.Query().Get("ttl"))
+		if err != nil {
+			http.Error(w, ErrLeaseTTLInvalid.Error(), http.StatusBadRequest)
+			return
+		}
+		l, err := s.AcquireLease(r.PathValue("name"), ttl)
+		writeJSON(w, l, err)
+	})
+	mux.HandleFunc("PUT /admin/leases/{name}", func(w http.ResponseWriter, r *http.Request) {
+		token, err := strconv.ParseInt(r.URL.Query().Get("token"), 10, 64)
+		if err != nil {
+			http.Error(w, "invalid lease token", http.StatusBadRequest)
+			return
+		}
+		l, err := s.RenewLease(Lease{Name: r.PathValue("name"), Token: token})
+		writeJSON(w, l, err)
+	})
+	mux.HandleFunc("DELETE /admin/leases/{name}", func(w http.ResponseWriter, r *http.Request) {
+		token, err := strconv.ParseInt(r.URL.Query().Get("token"), 10, 64)
+		if err != nil {
+			http.Error(w, "invalid lease token", http.StatusBadRequest)
+			return
+		} else if err := s.ReleaseLease(Lease{Name: r.PathValue("name"), Token: token}); err != nil {
+			http.Error(w, err.Error(), HTTPStatus(err))
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+	return mux
+}
+
+// writeJSON writes v as JSON or err, if not nil.
+func writeJSON(w http.ResponseWriter, v any, err error) {
+	if err != nil {
+		http.Error(w, err.Error(), HTTPStatus(err))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeMaintenance writes the maintenance state of s or err, if not nil.
+func writeMaintenance(w http.ResponseWriter, s *Store, err error) {
+	writeJSON(w, struct {
+		Frozen bool `json:"frozen"`
+	}{s.Frozen()}, err)
+}
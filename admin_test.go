@@ -0,0 +1,119 @@
+package main_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	main "github.com/benbjohnson/application-development-using-boltdb"
+)
+
+// Ensure maintenance mode can be toggled over HTTP.
+func TestAdminHandler_Maintenance(t *testing.T) {
+	s := OpenStore()
+	defer s.Close()
+	h := main.NewAdminHandler(s.Store)
+
+	for _, tt := range []struct {
+		method string
+		frozen bool
+	}{
+		{"GET", false},
+		{"POST", true},
+		{"GET", true},
+		{"DELETE", false},
+	} {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(tt.method, "/admin/maintenance", nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: unexpected status: %d", tt.method, w.Code)
+		} else if exp := map[bool]string{false: `{"frozen":false}`, true: `{"frozen":true}`}[tt.frozen]; strings.TrimSpace(w.Body.String()) != exp {
+			t.Fatalf("%s: unexpected body: %s", tt.method, w.Body.String())
+		} else if s.Frozen() != tt.frozen {
+			t.Fatalf("%s: unexpected state: %v", tt.method, s.Frozen())
+		}
+	}
+
+	// Errors are reported with the status of their code.
+	s.Close()
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("POST", "/admin/maintenance", nil))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("unexpected status: %d", w.Code)
+	}
+}
+
+// Ensure flags can be managed over HTTP.
+func TestAdminHandler_Flags(t *testing.T) {
+	s := OpenStore()
+	defer s.Close()
+	h := main.NewAdminHandler(s.Store)
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(method, path, strings.NewReader(body)))
+		return w
+	}
+
+	if w := do("PUT", "/admin/flags/search", `{"percentage":25,"users":{"1":true}}`); w.Code != http.StatusOK {
+		t.Fatalf("unexpected status: %d %s", w.Code, w.Body.String())
+	} else if !s.FlagEnabled("search", 1) {
+		t.Fatal("expected override to enable flag")
+	}
+
+	if w := do("GET", "/admin/flags/search", ""); w.Code != http.StatusOK {
+		t.Fatalf("unexpected status: %d", w.Code)
+	} else if !strings.Contains(w.Body.String(), `"name":"search","enabled":false,"percentage":25`) {
+		t.Fatalf("unexpected body: %s", w.Body.String())
+	} else if w := do("GET", "/admin/flags", ""); w.Code != http.StatusOK || !strings.HasPrefix(w.Body.String(), `[{"name":"search"`) {
+		t.Fatalf("unexpected list: %d %s", w.Code, w.Body.String())
+	}
+
+	if w := do("PUT", "/admin/flags/search", `{"percentage":200}`); w.Code != http.StatusBadRequest {
+		t.Fatalf("unexpected status: %d", w.Code)
+	} else if w := do("DELETE", "/admin/flags/search", ""); w.Code != http.StatusNoContent {
+		t.Fatalf("unexpected status: %d", w.Code)
+	} else if w := do("GET", "/admin/flags/search", ""); w.Code != http.StatusNotFound {
+		t.Fatalf("unexpected status: %d", w.Code)
+	} else if w := do("DELETE", "/admin/flags/search", ""); w.Code != http.StatusNotFound {
+		t.Fatalf("unexpected status: %d", w.Code)
+	}
+}
+
+// Ensure leases can be acquired, renewed, and released over HTTP.
+func TestAdminHandler_Leases(t *testing.T) {
+	s := OpenStore()
+	defer s.Close()
+	h := main.NewAdminHandler(s.Store)
+
+	do := func(method, path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(method, path, nil))
+		return w
+	}
+
+	if w := do("POST", "/admin/leases/reports?ttl=1m"); w.Code != http.StatusOK {
+		t.Fatalf("unexpected status: %d %s", w.Code, w.Body.String())
+	} else if !strings.Contains(w.Body.String(), `"name":"reports","token":1,"ttl":60000000000`) {
+		t.Fatalf("unexpected body: %s", w.Body.String())
+	} else if w := do("POST", "/admin/leases/reports?ttl=1m"); w.Code != http.StatusConflict {
+		t.Fatalf("unexpected status: %d", w.Code)
+	} else if w := do("POST", "/admin/leases/other"); w.Code != http.StatusBadRequest {
+		t.Fatalf("unexpected status: %d", w.Code)
+	}
+
+	if w := do("PUT", "/admin/leases/reports?token=1"); w.Code != http.StatusOK {
+		t.Fatalf("unexpected status: %d %s", w.Code, w.Body.String())
+	} else if w := do("PUT", "/admin/leases/reports?token=2"); w.Code != http.StatusConflict {
+		t.Fatalf("unexpected status: %d", w.Code)
+	} else if w := do("GET", "/admin/leases"); w.Code != http.StatusOK || !strings.HasPrefix(w.Body.String(), `[{"name":"reports"`) {
+		t.Fatalf("unexpected list: %d %s", w.Code, w.Body.String())
+	}
+
+	if w := do("DELETE", "/admin/leases/reports?token=1"); w.Code != http.StatusNoContent {
+		t.Fatalf("unexpected status: %d", w.Code)
+	} else if w := do("DELETE", "/admin/leases/reports?token=1"); w.Code != http.StatusConflict {
+		t.Fatalf("unexpected status: %d", w.Code)
+	}
+}
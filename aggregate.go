@@ -0,0 +1,54 @@
+package main
+
+import (
+	"github.com/benbjohnson/application-development-using-boltdb/keys"
+)
+
+// AggregateUsers counts users by the group returned from groupBy.
+// Users for which groupBy returns an empty string are not counted.
+func (s *Store) AggregateUsers(groupBy func(u *User) string) (map[string]int, error) {
+	m := make(map[string]int)
+	if err := s.view("AggregateUsers", func(tx *Tx) error {
+		return scanUsers(tx, false, func(u *User) {
+			if group := groupBy(u); group != "" {
+				m[group]++
+			}
+		})
+	}); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// SignupsPerDay returns the number of users created on each day, keyed by
+// UTC date in YYYY-MM-DD format. Users without a creation time are skipped.
+func (s *Store) SignupsPerDay() (map[string]int, error) {
+	return s.AggregateUsers(func(u *User) string {
+		if u.CreatedAt.IsZero() {
+			return ""
+		}
+		return u.CreatedAt.UTC().Format("2006-01-02")
+	})
+}
+
+// UsersPerTag returns the number of users that have each tag.
+// Counts are read from the tag index so users are not decoded.
+func (s *Store) UsersPerTag() (map[string]int, error) {
+	m := make(map[string]int)
+	if err := s.view("UsersPerTag", func(tx *Tx) error {
+		return tx.Bucket([]byte("UsersByTag")).ForEach(func(k, _ []byte) error {
+			tx.recordRead("UsersByTag", nil)
+
+			r := keys.NewReader(k)
+			tag := r.ReadString()
+			if err := r.Err(); err != nil {
+				return err
+			}
+			m[tag]++
+			return nil
+		})
+	}); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
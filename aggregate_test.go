@@ -0,0 +1,75 @@
+package main_test
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	main "github.com/benbjohnson/application-development-using-boltdb"
+)
+
+// Ensure users can be counted by an arbitrary field.
+func TestStore_AggregateUsers(t *testing.T) {
+	s := OpenStore()
+	defer s.Close()
+
+	for _, username := range []string{"susy", "sam", "john"} {
+		if err := s.CreateUser(&main.User{Username: username}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Group by first letter, skipping users that start with "j".
+	m, err := s.AggregateUsers(func(u *main.User) string {
+		if u.Username[0] == 'j' {
+			return ""
+		}
+		return u.Username[:1]
+	})
+	if err != nil {
+		t.Fatal(err)
+	} else if !reflect.DeepEqual(m, map[string]int{"s": 2}) {
+		t.Fatalf("unexpected counts: %v", m)
+	}
+}
+
+// Ensure signups are counted per day.
+func TestStore_SignupsPerDay(t *testing.T) {
+	s := OpenStore()
+	defer s.Close()
+
+	day := time.Date(2016, time.June, 1, 12, 0, 0, 0, time.UTC)
+	for _, u := range []*main.User{
+		{Username: "susy", CreatedAt: day},
+		{Username: "john", CreatedAt: day.Add(6 * time.Hour)},
+		{Username: "jane", CreatedAt: day.Add(24 * time.Hour)},
+	} {
+		if err := s.CreateUser(u); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if m, err := s.SignupsPerDay(); err != nil {
+		t.Fatal(err)
+	} else if !reflect.DeepEqual(m, map[string]int{"2016-06-01": 2, "2016-06-02": 1}) {
+		t.Fatalf("unexpected counts: %v", m)
+	}
+}
+
+// Ensure users are counted per tag.
+func TestStore_UsersPerTag(t *testing.T) {
+	s := OpenStore()
+	defer s.Close()
+
+	if err := s.CreateUser(&main.User{Username: "susy", Tags: []string{"admin", "beta"}}); err != nil {
+		t.Fatal(err)
+	} else if err := s.CreateUser(&main.User{Username: "john", Tags: []string{"beta"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	if m, err := s.UsersPerTag(); err != nil {
+		t.Fatal(err)
+	} else if !reflect.DeepEqual(m, map[string]int{"admin": 1, "beta": 2}) {
+		t.Fatalf("unexpected counts: %v", m)
+	}
+}
@@ -0,0 +1,256 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// DefaultAnonymizeDomain is the default domain of fake email addresses.
+const DefaultAnonymizeDomain = "example.com"
+
+// AnonymizeRules configures how ExportAnonymized scrubs a copy.
+type AnonymizeRules struct {
+	// Key is mixed into every fake so fakes cannot be reversed by hashing
+	// guessed values. The same key always produces the same fakes, so
+	// copies made with one key can be compared with each other.
+	Key []byte
+
+	// Domain of fake email addresses. Defaults to DefaultAnonymizeDomain.
+	Domain string
+
+	// By default display names are replaced with fakes and bios and avatar
+	// URLs are cleared. KeepProfile leaves them unchanged.
+	KeepProfile bool
+
+	// By default user blobs are removed. KeepBlobs leaves them unchanged.
+	KeepBlobs bool
+}
+
+// domain returns the configured domain or the default, if unset.
+func (r *AnonymizeRules) domain() string {
+	if r.Domain == "" {
+		return DefaultAnonymizeDomain
+	}
+	return r.Domain
+}
+
+// fake returns a deterministic replacement for a value of the given kind.
+// Values are compared case-insensitively so a value fakes the same way
+// wherever it appears.
+func (r *AnonymizeRules) fake(kind, v string) string {
+	h := hmac.New(sha256.New, r.Key)
+	h.Write([]byte(kind))
+	h.Write([]byte{0})
+	h.Write([]byte(strings.ToLower(v)))
+	return hex.EncodeToString(h.Sum(nil)[:8])
+}
+
+// ExportAnonymized writes a copy of the database to dstPath with personal
+// data replaced. Usernames and emails become deterministic fakes, so the
+// same input always maps to the same output and lookups, joins, and index
+// entries behave as they do in production. Every tenant is scrubbed.
+//
+// Records that cannot be faked are removed: user history, password hashes,
+// TOTP secrets, and login failures. Identity subjects and invite emails are
+// faked and unpublished outbox events lose their data and field values.
+// Job payloads are copied unchanged.
+//
+// The copy is scrubbed before it is moved into place so dstPath never
+// holds unscrubbed data.
+func (s *Store) ExportAnonymized(dstPath string, rules AnonymizeRules) error {
+	f, err := os.CreateTemp(filepath.Dir(dstPath), filepath.Base(dstPath)+".tmp-")
+	if err != nil {
+		return err
+	}
+	f.Close()
+	defer os.Remove(f.Name())
+
+	// The copy includes every tenant even if s is scoped to one.
+	if err := s.view("ExportAnonymized", func(tx *Tx) error {
+		return tx.CopyFile(f.Name(), 0600)
+	}); err != nil {
+		return err
+	}
+
+	// Open the copy without background processes and scrub it.
+	other := s.clone()
+	other.Path, other.ReadOnly, other.tenant = f.Name(), false, ""
+	other.SnapshotPath, other.ReapInterval, other.Retention = "", -1, nil
+	other.FragmentationInterval, other.VerifyOnOpen, other.PreallocateSize = 0, false, 0
+	if err := other.Open(); err != nil {
+		return err
+	}
+	defer other.Close()
+
+	if err := other.update("ExportAnonymized", func(tx *Tx) error {
+		return anonymize(tx, &rules)
+	}); err != nil {
+		return err
+	}
+	tenants, err := other.Tenants()
+	if err != nil {
+		return err
+	}
+	for _, name := range tenants {
+		if err := other.Tenant(name).update("ExportAnonymized", func(tx *Tx) error {
+			return anonymize(tx, &rules)
+		}); err != nil {
+			return err
+		}
+	}
+
+	if err := other.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), dstPath)
+}
+
+// anonymize scrubs the personal data within the transaction's buckets.
+func anonymize(tx *Tx, rules *AnonymizeRules) error {
+	if err := anonymizeUsers(tx, rules); err != nil {
+		return err
+	} else if err := anonymizeIdentities(tx, rules); err != nil {
+		return err
+	}
+
+	// Fake the email of each invite.
+	if err := rewriteValues(tx, "Invites", func(v []byte) ([]byte, error) {
+		var i Invite
+		if err := i.UnmarshalBinary(v); err != nil {
+			return nil, err
+		}
+		i.Email = "user-" + rules.fake("email", i.Email) + "@" + rules.domain()
+		return i.MarshalBinary()
+	}); err != nil {
+		return err
+	}
+
+	if _, err := scrubEvents(tx, func(*Event) bool { return true }); err != nil {
+		return err
+	}
+
+	// Remove records that cannot be faked.
+	for _, name := range []string{"Passwords", "TOTP", "LoginAttempts"} {
+		if err := clearBucket(tx, name); err != nil {
+			return err
+		}
+	}
+	if err := deleteNestedBuckets(tx, "UserHistory"); err != nil {
+		return err
+	} else if !rules.KeepBlobs {
+		if err := deleteNestedBuckets(tx, "Blobs"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// anonymizeUsers replaces the usernames, emails, and profiles of all users.
+func anonymizeUsers(tx *Tx, rules *AnonymizeRules) error {
+	var a []*User
+	if err := tx.Bucket([]byte("Users")).ForEach(func(_, v []byte) error {
+		tx.recordRead("Users", v)
+
+		u := &User{}
+		if err := decodeUser(tx, v, u); err != nil {
+			return err
+		}
+		a = append(a, u)
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	for _, u := range a {
+		u.Username = "user-" + rules.fake("username", u.Username)
+		if u.Email != "" {
+			u.Email = "user-" + rules.fake("email", u.Email) + "@" + rules.domain()
+		}
+		if !rules.KeepProfile {
+			if u.DisplayName != "" {
+				u.DisplayName = "User " + rules.fake("display_name", u.DisplayName)
+			}
+			u.Bio, u.AvatarURL = "", ""
+		}
+		if err := saveUser(tx, u); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// anonymizeIdentities replaces the subject of every linked identity.
+func anonymizeIdentities(tx *Tx, rules *AnonymizeRules) error {
+	var a []*Identity
+	if err := tx.Bucket([]byte("Identities")).ForEach(func(_, v []byte) error {
+		tx.recordRead("Identities", v)
+
+		i := &Identity{}
+		if err := i.UnmarshalBinary(v); err != nil {
+			return err
+		}
+		a = append(a, i)
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	// Remove every old key before adding new ones to free the unique index.
+	for _, i := range a {
+		if err := deleteValue(tx, "Identities", identityKey(i.UserID, i.Provider, i.Subject)); err != nil {
+			return err
+		}
+	}
+	for _, i := range a {
+		i.Subject = rules.fake("subject", i.Provider+":"+i.Subject)
+		if buf, err := i.MarshalBinary(); err != nil {
+			return err
+		} else if err := putValue(tx, "Identities", identityKey(i.UserID, i.Provider, i.Subject), buf); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// clearBucket removes every value from the named bucket.
+func clearBucket(tx *Tx, name string) error {
+	var a [][]byte
+	if err := tx.Bucket([]byte(name)).ForEach(func(k, _ []byte) error {
+		a = append(a, append([]byte{}, k...))
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	for _, k := range a {
+		if err := deleteWithTTL(tx, name, k); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deleteNestedBuckets removes every per-user bucket within the named bucket.
+func deleteNestedBuckets(tx *Tx, name string) error {
+	bkt := tx.Bucket([]byte(name))
+
+	var a [][]byte
+	if err := bkt.ForEach(func(k, _ []byte) error {
+		a = append(a, append([]byte{}, k...))
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	for _, k := range a {
+		tx.recordDelete(name)
+		if err := bkt.DeleteBucket(k); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,111 @@
+package main_test
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"testing"
+
+	main "github.com/benbjohnson/application-development-using-boltdb"
+)
+
+// Ensure an anonymized copy replaces personal data with deterministic fakes.
+func TestStore_ExportAnonymized(t *testing.T) {
+	s := NewStore()
+	s.UserHistoryLimit = 10
+	if err := s.Open(); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	if err := s.CreateUser(&main.User{Username: "susy", Email: "susy@acme.com", DisplayName: "Susy", Bio: "Hi"}); err != nil {
+		t.Fatal(err)
+	} else if err := s.SetPassword(1, "hunter22"); err != nil {
+		t.Fatal(err)
+	} else if err := s.LinkIdentity(1, "google", "1234"); err != nil {
+		t.Fatal(err)
+	} else if _, err := s.CreateInvite("jimbo@acme.com", 1); err != nil {
+		t.Fatal(err)
+	} else if err := s.PutUserBlob(1, "bio.txt", strings.NewReader("hello")); err != nil {
+		t.Fatal(err)
+	}
+
+	rules := main.AnonymizeRules{Key: []byte("secret")}
+	path0, path1 := s.Path+".anon0", s.Path+".anon1"
+	defer os.Remove(path0)
+	defer os.Remove(path1)
+	if err := s.ExportAnonymized(path0, rules); err != nil {
+		t.Fatal(err)
+	} else if err := s.ExportAnonymized(path1, rules); err != nil {
+		t.Fatal(err)
+	}
+
+	other0 := &main.Store{Path: path0, ReadOnly: true}
+	if err := other0.Open(); err != nil {
+		t.Fatal(err)
+	}
+	defer other0.Close()
+
+	// The user keeps its ID but its personal data is replaced.
+	u, err := other0.User(1)
+	if err != nil {
+		t.Fatal(err)
+	} else if u == nil || !strings.HasPrefix(u.Username, "user-") {
+		t.Fatalf("unexpected user: %#v", u)
+	} else if !strings.HasSuffix(u.Email, "@example.com") || strings.Contains(u.Email, "susy") {
+		t.Fatalf("unexpected email: %q", u.Email)
+	} else if u.DisplayName == "Susy" || u.Bio != "" {
+		t.Fatalf("unexpected profile: %#v", u)
+	}
+
+	// Indexes point at the fakes.
+	if other, err := other0.UserByName(u.Username); err != nil {
+		t.Fatal(err)
+	} else if other == nil || other.ID != 1 {
+		t.Fatalf("unexpected user: %#v", other)
+	} else if other, err := other0.UserByName("susy"); err != nil {
+		t.Fatal(err)
+	} else if other != nil {
+		t.Fatalf("unexpected user: %#v", other)
+	} else if other, err := other0.UserByIdentity("google", "1234"); err != nil {
+		t.Fatal(err)
+	} else if other != nil {
+		t.Fatalf("unexpected user: %#v", other)
+	}
+
+	// Secrets, history, and blobs are removed and invites are faked.
+	if _, err := other0.AuthenticateUser(u.Username, "hunter22"); !errors.Is(err, main.ErrPasswordInvalid) {
+		t.Fatalf("unexpected error: %v", err)
+	} else if a, err := other0.UserHistory(1); err != nil {
+		t.Fatal(err)
+	} else if len(a) != 0 {
+		t.Fatalf("unexpected revisions: %d", len(a))
+	} else if a, err := other0.UserBlobs(1); err != nil {
+		t.Fatal(err)
+	} else if len(a) != 0 {
+		t.Fatalf("unexpected blobs: %#v", a)
+	} else if a, err := other0.PendingInvites(); err != nil {
+		t.Fatal(err)
+	} else if len(a) != 1 || strings.Contains(a[0].Email, "jimbo") {
+		t.Fatalf("unexpected invites: %#v", a)
+	}
+
+	// The same key produces the same fakes.
+	other1 := &main.Store{Path: path1, ReadOnly: true}
+	if err := other1.Open(); err != nil {
+		t.Fatal(err)
+	}
+	defer other1.Close()
+	if u1, err := other1.User(1); err != nil {
+		t.Fatal(err)
+	} else if u1.Username != u.Username || u1.Email != u.Email {
+		t.Fatalf("unexpected user: %#v", u1)
+	}
+
+	// The source is unchanged.
+	if u, err := s.User(1); err != nil {
+		t.Fatal(err)
+	} else if u.Username != "susy" {
+		t.Fatalf("unexpected username: %q", u.Username)
+	}
+}
@@ -0,0 +1,290 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/benbjohnson/application-development-using-boltdb/internal"
+	"github.com/benbjohnson/application-development-using-boltdb/keys"
+	"github.com/gogo/protobuf/proto"
+)
+
+// APIKey represents a key used to authenticate API requests.
+//
+// The secret portion of a key is only returned when the key is created.
+// The store only keeps a hash of the secret.
+type APIKey struct {
+	ID        int
+	Name      string
+	Scopes    []string
+	ExpiresAt time.Time
+	CreatedAt time.Time
+
+	hash []byte
+}
+
+// HasScope returns true if the key has been granted scope.
+func (k *APIKey) HasScope(scope string) bool {
+	for _, s := range k.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// Expired returns true if the key has an expiration that is before now.
+func (k *APIKey) Expired(now time.Time) bool {
+	return !k.ExpiresAt.IsZero() && !now.Before(k.ExpiresAt)
+}
+
+// MarshalBinary encodes a key to binary format.
+func (k *APIKey) MarshalBinary() ([]byte, error) {
+	return proto.Marshal(&internal.APIKey{
+		ID:        proto.Int64(int64(k.ID)),
+		Name:      proto.String(k.Name),
+		Hash:      k.hash,
+		Scopes:    k.Scopes,
+		ExpiresAt: proto.Int64(encodeTime(k.ExpiresAt)),
+		CreatedAt: proto.Int64(encodeTime(k.CreatedAt)),
+	})
+}
+
+// UnmarshalBinary decodes a key from binary data.
+func (k *APIKey) UnmarshalBinary(data []byte) error {
+	var pb internal.APIKey
+	if err := proto.Unmarshal(data, &pb); err != nil {
+		return err
+	}
+
+	k.ID = int(pb.GetID())
+	k.Name = pb.GetName()
+	k.hash = pb.GetHash()
+	k.Scopes = pb.GetScopes()
+	k.ExpiresAt = decodeTime(pb.GetExpiresAt())
+	k.CreatedAt = decodeTime(pb.GetCreatedAt())
+
+	return nil
+}
+
+// CreateAPIKey creates a new API key in the store and returns its token.
+// The key's ID is set to k.ID on success. The returned token is the only
+// copy of the key's secret so it must be handed to the caller immediately.
+func (s *Store) CreateAPIKey(k *APIKey) (token string, err error) {
+	// Generate a random secret for the key.
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+
+	err = s.update("CreateAPIKey", func(tx *Tx) error {
+		bkt := tx.Bucket([]byte("APIKeys"))
+
+		// Assign a new ID and only keep a hash of the secret.
+		id, err := s.nextID(bkt)
+		if err != nil {
+			return err
+		}
+		k.ID = id
+		k.CreatedAt = time.Now().UTC()
+		k.hash = hashAPIKeySecret(secret)
+
+		// Encode and save key.
+		if buf, err := k.MarshalBinary(); err != nil {
+			return err
+		} else if err := bkt.Put(keys.Int(k.ID), buf); err != nil {
+			return err
+		} else {
+			tx.recordWrite("APIKeys", buf)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	// The token includes the ID so the key can be looked up directly.
+	return fmt.Sprintf("%d.%s", k.ID, hex.EncodeToString(secret)), nil
+}
+
+// APIKey retrieves an API key by ID.
+func (s *Store) APIKey(id int) (*APIKey, error) {
+	var k *APIKey
+	if err := s.view("APIKey", func(tx *Tx) error {
+		v := tx.Bucket([]byte("APIKeys")).Get(keys.Int(id))
+		if v == nil {
+			return nil
+		}
+		tx.recordRead("APIKeys", v)
+
+		k = &APIKey{}
+		return k.UnmarshalBinary(v)
+	}); err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+// APIKeys retrieves a list of all API keys.
+func (s *Store) APIKeys() ([]*APIKey, error) {
+	var a []*APIKey
+	if err := s.view("APIKeys", func(tx *Tx) error {
+		return tx.Bucket([]byte("APIKeys")).ForEach(func(_, v []byte) error {
+			tx.recordRead("APIKeys", v)
+
+			var k APIKey
+			if err := k.UnmarshalBinary(v); err != nil {
+				return err
+			}
+			a = append(a, &k)
+			return nil
+		})
+	}); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// DeleteAPIKey revokes an API key by ID.
+func (s *Store) DeleteAPIKey(id int) error {
+	return s.update("DeleteAPIKey", func(tx *Tx) error {
+		bkt := tx.Bucket([]byte("APIKeys"))
+		if bkt.Get(keys.Int(id)) == nil {
+			return keyError("api key", id, ErrAPIKeyNotFound)
+		}
+		tx.recordDelete("APIKeys")
+		return bkt.Delete(keys.Int(id))
+	})
+}
+
+// AuthenticateAPIKey returns the API key identified by token and presented
+// from ip. Returns ErrAPIKeyInvalid if the token does not match a key and
+// ErrAPIKeyExpired if the key has expired.
+//
+// Invalid tokens count as login failures of ip, not of the key, so a caller
+// guessing secrets is stopped with ErrAccountLocked without locking out the
+// key's real clients. An empty ip is not tracked.
+func (s *Store) AuthenticateAPIKey(token, ip string) (*APIKey, error) {
+	if err := s.CheckLogin(0, ip); err != nil {
+		return nil, err
+	}
+
+	// Failures cannot be recorded by read-only stores.
+	k, err := s.authenticateAPIKey(token)
+	if errors.Is(err, ErrAPIKeyInvalid) && ip != "" && !s.ReadOnly {
+		if err := s.RecordLoginAttempt(0, ip, false); err != nil {
+			return nil, err
+		}
+	}
+	return k, err
+}
+
+// authenticateAPIKey returns the API key identified by token.
+func (s *Store) authenticateAPIKey(token string) (*APIKey, error) {
+	// Split token into its ID & secret.
+	id, secret, err := parseAPIKeyToken(token)
+	if err != nil {
+		return nil, err
+	}
+
+	// Look up the key.
+	k, err := s.APIKey(id)
+	if err != nil {
+		return nil, err
+	} else if k == nil {
+		return nil, ErrAPIKeyInvalid
+	}
+
+	// Compare hashes in constant time.
+	if subtle.ConstantTimeCompare(k.hash, hashAPIKeySecret(secret)) != 1 {
+		return nil, ErrAPIKeyInvalid
+	} else if k.Expired(time.Now()) {
+		return nil, ErrAPIKeyExpired
+	}
+	return k, nil
+}
+
+// RequireAPIKey returns a handler that authenticates requests by the API key
+// in their bearer token before passing them to h. Keys without scope are
+// rejected with a 403 response, and requests without a valid key with a 401
+// response. The key is added to the request's context so h can act on
+// behalf of it, see APIKeyFromContext.
+func RequireAPIKey(s *Store, scope string, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, ErrAPIKeyInvalid.Error(), http.StatusUnauthorized)
+			return
+		}
+
+		k, err := s.AuthenticateAPIKey(token, remoteIP(r))
+		if err != nil {
+			if ErrorCode(err) == EUNAUTHORIZED {
+				w.Header().Set("WWW-Authenticate", "Bearer")
+			} else {
+				s.logger().Error("api key authentication failed", "err", err)
+			}
+			http.Error(w, err.Error(), HTTPStatus(err))
+			return
+		} else if !k.HasScope(scope) {
+			http.Error(w, "api key lacks scope "+scope, http.StatusForbidden)
+			return
+		}
+		h.ServeHTTP(w, r.WithContext(NewAPIKeyContext(r.Context(), k)))
+	})
+}
+
+// apiKeyContextKey is the context key of the API key of a request.
+type apiKeyContextKey struct{}
+
+// NewAPIKeyContext returns a copy of ctx that carries k as the acting
+// principal.
+func NewAPIKeyContext(ctx context.Context, k *APIKey) context.Context {
+	return context.WithValue(ctx, apiKeyContextKey{}, k)
+}
+
+// APIKeyFromContext returns the API key carried by ctx or nil if there is
+// none.
+func APIKeyFromContext(ctx context.Context) *APIKey {
+	k, _ := ctx.Value(apiKeyContextKey{}).(*APIKey)
+	return k
+}
+
+// parseAPIKeyToken splits a token into its key ID and secret.
+func parseAPIKeyToken(token string) (id int, secret []byte, err error) {
+	i := strings.IndexByte(token, '.')
+	if i == -1 {
+		return 0, nil, ErrAPIKeyInvalid
+	}
+
+	if id, err = strconv.Atoi(token[:i]); err != nil {
+		return 0, nil, ErrAPIKeyInvalid
+	} else if secret, err = hex.DecodeString(token[i+1:]); err != nil {
+		return 0, nil, ErrAPIKeyInvalid
+	}
+	return id, secret, nil
+}
+
+// hashAPIKeySecret returns the hash of secret that is persisted to the store.
+func hashAPIKeySecret(secret []byte) []byte {
+	h := sha256.Sum256(secret)
+	return h[:]
+}
+
+// API key related errors.
+var (
+	ErrAPIKeyNotFound = &Error{Code: ENOTFOUND, Message: "api key not found"}
+	ErrAPIKeyInvalid  = &Error{Code: EUNAUTHORIZED, Message: "invalid api key"}
+	ErrAPIKeyExpired  = &Error{Code: EUNAUTHORIZED, Message: "api key expired"}
+)
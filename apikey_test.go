@@ -0,0 +1,159 @@
+package main_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	main "github.com/benbjohnson/application-development-using-boltdb"
+)
+
+// Ensure store can create an API key and authenticate with its token.
+func TestStore_AuthenticateAPIKey(t *testing.T) {
+	s := OpenStore()
+	defer s.Close()
+
+	// Create a new key.
+	token, err := s.CreateAPIKey(&main.APIKey{Name: "deploy", Scopes: []string{"users:read"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Verify the token resolves to the key.
+	if k, err := s.AuthenticateAPIKey(token, ""); err != nil {
+		t.Fatal(err)
+	} else if k.ID != 1 || k.Name != "deploy" {
+		t.Fatalf("unexpected key: %#v", k)
+	} else if !k.HasScope("users:read") || k.HasScope("users:write") {
+		t.Fatalf("unexpected scopes: %v", k.Scopes)
+	}
+}
+
+// Ensure store rejects tokens with an incorrect secret.
+func TestStore_AuthenticateAPIKey_ErrAPIKeyInvalid(t *testing.T) {
+	s := OpenStore()
+	defer s.Close()
+
+	if _, err := s.CreateAPIKey(&main.APIKey{Name: "deploy"}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, token := range []string{"", "1", "1.zz", "1.00", "2.00"} {
+		if _, err := s.AuthenticateAPIKey(token, ""); !errors.Is(err, main.ErrAPIKeyInvalid) {
+			t.Fatalf("unexpected error(%q): %v", token, err)
+		}
+	}
+}
+
+// Ensure store rejects expired keys.
+func TestStore_AuthenticateAPIKey_ErrAPIKeyExpired(t *testing.T) {
+	s := OpenStore()
+	defer s.Close()
+
+	token, err := s.CreateAPIKey(&main.APIKey{ExpiresAt: time.Now().Add(-time.Minute)})
+	if err != nil {
+		t.Fatal(err)
+	} else if _, err := s.AuthenticateAPIKey(token, ""); !errors.Is(err, main.ErrAPIKeyExpired) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+// Ensure store can revoke an API key.
+func TestStore_DeleteAPIKey(t *testing.T) {
+	s := OpenStore()
+	defer s.Close()
+
+	token, err := s.CreateAPIKey(&main.APIKey{Name: "deploy"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Delete the key and verify it can no longer be used.
+	if err := s.DeleteAPIKey(1); err != nil {
+		t.Fatal(err)
+	} else if _, err := s.AuthenticateAPIKey(token, ""); !errors.Is(err, main.ErrAPIKeyInvalid) {
+		t.Fatalf("unexpected error: %v", err)
+	} else if a, err := s.APIKeys(); err != nil {
+		t.Fatal(err)
+	} else if len(a) != 0 {
+		t.Fatalf("unexpected keys: %d", len(a))
+	}
+
+	// Deleting again should return an error.
+	if err := s.DeleteAPIKey(1); !errors.Is(err, main.ErrAPIKeyNotFound) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+// Ensure hostile tokens are rejected without panicking.
+func FuzzStore_AuthenticateAPIKey(f *testing.F) {
+	s := OpenStore()
+	defer s.Close()
+
+	token, err := s.CreateAPIKey(&main.APIKey{Name: "deploy"})
+	if err != nil {
+		f.Fatal(err)
+	}
+	f.Add(token)
+	f.Add("")
+	f.Add(".")
+	f.Add("1.")
+	f.Add("-1.zz")
+
+	f.Fuzz(func(t *testing.T, v string) {
+		if k, err := s.AuthenticateAPIKey(v, ""); err == nil && v != token {
+			t.Fatalf("unexpected key for %q: %#v", v, k)
+		}
+	})
+}
+
+// Ensure requests are authenticated by API key and carry it in their context.
+func TestRequireAPIKey(t *testing.T) {
+	s := OpenStore()
+	defer s.Close()
+
+	admin, err := s.CreateAPIKey(&main.APIKey{Name: "ops", Scopes: []string{"admin"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	reader, err := s.CreateAPIKey(&main.APIKey{Name: "reader", Scopes: []string{"users:read"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var principal *main.APIKey
+	h := main.RequireAPIKey(s.Store, "admin", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		principal = main.APIKeyFromContext(r.Context())
+	}))
+
+	for _, tt := range []struct {
+		header string
+		code   int
+	}{
+		{"", http.StatusUnauthorized},
+		{"Basic " + admin, http.StatusUnauthorized},
+		{"Bearer 1.00", http.StatusUnauthorized},
+		{"Bearer " + reader, http.StatusForbidden},
+		{"Bearer " + admin, http.StatusOK},
+	} {
+		principal = nil
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("GET", "/", nil)
+		if tt.header != "" {
+			r.Header.Set("Authorization", tt.header)
+		}
+		h.ServeHTTP(w, r)
+		if w.Code != tt.code {
+			t.Fatalf("%q: unexpected status: %d", tt.header, w.Code)
+		} else if w.Code == http.StatusUnauthorized && w.Header().Get("WWW-Authenticate") != "Bearer" {
+			t.Fatalf("%q: unexpected challenge: %q", tt.header, w.Header().Get("WWW-Authenticate"))
+		} else if (w.Code == http.StatusOK) != (principal != nil) {
+			t.Fatalf("%q: unexpected principal: %#v", tt.header, principal)
+		}
+	}
+	if principal.Name != "ops" {
+		t.Fatalf("unexpected principal: %#v", principal)
+	}
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// snapshotTimeFormat is the format of the time suffix of retained snapshots.
+// It sorts lexicographically in chronological order.
+const snapshotTimeFormat = "20060102T150405.000000000Z"
+
+// Snapshot is a read-only store opened from a retained snapshot.
+type Snapshot struct {
+	*Store
+
+	// Time the snapshot was taken.
+	Time time.Time
+}
+
+// RetainSnapshot writes a snapshot to SnapshotPath and keeps a read-only
+// copy named after the snapshot time for use by AsOf. Copies beyond
+// SnapshotRetain are removed, oldest first.
+//
+// This is called automatically every SnapshotInterval if SnapshotRetain
+// is set.
+func (s *Store) RetainSnapshot() error {
+	if s.SnapshotPath == "" {
+		return ErrSnapshotPathRequired
+	} else if err := s.Snapshot(s.SnapshotPath); err != nil {
+		return err
+	}
+
+	fi, err := os.Stat(s.SnapshotPath)
+	if err != nil {
+		return err
+	}
+
+	// Snapshots are always written to a new file so the current one can be
+	// linked instead of copied. Fall back to another snapshot if linking
+	// is not supported.
+	path := s.SnapshotPath + "." + fi.ModTime().UTC().Format(snapshotTimeFormat)
+	if err := os.Link(s.SnapshotPath, path); err != nil {
+		if err := s.Snapshot(path); err != nil {
+			return err
+		}
+	}
+	if err := os.Chmod(path, 0444); err != nil {
+		return err
+	}
+
+	// Remove the oldest snapshots beyond the retention limit.
+	a, err := retainedSnapshots(s.SnapshotPath)
+	if err != nil {
+		return err
+	}
+	for len(a) > s.SnapshotRetain {
+		if err := os.Remove(a[0].path); err != nil {
+			return err
+		}
+		a = a[1:]
+	}
+	return nil
+}
+
+// AsOf opens the latest retained snapshot taken at or before t. The caller
+// must close the returned snapshot. For a TenantStore, queries on the
+// snapshot are scoped to the same tenant.
+//
+// Returns ErrSnapshotNotFound if no snapshot is old enough.
+func (s *Store) AsOf(t time.Time) (*Snapshot, error) {
+	if s.SnapshotPath == "" {
+		return nil, ErrSnapshotPathRequired
+	}
+
+	a, err := retainedSnapshots(s.SnapshotPath)
+	if err != nil {
+		return nil, err
+	}
+
+	// Find the last snapshot that is not after t.
+	i := sort.Search(len(a), func(i int) bool { return a[i].time.After(t) })
+	if i == 0 {
+		return nil, ErrSnapshotNotFound
+	}
+	rs := a[i-1]
+
+	store := &Store{Path: rs.path, ReadOnly: true, LockTimeout: s.LockTimeout, Logger: s.Logger, tenant: s.tenant}
+	if err := store.Open(); err != nil {
+		return nil, err
+	}
+	return &Snapshot{Store: store, Time: rs.time}, nil
+}
+
+// retainedSnapshot is a snapshot file kept for AsOf.
+type retainedSnapshot struct {
+	path string
+	time time.Time
+}
+
+// retainedSnapshots returns the snapshots retained for path, oldest first.
+func retainedSnapshots(path string) ([]retainedSnapshot, error) {
+	matches, err := filepath.Glob(path + ".*")
+	if err != nil {
+		return nil, err
+	}
+
+	var a []retainedSnapshot
+	for _, m := range matches {
+		// Skip files that are not retained snapshots, such as temporary
+		// files from a snapshot in progress.
+		t, err := time.Parse(snapshotTimeFormat, strings.TrimPrefix(m, path+"."))
+		if err != nil {
+			continue
+		}
+		a = append(a, retainedSnapshot{path: m, time: t})
+	}
+
+	sort.Slice(a, func(i, j int) bool { return a[i].time.Before(a[j].time) })
+	return a, nil
+}
+
+// Snapshot related errors.
+var (
+	ErrSnapshotPathRequired = &Error{Code: EINVALID, Message: "snapshot path required"}
+)
@@ -0,0 +1,76 @@
+package main_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	main "github.com/benbjohnson/application-development-using-boltdb"
+)
+
+// Ensure AsOf opens the latest snapshot taken before a given time.
+func TestStore_AsOf(t *testing.T) {
+	dir := t.TempDir()
+	s := NewStore()
+	s.SnapshotPath = filepath.Join(dir, "snapshot")
+	s.SnapshotRetain = 2
+	if err := s.Open(); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	// No snapshots have been retained yet.
+	if _, err := s.AsOf(time.Now()); !errors.Is(err, main.ErrSnapshotNotFound) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// Retain a snapshot after each change to the username.
+	var times []time.Time
+	for _, name := range []string{"susy", "jimbo", "jane"} {
+		if name == "susy" {
+			if err := s.CreateUser(&main.User{Username: name}); err != nil {
+				t.Fatal(err)
+			}
+		} else if err := s.SetUsername(1, name); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := s.RetainSnapshot(); err != nil {
+			t.Fatal(err)
+		}
+		times = append(times, time.Now())
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// Only the last two snapshots are kept.
+	if matches, err := filepath.Glob(s.SnapshotPath + ".*"); err != nil {
+		t.Fatal(err)
+	} else if len(matches) != 2 {
+		t.Fatalf("unexpected snapshot count: %d", len(matches))
+	} else if fi, err := os.Stat(matches[0]); err != nil {
+		t.Fatal(err)
+	} else if fi.Mode().Perm() != 0444 {
+		t.Fatalf("unexpected mode: %s", fi.Mode())
+	}
+
+	// Query the user as of the second snapshot.
+	snap, err := s.AsOf(times[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer snap.Close()
+	if snap.Time.After(times[1]) {
+		t.Fatalf("unexpected snapshot time: %s", snap.Time)
+	} else if u, err := snap.User(1); err != nil {
+		t.Fatal(err)
+	} else if u.Username != "jimbo" {
+		t.Fatalf("unexpected username: %s", u.Username)
+	}
+
+	// The first snapshot has been removed.
+	if _, err := s.AsOf(times[0]); !errors.Is(err, main.ErrSnapshotNotFound) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// BenchCommand loads users into a store and reports the throughput and
+// latency of common operations.
+type BenchCommand struct {
+	*Main
+}
+
+// NewBenchCommand returns a new instance of BenchCommand.
+func NewBenchCommand(m *Main) *BenchCommand {
+	return &BenchCommand{Main: m}
+}
+
+// Run executes the benchmark.
+func (cmd *BenchCommand) Run(args ...string) error {
+	fs := flag.NewFlagSet("bench", flag.ContinueOnError)
+	fs.SetOutput(cmd.Stderr)
+	n := fs.Int("n", 10000, "number of users to load")
+	path := fs.String("path", "", "data file path; a temporary file is used if empty")
+	fs.Usage = func() {
+		fmt.Fprintln(cmd.Stderr, "usage: appdev bench [-n users] [-path file]")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err == flag.ErrHelp {
+		return ErrUsage
+	} else if err != nil {
+		return err
+	} else if *n <= 0 {
+		return fmt.Errorf("user count must be positive")
+	}
+
+	// Use a temporary data file unless one is specified.
+	if *path == "" {
+		dir, err := os.MkdirTemp("", "appdev-bench-")
+		if err != nil {
+			return err
+		}
+		defer os.RemoveAll(dir)
+		*path = filepath.Join(dir, "db")
+	}
+
+	s := NewStore(*path)
+	if err := s.Open(); err != nil {
+		return err
+	}
+	defer s.Close()
+
+	// Create users, one transaction each.
+	names := make([]string, *n)
+	for i := range names {
+		names[i] = fmt.Sprintf("user%08d", i)
+	}
+	cmd.report("CreateUser", *n, func(i int) error {
+		return s.CreateUser(&User{Username: names[i]})
+	})
+
+	// Look up random users by name.
+	cmd.report("UserByName", *n, func(i int) error {
+		_, err := s.UserByName(names[rand.Intn(len(names))])
+		return err
+	})
+
+	// Scan all users a few times.
+	cmd.report("Users", 10, func(i int) error {
+		_, err := s.Users()
+		return err
+	})
+
+	return nil
+}
+
+// report executes fn n times and prints the throughput and latency of op.
+// Execution stops at the first error.
+func (cmd *BenchCommand) report(op string, n int, fn func(i int) error) {
+	durations := make([]time.Duration, 0, n)
+	start := time.Now()
+	for i := 0; i < n; i++ {
+		t := time.Now()
+		if err := fn(i); err != nil {
+			fmt.Fprintf(cmd.Stderr, "%s: %s\n", op, err)
+			return
+		}
+		durations = append(durations, time.Since(t))
+	}
+	elapsed := time.Since(start)
+
+	sort.Slice(durations, func(i, j int) bool { return durations[i] < durations[j] })
+	fmt.Fprintf(cmd.Stdout, "%-12s %8d ops %12.0f ops/sec  p50=%-10s p99=%s\n",
+		op, n, float64(n)/elapsed.Seconds(),
+		percentile(durations, 0.50), percentile(durations, 0.99),
+	)
+}
+
+// percentile returns the duration at percentile p of sorted durations.
+func percentile(a []time.Duration, p float64) time.Duration {
+	if len(a) == 0 {
+		return 0
+	}
+	return a[int(float64(len(a)-1)*p)]
+}
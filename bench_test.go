@@ -0,0 +1,23 @@
+package main_test
+
+import (
+	"strings"
+	"testing"
+)
+
+// Ensure the bench command reports each operation.
+func TestBenchCommand_Run(t *testing.T) {
+	m := NewMain()
+	if err := m.Run("bench", "-n", "50"); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, op := range []string{"CreateUser", "UserByName", "Users"} {
+		if !strings.Contains(m.Stdout.String(), op+" ") {
+			t.Fatalf("missing %s in output: %s", op, m.Stdout.String())
+		}
+	}
+	if m.Stderr.Len() != 0 {
+		t.Fatalf("unexpected stderr: %s", m.Stderr.String())
+	}
+}
@@ -0,0 +1,251 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"hash"
+	"io"
+	"time"
+
+	"github.com/benbjohnson/application-development-using-boltdb/internal"
+	"github.com/benbjohnson/application-development-using-boltdb/keys"
+	"github.com/boltdb/bolt"
+	"github.com/gogo/protobuf/proto"
+)
+
+// blobChunkSize is the size of each chunk of blob content.
+const blobChunkSize = overflowChunkSize
+
+// blobInfoKey is the key of a blob's metadata within its bucket. Chunks are
+// keyed by their 8-byte index so they never collide with it.
+var blobInfoKey = []byte("info")
+
+// Blob describes a named piece of content attached to a user.
+type Blob struct {
+	Name      string
+	Size      int64
+	Checksum  []byte // SHA-256 of the content
+	CreatedAt time.Time
+}
+
+// MarshalBinary encodes a blob's metadata to binary format.
+// The name is not included since it is the key of the blob's bucket.
+func (b *Blob) MarshalBinary() ([]byte, error) {
+	return proto.Marshal(&internal.Blob{
+		Size:      proto.Int64(b.Size),
+		Checksum:  b.Checksum,
+		CreatedAt: proto.Int64(encodeTime(b.CreatedAt)),
+	})
+}
+
+// UnmarshalBinary decodes a blob's metadata from binary data.
+func (b *Blob) UnmarshalBinary(data []byte) error {
+	var pb internal.Blob
+	if err := proto.Unmarshal(data, &pb); err != nil {
+		return err
+	}
+
+	b.Size = pb.GetSize()
+	b.Checksum = pb.GetChecksum()
+	b.CreatedAt = decodeTime(pb.GetCreatedAt())
+
+	return nil
+}
+
+// PutUserBlob stores the contents of r as the user's blob with the given
+// name, replacing any existing blob with that name.
+//
+// The content is read fully before the write transaction starts so that a
+// slow reader does not block other writers.
+func (s *Store) PutUserBlob(userID int, name string, r io.Reader) error {
+	if name == "" {
+		return ErrBlobNameRequired
+	}
+
+	// Read content into chunks while computing the checksum.
+	var chunks [][]byte
+	h := sha256.New()
+	var size int64
+	for {
+		buf := make([]byte, blobChunkSize)
+		n, err := io.ReadFull(r, buf)
+		if n > 0 {
+			chunks = append(chunks, buf[:n])
+			h.Write(buf[:n])
+			size += int64(n)
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		} else if err != nil {
+			return err
+		}
+	}
+	b := &Blob{Name: name, Size: size, Checksum: h.Sum(nil), CreatedAt: time.Now().UTC()}
+
+	return s.update("PutUserBlob", func(tx *Tx) error {
+		if v := tx.Bucket([]byte("Users")).Get(keys.Int(userID)); v == nil {
+			return keyError("user", userID, ErrUserNotFound)
+		}
+
+		// Replace the blob's bucket entirely.
+		ubkt, err := tx.Bucket([]byte("Blobs")).CreateBucketIfNotExists(keys.Int(userID))
+		if err != nil {
+			return err
+		} else if err := ubkt.DeleteBucket([]byte(name)); err != nil && err != bolt.ErrBucketNotFound {
+			return err
+		}
+		bkt, err := ubkt.CreateBucket([]byte(name))
+		if err != nil {
+			return err
+		}
+
+		for i, chunk := range chunks {
+			tx.recordWrite("Blobs", chunk)
+			if err := bkt.Put(keys.Int(i), chunk); err != nil {
+				return err
+			}
+		}
+
+		buf, err := b.MarshalBinary()
+		if err != nil {
+			return err
+		}
+		tx.recordWrite("Blobs", buf)
+		return bkt.Put(blobInfoKey, buf)
+	})
+}
+
+// UserBlob returns a reader for the content of the user's named blob.
+//
+// The reader holds a read transaction open until it is closed so the caller
+// must always close it. Returns ErrBlobChecksumMismatch from Read if the
+// content does not match its checksum.
+func (s *Store) UserBlob(userID int, name string) (io.ReadCloser, error) {
+	tx, err := s.begin("UserBlob", false)
+	if err != nil {
+		return nil, err
+	}
+
+	r, err := newBlobReader(tx, userID, name)
+	if err != nil {
+		tx.err = err
+		tx.Rollback()
+		return nil, err
+	}
+	return r, nil
+}
+
+// UserBlobs returns metadata for all of a user's blobs, ordered by name.
+func (s *Store) UserBlobs(userID int) ([]*Blob, error) {
+	var a []*Blob
+	if err := s.view("UserBlobs", func(tx *Tx) error {
+		ubkt := tx.Bucket([]byte("Blobs")).Bucket(keys.Int(userID))
+		if ubkt == nil {
+			return nil
+		}
+
+		return ubkt.ForEach(func(k, _ []byte) error {
+			v := ubkt.Bucket(k).Get(blobInfoKey)
+			tx.recordRead("Blobs", v)
+
+			b := &Blob{Name: string(k)}
+			if err := b.UnmarshalBinary(v); err != nil {
+				return err
+			}
+			a = append(a, b)
+			return nil
+		})
+	}); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// DeleteUserBlob removes the user's named blob.
+// Returns ErrBlobNotFound if the blob does not exist.
+func (s *Store) DeleteUserBlob(userID int, name string) error {
+	return s.update("DeleteUserBlob", func(tx *Tx) error {
+		ubkt := tx.Bucket([]byte("Blobs")).Bucket(keys.Int(userID))
+		if ubkt == nil || ubkt.Bucket([]byte(name)) == nil {
+			return keyError("blob", name, ErrBlobNotFound)
+		}
+		tx.recordDelete("Blobs")
+		return ubkt.DeleteBucket([]byte(name))
+	})
+}
+
+// deleteUserBlobs removes all blobs belonging to a user.
+func deleteUserBlobs(tx *Tx, userID int) error {
+	bkt := tx.Bucket([]byte("Blobs"))
+	if bkt.Bucket(keys.Int(userID)) == nil {
+		return nil
+	}
+	tx.recordDelete("Blobs")
+	return bkt.DeleteBucket(keys.Int(userID))
+}
+
+// userBlobBucket returns the bucket holding a blob or nil if it does not exist.
+func userBlobBucket(tx *Tx, userID int, name string) *bolt.Bucket {
+	ubkt := tx.Bucket([]byte("Blobs")).Bucket(keys.Int(userID))
+	if ubkt == nil {
+		return nil
+	}
+	return ubkt.Bucket([]byte(name))
+}
+
+// newBlobReader returns a reader for a blob within tx.
+func newBlobReader(tx *Tx, userID int, name string) (*blobReader, error) {
+	bkt := userBlobBucket(tx, userID, name)
+	if bkt == nil {
+		return nil, keyError("blob", name, ErrBlobNotFound)
+	}
+
+	var b Blob
+	if err := b.UnmarshalBinary(bkt.Get(blobInfoKey)); err != nil {
+		return nil, err
+	}
+	return &blobReader{tx: tx, bkt: bkt, checksum: b.Checksum, hash: sha256.New()}, nil
+}
+
+// blobReader streams the chunks of a blob and verifies its checksum.
+type blobReader struct {
+	tx       *Tx
+	bkt      *bolt.Bucket
+	i        int    // index of the next chunk
+	buf      []byte // unread portion of the current chunk
+	checksum []byte
+	hash     hash.Hash
+}
+
+// Read reads content from the current chunk, advancing to the next as needed.
+func (r *blobReader) Read(p []byte) (int, error) {
+	for len(r.buf) == 0 {
+		chunk := r.bkt.Get(keys.Int(r.i))
+		if chunk == nil {
+			// Verify the content once all chunks have been read.
+			if !bytes.Equal(r.hash.Sum(nil), r.checksum) {
+				return 0, ErrBlobChecksumMismatch
+			}
+			return 0, io.EOF
+		}
+		r.tx.recordRead("Blobs", chunk)
+		r.hash.Write(chunk)
+		r.buf, r.i = chunk, r.i+1
+	}
+
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+	return n, nil
+}
+
+// Close releases the read transaction.
+func (r *blobReader) Close() error {
+	return r.tx.Rollback()
+}
+
+// Blob related errors.
+var (
+	ErrBlobNameRequired     = &Error{Code: EINVALID, Message: "blob name required"}
+	ErrBlobNotFound         = &Error{Code: ENOTFOUND, Message: "blob not found"}
+	ErrBlobChecksumMismatch = &Error{Code: EINTERNAL, Message: "blob checksum mismatch"}
+)
@@ -0,0 +1,129 @@
+package main_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	main "github.com/benbjohnson/application-development-using-boltdb"
+	"github.com/benbjohnson/application-development-using-boltdb/keys"
+	"github.com/boltdb/bolt"
+)
+
+// Ensure blobs can be stored, listed, read, and deleted.
+func TestStore_PutUserBlob(t *testing.T) {
+	s := OpenStore()
+	defer s.Close()
+
+	if err := s.CreateUser(&main.User{Username: "susy"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Store a blob spanning several chunks and a small one.
+	content := strings.Repeat("avatar", 2000)
+	if err := s.PutUserBlob(1, "avatar.png", strings.NewReader(content)); err != nil {
+		t.Fatal(err)
+	} else if err := s.PutUserBlob(1, "bio.txt", strings.NewReader("hi")); err != nil {
+		t.Fatal(err)
+	}
+
+	if a, err := s.UserBlobs(1); err != nil {
+		t.Fatal(err)
+	} else if len(a) != 2 || a[0].Name != "avatar.png" || a[0].Size != int64(len(content)) || a[1].Name != "bio.txt" {
+		t.Fatalf("unexpected blobs: %#v", a)
+	}
+
+	// Read the blob back.
+	if rc, err := s.UserBlob(1, "avatar.png"); err != nil {
+		t.Fatal(err)
+	} else if buf, err := io.ReadAll(rc); err != nil {
+		t.Fatal(err)
+	} else if string(buf) != content {
+		t.Fatalf("unexpected content: %d bytes", len(buf))
+	} else if err := rc.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Replace the blob with an empty one.
+	if err := s.PutUserBlob(1, "avatar.png", &bytes.Buffer{}); err != nil {
+		t.Fatal(err)
+	} else if rc, err := s.UserBlob(1, "avatar.png"); err != nil {
+		t.Fatal(err)
+	} else if buf, err := io.ReadAll(rc); err != nil {
+		t.Fatal(err)
+	} else if len(buf) != 0 {
+		t.Fatalf("unexpected content: %d bytes", len(buf))
+	} else {
+		rc.Close()
+	}
+
+	// Delete a blob.
+	if err := s.DeleteUserBlob(1, "bio.txt"); err != nil {
+		t.Fatal(err)
+	} else if _, err := s.UserBlob(1, "bio.txt"); !errors.Is(err, main.ErrBlobNotFound) {
+		t.Fatalf("unexpected error: %v", err)
+	} else if err := s.DeleteUserBlob(1, "bio.txt"); !errors.Is(err, main.ErrBlobNotFound) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// Deleting the user deletes its blobs.
+	if err := s.DeleteUser(1); err != nil {
+		t.Fatal(err)
+	} else if a, err := s.UserBlobs(1); err != nil {
+		t.Fatal(err)
+	} else if len(a) != 0 {
+		t.Fatalf("unexpected blobs: %#v", a)
+	}
+}
+
+// Ensure blobs cannot be attached to missing users or without a name.
+func TestStore_PutUserBlob_Err(t *testing.T) {
+	s := OpenStore()
+	defer s.Close()
+
+	if err := s.PutUserBlob(1, "avatar.png", strings.NewReader("x")); !errors.Is(err, main.ErrUserNotFound) {
+		t.Fatalf("unexpected error: %v", err)
+	} else if err := s.PutUserBlob(1, "", strings.NewReader("x")); !errors.Is(err, main.ErrBlobNameRequired) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+// Ensure corrupted blob content is detected when read.
+func TestStore_UserBlob_ErrBlobChecksumMismatch(t *testing.T) {
+	s := OpenStore()
+	defer s.Close()
+
+	if err := s.CreateUser(&main.User{Username: "susy"}); err != nil {
+		t.Fatal(err)
+	} else if err := s.PutUserBlob(1, "bio.txt", strings.NewReader("hello")); err != nil {
+		t.Fatal(err)
+	} else if err := s.Store.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Overwrite the first chunk directly.
+	db, err := bolt.Open(s.Path, 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte("Blobs")).Bucket(keys.Int(1)).Bucket([]byte("bio.txt")).Put(keys.Int(0), []byte("jello"))
+	}); err != nil {
+		t.Fatal(err)
+	} else if err := db.Close(); err != nil {
+		t.Fatal(err)
+	} else if err := s.Open(); err != nil {
+		t.Fatal(err)
+	}
+
+	rc, err := s.UserBlob(1, "bio.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.Close()
+	if _, err := io.ReadAll(rc); !errors.Is(err, main.ErrBlobChecksumMismatch) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"os"
+
+	"github.com/boltdb/bolt"
+)
+
+// BulkLoad executes fn with fsync disabled on commit and syncs once to disk
+// after fn returns. This is intended for large imports where fn commits many
+// transactions and per-commit fsync would dominate the load time.
+//
+// Data committed during fn is not durable until BulkLoad returns. Writes made
+// by other goroutines during fn are also not synced until then.
+func (s *Store) BulkLoad(fn func() error) error {
+	if err := s.setNoSync(true); err != nil {
+		return err
+	}
+
+	// Run the load and restore sync behavior regardless of the result.
+	fnErr := fn()
+	if err := s.setNoSync(false); err != nil {
+		return err
+	}
+
+	// Force everything committed during the load to disk.
+	if err := s.rlock(); err != nil {
+		return err
+	}
+	defer s.db.mu.RUnlock()
+	if err := s.db.Sync(); err != nil {
+		return err
+	}
+	return fnErr
+}
+
+// setNoSync sets the NoSync flag on the database. The flag is changed while
+// holding the writer lock so it is not modified while a commit is in progress.
+func (s *Store) setNoSync(v bool) error {
+	if err := s.rlock(); err != nil {
+		return err
+	}
+	defer s.db.mu.RUnlock()
+
+	tx, err := s.db.Begin(true)
+	if err != nil {
+		return err
+	}
+	s.db.NoSync = v
+	return tx.Rollback()
+}
+
+// Preallocate grows the data file to at least n bytes so that large imports
+// write into space that is already allocated instead of repeatedly growing
+// and syncing the file. The file is not shrunk if it is already larger.
+//
+// Bolt would truncate a preallocated file back to the size of its data the
+// next time it grows the file, so growth syncs are disabled afterwards. The
+// size of the preallocated file is already durable and commits still sync
+// the data written beyond it.
+func (s *Store) Preallocate(n int64) error {
+	if s.ReadOnly {
+		return bolt.ErrDatabaseReadOnly
+	}
+
+	// Hold the writer lock so the file is not grown by a commit meanwhile.
+	if err := s.rlock(); err != nil {
+		return err
+	}
+	defer s.db.mu.RUnlock()
+	tx, err := s.db.Begin(true)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	f, err := os.OpenFile(s.Path, os.O_RDWR, 0)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	// Growth syncs are disabled even if the file is large enough already
+	// since it may have been preallocated before the store was reopened.
+	s.db.NoGrowSync = true
+	if fi, err := f.Stat(); err != nil {
+		return err
+	} else if fi.Size() >= n {
+		return nil
+	} else if err := f.Truncate(n); err != nil {
+		return err
+	} else if err := f.Sync(); err != nil {
+		return err
+	}
+
+	s.logger().Info("data file preallocated", "path", s.Path, "size", n)
+	return nil
+}
@@ -0,0 +1,103 @@
+package main_test
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+
+	main "github.com/benbjohnson/application-development-using-boltdb"
+)
+
+// Ensure users created during a bulk load are persisted.
+func TestStore_BulkLoad(t *testing.T) {
+	s := OpenStore()
+	defer s.Close()
+
+	if err := s.BulkLoad(func() error {
+		for i := 0; i < 100; i++ {
+			if err := s.CreateUser(&main.User{Username: fmt.Sprintf("user%d", i)}); err != nil {
+				return err
+			}
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Reopen the store and verify all users exist.
+	if err := s.Reopen(); err != nil {
+		t.Fatal(err)
+	} else if a, err := s.Users(); err != nil {
+		t.Fatal(err)
+	} else if len(a) != 100 {
+		t.Fatalf("unexpected user count: %d", len(a))
+	}
+}
+
+// Ensure an error from the load function is returned.
+func TestStore_BulkLoad_Error(t *testing.T) {
+	s := OpenStore()
+	defer s.Close()
+
+	errMarker := errors.New("marker")
+	if err := s.BulkLoad(func() error { return errMarker }); err != errMarker {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+// Ensure the data file can be preallocated and keeps its size as data is
+// written.
+func TestStore_Preallocate(t *testing.T) {
+	s := NewStore()
+	s.PreallocateSize = 8 << 20
+	s.AllocSize = 1 << 20
+	s.InitialMmapSize = 16 << 20
+	if err := s.Open(); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	size := func() int64 {
+		fi, err := os.Stat(s.Path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return fi.Size()
+	}
+	if n := size(); n != 8<<20 {
+		t.Fatalf("unexpected size after open: %d", n)
+	}
+
+	// Writes must not truncate the preallocated space.
+	for i := 0; i < 100; i++ {
+		if err := s.CreateUser(&main.User{Username: fmt.Sprintf("user%d", i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := size(); n != 8<<20 {
+		t.Fatalf("unexpected size after writes: %d", n)
+	}
+
+	// Preallocating less than the current size is a no-op.
+	if err := s.Preallocate(32 << 20); err != nil {
+		t.Fatal(err)
+	} else if err := s.Preallocate(1 << 20); err != nil {
+		t.Fatal(err)
+	} else if n := size(); n != 32<<20 {
+		t.Fatalf("unexpected size after preallocate: %d", n)
+	}
+
+	// The file keeps its size after reopening with a smaller preallocation.
+	if err := s.Reopen(); err != nil {
+		t.Fatal(err)
+	} else if err := s.CreateUser(&main.User{Username: "susy"}); err != nil {
+		t.Fatal(err)
+	} else if n := size(); n != 32<<20 {
+		t.Fatalf("unexpected size after reopen: %d", n)
+	} else if a, err := s.Users(); err != nil {
+		t.Fatal(err)
+	} else if len(a) != 101 {
+		t.Fatalf("unexpected user count: %d", len(a))
+	}
+}
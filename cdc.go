@@ -0,0 +1,393 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/benbjohnson/application-development-using-boltdb/keys"
+)
+
+// ChangeCapture defaults.
+const (
+	DefaultChangeCaptureName      = "bolt"
+	DefaultChangeCaptureInterval  = 1 * time.Second
+	DefaultChangeCaptureBatchSize = 100
+	DefaultKafkaRESTTimeout       = 10 * time.Second
+)
+
+// Operations of a change envelope, as used by Debezium.
+const (
+	ChangeCreate = "c"
+	ChangeUpdate = "u"
+	ChangeDelete = "d"
+)
+
+// ChangeEnvelope describes a change to a user in the format of a Debezium
+// change event value, without the schema. Rows are keyed by the snake case
+// field names used by FieldChange.
+type ChangeEnvelope struct {
+	Before map[string]any `json:"before"`
+	After  map[string]any `json:"after"`
+	Source ChangeSource   `json:"source"`
+	Op     string         `json:"op"`
+	TsMs   int64          `json:"ts_ms"`
+}
+
+// Key returns the key of the changed row, such as for partitioning.
+func (e *ChangeEnvelope) Key() map[string]any {
+	return map[string]any{"id": e.Source.UserID}
+}
+
+// ChangeSource describes where a change came from.
+type ChangeSource struct {
+	Connector string `json:"connector"`
+	Name      string `json:"name"`
+	DB        string `json:"db"`
+	Table     string `json:"table"`
+	Sequence  int    `json:"sequence"` // ID of the outbox event
+	Event     string `json:"event"`    // type of the outbox event
+	UserID    int    `json:"user_id"`
+	TsMs      int64  `json:"ts_ms"`
+}
+
+// ChangeSink writes change envelopes to an external system such as Kafka.
+// Envelopes are written in order and may be written more than once, so
+// consumers should ignore envelopes with a sequence they have already seen.
+type ChangeSink interface {
+	WriteChanges(ctx context.Context, a []*ChangeEnvelope) error
+}
+
+// ChangeCapture exports the events in a store's outbox as change envelopes.
+//
+// Unlike a Relay, it does not remove events. The ID of the last event
+// written to the sink is saved in the "ChangeOffsets" bucket under Name so
+// exporting resumes where it stopped, and the outbox is kept to a bounded
+// size with a RetainOutbox retention policy instead. It must not run
+// alongside a Relay, which removes events as it publishes them.
+type ChangeCapture struct {
+	closing chan struct{}
+	wg      sync.WaitGroup
+
+	// Store to read events from.
+	Store *Store
+
+	// Destination for change envelopes.
+	Sink ChangeSink
+
+	// Name of the export, used as the source name of envelopes and to save
+	// its offset. Defaults to DefaultChangeCaptureName.
+	Name string
+
+	// Time between checks for new events.
+	// Defaults to DefaultChangeCaptureInterval.
+	Interval time.Duration
+
+	// Maximum number of events written per flush.
+	// Defaults to DefaultChangeCaptureBatchSize.
+	BatchSize int
+}
+
+// Open starts exporting events in the background.
+func (c *ChangeCapture) Open() error {
+	c.closing = make(chan struct{})
+	c.wg.Add(1)
+	go func() { defer c.wg.Done(); c.monitor() }()
+	return nil
+}
+
+// Close stops exporting events.
+func (c *ChangeCapture) Close() error {
+	if c.closing != nil {
+		close(c.closing)
+		c.wg.Wait()
+		c.closing = nil
+	}
+	return nil
+}
+
+// monitor flushes new events on every interval until closed.
+func (c *ChangeCapture) monitor() {
+	interval := c.Interval
+	if interval <= 0 {
+		interval = DefaultChangeCaptureInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.closing:
+			return
+		case <-ticker.C:
+			for {
+				n, err := c.Flush(context.Background())
+				if err != nil {
+					c.Store.logger().Error("change capture failed", "err", err)
+				}
+				if err != nil || n < c.batchSize() {
+					break
+				}
+			}
+		}
+	}
+}
+
+// Flush writes the next batch of events after the saved offset to the sink
+// and returns the number written. The offset only advances once the sink
+// accepts the whole batch.
+func (c *ChangeCapture) Flush(ctx context.Context) (int, error) {
+	var events []*Event
+	if err := c.Store.view("ChangeCapture", func(tx *Tx) error {
+		cur := tx.Bucket([]byte("Outbox")).Cursor()
+		for k, v := cur.Seek(keys.Int(changeOffset(tx, c.name()) + 1)); k != nil && len(events) < c.batchSize(); k, v = cur.Next() {
+			tx.recordRead("Outbox", v)
+
+			e := &Event{}
+			if err := e.UnmarshalBinary(v); err != nil {
+				return err
+			}
+			events = append(events, e)
+		}
+		return nil
+	}); err != nil {
+		return 0, err
+	} else if len(events) == 0 {
+		return 0, nil
+	}
+
+	a := make([]*ChangeEnvelope, len(events))
+	for i, e := range events {
+		env, err := c.envelope(e)
+		if err != nil {
+			return 0, err
+		}
+		a[i] = env
+	}
+
+	// Write outside of a transaction so slow sinks don't block writers.
+	if err := c.Sink.WriteChanges(ctx, a); err != nil {
+		return 0, err
+	}
+
+	seq := events[len(events)-1].ID
+	if err := c.Store.update("ChangeCaptureAck", func(tx *Tx) error {
+		if seq <= changeOffset(tx, c.name()) {
+			return nil
+		}
+		tx.recordWrite("ChangeOffsets", nil)
+		return tx.Bucket([]byte("ChangeOffsets")).Put([]byte(c.name()), keys.Int(seq))
+	}); err != nil {
+		return 0, err
+	}
+	return len(events), nil
+}
+
+// Offset returns the ID of the last event written to the sink.
+func (c *ChangeCapture) Offset() (int, error) {
+	var seq int
+	if err := c.Store.view("ChangeOffset", func(tx *Tx) error {
+		seq = changeOffset(tx, c.name())
+		return nil
+	}); err != nil {
+		return 0, err
+	}
+	return seq, nil
+}
+
+// envelope converts an outbox event to a change envelope.
+func (c *ChangeCapture) envelope(e *Event) (*ChangeEnvelope, error) {
+	env := &ChangeEnvelope{
+		Source: ChangeSource{
+			Connector: "bolt",
+			Name:      c.name(),
+			DB:        filepath.Base(c.Store.Path),
+			Table:     "users",
+			Sequence:  e.ID,
+			Event:     e.Type,
+			UserID:    e.UserID,
+			TsMs:      e.CreatedAt.UnixMilli(),
+		},
+		TsMs: time.Now().UnixMilli(),
+	}
+
+	u, err := e.User()
+	if err != nil {
+		return nil, err
+	}
+
+	switch e.Type {
+	case EventUserCreated:
+		env.Op, env.After = ChangeCreate, changeRow(u)
+	case EventUserDeleted:
+		// The outbox does not keep deleted users so only the key is known.
+		env.Op, env.Before = ChangeDelete, map[string]any{"id": e.UserID}
+	default:
+		env.Op, env.After = ChangeUpdate, changeRow(u)
+		env.Before = changeRow(u)
+		for _, fc := range e.Changes {
+			if fc.Field == "tags" {
+				env.Before[fc.Field] = splitTags(fc.Old)
+			} else {
+				env.Before[fc.Field] = fc.Old
+			}
+		}
+	}
+	return env, nil
+}
+
+// name returns the configured name or the default, if unset.
+func (c *ChangeCapture) name() string {
+	if c.Name == "" {
+		return DefaultChangeCaptureName
+	}
+	return c.Name
+}
+
+// batchSize returns the configured batch size or the default, if unset.
+func (c *ChangeCapture) batchSize() int {
+	if c.BatchSize <= 0 {
+		return DefaultChangeCaptureBatchSize
+	}
+	return c.BatchSize
+}
+
+// changeOffset returns the saved offset of the named export or zero.
+func changeOffset(tx *Tx, name string) int {
+	v := tx.Bucket([]byte("ChangeOffsets")).Get([]byte(name))
+	if v == nil {
+		return 0
+	}
+	tx.recordRead("ChangeOffsets", v)
+	return keys.NewReader(v).ReadInt()
+}
+
+// changeRow returns the fields of u keyed as in FieldChange.
+func changeRow(u *User) map[string]any {
+	return map[string]any{
+		"id":                u.ID,
+		"username":          u.Username,
+		"tags":              append([]string{}, u.Tags...),
+		"created_at":        u.CreatedAt,
+		"display_name":      u.DisplayName,
+		"bio":               u.Bio,
+		"avatar_url":        u.AvatarURL,
+		"locale":            u.Locale,
+		"email":             u.Email,
+		"status":            u.Status.String(),
+		"status_reason":     u.StatusReason,
+		"status_changed_at": u.StatusChangedAt,
+	}
+}
+
+// splitTags reverses the comma-joined tags of a FieldChange.
+func splitTags(s string) []string {
+	if s == "" {
+		return []string{}
+	}
+	return strings.Split(s, ",")
+}
+
+// FileChangeSink appends change envelopes to a file as JSON, one per line.
+// The file is synced after each batch.
+type FileChangeSink struct {
+	Path string
+}
+
+// WriteChanges appends a to the file, creating it if needed.
+func (s *FileChangeSink) WriteChanges(ctx context.Context, a []*ChangeEnvelope) error {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, env := range a {
+		if err := enc.Encode(env); err != nil {
+			return err
+		}
+	}
+
+	f, err := os.OpenFile(s.Path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0666)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if _, err := f.Write(buf.Bytes()); err != nil {
+		return err
+	} else if err := f.Sync(); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// KafkaRESTSink produces change envelopes to a Kafka topic through a Kafka
+// REST proxy, such as the Confluent REST Proxy or Redpanda's HTTP proxy.
+// Records are keyed by user ID so changes to a user stay in one partition
+// and are read in order.
+type KafkaRESTSink struct {
+	// Base URL of the proxy, such as "http://localhost:8082".
+	URL string
+
+	// Topic to produce to.
+	Topic string
+
+	// Client used to send requests. Defaults to a client with a
+	// DefaultKafkaRESTTimeout timeout.
+	Client *http.Client
+}
+
+// WriteChanges produces a to the topic in a single request.
+func (s *KafkaRESTSink) WriteChanges(ctx context.Context, a []*ChangeEnvelope) error {
+	if s.Topic == "" {
+		return ErrChangeTopicRequired
+	}
+
+	type record struct {
+		Key   map[string]any  `json:"key"`
+		Value *ChangeEnvelope `json:"value"`
+	}
+	var body struct {
+		Records []record `json:"records"`
+	}
+	for _, env := range a {
+		body.Records = append(body.Records, record{Key: env.Key(), Value: env})
+	}
+	buf, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", strings.TrimSuffix(s.URL, "/")+"/topics/"+s.Topic, bytes.NewReader(buf))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/vnd.kafka.json.v2+json")
+	req.Header.Set("Accept", "application/vnd.kafka.v2+json")
+
+	client := s.Client
+	if client == nil {
+		client = &http.Client{Timeout: DefaultKafkaRESTTimeout}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("kafka rest proxy returned %s", resp.Status)
+	}
+	return nil
+}
+
+// Change capture related errors.
+var (
+	ErrChangeTopicRequired = &Error{Code: EINVALID, Message: "change topic required"}
+)
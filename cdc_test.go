@@ -0,0 +1,220 @@
+package main_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+
+	main "github.com/benbjohnson/application-development-using-boltdb"
+)
+
+// Ensure outbox events are exported as change envelopes from the saved
+// offset.
+func TestChangeCapture_Flush(t *testing.T) {
+	s := OpenStore()
+	defer s.Close()
+	s.Outbox = true
+
+	if err := s.CreateUser(&main.User{Username: "susy"}); err != nil {
+		t.Fatal(err)
+	} else if err := s.SetUsername(1, "jimbo"); err != nil {
+		t.Fatal(err)
+	} else if err := s.AddTag(1, "beta"); err != nil {
+		t.Fatal(err)
+	} else if err := s.DeleteUser(1); err != nil {
+		t.Fatal(err)
+	}
+
+	var sink ChangeSink
+	c := &main.ChangeCapture{Store: s.Store, Sink: &sink, BatchSize: 3}
+	if n, err := c.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	} else if n != 3 {
+		t.Fatalf("unexpected count: %d", n)
+	} else if n, err := c.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	} else if n != 1 {
+		t.Fatalf("unexpected count: %d", n)
+	} else if n, err := c.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	} else if n != 0 {
+		t.Fatalf("unexpected count: %d", n)
+	}
+
+	a := sink.Envelopes()
+	if ops := []string{a[0].Op, a[1].Op, a[2].Op, a[3].Op}; !reflect.DeepEqual(ops, []string{"c", "u", "u", "d"}) {
+		t.Fatalf("unexpected ops: %v", ops)
+	} else if a[0].Before != nil || a[0].After["username"] != "susy" {
+		t.Fatalf("unexpected create: %#v", a[0])
+	} else if a[1].Before["username"] != "susy" || a[1].After["username"] != "jimbo" {
+		t.Fatalf("unexpected update: %#v", a[1])
+	} else if !reflect.DeepEqual(a[2].Before["tags"], []string{}) || !reflect.DeepEqual(a[2].After["tags"], []string{"beta"}) {
+		t.Fatalf("unexpected update: %#v", a[2])
+	} else if a[3].After != nil || a[3].Before["id"] != 1 {
+		t.Fatalf("unexpected delete: %#v", a[3])
+	} else if src := a[3].Source; src.Name != "bolt" || src.Table != "users" || src.Sequence != 4 || src.Event != "user.deleted" {
+		t.Fatalf("unexpected source: %#v", src)
+	}
+
+	// Events are kept and the offset survives reopening the store.
+	if err := s.Reopen(); err != nil {
+		t.Fatal(err)
+	} else if err := s.CreateUser(&main.User{Username: "bob"}); err != nil {
+		t.Fatal(err)
+	}
+	c = &main.ChangeCapture{Store: s.Store, Sink: &sink}
+	if seq, err := c.Offset(); err != nil {
+		t.Fatal(err)
+	} else if seq != 4 {
+		t.Fatalf("unexpected offset: %d", seq)
+	} else if n, err := c.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	} else if n != 1 {
+		t.Fatalf("unexpected count: %d", n)
+	}
+
+	// Exports with another name start from the beginning.
+	var other ChangeSink
+	c = &main.ChangeCapture{Store: s.Store, Sink: &other, Name: "audit"}
+	if n, err := c.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	} else if n != 5 {
+		t.Fatalf("unexpected count: %d", n)
+	}
+}
+
+// Ensure the offset does not advance when the sink fails.
+func TestChangeCapture_Flush_SinkError(t *testing.T) {
+	s := OpenStore()
+	defer s.Close()
+	s.Outbox = true
+
+	if err := s.CreateUser(&main.User{Username: "susy"}); err != nil {
+		t.Fatal(err)
+	}
+
+	sink := ChangeSink{Err: errors.New("marker")}
+	c := &main.ChangeCapture{Store: s.Store, Sink: &sink}
+	if _, err := c.Flush(context.Background()); err == nil || err.Error() != "marker" {
+		t.Fatalf("unexpected error: %v", err)
+	} else if seq, err := c.Offset(); err != nil {
+		t.Fatal(err)
+	} else if seq != 0 {
+		t.Fatalf("unexpected offset: %d", seq)
+	}
+
+	sink.Err = nil
+	if n, err := c.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	} else if n != 1 {
+		t.Fatalf("unexpected count: %d", n)
+	}
+}
+
+// Ensure the file sink appends one JSON envelope per line.
+func TestFileChangeSink(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "changes.jsonl")
+	sink := &main.FileChangeSink{Path: path}
+
+	for _, op := range []string{"c", "u"} {
+		if err := sink.WriteChanges(context.Background(), []*main.ChangeEnvelope{{Op: op}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	var ops []string
+	for sc := bufio.NewScanner(f); sc.Scan(); {
+		var env main.ChangeEnvelope
+		if err := json.Unmarshal(sc.Bytes(), &env); err != nil {
+			t.Fatal(err)
+		}
+		ops = append(ops, env.Op)
+	}
+	if !reflect.DeepEqual(ops, []string{"c", "u"}) {
+		t.Fatalf("unexpected ops: %v", ops)
+	}
+}
+
+// Ensure the Kafka REST sink produces keyed records to its topic.
+func TestKafkaRESTSink(t *testing.T) {
+	var path, contentType string
+	var body []byte
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path, contentType = r.URL.Path, r.Header.Get("Content-Type")
+		body, _ = io.ReadAll(r.Body)
+		if r.URL.Path == "/topics/fail" {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer srv.Close()
+
+	env := &main.ChangeEnvelope{Op: "c", Source: main.ChangeSource{UserID: 7}}
+	sink := &main.KafkaRESTSink{URL: srv.URL + "/", Topic: "bolt.users"}
+	if err := sink.WriteChanges(context.Background(), []*main.ChangeEnvelope{env}); err != nil {
+		t.Fatal(err)
+	} else if path != "/topics/bolt.users" || contentType != "application/vnd.kafka.json.v2+json" {
+		t.Fatalf("unexpected request: %s %s", path, contentType)
+	}
+
+	var req struct {
+		Records []struct {
+			Key   map[string]int      `json:"key"`
+			Value main.ChangeEnvelope `json:"value"`
+		} `json:"records"`
+	}
+	if err := json.Unmarshal(body, &req); err != nil {
+		t.Fatal(err)
+	} else if len(req.Records) != 1 || req.Records[0].Key["id"] != 7 || req.Records[0].Value.Op != "c" {
+		t.Fatalf("unexpected body: %s", body)
+	}
+
+	sink.Topic = "fail"
+	if err := sink.WriteChanges(context.Background(), []*main.ChangeEnvelope{env}); err == nil {
+		t.Fatal("expected error")
+	}
+	sink.Topic = ""
+	if err := sink.WriteChanges(context.Background(), []*main.ChangeEnvelope{env}); !errors.Is(err, main.ErrChangeTopicRequired) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+// ChangeSink implements main.ChangeSink by recording envelopes in memory.
+type ChangeSink struct {
+	mu sync.Mutex
+	a  []*main.ChangeEnvelope
+
+	// Returned by WriteChanges, if set.
+	Err error
+}
+
+func (s *ChangeSink) WriteChanges(ctx context.Context, a []*main.ChangeEnvelope) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.Err != nil {
+		return s.Err
+	}
+	s.a = append(s.a, a...)
+	return nil
+}
+
+// Envelopes returns a copy of the written envelopes.
+func (s *ChangeSink) Envelopes() []*main.ChangeEnvelope {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]*main.ChangeEnvelope{}, s.a...)
+}
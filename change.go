@@ -0,0 +1,70 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/benbjohnson/application-development-using-boltdb/internal"
+	"github.com/gogo/protobuf/proto"
+)
+
+// FieldChange describes the change to a single field of a user. Values are
+// formatted as strings and tags are joined with commas.
+type FieldChange struct {
+	Field string
+	Old   string
+	New   string
+}
+
+// ChangedField returns the change to the named field or nil if the field
+// did not change.
+func ChangedField(changes []FieldChange, field string) *FieldChange {
+	for i := range changes {
+		if changes[i].Field == field {
+			return &changes[i]
+		}
+	}
+	return nil
+}
+
+// diffUser returns the fields that differ between prev and u, in the order
+// they are declared on User.
+func diffUser(prev, u *User) []FieldChange {
+	var a []FieldChange
+	add := func(field, old, new string) {
+		if old != new {
+			a = append(a, FieldChange{Field: field, Old: old, New: new})
+		}
+	}
+	add("username", prev.Username, u.Username)
+	add("tags", strings.Join(prev.Tags, ","), strings.Join(u.Tags, ","))
+	add("display_name", prev.DisplayName, u.DisplayName)
+	add("bio", prev.Bio, u.Bio)
+	add("avatar_url", prev.AvatarURL, u.AvatarURL)
+	add("locale", prev.Locale, u.Locale)
+	add("email", prev.Email, u.Email)
+	add("status", prev.Status.String(), u.Status.String())
+	add("status_reason", prev.StatusReason, u.StatusReason)
+	return a
+}
+
+// encodeChanges converts changes to their protobuf representation.
+func encodeChanges(changes []FieldChange) []*internal.FieldChange {
+	var a []*internal.FieldChange
+	for _, c := range changes {
+		a = append(a, &internal.FieldChange{
+			Field: proto.String(c.Field),
+			Old:   proto.String(c.Old),
+			New:   proto.String(c.New),
+		})
+	}
+	return a
+}
+
+// decodeChanges converts changes from their protobuf representation.
+func decodeChanges(a []*internal.FieldChange) []FieldChange {
+	var changes []FieldChange
+	for _, pb := range a {
+		changes = append(changes, FieldChange{Field: pb.GetField(), Old: pb.GetOld(), New: pb.GetNew()})
+	}
+	return changes
+}
@@ -0,0 +1,74 @@
+package main_test
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	main "github.com/benbjohnson/application-development-using-boltdb"
+)
+
+// Ensure updates record the fields they change in events and revisions.
+func TestStore_FieldChanges(t *testing.T) {
+	s := NewStore()
+	s.Outbox = true
+	s.UserHistoryLimit = 10
+	if err := s.Open(); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	name, locale := "jimbo", "fr-FR"
+	if err := s.CreateUser(&main.User{Username: "susy", Locale: "en-US"}); err != nil {
+		t.Fatal(err)
+	} else if err := s.PatchUser(1, main.UserPatch{Username: &name, Locale: &locale}); err != nil {
+		t.Fatal(err)
+	} else if err := s.AddTag(1, "beta"); err != nil {
+		t.Fatal(err)
+	} else if err := s.AddTag(1, "admin"); err != nil {
+		t.Fatal(err)
+	} else if err := s.RevertUser(1, 2); err != nil {
+		t.Fatal(err)
+	}
+
+	want := [][]main.FieldChange{
+		nil,
+		{{Field: "username", Old: "susy", New: "jimbo"}, {Field: "locale", Old: "en-US", New: "fr-FR"}},
+		{{Field: "tags", Old: "", New: "beta"}},
+		{{Field: "tags", Old: "beta", New: "beta,admin"}},
+		{{Field: "tags", Old: "beta,admin", New: ""}},
+	}
+
+	// Check the outbox events.
+	var p Publisher
+	r := &main.Relay{Store: s.Store, Publisher: &p}
+	if n, err := r.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	} else if n != len(want) {
+		t.Fatalf("unexpected event count: %d", n)
+	}
+	for i, e := range p.Events() {
+		if !reflect.DeepEqual(e.Changes, want[i]) {
+			t.Fatalf("%d: unexpected event changes: %#v", i, e.Changes)
+		}
+	}
+
+	// Check the revisions.
+	a, err := s.UserHistory(1)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(a) != len(want) {
+		t.Fatalf("unexpected revision count: %d", len(a))
+	}
+	for i, r := range a {
+		if !reflect.DeepEqual(r.Changes, want[i]) {
+			t.Fatalf("%d: unexpected revision changes: %#v", i, r.Changes)
+		}
+	}
+
+	if c := main.ChangedField(a[1].Changes, "username"); c == nil || c.New != "jimbo" {
+		t.Fatalf("unexpected change: %#v", c)
+	} else if c := main.ChangedField(a[1].Changes, "bio"); c != nil {
+		t.Fatalf("unexpected change: %#v", c)
+	}
+}
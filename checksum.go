@@ -0,0 +1,132 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+
+	"github.com/boltdb/bolt"
+)
+
+// checksumTag follows compressedMarker in values that begin with a CRC-32C
+// of the rest of the value. The rest may itself be compressed.
+const checksumTag = 0xFE
+
+// checksumHeaderSize is the size of the marker, tag, and checksum.
+const checksumHeaderSize = 2 + 4
+
+// castagnoli is the CRC-32C table, which is hardware accelerated on most
+// platforms.
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// encodeValue compresses v and prefixes it with a checksum using the
+// store's settings.
+func (s *Store) encodeValue(v []byte) ([]byte, error) {
+	buf, err := s.compress(v)
+	if err != nil {
+		return nil, err
+	} else if !s.Checksums {
+		return buf, nil
+	}
+	return addChecksum(buf), nil
+}
+
+// addChecksum returns v prefixed with a checksum header.
+func addChecksum(v []byte) []byte {
+	buf := make([]byte, checksumHeaderSize, checksumHeaderSize+len(v))
+	buf[0], buf[1] = compressedMarker, checksumTag
+	binary.BigEndian.PutUint32(buf[2:], crc32.Checksum(v, castagnoli))
+	return append(buf, v...)
+}
+
+// verifyChecksum returns v without its checksum header. Returns
+// ErrChecksumMismatch if the checksum does not match. Values without a
+// checksum are returned as is.
+func verifyChecksum(v []byte) ([]byte, error) {
+	if len(v) < 2 || v[0] != compressedMarker || v[1] != checksumTag {
+		return v, nil
+	} else if len(v) < checksumHeaderSize {
+		return nil, ErrChecksumMismatch
+	} else if crc32.Checksum(v[checksumHeaderSize:], castagnoli) != binary.BigEndian.Uint32(v[2:]) {
+		return nil, ErrChecksumMismatch
+	}
+	return v[checksumHeaderSize:], nil
+}
+
+// ScrubAll reads every value in the store, including those of tenants, and
+// verifies the checksums of values that have one. Returns a violation for
+// each value that is corrupt or whose overflow chunks are missing. Returns
+// an empty slice if every value is intact.
+//
+// Values written without checksums are only checked for missing chunks.
+func (s *Store) ScrubAll() ([]Violation, error) {
+	var a []Violation
+	if err := s.view("ScrubAll", func(tx *Tx) error {
+		if tx.root != nil {
+			return scrubRoot(tx, "", tx.root, &a)
+		}
+		return tx.forEachTopBucket(func(name []byte, b *bolt.Bucket) error {
+			switch string(name) {
+			case "Overflow":
+				return nil
+			case "Tenants":
+				// Overflow pointers of tenant values refer to the tenant's
+				// own Overflow bucket so the transaction is scoped to each
+				// tenant while it is scrubbed.
+				defer func() { tx.root = nil }()
+				return b.ForEach(func(k, v []byte) error {
+					if v != nil {
+						return nil
+					}
+					tx.root = b.Bucket(k)
+					return scrubRoot(tx, "Tenants/"+string(k)+"/", tx.root, &a)
+				})
+			}
+			return scrubBucket(tx, string(name), string(name), b, &a)
+		})
+	}); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// scrubRoot scrubs each bucket within a tenant's root. Names of violations
+// are prefixed with prefix.
+func scrubRoot(tx *Tx, prefix string, root *bolt.Bucket, a *[]Violation) error {
+	return root.ForEach(func(k, v []byte) error {
+		if v != nil || string(k) == "Overflow" {
+			return nil
+		}
+		return scrubBucket(tx, string(k), prefix+string(k), root.Bucket(k), a)
+	})
+}
+
+// scrubBucket verifies the values of b and its nested buckets and appends a
+// violation to a for each corrupt value. The path of b is used to name the
+// bucket in violations and reads are recorded against the top-level name.
+// Overflow chunks are verified as part of the values that point to them.
+func scrubBucket(tx *Tx, name, path string, b *bolt.Bucket, a *[]Violation) error {
+	return b.ForEach(func(k, v []byte) error {
+		if v == nil {
+			if child := b.Bucket(k); child != nil {
+				return scrubBucket(tx, name, fmt.Sprintf("%s/%x", path, k), child, a)
+			}
+			return nil
+		}
+		tx.recordRead(name, v)
+
+		buf, err := readOverflow(tx, v)
+		if err == nil {
+			_, err = verifyChecksum(buf)
+		}
+		if err != nil {
+			*a = append(*a, Violation{Bucket: path, Key: append([]byte{}, k...), Reason: err.Error()})
+		}
+		return nil
+	})
+}
+
+// Checksum related errors.
+var (
+	ErrChecksumMismatch = &Error{Code: EINTERNAL, Message: "checksum mismatch"}
+)
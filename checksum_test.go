@@ -0,0 +1,108 @@
+package main_test
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	main "github.com/benbjohnson/application-development-using-boltdb"
+	"github.com/benbjohnson/application-development-using-boltdb/keys"
+	"github.com/boltdb/bolt"
+)
+
+// Ensure corrupt values are detected on read and by ScrubAll.
+func TestStore_Checksums(t *testing.T) {
+	s := OpenStore()
+	defer s.Close()
+	s.Checksums = true
+	s.OverflowThreshold = 4096
+
+	tags := []string{strings.Repeat("x", 10000)}
+	if err := s.CreateUser(&main.User{Username: "susy"}); err != nil {
+		t.Fatal(err)
+	} else if err := s.CreateUser(&main.User{Username: "john", Tags: tags}); err != nil {
+		t.Fatal(err)
+	} else if u, err := s.User(1); err != nil {
+		t.Fatal(err)
+	} else if u.Username != "susy" {
+		t.Fatalf("unexpected user: %#v", u)
+	} else if a, err := s.ScrubAll(); err != nil {
+		t.Fatal(err)
+	} else if len(a) != 0 {
+		t.Fatalf("unexpected violations: %v", a)
+	}
+
+	// Flip the last byte of the first user.
+	v := rawValue(t, s, "Users", keys.Int(1))
+	v[len(v)-1] ^= 0xFF
+	putRawValue(t, s, "Users", keys.Int(1), v)
+
+	if _, err := s.User(1); !errors.Is(err, main.ErrChecksumMismatch) {
+		t.Fatalf("unexpected error: %v", err)
+	} else if u, err := s.User(2); err != nil {
+		t.Fatal(err)
+	} else if u.Username != "john" {
+		t.Fatalf("unexpected user: %#v", u)
+	}
+
+	if a, err := s.ScrubAll(); err != nil {
+		t.Fatal(err)
+	} else if len(a) != 1 || a[0].Bucket != "Users" || !bytes.Equal(a[0].Key, keys.Int(1)) {
+		t.Fatalf("unexpected violations: %v", a)
+	}
+}
+
+// Ensure checksums can be added to existing values and that values without
+// checksums remain readable.
+func TestStore_Checksums_RecompressAll(t *testing.T) {
+	s := OpenStore()
+	defer s.Close()
+	if err := s.CreateUser(&main.User{Username: "susy"}); err != nil {
+		t.Fatal(err)
+	}
+
+	s.Checksums = true
+	if u, err := s.User(1); err != nil {
+		t.Fatal(err)
+	} else if u.Username != "susy" {
+		t.Fatalf("unexpected user: %#v", u)
+	} else if v := rawValue(t, s, "Users", keys.Int(1)); v[0] == 0 {
+		t.Fatalf("unexpected header: %x", v[:2])
+	}
+
+	if err := s.RecompressAll(); err != nil {
+		t.Fatal(err)
+	} else if v := rawValue(t, s, "Users", keys.Int(1)); v[0] != 0 || v[1] != 0xFE {
+		t.Fatalf("unexpected header: %x", v[:2])
+	} else if u, err := s.User(1); err != nil {
+		t.Fatal(err)
+	} else if u.Username != "susy" {
+		t.Fatalf("unexpected user: %#v", u)
+	}
+}
+
+// putRawValue writes v directly to the data file, bypassing the store.
+func putRawValue(tb testing.TB, s *Store, bucket string, key, v []byte) {
+	tb.Helper()
+	if err := s.Store.Close(); err != nil {
+		tb.Fatal(err)
+	}
+	defer func() {
+		if err := s.Open(); err != nil {
+			tb.Fatal(err)
+		}
+	}()
+
+	db, err := bolt.Open(s.Path, 0600, nil)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	defer db.Close()
+
+	if err := db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(bucket)).Put(key, v)
+	}); err != nil {
+		tb.Fatal(err)
+	}
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/boltdb/bolt"
+)
+
+// Fragmentation watchdog defaults.
+const (
+	DefaultMaxFragmentation = 0.5
+	DefaultMinCompactSize   = 64 << 20
+)
+
+// Fragmentation describes how much of the data file is used by data.
+type Fragmentation struct {
+	// Size of the data file on disk.
+	FileSize int64
+
+	// Bytes of the pages allocated to buckets.
+	InUse int64
+
+	// Fraction of the file not allocated to buckets, such as free pages
+	// left behind by deletes.
+	Ratio float64
+}
+
+// Fragmentation returns the size of the data file compared to the pages in
+// use by its buckets, including those of every tenant.
+func (s *Store) Fragmentation() (*Fragmentation, error) {
+	var f Fragmentation
+	if err := s.view("Fragmentation", func(tx *Tx) error {
+		f.FileSize = tx.Size()
+
+		var stats bolt.BucketStats
+		if err := tx.Tx.ForEach(func(_ []byte, b *bolt.Bucket) error {
+			stats.Add(b.Stats())
+			return nil
+		}); err != nil {
+			return err
+		}
+		f.InUse = int64(stats.BranchAlloc + stats.LeafAlloc)
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	// Use the size on disk since bolt grows the file ahead of its data.
+	if fi, err := os.Stat(s.Path); err == nil {
+		f.FileSize = fi.Size()
+	}
+	if f.FileSize > 0 {
+		f.Ratio = 1 - float64(f.InUse)/float64(f.FileSize)
+	}
+	return &f, nil
+}
+
+// Compact rewrites the data file so it only contains pages in use and
+// returns the space held by free pages to the file system.
+//
+// Every bucket is copied to a temporary file that then replaces the data
+// file. Compact waits for open transactions to finish and blocks new ones,
+// including those of tenants, until it returns. Compacting a TenantStore
+// compacts the whole file.
+func (s *Store) Compact() error {
+	if s.ReadOnly {
+		return bolt.ErrDatabaseReadOnly
+	} else if s.db == nil {
+		return ErrStoreClosed
+	}
+
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	if s.db.closed {
+		return ErrStoreClosed
+	}
+
+	start := time.Now()
+	f, err := os.CreateTemp(filepath.Dir(s.Path), filepath.Base(s.Path)+".tmp-")
+	if err != nil {
+		return err
+	}
+	f.Close()
+	defer os.Remove(f.Name())
+
+	if err := s.compactTo(f.Name()); err != nil {
+		return err
+	}
+
+	// Swap the files and reopen. The original is reopened if the new file
+	// cannot be moved into place.
+	noSync := s.db.NoSync
+	if err := s.db.Close(); err != nil {
+		return err
+	}
+	renameErr := os.Rename(f.Name(), s.Path)
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.lockTimeout())
+	defer cancel()
+	db, err := s.openDB(ctx)
+	if err != nil {
+		s.logger().Error("reopen after compaction failed", "path", s.Path, "err", err)
+		return err
+	}
+	db.NoSync = noSync
+	s.db.DB = db
+
+	if renameErr != nil {
+		return renameErr
+	}
+	s.logger().Info("data file compacted", "path", s.Path, "duration", time.Since(start))
+	return nil
+}
+
+// compactTo copies every bucket of the database to a new data file at path.
+// The caller must hold the database lock.
+func (s *Store) compactTo(path string) error {
+	dst, err := bolt.Open(path, 0600, &bolt.Options{Timeout: s.lockTimeout()})
+	if err != nil {
+		return err
+	}
+	defer dst.Close()
+
+	if err := s.db.View(func(tx *bolt.Tx) error {
+		return dst.Update(func(dtx *bolt.Tx) error {
+			return tx.ForEach(func(name []byte, b *bolt.Bucket) error {
+				other, err := dtx.CreateBucket(name)
+				if err != nil {
+					return err
+				}
+				return copyBucket(other, b)
+			})
+		})
+	}); err != nil {
+		return err
+	}
+	return dst.Close()
+}
+
+// monitorFragmentation periodically checks the fragmentation of the data
+// file until the store is closed.
+func (s *Store) monitorFragmentation() {
+	ticker := time.NewTicker(s.FragmentationInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.closing:
+			return
+		case <-ticker.C:
+			if err := s.checkFragmentation(); err != nil {
+				s.logger().Error("fragmentation check failed", "err", err)
+			}
+		}
+	}
+}
+
+// checkFragmentation calls OnFragmentation and compacts the data file, if
+// AutoCompact is set, when the file is too fragmented.
+func (s *Store) checkFragmentation() error {
+	f, err := s.Fragmentation()
+	if err != nil {
+		return err
+	} else if f.FileSize < s.minCompactSize() || f.Ratio <= s.maxFragmentation() {
+		return nil
+	}
+
+	s.logger().Warn("data file fragmented", "path", s.Path, "size", f.FileSize, "inuse", f.InUse, "ratio", f.Ratio)
+	if s.OnFragmentation != nil {
+		s.OnFragmentation(f)
+	}
+	if s.AutoCompact && !s.Frozen() {
+		return s.Compact()
+	}
+	return nil
+}
+
+// maxFragmentation returns the configured threshold or the default, if unset.
+func (s *Store) maxFragmentation() float64 {
+	if s.MaxFragmentation == 0 {
+		return DefaultMaxFragmentation
+	}
+	return s.MaxFragmentation
+}
+
+// minCompactSize returns the configured size or the default, if unset.
+func (s *Store) minCompactSize() int64 {
+	if s.MinCompactSize == 0 {
+		return DefaultMinCompactSize
+	}
+	return s.MinCompactSize
+}
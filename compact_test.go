@@ -0,0 +1,131 @@
+package main_test
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	main "github.com/benbjohnson/application-development-using-boltdb"
+)
+
+// fragment fills the store with users and deletes all but the first so
+// that most of the data file is free pages.
+func fragment(tb testing.TB, s *Store) {
+	if err := s.BulkLoad(func() error {
+		for i := 0; i < 2000; i++ {
+			if err := s.CreateUser(&main.User{Username: fmt.Sprintf("user%d", i), Tags: []string{strings.Repeat("x", 200)}}); err != nil {
+				return err
+			}
+		}
+		for i := 2; i <= 2000; i++ {
+			if err := s.DeleteUser(i); err != nil {
+				return err
+			}
+		}
+		return nil
+	}); err != nil {
+		tb.Fatal(err)
+	}
+}
+
+// Ensure compaction shrinks a fragmented data file and keeps its data.
+func TestStore_Compact(t *testing.T) {
+	s := OpenStore()
+	defer s.Close()
+
+	if err := s.CreateTenant("acme"); err != nil {
+		t.Fatal(err)
+	}
+	acme := s.Tenant("acme")
+	if err := acme.CreateUser(&main.User{Username: "john"}); err != nil {
+		t.Fatal(err)
+	}
+	fragment(t, s)
+
+	before, err := s.Fragmentation()
+	if err != nil {
+		t.Fatal(err)
+	} else if before.Ratio < 0.5 {
+		t.Fatalf("expected fragmented file: %+v", before)
+	}
+
+	if err := s.Compact(); err != nil {
+		t.Fatal(err)
+	}
+	if after, err := s.Fragmentation(); err != nil {
+		t.Fatal(err)
+	} else if after.FileSize >= before.FileSize {
+		t.Fatalf("expected smaller file: %d >= %d", after.FileSize, before.FileSize)
+	}
+
+	// Data and sequences are kept for the store and its tenants.
+	if u, err := s.User(1); err != nil {
+		t.Fatal(err)
+	} else if u.Username != "user0" {
+		t.Fatalf("unexpected user: %#v", u)
+	} else if u, err := acme.User(1); err != nil {
+		t.Fatal(err)
+	} else if u.Username != "john" {
+		t.Fatalf("unexpected tenant user: %#v", u)
+	}
+
+	u := &main.User{Username: "jane"}
+	if err := s.CreateUser(u); err != nil {
+		t.Fatal(err)
+	} else if u.ID != 2001 {
+		t.Fatalf("unexpected id: %d", u.ID)
+	}
+}
+
+// Ensure the watchdog reports and compacts a fragmented data file.
+func TestStore_FragmentationInterval(t *testing.T) {
+	s := OpenStore()
+	defer s.Close()
+	fragment(t, s)
+	fi, err := os.Stat(s.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Reopen with the watchdog enabled.
+	ch := make(chan *main.Fragmentation, 1)
+	s.FragmentationInterval = 10 * time.Millisecond
+	s.MinCompactSize = 1
+	s.AutoCompact = true
+	s.OnFragmentation = func(f *main.Fragmentation) {
+		select {
+		case ch <- f:
+		default:
+		}
+	}
+	if err := s.Reopen(); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case f := <-ch:
+		if f.FileSize != fi.Size() {
+			t.Fatalf("unexpected file size: %d", f.FileSize)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout")
+	}
+
+	// Wait for the compaction to finish.
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+		if other, err := os.Stat(s.Path); err != nil {
+			t.Fatal(err)
+		} else if other.Size() < fi.Size() {
+			break
+		} else if time.Now().After(deadline) {
+			t.Fatal("timeout")
+		}
+	}
+	if u, err := s.User(1); err != nil {
+		t.Fatal(err)
+	} else if u.Username != "user0" {
+		t.Fatalf("unexpected user: %#v", u)
+	}
+}
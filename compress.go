@@ -0,0 +1,161 @@
+package main
+
+import (
+	"bytes"
+
+	"github.com/benbjohnson/application-development-using-boltdb/keys"
+	"github.com/golang/snappy"
+	"github.com/klauspost/compress/zstd"
+)
+
+// Compression identifies the algorithm used to compress values.
+type Compression byte
+
+// Supported compression algorithms.
+const (
+	NoCompression     Compression = 0
+	SnappyCompression Compression = 1
+	ZstdCompression   Compression = 2
+)
+
+// DefaultCompressionThreshold is the default minimum size of a value before
+// it is compressed. Smaller values rarely shrink enough to be worthwhile.
+const DefaultCompressionThreshold = 512
+
+// compressedMarker is the first byte of a compressed value and is followed by
+// the Compression used. Encoded protobuf messages never start with a zero
+// byte since field number zero is invalid, so uncompressed values written
+// before compression was enabled are still readable.
+const compressedMarker = 0x00
+
+// recompressBatchSize is the number of values rewritten per transaction.
+const recompressBatchSize = 1000
+
+// Shared zstd codecs. Both are safe for concurrent use with EncodeAll and
+// DecodeAll.
+var (
+	zstdEncoder, _ = zstd.NewWriter(nil)
+	zstdDecoder, _ = zstd.NewReader(nil)
+)
+
+// compress returns v compressed with the store's algorithm. The value is
+// returned as-is if it is below the threshold or does not shrink.
+func (s *Store) compress(v []byte) ([]byte, error) {
+	if s.Compression == NoCompression || len(v) < s.compressionThreshold() {
+		return v, nil
+	}
+
+	hdr := []byte{compressedMarker, byte(s.Compression)}
+	var buf []byte
+	switch s.Compression {
+	case SnappyCompression:
+		buf = append(hdr, snappy.Encode(nil, v)...)
+	case ZstdCompression:
+		buf = zstdEncoder.EncodeAll(v, hdr)
+	default:
+		return nil, ErrUnknownCompression
+	}
+
+	if len(buf) >= len(v) {
+		return v, nil
+	}
+	return buf, nil
+}
+
+// isCompressed returns true if v was compressed by compress.
+func isCompressed(v []byte) bool {
+	return len(v) > 0 && v[0] == compressedMarker
+}
+
+// decompress returns the original contents of a value written by encodeValue,
+// after verifying its checksum if it has one.
+func decompress(v []byte) ([]byte, error) {
+	return decompressTo(nil, v)
+}
+
+// decompressTo is like decompress but decodes into dst, if it is large
+// enough. The contents of dst are overwritten.
+func decompressTo(dst, v []byte) ([]byte, error) {
+	v, err := verifyChecksum(v)
+	if err != nil {
+		return nil, err
+	} else if !isCompressed(v) {
+		return v, nil
+	} else if len(v) < 2 {
+		return nil, ErrUnknownCompression
+	}
+
+	switch Compression(v[1]) {
+	case SnappyCompression:
+		return snappy.Decode(dst[:cap(dst)], v[2:])
+	case ZstdCompression:
+		return zstdDecoder.DecodeAll(v[2:], dst[:0])
+	default:
+		return nil, ErrUnknownCompression
+	}
+}
+
+// compressionThreshold returns the configured threshold or the default, if unset.
+func (s *Store) compressionThreshold() int {
+	if s.CompressionThreshold <= 0 {
+		return DefaultCompressionThreshold
+	}
+	return s.CompressionThreshold
+}
+
+// RecompressAll rewrites every user value using the current compression
+// and checksum settings. Values are rewritten in batches across multiple transactions so
+// other writers are not blocked for the duration of the migration.
+func (s *Store) RecompressAll() error {
+	seek := keys.Int(0)
+	for seek != nil {
+		from := seek
+		if err := s.update("RecompressAll", func(tx *Tx) error {
+			bkt := tx.Bucket([]byte("Users"))
+
+			// Determine the new encoding for a batch of values. Updates are
+			// applied after iterating since writes can move the cursor.
+			var updates [][2][]byte
+			c := bkt.Cursor()
+			k, v := c.Seek(from)
+			for i := 0; k != nil && i < recompressBatchSize; k, v = c.Next() {
+				tx.recordRead("Users", v)
+
+				raw, err := readOverflow(tx, v)
+				if err != nil {
+					return err
+				}
+				buf, err := decompress(raw)
+				if err != nil {
+					return err
+				} else if buf, err = s.encodeValue(buf); err != nil {
+					return err
+				} else if !bytes.Equal(buf, raw) {
+					updates = append(updates, [2][]byte{append([]byte{}, k...), buf})
+				}
+				i++
+			}
+
+			// Save the position of the next batch.
+			seek = nil
+			if k != nil {
+				seek = append([]byte{}, k...)
+			}
+
+			for _, u := range updates {
+				if err := putValue(tx, "Users", u[0], u[1]); err != nil {
+					return err
+				}
+			}
+			return nil
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Compression related errors.
+var (
+	ErrUnknownCompression = &Error{Code: EINTERNAL, Message: "unknown compression"}
+)
@@ -0,0 +1,102 @@
+package main_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	main "github.com/benbjohnson/application-development-using-boltdb"
+	"github.com/benbjohnson/application-development-using-boltdb/keys"
+	"github.com/boltdb/bolt"
+)
+
+// Ensure large values are compressed and read back transparently.
+func TestStore_Compression(t *testing.T) {
+	for _, c := range []main.Compression{main.SnappyCompression, main.ZstdCompression} {
+		s := OpenStore()
+		defer s.Close()
+		s.Compression = c
+
+		tags := []string{strings.Repeat("x", 10000)}
+		if err := s.CreateUser(&main.User{Username: "susy", Tags: tags}); err != nil {
+			t.Fatal(err)
+		} else if err := s.CreateUser(&main.User{Username: "john"}); err != nil {
+			t.Fatal(err)
+		}
+
+		if u, err := s.User(1); err != nil {
+			t.Fatal(err)
+		} else if len(u.Tags) != 1 || u.Tags[0] != tags[0] {
+			t.Fatalf("unexpected tags: %d", len(u.Tags))
+		} else if u, err := s.User(2); err != nil {
+			t.Fatal(err)
+		} else if u.Username != "john" {
+			t.Fatalf("unexpected user: %#v", u)
+		}
+	}
+}
+
+// Ensure existing values can be migrated to a new compression setting.
+func TestStore_RecompressAll(t *testing.T) {
+	s := OpenStore()
+	defer s.Close()
+
+	// Write uncompressed users.
+	tags := []string{strings.Repeat("x", 10000)}
+	for i := 0; i < 10; i++ {
+		if err := s.CreateUser(&main.User{Username: fmt.Sprintf("user%d", i), Tags: tags}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Compress existing users.
+	s.Compression = main.ZstdCompression
+	if err := s.RecompressAll(); err != nil {
+		t.Fatal(err)
+	} else if a, err := s.Users(); err != nil {
+		t.Fatal(err)
+	} else if len(a) != 10 || a[9].Tags[0] != tags[0] {
+		t.Fatalf("unexpected users: %d", len(a))
+	} else if v := rawValue(t, s, "Users", keys.Int(10)); len(v) > 1000 {
+		t.Fatalf("value not compressed: %d bytes", len(v))
+	}
+
+	// Decompress them again.
+	s.Compression = main.NoCompression
+	if err := s.RecompressAll(); err != nil {
+		t.Fatal(err)
+	} else if u, err := s.User(1); err != nil {
+		t.Fatal(err)
+	} else if u.Tags[0] != tags[0] {
+		t.Fatal("unexpected tags")
+	} else if v := rawValue(t, s, "Users", keys.Int(1)); len(v) < 10000 {
+		t.Fatalf("value still compressed: %d bytes", len(v))
+	}
+}
+
+// rawValue returns the stored bytes for key in bucket. The store is closed
+// while the file is read directly and then reopened.
+func rawValue(tb testing.TB, s *Store, bucket string, key []byte) []byte {
+	tb.Helper()
+	if err := s.Store.Close(); err != nil {
+		tb.Fatal(err)
+	}
+	defer func() {
+		if err := s.Open(); err != nil {
+			tb.Fatal(err)
+		}
+	}()
+
+	db, err := bolt.Open(s.Path, 0600, nil)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	defer db.Close()
+
+	var v []byte
+	db.View(func(tx *bolt.Tx) error {
+		v = append([]byte{}, tx.Bucket([]byte(bucket)).Get(key)...)
+		return nil
+	})
+	return v
+}
@@ -0,0 +1,266 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"strconv"
+	"time"
+)
+
+// DefaultListenAddr is the default address the server listens on.
+const DefaultListenAddr = "localhost:8080"
+
+// ConfigEnvPrefix prefixes the environment variables that override fields of
+// a config file, such as APPDEV_PATH for the path field.
+const ConfigEnvPrefix = "APPDEV_"
+
+// Config holds the settings of the command line program and server. It is
+// read from a JSON file and then overridden by environment variables.
+type Config struct {
+	// Path of the data file. Required.
+	Path string `json:"path"`
+
+	// Address the server listens on. Defaults to DefaultListenAddr.
+	Listen string `json:"listen"`
+
+	// Backups are written to BackupDir every BackupInterval. Backups are
+	// disabled if the interval is zero.
+	BackupDir      string   `json:"backup_dir"`
+	BackupInterval Duration `json:"backup_interval"`
+
+	// Hex-encoded key used to encrypt secrets at rest. Must be 16, 24, or
+	// 32 bytes once decoded, if set.
+	SecretKey string `json:"secret_key"`
+
+	// Bearer token that grants access to the admin endpoints of the server
+	// in addition to API keys with the admin scope. Disabled if empty.
+	AdminToken string `json:"admin_token"`
+
+	// Minimum level of log messages: debug, info, warn, or error.
+	// Defaults to info.
+	LogLevel string `json:"log_level"`
+
+	// Requests allowed per minute from each IP address. Clients may send up
+	// to RateLimitBurst requests at once, which defaults to RateLimit.
+	// Requests are not limited if zero.
+	RateLimit      int `json:"rate_limit"`
+	RateLimitBurst int `json:"rate_limit_burst"`
+}
+
+// Duration is a time.Duration that is encoded in JSON as a string such as
+// "1h30m".
+type Duration time.Duration
+
+// MarshalJSON encodes d as a duration string.
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// UnmarshalJSON decodes a duration string.
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+// ReadConfigFile reads the config at filename and applies the overrides
+// returned by getenv, which is usually os.Getenv. An empty filename reads
+// the config from the environment only. The config is validated before it
+// is returned.
+func ReadConfigFile(filename string, getenv func(string) string) (*Config, error) {
+	c := &Config{}
+	if filename != "" {
+		buf, err := os.ReadFile(filename)
+		if err != nil {
+			return nil, err
+		}
+		dec := json.NewDecoder(bytes.NewReader(buf))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(c); err != nil {
+			return nil, fmt.Errorf("%s: %w", filename, err)
+		}
+	}
+
+	if err := c.applyEnv(getenv); err != nil {
+		return nil, err
+	} else if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// applyEnv overrides fields with the environment variables that are set.
+func (c *Config) applyEnv(getenv func(string) string) error {
+	for name, p := range map[string]*string{
+		"PATH":        &c.Path,
+		"LISTEN":      &c.Listen,
+		"BACKUP_DIR":  &c.BackupDir,
+		"SECRET_KEY":  &c.SecretKey,
+		"ADMIN_TOKEN": &c.AdminToken,
+		"LOG_LEVEL":   &c.LogLevel,
+	} {
+		if v := getenv(ConfigEnvPrefix + name); v != "" {
+			*p = v
+		}
+	}
+
+	if v := getenv(ConfigEnvPrefix + "BACKUP_INTERVAL"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return fmt.Errorf("%sBACKUP_INTERVAL: %w", ConfigEnvPrefix, err)
+		}
+		c.BackupInterval = Duration(d)
+	}
+
+	for name, p := range map[string]*int{
+		"RATE_LIMIT":       &c.RateLimit,
+		"RATE_LIMIT_BURST": &c.RateLimitBurst,
+	} {
+		if v := getenv(ConfigEnvPrefix + name); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				return fmt.Errorf("%s%s: %w", ConfigEnvPrefix, name, err)
+			}
+			*p = n
+		}
+	}
+	return nil
+}
+
+// Validate returns an error listing every invalid field.
+func (c *Config) Validate() error {
+	var errs []error
+	invalid := func(field, format string, args ...any) {
+		errs = append(errs, fmt.Errorf("config: %s: %s", field, fmt.Sprintf(format, args...)))
+	}
+
+	if c.Path == "" {
+		invalid("path", "required; set it in the config file or with %sPATH", ConfigEnvPrefix)
+	}
+	if c.Listen != "" {
+		if _, _, err := net.SplitHostPort(c.Listen); err != nil {
+			invalid("listen", "expected host:port, got %q", c.Listen)
+		}
+	}
+	if c.BackupInterval < 0 {
+		invalid("backup_interval", "must not be negative")
+	} else if c.BackupInterval > 0 && c.BackupDir == "" {
+		invalid("backup_dir", "required when backup_interval is set")
+	}
+	if c.SecretKey != "" {
+		if key, err := hex.DecodeString(c.SecretKey); err != nil {
+			invalid("secret_key", "must be hex encoded")
+		} else if n := len(key); n != 16 && n != 24 && n != 32 {
+			invalid("secret_key", "must be 16, 24, or 32 bytes, got %d", n)
+		}
+	}
+	if _, err := c.logLevel(); err != nil {
+		invalid("log_level", "expected debug, info, warn, or error, got %q", c.LogLevel)
+	}
+	if c.RateLimit < 0 {
+		invalid("rate_limit", "must not be negative")
+	}
+	if c.RateLimitBurst < 0 {
+		invalid("rate_limit_burst", "must not be negative")
+	}
+	return errors.Join(errs...)
+}
+
+// ListenAddr returns the listen address or the default, if unset.
+func (c *Config) ListenAddr() string {
+	if c.Listen == "" {
+		return DefaultListenAddr
+	}
+	return c.Listen
+}
+
+// Rate returns the rate that requests from each client are limited to. The
+// rate allows no events if rate limiting is disabled.
+func (c *Config) Rate() Rate {
+	return Rate{Events: c.RateLimit, Per: time.Minute, Burst: c.RateLimitBurst}
+}
+
+// logLevel returns the parsed log level or info, if unset.
+func (c *Config) logLevel() (slog.Level, error) {
+	var level slog.Level
+	if c.LogLevel == "" {
+		return slog.LevelInfo, nil
+	}
+	err := level.UnmarshalText([]byte(c.LogLevel))
+	return level, err
+}
+
+// Logger returns a logger that writes messages at the configured level or
+// above to w.
+func (c *Config) Logger(w io.Writer) *slog.Logger {
+	level, _ := c.logLevel()
+	return slog.New(slog.NewTextHandler(w, &slog.HandlerOptions{Level: level}))
+}
+
+// NewStore returns a store for the configured data file that logs to
+// logger. The store must be opened with Open before use.
+func (c *Config) NewStore(logger *slog.Logger) *Store {
+	opts := []Option{WithLogger(logger)}
+	if c.SecretKey != "" {
+		key, _ := hex.DecodeString(c.SecretKey)
+		opts = append(opts, WithSecretKey(key))
+	}
+	return NewStore(c.Path, opts...)
+}
+
+// ConfigCommand validates a config and prints the result.
+type ConfigCommand struct {
+	*Main
+}
+
+// NewConfigCommand returns a new instance of ConfigCommand.
+func NewConfigCommand(m *Main) *ConfigCommand {
+	return &ConfigCommand{Main: m}
+}
+
+// Run reads and validates the config and prints it as JSON with secrets
+// redacted.
+func (cmd *ConfigCommand) Run(args ...string) error {
+	fs := flag.NewFlagSet("config", flag.ContinueOnError)
+	fs.SetOutput(cmd.Stderr)
+	filename := fs.String("config", "", "config file path")
+	fs.Usage = func() {
+		fmt.Fprintf(cmd.Stderr, "usage: appdev config [-config file]\n\nFields may be overridden with %s* environment variables.\n", ConfigEnvPrefix)
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err == flag.ErrHelp {
+		return ErrUsage
+	} else if err != nil {
+		return err
+	}
+
+	c, err := ReadConfigFile(*filename, cmd.Getenv)
+	if err != nil {
+		return err
+	}
+
+	redacted := *c
+	for _, p := range []*string{&redacted.SecretKey, &redacted.AdminToken} {
+		if *p != "" {
+			*p = "REDACTED"
+		}
+	}
+	enc := json.NewEncoder(cmd.Stdout)
+	enc.SetIndent("", "\t")
+	return enc.Encode(redacted)
+}
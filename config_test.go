@@ -0,0 +1,88 @@
+package main_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	main "github.com/benbjohnson/application-development-using-boltdb"
+)
+
+// Ensure a config file is read and overridden by the environment.
+func TestReadConfigFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte(`{
+		"path": "/var/lib/appdev/db",
+		"listen": ":9000",
+		"backup_dir": "/var/backups",
+		"backup_interval": "1h",
+		"log_level": "debug",
+		"rate_limit": 60
+	}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	env := map[string]string{"APPDEV_LISTEN": ":9001", "APPDEV_BACKUP_INTERVAL": "30m", "APPDEV_RATE_LIMIT_BURST": "10"}
+	c, err := main.ReadConfigFile(path, func(k string) string { return env[k] })
+	if err != nil {
+		t.Fatal(err)
+	} else if c.Path != "/var/lib/appdev/db" || c.ListenAddr() != ":9001" || c.BackupDir != "/var/backups" {
+		t.Fatalf("unexpected config: %#v", c)
+	} else if time.Duration(c.BackupInterval) != 30*time.Minute {
+		t.Fatalf("unexpected backup interval: %s", time.Duration(c.BackupInterval))
+	} else if !c.Logger(io.Discard).Enabled(context.Background(), slog.LevelDebug) {
+		t.Fatal("expected debug logging")
+	} else if r := c.Rate(); r.Events != 60 || r.Per != time.Minute || r.Burst != 10 {
+		t.Fatalf("unexpected rate: %#v", r)
+	}
+}
+
+// Ensure every invalid field is reported.
+func TestReadConfigFile_Invalid(t *testing.T) {
+	env := map[string]string{
+		"APPDEV_LISTEN":          "9000",
+		"APPDEV_BACKUP_INTERVAL": "1h",
+		"APPDEV_SECRET_KEY":      "abcd",
+		"APPDEV_LOG_LEVEL":       "loud",
+		"APPDEV_RATE_LIMIT":      "-1",
+	}
+	_, err := main.ReadConfigFile("", func(k string) string { return env[k] })
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	for _, field := range []string{"path", "listen", "backup_dir", "secret_key", "log_level", "rate_limit"} {
+		if !strings.Contains(err.Error(), "config: "+field+":") {
+			t.Fatalf("missing %s in error: %v", field, err)
+		}
+	}
+
+	// Unknown fields are rejected so typos are not silently ignored.
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte(`{"pth": "db"}`), 0600); err != nil {
+		t.Fatal(err)
+	} else if _, err := main.ReadConfigFile(path, func(string) string { return "" }); err == nil || !strings.Contains(err.Error(), `unknown field "pth"`) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+// Ensure the config command prints the config with secrets redacted.
+func TestConfigCommand_Run(t *testing.T) {
+	m := NewMain()
+	env := map[string]string{"APPDEV_PATH": "db", "APPDEV_ADMIN_TOKEN": "secret"}
+	m.Getenv = func(k string) string { return env[k] }
+
+	var c main.Config
+	if err := m.Run("config"); err != nil {
+		t.Fatal(err)
+	} else if err := json.Unmarshal(m.Stdout.Bytes(), &c); err != nil {
+		t.Fatal(err)
+	} else if c.Path != "db" || c.AdminToken != "REDACTED" {
+		t.Fatalf("unexpected config: %#v", c)
+	}
+}
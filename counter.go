@@ -0,0 +1,178 @@
+package main
+
+import (
+	"encoding/binary"
+	"sync"
+	"time"
+
+	"github.com/benbjohnson/application-development-using-boltdb/keys"
+)
+
+// DefaultCounterBatchDelay is the default duration that IncrCounter waits
+// for other increments to apply in the same transaction.
+const DefaultCounterBatchDelay = 10 * time.Millisecond
+
+// IncrCounter adds delta to the named counter and returns its new value.
+// Counters that do not exist start at zero.
+//
+// Increments made within CounterBatchDelay of each other are combined into
+// a single transaction so hot counters, such as page views, do not take the
+// writer lock once per increment. Each caller still receives the value of
+// the counter just after its own increment.
+func (s *Store) IncrCounter(name string, delta int64) (int64, error) {
+	if name == "" {
+		return 0, ErrCounterNameRequired
+	}
+
+	delay := s.counterBatchDelay()
+	if delay < 0 {
+		var v int64
+		if err := s.update("IncrCounter", func(tx *Tx) error {
+			var err error
+			v, err = incrCounter(tx, name, delta)
+			return err
+		}); err != nil {
+			return 0, err
+		}
+		return v, nil
+	}
+
+	if err := s.rlock(); err != nil {
+		return 0, err
+	}
+	b, offset := s.db.counters.add(s, name, delta, delay)
+	s.db.mu.RUnlock()
+
+	<-b.done
+	if b.err != nil {
+		return 0, b.err
+	}
+	return b.prev[name] + offset, nil
+}
+
+// Counter returns the value of the named counter or zero if it does not
+// exist.
+func (s *Store) Counter(name string) (int64, error) {
+	var v int64
+	if err := s.view("Counter", func(tx *Tx) error {
+		v = counterValue(tx, name)
+		return nil
+	}); err != nil {
+		return 0, err
+	}
+	return v, nil
+}
+
+// Counters returns the value of every counter whose name starts with prefix.
+func (s *Store) Counters(prefix string) (map[string]int64, error) {
+	m := make(map[string]int64)
+	if err := s.view("Counters", func(tx *Tx) error {
+		c := tx.Bucket([]byte("Counters")).Cursor()
+		return keys.Scan(c, []byte(prefix), func(k, v []byte) error {
+			tx.recordRead("Counters", v)
+			m[string(k)] = decodeCounter(v)
+			return nil
+		})
+	}); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// counterBatchDelay returns the configured delay or the default, if unset.
+func (s *Store) counterBatchDelay() time.Duration {
+	if s.CounterBatchDelay == 0 {
+		return DefaultCounterBatchDelay
+	}
+	return s.CounterBatchDelay
+}
+
+// incrCounter adds delta to the named counter and returns its new value.
+func incrCounter(tx *Tx, name string, delta int64) (int64, error) {
+	v := counterValue(tx, name) + delta
+	buf := make([]byte, 8)
+	binary.BigEndian.PutUint64(buf, uint64(v))
+	tx.recordWrite("Counters", buf)
+	return v, tx.Bucket([]byte("Counters")).Put([]byte(name), buf)
+}
+
+// counterValue returns the value of the named counter or zero.
+func counterValue(tx *Tx, name string) int64 {
+	v := tx.Bucket([]byte("Counters")).Get([]byte(name))
+	if v == nil {
+		return 0
+	}
+	tx.recordRead("Counters", v)
+	return decodeCounter(v)
+}
+
+// decodeCounter returns the value of an encoded counter.
+func decodeCounter(v []byte) int64 {
+	if len(v) != 8 {
+		return 0
+	}
+	return int64(binary.BigEndian.Uint64(v))
+}
+
+// counterBatch is a set of increments applied in one transaction.
+type counterBatch struct {
+	deltas map[string]int64
+
+	// Values of the counters before the batch was applied, and the error of
+	// the transaction. Set before done is closed.
+	prev map[string]int64
+	err  error
+	done chan struct{}
+}
+
+// counterBatches holds the open batch of each store sharing a database.
+// Stores are kept apart since tenants write to their own buckets.
+type counterBatches struct {
+	mu sync.Mutex
+	m  map[*Store]*counterBatch
+}
+
+// add adds delta to the open batch of s, opening a batch that is applied
+// after delay if there is none. Returns the batch and the sum of the deltas
+// for name in the batch so far, including delta.
+func (c *counterBatches) add(s *Store, name string, delta int64, delay time.Duration) (*counterBatch, int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	b := c.m[s]
+	if b == nil {
+		b = &counterBatch{deltas: make(map[string]int64), done: make(chan struct{})}
+		if c.m == nil {
+			c.m = make(map[*Store]*counterBatch)
+		}
+		c.m[s] = b
+		time.AfterFunc(delay, func() { c.flush(s, b) })
+	}
+	b.deltas[name] += delta
+	return b, b.deltas[name]
+}
+
+// flush closes the batch of s and applies it.
+func (c *counterBatches) flush(s *Store, b *counterBatch) {
+	c.mu.Lock()
+	delete(c.m, s)
+	c.mu.Unlock()
+
+	b.err = s.update("IncrCounter", func(tx *Tx) error {
+		b.prev = make(map[string]int64, len(b.deltas))
+		for name, delta := range b.deltas {
+			v, err := incrCounter(tx, name, delta)
+			if err != nil {
+				return err
+			}
+			b.prev[name] = v - delta
+		}
+		return nil
+	})
+	close(b.done)
+}
+
+// Counter related errors.
+var (
+	ErrCounterNameRequired = &Error{Code: EINVALID, Message: "counter name required"}
+)
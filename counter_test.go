@@ -0,0 +1,94 @@
+package main_test
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	main "github.com/benbjohnson/application-development-using-boltdb"
+)
+
+// Ensure counters can be incremented and listed by prefix, with and without
+// batching.
+func TestStore_IncrCounter(t *testing.T) {
+	for _, delay := range []time.Duration{0, -1} {
+		s := NewStore()
+		s.CounterBatchDelay = delay
+		if err := s.Open(); err != nil {
+			t.Fatal(err)
+		}
+		defer s.Close()
+
+		if v, err := s.IncrCounter("views:1", 1); err != nil {
+			t.Fatal(err)
+		} else if v != 1 {
+			t.Fatalf("unexpected value: %d", v)
+		} else if v, err := s.IncrCounter("views:1", 5); err != nil {
+			t.Fatal(err)
+		} else if v != 6 {
+			t.Fatalf("unexpected value: %d", v)
+		} else if v, err := s.IncrCounter("views:2", -2); err != nil {
+			t.Fatal(err)
+		} else if v != -2 {
+			t.Fatalf("unexpected value: %d", v)
+		} else if _, err := s.IncrCounter("api:1", 1); err != nil {
+			t.Fatal(err)
+		}
+
+		if v, err := s.Counter("views:1"); err != nil {
+			t.Fatal(err)
+		} else if v != 6 {
+			t.Fatalf("unexpected value: %d", v)
+		} else if v, err := s.Counter("views:3"); err != nil {
+			t.Fatal(err)
+		} else if v != 0 {
+			t.Fatalf("unexpected value: %d", v)
+		}
+
+		if m, err := s.Counters("views:"); err != nil {
+			t.Fatal(err)
+		} else if len(m) != 2 || m["views:1"] != 6 || m["views:2"] != -2 {
+			t.Fatalf("unexpected counters: %v", m)
+		}
+
+		if _, err := s.IncrCounter("", 1); err != main.ErrCounterNameRequired {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+}
+
+// Ensure concurrent increments are combined without losing any and that
+// each caller receives a distinct value.
+func TestStore_IncrCounter_Concurrent(t *testing.T) {
+	s := OpenStore()
+	defer s.Close()
+
+	const n = 100
+	var mu sync.Mutex
+	seen := make(map[int64]bool)
+
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			v, err := s.IncrCounter("hits", 1)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			mu.Lock()
+			seen[v] = true
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	if v, err := s.Counter("hits"); err != nil {
+		t.Fatal(err)
+	} else if v != n {
+		t.Fatalf("unexpected value: %d", v)
+	} else if len(seen) != n {
+		t.Fatalf("unexpected distinct values: %d", len(seen))
+	}
+}
@@ -0,0 +1,134 @@
+package main_test
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"testing"
+
+	main "github.com/benbjohnson/application-development-using-boltdb"
+	"github.com/benbjohnson/application-development-using-boltdb/crashtest"
+	"github.com/benbjohnson/application-development-using-boltdb/keys"
+	"github.com/boltdb/bolt"
+)
+
+// Ensure every acknowledged write survives the process being killed.
+func TestStore_Crash_Kill(t *testing.T) {
+	if crashtest.IsChild() {
+		t.Skip("parent only")
+	}
+
+	s := NewStore()
+	defer s.Close()
+
+	// Write users in a child process and kill it partway through.
+	child := crashtest.StartChild(t, "TestStore_Crash_KillChild", "CRASHTEST_PATH="+s.Path)
+	var ids []int
+	for len(ids) < 100 {
+		line, err := child.ReadLine()
+		if err != nil {
+			t.Fatal(err)
+		}
+		id, err := strconv.Atoi(line)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, id)
+	}
+	if err := child.Kill(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Reopen and verify the file and every acknowledged user.
+	s.VerifyOnOpen = true
+	if err := s.Open(); err != nil {
+		t.Fatal(err)
+	} else if a, err := s.CheckIntegrity(); err != nil {
+		t.Fatal(err)
+	} else if len(a) != 0 {
+		t.Fatalf("unexpected violations: %v", a)
+	}
+	for _, id := range ids {
+		if u, err := s.User(id); err != nil {
+			t.Fatal(err)
+		} else if u == nil {
+			t.Fatalf("user %d lost", id)
+		}
+	}
+}
+
+// TestStore_Crash_KillChild creates users until it is killed, printing the
+// ID of each user after its transaction commits.
+func TestStore_Crash_KillChild(t *testing.T) {
+	if !crashtest.IsChild() {
+		t.Skip("run by TestStore_Crash_Kill")
+	}
+
+	s := &main.Store{Path: os.Getenv("CRASHTEST_PATH")}
+	if err := s.Open(); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; ; i++ {
+		u := &main.User{Username: fmt.Sprintf("user%d", i), Tags: []string{"crash"}}
+		if err := s.CreateUser(u); err != nil {
+			t.Fatal(err)
+		}
+		fmt.Println(u.ID)
+	}
+}
+
+// Ensure a torn write of the latest meta page rolls back to the previous
+// transaction.
+func TestStore_Crash_TornMeta(t *testing.T) {
+	s := OpenStore()
+	defer s.Close()
+
+	if err := s.CreateUser(&main.User{Username: "susy"}); err != nil {
+		t.Fatal(err)
+	} else if err := s.Store.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Write a second user directly in a transaction that bolt records in
+	// the second meta page. Meta pages alternate by transaction ID.
+	db, err := bolt.Open(s.Path, 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var txid int
+	db.View(func(tx *bolt.Tx) error { txid = tx.ID(); return nil })
+	if txid%2 == 1 {
+		if err := db.Update(func(tx *bolt.Tx) error { return nil }); err != nil {
+			t.Fatal(err)
+		}
+	}
+	buf, _ := (&main.User{ID: 2, Username: "john"}).MarshalBinary()
+	if err := db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte("Users")).Put(keys.Int(2), buf)
+	}); err != nil {
+		t.Fatal(err)
+	}
+	pageSize := db.Info().PageSize
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Tear the meta page written by the last transaction.
+	if err := crashtest.TearWrite(s.Path, int64(pageSize)+16, 64); err != nil {
+		t.Fatal(err)
+	}
+
+	// The last transaction is lost but the rest of the file is intact.
+	s.VerifyOnOpen = true
+	if err := s.Open(); err != nil {
+		t.Fatal(err)
+	} else if u, err := s.User(2); err != nil {
+		t.Fatal(err)
+	} else if u != nil {
+		t.Fatalf("unexpected user: %#v", u)
+	} else if u, err := s.User(1); err != nil {
+		t.Fatal(err)
+	} else if u == nil || u.Username != "susy" {
+		t.Fatalf("unexpected user: %#v", u)
+	}
+}
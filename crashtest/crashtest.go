@@ -0,0 +1,96 @@
+// Package crashtest provides helpers for testing recovery after crashes.
+//
+// Crashes are simulated by running part of a test in a child process that
+// is killed without warning, and by tearing writes in the data file after
+// the fact. Bolt writes directly to its file and memory map so faults
+// cannot be injected into individual writes while the store is running.
+package crashtest
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"os/exec"
+	"testing"
+)
+
+// childEnv is set in the environment of child processes.
+const childEnv = "CRASHTEST_CHILD"
+
+// IsChild returns true if the current process was started by StartChild.
+func IsChild() bool {
+	return os.Getenv(childEnv) != ""
+}
+
+// Child represents a test process that can be killed at any time.
+type Child struct {
+	cmd *exec.Cmd
+	r   *bufio.Scanner
+}
+
+// StartChild re-executes the test binary running only the test named name.
+// The child's environment includes env and IsChild reports true within it.
+// Anything the child writes to stdout can be read with ReadLine.
+func StartChild(t testing.TB, name string, env ...string) *Child {
+	t.Helper()
+
+	cmd := exec.Command(os.Args[0], "-test.run=^"+name+"$")
+	cmd.Env = append(append(os.Environ(), childEnv+"=1"), env...)
+	cmd.Stderr = os.Stderr
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	} else if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	c := &Child{cmd: cmd, r: bufio.NewScanner(stdout)}
+	t.Cleanup(func() { c.Kill() })
+	return c
+}
+
+// ReadLine returns the next line written by the child.
+// Returns io.EOF once the child has exited.
+func (c *Child) ReadLine() (string, error) {
+	if c.r.Scan() {
+		return c.r.Text(), nil
+	} else if err := c.r.Err(); err != nil {
+		return "", err
+	}
+	return "", io.EOF
+}
+
+// Kill terminates the child immediately, simulating a power cut from the
+// perspective of the process. Killing an exited child is a no-op.
+func (c *Child) Kill() error {
+	if c.cmd.ProcessState != nil {
+		return nil
+	} else if err := c.cmd.Process.Kill(); err != nil {
+		return err
+	}
+
+	// Wait reports the kill as an error so it is ignored.
+	c.cmd.Wait()
+	return nil
+}
+
+// TearWrite simulates a write that was interrupted partway through by
+// overwriting n bytes of the file at path, starting at off, with garbage.
+func TearWrite(path string, off int64, n int) error {
+	buf := make([]byte, n)
+	for i := range buf {
+		buf[i] = 0xAB
+	}
+
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if _, err := f.WriteAt(buf, off); err != nil {
+		return err
+	}
+	return f.Close()
+}
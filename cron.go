@@ -0,0 +1,167 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// scheduleSpec computes the run times of a schedule.
+type scheduleSpec interface {
+	// next returns the first run time after t or the zero time if there is
+	// none.
+	next(t time.Time) time.Time
+}
+
+// parseScheduleSpec parses a schedule spec. Specs are either "@every" with a
+// duration, such as "@every 90m", one of "@hourly", "@daily", "@weekly", or
+// "@monthly", or five cron fields: minute, hour, day of month, month, and
+// day of week. Cron fields accept "*", numbers, ranges such as "1-5", lists
+// such as "1,15", and steps such as "*/10". Times are in UTC.
+func parseScheduleSpec(spec string) (scheduleSpec, error) {
+	switch spec = strings.TrimSpace(spec); spec {
+	case "@hourly":
+		spec = "0 * * * *"
+	case "@daily":
+		spec = "0 0 * * *"
+	case "@weekly":
+		spec = "0 0 * * 0"
+	case "@monthly":
+		spec = "0 0 1 * *"
+	}
+
+	if s, ok := strings.CutPrefix(spec, "@every "); ok {
+		d, err := time.ParseDuration(strings.TrimSpace(s))
+		if err != nil || d < time.Second {
+			return nil, ErrScheduleSpecInvalid
+		}
+		return everySpec(d), nil
+	}
+
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return nil, ErrScheduleSpecInvalid
+	}
+
+	var c cronSpec
+	var err error
+	if c.minute, err = parseCronField(fields[0], 0, 59); err != nil {
+		return nil, err
+	} else if c.hour, err = parseCronField(fields[1], 0, 23); err != nil {
+		return nil, err
+	} else if c.dom, err = parseCronField(fields[2], 1, 31); err != nil {
+		return nil, err
+	} else if c.month, err = parseCronField(fields[3], 1, 12); err != nil {
+		return nil, err
+	} else if c.dow, err = parseCronField(fields[4], 0, 7); err != nil {
+		return nil, err
+	}
+
+	// Sunday may be written as 0 or 7.
+	if c.dow&(1<<7) != 0 {
+		c.dow |= 1
+	}
+	c.domAny, c.dowAny = fields[2] == "*", fields[4] == "*"
+
+	if c.next(time.Now()).IsZero() {
+		return nil, ErrScheduleSpecInvalid
+	}
+	return &c, nil
+}
+
+// NextRun returns the first run time of a schedule spec after t, such as to
+// preview a schedule before saving it.
+func NextRun(spec string, t time.Time) (time.Time, error) {
+	sp, err := parseScheduleSpec(spec)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return sp.next(t), nil
+}
+
+// everySpec runs at a fixed interval.
+type everySpec time.Duration
+
+func (d everySpec) next(t time.Time) time.Time {
+	return t.Add(time.Duration(d)).Truncate(time.Second)
+}
+
+// cronSpec runs at the times matching a set of cron fields. Each field is a
+// bitset of the values it matches.
+type cronSpec struct {
+	minute, hour, dom, month, dow uint64
+
+	// Set if the day fields were "*". As in cron, a day matches either day
+	// field if both are restricted.
+	domAny, dowAny bool
+}
+
+func (c *cronSpec) next(t time.Time) time.Time {
+	t = t.UTC().Truncate(time.Minute).Add(time.Minute)
+
+	// Give up on specs that never match, such as February 30th.
+	for limit := t.AddDate(5, 0, 0); t.Before(limit); {
+		if c.month&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+		} else if !c.dayMatches(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, time.UTC)
+		} else if c.hour&(1<<uint(t.Hour())) == 0 {
+			t = t.Truncate(time.Hour).Add(time.Hour)
+		} else if c.minute&(1<<uint(t.Minute())) == 0 {
+			t = t.Add(time.Minute)
+		} else {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// dayMatches returns true if the day of t matches the day fields.
+func (c *cronSpec) dayMatches(t time.Time) bool {
+	dom := c.dom&(1<<uint(t.Day())) != 0
+	dow := c.dow&(1<<uint(t.Weekday())) != 0
+	if c.domAny || c.dowAny {
+		return dom && dow
+	}
+	return dom || dow
+}
+
+// parseCronField returns the bitset of values matched by a cron field.
+func parseCronField(field string, min, max int) (uint64, error) {
+	var bits uint64
+	for _, item := range strings.Split(field, ",") {
+		rng, step := item, 1
+		if i := strings.IndexByte(item, '/'); i >= 0 {
+			n, err := strconv.Atoi(item[i+1:])
+			if err != nil || n <= 0 {
+				return 0, ErrScheduleSpecInvalid
+			}
+			rng, step = item[:i], n
+		}
+
+		lo, hi := min, max
+		if rng != "*" {
+			a, b, isRange := strings.Cut(rng, "-")
+			var err error
+			if lo, err = strconv.Atoi(a); err != nil {
+				return 0, ErrScheduleSpecInvalid
+			}
+			hi = lo
+			if isRange {
+				if hi, err = strconv.Atoi(b); err != nil {
+					return 0, ErrScheduleSpecInvalid
+				}
+			} else if step > 1 {
+				hi = max
+			}
+		}
+		if lo < min || hi > max || lo > hi {
+			return 0, ErrScheduleSpecInvalid
+		}
+
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, nil
+}
@@ -0,0 +1,51 @@
+package main_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	main "github.com/benbjohnson/application-development-using-boltdb"
+)
+
+// Ensure schedule specs compute their next run time.
+func TestNextRun(t *testing.T) {
+	// Wednesday, March 15th, 2023.
+	now := time.Date(2023, 3, 15, 10, 30, 15, 0, time.UTC)
+
+	for _, tt := range []struct {
+		spec string
+		want time.Time
+	}{
+		{"@every 90m", time.Date(2023, 3, 15, 12, 0, 15, 0, time.UTC)},
+		{"@hourly", time.Date(2023, 3, 15, 11, 0, 0, 0, time.UTC)},
+		{"@daily", time.Date(2023, 3, 16, 0, 0, 0, 0, time.UTC)},
+		{"@weekly", time.Date(2023, 3, 19, 0, 0, 0, 0, time.UTC)},
+		{"@monthly", time.Date(2023, 4, 1, 0, 0, 0, 0, time.UTC)},
+		{"* * * * *", time.Date(2023, 3, 15, 10, 31, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2023, 3, 15, 10, 45, 0, 0, time.UTC)},
+		{"30 2 * * *", time.Date(2023, 3, 16, 2, 30, 0, 0, time.UTC)},
+		{"0 9-17 * * 1-5", time.Date(2023, 3, 15, 11, 0, 0, 0, time.UTC)},
+		{"0 0 * * 7", time.Date(2023, 3, 19, 0, 0, 0, 0, time.UTC)},
+		{"0 0 1,15 * *", time.Date(2023, 4, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC)},
+
+		// Either day field matches when both are restricted.
+		{"0 0 1 * 5", time.Date(2023, 3, 17, 0, 0, 0, 0, time.UTC)},
+	} {
+		if got, err := main.NextRun(tt.spec, now); err != nil {
+			t.Fatalf("%s: %v", tt.spec, err)
+		} else if !got.Equal(tt.want) {
+			t.Fatalf("%s: next=%s, want %s", tt.spec, got, tt.want)
+		}
+	}
+}
+
+// Ensure invalid specs are rejected.
+func TestNextRun_ErrScheduleSpecInvalid(t *testing.T) {
+	for _, spec := range []string{"", "* * * *", "60 * * * *", "* 24 * * *", "5-1 * * * *", "*/0 * * * *", "0 0 30 2 *", "@every 1ms", "@every soon", "@yearly"} {
+		if _, err := main.NextRun(spec, time.Now()); !errors.Is(err, main.ErrScheduleSpecInvalid) {
+			t.Fatalf("%q: unexpected error: %v", spec, err)
+		}
+	}
+}
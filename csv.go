@@ -0,0 +1,206 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// User fields that can be exported to or imported from CSV. Tags are
+// separated by semicolons and times are formatted as RFC 3339.
+const (
+	CSVFieldID        = "id"
+	CSVFieldUsername  = "username"
+	CSVFieldTags      = "tags"
+	CSVFieldCreatedAt = "created_at"
+)
+
+// ExportCSV writes every user to w as CSV with a header row followed by one
+// row per user containing the given fields, in order.
+func (s *Store) ExportCSV(w io.Writer, fields []string) error {
+	for _, f := range fields {
+		if f != CSVFieldID && f != CSVFieldUsername && f != CSVFieldTags && f != CSVFieldCreatedAt {
+			return ErrInvalidCSVField
+		}
+	}
+
+	cw := csv.NewWriter(w)
+	if err := cw.Write(fields); err != nil {
+		return err
+	}
+
+	if err := s.view("ExportCSV", func(tx *Tx) error {
+		return scanUsers(tx, false, func(u *User) {
+			row := make([]string, len(fields))
+			for i, f := range fields {
+				switch f {
+				case CSVFieldID:
+					row[i] = strconv.Itoa(u.ID)
+				case CSVFieldUsername:
+					row[i] = u.Username
+				case CSVFieldTags:
+					row[i] = strings.Join(u.Tags, ";")
+				case CSVFieldCreatedAt:
+					row[i] = u.CreatedAt.Format(time.RFC3339Nano)
+				}
+			}
+			cw.Write(row)
+		})
+	}); err != nil {
+		return err
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+// ImportOptions configures ImportCSV.
+type ImportOptions struct {
+	// Validates every row and reports what would be imported without
+	// saving any users.
+	DryRun bool
+}
+
+// ImportResult reports the outcome of ImportCSV.
+type ImportResult struct {
+	// Number of users created, or that would be created in a dry run.
+	Created int
+
+	// Rows that could not be imported. These rows are skipped.
+	Errors []*RowError
+}
+
+// RowError is an error importing a single CSV row.
+type RowError struct {
+	Row int // 1-based row number, including the header
+	Err error
+}
+
+// Error returns the row number and the underlying error.
+func (e *RowError) Error() string {
+	return fmt.Sprintf("row %d: %s", e.Row, e.Err)
+}
+
+// Unwrap returns the underlying error.
+func (e *RowError) Unwrap() error { return e.Err }
+
+// ImportCSV creates a user for each row of r. The first row is a header and
+// mapping maps its column names to user fields. Columns that are not mapped
+// are ignored. IDs are always assigned by the store so the id field cannot
+// be mapped.
+//
+// Rows that fail are reported in the result and do not stop the import.
+// Each row is saved in its own transaction with fsync deferred until the
+// end, as with BulkLoad. A dry run applies all rows in a single transaction
+// that is rolled back.
+func (s *Store) ImportCSV(r io.Reader, mapping map[string]string, opts ImportOptions) (*ImportResult, error) {
+	for _, f := range mapping {
+		if f != CSVFieldUsername && f != CSVFieldTags && f != CSVFieldCreatedAt {
+			return nil, ErrInvalidCSVField
+		}
+	}
+
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	header, err := cr.Read()
+	if err == io.EOF {
+		return &ImportResult{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	// Resolve the user field of each column.
+	columns := make([]string, len(header))
+	for i, name := range header {
+		columns[i] = mapping[name]
+	}
+
+	result := &ImportResult{}
+	importRows := func(create func(u *User) error) error {
+		for row := 2; ; row++ {
+			rec, err := cr.Read()
+			if err == io.EOF {
+				return nil
+			} else if err != nil {
+				return err
+			}
+
+			u, err := parseCSVUser(columns, rec)
+			if err == nil {
+				err = create(u)
+			}
+			if err != nil {
+				result.Errors = append(result.Errors, &RowError{Row: row, Err: err})
+				continue
+			}
+			result.Created++
+		}
+	}
+
+	if opts.DryRun {
+		tx, err := s.begin("ImportCSV", true)
+		if err != nil {
+			return nil, err
+		}
+		defer tx.Rollback()
+
+		if err := importRows(func(u *User) error {
+			return tx.call(func(tx *Tx) error { return createUser(tx, u) })
+		}); err != nil {
+			return nil, err
+		}
+		return result, nil
+	}
+
+	if err := s.BulkLoad(func() error {
+		return importRows(s.CreateUser)
+	}); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// parseCSVUser returns a user from a CSV record whose columns map to the
+// given user fields.
+func parseCSVUser(columns []string, rec []string) (*User, error) {
+	u := &User{}
+	for i, v := range rec {
+		if i >= len(columns) {
+			break
+		}
+
+		switch columns[i] {
+		case CSVFieldUsername:
+			u.Username = v
+		case CSVFieldTags:
+			for _, tag := range strings.Split(v, ";") {
+				if tag = strings.TrimSpace(tag); tag != "" && !hasTag(u.Tags, tag) {
+					u.Tags = append(u.Tags, tag)
+				}
+			}
+		case CSVFieldCreatedAt:
+			if v == "" {
+				continue
+			}
+			t, err := time.Parse(time.RFC3339Nano, v)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s: %q", CSVFieldCreatedAt, v)
+			}
+			u.CreatedAt = t.UTC()
+		}
+	}
+
+	if u.Username == "" {
+		return nil, ErrUsernameRequired
+	}
+	return u, nil
+}
+
+// CSV related errors.
+var (
+	ErrInvalidCSVField  = &Error{Code: EINVALID, Message: "invalid csv field"}
+	ErrUsernameRequired = &Error{Code: EINVALID, Message: "username required"}
+)
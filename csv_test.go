@@ -0,0 +1,99 @@
+package main_test
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	main "github.com/benbjohnson/application-development-using-boltdb"
+)
+
+// Ensure users can be exported with a chosen set of fields.
+func TestStore_ExportCSV(t *testing.T) {
+	s := OpenStore()
+	defer s.Close()
+
+	createdAt := time.Date(2016, time.June, 1, 0, 0, 0, 0, time.UTC)
+	if err := s.CreateUser(&main.User{Username: "susy", Tags: []string{"beta", "admin"}, CreatedAt: createdAt}); err != nil {
+		t.Fatal(err)
+	} else if err := s.CreateUser(&main.User{Username: "john, jr", CreatedAt: createdAt}); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := s.ExportCSV(&buf, []string{"id", "username", "tags", "created_at"}); err != nil {
+		t.Fatal(err)
+	} else if got, want := buf.String(), "id,username,tags,created_at\n"+
+		"1,susy,beta;admin,2016-06-01T00:00:00Z\n"+
+		"2,\"john, jr\",,2016-06-01T00:00:00Z\n"; got != want {
+		t.Fatalf("unexpected csv:\n%s", got)
+	}
+
+	if err := s.ExportCSV(&buf, []string{"email"}); !errors.Is(err, main.ErrInvalidCSVField) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+// Ensure users can be imported with a column mapping and that bad rows are
+// reported without stopping the import.
+func TestStore_ImportCSV(t *testing.T) {
+	s := OpenStore()
+	defer s.Close()
+
+	input := "Name,Groups,Joined,Notes\n" +
+		"susy,beta;admin,2016-06-01T00:00:00Z,first\n" +
+		",beta,,missing name\n" +
+		"john,,yesterday,bad time\n" +
+		"jane,,,\n"
+	mapping := map[string]string{"Name": "username", "Groups": "tags", "Joined": "created_at"}
+
+	result, err := s.ImportCSV(strings.NewReader(input), mapping, main.ImportOptions{})
+	if err != nil {
+		t.Fatal(err)
+	} else if result.Created != 2 {
+		t.Fatalf("unexpected created count: %d", result.Created)
+	} else if len(result.Errors) != 2 {
+		t.Fatalf("unexpected errors: %v", result.Errors)
+	} else if e := result.Errors[0]; e.Row != 3 || e.Err != main.ErrUsernameRequired {
+		t.Fatalf("unexpected error: %v", e)
+	} else if e := result.Errors[1]; e.Row != 4 {
+		t.Fatalf("unexpected error: %v", e)
+	}
+
+	if u, err := s.UserByName("susy"); err != nil {
+		t.Fatal(err)
+	} else if u == nil || len(u.Tags) != 2 || !u.CreatedAt.Equal(time.Date(2016, time.June, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Fatalf("unexpected user: %#v", u)
+	} else if u, err := s.UserByName("jane"); err != nil {
+		t.Fatal(err)
+	} else if u == nil || u.CreatedAt.IsZero() {
+		t.Fatalf("unexpected user: %#v", u)
+	}
+
+	// The id field is assigned by the store.
+	if _, err := s.ImportCSV(strings.NewReader(input), map[string]string{"Name": "id"}, main.ImportOptions{}); !errors.Is(err, main.ErrInvalidCSVField) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+// Ensure a dry run reports results without saving users.
+func TestStore_ImportCSV_DryRun(t *testing.T) {
+	s := OpenStore()
+	defer s.Close()
+
+	input := "username\nsusy\n\njohn\n"
+	result, err := s.ImportCSV(strings.NewReader(input), map[string]string{"username": "username"}, main.ImportOptions{DryRun: true})
+	if err != nil {
+		t.Fatal(err)
+	} else if result.Created != 2 || len(result.Errors) != 0 {
+		t.Fatalf("unexpected result: %#v", result)
+	}
+
+	if a, err := s.Users(); err != nil {
+		t.Fatal(err)
+	} else if len(a) != 0 {
+		t.Fatalf("unexpected users: %#v", a)
+	}
+}
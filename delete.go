@@ -0,0 +1,66 @@
+package main
+
+import (
+	"github.com/benbjohnson/application-development-using-boltdb/keys"
+)
+
+// DefaultDeleteBatchSize is the default number of users examined per
+// transaction by DeleteUsersWhere.
+const DefaultDeleteBatchSize = 1000
+
+// DeleteUsersWhere deletes every user for which pred returns true and returns
+// the number of users deleted. Each user is removed as by DeleteUser, along
+// with its index entries, blobs, and credentials.
+//
+// Users are examined in batches of batchSize, ordered by ID, with one write
+// transaction per batch so other writers are not blocked for the whole
+// delete. Batches that committed remain deleted if a later batch fails.
+// batchSize defaults to DefaultDeleteBatchSize if zero or negative.
+func (s *Store) DeleteUsersWhere(pred func(*User) bool, batchSize int) (int, error) {
+	if batchSize <= 0 {
+		batchSize = DefaultDeleteBatchSize
+	}
+
+	var n int
+	seek := keys.Int(0)
+	for seek != nil {
+		var next []byte
+		var ids []int
+		if err := s.update("DeleteUsersWhere", func(tx *Tx) error {
+			// Find the users of the batch to delete. Deletes are applied
+			// after iterating since writes can move the cursor.
+			ids = ids[:0]
+			c := tx.Bucket([]byte("Users")).Cursor()
+			k, v := c.Seek(seek)
+			for i := 0; k != nil && i < batchSize; k, v = c.Next() {
+				tx.recordRead("Users", v)
+
+				var u User
+				if err := decodeUser(tx, v, &u); err != nil {
+					return err
+				} else if pred(&u) {
+					ids = append(ids, u.ID)
+				}
+				i++
+			}
+
+			// Save the position of the next batch.
+			next = nil
+			if k != nil {
+				next = append([]byte{}, k...)
+			}
+
+			for _, id := range ids {
+				if err := deleteUser(tx, id); err != nil {
+					return err
+				}
+			}
+			return nil
+		}); err != nil {
+			return n, err
+		}
+		n += len(ids)
+		seek = next
+	}
+	return n, nil
+}
@@ -0,0 +1,83 @@
+package main_test
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	main "github.com/benbjohnson/application-development-using-boltdb"
+)
+
+// Ensure matching users are deleted across multiple batches.
+func TestStore_DeleteUsersWhere(t *testing.T) {
+	s := OpenStore()
+	defer s.Close()
+
+	for i := 0; i < 25; i++ {
+		u := &main.User{Username: fmt.Sprintf("user%d", i)}
+		if i%2 == 0 {
+			u.Tags = []string{"spam"}
+		}
+		if err := s.CreateUser(u); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var calls int
+	n, err := s.DeleteUsersWhere(func(u *main.User) bool {
+		calls++
+		return len(u.Tags) > 0 && u.Tags[0] == "spam"
+	}, 4)
+	if err != nil {
+		t.Fatal(err)
+	} else if n != 13 {
+		t.Fatalf("unexpected count: %d", n)
+	} else if calls != 25 {
+		t.Fatalf("unexpected predicate calls: %d", calls)
+	}
+
+	// Deleted users are removed from their indexes.
+	if a, err := s.UsersWithTag("spam"); err != nil {
+		t.Fatal(err)
+	} else if len(a) != 0 {
+		t.Fatalf("unexpected tagged users: %d", len(a))
+	} else if u, err := s.UserByName("user0"); err != nil {
+		t.Fatal(err)
+	} else if u != nil {
+		t.Fatalf("unexpected user: %#v", u)
+	} else if u, err := s.User(2); err != nil {
+		t.Fatal(err)
+	} else if u == nil || u.Username != "user1" {
+		t.Fatalf("unexpected user: %#v", u)
+	}
+}
+
+// Ensure batches committed before a failure remain deleted.
+func TestStore_DeleteUsersWhere_Panic(t *testing.T) {
+	s := OpenStore()
+	defer s.Close()
+
+	for i := 0; i < 10; i++ {
+		if err := s.CreateUser(&main.User{Username: fmt.Sprintf("user%d", i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	n, err := s.DeleteUsersWhere(func(u *main.User) bool {
+		if u.ID == 7 {
+			panic("bad user")
+		}
+		return true
+	}, 5)
+	var e *main.PanicError
+	if !errors.As(err, &e) || !strings.Contains(err.Error(), "bad user") {
+		t.Fatalf("unexpected error: %v", err)
+	} else if n != 5 {
+		t.Fatalf("unexpected count: %d", n)
+	} else if a, err := s.Users(); err != nil {
+		t.Fatal(err)
+	} else if len(a) != 5 || a[0].ID != 6 {
+		t.Fatalf("unexpected users: %d", len(a))
+	}
+}
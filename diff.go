@@ -0,0 +1,174 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"reflect"
+)
+
+// Change types reported by Diff.
+const (
+	ChangeCreated = "created"
+	ChangeUpdated = "updated"
+	ChangeDeleted = "deleted"
+)
+
+// Change represents a difference in a single user between two data files.
+type Change struct {
+	Type   string `json:"type"`
+	UserID int    `json:"id"`
+
+	// User before and after the change. Before is nil for created users
+	// and After is nil for deleted users.
+	Before *User `json:"before,omitempty"`
+	After  *User `json:"after,omitempty"`
+}
+
+// Diff returns the changes to users from the store to the data file at
+// otherPath, such as from yesterday's backup to today's. Changes are
+// ordered by user ID. For a TenantStore, only the tenant's users are
+// compared.
+//
+// The other file is opened read-only so it must not be open for writing
+// by another store.
+func (s *Store) Diff(otherPath string) ([]Change, error) {
+	other := &Store{Path: otherPath, ReadOnly: true, LockTimeout: s.LockTimeout, Logger: s.Logger, tenant: s.tenant}
+	if err := other.Open(); err != nil {
+		return nil, err
+	}
+	defer other.Close()
+
+	var a []Change
+	if err := s.view("Diff", func(tx *Tx) error {
+		return other.view("Diff", func(otx *Tx) error {
+			var err error
+			a, err = diffUsers(tx, otx)
+			return err
+		})
+	}); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// diffUsers walks the Users buckets of both transactions in key order and
+// returns a change for each user that differs.
+func diffUsers(tx, otx *Tx) ([]Change, error) {
+	var a []Change
+	c, oc := tx.Bucket([]byte("Users")).Cursor(), otx.Bucket([]byte("Users")).Cursor()
+	k, v := c.First()
+	okey, oval := oc.First()
+	for k != nil || okey != nil {
+		// Determine which side has the lower key. Keys found on only one
+		// side are creations or deletions.
+		var cmp int
+		if k == nil {
+			cmp = 1
+		} else if okey == nil {
+			cmp = -1
+		} else {
+			cmp = bytes.Compare(k, okey)
+		}
+
+		var before, after *User
+		if cmp <= 0 {
+			before = &User{}
+			if err := decodeUser(tx, v, before); err != nil {
+				return nil, err
+			}
+		}
+		if cmp >= 0 {
+			after = &User{}
+			if err := decodeUser(otx, oval, after); err != nil {
+				return nil, err
+			}
+		}
+
+		switch {
+		case before == nil:
+			a = append(a, Change{Type: ChangeCreated, UserID: after.ID, After: after})
+		case after == nil:
+			a = append(a, Change{Type: ChangeDeleted, UserID: before.ID, Before: before})
+		case !reflect.DeepEqual(before, after):
+			a = append(a, Change{Type: ChangeUpdated, UserID: before.ID, Before: before, After: after})
+		}
+
+		// Advance the cursors whose keys were consumed.
+		if cmp <= 0 {
+			k, v = c.Next()
+		}
+		if cmp >= 0 {
+			okey, oval = oc.Next()
+		}
+	}
+	return a, nil
+}
+
+// DiffCommand reports the changes to users between two data files.
+type DiffCommand struct {
+	*Main
+}
+
+// NewDiffCommand returns a new instance of DiffCommand.
+func NewDiffCommand(m *Main) *DiffCommand {
+	return &DiffCommand{Main: m}
+}
+
+// Run prints one line per change, or one JSON object per line if -json is set.
+func (cmd *DiffCommand) Run(args ...string) error {
+	fs := flag.NewFlagSet("diff", flag.ContinueOnError)
+	fs.SetOutput(cmd.Stderr)
+	asJSON := fs.Bool("json", false, "print changes as JSON objects, one per line")
+	tenant := fs.String("tenant", "", "compare the users of a single tenant")
+	fs.Usage = func() {
+		fmt.Fprintln(cmd.Stderr, "usage: appdev diff [-json] [-tenant name] old new")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err == flag.ErrHelp {
+		return ErrUsage
+	} else if err != nil {
+		return err
+	} else if fs.NArg() != 2 {
+		fs.Usage()
+		return ErrUsage
+	}
+
+	s := NewStore(fs.Arg(0), WithReadOnly())
+	if err := s.Open(); err != nil {
+		return err
+	}
+	defer s.Close()
+
+	var a []Change
+	var err error
+	if *tenant != "" {
+		a, err = s.Tenant(*tenant).Diff(fs.Arg(1))
+	} else {
+		a, err = s.Diff(fs.Arg(1))
+	}
+	if err != nil {
+		return err
+	}
+
+	enc := json.NewEncoder(cmd.Stdout)
+	for _, c := range a {
+		if *asJSON {
+			if err := enc.Encode(c); err != nil {
+				return err
+			}
+			continue
+		}
+
+		switch c.Type {
+		case ChangeCreated:
+			fmt.Fprintf(cmd.Stdout, "+ %d %s\n", c.UserID, c.After.Username)
+		case ChangeDeleted:
+			fmt.Fprintf(cmd.Stdout, "- %d %s\n", c.UserID, c.Before.Username)
+		case ChangeUpdated:
+			fmt.Fprintf(cmd.Stdout, "~ %d %+v -> %+v\n", c.UserID, *c.Before, *c.After)
+		}
+	}
+	return nil
+}
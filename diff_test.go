@@ -0,0 +1,100 @@
+package main_test
+
+import (
+	"encoding/json"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	main "github.com/benbjohnson/application-development-using-boltdb"
+)
+
+// Ensure Diff reports created, updated, and deleted users.
+func TestStore_Diff(t *testing.T) {
+	s := OpenStore()
+	defer s.Close()
+
+	createdAt := time.Date(2016, time.June, 1, 0, 0, 0, 0, time.UTC)
+	for _, name := range []string{"susy", "john", "jane"} {
+		if err := s.CreateUser(&main.User{Username: name, CreatedAt: createdAt}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Take a backup and then modify the store.
+	path := s.Path + ".old"
+	defer os.Remove(path)
+	if err := s.Snapshot(path); err != nil {
+		t.Fatal(err)
+	} else if err := s.SetUsername(1, "jimbo"); err != nil {
+		t.Fatal(err)
+	} else if err := s.DeleteUser(2); err != nil {
+		t.Fatal(err)
+	} else if err := s.CreateUser(&main.User{Username: "bob", CreatedAt: createdAt}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Compare the backup against the current data.
+	if err := s.Store.Close(); err != nil {
+		t.Fatal(err)
+	}
+	old := &main.Store{Path: path, ReadOnly: true}
+	if err := old.Open(); err != nil {
+		t.Fatal(err)
+	}
+	defer old.Close()
+
+	a, err := old.Diff(s.Path)
+	if err != nil {
+		t.Fatal(err)
+	} else if !reflect.DeepEqual(a, []main.Change{
+		{
+			Type:   main.ChangeUpdated,
+			UserID: 1,
+			Before: &main.User{ID: 1, Username: "susy", CreatedAt: createdAt},
+			After:  &main.User{ID: 1, Username: "jimbo", CreatedAt: createdAt},
+		},
+		{Type: main.ChangeDeleted, UserID: 2, Before: &main.User{ID: 2, Username: "john", CreatedAt: createdAt}},
+		{Type: main.ChangeCreated, UserID: 4, After: &main.User{ID: 4, Username: "bob", CreatedAt: createdAt}},
+	}) {
+		t.Fatalf("unexpected changes: %#v", a)
+	}
+}
+
+// Ensure the diff command prints changes as JSON.
+func TestDiffCommand_Run_JSON(t *testing.T) {
+	s := OpenStore()
+	defer s.Close()
+
+	path := s.Path + ".old"
+	defer os.Remove(path)
+	if err := s.Snapshot(path); err != nil {
+		t.Fatal(err)
+	} else if err := s.CreateUser(&main.User{Username: "susy"}); err != nil {
+		t.Fatal(err)
+	} else if err := s.Store.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	m := NewMain()
+	if err := m.Run("diff", "-json", path, s.Path); err != nil {
+		t.Fatal(err)
+	}
+
+	var c main.Change
+	if err := json.Unmarshal(m.Stdout.Bytes(), &c); err != nil {
+		t.Fatal(err)
+	} else if c.Type != main.ChangeCreated || c.UserID != 1 || c.After.Username != "susy" || c.Before != nil {
+		t.Fatalf("unexpected change: %#v", c)
+	}
+
+	// Text output is one line per change.
+	m = NewMain()
+	if err := m.Run("diff", path, s.Path); err != nil {
+		t.Fatal(err)
+	} else if got := m.Stdout.String(); !strings.HasPrefix(got, "+ 1 susy\n") {
+		t.Fatalf("unexpected output: %q", got)
+	}
+}
@@ -0,0 +1,23 @@
+package main
+
+// DryRunStore is a store whose write operations run all validation and
+// index maintenance but are rolled back instead of committed. Results such
+// as the ID assigned by CreateUser are still returned so changes can be
+// previewed.
+//
+// Only changes to the database are discarded. Side effects outside of it,
+// such as events delivered by a Relay, are not undone.
+type DryRunStore struct {
+	*Store
+}
+
+// DryRun returns a store that previews writes against the store's data.
+// It shares the store's database and must not be opened separately.
+func (s *Store) DryRun() *DryRunStore {
+	other := s.clone()
+	other.dryRun = true
+	return &DryRunStore{Store: other}
+}
+
+// Close is a no-op. The database is owned by the parent store.
+func (s *DryRunStore) Close() error { return nil }
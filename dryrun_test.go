@@ -0,0 +1,65 @@
+package main_test
+
+import (
+	"errors"
+	"testing"
+
+	main "github.com/benbjohnson/application-development-using-boltdb"
+)
+
+// Ensure writes on a dry run store return results but are not saved.
+func TestStore_DryRun(t *testing.T) {
+	s := OpenStore()
+	defer s.Close()
+
+	if err := s.CreateUser(&main.User{Username: "susy"}); err != nil {
+		t.Fatal(err)
+	}
+	dry := s.DryRun()
+
+	// The would-be ID is returned.
+	u := &main.User{Username: "john"}
+	if err := dry.CreateUser(u); err != nil {
+		t.Fatal(err)
+	} else if u.ID != 2 {
+		t.Fatalf("unexpected ID: %d", u.ID)
+	}
+
+	// Validation still runs.
+	if err := dry.SetUsername(100, "jimbo"); !errors.Is(err, main.ErrUserNotFound) {
+		t.Fatalf("unexpected error: %v", err)
+	} else if err := dry.SetUsername(1, "jimbo"); err != nil {
+		t.Fatal(err)
+	} else if err := dry.DeleteUser(1); err != nil {
+		t.Fatal(err)
+	}
+
+	// Nothing was saved and the shared database is still open.
+	if err := dry.Close(); err != nil {
+		t.Fatal(err)
+	} else if a, err := s.Users(); err != nil {
+		t.Fatal(err)
+	} else if len(a) != 1 || a[0].Username != "susy" {
+		t.Fatalf("unexpected users: %#v", a)
+	} else if u, err := s.UserByName("jimbo"); err != nil {
+		t.Fatal(err)
+	} else if u != nil {
+		t.Fatalf("unexpected user: %#v", u)
+	}
+}
+
+// Ensure a dry run reports quota errors that a commit would return.
+func TestStore_DryRun_Quota(t *testing.T) {
+	s := NewStore()
+	s.MaxUsers = 1
+	if err := s.Open(); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	if err := s.CreateUser(&main.User{Username: "susy"}); err != nil {
+		t.Fatal(err)
+	} else if err := s.DryRun().CreateUser(&main.User{Username: "john"}); err == nil {
+		t.Fatal("expected error")
+	}
+}
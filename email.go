@@ -0,0 +1,526 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/benbjohnson/application-development-using-boltdb/internal"
+	"github.com/benbjohnson/application-development-using-boltdb/keys"
+	"github.com/gogo/protobuf/proto"
+)
+
+// Email worker defaults.
+const (
+	DefaultEmailInterval    = 1 * time.Second
+	DefaultEmailBatchSize   = 100
+	DefaultEmailMaxAttempts = 8
+	DefaultEmailLogTTL      = 7 * 24 * time.Hour
+)
+
+// Email statuses.
+const (
+	EmailPending = "pending"
+	EmailSent    = "sent"
+	EmailFailed  = "failed"
+)
+
+// Email templates.
+const (
+	EmailVerification  = "verification"
+	EmailInvite        = "invite"
+	EmailPasswordReset = "password_reset"
+)
+
+// EmailTemplate is the subject and body of an email written with
+// text/template.
+type EmailTemplate struct {
+	Subject string
+	Body    string
+}
+
+// DefaultEmailTemplates are the templates used if the store's
+// EmailTemplates is unset. Each template is passed an EmailData.
+var DefaultEmailTemplates = map[string]*EmailTemplate{
+	EmailVerification: {
+		Subject: "Verify your email address",
+		Body:    "Hi {{.Username}},\n\nUse this code to verify your email address: {{.Token}}\n",
+	},
+	EmailInvite: {
+		Subject: "{{.InvitedBy}} invited you to join",
+		Body:    "{{.InvitedBy}} invited you to create an account.\n\nUse this code to accept before {{.ExpiresAt.Format \"Jan 2, 2006\"}}: {{.Token}}\n",
+	},
+	EmailPasswordReset: {
+		Subject: "Reset your password",
+		Body:    "Hi {{.Username}},\n\nUse this code to reset your password before {{.ExpiresAt.Format \"Jan 2, 2006 15:04 MST\"}}: {{.Token}}\n\nIf you did not ask to reset your password you can ignore this email.\n",
+	},
+}
+
+// EmailData is the data passed to email templates. Fields that do not apply
+// to a template are empty.
+type EmailData struct {
+	Username  string // recipient's username, if they have an account
+	InvitedBy string // username of the inviting user
+	Token     string
+	ExpiresAt time.Time
+}
+
+// Email is a message queued in the Emails bucket. The body is cleared once
+// the email has been sent or has failed so tokens it contains are not kept
+// in the data file; the rest is kept as a log for DefaultEmailLogTTL.
+type Email struct {
+	ID       int
+	To       string
+	Template string
+	Subject  string
+	Body     string
+
+	Status        string
+	Attempts      int
+	NextAttemptAt time.Time // time of the next attempt, while pending
+	LastError     string
+
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// MarshalBinary encodes an email to binary format.
+func (e *Email) MarshalBinary() ([]byte, error) {
+	return proto.Marshal(&internal.Email{
+		ID:            proto.Int64(int64(e.ID)),
+		To:            proto.String(e.To),
+		Template:      proto.String(e.Template),
+		Subject:       proto.String(e.Subject),
+		Body:          proto.String(e.Body),
+		Status:        proto.String(e.Status),
+		Attempts:      proto.Int64(int64(e.Attempts)),
+		NextAttemptAt: proto.Int64(encodeTime(e.NextAttemptAt)),
+		LastError:     proto.String(e.LastError),
+		CreatedAt:     proto.Int64(encodeTime(e.CreatedAt)),
+		UpdatedAt:     proto.Int64(encodeTime(e.UpdatedAt)),
+	})
+}
+
+// UnmarshalBinary decodes an email from binary data.
+func (e *Email) UnmarshalBinary(data []byte) error {
+	var pb internal.Email
+	if err := proto.Unmarshal(data, &pb); err != nil {
+		return err
+	}
+
+	e.ID = int(pb.GetID())
+	e.To = pb.GetTo()
+	e.Template = pb.GetTemplate()
+	e.Subject = pb.GetSubject()
+	e.Body = pb.GetBody()
+	e.Status = pb.GetStatus()
+	e.Attempts = int(pb.GetAttempts())
+	e.NextAttemptAt = decodeTime(pb.GetNextAttemptAt())
+	e.LastError = pb.GetLastError()
+	e.CreatedAt = decodeTime(pb.GetCreatedAt())
+	e.UpdatedAt = decodeTime(pb.GetUpdatedAt())
+
+	return nil
+}
+
+// Mailer sends email through an external service such as SMTP or an email
+// API.
+type Mailer interface {
+	Send(ctx context.Context, e *Email) error
+}
+
+// QueueEmail renders the named template with data and queues the email to
+// be sent by an EmailWorker, such as a verification email for a new
+// address. The email's ID is returned on success.
+func (s *Store) QueueEmail(to, tmpl string, data *EmailData) (int, error) {
+	var id int
+	if err := s.update("QueueEmail", func(tx *Tx) error {
+		e, err := queueEmail(tx, to, tmpl, data)
+		if err != nil {
+			return err
+		}
+		id = e.ID
+		return nil
+	}); err != nil {
+		return 0, err
+	}
+	return id, nil
+}
+
+// Email retrieves a queued or logged email by ID. Returns nil if the email
+// does not exist.
+func (s *Store) Email(id int) (*Email, error) {
+	var e *Email
+	if err := s.view("Email", func(tx *Tx) error {
+		v := tx.Bucket([]byte("Emails")).Get(keys.Int(id))
+		if v == nil {
+			return nil
+		}
+		tx.recordRead("Emails", v)
+
+		var err error
+		e, err = decodeEmail(tx, v)
+		return err
+	}); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// Emails retrieves the queued and logged emails with the given status,
+// ordered by ID. All emails are returned if status is empty.
+func (s *Store) Emails(status string) ([]*Email, error) {
+	a := []*Email{}
+	if err := s.view("Emails", func(tx *Tx) error {
+		return tx.Bucket([]byte("Emails")).ForEach(func(_, v []byte) error {
+			tx.recordRead("Emails", v)
+
+			e, err := decodeEmail(tx, v)
+			if err != nil {
+				return err
+			} else if status == "" || e.Status == status {
+				a = append(a, e)
+			}
+			return nil
+		})
+	}); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// queueEmail renders the named template and queues the email within tx so
+// it is only sent if the change that caused it commits.
+func queueEmail(tx *Tx, to, tmpl string, data *EmailData) (*Email, error) {
+	to = strings.TrimSpace(to)
+	if !strings.Contains(to, "@") {
+		return nil, ErrEmailAddressInvalid
+	} else if data == nil {
+		data = &EmailData{}
+	}
+
+	t := tx.store.emailTemplates()[tmpl]
+	if t == nil {
+		return nil, keyError("email template", tmpl, ErrEmailTemplateNotFound)
+	}
+	subject, err := renderEmailTemplate(t.Subject, data)
+	if err != nil {
+		return nil, err
+	}
+	body, err := renderEmailTemplate(t.Body, data)
+	if err != nil {
+		return nil, err
+	}
+
+	seq, err := tx.Bucket([]byte("Emails")).NextSequence()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	e := &Email{
+		ID:            int(seq),
+		To:            to,
+		Template:      tmpl,
+		Subject:       subject,
+		Body:          body,
+		Status:        EmailPending,
+		NextAttemptAt: now,
+		CreatedAt:     now,
+		UpdatedAt:     now,
+	}
+	if err := putEmail(tx, e, 0); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// renderEmailTemplate executes text as a template with data.
+func renderEmailTemplate(text string, data *EmailData) (string, error) {
+	t, err := template.New("email").Parse(text)
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, data); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// putEmail saves an email. Pending emails are indexed in the "EmailQueue"
+// bucket by their next attempt; finished emails are removed from the queue
+// and expire from the log after ttl.
+func putEmail(tx *Tx, e *Email, ttl time.Duration) error {
+	if e.Status != EmailPending {
+		e.Body = ""
+	}
+	buf, err := e.MarshalBinary()
+	if err != nil {
+		return err
+	}
+
+	if e.Status != EmailPending {
+		return putWithTTL(tx, "Emails", keys.Int(e.ID), buf, e.UpdatedAt.Add(ttl))
+	}
+
+	tx.recordWrite("EmailQueue", nil)
+	if err := tx.Bucket([]byte("EmailQueue")).Put(emailQueueKey(e), nil); err != nil {
+		return err
+	}
+	return putValue(tx, "Emails", keys.Int(e.ID), buf)
+}
+
+// decodeEmail reassembles v, if needed, and unmarshals it into an email.
+func decodeEmail(tx *Tx, v []byte) (*Email, error) {
+	v, err := readOverflow(tx, v)
+	if err != nil {
+		return nil, err
+	}
+	e := &Email{}
+	if err := e.UnmarshalBinary(v); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// userEmails reads the queued and logged emails sent to addr ordered by
+// ID. Addresses are compared case-insensitively.
+func userEmails(tx *Tx, addr string) ([]*Email, error) {
+	if addr == "" {
+		return nil, nil
+	}
+
+	var a []*Email
+	if err := tx.Bucket([]byte("Emails")).ForEach(func(_, v []byte) error {
+		tx.recordRead("Emails", v)
+
+		e, err := decodeEmail(tx, v)
+		if err != nil {
+			return err
+		} else if strings.EqualFold(e.To, addr) {
+			a = append(a, e)
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// deleteUserEmails removes the queued and logged emails sent to addr and
+// returns their count. Pending emails are not sent.
+func deleteUserEmails(tx *Tx, addr string) (int, error) {
+	a, err := userEmails(tx, addr)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, e := range a {
+		if e.Status == EmailPending {
+			tx.recordDelete("EmailQueue")
+			if err := tx.Bucket([]byte("EmailQueue")).Delete(emailQueueKey(e)); err != nil {
+				return 0, err
+			}
+		}
+		if err := deleteWithTTL(tx, "Emails", keys.Int(e.ID)); err != nil {
+			return 0, err
+		}
+	}
+	return len(a), nil
+}
+
+// emailQueueKey returns the key of e in the send queue.
+func emailQueueKey(e *Email) []byte {
+	return keys.Join(keys.Time(e.NextAttemptAt), keys.Int(e.ID))
+}
+
+// emailTemplates returns the configured templates or the defaults, if unset.
+func (s *Store) emailTemplates() map[string]*EmailTemplate {
+	if s.EmailTemplates == nil {
+		return DefaultEmailTemplates
+	}
+	return s.EmailTemplates
+}
+
+// EmailWorker sends queued emails through a Mailer in the background.
+// Failed sends are retried with exponential backoff until MaxAttempts is
+// reached. Emails are sent at least once: an email may be sent again if the
+// worker stops before its status is saved. Only one worker should run per
+// store.
+type EmailWorker struct {
+	closing chan struct{}
+	wg      sync.WaitGroup
+
+	// Store to read emails from.
+	Store *Store
+
+	// Service used to send emails.
+	Mailer Mailer
+
+	// Time between checks for due emails. Defaults to DefaultEmailInterval.
+	Interval time.Duration
+
+	// Maximum number of emails sent per flush.
+	// Defaults to DefaultEmailBatchSize.
+	BatchSize int
+
+	// Number of attempts before an email is marked as failed.
+	// Defaults to DefaultEmailMaxAttempts.
+	MaxAttempts int
+
+	// Time sent and failed emails are kept in the log.
+	// Defaults to DefaultEmailLogTTL.
+	LogTTL time.Duration
+}
+
+// Open starts sending emails in the background.
+func (w *EmailWorker) Open() error {
+	w.closing = make(chan struct{})
+	w.wg.Add(1)
+	go func() { defer w.wg.Done(); w.monitor() }()
+	return nil
+}
+
+// Close stops sending emails.
+func (w *EmailWorker) Close() error {
+	if w.closing != nil {
+		close(w.closing)
+		w.wg.Wait()
+		w.closing = nil
+	}
+	return nil
+}
+
+// monitor flushes due emails on every interval until the worker is closed.
+func (w *EmailWorker) monitor() {
+	interval := w.Interval
+	if interval <= 0 {
+		interval = DefaultEmailInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-w.closing:
+			return
+		case <-ticker.C:
+			for {
+				n, err := w.Flush(context.Background())
+				if err != nil {
+					w.Store.logger().Error("email worker failed", "err", err)
+				}
+				if err != nil || n < w.batchSize() {
+					break
+				}
+			}
+		}
+	}
+}
+
+// Flush sends the next batch of due emails and returns the number attempted.
+// Failed sends are rescheduled and are not returned as errors.
+func (w *EmailWorker) Flush(ctx context.Context) (int, error) {
+	// Read a batch of due emails.
+	var emails []*Email
+	if err := w.Store.view("EmailDue", func(tx *Tx) error {
+		emails = nil
+		now := keys.Time(time.Now())
+		c := tx.Bucket([]byte("EmailQueue")).Cursor()
+		for k, _ := c.First(); k != nil && bytes.Compare(k, now) < 0 && len(emails) < w.batchSize(); k, _ = c.Next() {
+			r := keys.NewReader(k)
+			r.ReadTime()
+			id := r.ReadInt()
+			if err := r.Err(); err != nil {
+				return err
+			}
+
+			v := tx.Bucket([]byte("Emails")).Get(keys.Int(id))
+			if v == nil {
+				continue
+			}
+			tx.recordRead("Emails", v)
+
+			e, err := decodeEmail(tx, v)
+			if err != nil {
+				return err
+			}
+			emails = append(emails, e)
+		}
+		return nil
+	}); err != nil {
+		return 0, err
+	}
+
+	// Send outside of a transaction so a slow mailer doesn't block writers.
+	for _, e := range emails {
+		prev := emailQueueKey(e)
+		w.send(ctx, e)
+
+		if err := w.Store.update("EmailAck", func(tx *Tx) error {
+			tx.recordDelete("EmailQueue")
+			if err := tx.Bucket([]byte("EmailQueue")).Delete(prev); err != nil {
+				return err
+			} else if tx.Bucket([]byte("Emails")).Get(keys.Int(e.ID)) == nil {
+				return nil // removed while sending, such as by EraseUser
+			}
+			return putEmail(tx, e, w.logTTL())
+		}); err != nil {
+			return 0, err
+		}
+	}
+	return len(emails), nil
+}
+
+// send attempts to send e and updates its status, attempts, and next attempt
+// from the result.
+func (w *EmailWorker) send(ctx context.Context, e *Email) {
+	now := time.Now().UTC()
+	e.Attempts++
+	e.UpdatedAt = now
+
+	if err := w.Mailer.Send(ctx, e); err != nil {
+		e.LastError = err.Error()
+		if e.Attempts >= w.maxAttempts() {
+			e.Status = EmailFailed
+		} else {
+			e.NextAttemptAt = now.Add(jobRetryDelay(e.Attempts))
+		}
+		return
+	}
+	e.Status, e.LastError = EmailSent, ""
+}
+
+// batchSize returns the configured batch size or the default, if unset.
+func (w *EmailWorker) batchSize() int {
+	if w.BatchSize <= 0 {
+		return DefaultEmailBatchSize
+	}
+	return w.BatchSize
+}
+
+// maxAttempts returns the configured attempts or the default, if unset.
+func (w *EmailWorker) maxAttempts() int {
+	if w.MaxAttempts <= 0 {
+		return DefaultEmailMaxAttempts
+	}
+	return w.MaxAttempts
+}
+
+// logTTL returns the configured log TTL or the default, if unset.
+func (w *EmailWorker) logTTL() time.Duration {
+	if w.LogTTL <= 0 {
+		return DefaultEmailLogTTL
+	}
+	return w.LogTTL
+}
+
+// Email related errors.
+var (
+	ErrEmailAddressInvalid   = &Error{Code: EINVALID, Message: "invalid email address"}
+	ErrEmailTemplateNotFound = &Error{Code: ENOTFOUND, Message: "email template not found"}
+)
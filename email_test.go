@@ -0,0 +1,161 @@
+package main_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	main "github.com/benbjohnson/application-development-using-boltdb"
+)
+
+// Ensure queued emails are rendered, sent, and logged without their body.
+func TestEmailWorker_Flush(t *testing.T) {
+	s := OpenStore()
+	defer s.Close()
+
+	id, err := s.QueueEmail("susy@example.com", main.EmailVerification, &main.EmailData{Username: "susy", Token: "abc123"})
+	if err != nil {
+		t.Fatal(err)
+	} else if e, err := s.Email(id); err != nil {
+		t.Fatal(err)
+	} else if e.Status != main.EmailPending || e.Subject != "Verify your email address" || !strings.Contains(e.Body, "abc123") {
+		t.Fatalf("unexpected email: %#v", e)
+	}
+
+	var m Mailer
+	w := &main.EmailWorker{Store: s.Store, Mailer: &m}
+	if n, err := w.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	} else if n != 1 {
+		t.Fatalf("unexpected count: %d", n)
+	} else if sent := m.Emails(); len(sent) != 1 || sent[0].To != "susy@example.com" || !strings.Contains(sent[0].Body, "Hi susy") {
+		t.Fatalf("unexpected sent emails: %#v", sent)
+	}
+
+	if e, err := s.Email(id); err != nil {
+		t.Fatal(err)
+	} else if e.Status != main.EmailSent || e.Attempts != 1 || e.Body != "" {
+		t.Fatalf("unexpected email: %#v", e)
+	} else if a, err := s.Emails(main.EmailPending); err != nil {
+		t.Fatal(err)
+	} else if len(a) != 0 {
+		t.Fatalf("unexpected pending emails: %d", len(a))
+	}
+
+	// Sent emails are not sent again.
+	if n, err := w.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	} else if n != 0 {
+		t.Fatalf("unexpected count: %d", n)
+	}
+}
+
+// Ensure failed sends are retried later and fail after MaxAttempts.
+func TestEmailWorker_Flush_Retry(t *testing.T) {
+	s := OpenStore()
+	defer s.Close()
+
+	id, err := s.QueueEmail("susy@example.com", main.EmailVerification, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m := Mailer{Err: errors.New("smtp unavailable")}
+	w := &main.EmailWorker{Store: s.Store, Mailer: &m, MaxAttempts: 2}
+	if n, err := w.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	} else if n != 1 {
+		t.Fatalf("unexpected count: %d", n)
+	} else if n, err := w.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	} else if n != 0 {
+		t.Fatalf("unexpected count: %d", n)
+	}
+
+	if e, err := s.Email(id); err != nil {
+		t.Fatal(err)
+	} else if e.Status != main.EmailPending || e.Attempts != 1 || e.LastError != "smtp unavailable" || !e.NextAttemptAt.After(time.Now()) {
+		t.Fatalf("unexpected email: %#v", e)
+	}
+
+	waitFor(t, func() bool {
+		n, err := w.Flush(context.Background())
+		return err == nil && n == 1
+	})
+	if e, err := s.Email(id); err != nil {
+		t.Fatal(err)
+	} else if e.Status != main.EmailFailed || e.Attempts != 2 || e.Body != "" {
+		t.Fatalf("unexpected email: %#v", e)
+	}
+}
+
+// Ensure emails with an invalid address or unknown template are rejected.
+func TestStore_QueueEmail_Err(t *testing.T) {
+	s := OpenStore()
+	defer s.Close()
+
+	if _, err := s.QueueEmail("susy", main.EmailVerification, nil); !errors.Is(err, main.ErrEmailAddressInvalid) {
+		t.Fatalf("unexpected error: %v", err)
+	} else if _, err := s.QueueEmail("susy@example.com", "welcome", nil); !errors.Is(err, main.ErrEmailTemplateNotFound) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+// Ensure invites queue an email with their token when enabled.
+func TestStore_CreateInvite_QueueEmails(t *testing.T) {
+	s := OpenStore()
+	defer s.Close()
+	s.QueueEmails = true
+
+	if err := s.CreateUser(&main.User{Username: "susy"}); err != nil {
+		t.Fatal(err)
+	}
+	token, err := s.CreateInvite("jim@example.com", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// An invite that fails does not queue an email.
+	if _, err := s.CreateInvite("bob@example.com", 2); !errors.Is(err, main.ErrUserNotFound) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if a, err := s.Emails(""); err != nil {
+		t.Fatal(err)
+	} else if len(a) != 1 {
+		t.Fatalf("unexpected emails: %d", len(a))
+	} else if e := a[0]; e.To != "jim@example.com" || e.Template != main.EmailInvite || e.Subject != "susy invited you to join" || !strings.Contains(e.Body, token) {
+		t.Fatalf("unexpected email: %#v", e)
+	}
+}
+
+// Mailer is a test implementation of main.Mailer that records sent emails.
+type Mailer struct {
+	mu     sync.Mutex
+	emails []*main.Email
+
+	// If set, every send fails with this error.
+	Err error
+}
+
+// Send records e.
+func (m *Mailer) Send(ctx context.Context, e *main.Email) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.Err != nil {
+		return m.Err
+	}
+	other := *e
+	m.emails = append(m.emails, &other)
+	return nil
+}
+
+// Emails returns all sent emails.
+func (m *Mailer) Emails() []*main.Email {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]*main.Email{}, m.emails...)
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Error codes classify errors so that callers can tell, for example,
+// invalid input apart from missing records or I/O failures.
+const (
+	ECONFLICT     = "conflict"     // record exists or changed concurrently
+	EINTERNAL     = "internal"     // I/O failure, corruption, or bug
+	EINVALID      = "invalid"      // validation failed
+	ELIMIT        = "limit"        // quota exceeded
+	ENOTFOUND     = "not_found"    // record does not exist
+	EUNAUTHORIZED = "unauthorized" // credentials rejected
+	EUNAVAILABLE  = "unavailable"  // store cannot serve requests right now
+)
+
+// Error represents an application error.
+//
+// Sentinel errors such as ErrUserNotFound set Code and Message. Errors
+// returned by the store wrap them with the operation and, where known, the
+// entity and key involved, so they should be matched with errors.Is.
+// Other errors, such as those from bolt, are wrapped the same way and can
+// be retrieved with errors.Unwrap or errors.As.
+type Error struct {
+	Code    string
+	Message string
+
+	// Store operation that failed, such as "CreateUser".
+	Op string
+
+	// Kind and key of the record involved, such as "user" and "12".
+	Entity string
+	Key    string
+
+	// Underlying error, if any.
+	Err error
+}
+
+// Error returns the operation, record, and message of the error.
+func (e *Error) Error() string {
+	var b strings.Builder
+	if e.Op != "" {
+		b.WriteString(e.Op + ": ")
+	}
+	if e.Entity != "" {
+		b.WriteString(e.Entity + " " + e.Key + ": ")
+	}
+	if e.Err != nil {
+		b.WriteString(e.Err.Error())
+	} else {
+		b.WriteString(e.Message)
+	}
+	return b.String()
+}
+
+// Unwrap returns the underlying error.
+func (e *Error) Unwrap() error { return e.Err }
+
+// ErrorCode returns the code of the first error in err's chain that has one.
+// Quota errors return ELIMIT. Returns EINTERNAL for errors without a code
+// and an empty string for a nil error.
+func ErrorCode(err error) string {
+	if err == nil {
+		return ""
+	}
+	for ; err != nil; err = errors.Unwrap(err) {
+		switch e := err.(type) {
+		case *Error:
+			if e.Code != "" {
+				return e.Code
+			}
+		case *QuotaError:
+			return ELIMIT
+		}
+	}
+	return EINTERNAL
+}
+
+// HTTPStatus returns the HTTP status code for err.
+func HTTPStatus(err error) int {
+	switch ErrorCode(err) {
+	case "":
+		return http.StatusOK
+	case ECONFLICT:
+		return http.StatusConflict
+	case EINVALID:
+		return http.StatusBadRequest
+	case ELIMIT:
+		return http.StatusTooManyRequests
+	case ENOTFOUND:
+		return http.StatusNotFound
+	case EUNAUTHORIZED:
+		return http.StatusUnauthorized
+	case EUNAVAILABLE:
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// GRPCCode returns the gRPC status code for err, as defined by the
+// google.golang.org/grpc/codes package.
+func GRPCCode(err error) uint32 {
+	switch ErrorCode(err) {
+	case "":
+		return 0 // OK
+	case ECONFLICT:
+		return 6 // AlreadyExists
+	case EINVALID:
+		return 3 // InvalidArgument
+	case ELIMIT:
+		return 8 // ResourceExhausted
+	case ENOTFOUND:
+		return 5 // NotFound
+	case EUNAUTHORIZED:
+		return 16 // Unauthenticated
+	case EUNAVAILABLE:
+		return 14 // Unavailable
+	default:
+		return 13 // Internal
+	}
+}
+
+// wrapError annotates err with the store operation that returned it.
+func wrapError(op string, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &Error{Op: op, Err: err}
+}
+
+// keyError annotates err with the kind and key of the record involved.
+func keyError(entity string, key interface{}, err error) error {
+	return &Error{Entity: entity, Key: fmt.Sprint(key), Err: err}
+}
@@ -0,0 +1,78 @@
+package main_test
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	main "github.com/benbjohnson/application-development-using-boltdb"
+	"github.com/boltdb/bolt"
+)
+
+// Ensure store errors can be matched and annotate the operation and record.
+func TestStore_Error(t *testing.T) {
+	s := OpenStore()
+	defer s.Close()
+
+	err := s.SetUsername(100, "susy")
+	if !errors.Is(err, main.ErrUserNotFound) {
+		t.Fatalf("unexpected error: %v", err)
+	} else if err.Error() != "SetUsername: user 100: user not found" {
+		t.Fatalf("unexpected message: %s", err)
+	}
+
+	var e *main.Error
+	if !errors.As(err, &e) || e.Op != "SetUsername" {
+		t.Fatalf("unexpected error: %#v", e)
+	} else if code := main.ErrorCode(err); code != main.ENOTFOUND {
+		t.Fatalf("unexpected code: %s", code)
+	}
+}
+
+// Ensure underlying bolt errors are preserved.
+func TestStore_Error_Bolt(t *testing.T) {
+	s := OpenStore()
+	defer s.Close()
+	if err := s.Store.Close(); err != nil {
+		t.Fatal(err)
+	}
+	s.ReadOnly = true
+	if err := s.Open(); err != nil {
+		t.Fatal(err)
+	}
+
+	err := s.SetUsername(1, "susy")
+	if !errors.Is(err, bolt.ErrDatabaseReadOnly) {
+		t.Fatalf("unexpected error: %v", err)
+	} else if code := main.ErrorCode(err); code != main.EINTERNAL {
+		t.Fatalf("unexpected code: %s", code)
+	}
+}
+
+// Ensure error codes map to HTTP and gRPC status codes.
+func TestErrorCode(t *testing.T) {
+	for _, tt := range []struct {
+		err  error
+		code string
+		http int
+		grpc uint32
+	}{
+		{nil, "", http.StatusOK, 0},
+		{main.ErrUserNotFound, main.ENOTFOUND, http.StatusNotFound, 5},
+		{main.ErrTagRequired, main.EINVALID, http.StatusBadRequest, 3},
+		{main.ErrTenantExists, main.ECONFLICT, http.StatusConflict, 6},
+		{main.ErrAPIKeyExpired, main.EUNAUTHORIZED, http.StatusUnauthorized, 16},
+		{main.ErrDatabaseLocked, main.EUNAVAILABLE, http.StatusServiceUnavailable, 14},
+		{&main.QuotaError{Quota: main.QuotaUsers}, main.ELIMIT, http.StatusTooManyRequests, 8},
+		{&main.Error{Op: "CreateUser", Err: main.ErrIDExists}, main.ECONFLICT, http.StatusConflict, 6},
+		{errors.New("marker"), main.EINTERNAL, http.StatusInternalServerError, 13},
+	} {
+		if code := main.ErrorCode(tt.err); code != tt.code {
+			t.Errorf("%v: unexpected code: %s", tt.err, code)
+		} else if status := main.HTTPStatus(tt.err); status != tt.http {
+			t.Errorf("%v: unexpected http status: %d", tt.err, status)
+		} else if code := main.GRPCCode(tt.err); code != tt.grpc {
+			t.Errorf("%v: unexpected grpc code: %d", tt.err, code)
+		}
+	}
+}
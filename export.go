@@ -0,0 +1,140 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+
+	"github.com/benbjohnson/application-development-using-boltdb/keys"
+)
+
+// maxPBRecordSize is the largest record ImportPB accepts.
+const maxPBRecordSize = 64 << 20
+
+// importPBBatchSize is the number of users ImportPB saves per transaction.
+const importPBBatchSize = 1000
+
+// ExportPB writes every user to w, in ID order, as a stream of
+// internal.User messages. Each message is preceded by its length as an
+// unsigned varint, the same framing used by delimited protobuf readers in
+// other languages.
+//
+// Stored values are already encoded as internal.User so they are written
+// without being decoded, after decompression.
+func (s *Store) ExportPB(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	if err := s.view("ExportPB", func(tx *Tx) error {
+		return tx.Bucket([]byte("Users")).ForEach(func(_, v []byte) error {
+			tx.recordRead("Users", v)
+
+			buf, err := decodeValue(tx, v)
+			if err != nil {
+				return err
+			}
+			if _, err := bw.Write(binary.AppendUvarint(nil, uint64(len(buf)))); err != nil {
+				return err
+			}
+			_, err = bw.Write(buf)
+			return err
+		})
+	}); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+// ImportPB creates a user for each message read from a stream written by
+// ExportPB and returns the number of users imported. Users keep their IDs
+// and the bucket sequence is advanced past the largest one.
+//
+// Users are saved in batches of importPBBatchSize, each in its own
+// transaction, so users saved before an error remain. Returns ErrUserExists
+// if a user's ID is already in use.
+func (s *Store) ImportPB(r io.Reader) (int, error) {
+	br := bufio.NewReader(r)
+
+	var n int
+	for {
+		batch, err := readPBUsers(br, importPBBatchSize)
+		if err != nil {
+			return n, err
+		} else if len(batch) == 0 {
+			return n, nil
+		}
+
+		if err := s.update("ImportPB", func(tx *Tx) error {
+			for _, u := range batch {
+				if err := importUser(tx, u); err != nil {
+					return err
+				}
+			}
+			return nil
+		}); err != nil {
+			return n, err
+		}
+		n += len(batch)
+	}
+}
+
+// readPBUsers reads up to n users from a stream written by ExportPB.
+// Returns fewer users once the stream ends.
+func readPBUsers(r *bufio.Reader, n int) ([]*User, error) {
+	var a []*User
+	for len(a) < n {
+		sz, err := binary.ReadUvarint(r)
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, ErrInvalidPBStream
+		} else if sz > maxPBRecordSize {
+			return nil, ErrInvalidPBStream
+		}
+
+		buf := make([]byte, sz)
+		if _, err := io.ReadFull(r, buf); errors.Is(err, io.ErrUnexpectedEOF) || err == io.EOF {
+			return nil, ErrInvalidPBStream
+		} else if err != nil {
+			return nil, err
+		}
+
+		u := &User{}
+		if err := u.UnmarshalBinary(buf); err != nil {
+			return nil, ErrInvalidPBStream
+		} else if u.ID <= 0 {
+			return nil, ErrInvalidPBStream
+		} else if u.Username == "" {
+			return nil, keyError("user", u.ID, ErrUsernameRequired)
+		}
+		a = append(a, u)
+	}
+	return a, nil
+}
+
+// importUser saves u under its existing ID.
+func importUser(tx *Tx, u *User) error {
+	bkt := tx.Bucket([]byte("Users"))
+	if bkt.Get(keys.Int(u.ID)) != nil {
+		return keyError("user", u.ID, ErrUserExists)
+	} else if err := checkUserQuota(tx); err != nil {
+		return err
+	}
+
+	if err := saveUser(tx, u); err != nil {
+		return err
+	} else if uint64(u.ID) > bkt.Sequence() {
+		if err := bkt.SetSequence(uint64(u.ID)); err != nil {
+			return err
+		}
+	}
+
+	if err := recordUserRevision(tx, u.ID, u, nil); err != nil {
+		return err
+	}
+	return recordUserEvent(tx, EventUserCreated, u, nil)
+}
+
+// Export related errors.
+var (
+	ErrInvalidPBStream = &Error{Code: EINVALID, Message: "invalid protobuf stream"}
+)
@@ -0,0 +1,84 @@
+package main_test
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	main "github.com/benbjohnson/application-development-using-boltdb"
+)
+
+// Ensure users exported as protobuf can be imported into another store with
+// the same IDs.
+func TestStore_ExportPB(t *testing.T) {
+	s := OpenStore()
+	defer s.Close()
+	s.Compression = main.SnappyCompression
+
+	if err := s.CreateUser(&main.User{Username: "susy", Tags: []string{strings.Repeat("x", 10000)}}); err != nil {
+		t.Fatal(err)
+	} else if err := s.CreateUser(&main.User{Username: "john"}); err != nil {
+		t.Fatal(err)
+	} else if err := s.CreateUser(&main.User{Username: "jimbo"}); err != nil {
+		t.Fatal(err)
+	} else if err := s.DeleteUser(2); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := s.ExportPB(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	other := OpenStore()
+	defer other.Close()
+	if n, err := other.ImportPB(bytes.NewReader(buf.Bytes())); err != nil {
+		t.Fatal(err)
+	} else if n != 2 {
+		t.Fatalf("unexpected count: %d", n)
+	}
+
+	exp, err := s.Users()
+	if err != nil {
+		t.Fatal(err)
+	} else if a, err := other.Users(); err != nil {
+		t.Fatal(err)
+	} else if !reflect.DeepEqual(a, exp) {
+		t.Fatalf("unexpected users: %#v", a)
+	}
+
+	// New users are assigned IDs after the imported ones.
+	u := &main.User{Username: "bob"}
+	if err := other.CreateUser(u); err != nil {
+		t.Fatal(err)
+	} else if u.ID != 4 {
+		t.Fatalf("unexpected id: %d", u.ID)
+	}
+
+	// Importing the same users again conflicts.
+	if _, err := other.ImportPB(bytes.NewReader(buf.Bytes())); !errors.Is(err, main.ErrUserExists) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+// Ensure a truncated stream is rejected.
+func TestStore_ImportPB_ErrInvalidPBStream(t *testing.T) {
+	s := OpenStore()
+	defer s.Close()
+	if err := s.CreateUser(&main.User{Username: "susy"}); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := s.ExportPB(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	other := OpenStore()
+	defer other.Close()
+	if _, err := other.ImportPB(bytes.NewReader(buf.Bytes()[:buf.Len()-1])); !errors.Is(err, main.ErrInvalidPBStream) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
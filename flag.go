@@ -0,0 +1,242 @@
+package main
+
+import (
+	"hash/fnv"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/benbjohnson/application-development-using-boltdb/internal"
+	"github.com/gogo/protobuf/proto"
+)
+
+// Flag is a feature flag that is evaluated per user by FlagEnabled.
+type Flag struct {
+	Name string `json:"name"`
+
+	// Enables the flag for every user.
+	Enabled bool `json:"enabled"`
+
+	// Percentage of users, from 0 to 100, that the flag is enabled for.
+	// Users are chosen by a hash of the flag name and user ID so each user
+	// gets the same result on every call and raising the percentage only
+	// adds users.
+	Percentage int `json:"percentage"`
+
+	// Overrides that enable or disable the flag for individual users
+	// regardless of the settings above.
+	Users map[int]bool `json:"users,omitempty"`
+
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Validate returns an error if f cannot be saved.
+func (f *Flag) Validate() error {
+	if f.Name == "" {
+		return ErrFlagNameRequired
+	} else if f.Percentage < 0 || f.Percentage > 100 {
+		return ErrInvalidFlagPercentage
+	}
+	return nil
+}
+
+// EnabledFor returns true if the flag is enabled for the user.
+func (f *Flag) EnabledFor(userID int) bool {
+	if on, ok := f.Users[userID]; ok {
+		return on
+	} else if f.Enabled {
+		return true
+	}
+	return flagBucket(f.Name, userID) < f.Percentage
+}
+
+// flagBucket returns a number from 0 to 99 that is fixed for a flag and user.
+func flagBucket(name string, userID int) int {
+	h := fnv.New32a()
+	h.Write([]byte(name))
+	h.Write([]byte{0})
+	h.Write([]byte(strconv.Itoa(userID)))
+	return int(h.Sum32() % 100)
+}
+
+// MarshalBinary encodes a flag to binary format.
+func (f *Flag) MarshalBinary() ([]byte, error) {
+	pb := &internal.Flag{
+		Name:       proto.String(f.Name),
+		Enabled:    proto.Bool(f.Enabled),
+		Percentage: proto.Int64(int64(f.Percentage)),
+		UpdatedAt:  proto.Int64(encodeTime(f.UpdatedAt)),
+	}
+	for id, on := range f.Users {
+		if on {
+			pb.EnabledUsers = append(pb.EnabledUsers, int64(id))
+		} else {
+			pb.DisabledUsers = append(pb.DisabledUsers, int64(id))
+		}
+	}
+	slices.Sort(pb.EnabledUsers)
+	slices.Sort(pb.DisabledUsers)
+	return proto.Marshal(pb)
+}
+
+// UnmarshalBinary decodes a flag from binary data.
+func (f *Flag) UnmarshalBinary(data []byte) error {
+	var pb internal.Flag
+	if err := proto.Unmarshal(data, &pb); err != nil {
+		return err
+	}
+
+	f.Name = pb.GetName()
+	f.Enabled = pb.GetEnabled()
+	f.Percentage = int(pb.GetPercentage())
+	f.Users = nil
+	if n := len(pb.EnabledUsers) + len(pb.DisabledUsers); n > 0 {
+		f.Users = make(map[int]bool, n)
+		for _, id := range pb.EnabledUsers {
+			f.Users[int(id)] = true
+		}
+		for _, id := range pb.DisabledUsers {
+			f.Users[int(id)] = false
+		}
+	}
+	f.UpdatedAt = decodeTime(pb.GetUpdatedAt())
+
+	return nil
+}
+
+// SetFlag creates or replaces a flag. UpdatedAt is set on f on success.
+func (s *Store) SetFlag(f *Flag) error {
+	if err := f.Validate(); err != nil {
+		return err
+	}
+
+	return s.update("SetFlag", func(tx *Tx) error {
+		f.UpdatedAt = time.Now().UTC()
+		buf, err := f.MarshalBinary()
+		if err != nil {
+			return err
+		}
+		tx.recordWrite("Flags", buf)
+		return tx.Bucket([]byte("Flags")).Put([]byte(f.Name), buf)
+	})
+}
+
+// Flag retrieves a flag by name. Returns nil if the flag does not exist.
+func (s *Store) Flag(name string) (*Flag, error) {
+	var f *Flag
+	if err := s.view("Flag", func(tx *Tx) error {
+		v := tx.Bucket([]byte("Flags")).Get([]byte(name))
+		if v == nil {
+			return nil
+		}
+		tx.recordRead("Flags", v)
+
+		f = &Flag{}
+		return f.UnmarshalBinary(v)
+	}); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// Flags retrieves a list of all flags ordered by name.
+func (s *Store) Flags() ([]*Flag, error) {
+	a := []*Flag{}
+	if err := s.view("Flags", func(tx *Tx) error {
+		return tx.Bucket([]byte("Flags")).ForEach(func(_, v []byte) error {
+			tx.recordRead("Flags", v)
+
+			var f Flag
+			if err := f.UnmarshalBinary(v); err != nil {
+				return err
+			}
+			a = append(a, &f)
+			return nil
+		})
+	}); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// DeleteFlag removes a flag by name. Returns ErrFlagNotFound if the flag
+// does not exist.
+func (s *Store) DeleteFlag(name string) error {
+	return s.update("DeleteFlag", func(tx *Tx) error {
+		bkt := tx.Bucket([]byte("Flags"))
+		if bkt.Get([]byte(name)) == nil {
+			return keyError("flag", name, ErrFlagNotFound)
+		}
+		tx.recordDelete("Flags")
+		return bkt.Delete([]byte(name))
+	})
+}
+
+// FlagEnabled returns true if the named flag is enabled for the user.
+// Flags that do not exist are disabled. Errors reading the flag are logged
+// and the flag is reported as disabled so callers can use the result
+// directly in request paths.
+func (s *Store) FlagEnabled(name string, userID int) bool {
+	f, err := s.Flag(name)
+	if err != nil {
+		s.logger().Warn("flag read failed", "flag", name, "err", err)
+		return false
+	} else if f == nil {
+		return false
+	}
+	return f.EnabledFor(userID)
+}
+
+// reassignFlagOverrides moves the overrides of oldID to newID in every
+// flag. An override that newID already has is kept. The overrides of oldID
+// are removed without being moved if newID is zero.
+func reassignFlagOverrides(tx *Tx, oldID, newID int) error {
+	bkt := tx.Bucket([]byte("Flags"))
+
+	// Collect flags first since the bucket cannot be modified while
+	// iterating.
+	var a []*Flag
+	if err := bkt.ForEach(func(_, v []byte) error {
+		tx.recordRead("Flags", v)
+
+		f := &Flag{}
+		if err := f.UnmarshalBinary(v); err != nil {
+			return err
+		} else if _, ok := f.Users[oldID]; ok {
+			a = append(a, f)
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	for _, f := range a {
+		on := f.Users[oldID]
+		delete(f.Users, oldID)
+		if _, ok := f.Users[newID]; newID != 0 && !ok {
+			f.Users[newID] = on
+		}
+
+		buf, err := f.MarshalBinary()
+		if err != nil {
+			return err
+		}
+		tx.recordWrite("Flags", buf)
+		if err := bkt.Put([]byte(f.Name), buf); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deleteFlagOverrides removes the overrides of a user from every flag.
+func deleteFlagOverrides(tx *Tx, id int) error {
+	return reassignFlagOverrides(tx, id, 0)
+}
+
+// Flag related errors.
+var (
+	ErrFlagNameRequired      = &Error{Code: EINVALID, Message: "flag name required"}
+	ErrInvalidFlagPercentage = &Error{Code: EINVALID, Message: "flag percentage must be between 0 and 100"}
+	ErrFlagNotFound          = &Error{Code: ENOTFOUND, Message: "flag not found"}
+)
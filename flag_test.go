@@ -0,0 +1,135 @@
+package main_test
+
+import (
+	"errors"
+	"testing"
+
+	main "github.com/benbjohnson/application-development-using-boltdb"
+)
+
+// Ensure flags can be created, read, listed, and deleted.
+func TestStore_SetFlag(t *testing.T) {
+	s := OpenStore()
+	defer s.Close()
+
+	if err := s.SetFlag(&main.Flag{Name: "search", Percentage: 50, Users: map[int]bool{1: true, 2: false}}); err != nil {
+		t.Fatal(err)
+	} else if err := s.SetFlag(&main.Flag{Name: "beta", Enabled: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	if f, err := s.Flag("search"); err != nil {
+		t.Fatal(err)
+	} else if f == nil || f.Percentage != 50 || len(f.Users) != 2 || !f.Users[1] || f.Users[2] || f.UpdatedAt.IsZero() {
+		t.Fatalf("unexpected flag: %#v", f)
+	} else if f, err := s.Flag("missing"); err != nil {
+		t.Fatal(err)
+	} else if f != nil {
+		t.Fatalf("unexpected flag: %#v", f)
+	}
+
+	if a, err := s.Flags(); err != nil {
+		t.Fatal(err)
+	} else if len(a) != 2 || a[0].Name != "beta" || a[1].Name != "search" {
+		t.Fatalf("unexpected flags: %#v", a)
+	}
+
+	if err := s.DeleteFlag("beta"); err != nil {
+		t.Fatal(err)
+	} else if err := s.DeleteFlag("beta"); !errors.Is(err, main.ErrFlagNotFound) {
+		t.Fatalf("unexpected error: %v", err)
+	} else if a, err := s.Flags(); err != nil {
+		t.Fatal(err)
+	} else if len(a) != 1 {
+		t.Fatalf("unexpected flags: %#v", a)
+	}
+
+	if err := s.SetFlag(&main.Flag{}); err != main.ErrFlagNameRequired {
+		t.Fatalf("unexpected error: %v", err)
+	} else if err := s.SetFlag(&main.Flag{Name: "x", Percentage: 101}); err != main.ErrInvalidFlagPercentage {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+// Ensure flags are evaluated with overrides first and rollouts are stable.
+func TestStore_FlagEnabled(t *testing.T) {
+	s := OpenStore()
+	defer s.Close()
+
+	if s.FlagEnabled("search", 1) {
+		t.Fatal("expected missing flag to be disabled")
+	}
+
+	if err := s.SetFlag(&main.Flag{Name: "search", Enabled: true, Users: map[int]bool{2: false}}); err != nil {
+		t.Fatal(err)
+	} else if !s.FlagEnabled("search", 1) {
+		t.Fatal("expected flag to be enabled")
+	} else if s.FlagEnabled("search", 2) {
+		t.Fatal("expected override to disable flag")
+	}
+
+	// Roughly the percentage of users are enabled and raising the
+	// percentage keeps users that were already enabled.
+	enabled := func(pct int) map[int]bool {
+		if err := s.SetFlag(&main.Flag{Name: "rollout", Percentage: pct}); err != nil {
+			t.Fatal(err)
+		}
+		m := make(map[int]bool)
+		for id := 1; id <= 1000; id++ {
+			if s.FlagEnabled("rollout", id) {
+				m[id] = true
+			}
+		}
+		return m
+	}
+	low, high := enabled(20), enabled(60)
+	if n := len(low); n < 150 || n > 250 {
+		t.Fatalf("unexpected enabled count at 20%%: %d", n)
+	} else if n := len(high); n < 550 || n > 650 {
+		t.Fatalf("unexpected enabled count at 60%%: %d", n)
+	}
+	for id := range low {
+		if !high[id] {
+			t.Fatalf("user %d dropped when raising percentage", id)
+		}
+	}
+	if n := len(enabled(0)); n != 0 {
+		t.Fatalf("unexpected enabled count at 0%%: %d", n)
+	} else if n := len(enabled(100)); n != 1000 {
+		t.Fatalf("unexpected enabled count at 100%%: %d", n)
+	}
+}
+
+// Ensure user overrides follow users that are deleted, reassigned, merged,
+// or erased.
+func TestStore_SetFlag_UserOverrides(t *testing.T) {
+	s := OpenStore()
+	defer s.Close()
+
+	for _, name := range []string{"susy", "jimbo", "john", "jane"} {
+		if err := s.CreateUser(&main.User{Username: name}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.SetFlag(&main.Flag{Name: "search", Users: map[int]bool{1: true, 2: false, 3: true, 4: false}}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Delete 1, move 2 to 10, merge 3 into 10 which keeps its own
+	// override, and erase 4.
+	if err := s.DeleteUser(1); err != nil {
+		t.Fatal(err)
+	} else if err := s.ReassignUserID(2, 10); err != nil {
+		t.Fatal(err)
+	} else if err := s.MergeUsers(3, 10, main.MergeKeepDestination); err != nil {
+		t.Fatal(err)
+	} else if _, err := s.EraseUser(4); err != nil {
+		t.Fatal(err)
+	}
+
+	if f, err := s.Flag("search"); err != nil {
+		t.Fatal(err)
+	} else if len(f.Users) != 1 || f.Users[10] {
+		t.Fatalf("unexpected overrides: %v", f.Users)
+	}
+}
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"encoding/binary"
+
+	"github.com/benbjohnson/application-development-using-boltdb/keys"
+)
+
+// DefaultPageLimit is the number of results returned by paged queries that
+// do not set a limit.
+const DefaultPageLimit = 100
+
+// Page selects a range of results ordered by ID. The next page starts after
+// the last ID of the previous one.
+type Page struct {
+	// Only IDs greater than After are returned.
+	After int
+
+	// Maximum number of results. Defaults to DefaultPageLimit.
+	Limit int
+}
+
+// limit returns the page limit or the default, if unset.
+func (p Page) limit() int {
+	if p.Limit <= 0 {
+		return DefaultPageLimit
+	}
+	return p.Limit
+}
+
+// The follow graph is stored as edges in both directions so either side can
+// be listed with a single cursor. "Following" keys are the follower's ID
+// followed by the followed user's ID and "Followers" keys are the reverse.
+// "FollowCounts" holds the follower and following counts of each user.
+
+// Follow records that user a follows user b. Following a user that is
+// already followed is not an error. Returns ErrUserNotFound if either user
+// does not exist.
+func (s *Store) Follow(a, b int) error {
+	if a == b {
+		return ErrFollowSelf
+	}
+
+	return s.update("Follow", func(tx *Tx) error {
+		for _, id := range []int{a, b} {
+			if tx.Bucket([]byte("Users")).Get(keys.Int(id)) == nil {
+				return keyError("user", id, ErrUserNotFound)
+			}
+		}
+		return follow(tx, a, b)
+	})
+}
+
+// Unfollow removes the record that user a follows user b, if any.
+func (s *Store) Unfollow(a, b int) error {
+	return s.update("Unfollow", func(tx *Tx) error {
+		return unfollow(tx, a, b)
+	})
+}
+
+// Followers returns a page of the IDs of the users that follow a user.
+func (s *Store) Followers(id int, page Page) ([]int, error) {
+	return s.followEdges("Followers", id, page)
+}
+
+// Following returns a page of the IDs of the users that a user follows.
+func (s *Store) Following(id int, page Page) ([]int, error) {
+	return s.followEdges("Following", id, page)
+}
+
+// FollowCounts returns the number of users that follow a user and that the
+// user follows.
+func (s *Store) FollowCounts(id int) (followers, following int, err error) {
+	err = s.view("FollowCounts", func(tx *Tx) error {
+		followers, following = followCounts(tx, id)
+		return nil
+	})
+	return followers, following, err
+}
+
+// followEdges returns a page of the IDs at the far end of a user's edges in
+// the named bucket.
+func (s *Store) followEdges(name string, id int, page Page) ([]int, error) {
+	var a []int
+	if err := s.view(name, func(tx *Tx) error {
+		prefix := keys.Int(id)
+		c := tx.Bucket([]byte(name)).Cursor()
+		for k, _ := c.Seek(keys.Join(prefix, keys.Int(page.After+1))); k != nil && len(a) < page.limit(); k, _ = c.Next() {
+			r := keys.NewReader(k)
+			if r.ReadInt() != id {
+				break
+			}
+			other := r.ReadInt()
+			if err := r.Err(); err != nil {
+				return err
+			}
+			tx.recordRead(name, nil)
+			a = append(a, other)
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// follow adds the edges between a and b and updates their counts.
+func follow(tx *Tx, a, b int) error {
+	key := keys.Join(keys.Int(a), keys.Int(b))
+	if tx.Bucket([]byte("Following")).Get(key) != nil {
+		return nil
+	}
+
+	tx.recordWrite("Following", nil)
+	if err := tx.Bucket([]byte("Following")).Put(key, []byte{}); err != nil {
+		return err
+	}
+	tx.recordWrite("Followers", nil)
+	if err := tx.Bucket([]byte("Followers")).Put(keys.Join(keys.Int(b), keys.Int(a)), []byte{}); err != nil {
+		return err
+	}
+
+	if err := addFollowCounts(tx, a, 0, 1); err != nil {
+		return err
+	}
+	return addFollowCounts(tx, b, 1, 0)
+}
+
+// unfollow removes the edges between a and b and updates their counts.
+func unfollow(tx *Tx, a, b int) error {
+	key := keys.Join(keys.Int(a), keys.Int(b))
+	if tx.Bucket([]byte("Following")).Get(key) == nil {
+		return nil
+	}
+
+	tx.recordDelete("Following")
+	if err := tx.Bucket([]byte("Following")).Delete(key); err != nil {
+		return err
+	}
+	tx.recordDelete("Followers")
+	if err := tx.Bucket([]byte("Followers")).Delete(keys.Join(keys.Int(b), keys.Int(a))); err != nil {
+		return err
+	}
+
+	if err := addFollowCounts(tx, a, 0, -1); err != nil {
+		return err
+	}
+	return addFollowCounts(tx, b, -1, 0)
+}
+
+// followCounts returns the follower and following counts of a user.
+func followCounts(tx *Tx, id int) (followers, following int) {
+	v := tx.Bucket([]byte("FollowCounts")).Get(keys.Int(id))
+	if len(v) != 16 {
+		return 0, 0
+	}
+	tx.recordRead("FollowCounts", v)
+	return int(binary.BigEndian.Uint64(v[0:8])), int(binary.BigEndian.Uint64(v[8:16]))
+}
+
+// addFollowCounts adds to the follower and following counts of a user. The
+// counts are removed once both reach zero.
+func addFollowCounts(tx *Tx, id, followers, following int) error {
+	bkt := tx.Bucket([]byte("FollowCounts"))
+	n, m := followCounts(tx, id)
+	n, m = n+followers, m+following
+	if n <= 0 && m <= 0 {
+		tx.recordDelete("FollowCounts")
+		return bkt.Delete(keys.Int(id))
+	}
+
+	v := make([]byte, 16)
+	binary.BigEndian.PutUint64(v[0:8], uint64(n))
+	binary.BigEndian.PutUint64(v[8:16], uint64(m))
+	tx.recordWrite("FollowCounts", v)
+	return bkt.Put(keys.Int(id), v)
+}
+
+// edgeIDs returns the IDs at the far end of every edge of a user in the
+// named bucket.
+func edgeIDs(tx *Tx, name string, id int) ([]int, error) {
+	var a []int
+	if err := keys.Scan(tx.Bucket([]byte(name)).Cursor(), keys.Int(id), func(k, _ []byte) error {
+		r := keys.NewReader(k)
+		r.ReadInt()
+		a = append(a, r.ReadInt())
+		return r.Err()
+	}); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// deleteFollows removes every edge to and from a user.
+func deleteFollows(tx *Tx, id int) error {
+	followers, err := edgeIDs(tx, "Followers", id)
+	if err != nil {
+		return err
+	}
+	following, err := edgeIDs(tx, "Following", id)
+	if err != nil {
+		return err
+	}
+
+	for _, other := range followers {
+		if err := unfollow(tx, other, id); err != nil {
+			return err
+		}
+	}
+	for _, other := range following {
+		if err := unfollow(tx, id, other); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// reassignFollows moves every edge to and from a user to a new ID.
+func reassignFollows(tx *Tx, oldID, newID int) error {
+	followers, err := edgeIDs(tx, "Followers", oldID)
+	if err != nil {
+		return err
+	}
+	following, err := edgeIDs(tx, "Following", oldID)
+	if err != nil {
+		return err
+	} else if err := deleteFollows(tx, oldID); err != nil {
+		return err
+	}
+
+	for _, other := range followers {
+		if err := follow(tx, other, newID); err != nil {
+			return err
+		}
+	}
+	for _, other := range following {
+		if err := follow(tx, newID, other); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Follow related errors.
+var (
+	ErrFollowSelf = &Error{Code: EINVALID, Message: "users cannot follow themselves"}
+)
@@ -0,0 +1,131 @@
+package main_test
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	main "github.com/benbjohnson/application-development-using-boltdb"
+)
+
+// Ensure users can follow each other and list both sides of the graph.
+func TestStore_Follow(t *testing.T) {
+	s := OpenStore()
+	defer s.Close()
+
+	for _, username := range []string{"susy", "john", "jimbo", "bob"} {
+		if err := s.CreateUser(&main.User{Username: username}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, edge := range [][2]int{{1, 2}, {1, 3}, {1, 4}, {2, 1}, {3, 1}, {1, 2}} {
+		if err := s.Follow(edge[0], edge[1]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if a, err := s.Following(1, main.Page{}); err != nil {
+		t.Fatal(err)
+	} else if !reflect.DeepEqual(a, []int{2, 3, 4}) {
+		t.Fatalf("unexpected following: %v", a)
+	} else if a, err := s.Followers(1, main.Page{}); err != nil {
+		t.Fatal(err)
+	} else if !reflect.DeepEqual(a, []int{2, 3}) {
+		t.Fatalf("unexpected followers: %v", a)
+	} else if a, err := s.Followers(2, main.Page{}); err != nil {
+		t.Fatal(err)
+	} else if !reflect.DeepEqual(a, []int{1}) {
+		t.Fatalf("unexpected followers: %v", a)
+	}
+
+	// Pages start after the last ID of the previous page.
+	if a, err := s.Following(1, main.Page{Limit: 2}); err != nil {
+		t.Fatal(err)
+	} else if !reflect.DeepEqual(a, []int{2, 3}) {
+		t.Fatalf("unexpected page: %v", a)
+	} else if a, err := s.Following(1, main.Page{After: 3, Limit: 2}); err != nil {
+		t.Fatal(err)
+	} else if !reflect.DeepEqual(a, []int{4}) {
+		t.Fatalf("unexpected page: %v", a)
+	}
+
+	if followers, following, err := s.FollowCounts(1); err != nil {
+		t.Fatal(err)
+	} else if followers != 2 || following != 3 {
+		t.Fatalf("unexpected counts: %d, %d", followers, following)
+	}
+
+	// Unfollowing updates both sides and the counts.
+	if err := s.Unfollow(1, 3); err != nil {
+		t.Fatal(err)
+	} else if err := s.Unfollow(1, 3); err != nil {
+		t.Fatal(err)
+	} else if a, err := s.Followers(3, main.Page{}); err != nil {
+		t.Fatal(err)
+	} else if len(a) != 0 {
+		t.Fatalf("unexpected followers: %v", a)
+	} else if followers, following, err := s.FollowCounts(3); err != nil {
+		t.Fatal(err)
+	} else if followers != 0 || following != 1 {
+		t.Fatalf("unexpected counts: %d, %d", followers, following)
+	}
+}
+
+// Ensure following validates both users.
+func TestStore_Follow_Err(t *testing.T) {
+	s := OpenStore()
+	defer s.Close()
+
+	if err := s.CreateUser(&main.User{Username: "susy"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.Follow(1, 1); err != main.ErrFollowSelf {
+		t.Fatalf("unexpected error: %v", err)
+	} else if err := s.Follow(1, 2); !errors.Is(err, main.ErrUserNotFound) {
+		t.Fatalf("unexpected error: %v", err)
+	} else if err := s.Follow(2, 1); !errors.Is(err, main.ErrUserNotFound) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+// Ensure follows are removed with a user and move with a reassigned user.
+func TestStore_Follow_DeleteUser(t *testing.T) {
+	s := OpenStore()
+	defer s.Close()
+
+	for _, username := range []string{"susy", "john", "jimbo"} {
+		if err := s.CreateUser(&main.User{Username: username}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, edge := range [][2]int{{1, 2}, {2, 1}, {3, 1}} {
+		if err := s.Follow(edge[0], edge[1]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := s.ReassignUserID(1, 10); err != nil {
+		t.Fatal(err)
+	} else if a, err := s.Following(2, main.Page{}); err != nil {
+		t.Fatal(err)
+	} else if !reflect.DeepEqual(a, []int{10}) {
+		t.Fatalf("unexpected following: %v", a)
+	} else if followers, following, err := s.FollowCounts(10); err != nil {
+		t.Fatal(err)
+	} else if followers != 2 || following != 1 {
+		t.Fatalf("unexpected counts: %d, %d", followers, following)
+	}
+
+	if err := s.DeleteUser(10); err != nil {
+		t.Fatal(err)
+	} else if a, err := s.Followers(2, main.Page{}); err != nil {
+		t.Fatal(err)
+	} else if len(a) != 0 {
+		t.Fatalf("unexpected followers: %v", a)
+	} else if followers, following, err := s.FollowCounts(3); err != nil {
+		t.Fatal(err)
+	} else if followers != 0 || following != 0 {
+		t.Fatalf("unexpected counts: %d, %d", followers, following)
+	}
+}
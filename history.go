@@ -0,0 +1,201 @@
+package main
+
+import (
+	"errors"
+	"time"
+
+	"github.com/benbjohnson/application-development-using-boltdb/internal"
+	"github.com/benbjohnson/application-development-using-boltdb/keys"
+	"github.com/gogo/protobuf/proto"
+)
+
+// UserRevision represents the state of a user after a single change.
+type UserRevision struct {
+	Revision int
+
+	// User as of the revision. Nil if the user was deleted.
+	User *User
+
+	// Fields changed since the previous revision. Empty if the user was
+	// created or deleted.
+	Changes []FieldChange
+
+	CreatedAt time.Time
+}
+
+// MarshalBinary encodes a revision to binary format.
+func (r *UserRevision) MarshalBinary() ([]byte, error) {
+	pb := &internal.UserRevision{
+		Revision:  proto.Int64(int64(r.Revision)),
+		CreatedAt: proto.Int64(encodeTime(r.CreatedAt)),
+		Changes:   encodeChanges(r.Changes),
+	}
+	if r.User != nil {
+		buf, err := r.User.MarshalBinary()
+		if err != nil {
+			return nil, err
+		}
+		pb.User = buf
+	}
+	return proto.Marshal(pb)
+}
+
+// UnmarshalBinary decodes a revision from binary data.
+func (r *UserRevision) UnmarshalBinary(data []byte) error {
+	var pb internal.UserRevision
+	if err := proto.Unmarshal(data, &pb); err != nil {
+		return err
+	}
+
+	r.Revision = int(pb.GetRevision())
+	r.CreatedAt = decodeTime(pb.GetCreatedAt())
+	r.Changes = decodeChanges(pb.GetChanges())
+	r.User = nil
+	if pb.User != nil {
+		r.User = &User{}
+		if err := r.User.UnmarshalBinary(pb.User); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// UserHistory returns the retained revisions of a user, oldest first.
+// Revisions are kept after a user is deleted so it can be restored.
+func (s *Store) UserHistory(id int) ([]*UserRevision, error) {
+	a := []*UserRevision{}
+	if err := s.view("UserHistory", func(tx *Tx) error {
+		other, err := userRevisions(tx, id)
+		a = append(a, other...)
+		return err
+	}); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// userRevisions returns the retained revisions of a user, oldest first.
+func userRevisions(tx *Tx, id int) ([]*UserRevision, error) {
+	bkt := tx.Bucket([]byte("UserHistory")).Bucket(keys.Int(id))
+	if bkt == nil {
+		return nil, nil
+	}
+
+	var a []*UserRevision
+	if err := bkt.ForEach(func(_, v []byte) error {
+		tx.recordRead("UserHistory", v)
+
+		r := &UserRevision{}
+		if err := decodeRevision(v, r); err != nil {
+			return err
+		}
+		a = append(a, r)
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// RevertUser restores a user to the state of a retained revision. Reverting
+// to a deletion deletes the user and reverting a deleted user recreates it.
+// The revert is itself recorded as a new revision.
+func (s *Store) RevertUser(id, revision int) error {
+	return s.update("RevertUser", func(tx *Tx) error {
+		bkt := tx.Bucket([]byte("UserHistory")).Bucket(keys.Int(id))
+		if bkt == nil {
+			return keyError("revision", revision, ErrRevisionNotFound)
+		}
+		v := bkt.Get(keys.Int(revision))
+		if v == nil {
+			return keyError("revision", revision, ErrRevisionNotFound)
+		}
+		tx.recordRead("UserHistory", v)
+
+		var r UserRevision
+		if err := decodeRevision(v, &r); err != nil {
+			return err
+		} else if r.User == nil {
+			return deleteUser(tx, id)
+		}
+
+		// Determine whether the user is restored or updated.
+		typ, changes := EventUserCreated, []FieldChange(nil)
+		var prev User
+		if err := loadUser(tx, id, &prev); err == nil {
+			typ, changes = EventUserUpdated, diffUser(&prev, r.User)
+		} else if !errors.Is(err, ErrUserNotFound) {
+			return err
+		}
+
+		if err := saveUser(tx, r.User); err != nil {
+			return err
+		} else if err := recordUserEvent(tx, typ, r.User, changes); err != nil {
+			return err
+		}
+		return recordUserRevision(tx, id, r.User, changes)
+	})
+}
+
+// recordUserRevision adds a revision to the history of the user with the
+// given id and removes revisions beyond the store's UserHistoryLimit.
+// Pass a nil user to record a deletion. changes lists the fields changed by
+// an update. No-op if history is disabled.
+func recordUserRevision(tx *Tx, id int, u *User, changes []FieldChange) error {
+	limit := tx.store.UserHistoryLimit
+	if limit <= 0 {
+		return nil
+	}
+
+	bkt, err := tx.Bucket([]byte("UserHistory")).CreateBucketIfNotExists(keys.Int(id))
+	if err != nil {
+		return err
+	}
+	seq, err := bkt.NextSequence()
+	if err != nil {
+		return err
+	}
+
+	r := &UserRevision{Revision: int(seq), User: u, Changes: changes, CreatedAt: time.Now().UTC()}
+	buf, err := r.MarshalBinary()
+	if err != nil {
+		return err
+	} else if buf, err = tx.store.encodeValue(buf); err != nil {
+		return err
+	}
+
+	tx.recordWrite("UserHistory", buf)
+	if err := bkt.Put(keys.Int(r.Revision), buf); err != nil {
+		return err
+	}
+
+	// Remove the oldest revisions. Keys are collected first since the
+	// bucket cannot be modified while iterating.
+	var expired [][]byte
+	c := bkt.Cursor()
+	for k, _ := c.First(); k != nil && keys.ParseInt(k) <= r.Revision-limit; k, _ = c.Next() {
+		expired = append(expired, append([]byte{}, k...))
+	}
+	for _, k := range expired {
+		tx.recordDelete("UserHistory")
+		if err := bkt.Delete(k); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// decodeRevision decompresses v, if needed, and unmarshals it into r.
+func decodeRevision(v []byte, r *UserRevision) error {
+	buf, err := decompress(v)
+	if err != nil {
+		return err
+	}
+	return r.UnmarshalBinary(buf)
+}
+
+// History related errors.
+var (
+	ErrRevisionNotFound = &Error{Code: ENOTFOUND, Message: "revision not found"}
+)
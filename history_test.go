@@ -0,0 +1,119 @@
+package main_test
+
+import (
+	"errors"
+	"testing"
+
+	main "github.com/benbjohnson/application-development-using-boltdb"
+)
+
+// Ensure every change to a user is recorded as a revision up to the limit.
+func TestStore_UserHistory(t *testing.T) {
+	s := NewStore()
+	s.UserHistoryLimit = 3
+	if err := s.Open(); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	if err := s.CreateUser(&main.User{Username: "susy"}); err != nil {
+		t.Fatal(err)
+	} else if err := s.SetUsername(1, "jimbo"); err != nil {
+		t.Fatal(err)
+	} else if err := s.AddTag(1, "beta"); err != nil {
+		t.Fatal(err)
+	} else if err := s.DeleteUser(1); err != nil {
+		t.Fatal(err)
+	}
+
+	a, err := s.UserHistory(1)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(a) != 3 {
+		t.Fatalf("unexpected revision count: %d", len(a))
+	}
+
+	// The first revision was removed and the last records the deletion.
+	if a[0].Revision != 2 || a[0].User.Username != "jimbo" {
+		t.Fatalf("unexpected revision: %#v", a[0])
+	} else if a[1].Revision != 3 || len(a[1].User.Tags) != 1 {
+		t.Fatalf("unexpected revision: %#v", a[1])
+	} else if a[2].Revision != 4 || a[2].User != nil || a[2].CreatedAt.IsZero() {
+		t.Fatalf("unexpected revision: %#v", a[2])
+	}
+
+	// Users without history return an empty list.
+	if a, err := s.UserHistory(100); err != nil {
+		t.Fatal(err)
+	} else if len(a) != 0 {
+		t.Fatalf("unexpected revisions: %#v", a)
+	}
+}
+
+// Ensure history is not recorded unless a limit is set.
+func TestStore_UserHistory_Disabled(t *testing.T) {
+	s := OpenStore()
+	defer s.Close()
+
+	if err := s.CreateUser(&main.User{Username: "susy"}); err != nil {
+		t.Fatal(err)
+	} else if a, err := s.UserHistory(1); err != nil {
+		t.Fatal(err)
+	} else if len(a) != 0 {
+		t.Fatalf("unexpected revisions: %#v", a)
+	}
+}
+
+// Ensure a user can be reverted to an earlier revision, including after
+// it has been deleted.
+func TestStore_RevertUser(t *testing.T) {
+	s := NewStore()
+	s.UserHistoryLimit = 10
+	if err := s.Open(); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	if err := s.CreateUser(&main.User{Username: "susy"}); err != nil {
+		t.Fatal(err)
+	} else if err := s.SetUsername(1, "jimbo"); err != nil {
+		t.Fatal(err)
+	} else if err := s.DeleteUser(1); err != nil {
+		t.Fatal(err)
+	}
+
+	// Restore the user as it was first created.
+	if err := s.RevertUser(1, 1); err != nil {
+		t.Fatal(err)
+	} else if u, err := s.User(1); err != nil {
+		t.Fatal(err)
+	} else if u == nil || u.Username != "susy" {
+		t.Fatalf("unexpected user: %#v", u)
+	} else if u, err := s.UserByName("susy"); err != nil {
+		t.Fatal(err)
+	} else if u == nil {
+		t.Fatal("expected user in username index")
+	}
+
+	// Reverting to the deletion removes the user again.
+	if err := s.RevertUser(1, 3); err != nil {
+		t.Fatal(err)
+	} else if u, err := s.User(1); err != nil {
+		t.Fatal(err)
+	} else if u != nil {
+		t.Fatalf("unexpected user: %#v", u)
+	}
+
+	// Each revert is recorded.
+	if a, err := s.UserHistory(1); err != nil {
+		t.Fatal(err)
+	} else if len(a) != 5 {
+		t.Fatalf("unexpected revision count: %d", len(a))
+	}
+
+	if err := s.RevertUser(1, 100); !errors.Is(err, main.ErrRevisionNotFound) {
+		t.Fatalf("unexpected error: %v", err)
+	} else if err := s.RevertUser(2, 1); !errors.Is(err, main.ErrRevisionNotFound) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
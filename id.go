@@ -0,0 +1,121 @@
+package main
+
+import (
+	"sync"
+	"time"
+
+	"github.com/benbjohnson/application-development-using-boltdb/keys"
+	"github.com/boltdb/bolt"
+)
+
+// IDGenerator generates IDs for new records.
+type IDGenerator interface {
+	// NextID returns a new unique ID for a record stored in bkt.
+	NextID(bkt *bolt.Bucket) (int, error)
+}
+
+// SequenceIDGenerator generates IDs from the bucket's autoincrementing
+// sequence. IDs are only unique within a single database.
+type SequenceIDGenerator struct{}
+
+// NextID returns the next sequence value of bkt.
+func (SequenceIDGenerator) NextID(bkt *bolt.Bucket) (int, error) {
+	seq, err := bkt.NextSequence()
+	return int(seq), err
+}
+
+// Snowflake ID layout.
+const (
+	snowflakeNodeBits     = 10
+	snowflakeSequenceBits = 12
+
+	// MaxSnowflakeNode is the largest node ID that can be used.
+	MaxSnowflakeNode = 1<<snowflakeNodeBits - 1
+
+	maxSnowflakeSequence = 1<<snowflakeSequenceBits - 1
+)
+
+// SnowflakeEpoch is the start time of snowflake timestamps.
+var SnowflakeEpoch = time.Date(2016, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// SnowflakeIDGenerator generates time-ordered IDs that are unique across
+// nodes as long as each node uses a different Node value.
+//
+// IDs are composed of a millisecond timestamp, the node ID, and a per-node
+// sequence so up to 4096 IDs can be generated per millisecond per node.
+type SnowflakeIDGenerator struct {
+	mu   sync.Mutex
+	last int64 // last timestamp, in ms since epoch
+	seq  int64
+
+	// Identifies this node. Must be between 0 and MaxSnowflakeNode.
+	Node int
+
+	// Returns the current time. Defaults to time.Now.
+	Now func() time.Time
+}
+
+// NextID returns the next snowflake ID. The bucket is not used.
+func (g *SnowflakeIDGenerator) NextID(bkt *bolt.Bucket) (int, error) {
+	if g.Node < 0 || g.Node > MaxSnowflakeNode {
+		return 0, ErrInvalidSnowflakeNode
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	ts := g.timestamp()
+	if ts < g.last {
+		// Never move backwards if the clock does.
+		ts = g.last
+	}
+
+	if ts == g.last {
+		// Wait for the next millisecond once the sequence is exhausted.
+		if g.seq++; g.seq > maxSnowflakeSequence {
+			for ts <= g.last {
+				time.Sleep(100 * time.Microsecond)
+				ts = g.timestamp()
+			}
+			g.seq = 0
+		}
+	} else {
+		g.seq = 0
+	}
+	g.last = ts
+
+	id := ts<<(snowflakeNodeBits+snowflakeSequenceBits) | int64(g.Node)<<snowflakeSequenceBits | g.seq
+	return int(id), nil
+}
+
+// timestamp returns the number of milliseconds since the snowflake epoch.
+func (g *SnowflakeIDGenerator) timestamp() int64 {
+	now := time.Now
+	if g.Now != nil {
+		now = g.Now
+	}
+	return now().Sub(SnowflakeEpoch).Milliseconds()
+}
+
+// nextID generates a new ID for a record in bkt using the store's generator.
+// Returns ErrIDExists if the generated ID is already in use.
+func (s *Store) nextID(bkt *bolt.Bucket) (int, error) {
+	var g IDGenerator = SequenceIDGenerator{}
+	if s.IDGenerator != nil {
+		g = s.IDGenerator
+	}
+
+	id, err := g.NextID(bkt)
+	if err != nil {
+		return 0, err
+	} else if bkt.Get(keys.Int(id)) != nil {
+		return 0, ErrIDExists
+	}
+	return id, nil
+}
+
+// ID related errors.
+var (
+	ErrIDExists             = &Error{Code: ECONFLICT, Message: "id already exists"}
+	ErrInvalidSnowflakeNode = &Error{Code: EINVALID, Message: "invalid snowflake node"}
+)
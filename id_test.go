@@ -0,0 +1,71 @@
+package main_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	main "github.com/benbjohnson/application-development-using-boltdb"
+)
+
+// Ensure the store uses a configured ID generator.
+func TestStore_IDGenerator(t *testing.T) {
+	s := NewStore()
+	s.IDGenerator = &main.SnowflakeIDGenerator{Node: 7}
+	if err := s.Open(); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	// Create users and verify IDs are increasing and not sequential.
+	u0, u1 := &main.User{Username: "susy"}, &main.User{Username: "john"}
+	if err := s.CreateUser(u0); err != nil {
+		t.Fatal(err)
+	} else if err := s.CreateUser(u1); err != nil {
+		t.Fatal(err)
+	} else if u0.ID <= 2 || u1.ID <= u0.ID {
+		t.Fatalf("unexpected ids: %d, %d", u0.ID, u1.ID)
+	}
+
+	// Verify user can be retrieved by generated ID.
+	if u, err := s.User(u1.ID); err != nil {
+		t.Fatal(err)
+	} else if u == nil || u.Username != "john" {
+		t.Fatalf("unexpected user: %#v", u)
+	}
+}
+
+// Ensure snowflake IDs embed the node and sequence.
+func TestSnowflakeIDGenerator_NextID(t *testing.T) {
+	now := main.SnowflakeEpoch.Add(time.Second)
+	g := &main.SnowflakeIDGenerator{Node: 3, Now: func() time.Time { return now }}
+
+	if id, err := g.NextID(nil); err != nil {
+		t.Fatal(err)
+	} else if exp := 1000<<22 | 3<<12; id != exp {
+		t.Fatalf("unexpected id: %d, expected %d", id, exp)
+	}
+
+	// The sequence increments within the same millisecond.
+	if id, err := g.NextID(nil); err != nil {
+		t.Fatal(err)
+	} else if exp := 1000<<22 | 3<<12 | 1; id != exp {
+		t.Fatalf("unexpected id: %d, expected %d", id, exp)
+	}
+
+	// Different nodes never collide.
+	other := &main.SnowflakeIDGenerator{Node: 4, Now: func() time.Time { return now }}
+	if id, err := other.NextID(nil); err != nil {
+		t.Fatal(err)
+	} else if exp := 1000<<22 | 4<<12; id != exp {
+		t.Fatalf("unexpected id: %d, expected %d", id, exp)
+	}
+}
+
+// Ensure an out of range node is rejected.
+func TestSnowflakeIDGenerator_ErrInvalidSnowflakeNode(t *testing.T) {
+	g := &main.SnowflakeIDGenerator{Node: main.MaxSnowflakeNode + 1}
+	if _, err := g.NextID(nil); !errors.Is(err, main.ErrInvalidSnowflakeNode) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
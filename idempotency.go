@@ -0,0 +1,96 @@
+package main
+
+import (
+	"time"
+
+	"github.com/benbjohnson/application-development-using-boltdb/internal"
+	"github.com/gogo/protobuf/proto"
+)
+
+// DefaultIdempotencyTTL is the default duration that idempotency keys are kept.
+const DefaultIdempotencyTTL = 24 * time.Hour
+
+// idempotencyRecord stores the result of a request made with an idempotency key.
+type idempotencyRecord struct {
+	UserID    int
+	ExpiresAt time.Time
+}
+
+// MarshalBinary encodes a record to binary format.
+func (r *idempotencyRecord) MarshalBinary() ([]byte, error) {
+	return proto.Marshal(&internal.IdempotencyRecord{
+		UserID:    proto.Int64(int64(r.UserID)),
+		ExpiresAt: proto.Int64(encodeTime(r.ExpiresAt)),
+	})
+}
+
+// UnmarshalBinary decodes a record from binary data.
+func (r *idempotencyRecord) UnmarshalBinary(data []byte) error {
+	var pb internal.IdempotencyRecord
+	if err := proto.Unmarshal(data, &pb); err != nil {
+		return err
+	}
+
+	r.UserID = int(pb.GetUserID())
+	r.ExpiresAt = decodeTime(pb.GetExpiresAt())
+
+	return nil
+}
+
+// CreateUserIdempotent creates a new user unless key has already been used.
+//
+// If key was used by a previous call within the store's IdempotencyTTL then
+// no user is created and u is set to the user created by the earlier call.
+// This allows clients to safely retry requests after network failures.
+func (s *Store) CreateUserIdempotent(key string, u *User) error {
+	if key == "" {
+		return ErrIdempotencyKeyRequired
+	}
+
+	return s.update("CreateUserIdempotent", func(tx *Tx) error {
+		bkt := tx.Bucket([]byte("Idempotency"))
+		now := time.Now()
+
+		// If the key has been used and has not expired then return the
+		// previously created user instead of creating a new one.
+		if v := bkt.Get([]byte(key)); v != nil {
+			tx.recordRead("Idempotency", v)
+
+			var r idempotencyRecord
+			if err := r.UnmarshalBinary(v); err != nil {
+				return err
+			} else if now.Before(r.ExpiresAt) {
+				return loadUser(tx, r.UserID, u)
+			}
+		}
+
+		// Create the user.
+		if err := createUser(tx, u); err != nil {
+			return err
+		}
+
+		// Record the key so retries return the same user. The key is
+		// removed by the reaper once it expires.
+		r := &idempotencyRecord{UserID: u.ID, ExpiresAt: now.Add(s.idempotencyTTL())}
+		if buf, err := r.MarshalBinary(); err != nil {
+			return err
+		} else if err := putWithTTL(tx, "Idempotency", []byte(key), buf, r.ExpiresAt); err != nil {
+			return err
+		}
+
+		return nil
+	})
+}
+
+// idempotencyTTL returns the configured TTL or the default, if unset.
+func (s *Store) idempotencyTTL() time.Duration {
+	if s.IdempotencyTTL == 0 {
+		return DefaultIdempotencyTTL
+	}
+	return s.IdempotencyTTL
+}
+
+// Idempotency related errors.
+var (
+	ErrIdempotencyKeyRequired = &Error{Code: EINVALID, Message: "idempotency key required"}
+)
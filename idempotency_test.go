@@ -0,0 +1,75 @@
+package main_test
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	main "github.com/benbjohnson/application-development-using-boltdb"
+)
+
+// Ensure retrying a create with the same idempotency key returns the original user.
+func TestStore_CreateUserIdempotent(t *testing.T) {
+	s := OpenStore()
+	defer s.Close()
+
+	// Create a user with a key.
+	u := &main.User{Username: "susy"}
+	if err := s.CreateUserIdempotent("req-1", u); err != nil {
+		t.Fatal(err)
+	} else if u.ID != 1 {
+		t.Fatalf("unexpected ID: %d", u.ID)
+	}
+
+	// Retry with the same key.
+	other := &main.User{Username: "susy"}
+	if err := s.CreateUserIdempotent("req-1", other); err != nil {
+		t.Fatal(err)
+	} else if !reflect.DeepEqual(other, u) {
+		t.Fatalf("unexpected user: %#v", other)
+	}
+
+	// Verify only one user exists.
+	if a, err := s.Users(); err != nil {
+		t.Fatal(err)
+	} else if len(a) != 1 {
+		t.Fatalf("unexpected user count: %d", len(a))
+	}
+
+	// A different key creates a new user.
+	if err := s.CreateUserIdempotent("req-2", &main.User{Username: "john"}); err != nil {
+		t.Fatal(err)
+	} else if a, _ := s.Users(); len(a) != 2 {
+		t.Fatalf("unexpected user count: %d", len(a))
+	}
+}
+
+// Ensure an expired idempotency key creates a new user.
+func TestStore_CreateUserIdempotent_Expired(t *testing.T) {
+	s := OpenStore()
+	defer s.Close()
+	s.IdempotencyTTL = time.Nanosecond
+
+	if err := s.CreateUserIdempotent("req-1", &main.User{Username: "susy"}); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(time.Millisecond)
+
+	u := &main.User{Username: "jimbo"}
+	if err := s.CreateUserIdempotent("req-1", u); err != nil {
+		t.Fatal(err)
+	} else if u.ID != 2 {
+		t.Fatalf("unexpected ID: %d", u.ID)
+	}
+}
+
+// Ensure an empty idempotency key is rejected.
+func TestStore_CreateUserIdempotent_ErrIdempotencyKeyRequired(t *testing.T) {
+	s := OpenStore()
+	defer s.Close()
+
+	if err := s.CreateUserIdempotent("", &main.User{}); !errors.Is(err, main.ErrIdempotencyKeyRequired) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
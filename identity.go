@@ -0,0 +1,190 @@
+package main
+
+import (
+	"bytes"
+	"time"
+
+	"github.com/benbjohnson/application-development-using-boltdb/internal"
+	"github.com/benbjohnson/application-development-using-boltdb/keys"
+	"github.com/gogo/protobuf/proto"
+)
+
+// Identity links an account at an external provider, such as "google" or
+// "github", to a local user. Subject is the provider's ID for the account.
+type Identity struct {
+	UserID    int
+	Provider  string
+	Subject   string
+	CreatedAt time.Time
+}
+
+// MarshalBinary encodes an identity to binary format.
+func (i *Identity) MarshalBinary() ([]byte, error) {
+	return proto.Marshal(&internal.Identity{
+		UserID:    proto.Int64(int64(i.UserID)),
+		Provider:  proto.String(i.Provider),
+		Subject:   proto.String(i.Subject),
+		CreatedAt: proto.Int64(encodeTime(i.CreatedAt)),
+	})
+}
+
+// UnmarshalBinary decodes an identity from binary data.
+func (i *Identity) UnmarshalBinary(data []byte) error {
+	var pb internal.Identity
+	if err := proto.Unmarshal(data, &pb); err != nil {
+		return err
+	}
+
+	i.UserID = int(pb.GetUserID())
+	i.Provider = pb.GetProvider()
+	i.Subject = pb.GetSubject()
+	i.CreatedAt = decodeTime(pb.GetCreatedAt())
+
+	return nil
+}
+
+// The "Identities" bucket is keyed by user ID, provider, and subject so the
+// identities of a user can be scanned by prefix. The unique
+// "IdentitiesBySubject" index maps a provider and subject back to the key so
+// an external account can only be linked to one user.
+
+// LinkIdentity links the provider's subject to a user. Linking an identity
+// the user already has is a no-op. Returns ErrIdentityLinked if the identity
+// is linked to another user.
+func (s *Store) LinkIdentity(userID int, provider, subject string) error {
+	if provider == "" || subject == "" {
+		return ErrIdentityRequired
+	}
+
+	return s.update("LinkIdentity", func(tx *Tx) error {
+		var u User
+		if err := loadUser(tx, userID, &u); err != nil {
+			return err
+		}
+
+		// Check the index first to report which constraint failed.
+		key := identityKey(userID, provider, subject)
+		if other := tx.Bucket([]byte("IdentitiesBySubject")).Get(identityIndexKey(provider, subject)); bytes.Equal(other, key) {
+			return nil
+		} else if other != nil {
+			return keyError("identity", provider+":"+subject, ErrIdentityLinked)
+		}
+
+		i := &Identity{UserID: userID, Provider: provider, Subject: subject, CreatedAt: time.Now().UTC()}
+		buf, err := i.MarshalBinary()
+		if err != nil {
+			return err
+		}
+		return putValue(tx, "Identities", key, buf)
+	})
+}
+
+// UnlinkIdentity removes the link between the provider's subject and a user.
+// Returns ErrIdentityNotFound if the identity is not linked to the user.
+func (s *Store) UnlinkIdentity(userID int, provider, subject string) error {
+	return s.update("UnlinkIdentity", func(tx *Tx) error {
+		key := identityKey(userID, provider, subject)
+		if tx.Bucket([]byte("Identities")).Get(key) == nil {
+			return keyError("identity", provider+":"+subject, ErrIdentityNotFound)
+		}
+		return deleteValue(tx, "Identities", key)
+	})
+}
+
+// UnlinkIdentities removes every identity linked to a user and returns the
+// number removed.
+func (s *Store) UnlinkIdentities(userID int) (int, error) {
+	var n int
+	if err := s.update("UnlinkIdentities", func(tx *Tx) error {
+		var err error
+		n, err = deleteIdentities(tx, userID)
+		return err
+	}); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+// UserByIdentity retrieves the user linked to the provider's subject.
+// Returns nil if the identity is not linked to a user.
+func (s *Store) UserByIdentity(provider, subject string) (*User, error) {
+	var u *User
+	if err := s.view("UserByIdentity", func(tx *Tx) error {
+		v := tx.Bucket([]byte("IdentitiesBySubject")).Get(identityIndexKey(provider, subject))
+		if v == nil {
+			return nil
+		}
+		tx.recordRead("IdentitiesBySubject", v)
+
+		u = &User{}
+		return loadUser(tx, keys.ParseInt(v), u)
+	}); err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
+// Identities retrieves the identities linked to a user, ordered by provider
+// and subject.
+func (s *Store) Identities(userID int) ([]*Identity, error) {
+	var a []*Identity
+	if err := s.view("Identities", func(tx *Tx) error {
+		var err error
+		a, err = userIdentities(tx, userID)
+		return err
+	}); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// userIdentities returns the identities linked to a user.
+func userIdentities(tx *Tx, userID int) ([]*Identity, error) {
+	var a []*Identity
+	c := tx.Bucket([]byte("Identities")).Cursor()
+	if err := keys.Scan(c, keys.Int(userID), func(_, v []byte) error {
+		tx.recordRead("Identities", v)
+
+		var i Identity
+		if err := i.UnmarshalBinary(v); err != nil {
+			return err
+		}
+		a = append(a, &i)
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// deleteIdentities removes all identities linked to a user and returns their
+// count.
+func deleteIdentities(tx *Tx, userID int) (int, error) {
+	return deletePrefix(tx, "Identities", keys.Int(userID))
+}
+
+// identityKey returns the key of an identity in the Identities bucket.
+func identityKey(userID int, provider, subject string) []byte {
+	return keys.Join(keys.Int(userID), keys.String(provider), keys.String(subject))
+}
+
+// identityIndexKey returns the key of an identity in IdentitiesBySubject.
+func identityIndexKey(provider, subject string) []byte {
+	return keys.Join(keys.String(provider), keys.String(subject))
+}
+
+// identityKeys indexes an identity by its provider and subject.
+func identityKeys(_, v []byte) ([][]byte, error) {
+	var i Identity
+	if err := i.UnmarshalBinary(v); err != nil {
+		return nil, err
+	}
+	return [][]byte{identityIndexKey(i.Provider, i.Subject)}, nil
+}
+
+// Identity related errors.
+var (
+	ErrIdentityRequired = &Error{Code: EINVALID, Message: "identity provider and subject required"}
+	ErrIdentityNotFound = &Error{Code: ENOTFOUND, Message: "identity not found"}
+	ErrIdentityLinked   = &Error{Code: ECONFLICT, Message: "identity linked to another user"}
+)
@@ -0,0 +1,149 @@
+package main_test
+
+import (
+	"errors"
+	"testing"
+
+	main "github.com/benbjohnson/application-development-using-boltdb"
+)
+
+// Ensure external identities can be linked to users and looked up.
+func TestStore_LinkIdentity(t *testing.T) {
+	s := OpenStore()
+	defer s.Close()
+
+	if err := s.CreateUser(&main.User{Username: "susy"}); err != nil {
+		t.Fatal(err)
+	} else if err := s.CreateUser(&main.User{Username: "jimbo"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.LinkIdentity(1, "google", "1234"); err != nil {
+		t.Fatal(err)
+	} else if err := s.LinkIdentity(1, "github", "susy"); err != nil {
+		t.Fatal(err)
+	} else if err := s.LinkIdentity(1, "github", "susy"); err != nil {
+		t.Fatal(err)
+	} else if err := s.LinkIdentity(2, "google", "5678"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Look up users by identity.
+	if u, err := s.UserByIdentity("google", "1234"); err != nil {
+		t.Fatal(err)
+	} else if u == nil || u.Username != "susy" {
+		t.Fatalf("unexpected user: %#v", u)
+	} else if u, err := s.UserByIdentity("google", "5678"); err != nil {
+		t.Fatal(err)
+	} else if u == nil || u.Username != "jimbo" {
+		t.Fatalf("unexpected user: %#v", u)
+	} else if u, err := s.UserByIdentity("github", "1234"); err != nil {
+		t.Fatal(err)
+	} else if u != nil {
+		t.Fatalf("unexpected user: %#v", u)
+	}
+
+	// List a user's identities.
+	if a, err := s.Identities(1); err != nil {
+		t.Fatal(err)
+	} else if len(a) != 2 {
+		t.Fatalf("unexpected identities: %d", len(a))
+	} else if a[0].Provider != "github" || a[0].Subject != "susy" || a[0].UserID != 1 {
+		t.Fatalf("unexpected identity(0): %#v", a[0])
+	} else if a[1].Provider != "google" || a[1].Subject != "1234" || a[1].CreatedAt.IsZero() {
+		t.Fatalf("unexpected identity(1): %#v", a[1])
+	}
+
+	// An identity cannot be linked to two users.
+	if err := s.LinkIdentity(2, "google", "1234"); !errors.Is(err, main.ErrIdentityLinked) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// Unlinking frees the identity.
+	if err := s.UnlinkIdentity(1, "google", "1234"); err != nil {
+		t.Fatal(err)
+	} else if err := s.UnlinkIdentity(1, "google", "1234"); !errors.Is(err, main.ErrIdentityNotFound) {
+		t.Fatalf("unexpected error: %v", err)
+	} else if err := s.LinkIdentity(2, "google", "1234"); err != nil {
+		t.Fatal(err)
+	} else if u, err := s.UserByIdentity("google", "1234"); err != nil {
+		t.Fatal(err)
+	} else if u == nil || u.ID != 2 {
+		t.Fatalf("unexpected user: %#v", u)
+	}
+}
+
+// Ensure deleting a user removes their identities.
+func TestStore_LinkIdentity_DeleteUser(t *testing.T) {
+	s := OpenStore()
+	defer s.Close()
+
+	if err := s.CreateUser(&main.User{Username: "susy"}); err != nil {
+		t.Fatal(err)
+	} else if err := s.LinkIdentity(1, "google", "1234"); err != nil {
+		t.Fatal(err)
+	} else if err := s.DeleteUser(1); err != nil {
+		t.Fatal(err)
+	} else if u, err := s.UserByIdentity("google", "1234"); err != nil {
+		t.Fatal(err)
+	} else if u != nil {
+		t.Fatalf("unexpected user: %#v", u)
+	} else if a, err := s.Identities(1); err != nil || len(a) != 0 {
+		t.Fatalf("unexpected identities: %v, %v", a, err)
+	}
+}
+
+// Ensure all identities of a user can be unlinked at once.
+func TestStore_UnlinkIdentities(t *testing.T) {
+	s := OpenStore()
+	defer s.Close()
+
+	if err := s.CreateUser(&main.User{Username: "susy"}); err != nil {
+		t.Fatal(err)
+	} else if err := s.CreateUser(&main.User{Username: "jimbo"}); err != nil {
+		t.Fatal(err)
+	}
+	for _, subject := range []string{"1", "2", "3"} {
+		if err := s.LinkIdentity(1, "google", subject); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.LinkIdentity(2, "google", "4"); err != nil {
+		t.Fatal(err)
+	}
+
+	if n, err := s.UnlinkIdentities(1); err != nil {
+		t.Fatal(err)
+	} else if n != 3 {
+		t.Fatalf("unexpected count: %d", n)
+	} else if a, err := s.Identities(1); err != nil || len(a) != 0 {
+		t.Fatalf("unexpected identities: %v, %v", a, err)
+	} else if u, err := s.UserByIdentity("google", "2"); err != nil {
+		t.Fatal(err)
+	} else if u != nil {
+		t.Fatalf("unexpected user: %#v", u)
+	}
+
+	// Identities of other users are kept.
+	if u, err := s.UserByIdentity("google", "4"); err != nil {
+		t.Fatal(err)
+	} else if u == nil || u.ID != 2 {
+		t.Fatalf("unexpected user: %#v", u)
+	} else if n, err := s.UnlinkIdentities(1); err != nil {
+		t.Fatal(err)
+	} else if n != 0 {
+		t.Fatalf("unexpected count: %d", n)
+	}
+}
+
+// Ensure linking validates its arguments.
+func TestStore_LinkIdentity_Err(t *testing.T) {
+	s := OpenStore()
+	defer s.Close()
+
+	if err := s.LinkIdentity(1, "", "1234"); !errors.Is(err, main.ErrIdentityRequired) {
+		t.Fatalf("unexpected error: %v", err)
+	} else if err := s.LinkIdentity(1, "google", "1234"); !errors.Is(err, main.ErrUserNotFound) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,481 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/benbjohnson/application-development-using-boltdb/internal"
+	"github.com/gogo/protobuf/proto"
+)
+
+// DefaultImportProgressInterval is the default number of rows between
+// progress reports of an import.
+const DefaultImportProgressInterval = 1000
+
+// Formats of an import file.
+const (
+	// CSV with a header row, as read by ImportCSV.
+	ImportFormatCSV = "csv"
+
+	// A stream of JSON objects, such as one per line, with "username",
+	// "tags", and "created_at" fields.
+	ImportFormatJSON = "json"
+)
+
+// ImportJob records the progress of an import so it can resume after a
+// crash. Rows are numbered from 1 and include the header row of a CSV file.
+type ImportJob struct {
+	Name   string
+	Format string
+
+	// Byte offset and number of the last row read.
+	Offset int64
+	Row    int
+
+	// Number of users created and rows that failed, and the error of the
+	// last failed row.
+	Created   int
+	Failed    int
+	LastError string
+
+	StartedAt   time.Time
+	UpdatedAt   time.Time
+	CompletedAt time.Time // zero until every row is read
+}
+
+// MarshalBinary encodes an import job to binary format.
+func (j *ImportJob) MarshalBinary() ([]byte, error) {
+	return proto.Marshal(&internal.ImportJob{
+		Name:        proto.String(j.Name),
+		Format:      proto.String(j.Format),
+		Offset:      proto.Int64(j.Offset),
+		Row:         proto.Int64(int64(j.Row)),
+		Created:     proto.Int64(int64(j.Created)),
+		Failed:      proto.Int64(int64(j.Failed)),
+		LastError:   proto.String(j.LastError),
+		StartedAt:   proto.Int64(encodeTime(j.StartedAt)),
+		UpdatedAt:   proto.Int64(encodeTime(j.UpdatedAt)),
+		CompletedAt: proto.Int64(encodeTime(j.CompletedAt)),
+	})
+}
+
+// UnmarshalBinary decodes an import job from binary data.
+func (j *ImportJob) UnmarshalBinary(data []byte) error {
+	var pb internal.ImportJob
+	if err := proto.Unmarshal(data, &pb); err != nil {
+		return err
+	}
+
+	j.Name = pb.GetName()
+	j.Format = pb.GetFormat()
+	j.Offset = pb.GetOffset()
+	j.Row = int(pb.GetRow())
+	j.Created = int(pb.GetCreated())
+	j.Failed = int(pb.GetFailed())
+	j.LastError = pb.GetLastError()
+	j.StartedAt = decodeTime(pb.GetStartedAt())
+	j.UpdatedAt = decodeTime(pb.GetUpdatedAt())
+	j.CompletedAt = decodeTime(pb.GetCompletedAt())
+
+	return nil
+}
+
+// ImportJobOptions configures Import.
+type ImportJobOptions struct {
+	// Format of the file. Either ImportFormatCSV or ImportFormatJSON.
+	Format string
+
+	// Maps CSV column names to user fields, as with ImportCSV. Defaults to
+	// the columns named after the fields.
+	Mapping map[string]string
+
+	// Called every ProgressInterval rows and once the import completes.
+	Progress func(ImportProgress)
+
+	// Rows between progress reports.
+	// Defaults to DefaultImportProgressInterval.
+	ProgressInterval int
+}
+
+// ImportProgress reports the progress of an import.
+type ImportProgress struct {
+	Job ImportJob
+
+	// Rate at which rows were read since the import started or resumed.
+	RowsPerSec float64
+
+	// Rows that failed since the previous report.
+	Errors []*RowError
+}
+
+// Import creates a user for each row of r and records its progress in the
+// "ImportJobs" bucket under name. If a job with the name exists, the import
+// resumes after the last row it recorded; r must be the same file. A
+// completed job is returned without reading r.
+//
+// Each user is saved in the same transaction as the job's progress so no
+// row is imported twice. As with ImportCSV, transactions are committed with
+// fsync deferred until the end and rows that fail are counted and do not
+// stop the import. Errors other than invalid or conflicting users stop the
+// import so it can be resumed.
+func (s *Store) Import(name string, r io.ReadSeeker, opts ImportJobOptions) (*ImportJob, error) {
+	if name == "" {
+		return nil, ErrImportNameRequired
+	} else if opts.Format != ImportFormatCSV && opts.Format != ImportFormatJSON {
+		return nil, ErrImportFormatInvalid
+	}
+	for _, f := range opts.Mapping {
+		if f != CSVFieldUsername && f != CSVFieldTags && f != CSVFieldCreatedAt {
+			return nil, ErrInvalidCSVField
+		}
+	}
+
+	job, err := s.ImportJob(name)
+	if err != nil {
+		return nil, err
+	} else if job == nil {
+		job = &ImportJob{Name: name, Format: opts.Format, StartedAt: time.Now().UTC()}
+	} else if job.Format != opts.Format {
+		return nil, keyError("import", name, ErrImportFormatMismatch)
+	} else if !job.CompletedAt.IsZero() {
+		return job, nil
+	}
+
+	var rd importReader
+	if opts.Format == ImportFormatCSV {
+		rd, err = newCSVImportReader(r, job, opts.Mapping)
+	} else {
+		rd, err = newJSONImportReader(r, job)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	interval := opts.ProgressInterval
+	if interval <= 0 {
+		interval = DefaultImportProgressInterval
+	}
+	start, rows := time.Now(), 0
+	var errs []*RowError
+	report := func() {
+		if opts.Progress != nil {
+			opts.Progress(ImportProgress{Job: *job, RowsPerSec: float64(rows) / time.Since(start).Seconds(), Errors: errs})
+		}
+		errs = nil
+	}
+
+	if err := s.BulkLoad(func() error {
+		for {
+			u, err := rd.next()
+			if err == io.EOF {
+				break
+			}
+			next := *job
+			next.Row++
+			next.Offset = rd.offset()
+			next.UpdatedAt = time.Now().UTC()
+
+			if err == nil {
+				next.Created++
+				err = s.update("Import", func(tx *Tx) error {
+					if err := createUser(tx, u); err != nil {
+						return err
+					}
+					return saveImportJob(tx, &next)
+				})
+			}
+			if code := ErrorCode(err); err != nil && code != EINVALID && code != ECONFLICT {
+				return err
+			} else if err != nil {
+				// The failure is recorded with the next saved row.
+				next.Created, next.Failed, next.LastError = job.Created, job.Failed+1, err.Error()
+				errs = append(errs, &RowError{Row: next.Row, Err: err})
+			}
+			*job = next
+
+			if rows++; rows%interval == 0 {
+				report()
+			}
+		}
+
+		job.CompletedAt = time.Now().UTC()
+		job.UpdatedAt = job.CompletedAt
+		return s.update("Import", func(tx *Tx) error { return saveImportJob(tx, job) })
+	}); err != nil {
+		return nil, err
+	}
+	report()
+	return job, nil
+}
+
+// ImportJob retrieves an import job by name. Returns nil if the job does not
+// exist.
+func (s *Store) ImportJob(name string) (*ImportJob, error) {
+	var job *ImportJob
+	if err := s.view("ImportJob", func(tx *Tx) error {
+		v := tx.Bucket([]byte("ImportJobs")).Get([]byte(name))
+		if v == nil {
+			return nil
+		}
+		tx.recordRead("ImportJobs", v)
+
+		job = &ImportJob{}
+		return job.UnmarshalBinary(v)
+	}); err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
+// ImportJobs retrieves a list of all import jobs ordered by name.
+func (s *Store) ImportJobs() ([]*ImportJob, error) {
+	a := []*ImportJob{}
+	if err := s.view("ImportJobs", func(tx *Tx) error {
+		return tx.Bucket([]byte("ImportJobs")).ForEach(func(_, v []byte) error {
+			tx.recordRead("ImportJobs", v)
+
+			job := &ImportJob{}
+			if err := job.UnmarshalBinary(v); err != nil {
+				return err
+			}
+			a = append(a, job)
+			return nil
+		})
+	}); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// DeleteImportJob removes an import job so a file with the same name can be
+// imported again. Users created by the job are kept. Returns
+// ErrImportJobNotFound if the job does not exist.
+func (s *Store) DeleteImportJob(name string) error {
+	return s.update("DeleteImportJob", func(tx *Tx) error {
+		bkt := tx.Bucket([]byte("ImportJobs"))
+		if bkt.Get([]byte(name)) == nil {
+			return keyError("import", name, ErrImportJobNotFound)
+		}
+		tx.recordDelete("ImportJobs")
+		return bkt.Delete([]byte(name))
+	})
+}
+
+// saveImportJob writes job to the ImportJobs bucket.
+func saveImportJob(tx *Tx, job *ImportJob) error {
+	buf, err := job.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	tx.recordWrite("ImportJobs", buf)
+	return tx.Bucket([]byte("ImportJobs")).Put([]byte(job.Name), buf)
+}
+
+// importReader reads the rows of an import file.
+type importReader interface {
+	// next returns the user of the next row or io.EOF at the end of the
+	// file. Rows that cannot be converted to a user return an EINVALID
+	// error and can be skipped.
+	next() (*User, error)
+
+	// offset returns the byte offset after the last row read.
+	offset() int64
+}
+
+// csvImportReader reads users from CSV rows.
+type csvImportReader struct {
+	cr      *csv.Reader
+	base    int64
+	columns []string
+}
+
+// newCSVImportReader reads the header of r and positions it after the last
+// row read by job. The job's offset and row are set past the header if it
+// has not started.
+func newCSVImportReader(r io.ReadSeeker, job *ImportJob, mapping map[string]string) (*csvImportReader, error) {
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	header, err := cr.Read()
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	columns := make([]string, len(header))
+	for i, name := range header {
+		if mapping == nil {
+			columns[i] = name
+		} else {
+			columns[i] = mapping[name]
+		}
+	}
+
+	if job.Row == 0 && err == nil {
+		job.Offset, job.Row = cr.InputOffset(), 1
+	}
+	if _, err := r.Seek(job.Offset, io.SeekStart); err != nil {
+		return nil, err
+	}
+	cr = csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	return &csvImportReader{cr: cr, base: job.Offset, columns: columns}, nil
+}
+
+func (r *csvImportReader) next() (*User, error) {
+	rec, err := r.cr.Read()
+	if err != nil {
+		return nil, err
+	}
+
+	u, err := parseCSVUser(r.columns, rec)
+	var e *Error
+	if err != nil && !errors.As(err, &e) {
+		err = &Error{Code: EINVALID, Message: err.Error()}
+	}
+	return u, err
+}
+
+func (r *csvImportReader) offset() int64 { return r.base + r.cr.InputOffset() }
+
+// jsonImportReader reads users from a stream of JSON objects.
+type jsonImportReader struct {
+	dec  *json.Decoder
+	base int64
+}
+
+// newJSONImportReader positions r after the last row read by job.
+func newJSONImportReader(r io.ReadSeeker, job *ImportJob) (*jsonImportReader, error) {
+	if _, err := r.Seek(job.Offset, io.SeekStart); err != nil {
+		return nil, err
+	}
+	return &jsonImportReader{dec: json.NewDecoder(r), base: job.Offset}, nil
+}
+
+func (r *jsonImportReader) next() (*User, error) {
+	// Syntax errors end the stream but values of the wrong type only skip
+	// the row, so objects are decoded in two steps.
+	var raw json.RawMessage
+	if err := r.dec.Decode(&raw); err != nil {
+		return nil, err
+	}
+
+	var row struct {
+		Username  string    `json:"username"`
+		Tags      []string  `json:"tags"`
+		CreatedAt time.Time `json:"created_at"`
+	}
+	if err := json.Unmarshal(raw, &row); err != nil {
+		return nil, &Error{Code: EINVALID, Message: err.Error()}
+	} else if row.Username == "" {
+		return nil, ErrUsernameRequired
+	}
+
+	u := &User{Username: row.Username, CreatedAt: row.CreatedAt.UTC()}
+	for _, tag := range row.Tags {
+		if tag = strings.TrimSpace(tag); tag != "" && !hasTag(u.Tags, tag) {
+			u.Tags = append(u.Tags, tag)
+		}
+	}
+	return u, nil
+}
+
+func (r *jsonImportReader) offset() int64 { return r.base + r.dec.InputOffset() }
+
+// ImportCommand imports users from a CSV or JSON file. Progress is saved
+// under the file's name so an interrupted import resumes when run again.
+type ImportCommand struct {
+	*Main
+}
+
+// NewImportCommand returns a new instance of ImportCommand.
+func NewImportCommand(m *Main) *ImportCommand {
+	return &ImportCommand{Main: m}
+}
+
+// Run executes the import and prints progress and failed rows.
+func (cmd *ImportCommand) Run(args ...string) error {
+	fs := flag.NewFlagSet("import", flag.ContinueOnError)
+	fs.SetOutput(cmd.Stderr)
+	format := fs.String("format", "", "file format, csv or json (default from the file extension)")
+	name := fs.String("name", "", "name of the import job (default the file name)")
+	restart := fs.Bool("restart", false, "discard the progress of a previous import with the same name")
+	fs.Usage = func() {
+		fmt.Fprintln(cmd.Stderr, "usage: appdev import [-format csv|json] [-name name] [-restart] path file")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err == flag.ErrHelp {
+		return ErrUsage
+	} else if err != nil {
+		return err
+	} else if fs.NArg() != 2 {
+		fs.Usage()
+		return ErrUsage
+	}
+	filename := fs.Arg(1)
+	if *format == "" {
+		switch filepath.Ext(filename) {
+		case ".csv":
+			*format = ImportFormatCSV
+		case ".json", ".jsonl", ".ndjson":
+			*format = ImportFormatJSON
+		}
+	}
+	if *name == "" {
+		*name = filepath.Base(filename)
+	}
+
+	f, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	s := NewStore(fs.Arg(0))
+	if err := s.Open(); err != nil {
+		return err
+	}
+	defer s.Close()
+
+	if *restart {
+		if err := s.DeleteImportJob(*name); err != nil && !errors.Is(err, ErrImportJobNotFound) {
+			return err
+		}
+	} else if job, err := s.ImportJob(*name); err != nil {
+		return err
+	} else if job != nil && job.CompletedAt.IsZero() {
+		fmt.Fprintf(cmd.Stdout, "resuming %s after row %d\n", *name, job.Row)
+	}
+
+	job, err := s.Import(*name, f, ImportJobOptions{
+		Format: *format,
+		Progress: func(p ImportProgress) {
+			for _, e := range p.Errors {
+				fmt.Fprintln(cmd.Stderr, e)
+			}
+			fmt.Fprintf(cmd.Stdout, "%d rows: %d created, %d failed, %.0f rows/sec\n", p.Job.Row, p.Job.Created, p.Job.Failed, p.RowsPerSec)
+		},
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(cmd.Stdout, "import %s completed: %d created, %d failed\n", job.Name, job.Created, job.Failed)
+	return nil
+}
+
+// Import related errors.
+var (
+	ErrImportNameRequired   = &Error{Code: EINVALID, Message: "import name required"}
+	ErrImportFormatInvalid  = &Error{Code: EINVALID, Message: "import format must be csv or json"}
+	ErrImportFormatMismatch = &Error{Code: ECONFLICT, Message: "import format differs from the existing job"}
+	ErrImportJobNotFound    = &Error{Code: ENOTFOUND, Message: "import job not found"}
+)
@@ -0,0 +1,216 @@
+package main_test
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	main "github.com/benbjohnson/application-development-using-boltdb"
+)
+
+// Ensure CSV rows are imported, failures are counted, and progress is
+// reported.
+func TestStore_Import_CSV(t *testing.T) {
+	s := OpenStore()
+	defer s.Close()
+
+	data := "username,tags,created_at\nsusy,a;b,\n,x,\njim,,\nbob,,yesterday\nsam,c,\n"
+	var reports []main.ImportProgress
+	job, err := s.Import("users.csv", strings.NewReader(data), main.ImportJobOptions{
+		Format:           main.ImportFormatCSV,
+		Progress:         func(p main.ImportProgress) { reports = append(reports, p) },
+		ProgressInterval: 2,
+	})
+	if err != nil {
+		t.Fatal(err)
+	} else if job.Row != 6 || job.Created != 3 || job.Failed != 2 || job.Offset != int64(len(data)) || job.CompletedAt.IsZero() {
+		t.Fatalf("unexpected job: %#v", job)
+	} else if !strings.Contains(job.LastError, "created_at") {
+		t.Fatalf("unexpected last error: %q", job.LastError)
+	}
+
+	// Reports are made every two rows and once at the end.
+	if len(reports) != 3 {
+		t.Fatalf("unexpected reports: %d", len(reports))
+	} else if a := reports[1].Errors; len(a) != 1 || a[0].Row != 5 || main.ErrorCode(a[0]) != main.EINVALID {
+		t.Fatalf("unexpected errors: %#v", a)
+	} else if reports[2].Job.Row != 6 || reports[2].RowsPerSec <= 0 {
+		t.Fatalf("unexpected report: %#v", reports[2])
+	}
+
+	if u, err := s.UserByName("sam"); err != nil {
+		t.Fatal(err)
+	} else if u == nil || len(u.Tags) != 1 || u.Tags[0] != "c" {
+		t.Fatalf("unexpected user: %#v", u)
+	}
+
+	// Completed jobs are not run again.
+	if other, err := s.Import("users.csv", nil, main.ImportJobOptions{Format: main.ImportFormatCSV}); err != nil {
+		t.Fatal(err)
+	} else if other.Created != 3 {
+		t.Fatalf("unexpected job: %#v", other)
+	} else if a, err := s.ImportJobs(); err != nil {
+		t.Fatal(err)
+	} else if len(a) != 1 || a[0].Name != "users.csv" {
+		t.Fatalf("unexpected jobs: %#v", a)
+	}
+}
+
+// Ensure an interrupted import resumes after the last saved row.
+func TestStore_Import_Resume(t *testing.T) {
+	s := OpenStore()
+	defer s.Close()
+
+	data := "name\nsusy\njim\nbob\nsam\n"
+	opts := main.ImportJobOptions{Format: main.ImportFormatCSV, Mapping: map[string]string{"name": "username"}}
+
+	// Fail partway through the third row.
+	r := &failingReader{ReadSeeker: strings.NewReader(data), n: int64(len("name\nsusy\njim\nb"))}
+	if _, err := s.Import("users", r, opts); err == nil || !strings.Contains(err.Error(), "marker") {
+		t.Fatalf("unexpected error: %v", err)
+	} else if job, err := s.ImportJob("users"); err != nil {
+		t.Fatal(err)
+	} else if job.Row != 3 || job.Created != 2 || !job.CompletedAt.IsZero() {
+		t.Fatalf("unexpected job: %#v", job)
+	}
+
+	if err := s.Reopen(); err != nil {
+		t.Fatal(err)
+	} else if job, err := s.Import("users", strings.NewReader(data), opts); err != nil {
+		t.Fatal(err)
+	} else if job.Created != 4 || job.Failed != 0 {
+		t.Fatalf("unexpected job: %#v", job)
+	} else if a, err := s.Users(); err != nil {
+		t.Fatal(err)
+	} else if len(a) != 4 {
+		t.Fatalf("unexpected users: %d", len(a))
+	}
+}
+
+// Ensure JSON objects are imported and resumed by offset.
+func TestStore_Import_JSON(t *testing.T) {
+	s := OpenStore()
+	defer s.Close()
+
+	data := `{"username":"susy","tags":["a"],"created_at":"2020-01-02T03:04:05Z"}
+{"username":"jim","tags":5}
+{"username":"bob"}
+`
+	r := &failingReader{ReadSeeker: strings.NewReader(data), n: int64(strings.Index(data, "bob"))}
+	if _, err := s.Import("users.json", r, main.ImportJobOptions{Format: main.ImportFormatJSON}); err == nil {
+		t.Fatal("expected error")
+	} else if job, err := s.Import("users.json", strings.NewReader(data), main.ImportJobOptions{Format: main.ImportFormatJSON}); err != nil {
+		t.Fatal(err)
+	} else if job.Row != 3 || job.Created != 2 || job.Failed != 1 {
+		t.Fatalf("unexpected job: %#v", job)
+	}
+
+	if u, err := s.UserByName("susy"); err != nil {
+		t.Fatal(err)
+	} else if u.CreatedAt.Year() != 2020 || len(u.Tags) != 1 {
+		t.Fatalf("unexpected user: %#v", u)
+	}
+}
+
+// Ensure invalid imports are rejected.
+func TestStore_Import_ErrInvalid(t *testing.T) {
+	s := OpenStore()
+	defer s.Close()
+
+	if _, err := s.Import("", strings.NewReader(""), main.ImportJobOptions{Format: main.ImportFormatCSV}); !errors.Is(err, main.ErrImportNameRequired) {
+		t.Fatalf("unexpected error: %v", err)
+	} else if _, err := s.Import("x", strings.NewReader(""), main.ImportJobOptions{Format: "xml"}); !errors.Is(err, main.ErrImportFormatInvalid) {
+		t.Fatalf("unexpected error: %v", err)
+	} else if _, err := s.Import("x", strings.NewReader(""), main.ImportJobOptions{Format: main.ImportFormatCSV, Mapping: map[string]string{"a": "id"}}); !errors.Is(err, main.ErrInvalidCSVField) {
+		t.Fatalf("unexpected error: %v", err)
+	} else if _, err := s.Import("x", strings.NewReader(""), main.ImportJobOptions{Format: main.ImportFormatCSV}); err != nil {
+		t.Fatal(err)
+	} else if _, err := s.Import("x", strings.NewReader(""), main.ImportJobOptions{Format: main.ImportFormatJSON}); !errors.Is(err, main.ErrImportFormatMismatch) {
+		t.Fatalf("unexpected error: %v", err)
+	} else if err := s.DeleteImportJob("x"); err != nil {
+		t.Fatal(err)
+	} else if err := s.DeleteImportJob("x"); !errors.Is(err, main.ErrImportJobNotFound) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+// Ensure the import command imports a file and can restart it.
+func TestImportCommand_Run(t *testing.T) {
+	s := OpenStore()
+	defer s.Close()
+	if err := s.Store.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "users.csv")
+	if err := os.WriteFile(path, []byte("username,created_at\nsusy,\njim,yesterday\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	m := NewMain()
+	if err := m.Run("import", s.Path, path); err != nil {
+		t.Fatal(err)
+	} else if !strings.Contains(m.Stdout.String(), "import users.csv completed: 1 created, 1 failed") {
+		t.Fatalf("unexpected stdout: %s", m.Stdout.String())
+	} else if !strings.Contains(m.Stderr.String(), "row 3:") {
+		t.Fatalf("unexpected stderr: %s", m.Stderr.String())
+	}
+
+	// Completed imports are only run again when restarted, in which case
+	// the imported username is taken.
+	for _, tt := range []struct {
+		args []string
+		want string
+	}{
+		{[]string{s.Path, path}, "import users.csv completed: 1 created, 1 failed"},
+		{[]string{"-restart", s.Path, path}, "import users.csv completed: 0 created, 2 failed"},
+	} {
+		m := NewMain()
+		if err := m.Run(append([]string{"import"}, tt.args...)...); err != nil {
+			t.Fatal(err)
+		} else if !strings.Contains(m.Stdout.String(), tt.want) {
+			t.Fatalf("unexpected stdout: %s", m.Stdout.String())
+		}
+	}
+	if err := s.Open(); err != nil {
+		t.Fatal(err)
+	} else if a, err := s.Users(); err != nil {
+		t.Fatal(err)
+	} else if len(a) != 1 {
+		t.Fatalf("unexpected users: %d", len(a))
+	}
+}
+
+// Ensure the import command requires a path and a file.
+func TestImportCommand_Run_ErrUsage(t *testing.T) {
+	if err := NewMain().Run("import", "x"); !errors.Is(err, main.ErrUsage) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+// failingReader returns an error when reading past offset n.
+type failingReader struct {
+	io.ReadSeeker
+	n   int64
+	pos int64
+}
+
+func (r *failingReader) Read(p []byte) (int, error) {
+	if r.pos >= r.n {
+		return 0, errors.New("marker")
+	} else if int64(len(p)) > r.n-r.pos {
+		p = p[:r.n-r.pos]
+	}
+	n, err := r.ReadSeeker.Read(p)
+	r.pos += int64(n)
+	return n, err
+}
+
+func (r *failingReader) Seek(offset int64, whence int) (int64, error) {
+	pos, err := r.ReadSeeker.Seek(offset, whence)
+	r.pos = pos
+	return pos, err
+}
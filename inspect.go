@@ -0,0 +1,349 @@
+package main
+
+import (
+	"bufio"
+	"encoding"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/boltdb/bolt"
+)
+
+// InspectCommand opens a data file read-only and reads commands from stdin
+// to browse its buckets, keys, and page statistics.
+type InspectCommand struct {
+	*Main
+
+	store *Store
+
+	// Bucket names from the top level to the current bucket.
+	path [][]byte
+}
+
+// NewInspectCommand returns a new instance of InspectCommand.
+func NewInspectCommand(m *Main) *InspectCommand {
+	return &InspectCommand{Main: m}
+}
+
+// Run opens the data file and executes commands until stdin is closed or
+// the quit command is entered.
+func (cmd *InspectCommand) Run(args ...string) error {
+	fs := flag.NewFlagSet("inspect", flag.ContinueOnError)
+	fs.SetOutput(cmd.Stderr)
+	fs.Usage = func() {
+		fmt.Fprintln(cmd.Stderr, "usage: appdev inspect path")
+		fmt.Fprint(cmd.Stderr, inspectHelp)
+	}
+	if err := fs.Parse(args); err == flag.ErrHelp {
+		return ErrUsage
+	} else if err != nil {
+		return err
+	} else if fs.NArg() != 1 {
+		fs.Usage()
+		return ErrUsage
+	}
+
+	cmd.store = NewStore(fs.Arg(0), WithReadOnly())
+	if err := cmd.store.Open(); err != nil {
+		return err
+	}
+	defer cmd.store.Close()
+
+	scanner := bufio.NewScanner(cmd.Stdin)
+	for {
+		fmt.Fprintf(cmd.Stdout, "%s> ", cmd.pwd())
+		if !scanner.Scan() {
+			fmt.Fprintln(cmd.Stdout)
+			return scanner.Err()
+		}
+
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		} else if fields[0] == "quit" || fields[0] == "exit" {
+			return nil
+		}
+
+		// Errors are reported and the session continues.
+		if err := cmd.exec(fields[0], fields[1:]); err != nil {
+			fmt.Fprintln(cmd.Stdout, "error:", err)
+		}
+	}
+}
+
+// exec executes a single command.
+func (cmd *InspectCommand) exec(name string, args []string) error {
+	switch name {
+	case "ls":
+		return cmd.view(cmd.ls)
+	case "cd":
+		if len(args) != 1 {
+			return fmt.Errorf("usage: cd bucket")
+		}
+		return cmd.cd(args[0])
+	case "pwd":
+		fmt.Fprintln(cmd.Stdout, cmd.pwd())
+		return nil
+	case "dump":
+		n := 20
+		if len(args) > 0 {
+			v, err := strconv.Atoi(args[0])
+			if err != nil {
+				return fmt.Errorf("invalid count: %q", args[0])
+			}
+			n = v
+		}
+		return cmd.view(func(tx *Tx, b *bolt.Bucket) error { return cmd.dump(tx, b, n) })
+	case "get":
+		if len(args) != 1 {
+			return fmt.Errorf("usage: get key")
+		}
+		return cmd.view(func(tx *Tx, b *bolt.Bucket) error { return cmd.get(tx, b, args[0]) })
+	case "stats":
+		return cmd.view(cmd.stats)
+	case "help":
+		fmt.Fprint(cmd.Stdout, inspectHelp)
+		return nil
+	default:
+		return fmt.Errorf("unknown command %q; type 'help' for a list of commands", name)
+	}
+}
+
+// view executes fn with the current bucket, which is nil at the top level.
+func (cmd *InspectCommand) view(fn func(tx *Tx, b *bolt.Bucket) error) error {
+	return cmd.store.view("Inspect", func(tx *Tx) error {
+		b, err := cmd.bucket(tx, cmd.path)
+		if err != nil {
+			return err
+		}
+		return fn(tx, b)
+	})
+}
+
+// bucket returns the bucket at path or nil for the top level.
+func (cmd *InspectCommand) bucket(tx *Tx, path [][]byte) (*bolt.Bucket, error) {
+	var b *bolt.Bucket
+	for i, name := range path {
+		if i == 0 {
+			b = tx.Tx.Bucket(name)
+		} else {
+			b = b.Bucket(name)
+		}
+		if b == nil {
+			return nil, fmt.Errorf("bucket not found: %s", formatKey(name))
+		}
+	}
+	return b, nil
+}
+
+// ls lists the nested buckets and keys of the current bucket.
+func (cmd *InspectCommand) ls(tx *Tx, b *bolt.Bucket) error {
+	if b == nil {
+		return tx.Tx.ForEach(func(name []byte, b *bolt.Bucket) error {
+			fmt.Fprintf(cmd.Stdout, "%s/\t%d keys\n", formatKey(name), b.Stats().KeyN)
+			return nil
+		})
+	}
+
+	return b.ForEach(func(k, v []byte) error {
+		if v == nil {
+			fmt.Fprintf(cmd.Stdout, "%s/\t%d keys\n", formatKey(k), b.Bucket(k).Stats().KeyN)
+			return nil
+		}
+		fmt.Fprintf(cmd.Stdout, "%s\t%d bytes\n", formatKey(k), len(v))
+		return nil
+	})
+}
+
+// cd changes the current bucket. ".." moves up one level and "/" moves to
+// the top level. Names may be given in hex with a "0x" prefix.
+func (cmd *InspectCommand) cd(arg string) error {
+	switch arg {
+	case "/":
+		cmd.path = nil
+		return nil
+	case "..":
+		if len(cmd.path) > 0 {
+			cmd.path = cmd.path[:len(cmd.path)-1]
+		}
+		return nil
+	}
+
+	name, err := parseKey(arg)
+	if err != nil {
+		return err
+	}
+
+	path := append(append([][]byte{}, cmd.path...), name)
+	if err := cmd.store.view("Inspect", func(tx *Tx) error {
+		_, err := cmd.bucket(tx, path)
+		return err
+	}); err != nil {
+		return err
+	}
+	cmd.path = path
+	return nil
+}
+
+// dump prints up to n keys of the current bucket along with their values.
+func (cmd *InspectCommand) dump(tx *Tx, b *bolt.Bucket, n int) error {
+	if b == nil {
+		return fmt.Errorf("no bucket selected")
+	}
+
+	c := b.Cursor()
+	for k, v := c.First(); k != nil && n > 0; k, v = c.Next() {
+		if v == nil {
+			fmt.Fprintf(cmd.Stdout, "%s/\n", formatKey(k))
+		} else {
+			fmt.Fprintf(cmd.Stdout, "%s\n%s\n", formatKey(k), cmd.formatValue(tx, k, v))
+		}
+		n--
+	}
+	return nil
+}
+
+// get prints the value of a single key in the current bucket.
+func (cmd *InspectCommand) get(tx *Tx, b *bolt.Bucket, arg string) error {
+	if b == nil {
+		return fmt.Errorf("no bucket selected")
+	}
+
+	k, err := parseKey(arg)
+	if err != nil {
+		return err
+	}
+
+	v := b.Get(k)
+	if v == nil {
+		return fmt.Errorf("key not found: %s", formatKey(k))
+	}
+	fmt.Fprintln(cmd.Stdout, cmd.formatValue(tx, k, v))
+	return nil
+}
+
+// stats prints page statistics for the current bucket, including nested
+// buckets, or for every bucket at the top level.
+func (cmd *InspectCommand) stats(tx *Tx, b *bolt.Bucket) error {
+	var s bolt.BucketStats
+	if b != nil {
+		s = b.Stats()
+	} else if err := tx.Tx.ForEach(func(_ []byte, b *bolt.Bucket) error {
+		s.Add(b.Stats())
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(cmd.Stdout, "keys:            %d\n", s.KeyN)
+	fmt.Fprintf(cmd.Stdout, "depth:           %d\n", s.Depth)
+	fmt.Fprintf(cmd.Stdout, "buckets:         %d (%d inline)\n", s.BucketN, s.InlineBucketN)
+	fmt.Fprintf(cmd.Stdout, "branch pages:    %d (%d overflow, %d/%d bytes used)\n", s.BranchPageN, s.BranchOverflowN, s.BranchInuse, s.BranchAlloc)
+	fmt.Fprintf(cmd.Stdout, "leaf pages:      %d (%d overflow, %d/%d bytes used)\n", s.LeafPageN, s.LeafOverflowN, s.LeafInuse, s.LeafAlloc)
+	fmt.Fprintf(cmd.Stdout, "inline bytes:    %d\n", s.InlineBucketInuse)
+	return nil
+}
+
+// formatValue returns the value as hex followed by its decoded form if the
+// current bucket holds a known record type.
+func (cmd *InspectCommand) formatValue(tx *Tx, k, v []byte) string {
+	s := "  hex: " + hex.EncodeToString(v)
+
+	m := cmd.decoder(k)
+	if m == nil {
+		return s
+	}
+
+	buf, err := decodeValue(tx, v)
+	if err != nil {
+		return s + "\n  error: " + err.Error()
+	} else if err := m.UnmarshalBinary(buf); err != nil {
+		return s + "\n  error: " + err.Error()
+	}
+	return s + fmt.Sprintf("\n  %T: %+v", m, m)
+}
+
+// decoder returns a record to decode values of key k in the current bucket
+// into or nil if the bucket does not hold records. Buckets are matched by
+// name so tenant buckets are decoded the same way.
+func (cmd *InspectCommand) decoder(k []byte) encoding.BinaryUnmarshaler {
+	if len(cmd.path) == 0 {
+		return nil
+	}
+
+	// Blob metadata is stored under the "info" key of each blob's bucket.
+	if len(cmd.path) >= 3 && string(cmd.path[len(cmd.path)-3]) == "Blobs" {
+		if string(k) == "info" {
+			return &Blob{}
+		}
+		return nil
+	}
+
+	// Revisions are stored in a bucket per user.
+	if len(cmd.path) >= 2 && string(cmd.path[len(cmd.path)-2]) == "UserHistory" {
+		return &UserRevision{}
+	}
+
+	switch string(cmd.path[len(cmd.path)-1]) {
+	case "Users":
+		return &User{}
+	case "APIKeys":
+		return &APIKey{}
+	case "Idempotency":
+		return &idempotencyRecord{}
+	case "Jobs", "DeadJobs":
+		return &Job{}
+	case "Outbox":
+		return &Event{}
+	default:
+		return nil
+	}
+}
+
+// pwd returns the path of the current bucket.
+func (cmd *InspectCommand) pwd() string {
+	a := make([]string, len(cmd.path))
+	for i, name := range cmd.path {
+		a[i] = formatKey(name)
+	}
+	return "/" + strings.Join(a, "/")
+}
+
+// formatKey returns k as a string if it is printable and as hex otherwise.
+func formatKey(k []byte) string {
+	for _, r := range string(k) {
+		if r == unicode.ReplacementChar || !unicode.IsPrint(r) || r == '/' {
+			return "0x" + hex.EncodeToString(k)
+		}
+	}
+	return string(k)
+}
+
+// parseKey parses a key given as a string or as hex with a "0x" prefix.
+func parseKey(s string) ([]byte, error) {
+	if strings.HasPrefix(s, "0x") {
+		return hex.DecodeString(s[2:])
+	}
+	return []byte(s), nil
+}
+
+// inspectHelp describes the commands of the inspect session.
+const inspectHelp = `
+Commands:
+
+	ls          list nested buckets and keys of the current bucket
+	cd name     enter a nested bucket; ".." moves up and "/" to the top
+	pwd         print the path of the current bucket
+	dump [n]    print up to n keys with hex and decoded values (default 20)
+	get key     print the value of a key
+	stats       print page statistics of the current bucket
+	help        print this screen
+	quit        end the session
+
+Keys and bucket names that are not printable are shown and may be given
+as hex with a "0x" prefix.
+`
@@ -0,0 +1,58 @@
+package main_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	main "github.com/benbjohnson/application-development-using-boltdb"
+)
+
+// Ensure the inspect command can browse buckets and decode records.
+func TestInspectCommand_Run(t *testing.T) {
+	s := OpenStore()
+	defer s.Close()
+	if err := s.CreateUser(&main.User{Username: "susy", Tags: []string{"beta"}}); err != nil {
+		t.Fatal(err)
+	} else if err := s.Store.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	m := NewMain()
+	m.Stdin.WriteString(strings.Join([]string{
+		"ls",
+		"cd Users",
+		"pwd",
+		"dump",
+		"get 0x0000000000000001",
+		"stats",
+		"cd ..",
+		"cd NoSuchBucket",
+		"quit",
+	}, "\n"))
+	if err := m.Run("inspect", s.Path); err != nil {
+		t.Fatal(err)
+	}
+
+	out := m.Stdout.String()
+	for _, want := range []string{
+		"Users/\t1 keys",
+		"UsersByUsername/\t1 keys",
+		"/Users> ",
+		"0x0000000000000001\n",
+		"*main.User: &{ID:1 Username:susy Tags:[beta]",
+		"keys:            1",
+		"error: Inspect: bucket not found: NoSuchBucket",
+	} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("missing %q in output:\n%s", want, out)
+		}
+	}
+}
+
+// Ensure the inspect command requires a path.
+func TestInspectCommand_Run_ErrUsage(t *testing.T) {
+	if err := NewMain().Run("inspect"); !errors.Is(err, main.ErrUsage) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
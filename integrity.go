@@ -0,0 +1,139 @@
+package main
+
+import (
+	"fmt"
+)
+
+// Violation describes an inconsistency between buckets in the store.
+type Violation struct {
+	// Bucket and key of the inconsistent entry.
+	Bucket string
+	Key    []byte
+
+	// Description of the inconsistency.
+	Reason string
+}
+
+// String returns a human-readable description of the violation.
+func (v Violation) String() string {
+	return fmt.Sprintf("%s/%x: %s", v.Bucket, v.Key, v.Reason)
+}
+
+// CheckIntegrity verifies that every index matches its source bucket and
+// that records referencing users point to users that exist.
+// Returns an empty slice if the store is consistent.
+func (s *Store) CheckIntegrity() ([]Violation, error) {
+	var a []Violation
+	if err := s.view("CheckIntegrity", func(tx *Tx) error {
+		users, err := allUsers(tx)
+		if err != nil {
+			return err
+		}
+
+		// Build the expected entries of each index from its source bucket.
+		for _, idx := range tx.store.schema().Indexes {
+			expected := make(map[string]struct{})
+			if err := forEachIndexEntry(tx, idx, func(_, k, _ []byte) error {
+				expected[string(k)] = struct{}{}
+				return nil
+			}); err != nil {
+				return err
+			}
+			a = append(a, checkIndex(tx, idx.Name, expected)...)
+		}
+
+		// Idempotency records must reference an existing user.
+		return tx.Bucket([]byte("Idempotency")).ForEach(func(k, v []byte) error {
+			tx.recordRead("Idempotency", v)
+
+			var r idempotencyRecord
+			if err := r.UnmarshalBinary(v); err != nil {
+				return err
+			} else if _, ok := users[r.UserID]; !ok {
+				a = append(a, Violation{Bucket: "Idempotency", Key: k, Reason: fmt.Sprintf("user %d not found", r.UserID)})
+			}
+			return nil
+		})
+	}); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// RepairIntegrity rebuilds all indexes from their source buckets and removes
+// records that reference users which no longer exist.
+func (s *Store) RepairIntegrity() error {
+	return s.update("RepairIntegrity", func(tx *Tx) error {
+		users, err := allUsers(tx)
+		if err != nil {
+			return err
+		}
+
+		// Recreate the indexes.
+		for _, idx := range tx.store.schema().Indexes {
+			if err := tx.DeleteBucket([]byte(idx.Name)); err != nil {
+				return err
+			} else if _, err := tx.CreateBucket([]byte(idx.Name)); err != nil {
+				return err
+			} else if err := rebuildIndex(tx, idx); err != nil {
+				return err
+			}
+		}
+
+		// Remove orphaned idempotency records. Keys are collected first
+		// since the bucket cannot be modified while iterating.
+		bkt := tx.Bucket([]byte("Idempotency"))
+		var orphans [][]byte
+		if err := bkt.ForEach(func(k, v []byte) error {
+			var r idempotencyRecord
+			if err := r.UnmarshalBinary(v); err != nil {
+				return err
+			} else if _, ok := users[r.UserID]; !ok {
+				orphans = append(orphans, k)
+			}
+			return nil
+		}); err != nil {
+			return err
+		}
+		for _, k := range orphans {
+			if err := deleteWithTTL(tx, "Idempotency", k); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// allUsers reads every user in the store, keyed by ID.
+func allUsers(tx *Tx) (map[int]*User, error) {
+	m := make(map[int]*User)
+	if err := scanUsers(tx, false, func(u *User) { m[u.ID] = u }); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// checkIndex compares the keys of the index bucket named name against the
+// expected set of keys and returns a violation for each difference.
+func checkIndex(tx *Tx, name string, expected map[string]struct{}) []Violation {
+	var a []Violation
+	seen := make(map[string]struct{}, len(expected))
+
+	c := tx.Bucket([]byte(name)).Cursor()
+	for k, _ := c.First(); k != nil; k, _ = c.Next() {
+		tx.recordRead(name, nil)
+
+		if _, ok := expected[string(k)]; !ok {
+			a = append(a, Violation{Bucket: name, Key: k, Reason: "index entry has no matching record"})
+		}
+		seen[string(k)] = struct{}{}
+	}
+
+	for k := range expected {
+		if _, ok := seen[k]; !ok {
+			a = append(a, Violation{Bucket: name, Key: []byte(k), Reason: "missing index entry"})
+		}
+	}
+	return a
+}
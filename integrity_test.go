@@ -0,0 +1,82 @@
+package main_test
+
+import (
+	"testing"
+
+	main "github.com/benbjohnson/application-development-using-boltdb"
+	"github.com/benbjohnson/application-development-using-boltdb/keys"
+	"github.com/boltdb/bolt"
+)
+
+// Ensure a consistent store has no integrity violations.
+func TestStore_CheckIntegrity(t *testing.T) {
+	s := OpenStore()
+	defer s.Close()
+
+	if err := s.CreateUser(&main.User{Username: "susy", Tags: []string{"beta"}}); err != nil {
+		t.Fatal(err)
+	} else if err := s.CreateUserIdempotent("key", &main.User{Username: "john"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if a, err := s.CheckIntegrity(); err != nil {
+		t.Fatal(err)
+	} else if len(a) != 0 {
+		t.Fatalf("unexpected violations: %v", a)
+	}
+}
+
+// Ensure corrupted indexes and orphaned records are detected and repaired.
+func TestStore_RepairIntegrity(t *testing.T) {
+	s := OpenStore()
+	defer s.Close()
+
+	if err := s.CreateUser(&main.User{Username: "susy", Tags: []string{"beta"}}); err != nil {
+		t.Fatal(err)
+	} else if err := s.CreateUserIdempotent("key", &main.User{Username: "john"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Corrupt the data file directly: drop an index entry, add a stale
+	// index entry, and delete a user referenced by an idempotency record.
+	if err := s.Store.Close(); err != nil {
+		t.Fatal(err)
+	}
+	db, err := bolt.Open(s.Path, 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Update(func(tx *bolt.Tx) error {
+		if err := tx.Bucket([]byte("UsersByTag")).Delete(keys.Join(keys.String("beta"), keys.Int(1))); err != nil {
+			return err
+		} else if err := tx.Bucket([]byte("UsersByUsername")).Put(keys.Join(keys.String("ghost"), keys.Int(100)), nil); err != nil {
+			return err
+		}
+		return tx.Bucket([]byte("Users")).Delete(keys.Int(2))
+	}); err != nil {
+		t.Fatal(err)
+	} else if err := db.Close(); err != nil {
+		t.Fatal(err)
+	} else if err := s.Open(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The missing tag entry, the stale username entry, the username entry
+	// for the deleted user, and the orphaned idempotency record.
+	if a, err := s.CheckIntegrity(); err != nil {
+		t.Fatal(err)
+	} else if len(a) != 4 {
+		t.Fatalf("unexpected violations: %v", a)
+	}
+
+	// Repair the store and verify it is consistent.
+	if err := s.RepairIntegrity(); err != nil {
+		t.Fatal(err)
+	} else if a, err := s.CheckIntegrity(); err != nil {
+		t.Fatal(err)
+	} else if len(a) != 0 {
+		t.Fatalf("unexpected violations: %v", a)
+	} else if a, _ := s.UsersWithTag("beta"); len(a) != 1 {
+		t.Fatalf("unexpected users: %v", usernames(a))
+	}
+}
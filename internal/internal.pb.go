@@ -10,6 +10,27 @@ It is generated from these files:
 
 It has these top-level messages:
 	User
+	APIKey
+	IdempotencyRecord
+	Manifest
+	Blob
+	Job
+	Event
+	UserRevision
+	FieldChange
+	TOTP
+	Identity
+	Password
+	Invite
+	Erasure
+	Flag
+	Webhook
+	WebhookDelivery
+	Email
+	PasswordReset
+	Schedule
+	Lease
+	ImportJob
 */
 package internal
 
@@ -27,9 +48,19 @@ var _ = math.Inf
 const _ = proto.GoGoProtoPackageIsVersion1
 
 type User struct {
-	ID               *int64  `protobuf:"varint,1,opt,name=ID" json:"ID,omitempty"`
-	Username         *string `protobuf:"bytes,2,opt,name=Username" json:"Username,omitempty"`
-	XXX_unrecognized []byte  `json:"-"`
+	ID               *int64   `protobuf:"varint,1,opt,name=ID" json:"ID,omitempty"`
+	Username         *string  `protobuf:"bytes,2,opt,name=Username" json:"Username,omitempty"`
+	Tags             []string `protobuf:"bytes,3,rep,name=Tags" json:"Tags,omitempty"`
+	CreatedAt        *int64   `protobuf:"varint,4,opt,name=CreatedAt" json:"CreatedAt,omitempty"`
+	DisplayName      *string  `protobuf:"bytes,5,opt,name=DisplayName" json:"DisplayName,omitempty"`
+	Bio              *string  `protobuf:"bytes,6,opt,name=Bio" json:"Bio,omitempty"`
+	AvatarURL        *string  `protobuf:"bytes,7,opt,name=AvatarURL" json:"AvatarURL,omitempty"`
+	Locale           *string  `protobuf:"bytes,8,opt,name=Locale" json:"Locale,omitempty"`
+	Email            *string  `protobuf:"bytes,9,opt,name=Email" json:"Email,omitempty"`
+	Status           *int64   `protobuf:"varint,10,opt,name=Status" json:"Status,omitempty"`
+	StatusReason     *string  `protobuf:"bytes,11,opt,name=StatusReason" json:"StatusReason,omitempty"`
+	StatusChangedAt  *int64   `protobuf:"varint,12,opt,name=StatusChangedAt" json:"StatusChangedAt,omitempty"`
+	XXX_unrecognized []byte   `json:"-"`
 }
 
 func (m *User) Reset()                    { *m = User{} }
@@ -51,16 +82,1269 @@ func (m *User) GetUsername() string {
 	return ""
 }
 
+func (m *User) GetTags() []string {
+	if m != nil {
+		return m.Tags
+	}
+	return nil
+}
+
+func (m *User) GetCreatedAt() int64 {
+	if m != nil && m.CreatedAt != nil {
+		return *m.CreatedAt
+	}
+	return 0
+}
+
+func (m *User) GetDisplayName() string {
+	if m != nil && m.DisplayName != nil {
+		return *m.DisplayName
+	}
+	return ""
+}
+
+func (m *User) GetBio() string {
+	if m != nil && m.Bio != nil {
+		return *m.Bio
+	}
+	return ""
+}
+
+func (m *User) GetAvatarURL() string {
+	if m != nil && m.AvatarURL != nil {
+		return *m.AvatarURL
+	}
+	return ""
+}
+
+func (m *User) GetLocale() string {
+	if m != nil && m.Locale != nil {
+		return *m.Locale
+	}
+	return ""
+}
+
+func (m *User) GetEmail() string {
+	if m != nil && m.Email != nil {
+		return *m.Email
+	}
+	return ""
+}
+
+func (m *User) GetStatus() int64 {
+	if m != nil && m.Status != nil {
+		return *m.Status
+	}
+	return 0
+}
+
+func (m *User) GetStatusReason() string {
+	if m != nil && m.StatusReason != nil {
+		return *m.StatusReason
+	}
+	return ""
+}
+
+func (m *User) GetStatusChangedAt() int64 {
+	if m != nil && m.StatusChangedAt != nil {
+		return *m.StatusChangedAt
+	}
+	return 0
+}
+
+type APIKey struct {
+	ID               *int64   `protobuf:"varint,1,opt,name=ID" json:"ID,omitempty"`
+	Name             *string  `protobuf:"bytes,2,opt,name=Name" json:"Name,omitempty"`
+	Hash             []byte   `protobuf:"bytes,3,opt,name=Hash" json:"Hash,omitempty"`
+	Scopes           []string `protobuf:"bytes,4,rep,name=Scopes" json:"Scopes,omitempty"`
+	ExpiresAt        *int64   `protobuf:"varint,5,opt,name=ExpiresAt" json:"ExpiresAt,omitempty"`
+	CreatedAt        *int64   `protobuf:"varint,6,opt,name=CreatedAt" json:"CreatedAt,omitempty"`
+	XXX_unrecognized []byte   `json:"-"`
+}
+
+func (m *APIKey) Reset()                    { *m = APIKey{} }
+func (m *APIKey) String() string            { return proto.CompactTextString(m) }
+func (*APIKey) ProtoMessage()               {}
+func (*APIKey) Descriptor() ([]byte, []int) { return fileDescriptorInternal, []int{1} }
+
+func (m *APIKey) GetID() int64 {
+	if m != nil && m.ID != nil {
+		return *m.ID
+	}
+	return 0
+}
+
+func (m *APIKey) GetName() string {
+	if m != nil && m.Name != nil {
+		return *m.Name
+	}
+	return ""
+}
+
+func (m *APIKey) GetHash() []byte {
+	if m != nil {
+		return m.Hash
+	}
+	return nil
+}
+
+func (m *APIKey) GetScopes() []string {
+	if m != nil {
+		return m.Scopes
+	}
+	return nil
+}
+
+func (m *APIKey) GetExpiresAt() int64 {
+	if m != nil && m.ExpiresAt != nil {
+		return *m.ExpiresAt
+	}
+	return 0
+}
+
+func (m *APIKey) GetCreatedAt() int64 {
+	if m != nil && m.CreatedAt != nil {
+		return *m.CreatedAt
+	}
+	return 0
+}
+
+type IdempotencyRecord struct {
+	UserID           *int64 `protobuf:"varint,1,opt,name=UserID" json:"UserID,omitempty"`
+	ExpiresAt        *int64 `protobuf:"varint,2,opt,name=ExpiresAt" json:"ExpiresAt,omitempty"`
+	XXX_unrecognized []byte `json:"-"`
+}
+
+func (m *IdempotencyRecord) Reset()                    { *m = IdempotencyRecord{} }
+func (m *IdempotencyRecord) String() string            { return proto.CompactTextString(m) }
+func (*IdempotencyRecord) ProtoMessage()               {}
+func (*IdempotencyRecord) Descriptor() ([]byte, []int) { return fileDescriptorInternal, []int{2} }
+
+func (m *IdempotencyRecord) GetUserID() int64 {
+	if m != nil && m.UserID != nil {
+		return *m.UserID
+	}
+	return 0
+}
+
+func (m *IdempotencyRecord) GetExpiresAt() int64 {
+	if m != nil && m.ExpiresAt != nil {
+		return *m.ExpiresAt
+	}
+	return 0
+}
+
+type Manifest struct {
+	CreatedAt        *int64   `protobuf:"varint,1,opt,name=CreatedAt" json:"CreatedAt,omitempty"`
+	Size             *int64   `protobuf:"varint,2,opt,name=Size" json:"Size,omitempty"`
+	Chunks           [][]byte `protobuf:"bytes,3,rep,name=Chunks" json:"Chunks,omitempty"`
+	XXX_unrecognized []byte   `json:"-"`
+}
+
+func (m *Manifest) Reset()                    { *m = Manifest{} }
+func (m *Manifest) String() string            { return proto.CompactTextString(m) }
+func (*Manifest) ProtoMessage()               {}
+func (*Manifest) Descriptor() ([]byte, []int) { return fileDescriptorInternal, []int{3} }
+
+func (m *Manifest) GetCreatedAt() int64 {
+	if m != nil && m.CreatedAt != nil {
+		return *m.CreatedAt
+	}
+	return 0
+}
+
+func (m *Manifest) GetSize() int64 {
+	if m != nil && m.Size != nil {
+		return *m.Size
+	}
+	return 0
+}
+
+func (m *Manifest) GetChunks() [][]byte {
+	if m != nil {
+		return m.Chunks
+	}
+	return nil
+}
+
+type Blob struct {
+	Size             *int64 `protobuf:"varint,1,opt,name=Size" json:"Size,omitempty"`
+	Checksum         []byte `protobuf:"bytes,2,opt,name=Checksum" json:"Checksum,omitempty"`
+	CreatedAt        *int64 `protobuf:"varint,3,opt,name=CreatedAt" json:"CreatedAt,omitempty"`
+	XXX_unrecognized []byte `json:"-"`
+}
+
+func (m *Blob) Reset()                    { *m = Blob{} }
+func (m *Blob) String() string            { return proto.CompactTextString(m) }
+func (*Blob) ProtoMessage()               {}
+func (*Blob) Descriptor() ([]byte, []int) { return fileDescriptorInternal, []int{4} }
+
+func (m *Blob) GetSize() int64 {
+	if m != nil && m.Size != nil {
+		return *m.Size
+	}
+	return 0
+}
+
+func (m *Blob) GetChecksum() []byte {
+	if m != nil {
+		return m.Checksum
+	}
+	return nil
+}
+
+func (m *Blob) GetCreatedAt() int64 {
+	if m != nil && m.CreatedAt != nil {
+		return *m.CreatedAt
+	}
+	return 0
+}
+
+type Job struct {
+	ID               *int64  `protobuf:"varint,1,opt,name=ID" json:"ID,omitempty"`
+	Type             *string `protobuf:"bytes,2,opt,name=Type" json:"Type,omitempty"`
+	Payload          []byte  `protobuf:"bytes,3,opt,name=Payload" json:"Payload,omitempty"`
+	Attempts         *int64  `protobuf:"varint,4,opt,name=Attempts" json:"Attempts,omitempty"`
+	VisibleAt        *int64  `protobuf:"varint,5,opt,name=VisibleAt" json:"VisibleAt,omitempty"`
+	WorkerID         *string `protobuf:"bytes,6,opt,name=WorkerID" json:"WorkerID,omitempty"`
+	LastError        *string `protobuf:"bytes,7,opt,name=LastError" json:"LastError,omitempty"`
+	CreatedAt        *int64  `protobuf:"varint,8,opt,name=CreatedAt" json:"CreatedAt,omitempty"`
+	XXX_unrecognized []byte  `json:"-"`
+}
+
+func (m *Job) Reset()                    { *m = Job{} }
+func (m *Job) String() string            { return proto.CompactTextString(m) }
+func (*Job) ProtoMessage()               {}
+func (*Job) Descriptor() ([]byte, []int) { return fileDescriptorInternal, []int{5} }
+
+func (m *Job) GetID() int64 {
+	if m != nil && m.ID != nil {
+		return *m.ID
+	}
+	return 0
+}
+
+func (m *Job) GetType() string {
+	if m != nil && m.Type != nil {
+		return *m.Type
+	}
+	return ""
+}
+
+func (m *Job) GetPayload() []byte {
+	if m != nil {
+		return m.Payload
+	}
+	return nil
+}
+
+func (m *Job) GetAttempts() int64 {
+	if m != nil && m.Attempts != nil {
+		return *m.Attempts
+	}
+	return 0
+}
+
+func (m *Job) GetVisibleAt() int64 {
+	if m != nil && m.VisibleAt != nil {
+		return *m.VisibleAt
+	}
+	return 0
+}
+
+func (m *Job) GetWorkerID() string {
+	if m != nil && m.WorkerID != nil {
+		return *m.WorkerID
+	}
+	return ""
+}
+
+func (m *Job) GetLastError() string {
+	if m != nil && m.LastError != nil {
+		return *m.LastError
+	}
+	return ""
+}
+
+func (m *Job) GetCreatedAt() int64 {
+	if m != nil && m.CreatedAt != nil {
+		return *m.CreatedAt
+	}
+	return 0
+}
+
+type Event struct {
+	ID               *int64         `protobuf:"varint,1,opt,name=ID" json:"ID,omitempty"`
+	Type             *string        `protobuf:"bytes,2,opt,name=Type" json:"Type,omitempty"`
+	UserID           *int64         `protobuf:"varint,3,opt,name=UserID" json:"UserID,omitempty"`
+	Data             []byte         `protobuf:"bytes,4,opt,name=Data" json:"Data,omitempty"`
+	CreatedAt        *int64         `protobuf:"varint,5,opt,name=CreatedAt" json:"CreatedAt,omitempty"`
+	Changes          []*FieldChange `protobuf:"bytes,6,rep,name=Changes" json:"Changes,omitempty"`
+	XXX_unrecognized []byte         `json:"-"`
+}
+
+func (m *Event) Reset()                    { *m = Event{} }
+func (m *Event) String() string            { return proto.CompactTextString(m) }
+func (*Event) ProtoMessage()               {}
+func (*Event) Descriptor() ([]byte, []int) { return fileDescriptorInternal, []int{6} }
+
+func (m *Event) GetID() int64 {
+	if m != nil && m.ID != nil {
+		return *m.ID
+	}
+	return 0
+}
+
+func (m *Event) GetType() string {
+	if m != nil && m.Type != nil {
+		return *m.Type
+	}
+	return ""
+}
+
+func (m *Event) GetUserID() int64 {
+	if m != nil && m.UserID != nil {
+		return *m.UserID
+	}
+	return 0
+}
+
+func (m *Event) GetData() []byte {
+	if m != nil {
+		return m.Data
+	}
+	return nil
+}
+
+func (m *Event) GetCreatedAt() int64 {
+	if m != nil && m.CreatedAt != nil {
+		return *m.CreatedAt
+	}
+	return 0
+}
+
+func (m *Event) GetChanges() []*FieldChange {
+	if m != nil {
+		return m.Changes
+	}
+	return nil
+}
+
+type UserRevision struct {
+	Revision         *int64         `protobuf:"varint,1,opt,name=Revision" json:"Revision,omitempty"`
+	User             []byte         `protobuf:"bytes,2,opt,name=User" json:"User,omitempty"`
+	CreatedAt        *int64         `protobuf:"varint,3,opt,name=CreatedAt" json:"CreatedAt,omitempty"`
+	Changes          []*FieldChange `protobuf:"bytes,4,rep,name=Changes" json:"Changes,omitempty"`
+	XXX_unrecognized []byte         `json:"-"`
+}
+
+func (m *UserRevision) Reset()                    { *m = UserRevision{} }
+func (m *UserRevision) String() string            { return proto.CompactTextString(m) }
+func (*UserRevision) ProtoMessage()               {}
+func (*UserRevision) Descriptor() ([]byte, []int) { return fileDescriptorInternal, []int{7} }
+
+func (m *UserRevision) GetRevision() int64 {
+	if m != nil && m.Revision != nil {
+		return *m.Revision
+	}
+	return 0
+}
+
+func (m *UserRevision) GetUser() []byte {
+	if m != nil {
+		return m.User
+	}
+	return nil
+}
+
+func (m *UserRevision) GetCreatedAt() int64 {
+	if m != nil && m.CreatedAt != nil {
+		return *m.CreatedAt
+	}
+	return 0
+}
+
+func (m *UserRevision) GetChanges() []*FieldChange {
+	if m != nil {
+		return m.Changes
+	}
+	return nil
+}
+
+type FieldChange struct {
+	Field            *string `protobuf:"bytes,1,opt,name=Field" json:"Field,omitempty"`
+	Old              *string `protobuf:"bytes,2,opt,name=Old" json:"Old,omitempty"`
+	New              *string `protobuf:"bytes,3,opt,name=New" json:"New,omitempty"`
+	XXX_unrecognized []byte  `json:"-"`
+}
+
+func (m *FieldChange) Reset()                    { *m = FieldChange{} }
+func (m *FieldChange) String() string            { return proto.CompactTextString(m) }
+func (*FieldChange) ProtoMessage()               {}
+func (*FieldChange) Descriptor() ([]byte, []int) { return fileDescriptorInternal, []int{8} }
+
+func (m *FieldChange) GetField() string {
+	if m != nil && m.Field != nil {
+		return *m.Field
+	}
+	return ""
+}
+
+func (m *FieldChange) GetOld() string {
+	if m != nil && m.Old != nil {
+		return *m.Old
+	}
+	return ""
+}
+
+func (m *FieldChange) GetNew() string {
+	if m != nil && m.New != nil {
+		return *m.New
+	}
+	return ""
+}
+
+type TOTP struct {
+	Secret           []byte   `protobuf:"bytes,1,opt,name=Secret" json:"Secret,omitempty"`
+	RecoveryCodes    [][]byte `protobuf:"bytes,2,rep,name=RecoveryCodes" json:"RecoveryCodes,omitempty"`
+	LastCounter      *int64   `protobuf:"varint,3,opt,name=LastCounter" json:"LastCounter,omitempty"`
+	CreatedAt        *int64   `protobuf:"varint,4,opt,name=CreatedAt" json:"CreatedAt,omitempty"`
+	XXX_unrecognized []byte   `json:"-"`
+}
+
+func (m *TOTP) Reset()                    { *m = TOTP{} }
+func (m *TOTP) String() string            { return proto.CompactTextString(m) }
+func (*TOTP) ProtoMessage()               {}
+func (*TOTP) Descriptor() ([]byte, []int) { return fileDescriptorInternal, []int{9} }
+
+func (m *TOTP) GetSecret() []byte {
+	if m != nil {
+		return m.Secret
+	}
+	return nil
+}
+
+func (m *TOTP) GetRecoveryCodes() [][]byte {
+	if m != nil {
+		return m.RecoveryCodes
+	}
+	return nil
+}
+
+func (m *TOTP) GetLastCounter() int64 {
+	if m != nil && m.LastCounter != nil {
+		return *m.LastCounter
+	}
+	return 0
+}
+
+func (m *TOTP) GetCreatedAt() int64 {
+	if m != nil && m.CreatedAt != nil {
+		return *m.CreatedAt
+	}
+	return 0
+}
+
+type Identity struct {
+	UserID           *int64  `protobuf:"varint,1,opt,name=UserID" json:"UserID,omitempty"`
+	Provider         *string `protobuf:"bytes,2,opt,name=Provider" json:"Provider,omitempty"`
+	Subject          *string `protobuf:"bytes,3,opt,name=Subject" json:"Subject,omitempty"`
+	CreatedAt        *int64  `protobuf:"varint,4,opt,name=CreatedAt" json:"CreatedAt,omitempty"`
+	XXX_unrecognized []byte  `json:"-"`
+}
+
+func (m *Identity) Reset()                    { *m = Identity{} }
+func (m *Identity) String() string            { return proto.CompactTextString(m) }
+func (*Identity) ProtoMessage()               {}
+func (*Identity) Descriptor() ([]byte, []int) { return fileDescriptorInternal, []int{10} }
+
+func (m *Identity) GetUserID() int64 {
+	if m != nil && m.UserID != nil {
+		return *m.UserID
+	}
+	return 0
+}
+
+func (m *Identity) GetProvider() string {
+	if m != nil && m.Provider != nil {
+		return *m.Provider
+	}
+	return ""
+}
+
+func (m *Identity) GetSubject() string {
+	if m != nil && m.Subject != nil {
+		return *m.Subject
+	}
+	return ""
+}
+
+func (m *Identity) GetCreatedAt() int64 {
+	if m != nil && m.CreatedAt != nil {
+		return *m.CreatedAt
+	}
+	return 0
+}
+
+type Password struct {
+	Salt             []byte `protobuf:"bytes,1,opt,name=Salt" json:"Salt,omitempty"`
+	Hash             []byte `protobuf:"bytes,2,opt,name=Hash" json:"Hash,omitempty"`
+	Iterations       *int64 `protobuf:"varint,3,opt,name=Iterations" json:"Iterations,omitempty"`
+	XXX_unrecognized []byte `json:"-"`
+}
+
+func (m *Password) Reset()                    { *m = Password{} }
+func (m *Password) String() string            { return proto.CompactTextString(m) }
+func (*Password) ProtoMessage()               {}
+func (*Password) Descriptor() ([]byte, []int) { return fileDescriptorInternal, []int{11} }
+
+func (m *Password) GetSalt() []byte {
+	if m != nil {
+		return m.Salt
+	}
+	return nil
+}
+
+func (m *Password) GetHash() []byte {
+	if m != nil {
+		return m.Hash
+	}
+	return nil
+}
+
+func (m *Password) GetIterations() int64 {
+	if m != nil && m.Iterations != nil {
+		return *m.Iterations
+	}
+	return 0
+}
+
+type Invite struct {
+	Email            *string `protobuf:"bytes,1,opt,name=Email" json:"Email,omitempty"`
+	InvitedBy        *int64  `protobuf:"varint,2,opt,name=InvitedBy" json:"InvitedBy,omitempty"`
+	ExpiresAt        *int64  `protobuf:"varint,3,opt,name=ExpiresAt" json:"ExpiresAt,omitempty"`
+	CreatedAt        *int64  `protobuf:"varint,4,opt,name=CreatedAt" json:"CreatedAt,omitempty"`
+	XXX_unrecognized []byte  `json:"-"`
+}
+
+func (m *Invite) Reset()                    { *m = Invite{} }
+func (m *Invite) String() string            { return proto.CompactTextString(m) }
+func (*Invite) ProtoMessage()               {}
+func (*Invite) Descriptor() ([]byte, []int) { return fileDescriptorInternal, []int{12} }
+
+func (m *Invite) GetEmail() string {
+	if m != nil && m.Email != nil {
+		return *m.Email
+	}
+	return ""
+}
+
+func (m *Invite) GetInvitedBy() int64 {
+	if m != nil && m.InvitedBy != nil {
+		return *m.InvitedBy
+	}
+	return 0
+}
+
+func (m *Invite) GetExpiresAt() int64 {
+	if m != nil && m.ExpiresAt != nil {
+		return *m.ExpiresAt
+	}
+	return 0
+}
+
+func (m *Invite) GetCreatedAt() int64 {
+	if m != nil && m.CreatedAt != nil {
+		return *m.CreatedAt
+	}
+	return 0
+}
+
+type Erasure struct {
+	UserID           *int64 `protobuf:"varint,1,opt,name=UserID" json:"UserID,omitempty"`
+	Records          *int64 `protobuf:"varint,2,opt,name=Records" json:"Records,omitempty"`
+	ErasedAt         *int64 `protobuf:"varint,3,opt,name=ErasedAt" json:"ErasedAt,omitempty"`
+	XXX_unrecognized []byte `json:"-"`
+}
+
+func (m *Erasure) Reset()                    { *m = Erasure{} }
+func (m *Erasure) String() string            { return proto.CompactTextString(m) }
+func (*Erasure) ProtoMessage()               {}
+func (*Erasure) Descriptor() ([]byte, []int) { return fileDescriptorInternal, []int{13} }
+
+func (m *Erasure) GetUserID() int64 {
+	if m != nil && m.UserID != nil {
+		return *m.UserID
+	}
+	return 0
+}
+
+func (m *Erasure) GetRecords() int64 {
+	if m != nil && m.Records != nil {
+		return *m.Records
+	}
+	return 0
+}
+
+func (m *Erasure) GetErasedAt() int64 {
+	if m != nil && m.ErasedAt != nil {
+		return *m.ErasedAt
+	}
+	return 0
+}
+
+type Flag struct {
+	Name             *string `protobuf:"bytes,1,opt,name=Name" json:"Name,omitempty"`
+	Enabled          *bool   `protobuf:"varint,2,opt,name=Enabled" json:"Enabled,omitempty"`
+	Percentage       *int64  `protobuf:"varint,3,opt,name=Percentage" json:"Percentage,omitempty"`
+	EnabledUsers     []int64 `protobuf:"varint,4,rep,name=EnabledUsers" json:"EnabledUsers,omitempty"`
+	DisabledUsers    []int64 `protobuf:"varint,5,rep,name=DisabledUsers" json:"DisabledUsers,omitempty"`
+	UpdatedAt        *int64  `protobuf:"varint,6,opt,name=UpdatedAt" json:"UpdatedAt,omitempty"`
+	XXX_unrecognized []byte  `json:"-"`
+}
+
+func (m *Flag) Reset()                    { *m = Flag{} }
+func (m *Flag) String() string            { return proto.CompactTextString(m) }
+func (*Flag) ProtoMessage()               {}
+func (*Flag) Descriptor() ([]byte, []int) { return fileDescriptorInternal, []int{14} }
+
+func (m *Flag) GetName() string {
+	if m != nil && m.Name != nil {
+		return *m.Name
+	}
+	return ""
+}
+
+func (m *Flag) GetEnabled() bool {
+	if m != nil && m.Enabled != nil {
+		return *m.Enabled
+	}
+	return false
+}
+
+func (m *Flag) GetPercentage() int64 {
+	if m != nil && m.Percentage != nil {
+		return *m.Percentage
+	}
+	return 0
+}
+
+func (m *Flag) GetEnabledUsers() []int64 {
+	if m != nil {
+		return m.EnabledUsers
+	}
+	return nil
+}
+
+func (m *Flag) GetDisabledUsers() []int64 {
+	if m != nil {
+		return m.DisabledUsers
+	}
+	return nil
+}
+
+func (m *Flag) GetUpdatedAt() int64 {
+	if m != nil && m.UpdatedAt != nil {
+		return *m.UpdatedAt
+	}
+	return 0
+}
+
+type Webhook struct {
+	ID               *int64   `protobuf:"varint,1,opt,name=ID" json:"ID,omitempty"`
+	URL              *string  `protobuf:"bytes,2,opt,name=URL" json:"URL,omitempty"`
+	Secret           *string  `protobuf:"bytes,3,opt,name=Secret" json:"Secret,omitempty"`
+	Events           []string `protobuf:"bytes,4,rep,name=Events" json:"Events,omitempty"`
+	CreatedAt        *int64   `protobuf:"varint,5,opt,name=CreatedAt" json:"CreatedAt,omitempty"`
+	EncryptedSecret  []byte   `protobuf:"bytes,6,opt,name=EncryptedSecret" json:"EncryptedSecret,omitempty"`
+	XXX_unrecognized []byte   `json:"-"`
+}
+
+func (m *Webhook) Reset()                    { *m = Webhook{} }
+func (m *Webhook) String() string            { return proto.CompactTextString(m) }
+func (*Webhook) ProtoMessage()               {}
+func (*Webhook) Descriptor() ([]byte, []int) { return fileDescriptorInternal, []int{15} }
+
+func (m *Webhook) GetID() int64 {
+	if m != nil && m.ID != nil {
+		return *m.ID
+	}
+	return 0
+}
+
+func (m *Webhook) GetURL() string {
+	if m != nil && m.URL != nil {
+		return *m.URL
+	}
+	return ""
+}
+
+func (m *Webhook) GetSecret() string {
+	if m != nil && m.Secret != nil {
+		return *m.Secret
+	}
+	return ""
+}
+
+func (m *Webhook) GetEvents() []string {
+	if m != nil {
+		return m.Events
+	}
+	return nil
+}
+
+func (m *Webhook) GetCreatedAt() int64 {
+	if m != nil && m.CreatedAt != nil {
+		return *m.CreatedAt
+	}
+	return 0
+}
+
+func (m *Webhook) GetEncryptedSecret() []byte {
+	if m != nil {
+		return m.EncryptedSecret
+	}
+	return nil
+}
+
+type WebhookDelivery struct {
+	ID               *int64  `protobuf:"varint,1,opt,name=ID" json:"ID,omitempty"`
+	WebhookID        *int64  `protobuf:"varint,2,opt,name=WebhookID" json:"WebhookID,omitempty"`
+	EventID          *int64  `protobuf:"varint,3,opt,name=EventID" json:"EventID,omitempty"`
+	EventType        *string `protobuf:"bytes,4,opt,name=EventType" json:"EventType,omitempty"`
+	Payload          []byte  `protobuf:"bytes,5,opt,name=Payload" json:"Payload,omitempty"`
+	Status           *string `protobuf:"bytes,6,opt,name=Status" json:"Status,omitempty"`
+	Attempts         *int64  `protobuf:"varint,7,opt,name=Attempts" json:"Attempts,omitempty"`
+	NextAttemptAt    *int64  `protobuf:"varint,8,opt,name=NextAttemptAt" json:"NextAttemptAt,omitempty"`
+	LastError        *string `protobuf:"bytes,9,opt,name=LastError" json:"LastError,omitempty"`
+	ResponseCode     *int64  `protobuf:"varint,10,opt,name=ResponseCode" json:"ResponseCode,omitempty"`
+	CreatedAt        *int64  `protobuf:"varint,11,opt,name=CreatedAt" json:"CreatedAt,omitempty"`
+	UpdatedAt        *int64  `protobuf:"varint,12,opt,name=UpdatedAt" json:"UpdatedAt,omitempty"`
+	XXX_unrecognized []byte  `json:"-"`
+}
+
+func (m *WebhookDelivery) Reset()                    { *m = WebhookDelivery{} }
+func (m *WebhookDelivery) String() string            { return proto.CompactTextString(m) }
+func (*WebhookDelivery) ProtoMessage()               {}
+func (*WebhookDelivery) Descriptor() ([]byte, []int) { return fileDescriptorInternal, []int{16} }
+
+func (m *WebhookDelivery) GetID() int64 {
+	if m != nil && m.ID != nil {
+		return *m.ID
+	}
+	return 0
+}
+
+func (m *WebhookDelivery) GetWebhookID() int64 {
+	if m != nil && m.WebhookID != nil {
+		return *m.WebhookID
+	}
+	return 0
+}
+
+func (m *WebhookDelivery) GetEventID() int64 {
+	if m != nil && m.EventID != nil {
+		return *m.EventID
+	}
+	return 0
+}
+
+func (m *WebhookDelivery) GetEventType() string {
+	if m != nil && m.EventType != nil {
+		return *m.EventType
+	}
+	return ""
+}
+
+func (m *WebhookDelivery) GetPayload() []byte {
+	if m != nil {
+		return m.Payload
+	}
+	return nil
+}
+
+func (m *WebhookDelivery) GetStatus() string {
+	if m != nil && m.Status != nil {
+		return *m.Status
+	}
+	return ""
+}
+
+func (m *WebhookDelivery) GetAttempts() int64 {
+	if m != nil && m.Attempts != nil {
+		return *m.Attempts
+	}
+	return 0
+}
+
+func (m *WebhookDelivery) GetNextAttemptAt() int64 {
+	if m != nil && m.NextAttemptAt != nil {
+		return *m.NextAttemptAt
+	}
+	return 0
+}
+
+func (m *WebhookDelivery) GetLastError() string {
+	if m != nil && m.LastError != nil {
+		return *m.LastError
+	}
+	return ""
+}
+
+func (m *WebhookDelivery) GetResponseCode() int64 {
+	if m != nil && m.ResponseCode != nil {
+		return *m.ResponseCode
+	}
+	return 0
+}
+
+func (m *WebhookDelivery) GetCreatedAt() int64 {
+	if m != nil && m.CreatedAt != nil {
+		return *m.CreatedAt
+	}
+	return 0
+}
+
+func (m *WebhookDelivery) GetUpdatedAt() int64 {
+	if m != nil && m.UpdatedAt != nil {
+		return *m.UpdatedAt
+	}
+	return 0
+}
+
+type Email struct {
+	ID               *int64  `protobuf:"varint,1,opt,name=ID" json:"ID,omitempty"`
+	To               *string `protobuf:"bytes,2,opt,name=To" json:"To,omitempty"`
+	Template         *string `protobuf:"bytes,3,opt,name=Template" json:"Template,omitempty"`
+	Subject          *string `protobuf:"bytes,4,opt,name=Subject" json:"Subject,omitempty"`
+	Body             *string `protobuf:"bytes,5,opt,name=Body" json:"Body,omitempty"`
+	Status           *string `protobuf:"bytes,6,opt,name=Status" json:"Status,omitempty"`
+	Attempts         *int64  `protobuf:"varint,7,opt,name=Attempts" json:"Attempts,omitempty"`
+	NextAttemptAt    *int64  `protobuf:"varint,8,opt,name=NextAttemptAt" json:"NextAttemptAt,omitempty"`
+	LastError        *string `protobuf:"bytes,9,opt,name=LastError" json:"LastError,omitempty"`
+	CreatedAt        *int64  `protobuf:"varint,10,opt,name=CreatedAt" json:"CreatedAt,omitempty"`
+	UpdatedAt        *int64  `protobuf:"varint,11,opt,name=UpdatedAt" json:"UpdatedAt,omitempty"`
+	XXX_unrecognized []byte  `json:"-"`
+}
+
+func (m *Email) Reset()                    { *m = Email{} }
+func (m *Email) String() string            { return proto.CompactTextString(m) }
+func (*Email) ProtoMessage()               {}
+func (*Email) Descriptor() ([]byte, []int) { return fileDescriptorInternal, []int{17} }
+
+func (m *Email) GetID() int64 {
+	if m != nil && m.ID != nil {
+		return *m.ID
+	}
+	return 0
+}
+
+func (m *Email) GetTo() string {
+	if m != nil && m.To != nil {
+		return *m.To
+	}
+	return ""
+}
+
+func (m *Email) GetTemplate() string {
+	if m != nil && m.Template != nil {
+		return *m.Template
+	}
+	return ""
+}
+
+func (m *Email) GetSubject() string {
+	if m != nil && m.Subject != nil {
+		return *m.Subject
+	}
+	return ""
+}
+
+func (m *Email) GetBody() string {
+	if m != nil && m.Body != nil {
+		return *m.Body
+	}
+	return ""
+}
+
+func (m *Email) GetStatus() string {
+	if m != nil && m.Status != nil {
+		return *m.Status
+	}
+	return ""
+}
+
+func (m *Email) GetAttempts() int64 {
+	if m != nil && m.Attempts != nil {
+		return *m.Attempts
+	}
+	return 0
+}
+
+func (m *Email) GetNextAttemptAt() int64 {
+	if m != nil && m.NextAttemptAt != nil {
+		return *m.NextAttemptAt
+	}
+	return 0
+}
+
+func (m *Email) GetLastError() string {
+	if m != nil && m.LastError != nil {
+		return *m.LastError
+	}
+	return ""
+}
+
+func (m *Email) GetCreatedAt() int64 {
+	if m != nil && m.CreatedAt != nil {
+		return *m.CreatedAt
+	}
+	return 0
+}
+
+func (m *Email) GetUpdatedAt() int64 {
+	if m != nil && m.UpdatedAt != nil {
+		return *m.UpdatedAt
+	}
+	return 0
+}
+
+type PasswordReset struct {
+	UserID           *int64 `protobuf:"varint,1,opt,name=UserID" json:"UserID,omitempty"`
+	ExpiresAt        *int64 `protobuf:"varint,2,opt,name=ExpiresAt" json:"ExpiresAt,omitempty"`
+	CreatedAt        *int64 `protobuf:"varint,3,opt,name=CreatedAt" json:"CreatedAt,omitempty"`
+	XXX_unrecognized []byte `json:"-"`
+}
+
+func (m *PasswordReset) Reset()                    { *m = PasswordReset{} }
+func (m *PasswordReset) String() string            { return proto.CompactTextString(m) }
+func (*PasswordReset) ProtoMessage()               {}
+func (*PasswordReset) Descriptor() ([]byte, []int) { return fileDescriptorInternal, []int{18} }
+
+func (m *PasswordReset) GetUserID() int64 {
+	if m != nil && m.UserID != nil {
+		return *m.UserID
+	}
+	return 0
+}
+
+func (m *PasswordReset) GetExpiresAt() int64 {
+	if m != nil && m.ExpiresAt != nil {
+		return *m.ExpiresAt
+	}
+	return 0
+}
+
+func (m *PasswordReset) GetCreatedAt() int64 {
+	if m != nil && m.CreatedAt != nil {
+		return *m.CreatedAt
+	}
+	return 0
+}
+
+type Schedule struct {
+	Name             *string `protobuf:"bytes,1,opt,name=Name" json:"Name,omitempty"`
+	Spec             *string `protobuf:"bytes,2,opt,name=Spec" json:"Spec,omitempty"`
+	Task             *string `protobuf:"bytes,3,opt,name=Task" json:"Task,omitempty"`
+	Arg              *string `protobuf:"bytes,4,opt,name=Arg" json:"Arg,omitempty"`
+	Missed           *int64  `protobuf:"varint,5,opt,name=Missed" json:"Missed,omitempty"`
+	NextRunAt        *int64  `protobuf:"varint,6,opt,name=NextRunAt" json:"NextRunAt,omitempty"`
+	LastRunAt        *int64  `protobuf:"varint,7,opt,name=LastRunAt" json:"LastRunAt,omitempty"`
+	LastError        *string `protobuf:"bytes,8,opt,name=LastError" json:"LastError,omitempty"`
+	XXX_unrecognized []byte  `json:"-"`
+}
+
+func (m *Schedule) Reset()                    { *m = Schedule{} }
+func (m *Schedule) String() string            { return proto.CompactTextString(m) }
+func (*Schedule) ProtoMessage()               {}
+func (*Schedule) Descriptor() ([]byte, []int) { return fileDescriptorInternal, []int{19} }
+
+func (m *Schedule) GetName() string {
+	if m != nil && m.Name != nil {
+		return *m.Name
+	}
+	return ""
+}
+
+func (m *Schedule) GetSpec() string {
+	if m != nil && m.Spec != nil {
+		return *m.Spec
+	}
+	return ""
+}
+
+func (m *Schedule) GetTask() string {
+	if m != nil && m.Task != nil {
+		return *m.Task
+	}
+	return ""
+}
+
+func (m *Schedule) GetArg() string {
+	if m != nil && m.Arg != nil {
+		return *m.Arg
+	}
+	return ""
+}
+
+func (m *Schedule) GetMissed() int64 {
+	if m != nil && m.Missed != nil {
+		return *m.Missed
+	}
+	return 0
+}
+
+func (m *Schedule) GetNextRunAt() int64 {
+	if m != nil && m.NextRunAt != nil {
+		return *m.NextRunAt
+	}
+	return 0
+}
+
+func (m *Schedule) GetLastRunAt() int64 {
+	if m != nil && m.LastRunAt != nil {
+		return *m.LastRunAt
+	}
+	return 0
+}
+
+func (m *Schedule) GetLastError() string {
+	if m != nil && m.LastError != nil {
+		return *m.LastError
+	}
+	return ""
+}
+
+type Lease struct {
+	Name             *string `protobuf:"bytes,1,opt,name=Name" json:"Name,omitempty"`
+	Token            *int64  `protobuf:"varint,2,opt,name=Token" json:"Token,omitempty"`
+	TTL              *int64  `protobuf:"varint,3,opt,name=TTL" json:"TTL,omitempty"`
+	AcquiredAt       *int64  `protobuf:"varint,4,opt,name=AcquiredAt" json:"AcquiredAt,omitempty"`
+	ExpiresAt        *int64  `protobuf:"varint,5,opt,name=ExpiresAt" json:"ExpiresAt,omitempty"`
+	XXX_unrecognized []byte  `json:"-"`
+}
+
+func (m *Lease) Reset()                    { *m = Lease{} }
+func (m *Lease) String() string            { return proto.CompactTextString(m) }
+func (*Lease) ProtoMessage()               {}
+func (*Lease) Descriptor() ([]byte, []int) { return fileDescriptorInternal, []int{20} }
+
+func (m *Lease) GetName() string {
+	if m != nil && m.Name != nil {
+		return *m.Name
+	}
+	return ""
+}
+
+func (m *Lease) GetToken() int64 {
+	if m != nil && m.Token != nil {
+		return *m.Token
+	}
+	return 0
+}
+
+func (m *Lease) GetTTL() int64 {
+	if m != nil && m.TTL != nil {
+		return *m.TTL
+	}
+	return 0
+}
+
+func (m *Lease) GetAcquiredAt() int64 {
+	if m != nil && m.AcquiredAt != nil {
+		return *m.AcquiredAt
+	}
+	return 0
+}
+
+func (m *Lease) GetExpiresAt() int64 {
+	if m != nil && m.ExpiresAt != nil {
+		return *m.ExpiresAt
+	}
+	return 0
+}
+
+type ImportJob struct {
+	Name             *string `protobuf:"bytes,1,opt,name=Name" json:"Name,omitempty"`
+	Format           *string `protobuf:"bytes,2,opt,name=Format" json:"Format,omitempty"`
+	Offset           *int64  `protobuf:"varint,3,opt,name=Offset" json:"Offset,omitempty"`
+	Row              *int64  `protobuf:"varint,4,opt,name=Row" json:"Row,omitempty"`
+	Created          *int64  `protobuf:"varint,5,opt,name=Created" json:"Created,omitempty"`
+	Failed           *int64  `protobuf:"varint,6,opt,name=Failed" json:"Failed,omitempty"`
+	LastError        *string `protobuf:"bytes,7,opt,name=LastError" json:"LastError,omitempty"`
+	StartedAt        *int64  `protobuf:"varint,8,opt,name=StartedAt" json:"StartedAt,omitempty"`
+	UpdatedAt        *int64  `protobuf:"varint,9,opt,name=UpdatedAt" json:"UpdatedAt,omitempty"`
+	CompletedAt      *int64  `protobuf:"varint,10,opt,name=CompletedAt" json:"CompletedAt,omitempty"`
+	XXX_unrecognized []byte  `json:"-"`
+}
+
+func (m *ImportJob) Reset()                    { *m = ImportJob{} }
+func (m *ImportJob) String() string            { return proto.CompactTextString(m) }
+func (*ImportJob) ProtoMessage()               {}
+func (*ImportJob) Descriptor() ([]byte, []int) { return fileDescriptorInternal, []int{21} }
+
+func (m *ImportJob) GetName() string {
+	if m != nil && m.Name != nil {
+		return *m.Name
+	}
+	return ""
+}
+
+func (m *ImportJob) GetFormat() string {
+	if m != nil && m.Format != nil {
+		return *m.Format
+	}
+	return ""
+}
+
+func (m *ImportJob) GetOffset() int64 {
+	if m != nil && m.Offset != nil {
+		return *m.Offset
+	}
+	return 0
+}
+
+func (m *ImportJob) GetRow() int64 {
+	if m != nil && m.Row != nil {
+		return *m.Row
+	}
+	return 0
+}
+
+func (m *ImportJob) GetCreated() int64 {
+	if m != nil && m.Created != nil {
+		return *m.Created
+	}
+	return 0
+}
+
+func (m *ImportJob) GetFailed() int64 {
+	if m != nil && m.Failed != nil {
+		return *m.Failed
+	}
+	return 0
+}
+
+func (m *ImportJob) GetLastError() string {
+	if m != nil && m.LastError != nil {
+		return *m.LastError
+	}
+	return ""
+}
+
+func (m *ImportJob) GetStartedAt() int64 {
+	if m != nil && m.StartedAt != nil {
+		return *m.StartedAt
+	}
+	return 0
+}
+
+func (m *ImportJob) GetUpdatedAt() int64 {
+	if m != nil && m.UpdatedAt != nil {
+		return *m.UpdatedAt
+	}
+	return 0
+}
+
+func (m *ImportJob) GetCompletedAt() int64 {
+	if m != nil && m.CompletedAt != nil {
+		return *m.CompletedAt
+	}
+	return 0
+}
+
 func init() {
 	proto.RegisterType((*User)(nil), "internal.User")
+	proto.RegisterType((*APIKey)(nil), "internal.APIKey")
+	proto.RegisterType((*IdempotencyRecord)(nil), "internal.IdempotencyRecord")
+	proto.RegisterType((*Manifest)(nil), "internal.Manifest")
+	proto.RegisterType((*Blob)(nil), "internal.Blob")
+	proto.RegisterType((*Job)(nil), "internal.Job")
+	proto.RegisterType((*Event)(nil), "internal.Event")
+	proto.RegisterType((*UserRevision)(nil), "internal.UserRevision")
+	proto.RegisterType((*FieldChange)(nil), "internal.FieldChange")
+	proto.RegisterType((*TOTP)(nil), "internal.TOTP")
+	proto.RegisterType((*Identity)(nil), "internal.Identity")
+	proto.RegisterType((*Password)(nil), "internal.Password")
+	proto.RegisterType((*Invite)(nil), "internal.Invite")
+	proto.RegisterType((*Erasure)(nil), "internal.Erasure")
+	proto.RegisterType((*Flag)(nil), "internal.Flag")
+	proto.RegisterType((*Webhook)(nil), "internal.Webhook")
+	proto.RegisterType((*WebhookDelivery)(nil), "internal.WebhookDelivery")
+	proto.RegisterType((*Email)(nil), "internal.Email")
+	proto.RegisterType((*PasswordReset)(nil), "internal.PasswordReset")
+	proto.RegisterType((*Schedule)(nil), "internal.Schedule")
+	proto.RegisterType((*Lease)(nil), "internal.Lease")
+	proto.RegisterType((*ImportJob)(nil), "internal.ImportJob")
 }
 
 var fileDescriptorInternal = []byte{
-	// 81 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x09, 0x6e, 0x88, 0x02, 0xff, 0xe2, 0x12, 0xcf, 0xcc, 0x2b, 0x49,
-	0x2d, 0xca, 0x4b, 0xcc, 0xd1, 0x87, 0x31, 0xf4, 0x0a, 0x8a, 0xf2, 0x4b, 0xf2, 0x85, 0x38, 0x60,
-	0x7c, 0x25, 0x15, 0x2e, 0x96, 0xd0, 0xe2, 0xd4, 0x22, 0x21, 0x2e, 0x2e, 0x26, 0x4f, 0x17, 0x09,
-	0x46, 0x05, 0x46, 0x0d, 0x66, 0x21, 0x01, 0x2e, 0x0e, 0x90, 0x58, 0x5e, 0x62, 0x6e, 0xaa, 0x04,
-	0x13, 0x50, 0x84, 0x13, 0x10, 0x00, 0x00, 0xff, 0xff, 0xc2, 0x20, 0xb9, 0x77, 0x49, 0x00, 0x00,
-	0x00,
+	// 1066 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x09, 0x6e, 0x88, 0x02, 0xff, 0xac, 0x56, 0x4b, 0x6e, 0xe3, 0x46,
+	0x13, 0x06, 0x45, 0x4a, 0xa2, 0x4a, 0xf4, 0xe8, 0xf1, 0xdb, 0x30, 0x97, 0x02, 0x17, 0x3f, 0xbc,
+	0x9a, 0x00, 0x59, 0x0c, 0x90, 0xc7, 0x46, 0x96, 0x64, 0x44, 0x13, 0x8f, 0x2d, 0xc8, 0x72, 0x26,
+	0xdb, 0x16, 0x59, 0xb6, 0x3a, 0xa2, 0xd8, 0x4c, 0x77, 0x4b, 0x1e, 0xce, 0x11, 0x02, 0xe4, 0x38,
+	0xb9, 0x40, 0x4e, 0x91, 0x4b, 0xe4, 0x0e, 0x41, 0x37, 0x9b, 0x94, 0x28, 0xcd, 0x0c, 0xb2, 0xc8,
+	0x8e, 0xfd, 0xaa, 0xaa, 0xaf, 0xea, 0xfb, 0xaa, 0x08, 0x97, 0x34, 0x91, 0xc8, 0x13, 0x12, 0x7f,
+	0x55, 0x7c, 0xbc, 0x4e, 0x39, 0x93, 0xac, 0xef, 0x16, 0xeb, 0xe0, 0x2f, 0x0b, 0x9c, 0x47, 0x81,
+	0xbc, 0x0f, 0x50, 0x9b, 0x8e, 0x7d, 0x6b, 0x60, 0x5d, 0xd9, 0xfd, 0x2e, 0xb8, 0x6a, 0x2f, 0x21,
+	0x1b, 0xf4, 0x6b, 0x03, 0xeb, 0xaa, 0xd5, 0xf7, 0xc0, 0x59, 0x90, 0x67, 0xe1, 0xdb, 0x03, 0xfb,
+	0xaa, 0xd5, 0xef, 0x41, 0x6b, 0xc4, 0x91, 0x48, 0x8c, 0x86, 0xd2, 0x77, 0xf4, 0x93, 0xff, 0x41,
+	0x7b, 0x4c, 0x45, 0x1a, 0x93, 0xec, 0x4e, 0xbd, 0xaa, 0xeb, 0x57, 0x6d, 0xb0, 0xaf, 0x29, 0xf3,
+	0x1b, 0x7a, 0xd1, 0x83, 0xd6, 0x70, 0x47, 0x24, 0xe1, 0x8f, 0xf3, 0x5b, 0xbf, 0xa9, 0xb7, 0x5e,
+	0x41, 0xe3, 0x96, 0x85, 0x24, 0x46, 0xdf, 0xd5, 0xeb, 0x33, 0xa8, 0x4f, 0x36, 0x84, 0xc6, 0x7e,
+	0xab, 0x38, 0x7e, 0x90, 0x44, 0x6e, 0x85, 0x0f, 0xda, 0xc7, 0x39, 0x78, 0xf9, 0x7a, 0x8e, 0x44,
+	0xb0, 0xc4, 0x6f, 0xeb, 0x5b, 0x97, 0xd0, 0xc9, 0x77, 0x47, 0x2b, 0x92, 0x3c, 0xeb, 0x90, 0x3c,
+	0x75, 0x3d, 0x78, 0x82, 0xc6, 0x70, 0x36, 0xfd, 0x11, 0xb3, 0x0a, 0x36, 0x0f, 0x9c, 0xbb, 0x0a,
+	0xae, 0x1f, 0x88, 0x58, 0xf9, 0xf6, 0xc0, 0xba, 0xf2, 0xb4, 0xc3, 0x90, 0xa5, 0x28, 0x7c, 0xa7,
+	0xc0, 0x39, 0xf9, 0x90, 0x52, 0x8e, 0x62, 0x28, 0x35, 0x24, 0xbb, 0x0a, 0xbd, 0xa1, 0xfd, 0xbc,
+	0x81, 0xde, 0x34, 0xc2, 0x4d, 0xca, 0x24, 0x26, 0x61, 0x36, 0xc7, 0x90, 0xf1, 0x48, 0x99, 0x52,
+	0x29, 0x2c, 0xdd, 0x56, 0x4c, 0xd5, 0xf4, 0xbb, 0xef, 0xc0, 0x7d, 0x47, 0x12, 0xfa, 0x84, 0x42,
+	0x56, 0xcd, 0x96, 0x81, 0x3e, 0xd0, 0x8f, 0x79, 0xa0, 0xb6, 0xb2, 0x37, 0x5a, 0x6d, 0x93, 0x75,
+	0x5e, 0x02, 0x2f, 0xf8, 0x06, 0x9c, 0xeb, 0x98, 0x2d, 0xcb, 0x5b, 0x65, 0xe1, 0x46, 0x2b, 0x0c,
+	0xd7, 0x62, 0xbb, 0xd1, 0xef, 0xbc, 0xaa, 0x61, 0x5b, 0xfb, 0xfd, 0xdd, 0x02, 0xfb, 0x2d, 0x5b,
+	0x1e, 0x67, 0x65, 0x91, 0xa5, 0x45, 0x56, 0x3a, 0xd0, 0x9c, 0x91, 0x2c, 0x66, 0x24, 0x32, 0x89,
+	0xe9, 0x82, 0x3b, 0x94, 0x12, 0x37, 0xa9, 0x14, 0xa6, 0xde, 0x3d, 0x68, 0xfd, 0x44, 0x05, 0x5d,
+	0xc6, 0x58, 0xa6, 0xa6, 0x0b, 0xee, 0x7b, 0xc6, 0xd7, 0x1a, 0x74, 0x59, 0xf2, 0x5b, 0x22, 0xe4,
+	0x84, 0x73, 0xc6, 0x4d, 0xc9, 0x2b, 0xf1, 0xb8, 0x3a, 0x9e, 0x8f, 0x50, 0x9f, 0xec, 0x30, 0x91,
+	0x5f, 0x08, 0x68, 0x9f, 0x4d, 0xbb, 0x38, 0x1d, 0x13, 0x49, 0x7c, 0xe7, 0x14, 0x63, 0x1e, 0xcb,
+	0xff, 0xa1, 0x99, 0xd3, 0x41, 0xf8, 0x8d, 0x81, 0x7d, 0xd5, 0xfe, 0xfa, 0xe2, 0x75, 0x29, 0x81,
+	0x1b, 0x8a, 0x71, 0x94, 0x9f, 0x06, 0x14, 0x3c, 0x65, 0x78, 0x8e, 0x3b, 0x2a, 0x28, 0x4b, 0x14,
+	0x86, 0xe2, 0x7b, 0x1f, 0x88, 0xba, 0xf1, 0xd9, 0x74, 0x1e, 0xba, 0x72, 0xbe, 0xe4, 0xea, 0x0d,
+	0xb4, 0x0f, 0x96, 0x8a, 0xeb, 0x7a, 0xe9, 0x5b, 0x85, 0x54, 0xee, 0xe3, 0xc8, 0xc0, 0x6d, 0x83,
+	0x7d, 0x87, 0x2f, 0xda, 0x7e, 0x2b, 0x78, 0x04, 0x67, 0x71, 0xbf, 0x98, 0x69, 0x72, 0x62, 0xc8,
+	0x31, 0xe7, 0x87, 0xd7, 0xbf, 0x80, 0x33, 0xc5, 0xb5, 0x1d, 0xf2, 0x6c, 0xc4, 0x22, 0x14, 0x7e,
+	0x4d, 0x11, 0x43, 0x09, 0x51, 0xe5, 0x7c, 0xc4, 0xb6, 0x2a, 0x08, 0x13, 0xe3, 0xa9, 0x60, 0x83,
+	0x19, 0xb8, 0xd3, 0x08, 0x13, 0x49, 0x65, 0x76, 0x42, 0xd6, 0x2e, 0xb8, 0x33, 0xce, 0x76, 0x34,
+	0x42, 0xbe, 0x67, 0xc4, 0xc3, 0x76, 0xf9, 0x0b, 0x86, 0x39, 0xea, 0x4f, 0xb5, 0x80, 0xe0, 0x5b,
+	0x70, 0x67, 0x44, 0x88, 0x17, 0x45, 0x7f, 0x45, 0x4b, 0x12, 0x17, 0xa1, 0x16, 0x2a, 0xcb, 0x73,
+	0xd8, 0x07, 0x98, 0x4a, 0xe4, 0x44, 0x52, 0x96, 0x08, 0xc3, 0xc9, 0x19, 0x34, 0xa6, 0xc9, 0x8e,
+	0x4a, 0xdc, 0xf7, 0x00, 0xab, 0xf0, 0x93, 0x1f, 0x44, 0xd7, 0x99, 0x5f, 0x3b, 0x95, 0xd2, 0x67,
+	0xf1, 0x7d, 0x0f, 0xcd, 0x09, 0x27, 0x62, 0xcb, 0xf1, 0x04, 0x5e, 0x07, 0x9a, 0xb9, 0x4a, 0x85,
+	0xb1, 0xd8, 0x05, 0x57, 0xdd, 0x3d, 0xd0, 0x48, 0x06, 0xce, 0x4d, 0x4c, 0x9e, 0xcb, 0x6e, 0x61,
+	0x15, 0x59, 0x98, 0x24, 0x64, 0x19, 0x63, 0x5e, 0x28, 0x57, 0x41, 0x99, 0x21, 0x0f, 0x31, 0x91,
+	0xe4, 0x19, 0x4d, 0x2c, 0xe7, 0xe0, 0x99, 0x4b, 0xca, 0x69, 0x4e, 0x0a, 0x5b, 0x55, 0x6b, 0x4c,
+	0xc5, 0xc1, 0x76, 0x5d, 0x6f, 0xf7, 0xa0, 0xf5, 0x98, 0x46, 0x95, 0x76, 0x92, 0x40, 0xf3, 0x3d,
+	0x2e, 0x57, 0x8c, 0xad, 0x2b, 0x82, 0x68, 0x83, 0xad, 0x1a, 0x67, 0xa9, 0x07, 0xc3, 0x05, 0xbb,
+	0x58, 0x6b, 0x09, 0x1d, 0x34, 0xae, 0x63, 0x45, 0x5c, 0x42, 0x67, 0x92, 0x84, 0x3c, 0x4b, 0x25,
+	0x46, 0xe6, 0xad, 0xf2, 0xe7, 0x05, 0x7f, 0x5b, 0xd0, 0x31, 0x0e, 0xc7, 0x18, 0x53, 0xc5, 0xa7,
+	0x8a, 0xe3, 0x1e, 0xb4, 0xcc, 0xf1, 0x74, 0x6c, 0xf2, 0xa5, 0xf2, 0xa0, 0xdc, 0x95, 0x7a, 0x54,
+	0x25, 0x51, 0x1b, 0x5a, 0xb2, 0xce, 0x71, 0x0f, 0xa9, 0x97, 0xcd, 0x35, 0xef, 0xe6, 0x79, 0x73,
+	0x38, 0xec, 0x29, 0x4d, 0x6d, 0xe5, 0x02, 0xce, 0xee, 0xf0, 0x83, 0x34, 0xbb, 0x45, 0x7f, 0xa8,
+	0x76, 0x91, 0x7c, 0x32, 0x9c, 0x83, 0x37, 0x47, 0x91, 0xb2, 0x44, 0xa0, 0xe2, 0xbe, 0x99, 0x0f,
+	0x15, 0xd4, 0xed, 0x81, 0x75, 0x9c, 0xdf, 0x7c, 0x2c, 0xfc, 0x69, 0x19, 0x86, 0x55, 0x50, 0x02,
+	0xd4, 0x16, 0xcc, 0x64, 0xb7, 0x0b, 0xee, 0x02, 0x37, 0x69, 0x4c, 0x24, 0xfa, 0xf6, 0x31, 0xfd,
+	0x9d, 0x62, 0x6e, 0x5c, 0xb3, 0x28, 0x33, 0x73, 0xee, 0xbf, 0x84, 0x56, 0x01, 0x01, 0xa7, 0x20,
+	0x34, 0xae, 0x60, 0x02, 0x67, 0x85, 0xd6, 0xe6, 0x28, 0x50, 0xfe, 0x8b, 0x79, 0xf3, 0xa9, 0x51,
+	0xf0, 0x9b, 0x05, 0xee, 0x43, 0xb8, 0xc2, 0x68, 0x1b, 0xe3, 0x11, 0xd7, 0x95, 0x82, 0x53, 0x0c,
+	0x0f, 0xe7, 0xbf, 0x58, 0x9b, 0x74, 0xb4, 0xc1, 0x1e, 0xf2, 0x67, 0x93, 0x8a, 0x57, 0xd0, 0x78,
+	0x47, 0x85, 0xc0, 0x68, 0x3f, 0x21, 0x15, 0xd4, 0xf9, 0x36, 0x29, 0x28, 0x5d, 0xc0, 0xcc, 0xb7,
+	0x9a, 0xa7, 0xc8, 0xf5, 0xf4, 0x0f, 0x7e, 0x86, 0xfa, 0x2d, 0x12, 0x71, 0x1c, 0xc8, 0x19, 0xd4,
+	0x17, 0x6c, 0x8d, 0x89, 0x41, 0xd1, 0x06, 0x7b, 0xb1, 0xb8, 0x35, 0xbc, 0xeb, 0x03, 0x0c, 0xc3,
+	0x5f, 0xb7, 0x94, 0x1f, 0xfc, 0x89, 0x9c, 0x0e, 0xed, 0xe0, 0x0f, 0x0b, 0x5a, 0xd3, 0x4d, 0xca,
+	0xb8, 0x7c, 0xcb, 0x96, 0x47, 0xe6, 0x5f, 0x41, 0xe3, 0x86, 0xf1, 0x0d, 0x91, 0x7b, 0x69, 0xdd,
+	0x3f, 0x3d, 0x09, 0x2c, 0x5a, 0x4b, 0x1b, 0xec, 0x39, 0x7b, 0x31, 0xb6, 0x3b, 0xd0, 0x34, 0x29,
+	0x34, 0x60, 0xd5, 0x6b, 0x42, 0x55, 0x43, 0x68, 0x9c, 0xc2, 0x2a, 0x27, 0xde, 0x83, 0x24, 0xfc,
+	0x60, 0xe2, 0x55, 0x0b, 0xda, 0x2a, 0xfe, 0x9f, 0x46, 0x6c, 0x93, 0xc6, 0x78, 0x50, 0xf8, 0x7f,
+	0x06, 0x00, 0xa7, 0x40, 0x8c, 0x0c, 0xc0, 0x09, 0x00, 0x00,
 }
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/benbjohnson/application-development-using-boltdb/internal"
+	"github.com/gogo/protobuf/proto"
+)
+
+// DefaultInviteTTL is the default duration that an invite can be accepted.
+const DefaultInviteTTL = 7 * 24 * time.Hour
+
+// Invite represents an invitation for someone to create an account.
+type Invite struct {
+	Email     string
+	InvitedBy int
+	ExpiresAt time.Time
+	CreatedAt time.Time
+}
+
+// MarshalBinary encodes an invite to binary format.
+func (i *Invite) MarshalBinary() ([]byte, error) {
+	return proto.Marshal(&internal.Invite{
+		Email:     proto.String(i.Email),
+		InvitedBy: proto.Int64(int64(i.InvitedBy)),
+		ExpiresAt: proto.Int64(encodeTime(i.ExpiresAt)),
+		CreatedAt: proto.Int64(encodeTime(i.CreatedAt)),
+	})
+}
+
+// UnmarshalBinary decodes an invite from binary data.
+func (i *Invite) UnmarshalBinary(data []byte) error {
+	var pb internal.Invite
+	if err := proto.Unmarshal(data, &pb); err != nil {
+		return err
+	}
+
+	i.Email = pb.GetEmail()
+	i.InvitedBy = int(pb.GetInvitedBy())
+	i.ExpiresAt = decodeTime(pb.GetExpiresAt())
+	i.CreatedAt = decodeTime(pb.GetCreatedAt())
+
+	return nil
+}
+
+// The "Invites" bucket is keyed by a hash of the invite token so a stolen
+// data file does not reveal usable tokens. Invites are removed when they are
+// accepted or by the reaper once they expire.
+
+// CreateInvite creates an invite to email sent by the user invitedBy and
+// returns its token. The invite can be accepted once within the store's
+// InviteTTL. The returned token is the only copy so it must be sent to the
+// invitee immediately, either by the caller or by queuing an invite email if
+// the store's QueueEmails is set.
+func (s *Store) CreateInvite(email string, invitedBy int) (token string, err error) {
+	email = strings.TrimSpace(email)
+	if !strings.Contains(email, "@") {
+		return "", ErrInviteEmailInvalid
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	token = hex.EncodeToString(secret)
+
+	if err := s.update("CreateInvite", func(tx *Tx) error {
+		var u User
+		if err := loadUser(tx, invitedBy, &u); err != nil {
+			return err
+		}
+
+		now := time.Now().UTC()
+		i := &Invite{Email: email, InvitedBy: invitedBy, ExpiresAt: now.Add(s.inviteTTL()), CreatedAt: now}
+		buf, err := i.MarshalBinary()
+		if err != nil {
+			return err
+		}
+		if err := putWithTTL(tx, "Invites", hashInviteToken(token), buf, i.ExpiresAt); err != nil {
+			return err
+		}
+
+		if s.QueueEmails {
+			if _, err := queueEmail(tx, email, EmailInvite, &EmailData{InvitedBy: u.Username, Token: token, ExpiresAt: i.ExpiresAt}); err != nil {
+				return err
+			}
+		}
+		return nil
+	}); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// AcceptInvite creates a user for the invite identified by token and sets
+// its password. The user's email is taken from the invite. The invite is
+// removed so it cannot be used again. Returns ErrInviteInvalid if the token
+// does not match an unexpired invite.
+func (s *Store) AcceptInvite(token, username, password string) (*User, error) {
+	h, err := hashPassword(password)
+	if err != nil {
+		return nil, err
+	}
+
+	u := &User{Username: username}
+	if err := s.update("AcceptInvite", func(tx *Tx) error {
+		key := hashInviteToken(token)
+		v := tx.Bucket([]byte("Invites")).Get(key)
+		if v == nil {
+			return ErrInviteInvalid
+		}
+		tx.recordRead("Invites", v)
+
+		var i Invite
+		if err := i.UnmarshalBinary(v); err != nil {
+			return err
+		} else if !time.Now().Before(i.ExpiresAt) {
+			return ErrInviteInvalid
+		}
+
+		u.Email = i.Email
+		if err := createUser(tx, u); err != nil {
+			return err
+		} else if err := savePassword(tx, u.ID, h); err != nil {
+			return err
+		}
+		return deleteWithTTL(tx, "Invites", key)
+	}); err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
+// PendingInvites retrieves the invites that have not been accepted or
+// expired, ordered by creation time.
+func (s *Store) PendingInvites() ([]*Invite, error) {
+	var a []*Invite
+	if err := s.view("PendingInvites", func(tx *Tx) error {
+		now := time.Now()
+		return tx.Bucket([]byte("Invites")).ForEach(func(_, v []byte) error {
+			tx.recordRead("Invites", v)
+
+			var i Invite
+			if err := i.UnmarshalBinary(v); err != nil {
+				return err
+			} else if now.Before(i.ExpiresAt) {
+				a = append(a, &i)
+			}
+			return nil
+		})
+	}); err != nil {
+		return nil, err
+	}
+
+	// Keys are hashes so sort by creation time instead.
+	sort.SliceStable(a, func(i, j int) bool { return a[i].CreatedAt.Before(a[j].CreatedAt) })
+	return a, nil
+}
+
+// inviteTTL returns the configured TTL or the default, if unset.
+func (s *Store) inviteTTL() time.Duration {
+	if s.InviteTTL == 0 {
+		return DefaultInviteTTL
+	}
+	return s.InviteTTL
+}
+
+// hashInviteToken returns the key of an invite in the Invites bucket.
+func hashInviteToken(token string) []byte {
+	h := sha256.Sum256([]byte(token))
+	return h[:]
+}
+
+// Invite related errors.
+var (
+	ErrInviteEmailInvalid = &Error{Code: EINVALID, Message: "invalid invite email"}
+	ErrInviteInvalid      = &Error{Code: EUNAUTHORIZED, Message: "invalid or expired invite"}
+)
@@ -0,0 +1,97 @@
+package main_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	main "github.com/benbjohnson/application-development-using-boltdb"
+)
+
+// Ensure an invite creates a user once and is then removed.
+func TestStore_AcceptInvite(t *testing.T) {
+	s := OpenStore()
+	defer s.Close()
+
+	if err := s.CreateUser(&main.User{Username: "admin"}); err != nil {
+		t.Fatal(err)
+	}
+
+	token, err := s.CreateInvite(" susy@example.com ", 1)
+	if err != nil {
+		t.Fatal(err)
+	} else if _, err := s.CreateInvite("jimbo@example.com", 1); err != nil {
+		t.Fatal(err)
+	}
+
+	// Both invites are pending in creation order.
+	if a, err := s.PendingInvites(); err != nil {
+		t.Fatal(err)
+	} else if len(a) != 2 {
+		t.Fatalf("unexpected invites: %d", len(a))
+	} else if a[0].Email != "susy@example.com" || a[0].InvitedBy != 1 || a[1].Email != "jimbo@example.com" {
+		t.Fatalf("unexpected invites: %#v, %#v", a[0], a[1])
+	}
+
+	// Accept the invite and log in as the new user.
+	u, err := s.AcceptInvite(token, "Susy", "hunter22")
+	if err != nil {
+		t.Fatal(err)
+	} else if u.ID != 2 || u.Username != "susy" || u.Email != "susy@example.com" {
+		t.Fatalf("unexpected user: %#v", u)
+	} else if other, err := s.AuthenticateUser("susy", "hunter22"); err != nil {
+		t.Fatal(err)
+	} else if other.ID != 2 {
+		t.Fatalf("unexpected user: %#v", other)
+	}
+
+	// The invite cannot be used again.
+	if _, err := s.AcceptInvite(token, "susy2", "hunter22"); !errors.Is(err, main.ErrInviteInvalid) {
+		t.Fatalf("unexpected error: %v", err)
+	} else if a, err := s.PendingInvites(); err != nil {
+		t.Fatal(err)
+	} else if len(a) != 1 {
+		t.Fatalf("unexpected invites: %d", len(a))
+	}
+}
+
+// Ensure expired invites cannot be accepted.
+func TestStore_AcceptInvite_Expired(t *testing.T) {
+	s := NewStore()
+	s.InviteTTL = 10 * time.Millisecond
+	if err := s.Open(); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	if err := s.CreateUser(&main.User{Username: "admin"}); err != nil {
+		t.Fatal(err)
+	}
+	token, err := s.CreateInvite("susy@example.com", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	time.Sleep(20 * time.Millisecond)
+	if _, err := s.AcceptInvite(token, "susy", "hunter22"); !errors.Is(err, main.ErrInviteInvalid) {
+		t.Fatalf("unexpected error: %v", err)
+	} else if a, err := s.PendingInvites(); err != nil {
+		t.Fatal(err)
+	} else if len(a) != 0 {
+		t.Fatalf("unexpected invites: %d", len(a))
+	}
+}
+
+// Ensure invites validate their arguments.
+func TestStore_CreateInvite_Err(t *testing.T) {
+	s := OpenStore()
+	defer s.Close()
+
+	if _, err := s.CreateInvite("susy", 1); !errors.Is(err, main.ErrInviteEmailInvalid) {
+		t.Fatalf("unexpected error: %v", err)
+	} else if _, err := s.CreateInvite("susy@example.com", 1); !errors.Is(err, main.ErrUserNotFound) {
+		t.Fatalf("unexpected error: %v", err)
+	} else if _, err := s.AcceptInvite("bad", "susy", "short"); !errors.Is(err, main.ErrPasswordTooShort) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
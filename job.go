@@ -0,0 +1,318 @@
+package main
+
+import (
+	"errors"
+	"time"
+
+	"github.com/benbjohnson/application-development-using-boltdb/internal"
+	"github.com/benbjohnson/application-development-using-boltdb/keys"
+	"github.com/gogo/protobuf/proto"
+)
+
+// Job defaults.
+const (
+	DefaultJobVisibilityTimeout = 30 * time.Second
+	DefaultJobMaxAttempts       = 5
+)
+
+// maxJobRetryDelay is the longest a failed job waits before it is retried.
+const maxJobRetryDelay = 1 * time.Hour
+
+// Job represents a unit of background work, such as sending an email.
+//
+// Jobs are delivered at least once. A dequeued job is hidden from other
+// workers until its visibility timeout passes. If it is not acknowledged by
+// then it is delivered again. Jobs that fail too many times are moved to the
+// dead-letter bucket.
+type Job struct {
+	ID        int
+	Type      string
+	Payload   []byte
+	Attempts  int
+	VisibleAt time.Time // time the job can next be dequeued
+	WorkerID  string    // worker holding the job, if any
+	LastError string
+	CreatedAt time.Time
+}
+
+// MarshalBinary encodes a job to binary format.
+func (j *Job) MarshalBinary() ([]byte, error) {
+	return proto.Marshal(&internal.Job{
+		ID:        proto.Int64(int64(j.ID)),
+		Type:      proto.String(j.Type),
+		Payload:   j.Payload,
+		Attempts:  proto.Int64(int64(j.Attempts)),
+		VisibleAt: proto.Int64(encodeTime(j.VisibleAt)),
+		WorkerID:  proto.String(j.WorkerID),
+		LastError: proto.String(j.LastError),
+		CreatedAt: proto.Int64(encodeTime(j.CreatedAt)),
+	})
+}
+
+// UnmarshalBinary decodes a job from binary data.
+func (j *Job) UnmarshalBinary(data []byte) error {
+	var pb internal.Job
+	if err := proto.Unmarshal(data, &pb); err != nil {
+		return err
+	}
+
+	j.ID = int(pb.GetID())
+	j.Type = pb.GetType()
+	j.Payload = pb.GetPayload()
+	j.Attempts = int(pb.GetAttempts())
+	j.VisibleAt = decodeTime(pb.GetVisibleAt())
+	j.WorkerID = pb.GetWorkerID()
+	j.LastError = pb.GetLastError()
+	j.CreatedAt = decodeTime(pb.GetCreatedAt())
+
+	return nil
+}
+
+// Enqueue adds a job to the queue. The job is available immediately unless
+// VisibleAt is set to a later time. The job's ID is set on success.
+func (s *Store) Enqueue(j *Job) error {
+	if j.Type == "" {
+		return ErrJobTypeRequired
+	}
+
+	return s.update("Enqueue", func(tx *Tx) error {
+		id, err := s.nextID(tx.Bucket([]byte("Jobs")))
+		if err != nil {
+			return err
+		}
+		j.ID = id
+		j.Attempts, j.WorkerID, j.LastError = 0, "", ""
+		j.CreatedAt = time.Now().UTC()
+		if j.VisibleAt.IsZero() {
+			j.VisibleAt = j.CreatedAt
+		}
+
+		return saveJob(tx, j)
+	})
+}
+
+// Dequeue returns the next available job and hides it from other workers
+// until the store's JobVisibilityTimeout passes. Returns nil if no job is
+// available.
+func (s *Store) Dequeue(workerID string) (*Job, error) {
+	var j *Job
+	if err := s.update("Dequeue", func(tx *Tx) error {
+		now := time.Now().UTC()
+
+		// The index is modified on each pass so the cursor is reset to the
+		// first entry each time.
+		c := tx.Bucket([]byte("JobsByVisibleAt")).Cursor()
+		for k, _ := c.First(); k != nil; k, _ = c.First() {
+			tx.recordRead("JobsByVisibleAt", nil)
+
+			r := keys.NewReader(k)
+			visibleAt, id := r.ReadTime(), r.ReadInt()
+			if err := r.Err(); err != nil {
+				return err
+			} else if visibleAt.After(now) {
+				return nil
+			}
+
+			j = &Job{}
+			if err := loadJob(tx, id, j); err != nil {
+				return err
+			}
+
+			// A job whose workers never finish it is eventually given up on.
+			if j.Attempts >= s.jobMaxAttempts() {
+				if j.LastError == "" {
+					j.LastError = "visibility timeout exceeded"
+				}
+				if err := deadLetterJob(tx, j); err != nil {
+					return err
+				}
+				j = nil
+				continue
+			}
+
+			if err := unindexJob(tx, j); err != nil {
+				return err
+			}
+			j.Attempts++
+			j.WorkerID = workerID
+			j.VisibleAt = now.Add(s.jobVisibilityTimeout())
+			return saveJob(tx, j)
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	return j, nil
+}
+
+// Ack marks a job as complete and removes it from the queue.
+// Returns ErrJobLeaseLost if the job was redelivered to another worker.
+func (s *Store) Ack(id int, workerID string) error {
+	return s.update("Ack", func(tx *Tx) error {
+		var j Job
+		if err := loadJob(tx, id, &j); err != nil {
+			return err
+		} else if j.WorkerID != workerID {
+			return ErrJobLeaseLost
+		} else if err := unindexJob(tx, &j); err != nil {
+			return err
+		}
+
+		tx.recordDelete("Jobs")
+		return tx.Bucket([]byte("Jobs")).Delete(keys.Int(id))
+	})
+}
+
+// Nack marks a job as failed. The job is retried after an exponential
+// backoff or moved to the dead-letter bucket once it has used all of its
+// attempts. Returns ErrJobLeaseLost if the job was redelivered to another
+// worker.
+func (s *Store) Nack(id int, workerID string, reason error) error {
+	return s.update("Nack", func(tx *Tx) error {
+		var j Job
+		if err := loadJob(tx, id, &j); err != nil {
+			return err
+		} else if j.WorkerID != workerID {
+			return ErrJobLeaseLost
+		}
+
+		if reason != nil {
+			j.LastError = reason.Error()
+		}
+		if j.Attempts >= s.jobMaxAttempts() {
+			return deadLetterJob(tx, &j)
+		}
+
+		if err := unindexJob(tx, &j); err != nil {
+			return err
+		}
+		j.WorkerID = ""
+		j.VisibleAt = time.Now().UTC().Add(jobRetryDelay(j.Attempts))
+		return saveJob(tx, &j)
+	})
+}
+
+// Job retrieves a queued job by ID. Returns nil if the job does not exist.
+func (s *Store) Job(id int) (*Job, error) {
+	var j Job
+	if err := s.view("Job", func(tx *Tx) error {
+		return loadJob(tx, id, &j)
+	}); errors.Is(err, ErrJobNotFound) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return &j, nil
+}
+
+// DeadJobs retrieves all jobs that exhausted their attempts, ordered by ID.
+func (s *Store) DeadJobs() ([]*Job, error) {
+	var a []*Job
+	if err := s.view("DeadJobs", func(tx *Tx) error {
+		return tx.Bucket([]byte("DeadJobs")).ForEach(func(_, v []byte) error {
+			tx.recordRead("DeadJobs", v)
+
+			j := &Job{}
+			if err := j.UnmarshalBinary(v); err != nil {
+				return err
+			}
+			a = append(a, j)
+			return nil
+		})
+	}); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// loadJob reads the job with the given id into j.
+// Returns ErrJobNotFound if the job does not exist.
+func loadJob(tx *Tx, id int, j *Job) error {
+	v := tx.Bucket([]byte("Jobs")).Get(keys.Int(id))
+	if v == nil {
+		return keyError("job", id, ErrJobNotFound)
+	}
+	tx.recordRead("Jobs", v)
+	return j.UnmarshalBinary(v)
+}
+
+// saveJob writes j to the Jobs bucket and indexes it by visibility time.
+func saveJob(tx *Tx, j *Job) error {
+	buf, err := j.MarshalBinary()
+	if err != nil {
+		return err
+	} else if err := checkValueSize(tx, len(buf)); err != nil {
+		return err
+	}
+
+	tx.recordWrite("Jobs", buf)
+	if err := tx.Bucket([]byte("Jobs")).Put(keys.Int(j.ID), buf); err != nil {
+		return err
+	}
+	tx.recordWrite("JobsByVisibleAt", nil)
+	return tx.Bucket([]byte("JobsByVisibleAt")).Put(jobIndexKey(j), nil)
+}
+
+// unindexJob removes the visibility index entry for j's current state.
+func unindexJob(tx *Tx, j *Job) error {
+	tx.recordDelete("JobsByVisibleAt")
+	return tx.Bucket([]byte("JobsByVisibleAt")).Delete(jobIndexKey(j))
+}
+
+// deadLetterJob moves j from the queue to the DeadJobs bucket.
+func deadLetterJob(tx *Tx, j *Job) error {
+	if err := unindexJob(tx, j); err != nil {
+		return err
+	}
+	tx.recordDelete("Jobs")
+	if err := tx.Bucket([]byte("Jobs")).Delete(keys.Int(j.ID)); err != nil {
+		return err
+	}
+
+	j.WorkerID = ""
+	buf, err := j.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	tx.recordWrite("DeadJobs", buf)
+	return tx.Bucket([]byte("DeadJobs")).Put(keys.Int(j.ID), buf)
+}
+
+// jobIndexKey returns the key of j in the visibility index.
+func jobIndexKey(j *Job) []byte {
+	return keys.Join(keys.Time(j.VisibleAt), keys.Int(j.ID))
+}
+
+// jobRetryDelay returns the delay before a job that has failed attempts
+// times is retried.
+func jobRetryDelay(attempts int) time.Duration {
+	if attempts > 11 {
+		return maxJobRetryDelay
+	} else if d := time.Duration(1<<attempts) * time.Second; d < maxJobRetryDelay {
+		return d
+	}
+	return maxJobRetryDelay
+}
+
+// jobVisibilityTimeout returns the configured timeout or the default, if unset.
+func (s *Store) jobVisibilityTimeout() time.Duration {
+	if s.JobVisibilityTimeout == 0 {
+		return DefaultJobVisibilityTimeout
+	}
+	return s.JobVisibilityTimeout
+}
+
+// jobMaxAttempts returns the configured attempts or the default, if unset.
+func (s *Store) jobMaxAttempts() int {
+	if s.JobMaxAttempts == 0 {
+		return DefaultJobMaxAttempts
+	}
+	return s.JobMaxAttempts
+}
+
+// Job related errors.
+var (
+	ErrJobTypeRequired = &Error{Code: EINVALID, Message: "job type required"}
+	ErrJobNotFound     = &Error{Code: ENOTFOUND, Message: "job not found"}
+	ErrJobLeaseLost    = &Error{Code: ECONFLICT, Message: "job lease lost"}
+)
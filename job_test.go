@@ -0,0 +1,140 @@
+package main_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	main "github.com/benbjohnson/application-development-using-boltdb"
+)
+
+// Ensure jobs are delivered in order and removed once acknowledged.
+func TestStore_Dequeue(t *testing.T) {
+	s := OpenStore()
+	defer s.Close()
+
+	if err := s.Enqueue(&main.Job{Type: "email", Payload: []byte("a")}); err != nil {
+		t.Fatal(err)
+	} else if err := s.Enqueue(&main.Job{Type: "email", Payload: []byte("b")}); err != nil {
+		t.Fatal(err)
+	} else if err := s.Enqueue(&main.Job{Type: "email", VisibleAt: time.Now().Add(time.Hour)}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Dequeue both available jobs; the delayed job is not returned.
+	j1, err := s.Dequeue("w1")
+	if err != nil {
+		t.Fatal(err)
+	} else if j1 == nil || string(j1.Payload) != "a" || j1.Attempts != 1 || j1.WorkerID != "w1" {
+		t.Fatalf("unexpected job: %#v", j1)
+	}
+	j2, err := s.Dequeue("w2")
+	if err != nil {
+		t.Fatal(err)
+	} else if j2 == nil || string(j2.Payload) != "b" {
+		t.Fatalf("unexpected job: %#v", j2)
+	} else if j, err := s.Dequeue("w3"); err != nil {
+		t.Fatal(err)
+	} else if j != nil {
+		t.Fatalf("unexpected job: %#v", j)
+	}
+
+	// Only the worker holding a job can acknowledge it.
+	if err := s.Ack(j1.ID, "w2"); !errors.Is(err, main.ErrJobLeaseLost) {
+		t.Fatalf("unexpected error: %v", err)
+	} else if err := s.Ack(j1.ID, "w1"); err != nil {
+		t.Fatal(err)
+	} else if j, err := s.Job(j1.ID); err != nil {
+		t.Fatal(err)
+	} else if j != nil {
+		t.Fatalf("unexpected job: %#v", j)
+	} else if err := s.Ack(j1.ID, "w1"); !errors.Is(err, main.ErrJobNotFound) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+// Ensure jobs are redelivered after the visibility timeout and are moved to
+// the dead-letter bucket after too many attempts.
+func TestStore_Dequeue_VisibilityTimeout(t *testing.T) {
+	s := OpenStore()
+	defer s.Close()
+	s.JobVisibilityTimeout = time.Nanosecond
+	s.JobMaxAttempts = 2
+
+	if err := s.Enqueue(&main.Job{Type: "email"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// The job is delivered again since it is never acknowledged.
+	for i := 1; i <= 2; i++ {
+		if j, err := s.Dequeue("w1"); err != nil {
+			t.Fatal(err)
+		} else if j == nil || j.Attempts != i {
+			t.Fatalf("unexpected job: %#v", j)
+		}
+	}
+
+	// Once attempts are exhausted the job is dead-lettered.
+	if j, err := s.Dequeue("w1"); err != nil {
+		t.Fatal(err)
+	} else if j != nil {
+		t.Fatalf("unexpected job: %#v", j)
+	} else if a, err := s.DeadJobs(); err != nil {
+		t.Fatal(err)
+	} else if len(a) != 1 || a[0].Attempts != 2 || a[0].LastError == "" {
+		t.Fatalf("unexpected dead jobs: %#v", a)
+	}
+}
+
+// Ensure failed jobs are retried and then dead-lettered.
+func TestStore_Nack(t *testing.T) {
+	s := OpenStore()
+	defer s.Close()
+	s.JobMaxAttempts = 2
+
+	if err := s.Enqueue(&main.Job{Type: "email"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// A failed job is delayed before its next attempt.
+	j, err := s.Dequeue("w1")
+	if err != nil {
+		t.Fatal(err)
+	} else if err := s.Nack(j.ID, "w1", errors.New("smtp down")); err != nil {
+		t.Fatal(err)
+	} else if other, err := s.Job(j.ID); err != nil {
+		t.Fatal(err)
+	} else if other.LastError != "smtp down" || other.WorkerID != "" || !other.VisibleAt.After(time.Now()) {
+		t.Fatalf("unexpected job: %#v", other)
+	} else if other, err := s.Dequeue("w1"); err != nil {
+		t.Fatal(err)
+	} else if other != nil {
+		t.Fatalf("unexpected job: %#v", other)
+	}
+
+	// Failing on the last attempt dead-letters the job.
+	s.JobMaxAttempts = 1
+	if err := s.Enqueue(&main.Job{Type: "cleanup"}); err != nil {
+		t.Fatal(err)
+	} else if j, err := s.Dequeue("w1"); err != nil {
+		t.Fatal(err)
+	} else if err := s.Nack(j.ID, "w2", nil); !errors.Is(err, main.ErrJobLeaseLost) {
+		t.Fatalf("unexpected error: %v", err)
+	} else if err := s.Nack(j.ID, "w1", errors.New("disk full")); err != nil {
+		t.Fatal(err)
+	} else if a, err := s.DeadJobs(); err != nil {
+		t.Fatal(err)
+	} else if len(a) != 1 || a[0].Type != "cleanup" || a[0].LastError != "disk full" {
+		t.Fatalf("unexpected dead jobs: %#v", a)
+	}
+}
+
+// Ensure a job type is required.
+func TestStore_Enqueue_ErrJobTypeRequired(t *testing.T) {
+	s := OpenStore()
+	defer s.Close()
+
+	if err := s.Enqueue(&main.Job{}); !errors.Is(err, main.ErrJobTypeRequired) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,154 @@
+// Package keys provides order-preserving encodings for bolt keys.
+//
+// Each encoding sorts bytewise in the same order as the values it encodes so
+// cursors iterate in natural order. Encodings can be concatenated with Join to
+// build composite keys such as an index entry made of a string and an ID.
+package keys
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"time"
+
+	"github.com/boltdb/bolt"
+)
+
+// Int encodes v as an 8-byte big endian integer.
+//
+// Negative values sort after all non-negative values so Int should only be
+// used for values that are never negative, such as IDs.
+func Int(v int) []byte {
+	buf := make([]byte, 8)
+	binary.BigEndian.PutUint64(buf, uint64(v))
+	return buf
+}
+
+// Int64 encodes v as an 8-byte integer that sorts correctly for negative values.
+func Int64(v int64) []byte {
+	buf := make([]byte, 8)
+	binary.BigEndian.PutUint64(buf, uint64(v)^(1<<63))
+	return buf
+}
+
+// Time encodes t with nanosecond precision. Times sort chronologically.
+func Time(t time.Time) []byte {
+	return Int64(t.UnixNano())
+}
+
+// String encodes s so that it can be followed by other components.
+// Zero bytes are escaped and the string is terminated by a zero byte
+// followed by 0x01 so shorter strings sort before longer ones.
+func String(s string) []byte {
+	buf := make([]byte, 0, len(s)+2)
+	for i := 0; i < len(s); i++ {
+		if s[i] == 0x00 {
+			buf = append(buf, 0x00, 0xFF)
+			continue
+		}
+		buf = append(buf, s[i])
+	}
+	return append(buf, 0x00, 0x01)
+}
+
+// Join concatenates encoded key components into a single key.
+func Join(parts ...[]byte) []byte {
+	return bytes.Join(parts, nil)
+}
+
+// ParseInt decodes an integer encoded with Int.
+func ParseInt(b []byte) int {
+	return int(binary.BigEndian.Uint64(b))
+}
+
+// Reader decodes the components of a composite key in order.
+type Reader struct {
+	buf []byte
+	err error
+}
+
+// NewReader returns a new reader for key b.
+func NewReader(b []byte) *Reader {
+	return &Reader{buf: b}
+}
+
+// Err returns the first error that occurred while decoding, if any.
+func (r *Reader) Err() error { return r.err }
+
+// Remaining returns the bytes that have not been decoded yet.
+func (r *Reader) Remaining() []byte { return r.buf }
+
+// ReadInt decodes the next component as an integer encoded with Int.
+func (r *Reader) ReadInt() int {
+	return int(r.uint64())
+}
+
+// ReadInt64 decodes the next component as an integer encoded with Int64.
+func (r *Reader) ReadInt64() int64 {
+	return int64(r.uint64() ^ (1 << 63))
+}
+
+// ReadTime decodes the next component as a time encoded with Time.
+func (r *Reader) ReadTime() time.Time {
+	if v := r.ReadInt64(); r.err == nil {
+		return time.Unix(0, v).UTC()
+	}
+	return time.Time{}
+}
+
+// ReadString decodes the next component as a string encoded with String.
+func (r *Reader) ReadString() string {
+	if r.err != nil {
+		return ""
+	}
+
+	var buf []byte
+	for i := 0; i+1 < len(r.buf); i++ {
+		if r.buf[i] != 0x00 {
+			buf = append(buf, r.buf[i])
+			continue
+		}
+
+		switch r.buf[i+1] {
+		case 0xFF:
+			buf, i = append(buf, 0x00), i+1
+		case 0x01:
+			r.buf = r.buf[i+2:]
+			return string(buf)
+		default:
+			r.err = ErrInvalidKey
+			return ""
+		}
+	}
+
+	r.err = ErrInvalidKey
+	return ""
+}
+
+// uint64 decodes the next 8 bytes as a big endian integer.
+func (r *Reader) uint64() uint64 {
+	if r.err != nil {
+		return 0
+	} else if len(r.buf) < 8 {
+		r.err = ErrInvalidKey
+		return 0
+	}
+
+	v := binary.BigEndian.Uint64(r.buf)
+	r.buf = r.buf[8:]
+	return v
+}
+
+// Scan calls fn for every key in c's bucket that starts with prefix, in
+// order. Iteration stops at the first error returned by fn.
+func Scan(c *bolt.Cursor, prefix []byte, fn func(k, v []byte) error) error {
+	for k, v := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = c.Next() {
+		if err := fn(k, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ErrInvalidKey is returned when a key cannot be decoded.
+var ErrInvalidKey = errors.New("invalid key")
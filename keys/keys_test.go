@@ -0,0 +1,138 @@
+package keys_test
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/benbjohnson/application-development-using-boltdb/keys"
+	"github.com/boltdb/bolt"
+)
+
+// Ensure encoded integers sort in numeric order.
+func TestInt64_Order(t *testing.T) {
+	values := []int64{-1 << 40, -2, -1, 0, 1, 2, 1 << 40}
+	for i := 1; i < len(values); i++ {
+		if bytes.Compare(keys.Int64(values[i-1]), keys.Int64(values[i])) >= 0 {
+			t.Fatalf("out of order: %d >= %d", values[i-1], values[i])
+		}
+	}
+}
+
+// Ensure encoded strings sort lexicographically, even when followed by
+// another component.
+func TestString_Order(t *testing.T) {
+	values := []string{"", "a", "a\x00", "a\x00b", "a\x01", "ab", "b"}
+
+	encoded := make([][]byte, len(values))
+	for i, s := range values {
+		encoded[i] = keys.Join(keys.String(s), keys.Int(1<<62))
+	}
+	sorted := append([][]byte{}, encoded...)
+	sort.Slice(sorted, func(i, j int) bool { return bytes.Compare(sorted[i], sorted[j]) == -1 })
+
+	if !reflect.DeepEqual(sorted, encoded) {
+		t.Fatal("unexpected order")
+	}
+}
+
+// Ensure composite keys can be decoded back into their components.
+func TestReader(t *testing.T) {
+	now := time.Unix(0, 1466640000123456789).UTC()
+	key := keys.Join(keys.String("a\x00b"), keys.Int(100), keys.Time(now), keys.Int64(-5))
+
+	r := keys.NewReader(key)
+	if s := r.ReadString(); s != "a\x00b" {
+		t.Fatalf("unexpected string: %q", s)
+	} else if v := r.ReadInt(); v != 100 {
+		t.Fatalf("unexpected int: %d", v)
+	} else if v := r.ReadTime(); !v.Equal(now) {
+		t.Fatalf("unexpected time: %s", v)
+	} else if v := r.ReadInt64(); v != -5 {
+		t.Fatalf("unexpected int64: %d", v)
+	} else if r.Err() != nil {
+		t.Fatal(r.Err())
+	} else if len(r.Remaining()) != 0 {
+		t.Fatalf("unexpected remaining: %x", r.Remaining())
+	}
+}
+
+// Ensure reading past the end of a key returns an error.
+func TestReader_ErrInvalidKey(t *testing.T) {
+	r := keys.NewReader(keys.String("a"))
+	r.ReadString()
+	if r.ReadInt(); r.Err() != keys.ErrInvalidKey {
+		t.Fatalf("unexpected error: %v", r.Err())
+	}
+
+	if r := keys.NewReader([]byte("abc")); r.ReadString() != "" || r.Err() != keys.ErrInvalidKey {
+		t.Fatalf("unexpected error: %v", r.Err())
+	}
+}
+
+// Ensure decoding arbitrary keys never panics and that decoded strings
+// re-encode to the bytes they were read from.
+func FuzzReader(f *testing.F) {
+	f.Add(keys.Join(keys.String("a\x00b"), keys.Int(100)))
+	f.Add([]byte{0x00})
+	f.Add([]byte{0x00, 0xFF, 0x00})
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		r := keys.NewReader(data)
+		s := r.ReadString()
+		if r.Err() != nil {
+			return
+		}
+
+		n := len(data) - len(r.Remaining())
+		if !bytes.Equal(keys.String(s), data[:n]) {
+			t.Fatalf("re-encoded mismatch: %x != %x", keys.String(s), data[:n])
+		}
+		r.ReadInt()
+		r.ReadTime()
+	})
+}
+
+// Ensure a prefix scan only visits keys with the prefix.
+func TestScan(t *testing.T) {
+	db, err := bolt.Open(filepath.Join(t.TempDir(), "db"), 0666, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(db.Path())
+	defer db.Close()
+
+	if err := db.Update(func(tx *bolt.Tx) error {
+		bkt, _ := tx.CreateBucket([]byte("x"))
+		for _, k := range [][]byte{
+			keys.Join(keys.String("a"), keys.Int(1)),
+			keys.Join(keys.String("ab"), keys.Int(1)),
+			keys.Join(keys.String("b"), keys.Int(2)),
+			keys.Join(keys.String("b"), keys.Int(1)),
+			keys.Join(keys.String("c"), keys.Int(1)),
+		} {
+			bkt.Put(k, nil)
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	var ids []int
+	if err := db.View(func(tx *bolt.Tx) error {
+		return keys.Scan(tx.Bucket([]byte("x")).Cursor(), keys.String("b"), func(k, _ []byte) error {
+			r := keys.NewReader(k)
+			r.ReadString()
+			ids = append(ids, r.ReadInt())
+			return r.Err()
+		})
+	}); err != nil {
+		t.Fatal(err)
+	} else if !reflect.DeepEqual(ids, []int{1, 2}) {
+		t.Fatalf("unexpected ids: %v", ids)
+	}
+}
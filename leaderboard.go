@@ -0,0 +1,154 @@
+package main
+
+import (
+	"errors"
+
+	"github.com/benbjohnson/application-development-using-boltdb/keys"
+	"github.com/boltdb/bolt"
+)
+
+// Score is the score of a member of a leaderboard.
+type Score struct {
+	Member string
+	Score  int64
+}
+
+// Each leaderboard is a bucket nested within the "Leaderboards" bucket. Its
+// "Members" bucket maps each member to its score and its "Scores" bucket
+// holds a key for each member made of the score followed by the member, so
+// members are ordered by score.
+
+// SetScore sets the score of a member of the named leaderboard, replacing
+// any previous score. The leaderboard is created if it does not exist.
+func (s *Store) SetScore(board, member string, score int64) error {
+	if board == "" {
+		return ErrLeaderboardRequired
+	} else if member == "" {
+		return ErrMemberRequired
+	}
+
+	return s.update("SetScore", func(tx *Tx) error {
+		tx.recordWrite("Leaderboards", nil)
+		bkt, err := tx.Bucket([]byte("Leaderboards")).CreateBucketIfNotExists([]byte(board))
+		if err != nil {
+			return err
+		}
+		members, err := bkt.CreateBucketIfNotExists([]byte("Members"))
+		if err != nil {
+			return err
+		}
+		scores, err := bkt.CreateBucketIfNotExists([]byte("Scores"))
+		if err != nil {
+			return err
+		}
+
+		if prev := members.Get([]byte(member)); prev != nil {
+			if err := scores.Delete(keys.Join(prev, keys.String(member))); err != nil {
+				return err
+			}
+		}
+		if err := members.Put([]byte(member), keys.Int64(score)); err != nil {
+			return err
+		}
+		return scores.Put(keys.Join(keys.Int64(score), keys.String(member)), nil)
+	})
+}
+
+// DeleteScore removes a member from the named leaderboard. Removing a member
+// that has no score is not an error.
+func (s *Store) DeleteScore(board, member string) error {
+	return s.update("DeleteScore", func(tx *Tx) error {
+		bkt := leaderboardBucket(tx, board)
+		if bkt == nil {
+			return nil
+		}
+		members, scores := bkt.Bucket([]byte("Members")), bkt.Bucket([]byte("Scores"))
+
+		prev := members.Get([]byte(member))
+		if prev == nil {
+			return nil
+		}
+		tx.recordDelete("Leaderboards")
+		if err := scores.Delete(keys.Join(prev, keys.String(member))); err != nil {
+			return err
+		}
+		return members.Delete([]byte(member))
+	})
+}
+
+// TopN returns up to n members of the named leaderboard with the highest
+// scores, highest first. Members with equal scores are ordered by member in
+// descending order. All members are returned if n is zero.
+func (s *Store) TopN(board string, n int) ([]*Score, error) {
+	a := []*Score{}
+	if err := s.view("TopN", func(tx *Tx) error {
+		bkt := leaderboardBucket(tx, board)
+		if bkt == nil {
+			return nil
+		}
+		return iterate(bkt.Bucket([]byte("Scores")).Cursor(), true, func(k, _ []byte) error {
+			if n > 0 && len(a) == n {
+				return errStop
+			}
+			tx.recordRead("Leaderboards", nil)
+
+			r := keys.NewReader(k)
+			score := &Score{Score: r.ReadInt64(), Member: r.ReadString()}
+			if err := r.Err(); err != nil {
+				return err
+			}
+			a = append(a, score)
+			return nil
+		})
+	}); err != nil && !errors.Is(err, errStop) {
+		return nil, err
+	}
+	return a, nil
+}
+
+// Rank returns the zero-based position of a member in the named leaderboard,
+// in the order returned by TopN, along with its score. Members are counted
+// from the top so the cost grows with the rank. Returns ErrScoreNotFound if
+// the member has no score.
+func (s *Store) Rank(board, member string) (int, int64, error) {
+	var rank int
+	var score int64
+	if err := s.view("Rank", func(tx *Tx) error {
+		var v []byte
+		if bkt := leaderboardBucket(tx, board); bkt != nil {
+			v = bkt.Bucket([]byte("Members")).Get([]byte(member))
+		}
+		if v == nil {
+			return keyError("member", member, ErrScoreNotFound)
+		}
+		tx.recordRead("Leaderboards", v)
+		score = keys.NewReader(v).ReadInt64()
+
+		// Count the members after the member's own entry.
+		c := leaderboardBucket(tx, board).Bucket([]byte("Scores")).Cursor()
+		c.Seek(keys.Join(v, keys.String(member)))
+		for k, _ := c.Next(); k != nil; k, _ = c.Next() {
+			rank++
+		}
+		return nil
+	}); err != nil {
+		return 0, 0, err
+	}
+	return rank, score, nil
+}
+
+// leaderboardBucket returns the bucket of the named leaderboard or nil if it
+// does not exist.
+func leaderboardBucket(tx *Tx, board string) *bolt.Bucket {
+	if board == "" {
+		return nil
+	}
+	return tx.Bucket([]byte("Leaderboards")).Bucket([]byte(board))
+}
+
+// Leaderboard related errors.
+var (
+	ErrLeaderboardRequired = &Error{Code: EINVALID, Message: "leaderboard name required"}
+	ErrMemberRequired      = &Error{Code: EINVALID, Message: "leaderboard member required"}
+	ErrScoreNotFound       = &Error{Code: ENOTFOUND, Message: "score not found"}
+)
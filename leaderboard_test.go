@@ -0,0 +1,85 @@
+package main_test
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	main "github.com/benbjohnson/application-development-using-boltdb"
+)
+
+// Ensure members are ordered by score and ranked from the top.
+func TestStore_SetScore(t *testing.T) {
+	s := OpenStore()
+	defer s.Close()
+
+	for _, score := range []main.Score{
+		{Member: "susy", Score: 10},
+		{Member: "john", Score: -5},
+		{Member: "jimbo", Score: 20},
+		{Member: "bob", Score: 15},
+		{Member: "susy", Score: 30},
+	} {
+		if err := s.SetScore("points", score.Member, score.Score); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.SetScore("other", "john", 100); err != nil {
+		t.Fatal(err)
+	}
+
+	if a, err := s.TopN("points", 3); err != nil {
+		t.Fatal(err)
+	} else if !reflect.DeepEqual(a, []*main.Score{
+		{Member: "susy", Score: 30},
+		{Member: "jimbo", Score: 20},
+		{Member: "bob", Score: 15},
+	}) {
+		t.Fatalf("unexpected scores: %#v", a)
+	} else if a, err := s.TopN("points", 0); err != nil {
+		t.Fatal(err)
+	} else if len(a) != 4 || a[3].Member != "john" {
+		t.Fatalf("unexpected scores: %#v", a)
+	}
+
+	if rank, score, err := s.Rank("points", "susy"); err != nil {
+		t.Fatal(err)
+	} else if rank != 0 || score != 30 {
+		t.Fatalf("unexpected rank: %d, %d", rank, score)
+	} else if rank, score, err := s.Rank("points", "john"); err != nil {
+		t.Fatal(err)
+	} else if rank != 3 || score != -5 {
+		t.Fatalf("unexpected rank: %d, %d", rank, score)
+	}
+
+	// Removed members are no longer ranked.
+	if err := s.DeleteScore("points", "susy"); err != nil {
+		t.Fatal(err)
+	} else if _, _, err := s.Rank("points", "susy"); !errors.Is(err, main.ErrScoreNotFound) {
+		t.Fatalf("unexpected error: %v", err)
+	} else if rank, _, err := s.Rank("points", "jimbo"); err != nil {
+		t.Fatal(err)
+	} else if rank != 0 {
+		t.Fatalf("unexpected rank: %d", rank)
+	}
+}
+
+// Ensure missing leaderboards are empty and names are validated.
+func TestStore_SetScore_Err(t *testing.T) {
+	s := OpenStore()
+	defer s.Close()
+
+	if err := s.SetScore("", "susy", 1); err != main.ErrLeaderboardRequired {
+		t.Fatalf("unexpected error: %v", err)
+	} else if err := s.SetScore("points", "", 1); err != main.ErrMemberRequired {
+		t.Fatalf("unexpected error: %v", err)
+	} else if a, err := s.TopN("points", 10); err != nil {
+		t.Fatal(err)
+	} else if len(a) != 0 {
+		t.Fatalf("unexpected scores: %#v", a)
+	} else if _, _, err := s.Rank("points", "susy"); !errors.Is(err, main.ErrScoreNotFound) {
+		t.Fatalf("unexpected error: %v", err)
+	} else if err := s.DeleteScore("points", "susy"); err != nil {
+		t.Fatal(err)
+	}
+}
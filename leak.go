@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultTxLeakTimeout is the default duration Close waits for open
+// transactions before reporting them as leaked.
+const DefaultTxLeakTimeout = 1 * time.Second
+
+// txLeakCheckBuild enables leak detection for every store. It is set by
+// building with the txleakcheck tag.
+var txLeakCheckBuild = false
+
+// TxLeakError is returned by Close when transactions are still open after
+// TxLeakTimeout. The store is left open so the transactions can finish.
+type TxLeakError struct {
+	// Stacks of the callers that began each open transaction.
+	Stacks []string
+}
+
+// Error returns the number of open transactions and their stacks.
+func (e *TxLeakError) Error() string {
+	return fmt.Sprintf("%d transaction(s) never closed:\n\n%s", len(e.Stacks), strings.Join(e.Stacks, "\n"))
+}
+
+// detectTxLeaks returns true if open transactions are tracked.
+func (s *Store) detectTxLeaks() bool {
+	return s.DetectTxLeaks || txLeakCheckBuild
+}
+
+// txLeakTimeout returns the configured timeout or the default, if unset.
+func (s *Store) txLeakTimeout() time.Duration {
+	if s.TxLeakTimeout <= 0 {
+		return DefaultTxLeakTimeout
+	}
+	return s.TxLeakTimeout
+}
+
+// openTxs tracks the transactions that have begun but not finished along
+// with the stacks of their callers.
+type openTxs struct {
+	mu sync.Mutex
+	m  map[*Tx][]uintptr
+}
+
+// add records that tx began with the stack pcs.
+func (o *openTxs) add(tx *Tx, pcs []uintptr) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.m == nil {
+		o.m = make(map[*Tx][]uintptr)
+	}
+	o.m[tx] = pcs
+}
+
+// remove records that tx finished.
+func (o *openTxs) remove(tx *Tx) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	delete(o.m, tx)
+}
+
+// wait waits up to timeout for every open transaction to finish. Returns a
+// *TxLeakError listing the transactions still open afterwards.
+func (o *openTxs) wait(timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		o.mu.Lock()
+		n := len(o.m)
+		o.mu.Unlock()
+		if n == 0 {
+			return nil
+		} else if time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	e := &TxLeakError{}
+	for _, pcs := range o.m {
+		_, stack := formatCallers(pcs)
+		e.Stacks = append(e.Stacks, stack)
+	}
+	return e
+}
@@ -0,0 +1,54 @@
+package main_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	main "github.com/benbjohnson/application-development-using-boltdb"
+)
+
+// Ensure Close reports transactions that are still open instead of blocking.
+func TestStore_DetectTxLeaks(t *testing.T) {
+	s := NewStore()
+	s.DetectTxLeaks = true
+	s.TxLeakTimeout = 10 * time.Millisecond
+	if err := s.Open(); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	if err := s.CreateUser(&main.User{Username: "susy"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Hold a read transaction open until released.
+	started, release, done := make(chan struct{}), make(chan struct{}), make(chan error)
+	go func() {
+		_, err := s.AggregateUsers(func(u *main.User) string {
+			close(started)
+			<-release
+			return ""
+		})
+		done <- err
+	}()
+	<-started
+
+	var e *main.TxLeakError
+	if err := s.Store.Close(); !errors.As(err, &e) {
+		t.Fatalf("unexpected error: %v", err)
+	} else if len(e.Stacks) != 1 || !strings.Contains(e.Stacks[0], "TestStore_DetectTxLeaks") {
+		t.Fatalf("unexpected stacks: %v", e.Stacks)
+	}
+
+	// The store is still open and closes once the transaction finishes.
+	close(release)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	} else if u, err := s.User(1); err != nil || u == nil {
+		t.Fatalf("unexpected user: %#v, %v", u, err)
+	} else if err := s.Store.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,7 @@
+//go:build txleakcheck
+
+package main
+
+// Building with the txleakcheck tag, such as with "go test -tags txleakcheck",
+// enables leak detection for every store.
+func init() { txLeakCheckBuild = true }
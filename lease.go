@@ -0,0 +1,223 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/benbjohnson/application-development-using-boltdb/internal"
+	"github.com/gogo/protobuf/proto"
+)
+
+// Lease grants its holder exclusive use of a name until it expires, such as
+// to run a singleton job from one of several processes.
+//
+// Each acquisition of a name is given a fencing token greater than that of
+// every earlier acquisition. A holder that stalls past its expiry may not
+// know it lost the lease, so systems that accept work from holders should
+// remember the highest token seen and reject requests with lower ones.
+type Lease struct {
+	Name       string        `json:"name"`
+	Token      int64         `json:"token"`
+	TTL        time.Duration `json:"ttl"`
+	AcquiredAt time.Time     `json:"acquired_at"`
+	ExpiresAt  time.Time     `json:"expires_at"`
+}
+
+// Expired returns true if the lease is no longer held at t.
+func (l *Lease) Expired(t time.Time) bool {
+	return !t.Before(l.ExpiresAt)
+}
+
+// MarshalBinary encodes a lease to binary format.
+func (l *Lease) MarshalBinary() ([]byte, error) {
+	return proto.Marshal(&internal.Lease{
+		Name:       proto.String(l.Name),
+		Token:      proto.Int64(l.Token),
+		TTL:        proto.Int64(int64(l.TTL)),
+		AcquiredAt: proto.Int64(encodeTime(l.AcquiredAt)),
+		ExpiresAt:  proto.Int64(encodeTime(l.ExpiresAt)),
+	})
+}
+
+// UnmarshalBinary decodes a lease from binary data.
+func (l *Lease) UnmarshalBinary(data []byte) error {
+	var pb internal.Lease
+	if err := proto.Unmarshal(data, &pb); err != nil {
+		return err
+	}
+
+	l.Name = pb.GetName()
+	l.Token = pb.GetToken()
+	l.TTL = time.Duration(pb.GetTTL())
+	l.AcquiredAt = decodeTime(pb.GetAcquiredAt())
+	l.ExpiresAt = decodeTime(pb.GetExpiresAt())
+
+	return nil
+}
+
+// The "Leases" bucket maps each name to its most recent lease. Released
+// leases are kept with a zero expiry so their token is not reused.
+
+// AcquireLease acquires the lease on name for ttl. Returns ErrLeaseHeld if
+// another holder's lease has not expired. The lease must be renewed before
+// it expires to keep holding it, see RenewLease and KeepLease.
+func (s *Store) AcquireLease(name string, ttl time.Duration) (Lease, error) {
+	if name == "" {
+		return Lease{}, ErrLeaseNameRequired
+	} else if ttl <= 0 {
+		return Lease{}, ErrLeaseTTLInvalid
+	}
+
+	var l Lease
+	if err := s.update("AcquireLease", func(tx *Tx) error {
+		prev, err := loadLease(tx, name)
+		if err != nil {
+			return err
+		}
+
+		now := time.Now().UTC()
+		l = Lease{Name: name, Token: 1, TTL: ttl, AcquiredAt: now, ExpiresAt: now.Add(ttl)}
+		if prev != nil {
+			if !prev.Expired(now) {
+				return keyError("lease", name, ErrLeaseHeld)
+			}
+			l.Token = prev.Token + 1
+		}
+		return saveLease(tx, &l)
+	}); err != nil {
+		return Lease{}, err
+	}
+	return l, nil
+}
+
+// RenewLease extends a held lease by its TTL from the current time and
+// returns the renewed lease. Returns ErrLeaseLost if the lease expired or
+// was acquired by another holder.
+func (s *Store) RenewLease(l Lease) (Lease, error) {
+	if err := s.update("RenewLease", func(tx *Tx) error {
+		cur, err := heldLease(tx, l.Name, l.Token)
+		if err != nil {
+			return err
+		}
+		l = *cur
+		l.ExpiresAt = time.Now().UTC().Add(l.TTL)
+		return saveLease(tx, &l)
+	}); err != nil {
+		return Lease{}, err
+	}
+	return l, nil
+}
+
+// ReleaseLease gives up a held lease so it can be acquired immediately.
+// Returns ErrLeaseLost if the lease expired or was acquired by another
+// holder.
+func (s *Store) ReleaseLease(l Lease) error {
+	return s.update("ReleaseLease", func(tx *Tx) error {
+		cur, err := heldLease(tx, l.Name, l.Token)
+		if err != nil {
+			return err
+		}
+		cur.ExpiresAt = time.Time{}
+		return saveLease(tx, cur)
+	})
+}
+
+// CheckLease returns ErrLeaseLost unless token is the fencing token of the
+// current, unexpired lease on name.
+func (s *Store) CheckLease(name string, token int64) error {
+	return s.view("CheckLease", func(tx *Tx) error {
+		_, err := heldLease(tx, name, token)
+		return err
+	})
+}
+
+// KeepLease renews l every third of its TTL until ctx is done and then
+// releases it. Returns ErrLeaseLost, or another error, if a renewal fails,
+// in which case the work guarded by the lease should stop.
+func (s *Store) KeepLease(ctx context.Context, l Lease) error {
+	ticker := time.NewTicker(max(l.TTL/3, time.Millisecond))
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			if err := s.ReleaseLease(l); err != nil && !errors.Is(err, ErrLeaseLost) {
+				return err
+			}
+			return nil
+		case <-ticker.C:
+			var err error
+			if l, err = s.RenewLease(l); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// Leases retrieves the leases that are currently held, ordered by name.
+func (s *Store) Leases() ([]Lease, error) {
+	a := []Lease{}
+	if err := s.view("Leases", func(tx *Tx) error {
+		now := time.Now().UTC()
+		return tx.Bucket([]byte("Leases")).ForEach(func(_, v []byte) error {
+			tx.recordRead("Leases", v)
+
+			var l Lease
+			if err := l.UnmarshalBinary(v); err != nil {
+				return err
+			} else if !l.Expired(now) {
+				a = append(a, l)
+			}
+			return nil
+		})
+	}); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// loadLease reads the lease on name. Returns nil if name was never leased.
+func loadLease(tx *Tx, name string) (*Lease, error) {
+	v := tx.Bucket([]byte("Leases")).Get([]byte(name))
+	if v == nil {
+		return nil, nil
+	}
+	tx.recordRead("Leases", v)
+
+	l := &Lease{}
+	if err := l.UnmarshalBinary(v); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// heldLease reads the lease on name and returns ErrLeaseLost unless it is
+// unexpired and has the given token.
+func heldLease(tx *Tx, name string, token int64) (*Lease, error) {
+	l, err := loadLease(tx, name)
+	if err != nil {
+		return nil, err
+	} else if l == nil || l.Token != token || l.Expired(time.Now().UTC()) {
+		return nil, keyError("lease", name, ErrLeaseLost)
+	}
+	return l, nil
+}
+
+// saveLease writes l to the Leases bucket.
+func saveLease(tx *Tx, l *Lease) error {
+	buf, err := l.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	tx.recordWrite("Leases", buf)
+	return tx.Bucket([]byte("Leases")).Put([]byte(l.Name), buf)
+}
+
+// Lease related errors.
+var (
+	ErrLeaseNameRequired = &Error{Code: EINVALID, Message: "lease name required"}
+	ErrLeaseTTLInvalid   = &Error{Code: EINVALID, Message: "lease ttl must be positive"}
+	ErrLeaseHeld         = &Error{Code: ECONFLICT, Message: "lease held by another holder"}
+	ErrLeaseLost         = &Error{Code: ECONFLICT, Message: "lease expired or acquired by another holder"}
+)
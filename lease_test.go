@@ -0,0 +1,114 @@
+package main_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	main "github.com/benbjohnson/application-development-using-boltdb"
+)
+
+// Ensure a lease is exclusive until released and tokens increase.
+func TestStore_AcquireLease(t *testing.T) {
+	s := OpenStore()
+	defer s.Close()
+
+	l, err := s.AcquireLease("reports", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	} else if l.Token != 1 || l.ExpiresAt.Sub(l.AcquiredAt) != time.Minute {
+		t.Fatalf("unexpected lease: %#v", l)
+	} else if _, err := s.AcquireLease("reports", time.Minute); !errors.Is(err, main.ErrLeaseHeld) {
+		t.Fatalf("unexpected error: %v", err)
+	} else if err := s.CheckLease("reports", 1); err != nil {
+		t.Fatal(err)
+	}
+
+	if other, err := s.RenewLease(l); err != nil {
+		t.Fatal(err)
+	} else if other.Token != 1 || other.ExpiresAt.Before(l.ExpiresAt) {
+		t.Fatalf("unexpected lease: %#v", other)
+	} else if a, err := s.Leases(); err != nil {
+		t.Fatal(err)
+	} else if len(a) != 1 || a[0].Name != "reports" {
+		t.Fatalf("unexpected leases: %#v", a)
+	}
+
+	// Released leases can be acquired again with a new token.
+	if err := s.ReleaseLease(l); err != nil {
+		t.Fatal(err)
+	} else if a, err := s.Leases(); err != nil {
+		t.Fatal(err)
+	} else if len(a) != 0 {
+		t.Fatalf("unexpected leases: %#v", a)
+	} else if l2, err := s.AcquireLease("reports", time.Minute); err != nil {
+		t.Fatal(err)
+	} else if l2.Token != 2 {
+		t.Fatalf("unexpected token: %d", l2.Token)
+	} else if err := s.CheckLease("reports", 1); !errors.Is(err, main.ErrLeaseLost) {
+		t.Fatalf("unexpected error: %v", err)
+	} else if err := s.ReleaseLease(l); !errors.Is(err, main.ErrLeaseLost) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if _, err := s.AcquireLease("", time.Minute); !errors.Is(err, main.ErrLeaseNameRequired) {
+		t.Fatalf("unexpected error: %v", err)
+	} else if _, err := s.AcquireLease("x", 0); !errors.Is(err, main.ErrLeaseTTLInvalid) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+// Ensure an expired lease can be taken over and is lost by its holder.
+func TestStore_AcquireLease_Expired(t *testing.T) {
+	s := OpenStore()
+	defer s.Close()
+
+	l, err := s.AcquireLease("reports", 50*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	if _, err := s.RenewLease(l); !errors.Is(err, main.ErrLeaseLost) {
+		t.Fatalf("unexpected error: %v", err)
+	} else if l2, err := s.AcquireLease("reports", time.Minute); err != nil {
+		t.Fatal(err)
+	} else if l2.Token != 2 {
+		t.Fatalf("unexpected token: %d", l2.Token)
+	}
+
+	// Tokens survive reopening the store.
+	if err := s.Reopen(); err != nil {
+		t.Fatal(err)
+	} else if err := s.CheckLease("reports", 2); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Ensure KeepLease holds a lease past its TTL and releases it when done.
+func TestStore_KeepLease(t *testing.T) {
+	s := OpenStore()
+	defer s.Close()
+
+	l, err := s.AcquireLease("reports", 60*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- s.KeepLease(ctx, l) }()
+
+	time.Sleep(200 * time.Millisecond)
+	if err := s.CheckLease("reports", l.Token); err != nil {
+		t.Fatal(err)
+	}
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	} else if _, err := s.AcquireLease("reports", time.Minute); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/benbjohnson/application-development-using-boltdb/keys"
+)
+
+// Default login lockout settings.
+const (
+	DefaultMaxLoginFailures = 5
+	DefaultLoginWindow      = 15 * time.Minute
+)
+
+// The "LoginAttempts" bucket holds one entry per failed login, keyed by the
+// subject and the time of the failure. A subject is a user or an IP
+// address. Entries expire once they leave the window so a subject is
+// unlocked when its oldest failures age out.
+
+// RecordLoginAttempt records an attempt to log in as a user from ip.
+//
+// A failure counts against both the user and the IP address. Once either
+// has MaxLoginFailures failures within LoginWindow, further attempts return
+// ErrAccountLocked until the oldest failures leave the window. A success
+// clears the failures of the user but not of the IP address. A zero userID
+// or empty ip is not tracked.
+func (s *Store) RecordLoginAttempt(userID int, ip string, success bool) error {
+	if s.maxLoginFailures() < 0 {
+		return nil
+	}
+	subjects := loginSubjects(userID, ip)
+
+	// The lockout error is returned after commit so the failure is kept.
+	var locked error
+	if err := s.update("RecordLoginAttempt", func(tx *Tx) error {
+		if success {
+			if userID == 0 {
+				return nil
+			}
+			return clearLoginFailures(tx, userLoginSubject(userID))
+		}
+
+		now := time.Now()
+		for _, subject := range subjects {
+			if err := s.recordLoginFailure(tx, subject, now); err != nil {
+				return err
+			}
+		}
+		locked = s.checkLoginLocked(tx, now, subjects...)
+		if locked != nil && !errors.Is(locked, ErrAccountLocked) {
+			return locked
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+	return locked
+}
+
+// CheckLogin returns ErrAccountLocked if the user or ip has too many recent
+// login failures. Callers check this before verifying credentials.
+func (s *Store) CheckLogin(userID int, ip string) error {
+	if s.maxLoginFailures() < 0 {
+		return nil
+	}
+	return s.view("CheckLogin", func(tx *Tx) error {
+		return s.checkLoginLocked(tx, time.Now(), loginSubjects(userID, ip)...)
+	})
+}
+
+// checkLoginLocked returns ErrAccountLocked if any subject is locked out.
+func (s *Store) checkLoginLocked(tx *Tx, now time.Time, subjects ...string) error {
+	for _, subject := range subjects {
+		n, err := s.loginFailures(tx, subject, now)
+		if err != nil {
+			return err
+		} else if n >= s.maxLoginFailures() {
+			return keyError("login", subject, ErrAccountLocked)
+		}
+	}
+	return nil
+}
+
+// loginFailures returns the number of failures of subject within the window.
+// Failures that have expired but not yet been reaped are not counted.
+func (s *Store) loginFailures(tx *Tx, subject string, now time.Time) (int, error) {
+	since := now.Add(-s.loginWindow())
+
+	var n int
+	c := tx.Bucket([]byte("LoginAttempts")).Cursor()
+	if err := keys.Scan(c, keys.String(subject), func(k, _ []byte) error {
+		tx.recordRead("LoginAttempts", nil)
+
+		r := keys.NewReader(k)
+		r.ReadString()
+		t := r.ReadTime()
+		if err := r.Err(); err != nil {
+			return err
+		} else if t.After(since) {
+			n++
+		}
+		return nil
+	}); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+// recordLoginFailure adds a failure for subject that expires after the window.
+func (s *Store) recordLoginFailure(tx *Tx, subject string, now time.Time) error {
+	key := keys.Join(keys.String(subject), keys.Time(now))
+	return putWithTTL(tx, "LoginAttempts", key, []byte{}, now.Add(s.loginWindow()))
+}
+
+// ClearLoginFailures removes the failures recorded for a user and IP address
+// so they are no longer locked out. Returns the number of failures removed.
+// A zero userID or empty ip is skipped.
+func (s *Store) ClearLoginFailures(userID int, ip string) (int, error) {
+	var n int
+	if err := s.update("ClearLoginFailures", func(tx *Tx) error {
+		n = 0
+		for _, subject := range loginSubjects(userID, ip) {
+			cleared, err := deletePrefix(tx, "LoginAttempts", keys.String(subject))
+			if err != nil {
+				return err
+			}
+			n += cleared
+		}
+		return nil
+	}); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+// clearLoginFailures removes all failures recorded for subject.
+func clearLoginFailures(tx *Tx, subject string) error {
+	_, err := deletePrefix(tx, "LoginAttempts", keys.String(subject))
+	return err
+}
+
+// loginSubjects returns the subjects tracked for a login attempt.
+func loginSubjects(userID int, ip string) []string {
+	var a []string
+	if userID != 0 {
+		a = append(a, userLoginSubject(userID))
+	}
+	if ip != "" {
+		a = append(a, "ip:"+ip)
+	}
+	return a
+}
+
+// userLoginSubject returns the subject used to track logins of a user.
+func userLoginSubject(id int) string { return "user:" + strconv.Itoa(id) }
+
+// maxLoginFailures returns the configured limit or the default, if unset.
+func (s *Store) maxLoginFailures() int {
+	if s.MaxLoginFailures == 0 {
+		return DefaultMaxLoginFailures
+	}
+	return s.MaxLoginFailures
+}
+
+// loginWindow returns the configured window or the default, if unset.
+func (s *Store) loginWindow() time.Duration {
+	if s.LoginWindow == 0 {
+		return DefaultLoginWindow
+	}
+	return s.LoginWindow
+}
+
+// Login related errors.
+var (
+	ErrAccountLocked = &Error{Code: EUNAUTHORIZED, Message: "account locked"}
+)
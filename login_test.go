@@ -0,0 +1,168 @@
+package main_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	main "github.com/benbjohnson/application-development-using-boltdb"
+)
+
+// Ensure repeated login failures lock out the user and IP address.
+func TestStore_RecordLoginAttempt(t *testing.T) {
+	s := NewStore()
+	s.MaxLoginFailures = 3
+	if err := s.Open(); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	// Failures below the limit do not lock the account.
+	for i := 0; i < 2; i++ {
+		if err := s.RecordLoginAttempt(1, "10.0.0.1", false); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.CheckLogin(1, "10.0.0.1"); err != nil {
+		t.Fatal(err)
+	}
+
+	// The third failure locks both the user and the IP address.
+	if err := s.RecordLoginAttempt(1, "10.0.0.1", false); !errors.Is(err, main.ErrAccountLocked) {
+		t.Fatalf("unexpected error: %v", err)
+	} else if err := s.CheckLogin(1, ""); !errors.Is(err, main.ErrAccountLocked) {
+		t.Fatalf("unexpected user error: %v", err)
+	} else if err := s.CheckLogin(2, "10.0.0.1"); !errors.Is(err, main.ErrAccountLocked) {
+		t.Fatalf("unexpected ip error: %v", err)
+	} else if main.ErrorCode(err) != main.EUNAUTHORIZED {
+		t.Fatalf("unexpected code: %s", main.ErrorCode(err))
+	} else if err := s.CheckLogin(2, "10.0.0.2"); err != nil {
+		t.Fatal(err)
+	}
+
+	// A success clears the user's failures but not the IP address's.
+	if err := s.RecordLoginAttempt(1, "10.0.0.1", true); err != nil {
+		t.Fatal(err)
+	} else if err := s.CheckLogin(1, ""); err != nil {
+		t.Fatal(err)
+	} else if err := s.CheckLogin(0, "10.0.0.1"); !errors.Is(err, main.ErrAccountLocked) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+// Ensure failures can be cleared to end a lockout early.
+func TestStore_ClearLoginFailures(t *testing.T) {
+	s := NewStore()
+	s.MaxLoginFailures = 2
+	if err := s.Open(); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	for i := 0; i < 2; i++ {
+		if err := s.RecordLoginAttempt(1, "10.0.0.1", false); err != nil && !errors.Is(err, main.ErrAccountLocked) {
+			t.Fatal(err)
+		}
+	}
+	if err := s.RecordLoginAttempt(2, "10.0.0.2", false); err != nil {
+		t.Fatal(err)
+	}
+
+	if n, err := s.ClearLoginFailures(1, "10.0.0.1"); err != nil {
+		t.Fatal(err)
+	} else if n != 4 {
+		t.Fatalf("unexpected count: %d", n)
+	} else if err := s.CheckLogin(1, "10.0.0.1"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Failures of other subjects are kept.
+	if err := s.RecordLoginAttempt(2, "", false); !errors.Is(err, main.ErrAccountLocked) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+// Ensure a lockout ends once failures leave the window.
+func TestStore_RecordLoginAttempt_Window(t *testing.T) {
+	s := NewStore()
+	s.MaxLoginFailures = 1
+	s.LoginWindow = 50 * time.Millisecond
+	if err := s.Open(); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	if err := s.RecordLoginAttempt(1, "", false); !errors.Is(err, main.ErrAccountLocked) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	if err := s.CheckLogin(1, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	// Expired failures are removed by the reaper.
+	if n, err := s.ReapExpired(); err != nil {
+		t.Fatal(err)
+	} else if n != 1 {
+		t.Fatalf("unexpected reaped count: %d", n)
+	}
+}
+
+// Ensure lockout can be disabled.
+func TestStore_RecordLoginAttempt_Disabled(t *testing.T) {
+	s := NewStore()
+	s.MaxLoginFailures = -1
+	if err := s.Open(); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	for i := 0; i < main.DefaultMaxLoginFailures*2; i++ {
+		if err := s.RecordLoginAttempt(1, "10.0.0.1", false); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.CheckLogin(1, "10.0.0.1"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Ensure callers are locked out after repeated incorrect API keys without
+// locking out the key itself.
+func TestStore_AuthenticateAPIKey_ErrAccountLocked(t *testing.T) {
+	s := NewStore()
+	s.MaxLoginFailures = 2
+	if err := s.Open(); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	token, err := s.CreateAPIKey(&main.APIKey{Name: "deploy"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The failure that reaches the limit locks out the caller's IP address.
+	if _, err := s.AuthenticateAPIKey("1.00", "10.0.0.1"); !errors.Is(err, main.ErrAPIKeyInvalid) {
+		t.Fatalf("unexpected error: %v", err)
+	} else if _, err := s.AuthenticateAPIKey("2.00", "10.0.0.1"); !errors.Is(err, main.ErrAccountLocked) {
+		t.Fatalf("unexpected error: %v", err)
+	} else if _, err := s.AuthenticateAPIKey(token, "10.0.0.1"); !errors.Is(err, main.ErrAccountLocked) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// The key still works from other addresses.
+	if k, err := s.AuthenticateAPIKey(token, "10.0.0.2"); err != nil {
+		t.Fatal(err)
+	} else if k.Name != "deploy" {
+		t.Fatalf("unexpected key: %#v", k)
+	}
+
+	// Untracked callers are never locked out.
+	for i := 0; i < 3; i++ {
+		if _, err := s.AuthenticateAPIKey("1.00", ""); !errors.Is(err, main.ErrAPIKeyInvalid) {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+}
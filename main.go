@@ -0,0 +1,96 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// ErrUsage is returned when a command is called with invalid arguments.
+var ErrUsage = &Error{Code: EINVALID, Message: "usage"}
+
+func main() {
+	m := NewMain()
+	if err := m.Run(os.Args[1:]...); errors.Is(err, ErrUsage) {
+		os.Exit(2)
+	} else if err != nil {
+		fmt.Fprintln(m.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+// Main represents the command line program.
+type Main struct {
+	Stdin  io.Reader
+	Stdout io.Writer
+	Stderr io.Writer
+
+	// Returns the value of an environment variable.
+	Getenv func(string) string
+}
+
+// NewMain returns a new instance of Main connected to the standard streams.
+func NewMain() *Main {
+	return &Main{
+		Stdin:  os.Stdin,
+		Stdout: os.Stdout,
+		Stderr: os.Stderr,
+		Getenv: os.Getenv,
+	}
+}
+
+// Run executes the subcommand named by the first argument.
+func (m *Main) Run(args ...string) error {
+	var cmd string
+	if len(args) > 0 {
+		cmd, args = args[0], args[1:]
+	}
+
+	switch cmd {
+	case "bench":
+		return NewBenchCommand(m).Run(args...)
+	case "config":
+		return NewConfigCommand(m).Run(args...)
+	case "diff":
+		return NewDiffCommand(m).Run(args...)
+	case "import":
+		return NewImportCommand(m).Run(args...)
+	case "inspect":
+		return NewInspectCommand(m).Run(args...)
+	case "reindex":
+		return NewReindexCommand(m).Run(args...)
+	case "serve":
+		return NewServeCommand(m).Run(args...)
+	case "", "help", "-h", "--help":
+		fmt.Fprintln(m.Stderr, m.Usage())
+		return ErrUsage
+	default:
+		return fmt.Errorf("unknown command %q; see 'appdev help'", cmd)
+	}
+}
+
+// Usage returns the help message.
+func (m *Main) Usage() string {
+	return strings.TrimLeft(`
+appdev is a tool for working with the user store.
+
+Usage:
+
+	appdev command [arguments]
+
+The commands are:
+
+	bench       measure the performance of store operations
+	config      validate and print the configuration
+	diff        report changes to users between two data files
+	help        print this screen
+	import      import users from a CSV or JSON file
+	inspect     browse the buckets and keys of a data file
+	reindex     rebuild all indexes in batches
+	serve       run the HTTP server
+
+Use "appdev command -h" for more information about a command.
+`, "\n")
+}
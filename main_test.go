@@ -0,0 +1,44 @@
+package main_test
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	main "github.com/benbjohnson/application-development-using-boltdb"
+)
+
+// Ensure the usage is printed when no command is given.
+func TestMain_Run_Usage(t *testing.T) {
+	m := NewMain()
+	if err := m.Run(); !errors.Is(err, main.ErrUsage) {
+		t.Fatalf("unexpected error: %v", err)
+	} else if !strings.Contains(m.Stderr.String(), "Usage:") {
+		t.Fatalf("unexpected stderr: %s", m.Stderr.String())
+	}
+}
+
+// Ensure an unknown command returns an error.
+func TestMain_Run_UnknownCommand(t *testing.T) {
+	if err := NewMain().Run("nosuchcmd"); err == nil || !strings.Contains(err.Error(), "unknown command") {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+// Main is a test wrapper for main.Main that captures output.
+type Main struct {
+	*main.Main
+	Stdin  bytes.Buffer
+	Stdout bytes.Buffer
+	Stderr bytes.Buffer
+}
+
+// NewMain returns a new instance of Main.
+func NewMain() *Main {
+	m := &Main{Main: main.NewMain()}
+	m.Main.Stdin = &m.Stdin
+	m.Main.Stdout = &m.Stdout
+	m.Main.Stderr = &m.Stderr
+	return m
+}
@@ -0,0 +1,74 @@
+package main_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	main "github.com/benbjohnson/application-development-using-boltdb"
+)
+
+// Ensure a frozen store rejects writes but serves reads.
+func TestStore_Freeze(t *testing.T) {
+	s := OpenStore()
+	defer s.Close()
+	if err := s.CreateUser(&main.User{Username: "susy"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.Freeze(); err != nil {
+		t.Fatal(err)
+	} else if !s.Frozen() {
+		t.Fatal("expected frozen")
+	} else if err := s.CreateUser(&main.User{Username: "john"}); !errors.Is(err, main.ErrMaintenance) {
+		t.Fatalf("unexpected error: %v", err)
+	} else if err := s.SetUsername(1, "jimbo"); !errors.Is(err, main.ErrMaintenance) {
+		t.Fatalf("unexpected error: %v", err)
+	} else if u, err := s.User(1); err != nil {
+		t.Fatal(err)
+	} else if u.Username != "susy" {
+		t.Fatalf("unexpected user: %#v", u)
+	}
+
+	if err := s.Unfreeze(); err != nil {
+		t.Fatal(err)
+	} else if s.Frozen() {
+		t.Fatal("expected unfrozen")
+	} else if err := s.CreateUser(&main.User{Username: "john"}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Ensure Freeze waits for the write in progress to finish.
+func TestStore_Freeze_Drain(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+	s := NewStore()
+	s.Schema = blockingSchema("stuck", started, release)
+	if err := s.Open(); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	errc := make(chan error)
+	go func() { errc <- s.CreateUser(&main.User{Username: "stuck"}) }()
+	<-started
+
+	frozen := make(chan error)
+	go func() { frozen <- s.Freeze() }()
+	select {
+	case err := <-frozen:
+		t.Fatalf("freeze returned during write: %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(release)
+	if err := <-errc; err != nil {
+		t.Fatal(err)
+	} else if err := <-frozen; err != nil {
+		t.Fatal(err)
+	} else if u, err := s.User(1); err != nil {
+		t.Fatal(err)
+	} else if u == nil {
+		t.Fatal("expected user")
+	}
+}
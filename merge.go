@@ -0,0 +1,156 @@
+package main
+
+import (
+	"github.com/benbjohnson/application-development-using-boltdb/keys"
+)
+
+// MergeStrategy determines which values are kept when both users of a merge
+// have them.
+type MergeStrategy int
+
+// Merge strategies.
+const (
+	// Profile fields and blobs of the destination are kept. Fields the
+	// destination has not set are taken from the source.
+	MergeKeepDestination MergeStrategy = iota
+
+	// Profile fields set on the source replace those of the destination
+	// and source blobs replace destination blobs with the same name.
+	MergePreferSource
+)
+
+// The "MergedUsers" bucket maps the ID of each merged source user to the ID
+// of the user it was merged into.
+
+// MergeUsers merges the user srcID into dstID in a single transaction and
+// deletes the source. The destination keeps its ID, username, and
+// credentials. Tags are combined, profile fields and blobs are merged using
+// strategy, and identities, invites, and idempotency keys of the source are
+// moved to the destination. Flag overrides of the source are moved unless
+// the destination has its own. A tombstone records the merge for MergedInto.
+func (s *Store) MergeUsers(srcID, dstID int, strategy MergeStrategy) error {
+	if srcID == dstID {
+		return ErrMergeSameUser
+	}
+
+	return s.update("MergeUsers", func(tx *Tx) error {
+		var src, dst User
+		if err := loadUser(tx, srcID, &src); err != nil {
+			return err
+		} else if err := loadUser(tx, dstID, &dst); err != nil {
+			return err
+		}
+
+		// Merge the fields of the source into the destination.
+		prev := dst
+		dst.Tags = append([]string{}, dst.Tags...)
+		for _, tag := range src.Tags {
+			if !hasTag(dst.Tags, tag) {
+				dst.Tags = append(dst.Tags, tag)
+			}
+		}
+		for _, f := range []struct{ dst, src *string }{
+			{&dst.DisplayName, &src.DisplayName},
+			{&dst.Bio, &src.Bio},
+			{&dst.AvatarURL, &src.AvatarURL},
+			{&dst.Locale, &src.Locale},
+			{&dst.Email, &src.Email},
+		} {
+			if *f.src != "" && (*f.dst == "" || strategy == MergePreferSource) {
+				*f.dst = *f.src
+			}
+		}
+
+		// Move the records and references of the source.
+		if err := mergeUserBlobs(tx, srcID, dstID, strategy); err != nil {
+			return err
+		} else if err := reassignIdentities(tx, srcID, dstID); err != nil {
+			return err
+		} else if err := reassignInvites(tx, srcID, dstID); err != nil {
+			return err
+		} else if err := reassignIdempotencyRecords(tx, srcID, dstID); err != nil {
+			return err
+		} else if err := reassignFlagOverrides(tx, srcID, dstID); err != nil {
+			return err
+		}
+
+		changes := diffUser(&prev, &dst)
+		if err := saveUser(tx, &dst); err != nil {
+			return err
+		} else if err := recordUserRevision(tx, dstID, &dst, changes); err != nil {
+			return err
+		} else if err := recordUserEvent(tx, EventUserUpdated, &dst, changes); err != nil {
+			return err
+		}
+
+		// Delete the source and leave a tombstone.
+		if err := deleteUser(tx, srcID); err != nil {
+			return err
+		}
+		return tombstoneUser(tx, srcID, dstID)
+	})
+}
+
+// MergedInto returns the ID of the user that id was merged into or zero if
+// the user was not merged.
+func (s *Store) MergedInto(id int) (int, error) {
+	var dstID int
+	if err := s.view("MergedInto", func(tx *Tx) error {
+		if v := tx.Bucket([]byte("MergedUsers")).Get(keys.Int(id)); v != nil {
+			tx.recordRead("MergedUsers", v)
+			dstID = keys.ParseInt(v)
+		}
+		return nil
+	}); err != nil {
+		return 0, err
+	}
+	return dstID, nil
+}
+
+// mergeUserBlobs moves the blobs of srcID to dstID. Blobs that exist for
+// both users are replaced only with MergePreferSource. The remaining source
+// blobs are removed with the source user.
+func mergeUserBlobs(tx *Tx, srcID, dstID int, strategy MergeStrategy) error {
+	bkt := tx.Bucket([]byte("Blobs"))
+	sbkt := bkt.Bucket(keys.Int(srcID))
+	if sbkt == nil {
+		return nil
+	}
+
+	tx.recordWrite("Blobs", nil)
+	dbkt, err := bkt.CreateBucketIfNotExists(keys.Int(dstID))
+	if err != nil {
+		return err
+	}
+
+	return sbkt.ForEach(func(name, _ []byte) error {
+		if dbkt.Bucket(name) != nil {
+			if strategy != MergePreferSource {
+				return nil
+			} else if err := dbkt.DeleteBucket(name); err != nil {
+				return err
+			}
+		}
+
+		b, err := dbkt.CreateBucket(name)
+		if err != nil {
+			return err
+		}
+		return copyBucket(b, sbkt.Bucket(name))
+	})
+}
+
+// tombstoneUser records that srcID was merged into dstID. Earlier merges
+// into srcID are pointed at dstID.
+func tombstoneUser(tx *Tx, srcID, dstID int) error {
+	if err := reassignTombstones(tx, srcID, dstID); err != nil {
+		return err
+	}
+	tx.recordWrite("MergedUsers", nil)
+	return tx.Bucket([]byte("MergedUsers")).Put(keys.Int(srcID), keys.Int(dstID))
+}
+
+// Merge related errors.
+var (
+	ErrMergeSameUser = &Error{Code: EINVALID, Message: "cannot merge user into itself"}
+)
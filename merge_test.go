@@ -0,0 +1,133 @@
+package main_test
+
+import (
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+
+	main "github.com/benbjohnson/application-development-using-boltdb"
+)
+
+// Ensure merging keeps the destination's values by default.
+func TestStore_MergeUsers(t *testing.T) {
+	s := OpenStore()
+	defer s.Close()
+
+	if err := s.CreateUser(&main.User{Username: "susy", Tags: []string{"beta"}, Bio: "old", Locale: "en-US"}); err != nil {
+		t.Fatal(err)
+	} else if err := s.CreateUser(&main.User{Username: "susan", Tags: []string{"admin", "beta"}, Bio: "new"}); err != nil {
+		t.Fatal(err)
+	} else if err := s.PutUserBlob(1, "a.txt", strings.NewReader("src a")); err != nil {
+		t.Fatal(err)
+	} else if err := s.PutUserBlob(1, "b.txt", strings.NewReader("src b")); err != nil {
+		t.Fatal(err)
+	} else if err := s.PutUserBlob(2, "a.txt", strings.NewReader("dst a")); err != nil {
+		t.Fatal(err)
+	} else if err := s.LinkIdentity(1, "google", "1234"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.MergeUsers(1, 2, main.MergeKeepDestination); err != nil {
+		t.Fatal(err)
+	}
+
+	// The source is deleted and tombstoned.
+	if u, err := s.User(1); err != nil {
+		t.Fatal(err)
+	} else if u != nil {
+		t.Fatalf("unexpected user: %#v", u)
+	} else if id, err := s.MergedInto(1); err != nil {
+		t.Fatal(err)
+	} else if id != 2 {
+		t.Fatalf("unexpected merged id: %d", id)
+	} else if id, err := s.MergedInto(2); err != nil || id != 0 {
+		t.Fatalf("unexpected merged id: %d, %v", id, err)
+	}
+
+	// The destination keeps its values and gains the source's.
+	u, err := s.User(2)
+	if err != nil {
+		t.Fatal(err)
+	} else if u.Username != "susan" || u.Bio != "new" || u.Locale != "en-US" {
+		t.Fatalf("unexpected user: %#v", u)
+	} else if !reflect.DeepEqual(u.Tags, []string{"admin", "beta"}) {
+		t.Fatalf("unexpected tags: %v", u.Tags)
+	} else if u, err := s.UserByIdentity("google", "1234"); err != nil {
+		t.Fatal(err)
+	} else if u == nil || u.ID != 2 {
+		t.Fatalf("unexpected user: %#v", u)
+	}
+
+	if got := readBlob(t, s, 2, "a.txt"); got != "dst a" {
+		t.Fatalf("unexpected blob: %q", got)
+	} else if got := readBlob(t, s, 2, "b.txt"); got != "src b" {
+		t.Fatalf("unexpected blob: %q", got)
+	}
+}
+
+// Ensure merging can prefer the source's values.
+func TestStore_MergeUsers_PreferSource(t *testing.T) {
+	s := OpenStore()
+	defer s.Close()
+
+	if err := s.CreateUser(&main.User{Username: "susy", Bio: "new"}); err != nil {
+		t.Fatal(err)
+	} else if err := s.CreateUser(&main.User{Username: "susan", Bio: "old", Locale: "en-US"}); err != nil {
+		t.Fatal(err)
+	} else if err := s.CreateUser(&main.User{Username: "sue"}); err != nil {
+		t.Fatal(err)
+	} else if err := s.PutUserBlob(1, "a.txt", strings.NewReader("src a")); err != nil {
+		t.Fatal(err)
+	} else if err := s.PutUserBlob(2, "a.txt", strings.NewReader("dst a")); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.MergeUsers(1, 2, main.MergePreferSource); err != nil {
+		t.Fatal(err)
+	} else if u, err := s.User(2); err != nil {
+		t.Fatal(err)
+	} else if u.Bio != "new" || u.Locale != "en-US" {
+		t.Fatalf("unexpected user: %#v", u)
+	} else if got := readBlob(t, s, 2, "a.txt"); got != "src a" {
+		t.Fatalf("unexpected blob: %q", got)
+	}
+
+	// Merging the destination again updates earlier tombstones.
+	if err := s.MergeUsers(2, 3, main.MergeKeepDestination); err != nil {
+		t.Fatal(err)
+	} else if id, err := s.MergedInto(1); err != nil || id != 3 {
+		t.Fatalf("unexpected merged id: %d, %v", id, err)
+	}
+}
+
+// Ensure merges validate their users.
+func TestStore_MergeUsers_Err(t *testing.T) {
+	s := OpenStore()
+	defer s.Close()
+
+	if err := s.CreateUser(&main.User{Username: "susy"}); err != nil {
+		t.Fatal(err)
+	} else if err := s.MergeUsers(1, 1, main.MergeKeepDestination); !errors.Is(err, main.ErrMergeSameUser) {
+		t.Fatalf("unexpected error: %v", err)
+	} else if err := s.MergeUsers(1, 2, main.MergeKeepDestination); !errors.Is(err, main.ErrUserNotFound) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+// readBlob returns the contents of a user's blob.
+func readBlob(tb testing.TB, s *Store, userID int, name string) string {
+	tb.Helper()
+	rc, err := s.UserBlob(userID, name)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	defer rc.Close()
+
+	buf, err := io.ReadAll(rc)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return string(buf)
+}
@@ -0,0 +1,143 @@
+// Package metrics exposes Prometheus metrics for the store.
+package metrics
+
+import (
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Namespace is the prefix used for all metric names.
+const Namespace = "appdevbolt"
+
+// Metrics records measurements of store operations.
+type Metrics struct {
+	opDuration *prometheus.HistogramVec
+	opErrors   *prometheus.CounterVec
+	txRetries  *prometheus.CounterVec
+	purged     *prometheus.CounterVec
+}
+
+// New returns a new instance of Metrics registered on reg.
+func New(reg prometheus.Registerer) *Metrics {
+	m := &Metrics{
+		opDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: Namespace,
+			Subsystem: "store",
+			Name:      "operation_duration_seconds",
+			Help:      "Latency of store operations.",
+			Buckets:   prometheus.ExponentialBuckets(0.00001, 4, 10),
+		}, []string{"op", "writable"}),
+
+		opErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: Namespace,
+			Subsystem: "store",
+			Name:      "operation_errors_total",
+			Help:      "Number of store operations that returned an error.",
+		}, []string{"op"}),
+
+		txRetries: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: Namespace,
+			Subsystem: "store",
+			Name:      "tx_retries_total",
+			Help:      "Number of times a store transaction was retried.",
+		}, []string{"op"}),
+
+		purged: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: Namespace,
+			Subsystem: "store",
+			Name:      "retention_purged_total",
+			Help:      "Number of records removed by retention policies.",
+		}, []string{"target"}),
+	}
+	reg.MustRegister(m.opDuration, m.opErrors, m.txRetries, m.purged)
+	return m
+}
+
+// ObserveTx records the duration and result of a store operation.
+func (m *Metrics) ObserveTx(op string, writable bool, d time.Duration, err error) {
+	w := "false"
+	if writable {
+		w = "true"
+	}
+	m.opDuration.WithLabelValues(op, w).Observe(d.Seconds())
+
+	if err != nil {
+		m.opErrors.WithLabelValues(op).Inc()
+	}
+}
+
+// ObserveRetry records that a transaction for op was retried.
+func (m *Metrics) ObserveRetry(op string) {
+	m.txRetries.WithLabelValues(op).Inc()
+}
+
+// ObservePurge records that n records of target were removed by a
+// retention policy.
+func (m *Metrics) ObservePurge(target string, n int) {
+	m.purged.WithLabelValues(target).Add(float64(n))
+}
+
+// StatsSource represents a source of bolt database statistics.
+type StatsSource interface {
+	Stats() bolt.Stats
+}
+
+// Collector collects bolt database statistics on each scrape.
+type Collector struct {
+	src StatsSource
+
+	freePages     *prometheus.Desc
+	pendingPages  *prometheus.Desc
+	freeAlloc     *prometheus.Desc
+	freelistInuse *prometheus.Desc
+	txTotal       *prometheus.Desc
+	txOpen        *prometheus.Desc
+	pageAlloc     *prometheus.Desc
+	writes        *prometheus.Desc
+}
+
+// NewCollector returns a new collector for the statistics of src.
+func NewCollector(src StatsSource) *Collector {
+	desc := func(name, help string) *prometheus.Desc {
+		return prometheus.NewDesc(prometheus.BuildFQName(Namespace, "bolt", name), help, nil, nil)
+	}
+
+	return &Collector{
+		src:           src,
+		freePages:     desc("freelist_free_pages", "Number of free pages on the freelist."),
+		pendingPages:  desc("freelist_pending_pages", "Number of pending pages on the freelist."),
+		freeAlloc:     desc("freelist_free_alloc_bytes", "Total bytes allocated in free pages."),
+		freelistInuse: desc("freelist_inuse_bytes", "Total bytes used by the freelist."),
+		txTotal:       desc("tx_started_total", "Total number of started read transactions."),
+		txOpen:        desc("tx_open", "Number of currently open read transactions."),
+		pageAlloc:     desc("tx_page_alloc_bytes_total", "Total bytes allocated by transactions."),
+		writes:        desc("tx_writes_total", "Total number of page writes."),
+	}
+}
+
+// Describe sends the descriptors of each metric to ch.
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.freePages
+	ch <- c.pendingPages
+	ch <- c.freeAlloc
+	ch <- c.freelistInuse
+	ch <- c.txTotal
+	ch <- c.txOpen
+	ch <- c.pageAlloc
+	ch <- c.writes
+}
+
+// Collect reads the current statistics and sends them to ch.
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	stats := c.src.Stats()
+	ch <- prometheus.MustNewConstMetric(c.freePages, prometheus.GaugeValue, float64(stats.FreePageN))
+	ch <- prometheus.MustNewConstMetric(c.pendingPages, prometheus.GaugeValue, float64(stats.PendingPageN))
+	ch <- prometheus.MustNewConstMetric(c.freeAlloc, prometheus.GaugeValue, float64(stats.FreeAlloc))
+	ch <- prometheus.MustNewConstMetric(c.freelistInuse, prometheus.GaugeValue, float64(stats.FreelistInuse))
+	ch <- prometheus.MustNewConstMetric(c.txTotal, prometheus.CounterValue, float64(stats.TxN))
+	ch <- prometheus.MustNewConstMetric(c.txOpen, prometheus.GaugeValue, float64(stats.OpenTxN))
+	ch <- prometheus.MustNewConstMetric(c.pageAlloc, prometheus.CounterValue, float64(stats.TxStats.PageAlloc))
+	ch <- prometheus.MustNewConstMetric(c.writes, prometheus.CounterValue, float64(stats.TxStats.Write))
+}
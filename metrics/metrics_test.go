@@ -0,0 +1,84 @@
+package metrics_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/benbjohnson/application-development-using-boltdb/metrics"
+	"github.com/boltdb/bolt"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// Ensure operations are recorded as latency observations and errors.
+func TestMetrics_ObserveTx(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	m := metrics.New(reg)
+
+	m.ObserveTx("User", false, time.Millisecond, nil)
+	m.ObserveTx("CreateUser", true, time.Millisecond, errors.New("marker"))
+	m.ObserveRetry("CreateUser")
+	m.ObservePurge("dead_jobs", 3)
+
+	// Verify a histogram exists for each operation.
+	if mfs, err := reg.Gather(); err != nil {
+		t.Fatal(err)
+	} else if mf := findFamily(mfs, "appdevbolt_store_operation_duration_seconds"); mf == nil {
+		t.Fatal("expected histogram")
+	} else if n := len(mf.GetMetric()); n != 2 {
+		t.Fatalf("unexpected histogram count: %d", n)
+	}
+
+	if err := testutil.GatherAndCompare(reg, strings.NewReader(`
+# HELP appdevbolt_store_operation_errors_total Number of store operations that returned an error.
+# TYPE appdevbolt_store_operation_errors_total counter
+appdevbolt_store_operation_errors_total{op="CreateUser"} 1
+# HELP appdevbolt_store_retention_purged_total Number of records removed by retention policies.
+# TYPE appdevbolt_store_retention_purged_total counter
+appdevbolt_store_retention_purged_total{target="dead_jobs"} 3
+# HELP appdevbolt_store_tx_retries_total Number of times a store transaction was retried.
+# TYPE appdevbolt_store_tx_retries_total counter
+appdevbolt_store_tx_retries_total{op="CreateUser"} 1
+`), "appdevbolt_store_operation_errors_total", "appdevbolt_store_retention_purged_total", "appdevbolt_store_tx_retries_total"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Ensure the collector reports bolt statistics.
+func TestCollector(t *testing.T) {
+	c := metrics.NewCollector(statsFunc(func() bolt.Stats {
+		return bolt.Stats{FreePageN: 3, PendingPageN: 2, OpenTxN: 1}
+	}))
+
+	if err := testutil.CollectAndCompare(c, strings.NewReader(`
+# HELP appdevbolt_bolt_freelist_free_pages Number of free pages on the freelist.
+# TYPE appdevbolt_bolt_freelist_free_pages gauge
+appdevbolt_bolt_freelist_free_pages 3
+# HELP appdevbolt_bolt_freelist_pending_pages Number of pending pages on the freelist.
+# TYPE appdevbolt_bolt_freelist_pending_pages gauge
+appdevbolt_bolt_freelist_pending_pages 2
+# HELP appdevbolt_bolt_tx_open Number of currently open read transactions.
+# TYPE appdevbolt_bolt_tx_open gauge
+appdevbolt_bolt_tx_open 1
+`), "appdevbolt_bolt_freelist_free_pages", "appdevbolt_bolt_freelist_pending_pages", "appdevbolt_bolt_tx_open"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// findFamily returns the metric family with the given name, if it exists.
+func findFamily(mfs []*dto.MetricFamily, name string) *dto.MetricFamily {
+	for _, mf := range mfs {
+		if mf.GetName() == name {
+			return mf
+		}
+	}
+	return nil
+}
+
+// statsFunc implements metrics.StatsSource with a function.
+type statsFunc func() bolt.Stats
+
+func (fn statsFunc) Stats() bolt.Stats { return fn() }
@@ -0,0 +1,137 @@
+package main_test
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"reflect"
+	"testing"
+
+	main "github.com/benbjohnson/application-development-using-boltdb"
+)
+
+// Ensure random sequences of operations leave the store in the same state
+// as a simple in-memory model of it.
+//
+// Each byte of the input selects an operation and its arguments. Seeds are
+// random sequences so "go test" covers a variety of sequences while
+// "go test -fuzz" explores new ones.
+func FuzzStore_Model(f *testing.F) {
+	rng := rand.New(rand.NewSource(0))
+	for i := 0; i < 20; i++ {
+		ops := make([]byte, 50)
+		rng.Read(ops)
+		f.Add(ops)
+	}
+
+	f.Fuzz(func(t *testing.T, ops []byte) {
+		s := OpenStore()
+		defer s.Close()
+
+		m := make(map[int]*main.User)
+		var nextID int
+		for i, op := range ops {
+			id := int(op>>3)%(nextID+1) + 1 // may reference a missing user
+			name := fmt.Sprintf("user%d", op>>4)
+			tag := fmt.Sprintf("tag%d", op>>6)
+
+			switch op % 6 {
+			case 0, 1:
+				u := &main.User{Username: name}
+				if err := s.CreateUser(u); usernameTaken(m, 0, name) {
+					if !errors.Is(err, main.ErrUsernameTaken) {
+						t.Fatalf("%d: unexpected error: %v", i, err)
+					}
+					break
+				} else if err != nil {
+					t.Fatal(err)
+				}
+				nextID++
+				m[u.ID] = &main.User{ID: u.ID, Username: name, CreatedAt: u.CreatedAt}
+
+			case 2:
+				err := s.SetUsername(id, name)
+				if u := m[id]; u == nil && !errors.Is(err, main.ErrUserNotFound) {
+					t.Fatalf("%d: unexpected error: %v", i, err)
+				} else if u != nil && usernameTaken(m, id, name) {
+					if !errors.Is(err, main.ErrUsernameTaken) {
+						t.Fatalf("%d: unexpected error: %v", i, err)
+					}
+				} else if u != nil && err != nil {
+					t.Fatalf("%d: unexpected error: %v", i, err)
+				} else if u != nil {
+					u.Username = name
+				}
+
+			case 3:
+				if err := s.DeleteUser(id); err != nil {
+					t.Fatal(err)
+				}
+				delete(m, id)
+
+			case 4:
+				err := s.AddTag(id, tag)
+				if u := m[id]; u == nil && !errors.Is(err, main.ErrUserNotFound) {
+					t.Fatalf("%d: unexpected error: %v", i, err)
+				} else if u != nil && err != nil {
+					t.Fatalf("%d: unexpected error: %v", i, err)
+				} else if u != nil && !containsString(u.Tags, tag) {
+					u.Tags = append(u.Tags, tag)
+				}
+
+			case 5:
+				if err := s.Reopen(); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			verifyModel(t, s, m)
+		}
+
+		if a, err := s.CheckIntegrity(); err != nil {
+			t.Fatal(err)
+		} else if len(a) != 0 {
+			t.Fatalf("unexpected violations: %v", a)
+		}
+	})
+}
+
+// verifyModel fails the test if the users in s do not match m.
+func verifyModel(tb testing.TB, s *Store, m map[int]*main.User) {
+	tb.Helper()
+
+	a, err := s.Users()
+	if err != nil {
+		tb.Fatal(err)
+	} else if len(a) != len(m) {
+		tb.Fatalf("unexpected user count: %d != %d", len(a), len(m))
+	}
+	for _, u := range a {
+		if len(u.Tags) == 0 {
+			u.Tags = nil
+		}
+		if !reflect.DeepEqual(u, m[u.ID]) {
+			tb.Fatalf("unexpected user: %#v != %#v", u, m[u.ID])
+		}
+	}
+}
+
+// usernameTaken returns true if a user in m other than id has username.
+func usernameTaken(m map[int]*main.User, id int, username string) bool {
+	for _, u := range m {
+		if u.ID != id && u.Username == username {
+			return true
+		}
+	}
+	return false
+}
+
+// containsString returns true if a contains v.
+func containsString(a []string, v string) bool {
+	for _, s := range a {
+		if s == v {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"log/slog"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Option configures a Store created with NewStore.
+type Option func(*Store)
+
+// NewStore returns a store for the data file at path configured by opts.
+// The store must be opened with Open before use.
+//
+// Options set the same fields as the exported Store fields and are applied
+// in order, so later options override earlier ones.
+func NewStore(path string, opts ...Option) *Store {
+	s := &Store{Path: path}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// WithReadOnly opens the data file read-only.
+func WithReadOnly() Option {
+	return func(s *Store) { s.ReadOnly = true }
+}
+
+// WithLockTimeout sets the duration Open waits for the data file lock.
+func WithLockTimeout(d time.Duration) Option {
+	return func(s *Store) { s.LockTimeout = d }
+}
+
+// WithBoltOptions sets the options used to open the bolt database. The
+// timeout, read-only flag, and initial mmap size are copied to LockTimeout,
+// ReadOnly, and InitialMmapSize if set. Other options are passed to bolt
+// as is.
+func WithBoltOptions(opts *bolt.Options) Option {
+	return func(s *Store) {
+		s.boltOptions = *opts
+		if opts.Timeout > 0 {
+			s.LockTimeout = opts.Timeout
+		}
+		if opts.ReadOnly {
+			s.ReadOnly = true
+		}
+		if opts.InitialMmapSize > 0 {
+			s.InitialMmapSize = opts.InitialMmapSize
+		}
+	}
+}
+
+// WithLogger sets the logger that receives store events.
+func WithLogger(logger *slog.Logger) Option {
+	return func(s *Store) { s.Logger = logger }
+}
+
+// WithMetrics sets the recorder of operation latency and errors.
+func WithMetrics(m MetricsRecorder) Option {
+	return func(s *Store) { s.Metrics = m }
+}
+
+// WithTracerProvider sets the provider used to create spans.
+func WithTracerProvider(tp trace.TracerProvider) Option {
+	return func(s *Store) { s.TracerProvider = tp }
+}
+
+// WithCompression compresses user values of at least threshold bytes with c.
+func WithCompression(c Compression, threshold int) Option {
+	return func(s *Store) { s.Compression, s.CompressionThreshold = c, threshold }
+}
+
+// WithSecretKey sets the key used to encrypt secrets at rest.
+func WithSecretKey(key []byte) Option {
+	return func(s *Store) { s.SecretKey = key }
+}
+
+// WithSchema sets the buckets and indexes of the store.
+func WithSchema(schema *Schema) Option {
+	return func(s *Store) { s.Schema = schema }
+}
+
+// WithBucketPrefix prefixes every top-level bucket name with prefix.
+func WithBucketPrefix(prefix string) Option {
+	return func(s *Store) { s.BucketPrefix = prefix }
+}
+
+// WithIDGenerator sets the generator of IDs for new records.
+func WithIDGenerator(g IDGenerator) Option {
+	return func(s *Store) { s.IDGenerator = g }
+}
@@ -0,0 +1,64 @@
+package main_test
+
+import (
+	"bytes"
+	"log/slog"
+	"os"
+	"testing"
+	"time"
+
+	main "github.com/benbjohnson/application-development-using-boltdb"
+	"github.com/boltdb/bolt"
+)
+
+// Ensure options configure a new store.
+func TestNewStore(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, nil))
+	s := main.NewStore("/tmp/db",
+		main.WithLogger(logger),
+		main.WithCompression(main.SnappyCompression, 64),
+		main.WithBoltOptions(&bolt.Options{Timeout: time.Second, InitialMmapSize: 1 << 20}),
+		main.WithSecretKey([]byte("0123456789abcdef")),
+	)
+
+	if s.Path != "/tmp/db" {
+		t.Fatalf("unexpected path: %s", s.Path)
+	} else if s.Logger != logger {
+		t.Fatal("unexpected logger")
+	} else if s.Compression != main.SnappyCompression || s.CompressionThreshold != 64 {
+		t.Fatalf("unexpected compression: %v, %d", s.Compression, s.CompressionThreshold)
+	} else if s.LockTimeout != time.Second || s.InitialMmapSize != 1<<20 {
+		t.Fatalf("unexpected bolt options: %v, %d", s.LockTimeout, s.InitialMmapSize)
+	} else if string(s.SecretKey) != "0123456789abcdef" {
+		t.Fatalf("unexpected secret key: %q", s.SecretKey)
+	} else if s.ReadOnly {
+		t.Fatal("expected writable store")
+	}
+}
+
+// Ensure a store opened with WithReadOnly rejects writes.
+func TestNewStore_ReadOnly(t *testing.T) {
+	s := OpenStore()
+	path := s.Path
+	if err := s.CreateUser(&main.User{Username: "susy"}); err != nil {
+		t.Fatal(err)
+	} else if err := s.Store.Close(); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(path)
+
+	other := main.NewStore(path, main.WithReadOnly())
+	if err := other.Open(); err != nil {
+		t.Fatal(err)
+	}
+	defer other.Close()
+
+	if u, err := other.User(1); err != nil {
+		t.Fatal(err)
+	} else if u == nil || u.Username != "susy" {
+		t.Fatalf("unexpected user: %#v", u)
+	} else if err := other.CreateUser(&main.User{Username: "jimbo"}); err == nil {
+		t.Fatal("expected error")
+	}
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/benbjohnson/application-development-using-boltdb/internal"
+	"github.com/benbjohnson/application-development-using-boltdb/keys"
+	"github.com/gogo/protobuf/proto"
+)
+
+// Event types recorded in the outbox.
+const (
+	EventUserCreated = "user.created"
+	EventUserUpdated = "user.updated"
+	EventUserDeleted = "user.deleted"
+
+	// Password resets are recorded so they can be audited. See
+	// CreatePasswordReset.
+	EventPasswordResetRequested = "user.password_reset_requested"
+	EventPasswordReset          = "user.password_reset"
+)
+
+// Relay defaults.
+const (
+	DefaultRelayInterval  = 1 * time.Second
+	DefaultRelayBatchSize = 100
+)
+
+// Event represents a change to the store that is published to external
+// systems.
+type Event struct {
+	ID        int
+	Type      string
+	UserID    int
+	Data      []byte // encoded user, if the user still exists
+	CreatedAt time.Time
+
+	// Fields changed by an update. Empty for other event types.
+	Changes []FieldChange
+}
+
+// User decodes the user attached to the event.
+// Returns nil for events without user data, such as deletions.
+func (e *Event) User() (*User, error) {
+	if e.Data == nil {
+		return nil, nil
+	}
+	u := &User{}
+	if err := u.UnmarshalBinary(e.Data); err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
+// MarshalBinary encodes an event to binary format.
+func (e *Event) MarshalBinary() ([]byte, error) {
+	return proto.Marshal(&internal.Event{
+		ID:        proto.Int64(int64(e.ID)),
+		Type:      proto.String(e.Type),
+		UserID:    proto.Int64(int64(e.UserID)),
+		Data:      e.Data,
+		CreatedAt: proto.Int64(encodeTime(e.CreatedAt)),
+		Changes:   encodeChanges(e.Changes),
+	})
+}
+
+// UnmarshalBinary decodes an event from binary data.
+func (e *Event) UnmarshalBinary(data []byte) error {
+	var pb internal.Event
+	if err := proto.Unmarshal(data, &pb); err != nil {
+		return err
+	}
+
+	e.ID = int(pb.GetID())
+	e.Type = pb.GetType()
+	e.UserID = int(pb.GetUserID())
+	e.Data = pb.GetData()
+	e.CreatedAt = decodeTime(pb.GetCreatedAt())
+	e.Changes = decodeChanges(pb.GetChanges())
+
+	return nil
+}
+
+// Publisher delivers events to an external system such as Kafka or NATS.
+type Publisher interface {
+	Publish(ctx context.Context, e *Event) error
+}
+
+// recordUserEvent writes an event for a change to u to the outbox if the
+// store has the outbox enabled. The event commits or rolls back along with
+// the change itself. changes lists the fields changed by an update.
+func recordUserEvent(tx *Tx, typ string, u *User, changes []FieldChange) error {
+	if !tx.store.Outbox {
+		return nil
+	}
+
+	bkt := tx.Bucket([]byte("Outbox"))
+	seq, err := bkt.NextSequence()
+	if err != nil {
+		return err
+	}
+
+	e := &Event{ID: int(seq), Type: typ, UserID: u.ID, CreatedAt: time.Now().UTC(), Changes: changes}
+	if typ != EventUserDeleted {
+		if e.Data, err = u.MarshalBinary(); err != nil {
+			return err
+		}
+	}
+
+	buf, err := e.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	tx.recordWrite("Outbox", buf)
+	return bkt.Put(keys.Int(e.ID), buf)
+}
+
+// Relay publishes events from a store's outbox and removes them once they
+// are delivered. Events are published in order and at least once: an event
+// may be published again if the relay stops before it is removed.
+type Relay struct {
+	closing chan struct{}
+	wg      sync.WaitGroup
+
+	// Store to read events from.
+	Store *Store
+
+	// Destination for events.
+	Publisher Publisher
+
+	// Time between checks for new events. Defaults to DefaultRelayInterval.
+	Interval time.Duration
+
+	// Maximum number of events published per flush.
+	// Defaults to DefaultRelayBatchSize.
+	BatchSize int
+}
+
+// Open starts publishing events in the background.
+func (r *Relay) Open() error {
+	r.closing = make(chan struct{})
+	r.wg.Add(1)
+	go func() { defer r.wg.Done(); r.monitor() }()
+	return nil
+}
+
+// Close stops publishing events.
+func (r *Relay) Close() error {
+	if r.closing != nil {
+		close(r.closing)
+		r.wg.Wait()
+		r.closing = nil
+	}
+	return nil
+}
+
+// monitor flushes the outbox on every interval until the relay is closed.
+func (r *Relay) monitor() {
+	interval := r.Interval
+	if interval <= 0 {
+		interval = DefaultRelayInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-r.closing:
+			return
+		case <-ticker.C:
+			for {
+				n, err := r.Flush(context.Background())
+				if err != nil {
+					r.Store.logger().Error("relay failed", "err", err)
+				}
+				if err != nil || n < r.batchSize() {
+					break
+				}
+			}
+		}
+	}
+}
+
+// Flush publishes the next batch of events and returns the number published.
+// Publishing stops at the first error so events are never delivered out of
+// order; events published before the error are still removed.
+func (r *Relay) Flush(ctx context.Context) (int, error) {
+	// Read a batch of pending events.
+	var events []*Event
+	if err := r.Store.view("Relay", func(tx *Tx) error {
+		c := tx.Bucket([]byte("Outbox")).Cursor()
+		for k, v := c.First(); k != nil && len(events) < r.batchSize(); k, v = c.Next() {
+			tx.recordRead("Outbox", v)
+
+			e := &Event{}
+			if err := e.UnmarshalBinary(v); err != nil {
+				return err
+			}
+			events = append(events, e)
+		}
+		return nil
+	}); err != nil {
+		return 0, err
+	}
+
+	// Publish outside of a transaction so slow publishers don't block writers.
+	var n int
+	var pubErr error
+	for _, e := range events {
+		if pubErr = r.Publisher.Publish(ctx, e); pubErr != nil {
+			break
+		}
+		n++
+	}
+
+	// Remove delivered events.
+	if n > 0 {
+		if err := r.Store.update("RelayAck", func(tx *Tx) error {
+			bkt := tx.Bucket([]byte("Outbox"))
+			for _, e := range events[:n] {
+				tx.recordDelete("Outbox")
+				if err := bkt.Delete(keys.Int(e.ID)); err != nil {
+					return err
+				}
+			}
+			return nil
+		}); err != nil {
+			return 0, err
+		}
+	}
+	return n, pubErr
+}
+
+// batchSize returns the configured batch size or the default, if unset.
+func (r *Relay) batchSize() int {
+	if r.BatchSize <= 0 {
+		return DefaultRelayBatchSize
+	}
+	return r.BatchSize
+}
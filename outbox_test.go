@@ -0,0 +1,167 @@
+package main_test
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	main "github.com/benbjohnson/application-development-using-boltdb"
+)
+
+// Ensure user changes are published in order and removed once delivered.
+func TestRelay_Flush(t *testing.T) {
+	s := OpenStore()
+	defer s.Close()
+	s.Outbox = true
+
+	if err := s.CreateUser(&main.User{Username: "susy"}); err != nil {
+		t.Fatal(err)
+	} else if err := s.SetUsername(1, "jimbo"); err != nil {
+		t.Fatal(err)
+	} else if err := s.AddTag(1, "beta"); err != nil {
+		t.Fatal(err)
+	} else if err := s.DeleteUser(1); err != nil {
+		t.Fatal(err)
+	}
+
+	var p Publisher
+	r := &main.Relay{Store: s.Store, Publisher: &p}
+	if n, err := r.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	} else if n != 4 {
+		t.Fatalf("unexpected count: %d", n)
+	} else if !reflect.DeepEqual(p.Types(), []string{"user.created", "user.updated", "user.updated", "user.deleted"}) {
+		t.Fatalf("unexpected events: %v", p.Types())
+	}
+
+	// Events carry the user as of the change.
+	if u, err := p.Events()[1].User(); err != nil {
+		t.Fatal(err)
+	} else if u.Username != "jimbo" {
+		t.Fatalf("unexpected user: %#v", u)
+	} else if u, err := p.Events()[3].User(); err != nil {
+		t.Fatal(err)
+	} else if u != nil {
+		t.Fatalf("unexpected user: %#v", u)
+	}
+
+	// Delivered events are not published again.
+	if n, err := r.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	} else if n != 0 {
+		t.Fatalf("unexpected count: %d", n)
+	}
+}
+
+// Ensure events are not recorded when the outbox is disabled or the change
+// rolls back.
+func TestRelay_Flush_NoEvents(t *testing.T) {
+	s := OpenStore()
+	defer s.Close()
+
+	if err := s.CreateUser(&main.User{Username: "susy"}); err != nil {
+		t.Fatal(err)
+	}
+	s.Outbox = true
+	if err := s.SetUsername(2, "john"); !errors.Is(err, main.ErrUserNotFound) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var p Publisher
+	r := &main.Relay{Store: s.Store, Publisher: &p}
+	if n, err := r.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	} else if n != 0 {
+		t.Fatalf("unexpected count: %d", n)
+	}
+}
+
+// Ensure events after a failed publish are retried on the next flush.
+func TestRelay_Flush_PublishError(t *testing.T) {
+	s := OpenStore()
+	defer s.Close()
+	s.Outbox = true
+
+	for _, username := range []string{"susy", "john", "jane"} {
+		if err := s.CreateUser(&main.User{Username: username}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Fail on the second event.
+	p := Publisher{FailAfter: 1}
+	r := &main.Relay{Store: s.Store, Publisher: &p}
+	if n, err := r.Flush(context.Background()); err == nil || err.Error() != "broker unavailable" {
+		t.Fatalf("unexpected error: %v", err)
+	} else if n != 1 {
+		t.Fatalf("unexpected count: %d", n)
+	}
+
+	// The remaining events are published once the publisher recovers.
+	p.FailAfter = 0
+	if n, err := r.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	} else if n != 2 {
+		t.Fatalf("unexpected count: %d", n)
+	} else if len(p.Events()) != 3 || p.Events()[2].UserID != 3 {
+		t.Fatalf("unexpected events: %#v", p.Events())
+	}
+}
+
+// Ensure the relay publishes events in the background.
+func TestRelay_Open(t *testing.T) {
+	s := OpenStore()
+	defer s.Close()
+	s.Outbox = true
+
+	var p Publisher
+	r := &main.Relay{Store: s.Store, Publisher: &p, Interval: 10 * time.Millisecond}
+	if err := r.Open(); err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	if err := s.CreateUser(&main.User{Username: "susy"}); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, func() bool { return len(p.Events()) == 1 })
+}
+
+// Publisher is an in-memory implementation of main.Publisher.
+type Publisher struct {
+	mu     sync.Mutex
+	events []*main.Event
+
+	// If set, publishing fails once this many events have been published.
+	FailAfter int
+}
+
+// Publish records e.
+func (p *Publisher) Publish(ctx context.Context, e *main.Event) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.FailAfter > 0 && len(p.events) >= p.FailAfter {
+		return errors.New("broker unavailable")
+	}
+	p.events = append(p.events, e)
+	return nil
+}
+
+// Events returns all published events.
+func (p *Publisher) Events() []*main.Event {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]*main.Event{}, p.events...)
+}
+
+// Types returns the type of each published event.
+func (p *Publisher) Types() []string {
+	var a []string
+	for _, e := range p.Events() {
+		a = append(a, e.Type)
+	}
+	return a
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"encoding/binary"
+
+	"github.com/benbjohnson/application-development-using-boltdb/keys"
+)
+
+// overflowTag follows compressedMarker in values that point to chunks in the
+// Overflow bucket instead of holding the data themselves.
+const overflowTag = 0xFF
+
+// overflowChunkSize is the size of each chunk in the Overflow bucket. Chunks
+// are small enough that several fit on a page so large values never require
+// runs of contiguous overflow pages.
+const overflowChunkSize = 2048
+
+// overflowPointerSize is the size of a pointer value: the 2-byte header,
+// the overflow ID, and the chunk count.
+const overflowPointerSize = 2 + 8 + 4
+
+// putValue writes v to key in the named bucket. Values larger than the
+// store's OverflowThreshold are written to the Overflow bucket and a pointer
+// is stored in their place. Chunks of any previous value are removed.
+func putValue(tx *Tx, name string, key, v []byte) error {
+	if err := checkValueSize(tx, len(v)); err != nil {
+		return err
+	}
+
+	// Update indexes before freeing any chunks of the previous value.
+	bkt := tx.Bucket([]byte(name))
+	prev := bkt.Get(key)
+	if err := updateIndexes(tx, name, key, prev, v); err != nil {
+		return err
+	} else if err := updateViews(tx, name, key, prev, v); err != nil {
+		return err
+	} else if err := freeOverflow(tx, prev); err != nil {
+		return err
+	} else if name == "Users" {
+		if err := tx.cacheUserWrite(key, v); err != nil {
+			return err
+		}
+	}
+
+	if threshold := tx.store.OverflowThreshold; threshold > 0 && len(v) > threshold {
+		ptr, err := writeOverflow(tx, v)
+		if err != nil {
+			return err
+		}
+		v = ptr
+	}
+
+	tx.recordWrite(name, v)
+	return bkt.Put(key, v)
+}
+
+// deleteValue removes key from the named bucket along with any chunks it
+// points to.
+func deleteValue(tx *Tx, name string, key []byte) error {
+	bkt := tx.Bucket([]byte(name))
+	prev := bkt.Get(key)
+	if err := updateIndexes(tx, name, key, prev, nil); err != nil {
+		return err
+	} else if err := updateViews(tx, name, key, prev, nil); err != nil {
+		return err
+	} else if err := freeOverflow(tx, prev); err != nil {
+		return err
+	} else if name == "Users" {
+		if err := tx.cacheUserWrite(key, nil); err != nil {
+			return err
+		}
+	}
+
+	tx.recordDelete(name)
+	return bkt.Delete(key)
+}
+
+// readOverflow returns the value that v points to, or v itself if it is not
+// an overflow pointer.
+func readOverflow(tx *Tx, v []byte) ([]byte, error) {
+	id, n, ok := parseOverflowPointer(v)
+	if !ok {
+		return v, nil
+	}
+
+	bkt := tx.Bucket([]byte("Overflow"))
+	buf := make([]byte, 0, n*overflowChunkSize)
+	for i := 0; i < n; i++ {
+		chunk := bkt.Get(keys.Join(keys.Int(id), keys.Int(i)))
+		if chunk == nil {
+			return nil, ErrOverflowChunkNotFound
+		}
+		tx.recordRead("Overflow", chunk)
+		buf = append(buf, chunk...)
+	}
+	return buf, nil
+}
+
+// writeOverflow splits v into chunks in the Overflow bucket and returns a
+// pointer to them.
+func writeOverflow(tx *Tx, v []byte) ([]byte, error) {
+	bkt := tx.Bucket([]byte("Overflow"))
+	seq, err := bkt.NextSequence()
+	if err != nil {
+		return nil, err
+	}
+	id := int(seq)
+
+	var n int
+	for ; len(v) > 0; n++ {
+		chunk := v
+		if len(chunk) > overflowChunkSize {
+			chunk = chunk[:overflowChunkSize]
+		}
+		v = v[len(chunk):]
+
+		tx.recordWrite("Overflow", chunk)
+		if err := bkt.Put(keys.Join(keys.Int(id), keys.Int(n)), chunk); err != nil {
+			return nil, err
+		}
+	}
+
+	ptr := make([]byte, overflowPointerSize)
+	ptr[0], ptr[1] = compressedMarker, overflowTag
+	copy(ptr[2:10], keys.Int(id))
+	binary.BigEndian.PutUint32(ptr[10:14], uint32(n))
+	return ptr, nil
+}
+
+// freeOverflow removes the chunks that v points to, if any.
+func freeOverflow(tx *Tx, v []byte) error {
+	id, n, ok := parseOverflowPointer(v)
+	if !ok {
+		return nil
+	}
+
+	bkt := tx.Bucket([]byte("Overflow"))
+	for i := 0; i < n; i++ {
+		tx.recordDelete("Overflow")
+		if err := bkt.Delete(keys.Join(keys.Int(id), keys.Int(i))); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parseOverflowPointer returns the overflow ID and chunk count of v.
+// Returns false if v is not an overflow pointer.
+func parseOverflowPointer(v []byte) (id, n int, ok bool) {
+	if len(v) != overflowPointerSize || v[0] != compressedMarker || v[1] != overflowTag {
+		return 0, 0, false
+	}
+	return keys.ParseInt(v[2:10]), int(binary.BigEndian.Uint32(v[10:14])), true
+}
+
+// Overflow related errors.
+var (
+	ErrOverflowChunkNotFound = &Error{Code: EINTERNAL, Message: "overflow chunk not found"}
+)
@@ -0,0 +1,78 @@
+package main_test
+
+import (
+	"strings"
+	"testing"
+
+	main "github.com/benbjohnson/application-development-using-boltdb"
+	"github.com/boltdb/bolt"
+)
+
+// Ensure large values are split into chunks and reassembled on read.
+func TestStore_OverflowThreshold(t *testing.T) {
+	s := OpenStore()
+	defer s.Close()
+	s.OverflowThreshold = 1000
+
+	tags := []string{strings.Repeat("x", 10000)}
+	if err := s.CreateUser(&main.User{Username: "susy", Tags: tags}); err != nil {
+		t.Fatal(err)
+	} else if err := s.CreateUser(&main.User{Username: "john"}); err != nil {
+		t.Fatal(err)
+	} else if n := overflowChunks(t, s); n != 5 {
+		t.Fatalf("unexpected chunk count: %d", n)
+	}
+
+	// Read the user back directly and from a scan.
+	if u, err := s.User(1); err != nil {
+		t.Fatal(err)
+	} else if u.Tags[0] != tags[0] {
+		t.Fatal("unexpected tags")
+	} else if a, err := s.Users(); err != nil {
+		t.Fatal(err)
+	} else if len(a) != 2 || a[0].Tags[0] != tags[0] {
+		t.Fatalf("unexpected users: %v", usernames(a))
+	}
+
+	// Shrinking the user removes its chunks.
+	if err := s.RemoveTag(1, tags[0]); err != nil {
+		t.Fatal(err)
+	} else if n := overflowChunks(t, s); n != 0 {
+		t.Fatalf("unexpected chunk count: %d", n)
+	}
+
+	// Deleting a user removes its chunks.
+	if err := s.AddTag(1, tags[0]); err != nil {
+		t.Fatal(err)
+	} else if err := s.DeleteUser(1); err != nil {
+		t.Fatal(err)
+	} else if n := overflowChunks(t, s); n != 0 {
+		t.Fatalf("unexpected chunk count: %d", n)
+	}
+}
+
+// overflowChunks returns the number of chunks in the Overflow bucket.
+func overflowChunks(tb testing.TB, s *Store) int {
+	tb.Helper()
+	if err := s.Store.Close(); err != nil {
+		tb.Fatal(err)
+	}
+	defer func() {
+		if err := s.Open(); err != nil {
+			tb.Fatal(err)
+		}
+	}()
+
+	db, err := bolt.Open(s.Path, 0600, nil)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	defer db.Close()
+
+	var n int
+	db.View(func(tx *bolt.Tx) error {
+		n = tx.Bucket([]byte("Overflow")).Stats().KeyN
+		return nil
+	})
+	return n
+}
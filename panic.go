@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"runtime/debug"
+)
+
+// DefaultMaxPanics is the default number of recovered panics after which a
+// store reports itself as unhealthy.
+const DefaultMaxPanics = 3
+
+// PanicError is returned when a transaction callback panics. The panic is
+// recovered and the transaction rolled back so the process keeps running.
+type PanicError struct {
+	// Value passed to panic.
+	Value interface{}
+
+	// Stack trace of the goroutine at the time of the panic.
+	Stack []byte
+}
+
+// Error returns the panic value.
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("panic: %v", e.Value)
+}
+
+// Unwrap returns the panic value if it is an error.
+func (e *PanicError) Unwrap() error {
+	err, _ := e.Value.(error)
+	return err
+}
+
+// Healthy returns ErrStoreUnhealthy once MaxPanics panics have been
+// recovered from transaction callbacks since the store was opened, or
+// ErrStoreClosed if the store is not open. Panics usually mean a bug or
+// corrupt data so an unhealthy store should be taken out of service and
+// reopened once the cause has been fixed.
+func (s *Store) Healthy() error {
+	if err := s.rlock(); err != nil {
+		return err
+	}
+	defer s.db.mu.RUnlock()
+
+	if s.db.panics.Load() >= int64(s.maxPanics()) {
+		return ErrStoreUnhealthy
+	}
+	return nil
+}
+
+// call executes fn with tx. A panic within fn is recovered and returned as
+// a *PanicError so the caller rolls back the transaction.
+func (tx *Tx) call(fn func(tx *Tx) error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			e := &PanicError{Value: r, Stack: debug.Stack()}
+			tx.store.recordPanic(tx.op, e)
+			err = e
+		}
+	}()
+	return fn(tx)
+}
+
+// recordPanic logs a recovered panic and counts it towards MaxPanics.
+func (s *Store) recordPanic(op string, e *PanicError) {
+	n := s.db.panics.Add(1)
+	s.logger().Error("transaction panicked", "op", op, "panic", e.Value, "stack", string(e.Stack))
+	if n == int64(s.maxPanics()) {
+		s.logger().Error("store unhealthy", "path", s.Path, "panics", n)
+	}
+}
+
+// maxPanics returns the configured limit or the default, if unset.
+func (s *Store) maxPanics() int {
+	if s.MaxPanics == 0 {
+		return DefaultMaxPanics
+	}
+	return s.MaxPanics
+}
+
+// Panic related errors.
+var (
+	ErrStoreUnhealthy = &Error{Code: EUNAVAILABLE, Message: "store unhealthy"}
+)
@@ -0,0 +1,104 @@
+package main_test
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	main "github.com/benbjohnson/application-development-using-boltdb"
+	"github.com/benbjohnson/application-development-using-boltdb/keys"
+)
+
+// Ensure a panic within a read transaction is returned as an error.
+func TestStore_Panic_View(t *testing.T) {
+	s := OpenStore()
+	defer s.Close()
+
+	if err := s.CreateUser(&main.User{Username: "susy"}); err != nil {
+		t.Fatal(err)
+	}
+
+	_, _, err := s.QueryUsers(main.Query{Filter: func(u *main.User) bool { panic("marker") }})
+	var e *main.PanicError
+	if !errors.As(err, &e) {
+		t.Fatalf("unexpected error: %v", err)
+	} else if e.Value != "marker" {
+		t.Fatalf("unexpected value: %v", e.Value)
+	} else if !strings.Contains(string(e.Stack), "panic_test.go") {
+		t.Fatalf("unexpected stack: %s", e.Stack)
+	}
+
+	// The store can still be used.
+	if u, err := s.User(1); err != nil {
+		t.Fatal(err)
+	} else if u.Username != "susy" {
+		t.Fatalf("unexpected user: %#v", u)
+	} else if err := s.Healthy(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Ensure a panic within a write transaction rolls back its changes.
+func TestStore_Panic_Update(t *testing.T) {
+	s := NewStore()
+	s.Schema = &main.Schema{
+		Buckets: main.DefaultSchema.Buckets,
+		Indexes: append([]*main.Index{{
+			Name:   "UsersByPanic",
+			Source: "Users",
+			Keys: func(_, v []byte) ([][]byte, error) {
+				var u main.User
+				if err := u.UnmarshalBinary(v); err != nil {
+					return nil, err
+				} else if u.Username == "bad" {
+					panic(errors.New("bad user"))
+				}
+				return [][]byte{keys.String(u.Username)}, nil
+			},
+		}}, main.DefaultSchema.Indexes...),
+	}
+	if err := s.Open(); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	var e *main.PanicError
+	if err := s.CreateUser(&main.User{Username: "bad"}); !errors.As(err, &e) || err.Error() != "panic: bad user" {
+		t.Fatalf("unexpected error: %v", err)
+	} else if main.ErrorCode(err) != main.EINTERNAL {
+		t.Fatalf("unexpected code: %s", main.ErrorCode(err))
+	}
+
+	if a, err := s.Users(); err != nil {
+		t.Fatal(err)
+	} else if len(a) != 0 {
+		t.Fatalf("unexpected users: %d", len(a))
+	} else if err := s.CreateUser(&main.User{Username: "susy"}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Ensure the store is marked unhealthy after MaxPanics panics.
+func TestStore_Healthy(t *testing.T) {
+	s := NewStore()
+	s.MaxPanics = 2
+	if err := s.Open(); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	panicky := func(*main.User) error { panic("marker") }
+	for i := 0; i < 2; i++ {
+		if err := s.Healthy(); err != nil {
+			t.Fatalf("%d: %v", i, err)
+		} else if err := s.CreateUser(&main.User{Username: fmt.Sprintf("user%d", i)}); err != nil {
+			t.Fatal(err)
+		} else if err := s.ParallelForEachUser(1, panicky); err == nil {
+			t.Fatal("expected error")
+		}
+	}
+	if err := s.Healthy(); !errors.Is(err, main.ErrStoreUnhealthy) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
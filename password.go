@@ -0,0 +1,159 @@
+package main
+
+import (
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha512"
+	"crypto/subtle"
+
+	"github.com/benbjohnson/application-development-using-boltdb/internal"
+	"github.com/benbjohnson/application-development-using-boltdb/keys"
+	"github.com/gogo/protobuf/proto"
+)
+
+// MinPasswordLength is the minimum number of bytes in a password.
+const MinPasswordLength = 8
+
+// Password hashing settings. The iteration count is stored with each hash
+// so it can be raised without invalidating existing passwords.
+const (
+	passwordIterations = 210000
+	passwordSaltSize   = 16
+	passwordHashSize   = 32
+)
+
+// passwordHash stores a salted PBKDF2-SHA512 hash of a user's password.
+type passwordHash struct {
+	Salt       []byte
+	Hash       []byte
+	Iterations int
+}
+
+// MarshalBinary encodes a hash to binary format.
+func (h *passwordHash) MarshalBinary() ([]byte, error) {
+	return proto.Marshal(&internal.Password{
+		Salt:       h.Salt,
+		Hash:       h.Hash,
+		Iterations: proto.Int64(int64(h.Iterations)),
+	})
+}
+
+// UnmarshalBinary decodes a hash from binary data.
+func (h *passwordHash) UnmarshalBinary(data []byte) error {
+	var pb internal.Password
+	if err := proto.Unmarshal(data, &pb); err != nil {
+		return err
+	}
+
+	h.Salt = pb.GetSalt()
+	h.Hash = pb.GetHash()
+	h.Iterations = int(pb.GetIterations())
+
+	return nil
+}
+
+// hashPassword returns a new salted hash of password. Hashing is slow on
+// purpose so it is done before a transaction begins.
+func hashPassword(password string) (*passwordHash, error) {
+	if len(password) < MinPasswordLength {
+		return nil, ErrPasswordTooShort
+	}
+
+	salt := make([]byte, passwordSaltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	hash, err := pbkdf2.Key(sha512.New, password, salt, passwordIterations, passwordHashSize)
+	if err != nil {
+		return nil, err
+	}
+	return &passwordHash{Salt: salt, Hash: hash, Iterations: passwordIterations}, nil
+}
+
+// match returns true if password matches the hash.
+func (h *passwordHash) match(password string) bool {
+	hash, err := pbkdf2.Key(sha512.New, password, h.Salt, h.Iterations, len(h.Hash))
+	return err == nil && subtle.ConstantTimeCompare(hash, h.Hash) == 1
+}
+
+// SetPassword sets the password of a user.
+func (s *Store) SetPassword(userID int, password string) error {
+	h, err := hashPassword(password)
+	if err != nil {
+		return err
+	}
+
+	return s.update("SetPassword", func(tx *Tx) error {
+		var u User
+		if err := loadUser(tx, userID, &u); err != nil {
+			return err
+		}
+		return savePassword(tx, userID, h)
+	})
+}
+
+// AuthenticateUser returns the user with username if password matches.
+// Returns ErrPasswordInvalid if the user does not exist, has no password, or
+// the password does not match. Failures are recorded with
+// RecordLoginAttempt so the failure that reaches the limit, and any attempt
+// after it, returns ErrAccountLocked. Users that are not active are rejected
+// by User.CheckStatus once their password has matched.
+func (s *Store) AuthenticateUser(username, password string) (*User, error) {
+	u, err := s.UserByName(username)
+	if err != nil {
+		return nil, err
+	} else if u == nil {
+		return nil, ErrPasswordInvalid
+	} else if err := s.CheckLogin(u.ID, ""); err != nil {
+		return nil, err
+	}
+
+	var h *passwordHash
+	if err := s.view("AuthenticateUser", func(tx *Tx) error {
+		v := tx.Bucket([]byte("Passwords")).Get(keys.Int(u.ID))
+		if v == nil {
+			return nil
+		}
+		tx.recordRead("Passwords", v)
+
+		h = &passwordHash{}
+		return h.UnmarshalBinary(v)
+	}); err != nil {
+		return nil, err
+	}
+
+	// Compare outside of the transaction since hashing is slow. Attempts
+	// cannot be recorded by read-only stores.
+	ok := h != nil && h.match(password)
+	if !s.ReadOnly {
+		if err := s.RecordLoginAttempt(u.ID, "", ok); err != nil {
+			return nil, err
+		}
+	}
+	if !ok {
+		return nil, ErrPasswordInvalid
+	} else if err := u.CheckStatus(); err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
+// savePassword writes the password hash of a user.
+func savePassword(tx *Tx, userID int, h *passwordHash) error {
+	buf, err := h.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	return putValue(tx, "Passwords", keys.Int(userID), buf)
+}
+
+// deletePassword removes the password hash of a user, if any.
+func deletePassword(tx *Tx, userID int) error {
+	return deleteValue(tx, "Passwords", keys.Int(userID))
+}
+
+// Password related errors.
+var (
+	ErrPasswordTooShort = &Error{Code: EINVALID, Message: "password too short"}
+	ErrPasswordInvalid  = &Error{Code: EUNAUTHORIZED, Message: "invalid username or password"}
+)
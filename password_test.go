@@ -0,0 +1,58 @@
+package main_test
+
+import (
+	"errors"
+	"testing"
+
+	main "github.com/benbjohnson/application-development-using-boltdb"
+)
+
+// Ensure users can authenticate with the password they set.
+func TestStore_AuthenticateUser(t *testing.T) {
+	s := NewStore()
+	s.MaxLoginFailures = 2
+	if err := s.Open(); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	if err := s.CreateUser(&main.User{Username: "susy"}); err != nil {
+		t.Fatal(err)
+	} else if _, err := s.AuthenticateUser("susy", "hunter22"); !errors.Is(err, main.ErrPasswordInvalid) {
+		t.Fatalf("unexpected error: %v", err)
+	} else if err := s.SetPassword(1, "hunter22"); err != nil {
+		t.Fatal(err)
+	}
+
+	// A success clears the earlier failure.
+	if u, err := s.AuthenticateUser("Susy", "hunter22"); err != nil {
+		t.Fatal(err)
+	} else if u.ID != 1 {
+		t.Fatalf("unexpected user: %#v", u)
+	} else if _, err := s.AuthenticateUser("jimbo", "hunter22"); !errors.Is(err, main.ErrPasswordInvalid) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// Repeated failures lock the user out.
+	if _, err := s.AuthenticateUser("susy", "hunter23"); !errors.Is(err, main.ErrPasswordInvalid) {
+		t.Fatalf("unexpected error: %v", err)
+	} else if _, err := s.AuthenticateUser("susy", "hunter23"); !errors.Is(err, main.ErrAccountLocked) {
+		t.Fatalf("unexpected error: %v", err)
+	} else if _, err := s.AuthenticateUser("susy", "hunter22"); !errors.Is(err, main.ErrAccountLocked) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+// Ensure short passwords are rejected.
+func TestStore_SetPassword_ErrPasswordTooShort(t *testing.T) {
+	s := OpenStore()
+	defer s.Close()
+
+	if err := s.CreateUser(&main.User{Username: "susy"}); err != nil {
+		t.Fatal(err)
+	} else if err := s.SetPassword(1, "short"); !errors.Is(err, main.ErrPasswordTooShort) {
+		t.Fatalf("unexpected error: %v", err)
+	} else if err := s.SetPassword(2, "hunter22"); !errors.Is(err, main.ErrUserNotFound) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
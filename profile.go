@@ -0,0 +1,56 @@
+package main
+
+// UserPatch is a partial update to a user. Only non-nil fields are applied.
+type UserPatch struct {
+	Username    *string
+	DisplayName *string
+	Bio         *string
+	AvatarURL   *string
+	Locale      *string
+	Email       *string
+}
+
+// PatchUser applies the non-nil fields of patch to a user in a single
+// transaction. A new username is normalized and checked against the
+// reserved and taken usernames like SetUsername. A patch without fields only checks
+// that the user exists.
+func (s *Store) PatchUser(id int, patch UserPatch) error {
+	return s.update("PatchUser", func(tx *Tx) error {
+		var u User
+		if err := loadUser(tx, id, &u); err != nil {
+			return err
+		} else if patch == (UserPatch{}) {
+			return nil
+		}
+
+		prev := u
+		if patch.Username != nil {
+			u.Username = s.normalizeUsername(*patch.Username)
+			if err := checkReservedUsername(tx, u.Username); err != nil {
+				return err
+			} else if err := checkUsernameTaken(tx, u.Username, id); err != nil {
+				return err
+			}
+		}
+		if patch.DisplayName != nil {
+			u.DisplayName = *patch.DisplayName
+		}
+		if patch.Bio != nil {
+			u.Bio = *patch.Bio
+		}
+		if patch.AvatarURL != nil {
+			u.AvatarURL = *patch.AvatarURL
+		}
+		if patch.Locale != nil {
+			u.Locale = *patch.Locale
+		}
+
+		changes := diffUser(&prev, &u)
+		if err := saveUser(tx, &u); err != nil {
+			return err
+		} else if err := recordUserRevision(tx, id, &u, changes); err != nil {
+			return err
+		}
+		return recordUserEvent(tx, EventUserUpdated, &u, changes)
+	})
+}
@@ -0,0 +1,55 @@
+package main_test
+
+import (
+	"errors"
+	"testing"
+
+	main "github.com/benbjohnson/application-development-using-boltdb"
+)
+
+// Ensure only the fields set in a patch are updated.
+func TestStore_PatchUser(t *testing.T) {
+	s := OpenStore()
+	defer s.Close()
+
+	if err := s.CreateUser(&main.User{Username: "susy", DisplayName: "Susy", Locale: "en-US"}); err != nil {
+		t.Fatal(err)
+	}
+
+	bio, avatar := "Hello!", "https://example.com/susy.png"
+	if err := s.PatchUser(1, main.UserPatch{Bio: &bio, AvatarURL: &avatar}); err != nil {
+		t.Fatal(err)
+	}
+
+	u, err := s.User(1)
+	if err != nil {
+		t.Fatal(err)
+	} else if u.Username != "susy" || u.DisplayName != "Susy" || u.Locale != "en-US" {
+		t.Fatalf("unexpected unchanged fields: %#v", u)
+	} else if u.Bio != bio || u.AvatarURL != avatar {
+		t.Fatalf("unexpected patched fields: %#v", u)
+	}
+
+	// A new username is indexed and empty strings clear fields.
+	name, empty := "Jimbo", ""
+	if err := s.PatchUser(1, main.UserPatch{Username: &name, Bio: &empty}); err != nil {
+		t.Fatal(err)
+	} else if u, err := s.UserByName("jimbo"); err != nil {
+		t.Fatal(err)
+	} else if u == nil || u.Bio != "" || u.AvatarURL != avatar {
+		t.Fatalf("unexpected user: %#v", u)
+	}
+}
+
+// Ensure patching a missing user returns an error.
+func TestStore_PatchUser_ErrUserNotFound(t *testing.T) {
+	s := OpenStore()
+	defer s.Close()
+
+	bio := "Hello!"
+	if err := s.PatchUser(1, main.UserPatch{Bio: &bio}); !errors.Is(err, main.ErrUserNotFound) {
+		t.Fatalf("unexpected error: %v", err)
+	} else if err := s.PatchUser(1, main.UserPatch{}); !errors.Is(err, main.ErrUserNotFound) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,315 @@
+package main
+
+import (
+	"bytes"
+	"sort"
+	"sync"
+	"sync/atomic"
+
+	"github.com/benbjohnson/application-development-using-boltdb/keys"
+	"github.com/boltdb/bolt"
+)
+
+// Query describes a set of users to retrieve.
+type Query struct {
+	// If set, only users for which Filter returns true are matched.
+	Filter func(u *User) bool
+
+	// If set, only users with this tag are matched. The tag index is used
+	// so only tagged users are scanned.
+	Tag string
+
+	// Field to sort by: "id" or "username". Defaults to "id".
+	SortBy string
+
+	// Sort in descending order.
+	Desc bool
+
+	// Number of matched users to skip and the maximum number to return.
+	// All remaining users are returned if Limit is zero.
+	Offset int
+	Limit  int
+}
+
+// match returns true if u matches the query's filter.
+func (q *Query) match(u *User) bool {
+	return q.Filter == nil || q.Filter(u)
+}
+
+// QueryUsers returns the page of users matching q along with the total
+// number of users that matched before Offset and Limit were applied.
+//
+// The username or tag index is used when it can satisfy the query.
+// Otherwise users are scanned in ID order.
+func (s *Store) QueryUsers(q Query) ([]*User, int, error) {
+	if q.SortBy != "" && q.SortBy != "id" && q.SortBy != "username" {
+		return nil, 0, ErrInvalidSortField
+	}
+
+	var a []*User
+	var n int
+	if err := s.view("QueryUsers", func(tx *Tx) error {
+		// Collect the page while counting every match.
+		fn := func(u *User) {
+			if !q.match(u) {
+				return
+			}
+			if n >= q.Offset && (q.Limit == 0 || len(a) < q.Limit) {
+				a = append(a, u)
+			}
+			n++
+		}
+
+		switch {
+		case q.Tag != "":
+			var err error
+			a, n, err = queryUsersByTag(tx, &q)
+			return err
+		case q.SortBy == "username":
+			return scanIndex(tx, "UsersByUsername", q.Desc, fn)
+		default:
+			return scanUsers(tx, q.Desc, fn)
+		}
+	}); err != nil {
+		return nil, 0, err
+	}
+	return a, n, nil
+}
+
+// ScanUsers returns up to limit users in ID order, starting after the
+// position encoded in token, along with a token to continue the scan. Pass a
+// nil token to start from the first user. The returned token is nil once
+// there are no more users. All remaining users are returned if limit is zero.
+//
+// Tokens hold the last key read so they remain valid across restarts and
+// concurrent changes. Users created behind the token are not returned.
+func (s *Store) ScanUsers(token []byte, limit int) ([]*User, []byte, error) {
+	if token != nil && len(token) != 8 {
+		return nil, nil, ErrInvalidScanToken
+	}
+
+	a := []*User{}
+	var next []byte
+	if err := s.view("ScanUsers", func(tx *Tx) error {
+		c := tx.Bucket([]byte("Users")).Cursor()
+		k, v := c.First()
+		if token != nil {
+			if k, v = c.Seek(token); k != nil && bytes.Equal(k, token) {
+				k, v = c.Next()
+			}
+		}
+
+		// Stop once the page is full. A token is only returned if another
+		// user remains so callers can stop without an extra empty page.
+		var last []byte
+		for ; k != nil; k, v = c.Next() {
+			if limit > 0 && len(a) == limit {
+				next = append([]byte{}, last...)
+				return nil
+			}
+			tx.recordRead("Users", v)
+			last = k
+
+			u := &User{}
+			if err := decodeUser(tx, v, u); err != nil {
+				return err
+			}
+			a = append(a, u)
+		}
+		return nil
+	}); err != nil {
+		return nil, nil, err
+	}
+	return a, next, nil
+}
+
+// ParallelForEachUser calls fn for every user using up to workers goroutines.
+// The users are split into ranges holding the same number of users by
+// sampling boundary keys from a cursor, so sparse or time-based IDs are
+// split as evenly as sequential ones. Each worker reads its range in its own
+// transaction, so users are not read from a single consistent view and fn
+// must be safe to call concurrently. Users within a range are visited in ID
+// order.
+//
+// Workers stop once any call to fn fails and the first error is returned.
+func (s *Store) ParallelForEachUser(workers int, fn func(u *User) error) error {
+	if workers < 1 {
+		workers = 1
+	}
+
+	// Sample the first key of each range by walking the keys once to count
+	// them and again to pick every n/workers-th key.
+	var bounds [][]byte
+	if err := s.view("ParallelForEachUser", func(tx *Tx) error {
+		c := tx.Bucket([]byte("Users")).Cursor()
+		var n int
+		for k, _ := c.First(); k != nil; k, _ = c.Next() {
+			n++
+		}
+
+		var i int
+		for k, _ := c.First(); k != nil; k, _ = c.Next() {
+			if i*workers >= len(bounds)*n {
+				bounds = append(bounds, append([]byte{}, k...))
+			}
+			i++
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	// Each range ends at the start of the next. The first and last ranges
+	// are unbounded so users created since sampling are also visited.
+	errs := make([]error, len(bounds))
+	var failed atomic.Bool
+	var wg sync.WaitGroup
+	for i := range bounds {
+		lo, hi := bounds[i], []byte(nil)
+		if i == 0 {
+			lo = nil
+		}
+		if i < len(bounds)-1 {
+			hi = bounds[i+1]
+		}
+
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = s.view("ParallelForEachUser", func(tx *Tx) error {
+				c := tx.Bucket([]byte("Users")).Cursor()
+				k, v := c.First()
+				if lo != nil {
+					k, v = c.Seek(lo)
+				}
+				for ; k != nil && (hi == nil || bytes.Compare(k, hi) < 0); k, v = c.Next() {
+					if failed.Load() {
+						return nil
+					}
+					tx.recordRead("Users", v)
+
+					u := &User{}
+					if err := decodeUser(tx, v, u); err != nil {
+						failed.Store(true)
+						return err
+					} else if err := fn(u); err != nil {
+						failed.Store(true)
+						return err
+					}
+				}
+				return nil
+			})
+		}(i)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// queryUsersByTag matches users from the tag index. The index is ordered by
+// ID so all matches are sorted in memory before the page is selected.
+func queryUsersByTag(tx *Tx, q *Query) ([]*User, int, error) {
+	var matched []*User
+	c := tx.Bucket([]byte("UsersByTag")).Cursor()
+	if err := keys.Scan(c, keys.String(q.Tag), func(k, _ []byte) error {
+		r := keys.NewReader(k)
+		r.ReadString()
+		id := r.ReadInt()
+		if err := r.Err(); err != nil {
+			return err
+		}
+
+		u := &User{}
+		if err := loadUser(tx, id, u); err != nil {
+			return err
+		} else if q.match(u) {
+			matched = append(matched, u)
+		}
+		return nil
+	}); err != nil {
+		return nil, 0, err
+	}
+
+	sort.SliceStable(matched, func(i, j int) bool {
+		x, y := matched[i], matched[j]
+		if q.Desc {
+			x, y = y, x
+		}
+		if q.SortBy == "username" && x.Username != y.Username {
+			return x.Username < y.Username
+		}
+		return x.ID < y.ID
+	})
+
+	// Select the page.
+	n := len(matched)
+	if q.Offset < len(matched) {
+		matched = matched[q.Offset:]
+	} else {
+		matched = nil
+	}
+	if q.Limit > 0 && len(matched) > q.Limit {
+		matched = matched[:q.Limit]
+	}
+	return matched, n, nil
+}
+
+// scanUsers calls fn for every user in ID order.
+func scanUsers(tx *Tx, desc bool, fn func(u *User)) error {
+	return iterate(tx.Bucket([]byte("Users")).Cursor(), desc, func(_, v []byte) error {
+		tx.recordRead("Users", v)
+
+		u := &User{}
+		if err := decodeUser(tx, v, u); err != nil {
+			return err
+		}
+		fn(u)
+		return nil
+	})
+}
+
+// scanIndex calls fn for every user in the order of the index named name.
+// Index keys must end with the encoded user ID.
+func scanIndex(tx *Tx, name string, desc bool, fn func(u *User)) error {
+	return iterate(tx.Bucket([]byte(name)).Cursor(), desc, func(k, _ []byte) error {
+		tx.recordRead(name, nil)
+
+		if len(k) < 8 {
+			return keys.ErrInvalidKey
+		}
+		id := keys.ParseInt(k[len(k)-8:])
+
+		u := &User{}
+		if err := loadUser(tx, id, u); err != nil {
+			return err
+		}
+		fn(u)
+		return nil
+	})
+}
+
+// iterate calls fn for every key in the cursor's bucket in ascending or
+// descending order.
+func iterate(c *bolt.Cursor, desc bool, fn func(k, v []byte) error) error {
+	first, next := c.First, c.Next
+	if desc {
+		first, next = c.Last, c.Prev
+	}
+	for k, v := first(); k != nil; k, v = next() {
+		if err := fn(k, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Query related errors.
+var (
+	ErrInvalidSortField = &Error{Code: EINVALID, Message: "invalid sort field"}
+	ErrInvalidScanToken = &Error{Code: EINVALID, Message: "invalid scan token"}
+)
@@ -0,0 +1,234 @@
+package main_test
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	main "github.com/benbjohnson/application-development-using-boltdb"
+	"github.com/boltdb/bolt"
+)
+
+// Ensure users can be filtered, sorted, and paginated.
+func TestStore_QueryUsers(t *testing.T) {
+	s := OpenStore()
+	defer s.Close()
+
+	for _, u := range []*main.User{
+		{Username: "susy", Tags: []string{"beta"}},
+		{Username: "john"},
+		{Username: "jane", Tags: []string{"beta"}},
+		{Username: "bob", Tags: []string{"beta"}},
+		{Username: "jim"},
+	} {
+		if err := s.CreateUser(u); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	startsWithJ := func(u *main.User) bool { return strings.HasPrefix(u.Username, "j") }
+
+	for _, tt := range []struct {
+		name  string
+		q     main.Query
+		users []string
+		total int
+	}{
+		{"All", main.Query{}, []string{"susy", "john", "jane", "bob", "jim"}, 5},
+		{"Desc", main.Query{Desc: true}, []string{"jim", "bob", "jane", "john", "susy"}, 5},
+		{"Username", main.Query{SortBy: "username"}, []string{"bob", "jane", "jim", "john", "susy"}, 5},
+		{"UsernameDesc", main.Query{SortBy: "username", Desc: true, Limit: 2}, []string{"susy", "john"}, 5},
+		{"Filter", main.Query{Filter: startsWithJ, SortBy: "username", Offset: 1, Limit: 1}, []string{"jim"}, 3},
+		{"Tag", main.Query{Tag: "beta", SortBy: "username"}, []string{"bob", "jane", "susy"}, 3},
+		{"TagPage", main.Query{Tag: "beta", Desc: true, Offset: 1}, []string{"jane", "susy"}, 3},
+		{"OffsetPastEnd", main.Query{Offset: 10}, []string{}, 5},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			a, n, err := s.QueryUsers(tt.q)
+			if err != nil {
+				t.Fatal(err)
+			} else if !reflect.DeepEqual(usernames(a), tt.users) {
+				t.Fatalf("unexpected users: %v", usernames(a))
+			} else if n != tt.total {
+				t.Fatalf("unexpected total: %d", n)
+			}
+		})
+	}
+
+	if _, _, err := s.QueryUsers(main.Query{SortBy: "email"}); !errors.Is(err, main.ErrInvalidSortField) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func BenchmarkStore_QueryUsers(b *testing.B) {
+	benchmarkSizes(b, func(b *testing.B, s *Store, n int) {
+		q := main.Query{SortBy: "username", Desc: true, Offset: n / 2, Limit: 50}
+		for i := 0; i < b.N; i++ {
+			if a, _, err := s.QueryUsers(q); err != nil {
+				b.Fatal(err)
+			} else if len(a) == 0 {
+				b.Fatal("no users")
+			}
+		}
+	})
+}
+
+// Ensure users can be scanned in pages using continuation tokens.
+func TestStore_ScanUsers(t *testing.T) {
+	s := OpenStore()
+	defer s.Close()
+
+	for _, name := range []string{"susy", "john", "jane", "bob", "jim"} {
+		if err := s.CreateUser(&main.User{Username: name}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Read pages until the token is exhausted.
+	var pages [][]string
+	var token []byte
+	for {
+		a, next, err := s.ScanUsers(token, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pages = append(pages, usernames(a))
+		if token = next; token == nil {
+			break
+		}
+	}
+	if !reflect.DeepEqual(pages, [][]string{{"susy", "john"}, {"jane", "bob"}, {"jim"}}) {
+		t.Fatalf("unexpected pages: %v", pages)
+	}
+
+	// Tokens remain valid after the last key read is deleted.
+	_, token, err := s.ScanUsers(nil, 2)
+	if err != nil {
+		t.Fatal(err)
+	} else if err := s.DeleteUser(2); err != nil {
+		t.Fatal(err)
+	} else if a, _, err := s.ScanUsers(token, 0); err != nil {
+		t.Fatal(err)
+	} else if !reflect.DeepEqual(usernames(a), []string{"jane", "bob", "jim"}) {
+		t.Fatalf("unexpected users: %v", usernames(a))
+	}
+
+	if _, _, err := s.ScanUsers([]byte("bad"), 2); !errors.Is(err, main.ErrInvalidScanToken) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+// Ensure every user is visited exactly once by a parallel scan.
+func TestStore_ParallelForEachUser(t *testing.T) {
+	s := OpenStore()
+	defer s.Close()
+
+	for i := 0; i < 100; i++ {
+		if err := s.CreateUser(&main.User{Username: fmt.Sprintf("user%d", i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, workers := range []int{1, 3, 8, 200} {
+		var mu sync.Mutex
+		seen := make(map[int]int)
+		if err := s.ParallelForEachUser(workers, func(u *main.User) error {
+			mu.Lock()
+			defer mu.Unlock()
+			seen[u.ID]++
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+
+		if len(seen) != 100 {
+			t.Fatalf("workers=%d: unexpected user count: %d", workers, len(seen))
+		}
+		for id, n := range seen {
+			if n != 1 {
+				t.Fatalf("workers=%d: user %d visited %d times", workers, id, n)
+			}
+		}
+	}
+}
+
+// Ensure sparse IDs are split evenly between workers.
+func TestStore_ParallelForEachUser_Sparse(t *testing.T) {
+	s := NewStore()
+	s.IDGenerator = &listIDGenerator{ids: []int{1, 2, 3, 4, 5, 6, 7, math.MaxInt}}
+	if err := s.Open(); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	for i := 0; i < 8; i++ {
+		if err := s.CreateUser(&main.User{Username: fmt.Sprintf("user%d", i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Each of the four ranges holds two users, so the first user of every
+	// range is visited at the same time.
+	var n atomic.Int32
+	started := make(chan struct{})
+	if err := s.ParallelForEachUser(4, func(u *main.User) error {
+		if i := n.Add(1); i == 4 {
+			close(started)
+		} else if i > 4 {
+			return nil
+		}
+		select {
+		case <-started:
+			return nil
+		case <-time.After(5 * time.Second):
+			return fmt.Errorf("user %d: ranges not visited in parallel", u.ID)
+		}
+	}); err != nil {
+		t.Fatal(err)
+	} else if n.Load() != 8 {
+		t.Fatalf("unexpected user count: %d", n.Load())
+	}
+}
+
+// listIDGenerator generates IDs from a fixed list.
+type listIDGenerator struct {
+	mu  sync.Mutex
+	ids []int
+}
+
+// NextID returns the next ID from the list.
+func (g *listIDGenerator) NextID(bkt *bolt.Bucket) (int, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	id := g.ids[0]
+	g.ids = g.ids[1:]
+	return id, nil
+}
+
+// Ensure a parallel scan stops and returns the error from fn.
+func TestStore_ParallelForEachUser_Error(t *testing.T) {
+	s := OpenStore()
+	defer s.Close()
+
+	for i := 0; i < 10; i++ {
+		if err := s.CreateUser(&main.User{Username: fmt.Sprintf("user%d", i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	errMarker := errors.New("marker")
+	if err := s.ParallelForEachUser(4, func(u *main.User) error {
+		if u.ID == 5 {
+			return errMarker
+		}
+		return nil
+	}); !errors.Is(err, errMarker) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/boltdb/bolt"
+)
+
+// Quota names reported by QuotaError.
+const (
+	QuotaUsers     = "users"
+	QuotaValueSize = "value size"
+	QuotaFileSize  = "file size"
+)
+
+// QuotaError is returned when a write would exceed one of the store's limits.
+type QuotaError struct {
+	Quota string
+	Limit int64
+
+	// Consumption that the write would have reached.
+	Value int64
+}
+
+// Error returns a description of the exceeded quota.
+func (e *QuotaError) Error() string {
+	return fmt.Sprintf("%s quota exceeded: %d > %d", e.Quota, e.Value, e.Limit)
+}
+
+// Usage represents the current consumption of a store or tenant.
+type Usage struct {
+	// Number of users.
+	Users int
+
+	// Bytes of pages in use by the store's buckets. For a tenant, only the
+	// tenant's buckets are counted.
+	Size int64
+
+	// Size of the data file, shared by all tenants.
+	FileSize int64
+}
+
+// Usage returns the current consumption of the store. For a TenantStore,
+// users and size are reported for the tenant only.
+func (s *Store) Usage() (*Usage, error) {
+	var u Usage
+	if err := s.view("Usage", func(tx *Tx) error {
+		u.Users = countUsers(tx)
+		u.FileSize = tx.Size()
+
+		// Sum the pages used by every bucket in the transaction's scope.
+		var stats bolt.BucketStats
+		if tx.root != nil {
+			stats = tx.root.Stats()
+		} else if err := tx.forEachTopBucket(func(name []byte, b *bolt.Bucket) error {
+			if string(name) != "Tenants" {
+				stats.Add(b.Stats())
+			}
+			return nil
+		}); err != nil {
+			return err
+		}
+		u.Size = int64(stats.BranchInuse + stats.LeafInuse + stats.InlineBucketInuse)
+
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	// Report the size on disk if available since it includes free pages.
+	if fi, err := os.Stat(s.Path); err == nil {
+		u.FileSize = fi.Size()
+	}
+	return &u, nil
+}
+
+// countUsers returns the number of users in the transaction's scope.
+func countUsers(tx *Tx) int {
+	return tx.Bucket([]byte("Users")).Stats().KeyN
+}
+
+// checkUserQuota returns an error if creating another user would exceed
+// the store's MaxUsers limit.
+func checkUserQuota(tx *Tx) error {
+	max := tx.store.MaxUsers
+	if max <= 0 {
+		return nil
+	}
+
+	if n := countUsers(tx) + 1; n > max {
+		return &QuotaError{Quota: QuotaUsers, Limit: int64(max), Value: int64(n)}
+	}
+	return nil
+}
+
+// checkValueSize returns an error if a value of n bytes exceeds the store's
+// MaxValueSize limit.
+func checkValueSize(tx *Tx, n int) error {
+	if max := tx.store.MaxValueSize; max > 0 && n > max {
+		return &QuotaError{Quota: QuotaValueSize, Limit: int64(max), Value: int64(n)}
+	}
+	return nil
+}
+
+// checkFileSize returns an error if the data written by tx would grow the
+// data file beyond the store's MaxFileSize limit. Transactions that only
+// delete data are always allowed so a full store can be cleaned up.
+func checkFileSize(tx *Tx) error {
+	max := tx.store.MaxFileSize
+	if max <= 0 || tx.bytesWritten == 0 {
+		return nil
+	}
+
+	if n := tx.Size() + int64(tx.bytesWritten); n > max {
+		return &QuotaError{Quota: QuotaFileSize, Limit: max, Value: n}
+	}
+	return nil
+}
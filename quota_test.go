@@ -0,0 +1,162 @@
+package main_test
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	main "github.com/benbjohnson/application-development-using-boltdb"
+)
+
+// Ensure users cannot be created beyond the store's user limit.
+func TestStore_MaxUsers(t *testing.T) {
+	s := NewStore()
+	s.MaxUsers = 2
+	if err := s.Open(); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	for i := 0; i < 2; i++ {
+		if err := s.CreateUser(&main.User{Username: fmt.Sprintf("user%d", i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err := s.CreateUser(&main.User{Username: "john"})
+	var e *main.QuotaError
+	if !errors.As(err, &e) {
+		t.Fatalf("unexpected error: %v", err)
+	} else if e.Quota != main.QuotaUsers || e.Limit != 2 || e.Value != 3 {
+		t.Fatalf("unexpected quota error: %#v", e)
+	}
+
+	// Deleting a user frees up space for another.
+	if err := s.DeleteUser(1); err != nil {
+		t.Fatal(err)
+	} else if err := s.CreateUser(&main.User{Username: "john"}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Ensure user limits apply to each tenant separately and can be overridden.
+func TestStore_MaxUsers_Tenant(t *testing.T) {
+	s := NewStore()
+	s.MaxUsers = 1
+	if err := s.Open(); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	if err := s.CreateTenant("acme"); err != nil {
+		t.Fatal(err)
+	} else if err := s.CreateTenant("beta"); err != nil {
+		t.Fatal(err)
+	}
+	acme, beta := s.Tenant("acme"), s.Tenant("beta")
+	beta.MaxUsers = 2
+
+	if err := s.CreateUser(&main.User{Username: "root"}); err != nil {
+		t.Fatal(err)
+	} else if err := acme.CreateUser(&main.User{Username: "susy"}); err != nil {
+		t.Fatal(err)
+	} else if err := acme.CreateUser(&main.User{Username: "john"}); err == nil {
+		t.Fatal("expected error")
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := beta.CreateUser(&main.User{Username: fmt.Sprintf("user%d", i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// Ensure values larger than the store's limit are rejected.
+func TestStore_MaxValueSize(t *testing.T) {
+	s := NewStore()
+	s.MaxValueSize = 100
+	if err := s.Open(); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	if err := s.CreateUser(&main.User{Username: "susy"}); err != nil {
+		t.Fatal(err)
+	}
+
+	err := s.CreateUser(&main.User{Username: strings.Repeat("x", 200)})
+	var e *main.QuotaError
+	if !errors.As(err, &e) || e.Quota != main.QuotaValueSize {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// Job payloads are limited as well.
+	if err := s.Enqueue(&main.Job{Type: "email", Payload: bytes.Repeat([]byte("x"), 200)}); err == nil {
+		t.Fatal("expected error")
+	}
+
+	// The failed write is not applied.
+	if a, err := s.Users(); err != nil {
+		t.Fatal(err)
+	} else if len(a) != 1 {
+		t.Fatalf("unexpected user count: %d", len(a))
+	}
+}
+
+// Ensure writes that would grow the file beyond its limit are rejected
+// while deletes are still allowed.
+func TestStore_MaxFileSize(t *testing.T) {
+	s := NewStore()
+	s.MaxFileSize = 256 << 10
+	if err := s.Open(); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	// Write until the quota is reached.
+	var err error
+	for i := 0; i < 1000 && err == nil; i++ {
+		err = s.CreateUser(&main.User{Username: fmt.Sprintf("%d", i) + strings.Repeat("x", 1000)})
+	}
+	var e *main.QuotaError
+	if !errors.As(err, &e) || e.Quota != main.QuotaFileSize {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if err := s.DeleteUser(1); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Ensure usage is reported for the store and for each tenant.
+func TestStore_Usage(t *testing.T) {
+	s := OpenStore()
+	defer s.Close()
+
+	if err := s.CreateTenant("acme"); err != nil {
+		t.Fatal(err)
+	}
+	acme := s.Tenant("acme")
+	for i := 0; i < 3; i++ {
+		if err := acme.CreateUser(&main.User{Username: fmt.Sprintf("user%d", i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.CreateUser(&main.User{Username: "root"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if u, err := s.Usage(); err != nil {
+		t.Fatal(err)
+	} else if u.Users != 1 || u.Size == 0 || u.FileSize == 0 {
+		t.Fatalf("unexpected usage: %#v", u)
+	}
+
+	if u, err := acme.Usage(); err != nil {
+		t.Fatal(err)
+	} else if u.Users != 3 || u.Size == 0 || u.FileSize == 0 {
+		t.Fatalf("unexpected usage: %#v", u)
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"encoding/binary"
+	"math"
+	"time"
+)
+
+// Rate is the rate at which a limit allows events.
+type Rate struct {
+	// Number of events allowed every Per.
+	Events int
+	Per    time.Duration
+
+	// Maximum number of events allowed at once after the limit has been
+	// idle. Defaults to Events.
+	Burst int
+}
+
+// burst returns the configured burst or the number of events, if unset.
+func (r Rate) burst() float64 {
+	if r.Burst <= 0 {
+		return float64(r.Events)
+	}
+	return float64(r.Burst)
+}
+
+// perEvent returns the time to refill one token.
+func (r Rate) perEvent() time.Duration {
+	return r.Per / time.Duration(r.Events)
+}
+
+// Allow reports whether an event for key is allowed under limit. If not,
+// it also returns how long to wait before the next event is allowed.
+//
+// Each key has a token bucket that holds up to the limit's burst and refills
+// at the limit's rate. The bucket is stored in the "RateLimits" bucket with
+// the time it was last updated, and tokens are refilled on the next call, so
+// limits survive restarts. State is removed by the reaper once the bucket
+// would be full again.
+func (s *Store) Allow(key string, limit Rate) (bool, time.Duration, error) {
+	if key == "" {
+		return false, 0, ErrRateLimitKeyRequired
+	} else if limit.Events <= 0 || limit.Per <= 0 {
+		return false, 0, ErrInvalidRate
+	}
+
+	var allowed bool
+	var retryAfter time.Duration
+	if err := s.update("Allow", func(tx *Tx) error {
+		now := time.Now()
+		burst, per := limit.burst(), limit.perEvent()
+
+		// Refill the tokens for the time since the last event.
+		tokens := burst
+		if v := tx.Bucket([]byte("RateLimits")).Get([]byte(key)); v != nil {
+			tx.recordRead("RateLimits", v)
+			var updatedAt time.Time
+			tokens, updatedAt = decodeRateLimit(v)
+			tokens = math.Min(burst, tokens+float64(now.Sub(updatedAt))/float64(per))
+		}
+
+		if allowed = tokens >= 1; !allowed {
+			retryAfter = time.Duration((1 - tokens) * float64(per))
+			return nil
+		}
+		tokens--
+
+		fullAt := now.Add(time.Duration((burst - tokens) * float64(per)))
+		return putWithTTL(tx, "RateLimits", []byte(key), encodeRateLimit(tokens, now), fullAt)
+	}); err != nil {
+		return false, 0, err
+	}
+	return allowed, retryAfter, nil
+}
+
+// encodeRateLimit encodes the tokens of a bucket and the time they were
+// counted.
+func encodeRateLimit(tokens float64, t time.Time) []byte {
+	buf := make([]byte, 16)
+	binary.BigEndian.PutUint64(buf[0:8], math.Float64bits(tokens))
+	binary.BigEndian.PutUint64(buf[8:16], uint64(t.UnixNano()))
+	return buf
+}
+
+// decodeRateLimit decodes a value written by encodeRateLimit.
+func decodeRateLimit(v []byte) (tokens float64, t time.Time) {
+	if len(v) != 16 {
+		return 0, time.Time{}
+	}
+	tokens = math.Float64frombits(binary.BigEndian.Uint64(v[0:8]))
+	return tokens, time.Unix(0, int64(binary.BigEndian.Uint64(v[8:16])))
+}
+
+// Rate limit related errors.
+var (
+	ErrRateLimitKeyRequired = &Error{Code: EINVALID, Message: "rate limit key required"}
+	ErrInvalidRate          = &Error{Code: EINVALID, Message: "invalid rate"}
+)
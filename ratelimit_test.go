@@ -0,0 +1,69 @@
+package main_test
+
+import (
+	"testing"
+	"time"
+
+	main "github.com/benbjohnson/application-development-using-boltdb"
+)
+
+// Ensure events are allowed up to the burst and then at the limit's rate.
+func TestStore_Allow(t *testing.T) {
+	s := OpenStore()
+	defer s.Close()
+
+	limit := main.Rate{Events: 2, Per: time.Second, Burst: 3}
+	for i := 0; i < 3; i++ {
+		if ok, _, err := s.Allow("ip:10.0.0.1", limit); err != nil {
+			t.Fatal(err)
+		} else if !ok {
+			t.Fatalf("event %d not allowed", i)
+		}
+	}
+
+	// The burst is used up so the next event must wait for a token.
+	ok, retryAfter, err := s.Allow("ip:10.0.0.1", limit)
+	if err != nil {
+		t.Fatal(err)
+	} else if ok {
+		t.Fatal("expected event to be denied")
+	} else if retryAfter <= 0 || retryAfter > 500*time.Millisecond {
+		t.Fatalf("unexpected retry after: %s", retryAfter)
+	}
+
+	// Other keys are limited separately.
+	if ok, _, err := s.Allow("ip:10.0.0.2", limit); err != nil {
+		t.Fatal(err)
+	} else if !ok {
+		t.Fatal("expected event to be allowed")
+	}
+
+	// The limit survives a restart and refills over time.
+	if err := s.Reopen(); err != nil {
+		t.Fatal(err)
+	} else if ok, _, err := s.Allow("ip:10.0.0.1", limit); err != nil {
+		t.Fatal(err)
+	} else if ok {
+		t.Fatal("expected event to be denied after reopen")
+	}
+	time.Sleep(retryAfter)
+	if ok, _, err := s.Allow("ip:10.0.0.1", limit); err != nil {
+		t.Fatal(err)
+	} else if !ok {
+		t.Fatal("expected event to be allowed after refill")
+	}
+}
+
+// Ensure limits are validated.
+func TestStore_Allow_Err(t *testing.T) {
+	s := OpenStore()
+	defer s.Close()
+
+	if _, _, err := s.Allow("", main.Rate{Events: 1, Per: time.Second}); err != main.ErrRateLimitKeyRequired {
+		t.Fatalf("unexpected error: %v", err)
+	} else if _, _, err := s.Allow("key", main.Rate{Per: time.Second}); err != main.ErrInvalidRate {
+		t.Fatalf("unexpected error: %v", err)
+	} else if _, _, err := s.Allow("key", main.Rate{Events: 1}); err != main.ErrInvalidRate {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,325 @@
+package main
+
+import (
+	"strconv"
+
+	"github.com/benbjohnson/application-development-using-boltdb/keys"
+)
+
+// ReassignUserID changes the ID of a user from oldID to newID in a single
+// transaction. The user's index entries, blobs, history, credentials,
+// identities, follows, and activity move with it and references from invites,
+// idempotency keys, login attempts, merge tombstones, password resets, and
+// flag overrides are rewritten.
+// Events already in the outbox keep the old ID; the reassignment is recorded
+// as an update with an "id" change.
+//
+// Returns ErrUserExists if newID is already used. The Users sequence is
+// raised to newID, if needed, so new users do not collide with it.
+func (s *Store) ReassignUserID(oldID, newID int) error {
+	if newID <= 0 {
+		return ErrUserIDInvalid
+	}
+
+	return s.update("ReassignUserID", func(tx *Tx) error {
+		var u User
+		if err := loadUser(tx, oldID, &u); err != nil {
+			return err
+		} else if oldID == newID {
+			return nil
+		}
+
+		bkt := tx.Bucket([]byte("Users"))
+		if bkt.Get(keys.Int(newID)) != nil {
+			return keyError("user", newID, ErrUserExists)
+		}
+
+		// Move the user. Removing the old record first frees its entries in
+		// unique indexes.
+		if err := deleteValue(tx, "Users", keys.Int(oldID)); err != nil {
+			return err
+		}
+		u.ID = newID
+		if err := saveUser(tx, &u); err != nil {
+			return err
+		} else if uint64(newID) > bkt.Sequence() {
+			if err := bkt.SetSequence(uint64(newID)); err != nil {
+				return err
+			}
+		}
+
+		// Move the records owned by the user.
+		if err := moveNestedBucket(tx, "Blobs", oldID, newID); err != nil {
+			return err
+		} else if err := reassignUserHistory(tx, oldID, newID); err != nil {
+			return err
+		} else if err := moveValue(tx, "TOTP", keys.Int(oldID), keys.Int(newID)); err != nil {
+			return err
+		} else if err := moveValue(tx, "Passwords", keys.Int(oldID), keys.Int(newID)); err != nil {
+			return err
+		} else if err := reassignIdentities(tx, oldID, newID); err != nil {
+			return err
+		} else if err := reassignFollows(tx, oldID, newID); err != nil {
+			return err
+		} else if err := moveNestedBucket(tx, "Activity", oldID, newID); err != nil {
+			return err
+		} else if err := moveNestedBucket(tx, "ActivityRollups", oldID, newID); err != nil {
+			return err
+		}
+
+		// Rewrite references to the user.
+		if err := reassignInvites(tx, oldID, newID); err != nil {
+			return err
+		} else if err := reassignIdempotencyRecords(tx, oldID, newID); err != nil {
+			return err
+		} else if err := reassignLoginAttempts(tx, oldID, newID); err != nil {
+			return err
+		} else if err := reassignTombstones(tx, oldID, newID); err != nil {
+			return err
+		} else if err := reassignPasswordResets(tx, oldID, newID); err != nil {
+			return err
+		} else if err := reassignFlagOverrides(tx, oldID, newID); err != nil {
+			return err
+		}
+
+		changes := []FieldChange{{Field: "id", Old: strconv.Itoa(oldID), New: strconv.Itoa(newID)}}
+		if err := recordUserRevision(tx, newID, &u, changes); err != nil {
+			return err
+		}
+		return recordUserEvent(tx, EventUserUpdated, &u, changes)
+	})
+}
+
+// moveNestedBucket moves the bucket of a user nested within the named bucket.
+func moveNestedBucket(tx *Tx, name string, oldID, newID int) error {
+	parent := tx.Bucket([]byte(name))
+	src := parent.Bucket(keys.Int(oldID))
+	if src == nil {
+		return nil
+	}
+
+	tx.recordWrite(name, nil)
+	dst, err := parent.CreateBucket(keys.Int(newID))
+	if err != nil {
+		return err
+	} else if err := copyBucket(dst, src); err != nil {
+		return err
+	}
+	tx.recordDelete(name)
+	return parent.DeleteBucket(keys.Int(oldID))
+}
+
+// moveValue moves the value under oldKey in the named bucket to newKey.
+func moveValue(tx *Tx, name string, oldKey, newKey []byte) error {
+	v := tx.Bucket([]byte(name)).Get(oldKey)
+	if v == nil {
+		return nil
+	}
+	tx.recordRead(name, v)
+
+	v = append([]byte{}, v...)
+	if err := deleteValue(tx, name, oldKey); err != nil {
+		return err
+	}
+	return putValue(tx, name, newKey, v)
+}
+
+// reassignUserHistory moves the revisions of a user and updates the ID of
+// the user within each one so reverts restore the new ID.
+func reassignUserHistory(tx *Tx, oldID, newID int) error {
+	if err := moveNestedBucket(tx, "UserHistory", oldID, newID); err != nil {
+		return err
+	}
+	bkt := tx.Bucket([]byte("UserHistory")).Bucket(keys.Int(newID))
+	if bkt == nil {
+		return nil
+	}
+
+	// Collect revisions first since the bucket cannot be modified while
+	// iterating.
+	var a []*UserRevision
+	if err := bkt.ForEach(func(_, v []byte) error {
+		tx.recordRead("UserHistory", v)
+
+		var r UserRevision
+		if err := decodeRevision(v, &r); err != nil {
+			return err
+		}
+		a = append(a, &r)
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	for _, r := range a {
+		if r.User == nil {
+			continue
+		}
+		r.User.ID = newID
+
+		buf, err := r.MarshalBinary()
+		if err != nil {
+			return err
+		} else if buf, err = tx.store.encodeValue(buf); err != nil {
+			return err
+		}
+		tx.recordWrite("UserHistory", buf)
+		if err := bkt.Put(keys.Int(r.Revision), buf); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// reassignIdentities moves the identities linked to a user.
+func reassignIdentities(tx *Tx, oldID, newID int) error {
+	a, err := userIdentities(tx, oldID)
+	if err != nil {
+		return err
+	}
+
+	// Remove every old key before adding new ones to free the unique index.
+	for _, i := range a {
+		if err := deleteValue(tx, "Identities", identityKey(oldID, i.Provider, i.Subject)); err != nil {
+			return err
+		}
+	}
+	for _, i := range a {
+		i.UserID = newID
+		if buf, err := i.MarshalBinary(); err != nil {
+			return err
+		} else if err := putValue(tx, "Identities", identityKey(newID, i.Provider, i.Subject), buf); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// reassignInvites rewrites invites sent by a user.
+func reassignInvites(tx *Tx, oldID, newID int) error {
+	return rewriteValues(tx, "Invites", func(v []byte) ([]byte, error) {
+		var i Invite
+		if err := i.UnmarshalBinary(v); err != nil {
+			return nil, err
+		} else if i.InvitedBy != oldID {
+			return nil, nil
+		}
+		i.InvitedBy = newID
+		return i.MarshalBinary()
+	})
+}
+
+// reassignPasswordResets rewrites password resets of a user.
+func reassignPasswordResets(tx *Tx, oldID, newID int) error {
+	return rewriteValues(tx, "PasswordResets", func(v []byte) ([]byte, error) {
+		var r passwordReset
+		if err := r.UnmarshalBinary(v); err != nil {
+			return nil, err
+		} else if r.UserID != oldID {
+			return nil, nil
+		}
+		r.UserID = newID
+		return r.MarshalBinary()
+	})
+}
+
+// reassignIdempotencyRecords rewrites idempotency keys that created a user.
+func reassignIdempotencyRecords(tx *Tx, oldID, newID int) error {
+	return rewriteValues(tx, "Idempotency", func(v []byte) ([]byte, error) {
+		var r idempotencyRecord
+		if err := r.UnmarshalBinary(v); err != nil {
+			return nil, err
+		} else if r.UserID != oldID {
+			return nil, nil
+		}
+		r.UserID = newID
+		return r.MarshalBinary()
+	})
+}
+
+// reassignLoginAttempts moves the login failures of a user. Each failure
+// keeps its time so lockouts are unaffected.
+func reassignLoginAttempts(tx *Tx, oldID, newID int) error {
+	subject, newSubject := userLoginSubject(oldID), userLoginSubject(newID)
+
+	var times [][]byte
+	c := tx.Bucket([]byte("LoginAttempts")).Cursor()
+	if err := keys.Scan(c, keys.String(subject), func(k, _ []byte) error {
+		r := keys.NewReader(k)
+		r.ReadString()
+		times = append(times, append([]byte{}, r.Remaining()...))
+		return r.Err()
+	}); err != nil {
+		return err
+	}
+
+	for _, t := range times {
+		r := keys.NewReader(t)
+		at := r.ReadTime()
+		if err := r.Err(); err != nil {
+			return err
+		} else if err := deleteWithTTL(tx, "LoginAttempts", keys.Join(keys.String(subject), t)); err != nil {
+			return err
+		} else if err := tx.store.recordLoginFailure(tx, newSubject, at); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// reassignTombstones rewrites tombstones of users merged into a user.
+func reassignTombstones(tx *Tx, oldID, newID int) error {
+	bkt := tx.Bucket([]byte("MergedUsers"))
+
+	var a [][]byte
+	if err := bkt.ForEach(func(k, v []byte) error {
+		if keys.ParseInt(v) == oldID {
+			a = append(a, append([]byte{}, k...))
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	for _, k := range a {
+		tx.recordWrite("MergedUsers", nil)
+		if err := bkt.Put(k, keys.Int(newID)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rewriteValues calls fn for every value in the named bucket and replaces
+// the values for which fn returns a non-nil result.
+func rewriteValues(tx *Tx, name string, fn func(v []byte) ([]byte, error)) error {
+	type update struct{ key, value []byte }
+	var updates []update
+
+	if err := tx.Bucket([]byte(name)).ForEach(func(k, v []byte) error {
+		tx.recordRead(name, v)
+
+		buf, err := fn(v)
+		if err != nil {
+			return err
+		} else if buf != nil {
+			updates = append(updates, update{key: append([]byte{}, k...), value: buf})
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	for _, u := range updates {
+		if err := putValue(tx, name, u.key, u.value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Reassignment related errors.
+var (
+	ErrUserIDInvalid = &Error{Code: EINVALID, Message: "invalid user id"}
+	ErrUserExists    = &Error{Code: ECONFLICT, Message: "user already exists"}
+)
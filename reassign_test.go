@@ -0,0 +1,122 @@
+package main_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	main "github.com/benbjohnson/application-development-using-boltdb"
+)
+
+// Ensure a user and the records that reference it move to a new ID.
+func TestStore_ReassignUserID(t *testing.T) {
+	s := NewStore()
+	s.UserHistoryLimit = 10
+	s.MaxLoginFailures = 2
+	if err := s.Open(); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	if err := s.CreateUser(&main.User{Username: "susy", Tags: []string{"beta"}}); err != nil {
+		t.Fatal(err)
+	} else if err := s.PutUserBlob(1, "bio.txt", strings.NewReader("hello")); err != nil {
+		t.Fatal(err)
+	} else if err := s.SetPassword(1, "hunter22"); err != nil {
+		t.Fatal(err)
+	} else if err := s.LinkIdentity(1, "google", "1234"); err != nil {
+		t.Fatal(err)
+	} else if _, err := s.CreateInvite("jimbo@example.com", 1); err != nil {
+		t.Fatal(err)
+	} else if err := s.RecordLoginAttempt(1, "", false); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.ReassignUserID(1, 100); err != nil {
+		t.Fatal(err)
+	}
+
+	// The user is only found under the new ID.
+	if u, err := s.User(1); err != nil {
+		t.Fatal(err)
+	} else if u != nil {
+		t.Fatalf("unexpected user: %#v", u)
+	} else if u, err := s.UserByName("susy"); err != nil {
+		t.Fatal(err)
+	} else if u == nil || u.ID != 100 {
+		t.Fatalf("unexpected user: %#v", u)
+	} else if a, err := s.UsersWithTag("beta"); err != nil {
+		t.Fatal(err)
+	} else if len(a) != 1 || a[0].ID != 100 {
+		t.Fatalf("unexpected tagged users: %#v", a)
+	} else if u, err := s.UserByIdentity("google", "1234"); err != nil {
+		t.Fatal(err)
+	} else if u == nil || u.ID != 100 {
+		t.Fatalf("unexpected user: %#v", u)
+	}
+
+	// Owned records and references moved with the user.
+	rc, err := s.UserBlob(100, "bio.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf, err := io.ReadAll(rc)
+	if err != nil {
+		t.Fatal(err)
+	} else if err := rc.Close(); err != nil {
+		t.Fatal(err)
+	} else if !bytes.Equal(buf, []byte("hello")) {
+		t.Fatalf("unexpected blob: %q", buf)
+	}
+
+	if a, err := s.PendingInvites(); err != nil {
+		t.Fatal(err)
+	} else if len(a) != 1 || a[0].InvitedBy != 100 {
+		t.Fatalf("unexpected invites: %#v", a)
+	} else if err := s.RecordLoginAttempt(100, "", false); !errors.Is(err, main.ErrAccountLocked) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// The history moved and records the change of ID.
+	if a, err := s.UserHistory(100); err != nil {
+		t.Fatal(err)
+	} else if len(a) != 2 {
+		t.Fatalf("unexpected revisions: %d", len(a))
+	} else if a[0].User.ID != 100 {
+		t.Fatalf("unexpected revision user: %#v", a[0].User)
+	} else if c := main.ChangedField(a[1].Changes, "id"); c == nil || c.Old != "1" || c.New != "100" {
+		t.Fatalf("unexpected change: %#v", c)
+	}
+
+	// New users are assigned IDs after the reassigned one.
+	u := &main.User{Username: "jimbo"}
+	if err := s.CreateUser(u); err != nil {
+		t.Fatal(err)
+	} else if u.ID != 101 {
+		t.Fatalf("unexpected id: %d", u.ID)
+	}
+}
+
+// Ensure a user cannot be moved onto an existing ID.
+func TestStore_ReassignUserID_Err(t *testing.T) {
+	s := OpenStore()
+	defer s.Close()
+
+	if err := s.CreateUser(&main.User{Username: "susy"}); err != nil {
+		t.Fatal(err)
+	} else if err := s.CreateUser(&main.User{Username: "jimbo"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.ReassignUserID(1, 2); !errors.Is(err, main.ErrUserExists) {
+		t.Fatalf("unexpected error: %v", err)
+	} else if err := s.ReassignUserID(3, 4); !errors.Is(err, main.ErrUserNotFound) {
+		t.Fatalf("unexpected error: %v", err)
+	} else if err := s.ReassignUserID(1, 0); !errors.Is(err, main.ErrUserIDInvalid) {
+		t.Fatalf("unexpected error: %v", err)
+	} else if u, err := s.User(1); err != nil || u == nil {
+		t.Fatalf("unexpected user: %#v, %v", u, err)
+	}
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+)
+
+// ReindexCommand rebuilds every index of a store from its source buckets.
+type ReindexCommand struct {
+	*Main
+}
+
+// NewReindexCommand returns a new instance of ReindexCommand.
+func NewReindexCommand(m *Main) *ReindexCommand {
+	return &ReindexCommand{Main: m}
+}
+
+// Run executes the rebuild and prints progress after each batch.
+func (cmd *ReindexCommand) Run(args ...string) error {
+	fs := flag.NewFlagSet("reindex", flag.ContinueOnError)
+	fs.SetOutput(cmd.Stderr)
+	tenant := fs.String("tenant", "", "rebuild the indexes of a single tenant")
+	fs.Usage = func() {
+		fmt.Fprintln(cmd.Stderr, "usage: appdev reindex [-tenant name] path")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err == flag.ErrHelp {
+		return ErrUsage
+	} else if err != nil {
+		return err
+	} else if fs.NArg() != 1 {
+		fs.Usage()
+		return ErrUsage
+	}
+
+	s := NewStore(fs.Arg(0))
+	if err := s.Open(); err != nil {
+		return err
+	}
+	defer s.Close()
+
+	progress := func(p ReindexProgress) {
+		fmt.Fprintf(cmd.Stdout, "%s: %d/%d\n", p.Index, p.N, p.Total)
+	}
+	if *tenant != "" {
+		return s.Tenant(*tenant).ReindexAll(progress)
+	}
+	return s.ReindexAll(progress)
+}
@@ -0,0 +1,34 @@
+package main_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	main "github.com/benbjohnson/application-development-using-boltdb"
+)
+
+// Ensure the reindex command rebuilds indexes and prints progress.
+func TestReindexCommand_Run(t *testing.T) {
+	s := OpenStore()
+	defer s.Close()
+	if err := s.CreateUser(&main.User{Username: "susy"}); err != nil {
+		t.Fatal(err)
+	} else if err := s.Store.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	m := NewMain()
+	if err := m.Run("reindex", s.Path); err != nil {
+		t.Fatal(err)
+	} else if !strings.Contains(m.Stdout.String(), "UsersByUsername: 1/1") {
+		t.Fatalf("unexpected stdout: %s", m.Stdout.String())
+	}
+}
+
+// Ensure the reindex command requires a path.
+func TestReindexCommand_Run_ErrUsage(t *testing.T) {
+	if err := NewMain().Run("reindex"); !errors.Is(err, main.ErrUsage) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
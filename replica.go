@@ -0,0 +1,206 @@
+package main
+
+import (
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Snapshot writes a consistent copy of the database to path.
+//
+// The copy is written to a temporary file and renamed into place so readers
+// never see a partial snapshot. The modification time of the file is set to
+// the time the snapshot was taken.
+func (s *Store) Snapshot(path string) error {
+	return s.view("Snapshot", func(tx *Tx) error {
+		now := time.Now()
+
+		f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp-")
+		if err != nil {
+			return err
+		}
+		defer os.Remove(f.Name())
+		defer f.Close()
+
+		// Copy the database as of this transaction.
+		if _, err := tx.WriteTo(f); err != nil {
+			return err
+		} else if err := f.Sync(); err != nil {
+			return err
+		} else if err := f.Close(); err != nil {
+			return err
+		}
+
+		// Record the snapshot time and move the file into place.
+		if err := os.Chtimes(f.Name(), now, now); err != nil {
+			return err
+		}
+		return os.Rename(f.Name(), path)
+	})
+}
+
+// monitorSnapshots periodically writes a snapshot to SnapshotPath until the
+// store is closed.
+func (s *Store) monitorSnapshots() {
+	ticker := time.NewTicker(s.SnapshotInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.closing:
+			return
+		case <-ticker.C:
+			var err error
+			if s.SnapshotRetain > 0 {
+				err = s.RetainSnapshot()
+			} else {
+				err = s.Snapshot(s.SnapshotPath)
+			}
+			if err != nil {
+				s.logger().Error("snapshot failed", "path", s.SnapshotPath, "err", err)
+			}
+		}
+	}
+}
+
+// Replica serves read-only queries from a snapshot written by another
+// process's store. Bolt holds an exclusive lock on the primary data file
+// while it is open so other processes read from snapshots instead.
+type Replica struct {
+	mu    sync.RWMutex
+	store *Store
+	mtime time.Time
+
+	closing chan struct{}
+	wg      sync.WaitGroup
+
+	// Path to the snapshot file written by the primary.
+	Path string
+
+	// If set, the snapshot is checked for changes on this interval and
+	// reloaded automatically.
+	ReloadInterval time.Duration
+
+	// Receives errors from automatic reloads, after which the previous
+	// snapshot keeps being served. Errors are discarded if nil.
+	Logger *slog.Logger
+}
+
+// Open opens the snapshot and starts monitoring it for changes.
+func (r *Replica) Open() error {
+	if err := r.Reload(); err != nil {
+		return err
+	}
+
+	r.closing = make(chan struct{})
+	if r.ReloadInterval > 0 {
+		r.wg.Add(1)
+		go func() { defer r.wg.Done(); r.monitor() }()
+	}
+	return nil
+}
+
+// Close stops monitoring and closes the snapshot.
+func (r *Replica) Close() error {
+	if r.closing != nil {
+		close(r.closing)
+		r.wg.Wait()
+		r.closing = nil
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.store == nil {
+		return nil
+	}
+	err := r.store.Close()
+	r.store = nil
+	return err
+}
+
+// Reload reopens the snapshot file. Queries in progress complete against
+// the previous snapshot before it is closed.
+func (r *Replica) Reload() error {
+	fi, err := os.Stat(r.Path)
+	if err != nil {
+		return err
+	}
+
+	// Open the new snapshot before swapping it in.
+	store := NewStore(r.Path, WithReadOnly(), WithLogger(r.Logger))
+	if err := store.Open(); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	prev := r.store
+	r.store, r.mtime = store, fi.ModTime()
+	r.mu.Unlock()
+
+	if prev != nil {
+		return prev.Close()
+	}
+	return nil
+}
+
+// View executes fn against the current snapshot. The snapshot is not
+// reloaded while fn is executing. Write operations on the store fail.
+func (r *Replica) View(fn func(s *Store) error) error {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if r.store == nil {
+		return ErrReplicaClosed
+	}
+	return fn(r.store)
+}
+
+// SnapshotTime returns the time the current snapshot was taken.
+func (r *Replica) SnapshotTime() time.Time {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.mtime
+}
+
+// Staleness returns how far the current snapshot lags behind now.
+func (r *Replica) Staleness() time.Duration {
+	return time.Since(r.SnapshotTime())
+}
+
+// monitor reloads the snapshot whenever its modification time changes.
+func (r *Replica) monitor() {
+	ticker := time.NewTicker(r.ReloadInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-r.closing:
+			return
+		case <-ticker.C:
+			if fi, err := os.Stat(r.Path); err != nil {
+				r.logger().Error("replica reload failed", "path", r.Path, "err", err)
+				continue
+			} else if fi.ModTime().Equal(r.SnapshotTime()) {
+				continue
+			}
+
+			if err := r.Reload(); err != nil {
+				r.logger().Error("replica reload failed", "path", r.Path, "err", err)
+			}
+		}
+	}
+}
+
+// logger returns the configured logger or one that discards messages.
+func (r *Replica) logger() *slog.Logger {
+	if r.Logger == nil {
+		return slog.New(slog.DiscardHandler)
+	}
+	return r.Logger
+}
+
+// Replica related errors.
+var (
+	ErrReplicaClosed = &Error{Code: EUNAVAILABLE, Message: "replica closed"}
+)
@@ -0,0 +1,156 @@
+package main_test
+
+import (
+	"bytes"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	main "github.com/benbjohnson/application-development-using-boltdb"
+)
+
+// Ensure a replica can serve reads from a snapshot of the primary.
+func TestReplica(t *testing.T) {
+	s := OpenStore()
+	defer s.Close()
+
+	path := filepath.Join(t.TempDir(), "snapshot")
+	if err := s.CreateUser(&main.User{Username: "susy"}); err != nil {
+		t.Fatal(err)
+	} else if err := s.Snapshot(path); err != nil {
+		t.Fatal(err)
+	}
+
+	r := &main.Replica{Path: path}
+	if err := r.Open(); err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	// Verify the user can be read and writes are rejected.
+	if err := r.View(func(s *main.Store) error {
+		if u, err := s.User(1); err != nil {
+			t.Fatal(err)
+		} else if u == nil || u.Username != "susy" {
+			t.Fatalf("unexpected user: %#v", u)
+		}
+
+		if err := s.CreateUser(&main.User{Username: "john"}); err == nil {
+			t.Fatal("expected error")
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if d := r.Staleness(); d < 0 || d > time.Minute {
+		t.Fatalf("unexpected staleness: %s", d)
+	}
+}
+
+// Ensure a replica picks up snapshots written on an interval.
+func TestReplica_Reload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "snapshot")
+
+	s := NewStore()
+	s.SnapshotPath, s.SnapshotInterval = path, 10*time.Millisecond
+	if err := s.Open(); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	// Wait for the first snapshot to be written.
+	waitFor(t, func() bool { _, err := os.Stat(path); return err == nil })
+
+	r := &main.Replica{Path: path, ReloadInterval: 10 * time.Millisecond}
+	if err := r.Open(); err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	// Create a user on the primary and wait for it to appear on the replica.
+	if err := s.CreateUser(&main.User{Username: "susy"}); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, func() bool {
+		var u *main.User
+		r.View(func(s *main.Store) (err error) { u, err = s.User(1); return err })
+		return u != nil
+	})
+}
+
+// Ensure failed reloads are logged and the previous snapshot is kept.
+func TestReplica_Reload_Error(t *testing.T) {
+	s := OpenStore()
+	defer s.Close()
+
+	path := filepath.Join(t.TempDir(), "snapshot")
+	if err := s.CreateUser(&main.User{Username: "susy"}); err != nil {
+		t.Fatal(err)
+	} else if err := s.Snapshot(path); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf lockedBuffer
+	r := &main.Replica{Path: path, ReloadInterval: 10 * time.Millisecond, Logger: slog.New(slog.NewTextHandler(&buf, nil))}
+	if err := r.Open(); err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	// Replace the snapshot with a corrupt file. It is renamed into place,
+	// as snapshots are, since the open snapshot is memory mapped.
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, []byte("corrupt"), 0666); err != nil {
+		t.Fatal(err)
+	} else if mtime := time.Now().Add(time.Minute); os.Chtimes(tmp, mtime, mtime) != nil {
+		t.Fatal("chtimes failed")
+	} else if err := os.Rename(tmp, path); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, func() bool { return strings.Contains(buf.String(), "replica reload failed") })
+
+	if err := r.View(func(s *main.Store) error {
+		if u, err := s.User(1); err != nil {
+			return err
+		} else if u == nil {
+			t.Fatal("expected user")
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// lockedBuffer is a bytes.Buffer that is safe for concurrent use.
+type lockedBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+// waitFor polls fn until it returns true or the test times out.
+func waitFor(t *testing.T, fn func() bool) {
+	t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(5 * time.Millisecond) {
+		if fn() {
+			return
+		}
+	}
+	t.Fatal("timeout")
+}
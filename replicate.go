@@ -0,0 +1,365 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/benbjohnson/application-development-using-boltdb/internal"
+	"github.com/gogo/protobuf/proto"
+)
+
+// DefaultChunkSize is the default size of the chunks a snapshot is split into.
+const DefaultChunkSize = 256 * 1024
+
+// Key prefixes used within the object store.
+const (
+	manifestPrefix = "manifests/"
+	chunkPrefix    = "chunks/"
+)
+
+// ObjectStore represents a remote blob store such as S3 or GCS.
+type ObjectStore interface {
+	// PutObject writes the contents of r to key.
+	PutObject(ctx context.Context, key string, r io.Reader) error
+
+	// GetObject returns a reader for the contents of key.
+	GetObject(ctx context.Context, key string) (io.ReadCloser, error)
+
+	// ListObjects returns all keys that start with prefix.
+	ListObjects(ctx context.Context, prefix string) ([]string, error)
+
+	// DeleteObject removes key. Deleting a missing key is not an error.
+	DeleteObject(ctx context.Context, key string) error
+}
+
+// Replicator continuously copies snapshots of a store to an object store.
+//
+// Each snapshot is split into fixed-size chunks that are addressed by their
+// checksum. Only chunks that changed since previous snapshots are uploaded,
+// followed by a manifest listing the chunks that make up the snapshot.
+type Replicator struct {
+	mu     sync.Mutex
+	chunks map[string]struct{} // chunks known to exist remotely
+
+	closing chan struct{}
+	wg      sync.WaitGroup
+
+	// Store to replicate.
+	Store *Store
+
+	// Remote destination for snapshots.
+	Client ObjectStore
+
+	// Time between snapshots when running in the background.
+	Interval time.Duration
+
+	// Number of snapshots to keep. Older snapshots and unreferenced chunks
+	// are removed after each sync. All snapshots are kept if zero.
+	Retain int
+
+	// Size of each chunk. Defaults to DefaultChunkSize.
+	ChunkSize int
+}
+
+// Open starts replicating snapshots in the background every Interval.
+func (r *Replicator) Open() error {
+	if r.Interval <= 0 {
+		return ErrInvalidInterval
+	}
+
+	r.closing = make(chan struct{})
+	r.wg.Add(1)
+	go func() { defer r.wg.Done(); r.monitor() }()
+	return nil
+}
+
+// Close stops background replication.
+func (r *Replicator) Close() error {
+	if r.closing != nil {
+		close(r.closing)
+		r.wg.Wait()
+		r.closing = nil
+	}
+	return nil
+}
+
+// monitor syncs on every interval until the replicator is closed.
+func (r *Replicator) monitor() {
+	ticker := time.NewTicker(r.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-r.closing:
+			return
+		case <-ticker.C:
+			if err := r.Sync(context.Background()); err != nil {
+				r.Store.logger().Error("replication failed", "err", err)
+			}
+		}
+	}
+}
+
+// Sync uploads a new snapshot of the store to the object store.
+func (r *Replicator) Sync(ctx context.Context) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// Read the set of chunks that already exist remotely on first sync.
+	if r.chunks == nil {
+		keys, err := r.Client.ListObjects(ctx, chunkPrefix)
+		if err != nil {
+			return err
+		}
+		r.chunks = make(map[string]struct{}, len(keys))
+		for _, key := range keys {
+			r.chunks[strings.TrimPrefix(key, chunkPrefix)] = struct{}{}
+		}
+	}
+
+	// Write a local snapshot so the read transaction is not held open
+	// for the duration of the upload.
+	dir, err := os.MkdirTemp("", "appdevbolt-replica-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "snapshot")
+	if err := r.Store.Snapshot(path); err != nil {
+		return err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	// Upload each chunk that does not already exist.
+	m := &manifest{CreatedAt: time.Now().UTC()}
+	buf := make([]byte, r.chunkSize())
+	for {
+		n, err := io.ReadFull(f, buf)
+		if err == io.EOF {
+			break
+		} else if err != nil && err != io.ErrUnexpectedEOF {
+			return err
+		}
+
+		sum := sha256.Sum256(buf[:n])
+		id := hex.EncodeToString(sum[:])
+		if _, ok := r.chunks[id]; !ok {
+			if err := r.Client.PutObject(ctx, chunkPrefix+id, bytes.NewReader(buf[:n])); err != nil {
+				return err
+			}
+			r.chunks[id] = struct{}{}
+		}
+
+		m.Size += int64(n)
+		m.Chunks = append(m.Chunks, sum[:])
+	}
+
+	// Upload the manifest last so it only references existing chunks.
+	data, err := m.MarshalBinary()
+	if err != nil {
+		return err
+	} else if err := r.Client.PutObject(ctx, manifestKey(m.CreatedAt), bytes.NewReader(data)); err != nil {
+		return err
+	}
+
+	r.Store.logger().Info("snapshot replicated", "size", m.Size, "chunks", len(m.Chunks))
+	return r.enforceRetention(ctx)
+}
+
+// enforceRetention removes snapshots beyond the retention count along with
+// any chunks that are no longer referenced by a remaining snapshot.
+func (r *Replicator) enforceRetention(ctx context.Context) error {
+	if r.Retain <= 0 {
+		return nil
+	}
+
+	keys, err := r.Client.ListObjects(ctx, manifestPrefix)
+	if err != nil {
+		return err
+	} else if len(keys) <= r.Retain {
+		return nil
+	}
+	sort.Strings(keys)
+
+	// Remove the oldest manifests.
+	for _, key := range keys[:len(keys)-r.Retain] {
+		if err := r.Client.DeleteObject(ctx, key); err != nil {
+			return err
+		}
+	}
+
+	// Determine which chunks are still referenced.
+	referenced := make(map[string]struct{})
+	for _, key := range keys[len(keys)-r.Retain:] {
+		m, err := readManifest(ctx, r.Client, key)
+		if err != nil {
+			return err
+		}
+		for _, sum := range m.Chunks {
+			referenced[hex.EncodeToString(sum)] = struct{}{}
+		}
+	}
+
+	// Remove all other chunks.
+	for id := range r.chunks {
+		if _, ok := referenced[id]; ok {
+			continue
+		}
+		if err := r.Client.DeleteObject(ctx, chunkPrefix+id); err != nil {
+			return err
+		}
+		delete(r.chunks, id)
+	}
+	return nil
+}
+
+// chunkSize returns the configured chunk size or the default, if unset.
+func (r *Replicator) chunkSize() int {
+	if r.ChunkSize <= 0 {
+		return DefaultChunkSize
+	}
+	return r.ChunkSize
+}
+
+// RestoreFromReplica writes the most recent snapshot in client to path.
+// The path must not already exist.
+func RestoreFromReplica(ctx context.Context, client ObjectStore, path string) error {
+	if _, err := os.Stat(path); err == nil {
+		return ErrRestoreTargetExists
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	// Find the latest manifest.
+	keys, err := client.ListObjects(ctx, manifestPrefix)
+	if err != nil {
+		return err
+	} else if len(keys) == 0 {
+		return ErrSnapshotNotFound
+	}
+	sort.Strings(keys)
+
+	m, err := readManifest(ctx, client, keys[len(keys)-1])
+	if err != nil {
+		return err
+	}
+
+	// Download chunks into a temporary file and verify each checksum.
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	for _, sum := range m.Chunks {
+		if err := copyChunk(ctx, client, f, sum); err != nil {
+			return err
+		}
+	}
+
+	if err := f.Sync(); err != nil {
+		return err
+	} else if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+// copyChunk downloads the chunk with the given checksum and writes it to w.
+func copyChunk(ctx context.Context, client ObjectStore, w io.Writer, sum []byte) error {
+	rc, err := client.GetObject(ctx, chunkPrefix+hex.EncodeToString(sum))
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	data, err := io.ReadAll(rc)
+	if err != nil {
+		return err
+	} else if actual := sha256.Sum256(data); !bytes.Equal(actual[:], sum) {
+		return ErrChunkChecksumMismatch
+	}
+
+	_, err = w.Write(data)
+	return err
+}
+
+// manifest lists the chunks that make up a single snapshot.
+type manifest struct {
+	CreatedAt time.Time
+	Size      int64
+	Chunks    [][]byte
+}
+
+// MarshalBinary encodes a manifest to binary format.
+func (m *manifest) MarshalBinary() ([]byte, error) {
+	return proto.Marshal(&internal.Manifest{
+		CreatedAt: proto.Int64(encodeTime(m.CreatedAt)),
+		Size:      proto.Int64(m.Size),
+		Chunks:    m.Chunks,
+	})
+}
+
+// UnmarshalBinary decodes a manifest from binary data.
+func (m *manifest) UnmarshalBinary(data []byte) error {
+	var pb internal.Manifest
+	if err := proto.Unmarshal(data, &pb); err != nil {
+		return err
+	}
+
+	m.CreatedAt = decodeTime(pb.GetCreatedAt())
+	m.Size = pb.GetSize()
+	m.Chunks = pb.GetChunks()
+
+	return nil
+}
+
+// readManifest downloads and decodes the manifest at key.
+func readManifest(ctx context.Context, client ObjectStore, key string) (*manifest, error) {
+	rc, err := client.GetObject(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	data, err := io.ReadAll(rc)
+	if err != nil {
+		return nil, err
+	}
+
+	var m manifest
+	if err := m.UnmarshalBinary(data); err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+// manifestKey returns the key for a manifest created at t.
+// Keys sort in creation order.
+func manifestKey(t time.Time) string {
+	return fmt.Sprintf("%s%020d", manifestPrefix, t.UnixNano())
+}
+
+// Replication related errors.
+var (
+	ErrInvalidInterval       = &Error{Code: EINVALID, Message: "invalid interval"}
+	ErrSnapshotNotFound      = &Error{Code: ENOTFOUND, Message: "snapshot not found"}
+	ErrRestoreTargetExists   = &Error{Code: ECONFLICT, Message: "restore target already exists"}
+	ErrChunkChecksumMismatch = &Error{Code: EINTERNAL, Message: "chunk checksum mismatch"}
+)
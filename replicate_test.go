@@ -0,0 +1,160 @@
+package main_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	main "github.com/benbjohnson/application-development-using-boltdb"
+)
+
+// Ensure a store can be replicated and restored to a new path.
+func TestReplicator_Restore(t *testing.T) {
+	s := OpenStore()
+	defer s.Close()
+
+	client := NewObjectStore()
+	r := &main.Replicator{Store: s.Store, Client: client, ChunkSize: 4096}
+
+	// Create a user and replicate.
+	if err := s.CreateUser(&main.User{Username: "susy"}); err != nil {
+		t.Fatal(err)
+	} else if err := r.Sync(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	n := len(client.Keys("chunks/"))
+
+	// Replicate again with a small change. Only changed chunks are uploaded.
+	if err := s.CreateUser(&main.User{Username: "john"}); err != nil {
+		t.Fatal(err)
+	} else if err := r.Sync(context.Background()); err != nil {
+		t.Fatal(err)
+	} else if m := len(client.Keys("chunks/")) - n; m == 0 || m >= n {
+		t.Fatalf("unexpected new chunk count: %d of %d", m, n)
+	}
+
+	// Restore the latest snapshot and verify its contents.
+	path := filepath.Join(t.TempDir(), "db")
+	if err := main.RestoreFromReplica(context.Background(), client, path); err != nil {
+		t.Fatal(err)
+	}
+
+	other := &main.Store{Path: path}
+	if err := other.Open(); err != nil {
+		t.Fatal(err)
+	}
+	defer other.Close()
+
+	if a, err := other.Users(); err != nil {
+		t.Fatal(err)
+	} else if len(a) != 2 || a[1].Username != "john" {
+		t.Fatalf("unexpected users: %#v", a)
+	}
+
+	// Restoring over an existing file is not allowed.
+	if err := main.RestoreFromReplica(context.Background(), client, path); !errors.Is(err, main.ErrRestoreTargetExists) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+// Ensure old snapshots and their unreferenced chunks are removed.
+func TestReplicator_Retain(t *testing.T) {
+	s := OpenStore()
+	defer s.Close()
+
+	client := NewObjectStore()
+	r := &main.Replicator{Store: s.Store, Client: client, Retain: 1, ChunkSize: 4096}
+	for _, name := range []string{"susy", "john", "jane"} {
+		if err := s.CreateUser(&main.User{Username: name}); err != nil {
+			t.Fatal(err)
+		} else if err := r.Sync(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if keys := client.Keys("manifests/"); len(keys) != 1 {
+		t.Fatalf("unexpected manifests: %v", keys)
+	}
+
+	// Every remaining chunk should be needed by the latest snapshot.
+	fi, err := os.Stat(s.Path)
+	if err != nil {
+		t.Fatal(err)
+	} else if n := len(client.Keys("chunks/")); int64(n*4096) > fi.Size() {
+		t.Fatalf("unexpected chunk count: %d", n)
+	}
+}
+
+// Ensure restoring from an empty object store returns an error.
+func TestRestoreFromReplica_ErrSnapshotNotFound(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "db")
+	if err := main.RestoreFromReplica(context.Background(), NewObjectStore(), path); !errors.Is(err, main.ErrSnapshotNotFound) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+// ObjectStore is an in-memory implementation of main.ObjectStore.
+type ObjectStore struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+}
+
+// NewObjectStore returns a new, empty instance of ObjectStore.
+func NewObjectStore() *ObjectStore {
+	return &ObjectStore{objects: make(map[string][]byte)}
+}
+
+func (s *ObjectStore) PutObject(ctx context.Context, key string, r io.Reader) error {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.objects[key] = data
+	return nil
+}
+
+func (s *ObjectStore) GetObject(ctx context.Context, key string) (io.ReadCloser, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, ok := s.objects[key]
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+func (s *ObjectStore) ListObjects(ctx context.Context, prefix string) ([]string, error) {
+	return s.Keys(prefix), nil
+}
+
+func (s *ObjectStore) DeleteObject(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.objects, key)
+	return nil
+}
+
+// Keys returns a sorted list of keys starting with prefix.
+func (s *ObjectStore) Keys(prefix string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var a []string
+	for key := range s.objects {
+		if strings.HasPrefix(key, prefix) {
+			a = append(a, key)
+		}
+	}
+	sort.Strings(a)
+	return a
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"path"
+	"unicode/utf8"
+)
+
+// SetReservedUsernames replaces the list of usernames that cannot be used by
+// new users or by SetUsername. Entries are glob patterns, such as "admin*",
+// in the syntax of path.Match and are normalized like usernames. Unlike
+// path.Match, '*' and '?' also match '/' since usernames are not paths.
+// Existing users that match are not changed.
+//
+// The list is stored in the ReservedUsernames bucket so it takes effect
+// without a restart. Tenants have their own lists.
+func (s *Store) SetReservedUsernames(patterns []string) error {
+	for _, pattern := range patterns {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return keyError("pattern", pattern, ErrInvalidReservedUsername)
+		}
+	}
+
+	return s.update("SetReservedUsernames", func(tx *Tx) error {
+		if err := tx.DeleteBucket([]byte("ReservedUsernames")); err != nil {
+			return err
+		}
+		bkt, err := tx.CreateBucket([]byte("ReservedUsernames"))
+		if err != nil {
+			return err
+		}
+
+		for _, pattern := range patterns {
+			tx.recordWrite("ReservedUsernames", nil)
+			if err := bkt.Put([]byte(s.normalizeUsername(pattern)), []byte{}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// ReservedUsernames returns the reserved username patterns, sorted.
+func (s *Store) ReservedUsernames() ([]string, error) {
+	a := []string{}
+	if err := s.view("ReservedUsernames", func(tx *Tx) error {
+		return tx.Bucket([]byte("ReservedUsernames")).ForEach(func(k, v []byte) error {
+			tx.recordRead("ReservedUsernames", v)
+			a = append(a, string(k))
+			return nil
+		})
+	}); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// checkReservedUsername returns ErrUsernameReserved if the normalized
+// username matches a reserved pattern.
+func checkReservedUsername(tx *Tx, username string) error {
+	c := tx.Bucket([]byte("ReservedUsernames")).Cursor()
+	for k, v := c.First(); k != nil; k, v = c.Next() {
+		tx.recordRead("ReservedUsernames", v)
+		if matchReserved(string(k), username) {
+			return keyError("username", username, ErrUsernameReserved)
+		}
+	}
+	return nil
+}
+
+// matchReserved returns true if name matches the glob pattern. The pattern
+// must be valid for path.Match but no character is treated as a separator.
+func matchReserved(pattern, name string) bool {
+	for pattern != "" {
+		switch pattern[0] {
+		case '*':
+			// Try the rest of the pattern against every suffix of name.
+			for pattern != "" && pattern[0] == '*' {
+				pattern = pattern[1:]
+			}
+			for i := range name {
+				if matchReserved(pattern, name[i:]) {
+					return true
+				}
+			}
+			return matchReserved(pattern, "")
+
+		case '?':
+			if name == "" {
+				return false
+			}
+			_, n := utf8.DecodeRuneInString(name)
+			pattern, name = pattern[1:], name[n:]
+
+		case '[':
+			if name == "" {
+				return false
+			}
+			r, n := utf8.DecodeRuneInString(name)
+			ok, rest := matchReservedClass(pattern[1:], r)
+			if !ok {
+				return false
+			}
+			pattern, name = rest, name[n:]
+
+		default:
+			if pattern[0] == '\\' {
+				pattern = pattern[1:]
+			}
+			pr, pn := utf8.DecodeRuneInString(pattern)
+			r, n := utf8.DecodeRuneInString(name)
+			if name == "" || r != pr {
+				return false
+			}
+			pattern, name = pattern[pn:], name[n:]
+		}
+	}
+	return name == ""
+}
+
+// matchReservedClass matches r against the character class at the start of
+// pattern, after its opening bracket, and returns the rest of the pattern.
+func matchReservedClass(pattern string, r rune) (bool, string) {
+	negated := pattern != "" && pattern[0] == '^'
+	if negated {
+		pattern = pattern[1:]
+	}
+
+	var matched bool
+	for i := 0; pattern != ""; i++ {
+		if pattern[0] == ']' && i > 0 {
+			return matched != negated, pattern[1:]
+		}
+
+		var lo, hi rune
+		lo, pattern = classRune(pattern)
+		hi = lo
+		if pattern != "" && pattern[0] == '-' {
+			hi, pattern = classRune(pattern[1:])
+		}
+		if lo <= r && r <= hi {
+			matched = true
+		}
+	}
+	return false, ""
+}
+
+// classRune returns the possibly escaped rune at the start of pattern and
+// the rest of the pattern.
+func classRune(pattern string) (rune, string) {
+	if pattern != "" && pattern[0] == '\\' {
+		pattern = pattern[1:]
+	}
+	r, n := utf8.DecodeRuneInString(pattern)
+	return r, pattern[n:]
+}
+
+// Reserved username related errors.
+var (
+	ErrUsernameReserved        = &Error{Code: EINVALID, Message: "username reserved"}
+	ErrInvalidReservedUsername = &Error{Code: EINVALID, Message: "invalid reserved username pattern"}
+)
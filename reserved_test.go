@@ -0,0 +1,98 @@
+package main_test
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	main "github.com/benbjohnson/application-development-using-boltdb"
+)
+
+// Ensure reserved usernames cannot be used by new or renamed users.
+func TestStore_SetReservedUsernames(t *testing.T) {
+	s := OpenStore()
+	defer s.Close()
+
+	if err := s.CreateUser(&main.User{Username: "rootbeer"}); err != nil {
+		t.Fatal(err)
+	} else if err := s.SetReservedUsernames([]string{"Admin", "root*"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if a, err := s.ReservedUsernames(); err != nil {
+		t.Fatal(err)
+	} else if !reflect.DeepEqual(a, []string{"admin", "root*"}) {
+		t.Fatalf("unexpected patterns: %v", a)
+	}
+
+	for _, name := range []string{"admin", "ADMIN", "root", "rooty"} {
+		if err := s.CreateUser(&main.User{Username: name}); !errors.Is(err, main.ErrUsernameReserved) {
+			t.Fatalf("%s: unexpected error: %v", name, err)
+		}
+	}
+	if err := s.SetUsername(1, "Admin"); !errors.Is(err, main.ErrUsernameReserved) {
+		t.Fatalf("unexpected error: %v", err)
+	} else if err := s.CreateUser(&main.User{Username: "administrator"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// The existing user is unaffected and tenants have their own list.
+	if u, err := s.User(1); err != nil {
+		t.Fatal(err)
+	} else if u.Username != "rootbeer" {
+		t.Fatalf("unexpected username: %s", u.Username)
+	} else if err := s.CreateTenant("acme"); err != nil {
+		t.Fatal(err)
+	} else if err := s.Tenant("acme").CreateUser(&main.User{Username: "admin"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Clearing the list allows the usernames again.
+	if err := s.SetReservedUsernames(nil); err != nil {
+		t.Fatal(err)
+	} else if err := s.CreateUser(&main.User{Username: "admin"}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Ensure patterns match usernames containing slashes and use the syntax of
+// path.Match otherwise.
+func TestStore_SetReservedUsernames_Glob(t *testing.T) {
+	for _, tt := range []struct {
+		pattern string
+		name    string
+		match   bool
+	}{
+		{"admin*", "admin/x", true},
+		{"*admin", "x/admin", true},
+		{"a?c", "a/c", true},
+		{"a[^b]c", "a/c", true},
+		{"a[/]c", "a/c", true},
+		{"a[b-d]*", "ac/x", true},
+		{"h?llo", "héllo", true},
+		{`star\*`, "star*", true},
+		{`star\*`, "stars", false},
+		{"a*b*c", "axxbyyc", true},
+		{"a*b*c", "axxbyy", false},
+		{"admin", "admin/x", false},
+		{"a[^b]c", "abc", false},
+	} {
+		s := OpenStore()
+		if err := s.SetReservedUsernames([]string{tt.pattern}); err != nil {
+			t.Fatal(err)
+		} else if err := s.CreateUser(&main.User{Username: tt.name}); errors.Is(err, main.ErrUsernameReserved) != tt.match {
+			t.Fatalf("%q/%q: unexpected error: %v", tt.pattern, tt.name, err)
+		}
+		s.Close()
+	}
+}
+
+// Ensure malformed patterns are rejected.
+func TestStore_SetReservedUsernames_ErrInvalidReservedUsername(t *testing.T) {
+	s := OpenStore()
+	defer s.Close()
+
+	if err := s.SetReservedUsernames([]string{"admin", "[a-"}); !errors.Is(err, main.ErrInvalidReservedUsername) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
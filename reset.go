@@ -0,0 +1,240 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/benbjohnson/application-development-using-boltdb/internal"
+	"github.com/benbjohnson/application-development-using-boltdb/keys"
+	"github.com/gogo/protobuf/proto"
+)
+
+// DefaultPasswordResetTTL is the default duration that a password reset
+// token can be used.
+const DefaultPasswordResetTTL = 1 * time.Hour
+
+// passwordReset is a pending request to reset the password of a user.
+type passwordReset struct {
+	UserID    int
+	ExpiresAt time.Time
+	CreatedAt time.Time
+}
+
+// MarshalBinary encodes a reset to binary format.
+func (r *passwordReset) MarshalBinary() ([]byte, error) {
+	return proto.Marshal(&internal.PasswordReset{
+		UserID:    proto.Int64(int64(r.UserID)),
+		ExpiresAt: proto.Int64(encodeTime(r.ExpiresAt)),
+		CreatedAt: proto.Int64(encodeTime(r.CreatedAt)),
+	})
+}
+
+// UnmarshalBinary decodes a reset from binary data.
+func (r *passwordReset) UnmarshalBinary(data []byte) error {
+	var pb internal.PasswordReset
+	if err := proto.Unmarshal(data, &pb); err != nil {
+		return err
+	}
+
+	r.UserID = int(pb.GetUserID())
+	r.ExpiresAt = decodeTime(pb.GetExpiresAt())
+	r.CreatedAt = decodeTime(pb.GetCreatedAt())
+
+	return nil
+}
+
+// The "PasswordResets" bucket is keyed by a hash of the reset token, like
+// invites, so a stolen data file does not reveal usable tokens. Each user
+// has at most one reset: creating a new one replaces the previous token.
+// Resets are removed when they are used or by the reaper once they expire.
+
+// CreatePasswordReset creates a password reset for the user with the given
+// email address and returns its token. The token can be used once with
+// ConsumePasswordReset within the store's PasswordResetTTL. An email with the
+// token is queued if the store's QueueEmails is set; otherwise the caller
+// must send it.
+//
+// Returns ErrUserNotFound if no user has the email address. Callers should
+// respond the same way in either case so the request cannot be used to find
+// out which addresses have accounts.
+func (s *Store) CreatePasswordReset(email string) (token string, err error) {
+	email = normalizeEmail(email)
+	if !strings.Contains(email, "@") {
+		return "", ErrEmailAddressInvalid
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	token = hex.EncodeToString(secret)
+
+	if err := s.update("CreatePasswordReset", func(tx *Tx) error {
+		u, err := userByEmail(tx, email)
+		if err != nil {
+			return err
+		} else if u == nil {
+			return keyError("user", email, ErrUserNotFound)
+		}
+
+		// Only the latest token of a user can be used.
+		if err := deletePasswordResets(tx, u.ID); err != nil {
+			return err
+		}
+
+		now := time.Now().UTC()
+		r := &passwordReset{UserID: u.ID, ExpiresAt: now.Add(s.passwordResetTTL()), CreatedAt: now}
+		buf, err := r.MarshalBinary()
+		if err != nil {
+			return err
+		} else if err := putWithTTL(tx, "PasswordResets", hashResetToken(token), buf, r.ExpiresAt); err != nil {
+			return err
+		}
+
+		if s.QueueEmails {
+			if _, err := queueEmail(tx, u.Email, EmailPasswordReset, &EmailData{Username: u.Username, Token: token, ExpiresAt: r.ExpiresAt}); err != nil {
+				return err
+			}
+		}
+		return recordUserEvent(tx, EventPasswordResetRequested, u, nil)
+	}); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// ConsumePasswordReset sets the password of the user that token was created
+// for and removes the reset so the token cannot be used again. The user's
+// login failures are cleared so a locked out user can sign in with the new
+// password. Returns ErrPasswordResetInvalid if the token does not match an
+// unexpired reset.
+func (s *Store) ConsumePasswordReset(token, newPassword string) error {
+	h, err := hashPassword(newPassword)
+	if err != nil {
+		return err
+	}
+
+	return s.update("ConsumePasswordReset", func(tx *Tx) error {
+		key := hashResetToken(token)
+		v := tx.Bucket([]byte("PasswordResets")).Get(key)
+		if v == nil {
+			return ErrPasswordResetInvalid
+		}
+		tx.recordRead("PasswordResets", v)
+
+		var r passwordReset
+		if err := r.UnmarshalBinary(v); err != nil {
+			return err
+		} else if !time.Now().Before(r.ExpiresAt) {
+			return ErrPasswordResetInvalid
+		}
+
+		var u User
+		if err := loadUser(tx, r.UserID, &u); err != nil {
+			return err
+		} else if err := savePassword(tx, u.ID, h); err != nil {
+			return err
+		} else if err := deleteWithTTL(tx, "PasswordResets", key); err != nil {
+			return err
+		} else if err := clearLoginFailures(tx, userLoginSubject(u.ID)); err != nil {
+			return err
+		}
+		return recordUserEvent(tx, EventPasswordReset, &u, nil)
+	})
+}
+
+// userByEmail returns the user with the lowest ID that has the normalized
+// email address. Returns nil if no user has it.
+func userByEmail(tx *Tx, email string) (*User, error) {
+	var u *User
+	c := tx.Bucket([]byte("UsersByEmail")).Cursor()
+	if err := keys.Scan(c, keys.String(email), func(k, _ []byte) error {
+		r := keys.NewReader(k)
+		r.ReadString()
+		id := r.ReadInt()
+		if err := r.Err(); err != nil {
+			return err
+		}
+
+		u = &User{}
+		if err := loadUser(tx, id, u); err != nil {
+			return err
+		}
+		return errStop
+	}); err != nil && !errors.Is(err, errStop) {
+		return nil, err
+	}
+	return u, nil
+}
+
+// userPasswordResets reads the pending resets of a user.
+func userPasswordResets(tx *Tx, userID int) ([]*passwordReset, error) {
+	var a []*passwordReset
+	if err := tx.Bucket([]byte("PasswordResets")).ForEach(func(_, v []byte) error {
+		tx.recordRead("PasswordResets", v)
+
+		r := &passwordReset{}
+		if err := r.UnmarshalBinary(v); err != nil {
+			return err
+		} else if r.UserID == userID {
+			a = append(a, r)
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// deletePasswordResets removes the pending resets of a user.
+func deletePasswordResets(tx *Tx, userID int) error {
+	var expired [][]byte
+	if err := tx.Bucket([]byte("PasswordResets")).ForEach(func(k, v []byte) error {
+		tx.recordRead("PasswordResets", v)
+
+		var r passwordReset
+		if err := r.UnmarshalBinary(v); err != nil {
+			return err
+		} else if r.UserID == userID {
+			expired = append(expired, append([]byte{}, k...))
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	for _, k := range expired {
+		if err := deleteWithTTL(tx, "PasswordResets", k); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// passwordResetTTL returns the configured TTL or the default, if unset.
+func (s *Store) passwordResetTTL() time.Duration {
+	if s.PasswordResetTTL == 0 {
+		return DefaultPasswordResetTTL
+	}
+	return s.PasswordResetTTL
+}
+
+// hashResetToken returns the key of a reset in the PasswordResets bucket.
+func hashResetToken(token string) []byte {
+	h := sha256.Sum256([]byte(token))
+	return h[:]
+}
+
+// normalizeEmail returns email in the form used by the UsersByEmail index.
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// Password reset related errors.
+var (
+	ErrPasswordResetInvalid = &Error{Code: EUNAUTHORIZED, Message: "invalid or expired password reset"}
+)
@@ -0,0 +1,150 @@
+package main_test
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	main "github.com/benbjohnson/application-development-using-boltdb"
+)
+
+// Ensure a reset token sets the password once and is then removed.
+func TestStore_ConsumePasswordReset(t *testing.T) {
+	s := OpenStore()
+	defer s.Close()
+	s.Outbox = true
+
+	if err := s.CreateUser(&main.User{Username: "susy", Email: "Susy@Example.com"}); err != nil {
+		t.Fatal(err)
+	} else if err := s.SetPassword(1, "hunter22"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Addresses are matched ignoring case and surrounding space.
+	token, err := s.CreatePasswordReset(" susy@example.COM ")
+	if err != nil {
+		t.Fatal(err)
+	} else if err := s.ConsumePasswordReset(token, "correcthorse"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := s.AuthenticateUser("susy", "hunter22"); !errors.Is(err, main.ErrPasswordInvalid) {
+		t.Fatalf("unexpected error: %v", err)
+	} else if u, err := s.AuthenticateUser("susy", "correcthorse"); err != nil {
+		t.Fatal(err)
+	} else if u.ID != 1 {
+		t.Fatalf("unexpected user: %#v", u)
+	}
+
+	// The token cannot be used again.
+	if err := s.ConsumePasswordReset(token, "batterystaple"); !errors.Is(err, main.ErrPasswordResetInvalid) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// The request and the reset are recorded in the outbox.
+	var p Publisher
+	r := &main.Relay{Store: s.Store, Publisher: &p}
+	if _, err := r.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	} else if !reflect.DeepEqual(p.Types(), []string{"user.created", "user.password_reset_requested", "user.password_reset"}) {
+		t.Fatalf("unexpected events: %v", p.Types())
+	}
+}
+
+// Ensure only the latest token of a user can be used.
+func TestStore_CreatePasswordReset_ReplacesToken(t *testing.T) {
+	s := OpenStore()
+	defer s.Close()
+
+	if err := s.CreateUser(&main.User{Username: "susy", Email: "susy@example.com"}); err != nil {
+		t.Fatal(err)
+	}
+	old, err := s.CreatePasswordReset("susy@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := s.CreatePasswordReset("susy@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.ConsumePasswordReset(old, "correcthorse"); !errors.Is(err, main.ErrPasswordResetInvalid) {
+		t.Fatalf("unexpected error: %v", err)
+	} else if err := s.ConsumePasswordReset(token, "correcthorse"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Ensure expired tokens cannot be used.
+func TestStore_ConsumePasswordReset_Expired(t *testing.T) {
+	s := NewStore()
+	s.PasswordResetTTL = 10 * time.Millisecond
+	if err := s.Open(); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	if err := s.CreateUser(&main.User{Username: "susy", Email: "susy@example.com"}); err != nil {
+		t.Fatal(err)
+	}
+	token, err := s.CreatePasswordReset("susy@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	time.Sleep(20 * time.Millisecond)
+	if err := s.ConsumePasswordReset(token, "correcthorse"); !errors.Is(err, main.ErrPasswordResetInvalid) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+// Ensure resets validate their arguments.
+func TestStore_CreatePasswordReset_Err(t *testing.T) {
+	s := OpenStore()
+	defer s.Close()
+
+	if err := s.CreateUser(&main.User{Username: "susy", Email: "susy@example.com"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := s.CreatePasswordReset("susy"); !errors.Is(err, main.ErrEmailAddressInvalid) {
+		t.Fatalf("unexpected error: %v", err)
+	} else if _, err := s.CreatePasswordReset("jim@example.com"); !errors.Is(err, main.ErrUserNotFound) {
+		t.Fatalf("unexpected error: %v", err)
+	} else if err := s.ConsumePasswordReset("bad", "correcthorse"); !errors.Is(err, main.ErrPasswordResetInvalid) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	token, err := s.CreatePasswordReset("susy@example.com")
+	if err != nil {
+		t.Fatal(err)
+	} else if err := s.ConsumePasswordReset(token, "short"); !errors.Is(err, main.ErrPasswordTooShort) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+// Ensure resets queue an email with their token when enabled.
+func TestStore_CreatePasswordReset_QueueEmails(t *testing.T) {
+	s := OpenStore()
+	defer s.Close()
+	s.QueueEmails = true
+
+	if err := s.CreateUser(&main.User{Username: "susy", Email: "susy@example.com"}); err != nil {
+		t.Fatal(err)
+	}
+	token, err := s.CreatePasswordReset("susy@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if a, err := s.Emails(main.EmailPending); err != nil {
+		t.Fatal(err)
+	} else if len(a) != 1 {
+		t.Fatalf("unexpected emails: %d", len(a))
+	} else if e := a[0]; e.To != "susy@example.com" || e.Template != main.EmailPasswordReset || !strings.Contains(e.Body, "Hi susy") || !strings.Contains(e.Body, token) {
+		t.Fatalf("unexpected email: %#v", e)
+	}
+}
@@ -0,0 +1,317 @@
+package main
+
+import (
+	"time"
+
+	"github.com/boltdb/bolt"
+)
+
+// DefaultRetentionInterval is the default time between enforcements of the
+// store's retention policies.
+const DefaultRetentionInterval = 1 * time.Hour
+
+// Targets of retention policies.
+const (
+	// Revisions in the UserHistory bucket. MaxCount applies per user.
+	RetainUserHistory = "user_history"
+
+	// Deleted users whose history is kept so they can be restored with
+	// RevertUser. The user's history is removed once its deletion is older
+	// than MaxAge.
+	RetainDeletedUsers = "deleted_users"
+
+	// Jobs in the DeadJobs bucket. Age is measured from job creation.
+	RetainDeadJobs = "dead_jobs"
+
+	// Activity samples recorded by RecordActivity. Samples older than
+	// MaxAge are rolled up into counts per ActivityRollupPeriod rather than
+	// removed. MaxCount is not supported.
+	RetainActivity = "activity"
+
+	// Events in the Outbox bucket that are kept after being exported by a
+	// ChangeCapture. Age is measured from event creation. Events are removed
+	// whether or not they were exported, so MaxAge should exceed the time
+	// an export may fall behind.
+	RetainOutbox = "outbox"
+)
+
+// RetentionPolicy limits how long the records of a target are kept.
+type RetentionPolicy struct {
+	Target string
+
+	// Records older than MaxAge are removed. Disabled if zero.
+	MaxAge time.Duration
+
+	// Only the most recent MaxCount records are kept. Disabled if zero.
+	MaxCount int
+}
+
+// RetentionRecorder is implemented by a MetricsRecorder that also records
+// the number of records removed by retention policies.
+type RetentionRecorder interface {
+	ObservePurge(target string, n int)
+}
+
+// EnforceRetention removes the records that fall outside of the store's
+// retention policies and returns the number removed for each target.
+//
+// This is called automatically every RetentionInterval for the store and
+// each of its tenants.
+func (s *Store) EnforceRetention() (map[string]int, error) {
+	m := make(map[string]int)
+	for _, p := range s.Retention {
+		var purge func(tx *Tx, p RetentionPolicy, now time.Time) (int, error)
+		switch p.Target {
+		case RetainUserHistory:
+			purge = purgeUserHistory
+		case RetainDeletedUsers:
+			purge = purgeDeletedUsers
+		case RetainDeadJobs:
+			purge = purgeDeadJobs
+		case RetainActivity:
+			purge = purgeActivity
+		case RetainOutbox:
+			purge = purgeOutbox
+		default:
+			return m, ErrInvalidRetentionTarget
+		}
+
+		var n int
+		if err := s.update("EnforceRetention", func(tx *Tx) (err error) {
+			n, err = purge(tx, p, time.Now().UTC())
+			return err
+		}); err != nil {
+			return m, err
+		}
+		m[p.Target] += n
+
+		if r, ok := s.Metrics.(RetentionRecorder); ok && n > 0 {
+			r.ObservePurge(p.Target, n)
+		}
+	}
+	return m, nil
+}
+
+// purgeUserHistory removes revisions beyond the policy's limits. A user's
+// history bucket is removed once it has no revisions left.
+func purgeUserHistory(tx *Tx, p RetentionPolicy, now time.Time) (int, error) {
+	hist := tx.Bucket([]byte("UserHistory"))
+
+	var n int
+	for _, id := range nestedBuckets(hist) {
+		bkt := hist.Bucket(id)
+
+		// Read revisions oldest first to find those to remove. Keys are
+		// collected first since the bucket cannot be modified while iterating.
+		var all, expired [][]byte
+		if err := bkt.ForEach(func(k, v []byte) error {
+			tx.recordRead("UserHistory", v)
+
+			var r UserRevision
+			if err := decodeRevision(v, &r); err != nil {
+				return err
+			}
+			all = append(all, append([]byte{}, k...))
+			if p.MaxAge > 0 && now.Sub(r.CreatedAt) > p.MaxAge {
+				expired = append(expired, all[len(all)-1])
+			}
+			return nil
+		}); err != nil {
+			return n, err
+		}
+		if p.MaxCount > 0 && len(all)-p.MaxCount > len(expired) {
+			expired = all[:len(all)-p.MaxCount]
+		}
+
+		for _, k := range expired {
+			tx.recordDelete("UserHistory")
+			if err := bkt.Delete(k); err != nil {
+				return n, err
+			}
+		}
+		n += len(expired)
+
+		if len(expired) == len(all) {
+			tx.recordDelete("UserHistory")
+			if err := hist.DeleteBucket(id); err != nil {
+				return n, err
+			}
+		}
+	}
+	return n, nil
+}
+
+// purgeDeletedUsers removes the history of users deleted more than MaxAge
+// ago and returns the number of users removed.
+func purgeDeletedUsers(tx *Tx, p RetentionPolicy, now time.Time) (int, error) {
+	if p.MaxAge <= 0 {
+		return 0, nil
+	}
+	hist := tx.Bucket([]byte("UserHistory"))
+
+	var n int
+	for _, id := range nestedBuckets(hist) {
+		// Only the latest revision determines whether a user is deleted.
+		_, v := hist.Bucket(id).Cursor().Last()
+		if v == nil {
+			continue
+		}
+		tx.recordRead("UserHistory", v)
+
+		var r UserRevision
+		if err := decodeRevision(v, &r); err != nil {
+			return n, err
+		} else if r.User != nil || now.Sub(r.CreatedAt) <= p.MaxAge {
+			continue
+		}
+
+		tx.recordDelete("UserHistory")
+		if err := hist.DeleteBucket(id); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, nil
+}
+
+// purgeDeadJobs removes dead jobs beyond the policy's limits.
+func purgeDeadJobs(tx *Tx, p RetentionPolicy, now time.Time) (int, error) {
+	bkt := tx.Bucket([]byte("DeadJobs"))
+
+	// Jobs are keyed by ID so they are read oldest first.
+	var all, expired [][]byte
+	if err := bkt.ForEach(func(k, v []byte) error {
+		tx.recordRead("DeadJobs", v)
+
+		var j Job
+		if err := j.UnmarshalBinary(v); err != nil {
+			return err
+		}
+		all = append(all, append([]byte{}, k...))
+		if p.MaxAge > 0 && now.Sub(j.CreatedAt) > p.MaxAge {
+			expired = append(expired, all[len(all)-1])
+		}
+		return nil
+	}); err != nil {
+		return 0, err
+	}
+	if p.MaxCount > 0 && len(all)-p.MaxCount > len(expired) {
+		expired = all[:len(all)-p.MaxCount]
+	}
+
+	for _, k := range expired {
+		tx.recordDelete("DeadJobs")
+		if err := bkt.Delete(k); err != nil {
+			return 0, err
+		}
+	}
+	return len(expired), nil
+}
+
+// purgeOutbox removes outbox events beyond the policy's limits.
+func purgeOutbox(tx *Tx, p RetentionPolicy, now time.Time) (int, error) {
+	bkt := tx.Bucket([]byte("Outbox"))
+
+	// Events are keyed by ID so they are read oldest first.
+	var all, expired [][]byte
+	if err := bkt.ForEach(func(k, v []byte) error {
+		tx.recordRead("Outbox", v)
+
+		var e Event
+		if err := e.UnmarshalBinary(v); err != nil {
+			return err
+		}
+		all = append(all, append([]byte{}, k...))
+		if p.MaxAge > 0 && now.Sub(e.CreatedAt) > p.MaxAge {
+			expired = append(expired, all[len(all)-1])
+		}
+		return nil
+	}); err != nil {
+		return 0, err
+	}
+	if p.MaxCount > 0 && len(all)-p.MaxCount > len(expired) {
+		expired = all[:len(all)-p.MaxCount]
+	}
+
+	for _, k := range expired {
+		tx.recordDelete("Outbox")
+		if err := bkt.Delete(k); err != nil {
+			return 0, err
+		}
+	}
+	return len(expired), nil
+}
+
+// nestedBuckets returns the keys of the buckets nested within b.
+func nestedBuckets(b *bolt.Bucket) [][]byte {
+	var a [][]byte
+	b.ForEach(func(k, v []byte) error {
+		if v == nil {
+			a = append(a, append([]byte{}, k...))
+		}
+		return nil
+	})
+	return a
+}
+
+// monitorRetention periodically enforces the retention policies until the
+// store is closed.
+func (s *Store) monitorRetention() {
+	ticker := time.NewTicker(s.retentionInterval())
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.closing:
+			return
+		case <-ticker.C:
+			s.enforceRetentionAll()
+		}
+	}
+}
+
+// enforceRetentionAll enforces the retention policies on the store and on
+// every tenant.
+func (s *Store) enforceRetentionAll() {
+	if s.Frozen() {
+		return
+	}
+
+	log := func(tenant string, m map[string]int, err error) {
+		if err != nil {
+			s.logger().Error("retention failed", "tenant", tenant, "err", err)
+			return
+		}
+		for target, n := range m {
+			if n > 0 {
+				s.logger().Info("retention purged records", "tenant", tenant, "target", target, "n", n)
+			}
+		}
+	}
+
+	m, err := s.EnforceRetention()
+	log("", m, err)
+
+	tenants, err := s.Tenants()
+	if err != nil {
+		s.logger().Error("retention failed", "err", err)
+		return
+	}
+	for _, name := range tenants {
+		m, err := s.Tenant(name).EnforceRetention()
+		log(name, m, err)
+	}
+}
+
+// retentionInterval returns the configured interval or the default, if unset.
+func (s *Store) retentionInterval() time.Duration {
+	if s.RetentionInterval == 0 {
+		return DefaultRetentionInterval
+	}
+	return s.RetentionInterval
+}
+
+// Retention related errors.
+var (
+	ErrInvalidRetentionTarget = &Error{Code: EINVALID, Message: "invalid retention target"}
+)
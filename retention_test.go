@@ -0,0 +1,144 @@
+package main_test
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	main "github.com/benbjohnson/application-development-using-boltdb"
+)
+
+// Ensure revisions beyond a retention policy's count are removed.
+func TestStore_EnforceRetention_UserHistory(t *testing.T) {
+	s := OpenStore()
+	defer s.Close()
+	s.UserHistoryLimit = 100
+	s.Retention = []main.RetentionPolicy{{Target: main.RetainUserHistory, MaxCount: 2}}
+
+	if err := s.CreateUser(&main.User{Username: "susy"}); err != nil {
+		t.Fatal(err)
+	}
+	for _, tag := range []string{"a", "b", "c", "d"} {
+		if err := s.AddTag(1, tag); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if m, err := s.EnforceRetention(); err != nil {
+		t.Fatal(err)
+	} else if !reflect.DeepEqual(m, map[string]int{main.RetainUserHistory: 3}) {
+		t.Fatalf("unexpected result: %v", m)
+	} else if a, err := s.UserHistory(1); err != nil {
+		t.Fatal(err)
+	} else if len(a) != 2 || a[0].Revision != 4 || a[1].Revision != 5 {
+		t.Fatalf("unexpected history: %#v", a)
+	}
+}
+
+// Ensure the history of deleted users is removed once it is old enough.
+func TestStore_EnforceRetention_DeletedUsers(t *testing.T) {
+	s := OpenStore()
+	defer s.Close()
+	s.UserHistoryLimit = 10
+	s.Retention = []main.RetentionPolicy{{Target: main.RetainDeletedUsers, MaxAge: time.Millisecond}}
+
+	if err := s.CreateUser(&main.User{Username: "susy"}); err != nil {
+		t.Fatal(err)
+	} else if err := s.CreateUser(&main.User{Username: "john"}); err != nil {
+		t.Fatal(err)
+	} else if err := s.DeleteUser(1); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(5 * time.Millisecond)
+
+	if m, err := s.EnforceRetention(); err != nil {
+		t.Fatal(err)
+	} else if m[main.RetainDeletedUsers] != 1 {
+		t.Fatalf("unexpected result: %v", m)
+	} else if err := s.RevertUser(1, 1); !errors.Is(err, main.ErrRevisionNotFound) {
+		t.Fatalf("unexpected error: %v", err)
+	} else if a, err := s.UserHistory(2); err != nil {
+		t.Fatal(err)
+	} else if len(a) != 1 {
+		t.Fatalf("unexpected history: %#v", a)
+	}
+}
+
+// Ensure the oldest dead jobs are removed and purges are recorded.
+func TestStore_EnforceRetention_DeadJobs(t *testing.T) {
+	s := OpenStore()
+	defer s.Close()
+	s.JobMaxAttempts = 1
+	s.Retention = []main.RetentionPolicy{{Target: main.RetainDeadJobs, MaxCount: 1}}
+
+	purged := make(map[string]int)
+	s.Metrics = purgeRecorder(purged)
+
+	for _, typ := range []string{"email", "cleanup"} {
+		if err := s.Enqueue(&main.Job{Type: typ}); err != nil {
+			t.Fatal(err)
+		} else if j, err := s.Dequeue("w1"); err != nil {
+			t.Fatal(err)
+		} else if err := s.Nack(j.ID, "w1", errors.New("marker")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := s.EnforceRetention(); err != nil {
+		t.Fatal(err)
+	} else if a, err := s.DeadJobs(); err != nil {
+		t.Fatal(err)
+	} else if len(a) != 1 || a[0].Type != "cleanup" {
+		t.Fatalf("unexpected dead jobs: %#v", a)
+	} else if !reflect.DeepEqual(purged, map[string]int{main.RetainDeadJobs: 1}) {
+		t.Fatalf("unexpected purges: %v", purged)
+	}
+}
+
+// Ensure the oldest outbox events are removed.
+func TestStore_EnforceRetention_Outbox(t *testing.T) {
+	s := OpenStore()
+	defer s.Close()
+	s.Outbox = true
+	s.Retention = []main.RetentionPolicy{{Target: main.RetainOutbox, MaxCount: 1}}
+
+	if err := s.CreateUser(&main.User{Username: "susy"}); err != nil {
+		t.Fatal(err)
+	} else if err := s.SetUsername(1, "jimbo"); err != nil {
+		t.Fatal(err)
+	}
+
+	if m, err := s.EnforceRetention(); err != nil {
+		t.Fatal(err)
+	} else if m[main.RetainOutbox] != 1 {
+		t.Fatalf("unexpected purges: %v", m)
+	}
+
+	var p Publisher
+	r := &main.Relay{Store: s.Store, Publisher: &p}
+	if _, err := r.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	} else if !reflect.DeepEqual(p.Types(), []string{"user.updated"}) {
+		t.Fatalf("unexpected events: %v", p.Types())
+	}
+}
+
+// Ensure an unknown retention target is rejected.
+func TestStore_EnforceRetention_ErrInvalidRetentionTarget(t *testing.T) {
+	s := OpenStore()
+	defer s.Close()
+	s.Retention = []main.RetentionPolicy{{Target: "audit_log", MaxAge: time.Hour}}
+
+	if _, err := s.EnforceRetention(); !errors.Is(err, main.ErrInvalidRetentionTarget) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+// purgeRecorder implements main.RetentionRecorder by counting purges.
+type purgeRecorder map[string]int
+
+func (r purgeRecorder) ObserveTx(op string, writable bool, d time.Duration, err error) {}
+
+func (r purgeRecorder) ObservePurge(target string, n int) { r[target] += n }
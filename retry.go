@@ -0,0 +1,85 @@
+package main
+
+import (
+	"errors"
+	"math/rand/v2"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/boltdb/bolt"
+)
+
+// DefaultMaxTxRetries is the default number of times a write transaction is
+// retried after a transient failure.
+const DefaultMaxTxRetries = 3
+
+// Backoff between retries of a write transaction. Each retry waits a random
+// duration between half and all of the current backoff, which doubles up to
+// the maximum.
+const (
+	minRetryBackoff = 10 * time.Millisecond
+	maxRetryBackoff = 1 * time.Second
+)
+
+// RetryRecorder is implemented by a MetricsRecorder that also records
+// retries of write transactions.
+type RetryRecorder interface {
+	ObserveRetry(op string)
+}
+
+// withRetry calls fn until it succeeds, returns an error that is not
+// transient, or has been retried MaxTxRetries times. fn is called again from
+// the start on each retry so it must not depend on state changed by an
+// earlier attempt.
+func (s *Store) withRetry(op string, fn func() error) error {
+	backoff := minRetryBackoff
+	for attempt := 0; ; attempt++ {
+		err := fn()
+		if err == nil || attempt >= s.maxTxRetries() || !isTransientError(err) {
+			return err
+		}
+
+		s.logger().Warn("transaction failed, retrying", "op", op, "attempt", attempt+1, "err", err)
+		if r, ok := s.Metrics.(RetryRecorder); ok {
+			r.ObserveRetry(op)
+		}
+
+		time.Sleep(backoff/2 + rand.N(backoff/2+1))
+		if backoff *= 2; backoff > maxRetryBackoff {
+			backoff = maxRetryBackoff
+		}
+	}
+}
+
+// maxTxRetries returns the configured number of retries or the default, if
+// unset. Returns zero if retries are disabled.
+func (s *Store) maxTxRetries() int {
+	if s.MaxTxRetries == 0 {
+		return DefaultMaxTxRetries
+	} else if s.MaxTxRetries < 0 {
+		return 0
+	}
+	return s.MaxTxRetries
+}
+
+// isTransientError returns true if err may not occur if the transaction is
+// attempted again, such as when the memory map could not be grown or a lock
+// was not acquired in time.
+func isTransientError(err error) bool {
+	var t interface{ Temporary() bool }
+	switch {
+	case errors.As(err, &t):
+		return t.Temporary()
+	case errors.Is(err, bolt.ErrTimeout),
+		errors.Is(err, syscall.EAGAIN),
+		errors.Is(err, syscall.EINTR),
+		errors.Is(err, syscall.ENOMEM):
+		return true
+	}
+
+	// Bolt reports failures to grow the data file without wrapping the
+	// underlying error.
+	msg := err.Error()
+	return strings.Contains(msg, "mmap allocate error") || strings.Contains(msg, "file resize error")
+}
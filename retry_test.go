@@ -0,0 +1,115 @@
+package main_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	main "github.com/benbjohnson/application-development-using-boltdb"
+	"github.com/benbjohnson/application-development-using-boltdb/keys"
+)
+
+// failingSchema returns the default schema with an index on usernames that
+// returns err for the next n writes.
+func failingSchema(n *int, err error) *main.Schema {
+	return &main.Schema{
+		Buckets: main.DefaultSchema.Buckets,
+		Indexes: append([]*main.Index{{
+			Name:   "UsersByFailure",
+			Source: "Users",
+			Keys: func(_, v []byte) ([][]byte, error) {
+				if *n > 0 {
+					*n--
+					return nil, err
+				}
+				var u main.User
+				if err := u.UnmarshalBinary(v); err != nil {
+					return nil, err
+				}
+				return [][]byte{keys.String(u.Username)}, nil
+			},
+		}}, main.DefaultSchema.Indexes...),
+	}
+}
+
+// temporaryError is an error that reports itself as transient.
+type temporaryError struct{}
+
+func (temporaryError) Error() string   { return "temporary failure" }
+func (temporaryError) Temporary() bool { return true }
+
+// Ensure a write that fails with a transient error is retried.
+func TestStore_Retry(t *testing.T) {
+	var failures int
+	retries := make(retryRecorder)
+	s := NewStore()
+	s.Schema = failingSchema(&failures, temporaryError{})
+	s.Metrics = retries
+	if err := s.Open(); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	failures = 2
+	u := &main.User{Username: "susy"}
+	if err := s.CreateUser(u); err != nil {
+		t.Fatal(err)
+	} else if u.ID != 1 {
+		t.Fatalf("unexpected id: %d", u.ID)
+	} else if retries["CreateUser"] != 2 {
+		t.Fatalf("unexpected retries: %d", retries["CreateUser"])
+	} else if a, err := s.Users(); err != nil {
+		t.Fatal(err)
+	} else if len(a) != 1 {
+		t.Fatalf("unexpected users: %d", len(a))
+	}
+}
+
+// Ensure retries stop after MaxTxRetries and permanent errors are not retried.
+func TestStore_Retry_Err(t *testing.T) {
+	t.Run("Exhausted", func(t *testing.T) {
+		var failures int
+		retries := make(retryRecorder)
+		s := NewStore()
+		s.Schema = failingSchema(&failures, temporaryError{})
+		s.Metrics = retries
+		s.MaxTxRetries = 2
+		if err := s.Open(); err != nil {
+			t.Fatal(err)
+		}
+		defer s.Close()
+
+		failures = 5
+		if err := s.CreateUser(&main.User{Username: "susy"}); !errors.As(err, &temporaryError{}) {
+			t.Fatalf("unexpected error: %v", err)
+		} else if retries["CreateUser"] != 2 || failures != 2 {
+			t.Fatalf("unexpected retries: %d, remaining failures %d", retries["CreateUser"], failures)
+		}
+	})
+
+	t.Run("Permanent", func(t *testing.T) {
+		var failures int
+		retries := make(retryRecorder)
+		s := NewStore()
+		s.Schema = failingSchema(&failures, errors.New("marker"))
+		s.Metrics = retries
+		if err := s.Open(); err != nil {
+			t.Fatal(err)
+		}
+		defer s.Close()
+
+		failures = 1
+		if err := s.CreateUser(&main.User{Username: "susy"}); err == nil || err.Error() != "marker" {
+			t.Fatalf("unexpected error: %v", err)
+		} else if len(retries) != 0 {
+			t.Fatalf("unexpected retries: %v", retries)
+		}
+	})
+}
+
+// retryRecorder implements main.RetryRecorder by counting retries.
+type retryRecorder map[string]int
+
+func (r retryRecorder) ObserveTx(op string, writable bool, d time.Duration, err error) {}
+
+func (r retryRecorder) ObserveRetry(op string) { r[op]++ }
@@ -0,0 +1,453 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/benbjohnson/application-development-using-boltdb/internal"
+	"github.com/benbjohnson/application-development-using-boltdb/keys"
+	"github.com/gogo/protobuf/proto"
+)
+
+// DefaultSchedulerInterval is the default time between checks for due
+// schedules.
+const DefaultSchedulerInterval = 1 * time.Second
+
+// MissedRunPolicy determines what happens to runs of a schedule that were
+// missed, such as while the process was stopped.
+type MissedRunPolicy int
+
+// Missed run policies.
+const (
+	// Missed runs are combined into a single run as soon as possible.
+	MissedRunOnce MissedRunPolicy = iota
+
+	// Every missed run is made, one per scheduler interval, until the
+	// schedule has caught up.
+	MissedRunAll
+
+	// Missed runs are skipped and the schedule waits for its next run time.
+	MissedRunSkip
+)
+
+// Schedule runs a registered task at the times given by its spec.
+type Schedule struct {
+	Name string
+
+	// Run times, such as "@every 1h", "@daily", or "30 2 * * *".
+	// See parseScheduleSpec for the supported forms.
+	Spec string
+
+	// Name of the task to run and an argument passed to it, such as the
+	// directory of a backup.
+	Task string
+	Arg  string
+
+	Missed MissedRunPolicy
+
+	// Time of the next run, and the time and error of the last run.
+	NextRunAt time.Time
+	LastRunAt time.Time
+	LastError string
+}
+
+// Validate returns an error if sc cannot be saved.
+func (sc *Schedule) Validate() error {
+	if sc.Name == "" {
+		return ErrScheduleNameRequired
+	} else if sc.Task == "" {
+		return ErrScheduleTaskRequired
+	} else if sc.Missed < MissedRunOnce || sc.Missed > MissedRunSkip {
+		return ErrMissedRunPolicyInvalid
+	} else if _, err := parseScheduleSpec(sc.Spec); err != nil {
+		return err
+	}
+	return nil
+}
+
+// MarshalBinary encodes a schedule to binary format.
+func (sc *Schedule) MarshalBinary() ([]byte, error) {
+	return proto.Marshal(&internal.Schedule{
+		Name:      proto.String(sc.Name),
+		Spec:      proto.String(sc.Spec),
+		Task:      proto.String(sc.Task),
+		Arg:       proto.String(sc.Arg),
+		Missed:    proto.Int64(int64(sc.Missed)),
+		NextRunAt: proto.Int64(encodeTime(sc.NextRunAt)),
+		LastRunAt: proto.Int64(encodeTime(sc.LastRunAt)),
+		LastError: proto.String(sc.LastError),
+	})
+}
+
+// UnmarshalBinary decodes a schedule from binary data.
+func (sc *Schedule) UnmarshalBinary(data []byte) error {
+	var pb internal.Schedule
+	if err := proto.Unmarshal(data, &pb); err != nil {
+		return err
+	}
+
+	sc.Name = pb.GetName()
+	sc.Spec = pb.GetSpec()
+	sc.Task = pb.GetTask()
+	sc.Arg = pb.GetArg()
+	sc.Missed = MissedRunPolicy(pb.GetMissed())
+	sc.NextRunAt = decodeTime(pb.GetNextRunAt())
+	sc.LastRunAt = decodeTime(pb.GetLastRunAt())
+	sc.LastError = pb.GetLastError()
+
+	return nil
+}
+
+// The "Schedules" bucket maps each schedule name to its schedule and the
+// "ScheduleQueue" bucket holds a key for each schedule made of its next run
+// time followed by its name, so due schedules are read from the start.
+
+// SetSchedule creates or replaces a schedule. The next run is computed from
+// the current time unless the spec is unchanged, in which case the existing
+// next run is kept. NextRunAt is set on sc on success.
+func (s *Store) SetSchedule(sc *Schedule) error {
+	if err := sc.Validate(); err != nil {
+		return err
+	}
+	spec, _ := parseScheduleSpec(sc.Spec)
+
+	return s.update("SetSchedule", func(tx *Tx) error {
+		prev, err := loadSchedule(tx, sc.Name)
+		if err != nil {
+			return err
+		}
+
+		sc.NextRunAt = spec.next(time.Now().UTC())
+		if prev != nil {
+			sc.LastRunAt, sc.LastError = prev.LastRunAt, prev.LastError
+			if prev.Spec == sc.Spec {
+				sc.NextRunAt = prev.NextRunAt
+			}
+		}
+		return saveSchedule(tx, prev, sc)
+	})
+}
+
+// Schedule retrieves a schedule by name. Returns nil if the schedule does
+// not exist.
+func (s *Store) Schedule(name string) (*Schedule, error) {
+	var sc *Schedule
+	if err := s.view("Schedule", func(tx *Tx) error {
+		var err error
+		sc, err = loadSchedule(tx, name)
+		return err
+	}); err != nil {
+		return nil, err
+	}
+	return sc, nil
+}
+
+// Schedules retrieves a list of all schedules ordered by name.
+func (s *Store) Schedules() ([]*Schedule, error) {
+	a := []*Schedule{}
+	if err := s.view("Schedules", func(tx *Tx) error {
+		return tx.Bucket([]byte("Schedules")).ForEach(func(_, v []byte) error {
+			tx.recordRead("Schedules", v)
+
+			var sc Schedule
+			if err := sc.UnmarshalBinary(v); err != nil {
+				return err
+			}
+			a = append(a, &sc)
+			return nil
+		})
+	}); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// DeleteSchedule removes a schedule by name. Returns ErrScheduleNotFound if
+// the schedule does not exist.
+func (s *Store) DeleteSchedule(name string) error {
+	return s.update("DeleteSchedule", func(tx *Tx) error {
+		sc, err := loadSchedule(tx, name)
+		if err != nil {
+			return err
+		} else if sc == nil {
+			return keyError("schedule", name, ErrScheduleNotFound)
+		}
+
+		tx.recordDelete("ScheduleQueue")
+		if err := tx.Bucket([]byte("ScheduleQueue")).Delete(scheduleQueueKey(sc)); err != nil {
+			return err
+		}
+		tx.recordDelete("Schedules")
+		return tx.Bucket([]byte("Schedules")).Delete([]byte(name))
+	})
+}
+
+// loadSchedule reads a schedule by name. Returns nil if it does not exist.
+func loadSchedule(tx *Tx, name string) (*Schedule, error) {
+	v := tx.Bucket([]byte("Schedules")).Get([]byte(name))
+	if v == nil {
+		return nil, nil
+	}
+	tx.recordRead("Schedules", v)
+
+	sc := &Schedule{}
+	if err := sc.UnmarshalBinary(v); err != nil {
+		return nil, err
+	}
+	return sc, nil
+}
+
+// saveSchedule writes sc and moves its queue entry from that of prev, if any.
+func saveSchedule(tx *Tx, prev, sc *Schedule) error {
+	queue := tx.Bucket([]byte("ScheduleQueue"))
+	if prev != nil {
+		tx.recordDelete("ScheduleQueue")
+		if err := queue.Delete(scheduleQueueKey(prev)); err != nil {
+			return err
+		}
+	}
+
+	buf, err := sc.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	tx.recordWrite("Schedules", buf)
+	if err := tx.Bucket([]byte("Schedules")).Put([]byte(sc.Name), buf); err != nil {
+		return err
+	}
+	tx.recordWrite("ScheduleQueue", nil)
+	return queue.Put(scheduleQueueKey(sc), nil)
+}
+
+// scheduleQueueKey returns the key of sc in the schedule queue.
+func scheduleQueueKey(sc *Schedule) []byte {
+	return keys.Join(keys.Time(sc.NextRunAt), keys.String(sc.Name))
+}
+
+// TaskFunc is a task that can be run by a schedule. arg is the schedule's
+// Arg.
+type TaskFunc func(ctx context.Context, s *Store, arg string) error
+
+// DefaultTasks are the tasks available to schedules if a Scheduler's Tasks
+// is unset.
+var DefaultTasks = map[string]TaskFunc{
+	// Writes a snapshot to the directory given by arg, named after the data
+	// file and the current time.
+	"backup": func(ctx context.Context, s *Store, arg string) error {
+		if arg == "" {
+			return ErrBackupDirRequired
+		}
+		path := filepath.Join(arg, filepath.Base(s.Path)+"."+time.Now().UTC().Format("20060102T150405Z"))
+		return s.Snapshot(path)
+	},
+
+	// Enforces the store's retention policies.
+	"retention": func(ctx context.Context, s *Store, arg string) error {
+		_, err := s.EnforceRetention()
+		return err
+	},
+
+	// Rebuilds every index.
+	"reindex": func(ctx context.Context, s *Store, arg string) error {
+		return s.ReindexAll(nil)
+	},
+}
+
+// Scheduler runs the tasks of due schedules in the background.
+//
+// A due schedule is claimed by advancing its next run in the same
+// transaction that reads it, before its task runs, so a run is never
+// repeated if the process stops while the task is running. Only one
+// scheduler should run per store.
+type Scheduler struct {
+	closing chan struct{}
+	wg      sync.WaitGroup
+
+	// Store to read schedules from.
+	Store *Store
+
+	// Tasks that schedules can run, by name. Defaults to DefaultTasks.
+	Tasks map[string]TaskFunc
+
+	// Time between checks for due schedules.
+	// Defaults to DefaultSchedulerInterval.
+	Interval time.Duration
+
+	// Returns the current time. Defaults to time.Now.
+	Now func() time.Time
+}
+
+// Open starts running schedules in the background.
+func (r *Scheduler) Open() error {
+	r.closing = make(chan struct{})
+	r.wg.Add(1)
+	go func() { defer r.wg.Done(); r.monitor() }()
+	return nil
+}
+
+// Close stops running schedules and waits for running tasks to finish.
+func (r *Scheduler) Close() error {
+	if r.closing != nil {
+		close(r.closing)
+		r.wg.Wait()
+		r.closing = nil
+	}
+	return nil
+}
+
+// monitor runs due schedules on every interval until the scheduler is
+// closed.
+func (r *Scheduler) monitor() {
+	interval := r.Interval
+	if interval <= 0 {
+		interval = DefaultSchedulerInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-r.closing:
+			return
+		case <-ticker.C:
+			if _, err := r.RunDue(context.Background()); err != nil {
+				r.Store.logger().Error("scheduler failed", "err", err)
+			}
+		}
+	}
+}
+
+// RunDue claims every due schedule, runs its task, and returns the number of
+// tasks run. Each schedule runs at most once per call. Task failures are
+// recorded in the schedule's LastError and are not returned.
+func (r *Scheduler) RunDue(ctx context.Context) (int, error) {
+	var claimed []*Schedule
+	if err := r.Store.update("ClaimSchedules", func(tx *Tx) error {
+		claimed = nil
+		now := r.now().UTC()
+
+		// Collect due schedules first since claiming rewrites the queue.
+		var due []string
+		c := tx.Bucket([]byte("ScheduleQueue")).Cursor()
+		for k, _ := c.First(); k != nil && bytes.Compare(k, keys.Time(now)) <= 0; k, _ = c.Next() {
+			kr := keys.NewReader(k)
+			kr.ReadTime()
+			name := kr.ReadString()
+			if err := kr.Err(); err != nil {
+				return err
+			}
+			due = append(due, name)
+		}
+
+		for _, name := range due {
+			prev, err := loadSchedule(tx, name)
+			if err != nil {
+				return err
+			} else if prev == nil {
+				continue
+			}
+
+			sc := *prev
+			run, err := claimSchedule(&sc, now)
+			if err != nil {
+				return err
+			} else if err := saveSchedule(tx, prev, &sc); err != nil {
+				return err
+			}
+			if run {
+				claimed = append(claimed, &sc)
+			}
+		}
+		return nil
+	}); err != nil {
+		return 0, err
+	}
+
+	// Run tasks outside of a transaction since they may write themselves.
+	for _, sc := range claimed {
+		var errMsg string
+		if err := r.run(ctx, sc); err != nil {
+			r.Store.logger().Warn("scheduled task failed", "schedule", sc.Name, "task", sc.Task, "err", err)
+			errMsg = err.Error()
+		}
+
+		if err := r.Store.update("ScheduleRun", func(tx *Tx) error {
+			prev, err := loadSchedule(tx, sc.Name)
+			if err != nil || prev == nil {
+				return err
+			}
+			other := *prev
+			other.LastError = errMsg
+			return saveSchedule(tx, prev, &other)
+		}); err != nil {
+			return 0, err
+		}
+	}
+	return len(claimed), nil
+}
+
+// run runs the task of sc, recovering from panics.
+func (r *Scheduler) run(ctx context.Context, sc *Schedule) (err error) {
+	tasks := r.Tasks
+	if tasks == nil {
+		tasks = DefaultTasks
+	}
+	fn := tasks[sc.Task]
+	if fn == nil {
+		return keyError("task", sc.Task, ErrScheduleTaskNotFound)
+	}
+
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("task panic: %v", p)
+		}
+	}()
+	return fn(ctx, r.Store, sc.Arg)
+}
+
+// now returns the current time from Now or time.Now, if unset.
+func (r *Scheduler) now() time.Time {
+	if r.Now != nil {
+		return r.Now()
+	}
+	return time.Now()
+}
+
+// claimSchedule advances the next run of a due schedule according to its
+// missed run policy and returns true if its task should run now. A run is
+// missed if the run after it is also due.
+func claimSchedule(sc *Schedule, now time.Time) (bool, error) {
+	spec, err := parseScheduleSpec(sc.Spec)
+	if err != nil {
+		return false, err
+	}
+
+	scheduled := sc.NextRunAt
+	sc.NextRunAt = spec.next(scheduled)
+	if sc.NextRunAt.After(now) || sc.Missed == MissedRunAll {
+		sc.LastRunAt = now
+		return true, nil
+	}
+
+	sc.NextRunAt = spec.next(now)
+	if sc.Missed == MissedRunSkip {
+		return false, nil
+	}
+	sc.LastRunAt = now
+	return true, nil
+}
+
+// Schedule related errors.
+var (
+	ErrScheduleNameRequired   = &Error{Code: EINVALID, Message: "schedule name required"}
+	ErrScheduleTaskRequired   = &Error{Code: EINVALID, Message: "schedule task required"}
+	ErrScheduleSpecInvalid    = &Error{Code: EINVALID, Message: "invalid schedule spec"}
+	ErrMissedRunPolicyInvalid = &Error{Code: EINVALID, Message: "invalid missed run policy"}
+	ErrScheduleNotFound       = &Error{Code: ENOTFOUND, Message: "schedule not found"}
+	ErrScheduleTaskNotFound   = &Error{Code: ENOTFOUND, Message: "schedule task not registered"}
+	ErrBackupDirRequired      = &Error{Code: EINVALID, Message: "backup directory required"}
+)
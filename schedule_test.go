@@ -0,0 +1,214 @@
+package main_test
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	main "github.com/benbjohnson/application-development-using-boltdb"
+)
+
+// Ensure schedules can be saved, listed, and deleted.
+func TestStore_SetSchedule(t *testing.T) {
+	s := OpenStore()
+	defer s.Close()
+
+	sc := &main.Schedule{Name: "nightly", Spec: "30 2 * * *", Task: "backup", Arg: "/backups"}
+	if err := s.SetSchedule(sc); err != nil {
+		t.Fatal(err)
+	} else if sc.NextRunAt.Hour() != 2 || sc.NextRunAt.Minute() != 30 || !sc.NextRunAt.After(time.Now()) {
+		t.Fatalf("unexpected next run: %s", sc.NextRunAt)
+	} else if err := s.SetSchedule(&main.Schedule{Name: "cleanup", Spec: "@hourly", Task: "retention"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Schedules persist across reopens.
+	if err := s.Reopen(); err != nil {
+		t.Fatal(err)
+	} else if other, err := s.Schedule("nightly"); err != nil {
+		t.Fatal(err)
+	} else if other.Spec != "30 2 * * *" || other.Arg != "/backups" || !other.NextRunAt.Equal(sc.NextRunAt) {
+		t.Fatalf("unexpected schedule: %#v", other)
+	} else if a, err := s.Schedules(); err != nil {
+		t.Fatal(err)
+	} else if len(a) != 2 || a[0].Name != "cleanup" || a[1].Name != "nightly" {
+		t.Fatalf("unexpected schedules: %#v", a)
+	}
+
+	if err := s.DeleteSchedule("nightly"); err != nil {
+		t.Fatal(err)
+	} else if sc, err := s.Schedule("nightly"); err != nil {
+		t.Fatal(err)
+	} else if sc != nil {
+		t.Fatalf("unexpected schedule: %#v", sc)
+	} else if err := s.DeleteSchedule("nightly"); !errors.Is(err, main.ErrScheduleNotFound) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+// Ensure invalid schedules are rejected.
+func TestStore_SetSchedule_ErrInvalid(t *testing.T) {
+	s := OpenStore()
+	defer s.Close()
+
+	for _, tt := range []struct {
+		sc  main.Schedule
+		err error
+	}{
+		{main.Schedule{Spec: "@daily", Task: "backup"}, main.ErrScheduleNameRequired},
+		{main.Schedule{Name: "x", Spec: "@daily"}, main.ErrScheduleTaskRequired},
+		{main.Schedule{Name: "x", Spec: "61 * * * *", Task: "backup"}, main.ErrScheduleSpecInvalid},
+		{main.Schedule{Name: "x", Spec: "@daily", Task: "backup", Missed: 5}, main.ErrMissedRunPolicyInvalid},
+	} {
+		if err := s.SetSchedule(&tt.sc); !errors.Is(err, tt.err) {
+			t.Fatalf("%#v: unexpected error: %v", tt.sc, err)
+		}
+	}
+}
+
+// Ensure due schedules run once and record task failures.
+func TestScheduler_RunDue(t *testing.T) {
+	s := OpenStore()
+	defer s.Close()
+
+	var mu sync.Mutex
+	var args []string
+	r := &main.Scheduler{
+		Store: s.Store,
+		Tasks: map[string]main.TaskFunc{
+			"record": func(ctx context.Context, s *main.Store, arg string) error {
+				mu.Lock()
+				defer mu.Unlock()
+				args = append(args, arg)
+				return nil
+			},
+			"fail": func(ctx context.Context, s *main.Store, arg string) error {
+				return errors.New("marker")
+			},
+			"panic": func(ctx context.Context, s *main.Store, arg string) error {
+				panic("boom")
+			},
+		},
+	}
+
+	for _, sc := range []*main.Schedule{
+		{Name: "a", Spec: "@every 1s", Task: "record", Arg: "x"},
+		{Name: "b", Spec: "@every 1s", Task: "fail"},
+		{Name: "c", Spec: "@every 1s", Task: "panic"},
+		{Name: "d", Spec: "@every 1s", Task: "missing"},
+		{Name: "e", Spec: "@daily", Task: "record", Arg: "never"},
+	} {
+		if err := s.SetSchedule(sc); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Nothing is due yet.
+	if n, err := r.RunDue(context.Background()); err != nil {
+		t.Fatal(err)
+	} else if n != 0 {
+		t.Fatalf("unexpected count: %d", n)
+	}
+
+	now := time.Now().Add(1100 * time.Millisecond)
+	r.Now = func() time.Time { return now }
+	if n, err := r.RunDue(context.Background()); err != nil {
+		t.Fatal(err)
+	} else if n != 4 {
+		t.Fatalf("unexpected count: %d", n)
+	} else if len(args) != 1 || args[0] != "x" {
+		t.Fatalf("unexpected args: %v", args)
+	}
+
+	// Runs advance the next run and record the outcome.
+	if sc, err := s.Schedule("a"); err != nil {
+		t.Fatal(err)
+	} else if sc.LastRunAt.IsZero() || !sc.NextRunAt.After(sc.LastRunAt) || sc.LastError != "" {
+		t.Fatalf("unexpected schedule: %#v", sc)
+	}
+	for name, msg := range map[string]string{"b": "marker", "c": "task panic: boom", "d": "task missing: schedule task not registered"} {
+		if sc, err := s.Schedule(name); err != nil {
+			t.Fatal(err)
+		} else if sc.LastError != msg {
+			t.Fatalf("%s: unexpected error: %q", name, sc.LastError)
+		}
+	}
+}
+
+// Ensure missed runs follow each schedule's policy.
+func TestScheduler_RunDue_Missed(t *testing.T) {
+	s := OpenStore()
+	defer s.Close()
+
+	var mu sync.Mutex
+	runs := make(map[string]int)
+	r := &main.Scheduler{
+		Store: s.Store,
+		Tasks: map[string]main.TaskFunc{
+			"count": func(ctx context.Context, s *main.Store, arg string) error {
+				mu.Lock()
+				defer mu.Unlock()
+				runs[arg]++
+				return nil
+			},
+		},
+	}
+
+	for _, sc := range []*main.Schedule{
+		{Name: "once", Spec: "@every 1s", Task: "count", Arg: "once", Missed: main.MissedRunOnce},
+		{Name: "all", Spec: "@every 1s", Task: "count", Arg: "all", Missed: main.MissedRunAll},
+		{Name: "skip", Spec: "@every 1s", Task: "count", Arg: "skip", Missed: main.MissedRunSkip},
+	} {
+		if err := s.SetSchedule(sc); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Miss at least one run of each schedule.
+	now := time.Now().Add(2500 * time.Millisecond)
+	r.Now = func() time.Time { return now }
+	for i := 0; i < 2; i++ {
+		if _, err := r.RunDue(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if runs["once"] != 1 || runs["all"] != 2 || runs["skip"] != 0 {
+		t.Fatalf("unexpected runs: %v", runs)
+	}
+
+	// Skipped and combined runs wait for the next run time.
+	for _, name := range []string{"once", "skip"} {
+		if sc, err := s.Schedule(name); err != nil {
+			t.Fatal(err)
+		} else if !sc.NextRunAt.After(now) {
+			t.Fatalf("%s: unexpected next run: %s", name, sc.NextRunAt)
+		}
+	}
+}
+
+// Ensure the backup task writes a snapshot to the schedule's directory.
+func TestDefaultTasks_Backup(t *testing.T) {
+	s := OpenStore()
+	defer s.Close()
+
+	if err := s.CreateUser(&main.User{Username: "susy"}); err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	if err := main.DefaultTasks["backup"](context.Background(), s.Store, dir); err != nil {
+		t.Fatal(err)
+	} else if a, err := filepath.Glob(filepath.Join(dir, "*")); err != nil {
+		t.Fatal(err)
+	} else if len(a) != 1 {
+		t.Fatalf("unexpected files: %v", a)
+	}
+
+	if err := main.DefaultTasks["backup"](context.Background(), s.Store, ""); !errors.Is(err, main.ErrBackupDirRequired) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,562 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+
+	"github.com/benbjohnson/application-development-using-boltdb/keys"
+	"github.com/boltdb/bolt"
+)
+
+// Schema declares the buckets, indexes, and views of a store.
+//
+// Open creates every bucket, index, and view in the schema that does not
+// exist yet and builds new indexes and views from their source buckets in
+// batches. Afterwards, every value written to a source bucket through the
+// store updates its indexes and views.
+type Schema struct {
+	Buckets []BucketSchema
+	Indexes []*Index
+	Views   []*View
+}
+
+// BucketSchema declares a bucket and the buckets nested within it.
+type BucketSchema struct {
+	Name    string
+	Buckets []BucketSchema
+}
+
+// Index declares a secondary index on the values of a bucket.
+type Index struct {
+	// Name of the bucket that holds the index entries.
+	Name string
+
+	// Name of the indexed bucket.
+	Source string
+
+	// Returns the encoded values to index for the record stored under key.
+	// The record is passed after being reassembled and decompressed.
+	Keys func(key, value []byte) ([][]byte, error)
+
+	// Requires that no two records share an indexed value. Entries of a
+	// unique index map the value to the record's key. Otherwise each entry
+	// key is the value followed by the record's key.
+	Unique bool
+}
+
+// DefaultSchema is the schema used by stores that do not set one.
+var DefaultSchema = &Schema{
+	Buckets: []BucketSchema{
+		{Name: "Users"},
+		{Name: "APIKeys"},
+		{Name: "Idempotency"},
+		{Name: "Overflow"},
+		{Name: "Blobs"},
+		{Name: "Expirations"},
+		{Name: "ExpirationKeys"},
+		{Name: "Jobs"},
+		{Name: "JobsByVisibleAt"},
+		{Name: "DeadJobs"},
+		{Name: "Outbox"},
+		{Name: "UserHistory"},
+		{Name: "ReservedUsernames"},
+		{Name: "LoginAttempts"},
+		{Name: "TOTP"},
+		{Name: "Identities"},
+		{Name: "Passwords"},
+		{Name: "Invites"},
+		{Name: "MergedUsers"},
+		{Name: "Erasures"},
+		{Name: "Following"},
+		{Name: "Followers"},
+		{Name: "FollowCounts"},
+		{Name: "Counters"},
+		{Name: "Leaderboards"},
+		{Name: "Activity"},
+		{Name: "ActivityRollups"},
+		{Name: "RateLimits"},
+		{Name: "Flags"},
+		{Name: "Webhooks"},
+		{Name: "WebhookDeliveries"},
+		{Name: "WebhookQueue"},
+		{Name: "Emails"},
+		{Name: "EmailQueue"},
+		{Name: "PasswordResets"},
+		{Name: "Schedules"},
+		{Name: "ScheduleQueue"},
+		{Name: "Leases"},
+		{Name: "ChangeOffsets"},
+		{Name: "ImportJobs"},
+	},
+	Indexes: []*Index{
+		{Name: "UsersByUsername", Source: "Users", Keys: usernameKeys},
+		{Name: "UsersByTag", Source: "Users", Keys: tagKeys},
+		{Name: "UsersByEmail", Source: "Users", Keys: emailKeys},
+		{Name: "UsersByStatus", Source: "Users", Keys: statusKeys},
+		{Name: "IdentitiesBySubject", Source: "Identities", Keys: identityKeys, Unique: true},
+	},
+}
+
+// usernameKeys indexes a user by its username.
+func usernameKeys(_, v []byte) ([][]byte, error) {
+	var u User
+	if err := u.UnmarshalBinary(v); err != nil {
+		return nil, err
+	}
+	return [][]byte{keys.String(u.Username)}, nil
+}
+
+// tagKeys indexes a user by each of its tags.
+func tagKeys(_, v []byte) ([][]byte, error) {
+	var u User
+	if err := u.UnmarshalBinary(v); err != nil {
+		return nil, err
+	}
+
+	a := make([][]byte, len(u.Tags))
+	for i, tag := range u.Tags {
+		a[i] = keys.String(tag)
+	}
+	return a, nil
+}
+
+// emailKeys indexes a user by its email address, ignoring case. Users
+// without an email are not indexed.
+func emailKeys(_, v []byte) ([][]byte, error) {
+	var u User
+	if err := u.UnmarshalBinary(v); err != nil {
+		return nil, err
+	} else if u.Email == "" {
+		return nil, nil
+	}
+	return [][]byte{keys.String(normalizeEmail(u.Email))}, nil
+}
+
+// statusKeys indexes a user by its status. Active users, which are most
+// users, are not indexed.
+func statusKeys(_, v []byte) ([][]byte, error) {
+	var u User
+	if err := u.UnmarshalBinary(v); err != nil {
+		return nil, err
+	} else if u.Status == UserActive {
+		return nil, nil
+	}
+	return [][]byte{keys.String(u.Status.String())}, nil
+}
+
+// schema returns the store's schema or the default schema, if unset.
+func (s *Store) schema() *Schema {
+	if s.Schema == nil {
+		return DefaultSchema
+	}
+	return s.Schema
+}
+
+// create creates all missing buckets, indexes, and views within the
+// transaction's root. Indexes and views that did not exist are marked to be
+// built from their source buckets by buildPendingIndexes and
+// buildPendingViews.
+func (sc *Schema) create(tx *Tx) error {
+	pending, err := tx.CreateBucketIfNotExists([]byte("IndexBuilds"))
+	if err != nil {
+		return err
+	}
+	pendingViews, err := tx.CreateBucketIfNotExists([]byte("ViewBuilds"))
+	if err != nil {
+		return err
+	} else if _, err := tx.CreateBucketIfNotExists([]byte("Meta")); err != nil {
+		return err
+	}
+
+	for _, bs := range sc.Buckets {
+		b, err := tx.CreateBucketIfNotExists([]byte(bs.Name))
+		if err != nil {
+			return err
+		} else if err := createNestedBuckets(b, bs.Buckets); err != nil {
+			return err
+		}
+	}
+
+	for _, idx := range sc.Indexes {
+		if tx.Bucket([]byte(idx.Name)) != nil {
+			continue
+		} else if _, err := tx.CreateBucket([]byte(idx.Name)); err != nil {
+			return err
+		} else if err := pending.Put([]byte(idx.Name), []byte{}); err != nil {
+			return err
+		}
+	}
+
+	for _, view := range sc.Views {
+		if tx.Bucket([]byte(view.Name)) != nil {
+			continue
+		} else if _, err := tx.CreateBucket([]byte(view.Name)); err != nil {
+			return err
+		} else if err := pendingViews.Put([]byte(view.Name), []byte{}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// index returns the index named name or nil if it does not exist.
+func (sc *Schema) index(name string) *Index {
+	for _, idx := range sc.Indexes {
+		if idx.Name == name {
+			return idx
+		}
+	}
+	return nil
+}
+
+// createNestedBuckets creates the buckets declared by a within b.
+func createNestedBuckets(b *bolt.Bucket, a []BucketSchema) error {
+	for _, bs := range a {
+		child, err := b.CreateBucketIfNotExists([]byte(bs.Name))
+		if err != nil {
+			return err
+		} else if err := createNestedBuckets(child, bs.Buckets); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// indexesOf returns the indexes whose source is the bucket named name.
+func (sc *Schema) indexesOf(name string) []*Index {
+	var a []*Index
+	for _, idx := range sc.Indexes {
+		if idx.Source == name {
+			a = append(a, idx)
+		}
+	}
+	return a
+}
+
+// entries returns the index entries for the record v stored under key,
+// mapped from entry key to entry value. v must already be decoded.
+func (idx *Index) entries(key, v []byte) (map[string][]byte, error) {
+	if v == nil {
+		return nil, nil
+	}
+
+	values, err := idx.Keys(key, v)
+	if err != nil {
+		return nil, err
+	}
+
+	m := make(map[string][]byte, len(values))
+	for _, value := range values {
+		if idx.Unique {
+			m[string(value)] = key
+		} else {
+			m[string(keys.Join(value, key))] = nil
+		}
+	}
+	return m, nil
+}
+
+// putEntry writes an index entry for the record stored under key.
+// Returns ErrUniqueConstraint if a unique value belongs to another record.
+func (idx *Index) putEntry(tx *Tx, key, k, v []byte) error {
+	bkt := tx.Bucket([]byte(idx.Name))
+	if idx.Unique {
+		if other := bkt.Get(k); other != nil && !bytes.Equal(other, key) {
+			return ErrUniqueConstraint
+		}
+	}
+
+	tx.recordWrite(idx.Name, v)
+	return bkt.Put(k, v)
+}
+
+// updateIndexes updates every index on the bucket named name after the
+// record under key changes from prev to v, as stored. Either may be nil
+// when a record is created or deleted.
+func updateIndexes(tx *Tx, name string, key, prev, v []byte) error {
+	indexes := tx.store.schema().indexesOf(name)
+	if len(indexes) == 0 {
+		return nil
+	}
+
+	prev, err := decodeValue(tx, prev)
+	if err != nil {
+		return err
+	}
+	v, err = decodeValue(tx, v)
+	if err != nil {
+		return err
+	}
+
+	for _, idx := range indexes {
+		before, err := idx.entries(key, prev)
+		if err != nil {
+			return err
+		}
+		after, err := idx.entries(key, v)
+		if err != nil {
+			return err
+		}
+
+		// Remove entries that no longer apply and add new ones.
+		for k := range before {
+			if _, ok := after[k]; !ok {
+				tx.recordDelete(idx.Name)
+				if err := tx.Bucket([]byte(idx.Name)).Delete([]byte(k)); err != nil {
+					return err
+				}
+			}
+		}
+		for k, ev := range after {
+			if _, ok := before[k]; ok {
+				continue
+			} else if err := idx.putEntry(tx, key, []byte(k), ev); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// rebuildIndex adds an entry to idx for every record in its source bucket.
+func rebuildIndex(tx *Tx, idx *Index) error {
+	return forEachIndexEntry(tx, idx, func(key, k, v []byte) error {
+		return idx.putEntry(tx, key, k, v)
+	})
+}
+
+// forEachIndexEntry calls fn with every entry that idx should contain
+// based on the current contents of its source bucket.
+func forEachIndexEntry(tx *Tx, idx *Index, fn func(key, k, v []byte) error) error {
+	return tx.Bucket([]byte(idx.Source)).ForEach(func(key, v []byte) error {
+		return forEachRecordEntry(tx, idx, key, v, fn)
+	})
+}
+
+// forEachRecordEntry calls fn with every entry of idx for the record v, as
+// stored under key in the source bucket. Nested buckets are skipped.
+func forEachRecordEntry(tx *Tx, idx *Index, key, v []byte, fn func(key, k, v []byte) error) error {
+	if v == nil {
+		return nil
+	}
+	tx.recordRead(idx.Source, v)
+
+	buf, err := decodeValue(tx, v)
+	if err != nil {
+		return err
+	}
+	m, err := idx.entries(key, buf)
+	if err != nil {
+		return err
+	}
+	for k, ev := range m {
+		if err := fn(key, []byte(k), ev); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// reindexBatchSize is the number of records indexed per transaction when
+// building an index.
+const reindexBatchSize = 1000
+
+// ReindexProgress reports the progress of building an index.
+type ReindexProgress struct {
+	Index string
+
+	// Number of source records indexed so far and in total.
+	N     int
+	Total int
+}
+
+// ReindexAll clears and rebuilds every index in the schema.
+//
+// Records are indexed in batches, each in its own transaction, so other
+// writers are not blocked while a large bucket is scanned. Writes made
+// during the rebuild keep the index up to date but queries may return
+// partial results until it finishes. An interrupted rebuild resumes when
+// the store is next opened. If fn is not nil, it is called after each batch.
+func (s *Store) ReindexAll(fn func(ReindexProgress)) error {
+	if err := s.update("ReindexAll", func(tx *Tx) error {
+		pending := tx.Bucket([]byte("IndexBuilds"))
+		for _, idx := range s.schema().Indexes {
+			if err := tx.DeleteBucket([]byte(idx.Name)); err != nil && err != bolt.ErrBucketNotFound {
+				return err
+			} else if _, err := tx.CreateBucket([]byte(idx.Name)); err != nil {
+				return err
+			} else if err := pending.Put([]byte(idx.Name), []byte{}); err != nil {
+				return err
+			}
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+	return s.buildPendingIndexes(fn)
+}
+
+// buildPendingIndexes builds every index that has been created or cleared
+// but not yet filled from its source bucket.
+func (s *Store) buildPendingIndexes(fn func(ReindexProgress)) error {
+	var names []string
+	if err := s.view("ReindexAll", func(tx *Tx) error {
+		return tx.Bucket([]byte("IndexBuilds")).ForEach(func(k, _ []byte) error {
+			names = append(names, string(k))
+			return nil
+		})
+	}); err != nil {
+		return err
+	}
+
+	for _, name := range names {
+		if err := s.buildIndex(name, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// buildIndex fills the index named name from its source bucket, one batch
+// per transaction. The key of the next record to index is saved in the
+// IndexBuilds bucket after each batch so the build can resume.
+func (s *Store) buildIndex(name string, fn func(ReindexProgress)) error {
+	p := ReindexProgress{Index: name}
+	var seek []byte
+	for done := false; !done; {
+		prev, from := p, seek
+		if err := s.update("ReindexAll", func(tx *Tx) error {
+			// Start over from the previous batch if the transaction is retried.
+			p, seek = prev, from
+			pending := tx.Bucket([]byte("IndexBuilds"))
+
+			// Drop partial indexes that are no longer in the schema. They
+			// are created again if the schema declares them later.
+			idx := s.schema().index(name)
+			if idx == nil {
+				done = true
+				if err := tx.DeleteBucket([]byte(name)); err != nil && err != bolt.ErrBucketNotFound {
+					return err
+				}
+				return pending.Delete([]byte(name))
+			}
+
+			// Resume from the saved position on the first batch. The position
+			// is tracked in memory afterwards so dry runs still progress.
+			src := tx.Bucket([]byte(idx.Source))
+			if p.Total == 0 {
+				p.Total = src.Stats().KeyN
+				seek = append([]byte{}, pending.Get([]byte(name))...)
+			}
+
+			// Index the next batch. Entries are written to another bucket
+			// so the cursor is not affected.
+			c := src.Cursor()
+			k, v := c.First()
+			if len(seek) > 0 {
+				k, v = c.Seek(seek)
+			}
+			for i := 0; k != nil && i < reindexBatchSize; k, v = c.Next() {
+				if err := forEachRecordEntry(tx, idx, k, v, func(key, k, v []byte) error {
+					return idx.putEntry(tx, key, k, v)
+				}); err != nil {
+					return err
+				}
+				p.N, i = p.N+1, i+1
+			}
+
+			// Save the position of the next batch or finish the build.
+			if k == nil {
+				done = true
+				return pending.Delete([]byte(name))
+			}
+			seek = append([]byte{}, k...)
+			return pending.Put([]byte(name), seek)
+		}); err != nil {
+			return err
+		}
+
+		if fn != nil {
+			fn(p)
+		}
+	}
+	return nil
+}
+
+// decodeValue reassembles and decompresses a stored value, if needed.
+// Returns nil if v is nil.
+func decodeValue(tx *Tx, v []byte) ([]byte, error) {
+	if v == nil {
+		return nil, nil
+	}
+
+	buf, err := readOverflow(tx, v)
+	if err != nil {
+		return nil, err
+	}
+	return decompress(buf)
+}
+
+// BucketPrefixSeparator ends a BucketPrefix. Bucket names must not contain
+// it so that the buckets of one prefix never match those of another.
+const BucketPrefixSeparator = ":"
+
+// internalBuckets are the buckets created by the store outside of its schema.
+var internalBuckets = []string{"Tenants", "IndexBuilds", "ViewBuilds", "Meta"}
+
+// bucketName returns the full name of a top-level bucket.
+func (s *Store) bucketName(name []byte) []byte {
+	if s.BucketPrefix == "" {
+		return name
+	}
+	return append([]byte(s.BucketPrefix), name...)
+}
+
+// ownBucketName returns name without the store's prefix and true if the
+// top-level bucket name belongs to the store.
+func (s *Store) ownBucketName(name []byte) ([]byte, bool) {
+	if !bytes.HasPrefix(name, []byte(s.BucketPrefix)) {
+		return nil, false
+	}
+	name = name[len(s.BucketPrefix):]
+	return name, !bytes.Contains(name, []byte(BucketPrefixSeparator))
+}
+
+// validateBucketNames returns an error if the bucket prefix is invalid or if
+// two buckets, indexes, or views of the schema share a name.
+func (s *Store) validateBucketNames() error {
+	if s.BucketPrefix != "" && !strings.HasSuffix(s.BucketPrefix, BucketPrefixSeparator) {
+		return ErrBucketPrefixInvalid
+	}
+
+	sc := s.schema()
+	names := append([]string{}, internalBuckets...)
+	for _, bs := range sc.Buckets {
+		names = append(names, bs.Name)
+	}
+	for _, idx := range sc.Indexes {
+		names = append(names, idx.Name)
+	}
+	for _, view := range sc.Views {
+		names = append(names, view.Name)
+	}
+
+	m := make(map[string]struct{}, len(names))
+	for _, name := range names {
+		if name == "" || strings.Contains(name, BucketPrefixSeparator) {
+			return keyError("bucket", name, ErrBucketNameInvalid)
+		} else if _, ok := m[name]; ok {
+			return keyError("bucket", name, ErrBucketNameConflict)
+		}
+		m[name] = struct{}{}
+	}
+	return nil
+}
+
+// Schema related errors.
+var (
+	ErrUniqueConstraint    = &Error{Code: ECONFLICT, Message: "unique constraint violated"}
+	ErrBucketPrefixInvalid = &Error{Code: EINVALID, Message: "bucket prefix must end with " + BucketPrefixSeparator}
+	ErrBucketNameInvalid   = &Error{Code: EINVALID, Message: "invalid bucket name"}
+	ErrBucketNameConflict  = &Error{Code: EINVALID, Message: "bucket name used more than once"}
+)
@@ -0,0 +1,292 @@
+package main_test
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+
+	main "github.com/benbjohnson/application-development-using-boltdb"
+	"github.com/benbjohnson/application-development-using-boltdb/keys"
+	"github.com/boltdb/bolt"
+)
+
+// uniqueDisplayNameSchema returns the default schema extended with a nested
+// bucket and a unique index on display names.
+func uniqueDisplayNameSchema() *main.Schema {
+	sc := &main.Schema{
+		Buckets: append([]main.BucketSchema{
+			{Name: "Settings", Buckets: []main.BucketSchema{{Name: "Flags"}}},
+		}, main.DefaultSchema.Buckets...),
+		Indexes: append([]*main.Index{}, main.DefaultSchema.Indexes...),
+	}
+	sc.Indexes = append(sc.Indexes, &main.Index{
+		Name:   "UniqueDisplayNames",
+		Source: "Users",
+		Unique: true,
+		Keys: func(_, v []byte) ([][]byte, error) {
+			var u main.User
+			if err := u.UnmarshalBinary(v); err != nil {
+				return nil, err
+			} else if u.DisplayName == "" {
+				return nil, nil
+			}
+			return [][]byte{keys.String(u.DisplayName)}, nil
+		},
+	})
+	return sc
+}
+
+// Ensure Open creates nested buckets declared by the schema.
+func TestStore_Schema_Buckets(t *testing.T) {
+	s := NewStore()
+	s.Schema = uniqueDisplayNameSchema()
+	if err := s.Open(); err != nil {
+		t.Fatal(err)
+	}
+	path := s.Path
+	defer s.Close()
+	if err := s.Store.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := bolt.Open(path, 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if err := db.View(func(tx *bolt.Tx) error {
+		if b := tx.Bucket([]byte("Settings")); b == nil {
+			t.Fatal("expected Settings bucket")
+		} else if b.Bucket([]byte("Flags")) == nil {
+			t.Fatal("expected Settings/Flags bucket")
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Ensure a unique index rejects records that share an indexed value.
+func TestStore_Schema_Unique(t *testing.T) {
+	s := NewStore()
+	s.Schema = uniqueDisplayNameSchema()
+	if err := s.Open(); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	if err := s.CreateUser(&main.User{Username: "susy", DisplayName: "Susy"}); err != nil {
+		t.Fatal(err)
+	} else if err := s.CreateUser(&main.User{Username: "susan", DisplayName: "Susy"}); !errors.Is(err, main.ErrUniqueConstraint) {
+		t.Fatalf("unexpected error: %v", err)
+	} else if err := s.CreateUser(&main.User{Username: "john", DisplayName: "John"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Renaming onto a taken name fails but renaming to a free name works
+	// and releases the old name.
+	susy, jane := "Susy", "Jane"
+	if err := s.PatchUser(2, main.UserPatch{DisplayName: &susy}); !errors.Is(err, main.ErrUniqueConstraint) {
+		t.Fatalf("unexpected error: %v", err)
+	} else if err := s.PatchUser(1, main.UserPatch{DisplayName: &jane}); err != nil {
+		t.Fatal(err)
+	} else if err := s.PatchUser(2, main.UserPatch{DisplayName: &susy}); err != nil {
+		t.Fatal(err)
+	}
+
+	if a, err := s.CheckIntegrity(); err != nil {
+		t.Fatal(err)
+	} else if len(a) != 0 {
+		t.Fatalf("unexpected violations: %v", a)
+	}
+}
+
+// Ensure an index added to an existing store is built on Open.
+func TestStore_Schema_NewIndex(t *testing.T) {
+	s := OpenStore()
+	defer s.Close()
+
+	if err := s.CreateUser(&main.User{Username: "susy", DisplayName: "Susy"}); err != nil {
+		t.Fatal(err)
+	} else if err := s.CreateUser(&main.User{Username: "susan", DisplayName: "Susy"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Building a unique index over duplicate values fails.
+	s.Schema = uniqueDisplayNameSchema()
+	if err := s.Reopen(); !errors.Is(err, main.ErrUniqueConstraint) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// Remove the duplicate and build the index.
+	s.Schema = nil
+	if err := s.Open(); err != nil {
+		t.Fatal(err)
+	} else if err := s.DeleteUser(2); err != nil {
+		t.Fatal(err)
+	}
+	s.Schema = uniqueDisplayNameSchema()
+	if err := s.Reopen(); err != nil {
+		t.Fatal(err)
+	} else if err := s.CreateUser(&main.User{Username: "susan", DisplayName: "Susy"}); !errors.Is(err, main.ErrUniqueConstraint) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+// Ensure ReindexAll rebuilds every index in batches and reports progress.
+func TestStore_ReindexAll(t *testing.T) {
+	s := OpenStore()
+	defer s.Close()
+
+	if err := s.BulkLoad(func() error {
+		for i := 0; i < 2500; i++ {
+			if err := s.CreateUser(&main.User{Username: fmt.Sprintf("user%d", i), Tags: []string{"beta"}}); err != nil {
+				return err
+			}
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	var a []main.ReindexProgress
+	if err := s.ReindexAll(func(p main.ReindexProgress) { a = append(a, p) }); err != nil {
+		t.Fatal(err)
+	}
+
+	// Each user index is built in three batches, in order of index name.
+	// The empty identity index is built in one.
+	if len(a) != 13 {
+		t.Fatalf("unexpected progress count: %d", len(a))
+	} else if p := a[0]; p.Index != "IdentitiesBySubject" || p.N != 0 {
+		t.Fatalf("unexpected progress: %#v", p)
+	} else if p := a[3]; p.Index != "UsersByEmail" || p.N != 2500 || p.Total != 2500 {
+		t.Fatalf("unexpected progress: %#v", p)
+	} else if p := a[6]; p.Index != "UsersByStatus" || p.N != 2500 || p.Total != 2500 {
+		t.Fatalf("unexpected progress: %#v", p)
+	} else if p := a[9]; p.Index != "UsersByTag" || p.N != 2500 || p.Total != 2500 {
+		t.Fatalf("unexpected progress: %#v", p)
+	} else if p := a[12]; p.Index != "UsersByUsername" || p.N != 2500 {
+		t.Fatalf("unexpected progress: %#v", p)
+	}
+
+	if v, err := s.CheckIntegrity(); err != nil {
+		t.Fatal(err)
+	} else if len(v) != 0 {
+		t.Fatalf("unexpected violations: %v", v)
+	} else if u, err := s.UserByName("user1234"); err != nil {
+		t.Fatal(err)
+	} else if u == nil || u.ID != 1235 {
+		t.Fatalf("unexpected user: %#v", u)
+	}
+}
+
+// Ensure stores with different bucket prefixes share a data file without
+// seeing each other's data.
+func TestStore_BucketPrefix(t *testing.T) {
+	s := NewStore()
+	s.BucketPrefix = "app1:"
+	if err := s.Open(); err != nil {
+		t.Fatal(err)
+	}
+	path := s.Path
+	defer s.Close()
+
+	if err := s.CreateUser(&main.User{Username: "susy"}); err != nil {
+		t.Fatal(err)
+	} else if err := s.CreateTenant("acme"); err != nil {
+		t.Fatal(err)
+	} else if err := s.Store.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// A store with another prefix starts empty and reuses the username.
+	other := main.NewStore(path, main.WithBucketPrefix("app2:"))
+	if err := other.Open(); err != nil {
+		t.Fatal(err)
+	} else if u, err := other.UserByName("susy"); err != nil {
+		t.Fatal(err)
+	} else if u != nil {
+		t.Fatalf("unexpected user: %#v", u)
+	} else if a, err := other.Tenants(); err != nil {
+		t.Fatal(err)
+	} else if len(a) != 0 {
+		t.Fatalf("unexpected tenants: %v", a)
+	} else if err := other.CreateUser(&main.User{Username: "susy"}); err != nil {
+		t.Fatal(err)
+	} else if usage, err := other.Usage(); err != nil {
+		t.Fatal(err)
+	} else if usage.Users != 1 {
+		t.Fatalf("unexpected users: %d", usage.Users)
+	} else if err := other.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The first store's data is unchanged.
+	if err := s.Store.Open(); err != nil {
+		t.Fatal(err)
+	} else if u, err := s.User(1); err != nil {
+		t.Fatal(err)
+	} else if u == nil || u.Username != "susy" {
+		t.Fatalf("unexpected user: %#v", u)
+	} else if a, err := s.Tenants(); err != nil {
+		t.Fatal(err)
+	} else if len(a) != 1 || a[0] != "acme" {
+		t.Fatalf("unexpected tenants: %v", a)
+	} else if err := s.Store.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Top-level buckets are stored under their prefixed names.
+	db, err := bolt.Open(path, 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if err := db.View(func(tx *bolt.Tx) error {
+		if tx.Bucket([]byte("Users")) != nil {
+			t.Fatal("unexpected Users bucket")
+		} else if tx.Bucket([]byte("app1:Users")) == nil || tx.Bucket([]byte("app2:Users")) == nil {
+			t.Fatal("expected prefixed Users buckets")
+		} else if tx.Bucket([]byte("app1:Tenants")).Bucket([]byte("acme")).Bucket([]byte("Users")) == nil {
+			t.Fatal("expected unprefixed tenant Users bucket")
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Ensure Open rejects bucket names that could collide.
+func TestStore_BucketPrefix_Err(t *testing.T) {
+	t.Run("Prefix", func(t *testing.T) {
+		s := NewStore()
+		defer os.Remove(s.Path)
+		s.BucketPrefix = "app1"
+		if err := s.Open(); !errors.Is(err, main.ErrBucketPrefixInvalid) {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+
+	t.Run("Separator", func(t *testing.T) {
+		s := NewStore()
+		defer os.Remove(s.Path)
+		s.Schema = &main.Schema{Buckets: append([]main.BucketSchema{{Name: "app2:Users"}}, main.DefaultSchema.Buckets...)}
+		if err := s.Open(); !errors.Is(err, main.ErrBucketNameInvalid) {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+
+	t.Run("Conflict", func(t *testing.T) {
+		s := NewStore()
+		defer os.Remove(s.Path)
+		s.Schema = &main.Schema{
+			Buckets: main.DefaultSchema.Buckets,
+			Indexes: []*main.Index{{Name: "Users", Source: "Users"}},
+		}
+		if err := s.Open(); !errors.Is(err, main.ErrBucketNameConflict) {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+}
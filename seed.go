@@ -0,0 +1,136 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path"
+	"time"
+
+	"github.com/benbjohnson/application-development-using-boltdb/keys"
+)
+
+// Seed calls fn within a writable transaction unless a seed with the same
+// name has already been applied. The name is recorded in the Meta bucket in
+// the same transaction so each seed is applied exactly once, even if several
+// processes start at the same time. Tenants track their own seeds.
+//
+// fn may be called more than once if the transaction is retried.
+func (s *Store) Seed(name string, fn func(tx *Tx) error) error {
+	if name == "" {
+		return ErrSeedNameRequired
+	}
+
+	var applied bool
+	if err := s.update("Seed", func(tx *Tx) error {
+		applied = false
+		bkt := tx.Bucket([]byte("Meta"))
+		key := seedKey(name)
+		if bkt.Get(key) != nil {
+			return nil
+		} else if err := fn(tx); err != nil {
+			return err
+		}
+
+		applied = true
+		tx.recordWrite("Meta", nil)
+		return bkt.Put(key, keys.Time(time.Now().UTC()))
+	}); err != nil {
+		return err
+	}
+
+	if applied {
+		s.logger().Info("seed applied", "name", name)
+	}
+	return nil
+}
+
+// SeedApplied returns true if the named seed has been applied.
+func (s *Store) SeedApplied(name string) (bool, error) {
+	var ok bool
+	err := s.view("SeedApplied", func(tx *Tx) error {
+		v := tx.Bucket([]byte("Meta")).Get(seedKey(name))
+		tx.recordRead("Meta", v)
+		ok = v != nil
+		return nil
+	})
+	return ok, err
+}
+
+// seedKey returns the key in the Meta bucket recording the named seed.
+func seedKey(name string) []byte {
+	return keys.Join(keys.String("seed"), keys.String(name))
+}
+
+// SeedFile is a declarative seed, decoded from JSON by SeedFromFile.
+type SeedFile struct {
+	// Name under which the seed is recorded. Defaults to the filename.
+	Name string `json:"name"`
+
+	// Users to create. IDs are assigned by the store.
+	Users []SeedUser `json:"users"`
+
+	// Patterns added to the reserved usernames.
+	ReservedUsernames []string `json:"reserved_usernames"`
+}
+
+// SeedUser describes a user created by a seed file.
+type SeedUser struct {
+	Username    string   `json:"username"`
+	Tags        []string `json:"tags"`
+	DisplayName string   `json:"display_name"`
+	Email       string   `json:"email"`
+}
+
+// SeedFromFile applies the JSON seed file at filename once, as with Seed.
+func (s *Store) SeedFromFile(filename string) error {
+	buf, err := os.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+
+	var f SeedFile
+	if err := json.Unmarshal(buf, &f); err != nil {
+		return keyError("seed", filename, ErrInvalidSeedFile)
+	} else if f.Name == "" {
+		f.Name = filename
+	}
+	for _, u := range f.Users {
+		if u.Username == "" {
+			return keyError("seed", f.Name, ErrUsernameRequired)
+		}
+	}
+	for _, pattern := range f.ReservedUsernames {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return keyError("pattern", pattern, ErrInvalidReservedUsername)
+		}
+	}
+
+	return s.Seed(f.Name, func(tx *Tx) error {
+		bkt := tx.Bucket([]byte("ReservedUsernames"))
+		for _, pattern := range f.ReservedUsernames {
+			tx.recordWrite("ReservedUsernames", nil)
+			if err := bkt.Put([]byte(s.normalizeUsername(pattern)), []byte{}); err != nil {
+				return err
+			}
+		}
+
+		for _, su := range f.Users {
+			u := &User{
+				Username:    su.Username,
+				Tags:        su.Tags,
+				DisplayName: su.DisplayName,
+				Email:       su.Email,
+			}
+			if err := createUser(tx, u); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Seed related errors.
+var (
+	ErrSeedNameRequired = &Error{Code: EINVALID, Message: "seed name required"}
+	ErrInvalidSeedFile  = &Error{Code: EINVALID, Message: "invalid seed file"}
+)
@@ -0,0 +1,82 @@
+package main_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	main "github.com/benbjohnson/application-development-using-boltdb"
+)
+
+// Ensure a seed is applied once and survives reopening the store.
+func TestStore_Seed(t *testing.T) {
+	s := OpenStore()
+	defer s.Close()
+
+	var n int
+	seed := func(tx *main.Tx) error {
+		n++
+		return nil
+	}
+	if err := s.Seed("demo", seed); err != nil {
+		t.Fatal(err)
+	} else if err := s.Reopen(); err != nil {
+		t.Fatal(err)
+	} else if err := s.Seed("demo", seed); err != nil {
+		t.Fatal(err)
+	} else if n != 1 {
+		t.Fatalf("unexpected calls: %d", n)
+	} else if ok, err := s.SeedApplied("demo"); err != nil {
+		t.Fatal(err)
+	} else if !ok {
+		t.Fatal("expected seed applied")
+	}
+
+	// A failed seed is not recorded.
+	if err := s.Seed("broken", func(tx *main.Tx) error { return errors.New("marker") }); err == nil || err.Error() != "Seed: marker" {
+		t.Fatalf("unexpected error: %v", err)
+	} else if ok, err := s.SeedApplied("broken"); err != nil {
+		t.Fatal(err)
+	} else if ok {
+		t.Fatal("expected seed not applied")
+	}
+}
+
+// Ensure a seed file creates its users and reserved usernames once.
+func TestStore_SeedFromFile(t *testing.T) {
+	s := OpenStore()
+	defer s.Close()
+
+	path := filepath.Join(t.TempDir(), "seed.json")
+	if err := os.WriteFile(path, []byte(`{
+		"name": "dev",
+		"users": [
+			{"username": "susy", "tags": ["admin"], "email": "susy@example.com"},
+			{"username": "john"}
+		],
+		"reserved_usernames": ["root*"]
+	}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := s.SeedFromFile(path); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if a, err := s.Users(); err != nil {
+		t.Fatal(err)
+	} else if len(a) != 2 || a[0].Username != "susy" || a[0].Email != "susy@example.com" || a[1].Username != "john" {
+		t.Fatalf("unexpected users: %#v", a)
+	} else if err := s.CreateUser(&main.User{Username: "rooty"}); !errors.Is(err, main.ErrUsernameReserved) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if err := os.WriteFile(path, []byte(`{`), 0600); err != nil {
+		t.Fatal(err)
+	} else if err := s.SeedFromFile(path); !errors.Is(err, main.ErrInvalidSeedFile) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
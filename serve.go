@@ -0,0 +1,330 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"math"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// serveShutdownTimeout is the duration the server waits for requests in
+// progress to finish once it is asked to stop.
+const serveShutdownTimeout = 30 * time.Second
+
+// ScopeAdmin is the scope an API key needs to use the admin endpoints of
+// the server.
+const ScopeAdmin = "admin"
+
+// ServeCommand runs the HTTP server for a store until it is signaled to
+// stop.
+//
+// SIGINT and SIGTERM shut the server down gracefully. SIGHUP reloads the
+// config file and SIGUSR1 writes a backup immediately. If the server is
+// started by systemd with Type=notify, readiness, reloads, and shutdown are
+// reported with sd_notify.
+type ServeCommand struct {
+	*Main
+
+	// Delivers the signals that control the server. Defaults to the
+	// signals received by the process.
+	Signals chan os.Signal
+
+	// Called with the address of the listener once the server is ready.
+	OnReady func(addr net.Addr)
+
+	filename   string
+	level      slog.LevelVar
+	adminToken atomic.Pointer[string]
+	rate       atomic.Pointer[Rate]
+}
+
+// NewServeCommand returns a new instance of ServeCommand.
+func NewServeCommand(m *Main) *ServeCommand {
+	return &ServeCommand{Main: m}
+}
+
+// Run executes the server.
+func (cmd *ServeCommand) Run(args ...string) error {
+	fs := flag.NewFlagSet("serve", flag.ContinueOnError)
+	fs.SetOutput(cmd.Stderr)
+	fs.StringVar(&cmd.filename, "config", "", "config file path")
+	fs.Usage = func() {
+		fmt.Fprintf(cmd.Stderr, "usage: appdev serve [-config file]\n\nFields may be overridden with %s* environment variables.\n", ConfigEnvPrefix)
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err == flag.ErrHelp {
+		return ErrUsage
+	} else if err != nil {
+		return err
+	}
+
+	c, err := ReadConfigFile(cmd.filename, cmd.Getenv)
+	if err != nil {
+		return err
+	}
+	logger := slog.New(slog.NewTextHandler(cmd.Stderr, &slog.HandlerOptions{Level: &cmd.level}))
+	cmd.apply(c)
+
+	s := c.NewStore(logger)
+	if err := s.Open(); err != nil {
+		return err
+	}
+	defer s.Close()
+
+	ln, err := net.Listen("tcp", c.ListenAddr())
+	if err != nil {
+		return err
+	}
+	srv := &http.Server{Handler: cmd.handler(s)}
+	errc := make(chan error, 1)
+	go func() { errc <- srv.Serve(ln) }()
+
+	sigs := cmd.Signals
+	if sigs == nil {
+		sigs = make(chan os.Signal, 1)
+		signal.Notify(sigs, append([]os.Signal{syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP}, backupSignals...)...)
+		defer signal.Stop(sigs)
+	}
+
+	logger.Info("server started", "addr", ln.Addr().String(), "path", c.Path)
+	cmd.notify(logger, "READY=1")
+	if cmd.OnReady != nil {
+		cmd.OnReady(ln.Addr())
+	}
+
+	// Backups run on a ticker that is replaced when the config is reloaded.
+	var ticker *time.Ticker
+	var tick <-chan time.Time
+	schedule := func(c *Config) {
+		if ticker != nil {
+			ticker.Stop()
+			ticker, tick = nil, nil
+		}
+		if c.BackupInterval > 0 {
+			ticker = time.NewTicker(time.Duration(c.BackupInterval))
+			tick = ticker.C
+		}
+	}
+	schedule(c)
+	defer func() { schedule(&Config{}) }()
+
+	for {
+		select {
+		case err := <-errc:
+			return err
+
+		case <-tick:
+			cmd.backup(logger, s, c)
+
+		case sig := <-sigs:
+			switch {
+			case sig == syscall.SIGHUP:
+				cmd.notify(logger, "RELOADING=1")
+				if other, err := cmd.reload(c); err != nil {
+					logger.Error("config reload failed", "err", err)
+				} else {
+					c = other
+					schedule(c)
+					logger.Info("config reloaded")
+				}
+				cmd.notify(logger, "READY=1")
+
+			case isBackupSignal(sig):
+				cmd.backup(logger, s, c)
+
+			default:
+				logger.Info("server stopping", "signal", sig.String())
+				cmd.notify(logger, "STOPPING=1")
+				ctx, cancel := context.WithTimeout(context.Background(), serveShutdownTimeout)
+				defer cancel()
+				return srv.Shutdown(ctx)
+			}
+		}
+	}
+}
+
+// reload reads the config file again and applies the settings that can
+// change while the server runs. The data file and listen address require a
+// restart so changes to them are rejected.
+func (cmd *ServeCommand) reload(prev *Config) (*Config, error) {
+	c, err := ReadConfigFile(cmd.filename, cmd.Getenv)
+	if err != nil {
+		return nil, err
+	} else if c.Path != prev.Path || c.ListenAddr() != prev.ListenAddr() || c.SecretKey != prev.SecretKey {
+		return nil, errors.New("path, listen, and secret_key require a restart")
+	}
+	cmd.apply(c)
+	return c, nil
+}
+
+// apply applies the settings of c that can change while the server runs.
+func (cmd *ServeCommand) apply(c *Config) {
+	level, _ := c.logLevel()
+	cmd.level.Set(level)
+	cmd.adminToken.Store(&c.AdminToken)
+	rate := c.Rate()
+	cmd.rate.Store(&rate)
+}
+
+// handler returns the handler of the server's endpoints.
+//
+// Admin endpoints require an API key with ScopeAdmin or the configured
+// admin token, which lets operators create the first keys. Requests to them
+// are written to the audit log.
+func (cmd *ServeCommand) handler(s *Store) http.Handler {
+	admin := audit(s.logger(), NewAdminHandler(s))
+	adminKey := RequireAPIKey(s, ScopeAdmin, admin)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "ok")
+	})
+	mux.HandleFunc("/admin/", func(w http.ResponseWriter, r *http.Request) {
+		token := *cmd.adminToken.Load()
+		given, _ := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if token != "" && subtle.ConstantTimeCompare([]byte(given), []byte(token)) == 1 {
+			admin.ServeHTTP(w, r)
+			return
+		}
+		adminKey.ServeHTTP(w, r)
+	})
+	return cmd.rateLimit(s, mux)
+}
+
+// audit wraps h so that each request it serves is logged with the principal
+// acting on it. The principal is the API key in the request's context, see
+// RequireAPIKey, or the admin token if there is none.
+func audit(logger *slog.Logger, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sw := &statusWriter{ResponseWriter: w, code: http.StatusOK}
+		h.ServeHTTP(sw, r)
+
+		principal := "admin_token"
+		if k := APIKeyFromContext(r.Context()); k != nil {
+			principal = "api_key:" + strconv.Itoa(k.ID)
+		}
+		logger.Info("audit",
+			"principal", principal,
+			"method", r.Method,
+			"path", r.URL.Path,
+			"status", sw.code,
+			"ip", remoteIP(r),
+		)
+	})
+}
+
+// statusWriter records the status code written to a response.
+type statusWriter struct {
+	http.ResponseWriter
+	code int
+}
+
+// WriteHeader records code before writing it.
+func (w *statusWriter) WriteHeader(code int) {
+	w.code = code
+	w.ResponseWriter.WriteHeader(code)
+}
+
+// rateLimit wraps h so that requests from each IP address are limited to
+// the configured rate. Requests over the limit get a 429 response with a
+// Retry-After header. Health checks are not limited.
+//
+// Clients are not identified by their credentials since checking them here
+// would let requests over the limit run authentication. Authentication is
+// left to the handlers behind the limit.
+func (cmd *ServeCommand) rateLimit(s *Store, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rate := *cmd.rate.Load()
+		if rate.Events <= 0 || r.URL.Path == "/healthz" {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		// Requests are let through if the limit cannot be checked so a
+		// failing store does not turn away every client.
+		allowed, retryAfter, err := s.Allow("http:ip:"+remoteIP(r), rate)
+		if err != nil {
+			s.logger().Error("rate limit check failed", "err", err)
+		} else if !allowed {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+			http.Error(w, "too many requests", http.StatusTooManyRequests)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// remoteIP returns the IP address of the client of r.
+func remoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// backup writes a snapshot of s to the configured backup directory. Failures
+// are logged since backups run in the background.
+func (cmd *ServeCommand) backup(logger *slog.Logger, s *Store, c *Config) {
+	if c.BackupDir == "" {
+		logger.Warn("backup skipped, backup_dir not set")
+		return
+	}
+
+	start := time.Now()
+	path := filepath.Join(c.BackupDir, filepath.Base(c.Path)+"."+start.UTC().Format("20060102T150405Z"))
+	if err := s.Snapshot(path); err != nil {
+		logger.Error("backup failed", "path", path, "err", err)
+		return
+	}
+	logger.Info("backup written", "path", path, "duration", time.Since(start))
+}
+
+// notify sends state to systemd if the server was started with
+// Type=notify. Failures are logged since the server works without it.
+func (cmd *ServeCommand) notify(logger *slog.Logger, state string) {
+	if err := sdNotify(cmd.Getenv("NOTIFY_SOCKET"), state); err != nil {
+		logger.Warn("sd_notify failed", "state", state, "err", err)
+	}
+}
+
+// sdNotify sends state to the systemd notification socket at addr. Does
+// nothing if addr is empty. A leading "@" refers to an abstract socket.
+func sdNotify(addr, state string) error {
+	if addr == "" {
+		return nil
+	} else if strings.HasPrefix(addr, "@") {
+		addr = "\x00" + addr[1:]
+	}
+
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: addr, Net: "unixgram"})
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	_, err = conn.Write([]byte(state))
+	return err
+}
+
+// isBackupSignal returns true if sig requests an on-demand backup.
+func isBackupSignal(sig os.Signal) bool {
+	for _, other := range backupSignals {
+		if sig == other {
+			return true
+		}
+	}
+	return false
+}
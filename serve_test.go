@@ -0,0 +1,231 @@
+package main_test
+
+import (
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+
+	main "github.com/benbjohnson/application-development-using-boltdb"
+)
+
+// Ensure the server serves the admin endpoints, handles signals, and
+// reports its state to systemd.
+func TestServeCommand_Run(t *testing.T) {
+	dir := t.TempDir()
+	config := filepath.Join(dir, "config.json")
+	writeConfig := func(token string) {
+		t.Helper()
+		if err := os.WriteFile(config, []byte(`{
+			"path": "`+filepath.Join(dir, "db")+`",
+			"listen": "127.0.0.1:0",
+			"backup_dir": "`+dir+`",
+			"admin_token": "`+token+`"
+		}`), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeConfig("secret")
+
+	// Listen for notifications as systemd would.
+	notifications, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: filepath.Join(dir, "notify"), Net: "unixgram"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer notifications.Close()
+	expectNotification := func(exp string) {
+		t.Helper()
+		buf := make([]byte, 64)
+		if n, err := notifications.Read(buf); err != nil {
+			t.Fatal(err)
+		} else if string(buf[:n]) != exp {
+			t.Fatalf("unexpected notification: %q", buf[:n])
+		}
+	}
+
+	m := NewMain()
+	m.Getenv = func(k string) string {
+		if k == "NOTIFY_SOCKET" {
+			return filepath.Join(dir, "notify")
+		}
+		return ""
+	}
+	cmd := main.NewServeCommand(m.Main)
+	cmd.Signals = make(chan os.Signal)
+	ready := make(chan net.Addr, 1)
+	cmd.OnReady = func(addr net.Addr) { ready <- addr }
+
+	errc := make(chan error)
+	go func() { errc <- cmd.Run("-config", config) }()
+	expectNotification("READY=1")
+	addr := (<-ready).String()
+
+	status := func(token string) int {
+		t.Helper()
+		req, _ := http.NewRequest("GET", "http://"+addr+"/admin/maintenance", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	if code := status("secret"); code != http.StatusOK {
+		t.Fatalf("unexpected status: %d", code)
+	} else if code := status("wrong"); code != http.StatusUnauthorized {
+		t.Fatalf("unexpected status: %d", code)
+	}
+
+	// SIGUSR1 writes a backup.
+	cmd.Signals <- syscall.SIGUSR1
+	waitFor(t, func() bool {
+		a, _ := filepath.Glob(filepath.Join(dir, "db.*"))
+		return len(a) == 1
+	})
+
+	// SIGHUP reloads the admin token.
+	writeConfig("other")
+	cmd.Signals <- syscall.SIGHUP
+	expectNotification("RELOADING=1")
+	expectNotification("READY=1")
+	if code := status("other"); code != http.StatusOK {
+		t.Fatalf("unexpected status: %d", code)
+	}
+
+	// SIGTERM stops the server.
+	cmd.Signals <- syscall.SIGTERM
+	expectNotification("STOPPING=1")
+	if err := <-errc; err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Ensure requests from a client over the rate limit are rejected.
+func TestServeCommand_Run_RateLimit(t *testing.T) {
+	dir := t.TempDir()
+	config := filepath.Join(dir, "config.json")
+	if err := os.WriteFile(config, []byte(`{
+		"path": "`+filepath.Join(dir, "db")+`",
+		"listen": "127.0.0.1:0",
+		"rate_limit": 1
+	}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	m := NewMain()
+	cmd := main.NewServeCommand(m.Main)
+	cmd.Signals = make(chan os.Signal)
+	ready := make(chan net.Addr, 1)
+	cmd.OnReady = func(addr net.Addr) { ready <- addr }
+
+	errc := make(chan error)
+	go func() { errc <- cmd.Run("-config", config) }()
+	addr := (<-ready).String()
+
+	get := func(path string, token string) *http.Response {
+		t.Helper()
+		req, err := http.NewRequest("GET", "http://"+addr+path, nil)
+		if err != nil {
+			t.Fatal(err)
+		} else if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp
+	}
+
+	// The first request uses the client's only token. Credentials do not
+	// change how a client is limited.
+	if resp := get("/admin/maintenance", ""); resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("unexpected status: %d", resp.StatusCode)
+	} else if resp := get("/admin/maintenance", "1.00"); resp.StatusCode != http.StatusTooManyRequests {
+		t.Fatalf("unexpected status: %d", resp.StatusCode)
+	} else if v := resp.Header.Get("Retry-After"); v != "60" && v != "59" {
+		t.Fatalf("unexpected Retry-After: %q", v)
+	}
+
+	// Health checks are not limited.
+	if resp := get("/healthz", ""); resp.StatusCode != http.StatusOK {
+		t.Fatalf("unexpected status: %d", resp.StatusCode)
+	}
+
+	cmd.Signals <- syscall.SIGTERM
+	if err := <-errc; err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Ensure the admin endpoints accept API keys with the admin scope and audit
+// their use.
+func TestServeCommand_Run_APIKey(t *testing.T) {
+	// Create the keys before the server opens the data file.
+	s := OpenStore()
+	defer s.Close()
+	token, err := s.CreateAPIKey(&main.APIKey{Name: "ops", Scopes: []string{main.ScopeAdmin}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := s.CreateAPIKey(&main.APIKey{Name: "reader"})
+	if err != nil {
+		t.Fatal(err)
+	} else if err := s.Store.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	config := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(config, []byte(`{
+		"path": "`+s.Path+`",
+		"listen": "127.0.0.1:0"
+	}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	m := NewMain()
+	cmd := main.NewServeCommand(m.Main)
+	cmd.Signals = make(chan os.Signal)
+	ready := make(chan net.Addr, 1)
+	cmd.OnReady = func(addr net.Addr) { ready <- addr }
+
+	errc := make(chan error)
+	go func() { errc <- cmd.Run("-config", config) }()
+	addr := (<-ready).String()
+
+	status := func(token string) int {
+		t.Helper()
+		req, _ := http.NewRequest("POST", "http://"+addr+"/admin/maintenance", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	if code := status(token); code != http.StatusOK {
+		t.Fatalf("unexpected status: %d", code)
+	} else if code := status(other); code != http.StatusForbidden {
+		t.Fatalf("unexpected status: %d", code)
+	} else if code := status(""); code != http.StatusUnauthorized {
+		t.Fatalf("unexpected status: %d", code)
+	}
+
+	cmd.Signals <- syscall.SIGTERM
+	if err := <-errc; err != nil {
+		t.Fatal(err)
+	}
+
+	// Only the authorized request reached the admin endpoints.
+	if n := strings.Count(m.Stderr.String(), "msg=audit"); n != 1 {
+		t.Fatalf("unexpected audit records: %d\n%s", n, m.Stderr.String())
+	} else if !strings.Contains(m.Stderr.String(), "msg=audit principal=api_key:1 method=POST path=/admin/maintenance status=200") {
+		t.Fatalf("unexpected log: %s", m.Stderr.String())
+	}
+}
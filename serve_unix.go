@@ -0,0 +1,11 @@
+//go:build !windows
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// backupSignals request an on-demand backup from the server.
+var backupSignals = []os.Signal{syscall.SIGUSR1}
@@ -0,0 +1,7 @@
+package main
+
+import "os"
+
+// backupSignals request an on-demand backup from the server. Windows has no
+// user-defined signals so backups only run on schedule.
+var backupSignals []os.Signal
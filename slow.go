@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultSlowOpsLimit is the default number of slow transactions kept.
+const DefaultSlowOpsLimit = 10
+
+// maxSlowOpFrames is the maximum depth of the stack recorded for a
+// transaction.
+const maxSlowOpFrames = 32
+
+// SlowOp describes a transaction that took longer than SlowTxThreshold.
+type SlowOp struct {
+	Op       string
+	Writable bool
+	Duration time.Duration
+	Start    time.Time
+
+	// Location of the code that started the operation, outside of the
+	// store, and the stack at the time the transaction began.
+	CallSite string
+	Stack    string
+}
+
+// SlowOps returns the slowest transactions since the store was opened that
+// took at least SlowTxThreshold, slowest first. At most SlowOpsLimit are
+// kept. Transactions are shared by a store and its tenants.
+//
+// Long read transactions prevent bolt from reusing the pages freed by
+// writes, so these are worth investigating even if their callers are
+// not latency sensitive.
+func (s *Store) SlowOps() []SlowOp {
+	if s.slow == nil {
+		return nil
+	}
+	s.slow.mu.Lock()
+	defer s.slow.mu.Unlock()
+	return append([]SlowOp{}, s.slow.a...)
+}
+
+// slowOpsLimit returns the configured limit or the default, if unset.
+func (s *Store) slowOpsLimit() int {
+	if s.SlowOpsLimit <= 0 {
+		return DefaultSlowOpsLimit
+	}
+	return s.SlowOpsLimit
+}
+
+// slowOps holds the slowest transactions of a store, slowest first.
+type slowOps struct {
+	mu sync.Mutex
+	a  []SlowOp
+}
+
+// add records op if it is among the n slowest.
+func (ops *slowOps) add(op SlowOp, n int) {
+	ops.mu.Lock()
+	defer ops.mu.Unlock()
+
+	i := sort.Search(len(ops.a), func(i int) bool { return ops.a[i].Duration < op.Duration })
+	if i >= n {
+		return
+	}
+	ops.a = append(ops.a, SlowOp{})
+	copy(ops.a[i+1:], ops.a[i:])
+	ops.a[i] = op
+	if len(ops.a) > n {
+		ops.a = ops.a[:n]
+	}
+}
+
+// callers returns the program counters of the calling goroutine's stack,
+// skipping the caller of callers and its caller.
+func callers() []uintptr {
+	pcs := make([]uintptr, maxSlowOpFrames)
+	return pcs[:runtime.Callers(3, pcs)]
+}
+
+// pkgPrefix is the prefix of the names of functions within this package.
+var pkgPrefix = strings.TrimSuffix(runtime.FuncForPC(reflect.ValueOf(wrapError).Pointer()).Name(), "wrapError")
+
+// formatCallers returns the call site and stack trace of pcs. The call site
+// is the first frame outside of this package or, if the store is called
+// from within the package, the outermost frame outside of the runtime.
+func formatCallers(pcs []uintptr) (callSite, stack string) {
+	var b strings.Builder
+	var outermost string
+	frames := runtime.CallersFrames(pcs)
+	for more := len(pcs) > 0; more; {
+		var f runtime.Frame
+		f, more = frames.Next()
+		fmt.Fprintf(&b, "%s\n\t%s:%d\n", f.Function, f.File, f.Line)
+
+		site := fmt.Sprintf("%s:%d", f.File, f.Line)
+		if callSite == "" && !strings.HasPrefix(f.Function, pkgPrefix) {
+			callSite = site
+		} else if !strings.HasPrefix(f.Function, "runtime.") {
+			outermost = site
+		}
+	}
+	if callSite == "" {
+		callSite = outermost
+	}
+	return callSite, b.String()
+}
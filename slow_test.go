@@ -0,0 +1,56 @@
+package main_test
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	main "github.com/benbjohnson/application-development-using-boltdb"
+)
+
+// Ensure the slowest transactions are kept along with their callers.
+func TestStore_SlowOps(t *testing.T) {
+	var buf bytes.Buffer
+	s := NewStore()
+	s.Logger = slog.New(slog.NewTextHandler(&buf, nil))
+	s.SlowOpsLimit = 2
+	if err := s.Open(); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	// Nothing is tracked while the threshold is disabled.
+	if err := s.CreateUser(&main.User{Username: "susy"}); err != nil {
+		t.Fatal(err)
+	} else if a := s.SlowOps(); len(a) != 0 {
+		t.Fatalf("unexpected slow ops: %#v", a)
+	}
+
+	// Every transaction is slow with a tiny threshold.
+	s.SlowTxThreshold = time.Nanosecond
+	for i := 0; i < 3; i++ {
+		if _, err := s.User(1); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	a := s.SlowOps()
+	if len(a) != 2 {
+		t.Fatalf("unexpected slow ops: %d", len(a))
+	} else if a[0].Duration < a[1].Duration {
+		t.Fatalf("unexpected order: %s, %s", a[0].Duration, a[1].Duration)
+	} else if a[0].Op != "User" || a[0].Writable {
+		t.Fatalf("unexpected slow op: %#v", a[0])
+	} else if !strings.Contains(a[0].CallSite, "slow_test.go:") {
+		t.Fatalf("unexpected call site: %s", a[0].CallSite)
+	} else if !strings.Contains(a[0].Stack, "TestStore_SlowOps") {
+		t.Fatalf("unexpected stack: %s", a[0].Stack)
+	}
+
+	// The call site is logged with the transaction.
+	if out := buf.String(); !strings.Contains(out, "caller="+a[0].CallSite) {
+		t.Fatalf("unexpected log output: %s", out)
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// BucketStats counts the operations performed on a bucket since the store
+// was opened. Reads of each record during a scan are counted as gets.
+type BucketStats struct {
+	Gets         int64
+	Puts         int64
+	Deletes      int64
+	BytesRead    int64
+	BytesWritten int64
+}
+
+// BucketStats returns operation counts for each bucket accessed since the
+// store was opened, keyed by bucket name. Counts are shared by a store and
+// its tenants and include writes that were later rolled back.
+func (s *Store) BucketStats() map[string]BucketStats {
+	m := make(map[string]BucketStats)
+	if s.ops == nil {
+		return m
+	}
+	s.ops.Range(func(k, v any) bool {
+		c := v.(*bucketCounters)
+		m[k.(string)] = BucketStats{
+			Gets:         c.gets.Load(),
+			Puts:         c.puts.Load(),
+			Deletes:      c.deletes.Load(),
+			BytesRead:    c.bytesRead.Load(),
+			BytesWritten: c.bytesWritten.Load(),
+		}
+		return true
+	})
+	return m
+}
+
+// bucketCounters holds the operation counters of a single bucket.
+type bucketCounters struct {
+	gets         atomic.Int64
+	puts         atomic.Int64
+	deletes      atomic.Int64
+	bytesRead    atomic.Int64
+	bytesWritten atomic.Int64
+}
+
+// bucketOps maps bucket names to their counters.
+type bucketOps struct {
+	sync.Map
+}
+
+// counters returns the counters for bucket, creating them if needed.
+func (ops *bucketOps) counters(bucket string) *bucketCounters {
+	if v, ok := ops.Load(bucket); ok {
+		return v.(*bucketCounters)
+	}
+	v, _ := ops.LoadOrStore(bucket, &bucketCounters{})
+	return v.(*bucketCounters)
+}
@@ -0,0 +1,47 @@
+package main_test
+
+import (
+	"testing"
+
+	main "github.com/benbjohnson/application-development-using-boltdb"
+)
+
+// Ensure operations are counted per bucket.
+func TestStore_BucketStats(t *testing.T) {
+	s := OpenStore()
+	defer s.Close()
+
+	if err := s.CreateUser(&main.User{Username: "susy"}); err != nil {
+		t.Fatal(err)
+	} else if _, err := s.User(1); err != nil {
+		t.Fatal(err)
+	} else if err := s.DeleteUser(1); err != nil {
+		t.Fatal(err)
+	}
+
+	stats := s.BucketStats()
+	if st := stats["Users"]; st.Puts != 1 || st.Gets < 1 || st.Deletes != 1 {
+		t.Fatalf("unexpected Users stats: %+v", st)
+	} else if st.BytesWritten == 0 || st.BytesRead == 0 {
+		t.Fatalf("unexpected Users byte counts: %+v", st)
+	}
+	if st := stats["UsersByUsername"]; st.Puts != 1 || st.Deletes != 1 {
+		t.Fatalf("unexpected UsersByUsername stats: %+v", st)
+	}
+}
+
+// Ensure tenant operations are counted with the parent store.
+func TestStore_BucketStats_Tenant(t *testing.T) {
+	s := OpenStore()
+	defer s.Close()
+
+	if err := s.CreateTenant("acme"); err != nil {
+		t.Fatal(err)
+	} else if err := s.Tenant("acme").CreateUser(&main.User{Username: "susy"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if st := s.BucketStats()["Users"]; st.Puts != 1 {
+		t.Fatalf("unexpected Users stats: %+v", st)
+	}
+}
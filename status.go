@@ -0,0 +1,162 @@
+package main
+
+import (
+	"slices"
+	"time"
+
+	"github.com/benbjohnson/application-development-using-boltdb/keys"
+)
+
+// UserStatus is the state of a user's account.
+type UserStatus int
+
+// User statuses. Users are active unless set otherwise with SetUserStatus.
+const (
+	UserActive    UserStatus = 0
+	UserSuspended UserStatus = 1 // temporarily unable to sign in
+	UserBanned    UserStatus = 2 // removed until reinstated
+)
+
+// userStatusTransitions lists the statuses each status can change to.
+// Banned users can only be reinstated, not suspended.
+var userStatusTransitions = map[UserStatus][]UserStatus{
+	UserActive:    {UserSuspended, UserBanned},
+	UserSuspended: {UserActive, UserBanned},
+	UserBanned:    {UserActive},
+}
+
+// String returns the name of the status.
+func (s UserStatus) String() string {
+	switch s {
+	case UserActive:
+		return "active"
+	case UserSuspended:
+		return "suspended"
+	case UserBanned:
+		return "banned"
+	default:
+		return "unknown"
+	}
+}
+
+// MarshalText encodes the status as its name.
+func (s UserStatus) MarshalText() ([]byte, error) {
+	if _, ok := userStatusTransitions[s]; !ok {
+		return nil, ErrUserStatusInvalid
+	}
+	return []byte(s.String()), nil
+}
+
+// UnmarshalText decodes a status from its name.
+func (s *UserStatus) UnmarshalText(text []byte) error {
+	for status := range userStatusTransitions {
+		if status.String() == string(text) {
+			*s = status
+			return nil
+		}
+	}
+	return ErrUserStatusInvalid
+}
+
+// CanTransitionTo returns true if a user with status s can be changed to to.
+func (s UserStatus) CanTransitionTo(to UserStatus) bool {
+	return slices.Contains(userStatusTransitions[s], to)
+}
+
+// CheckStatus returns ErrUserSuspended or ErrUserBanned if the user cannot
+// sign in. Applications should also call it when validating their own
+// sessions so a status change takes effect before the session expires.
+func (u *User) CheckStatus() error {
+	switch u.Status {
+	case UserSuspended:
+		return keyError("user", u.ID, ErrUserSuspended)
+	case UserBanned:
+		return keyError("user", u.ID, ErrUserBanned)
+	default:
+		return nil
+	}
+}
+
+// SetUserStatus changes the status of a user and records the reason.
+// Setting the status a user already has is not an error and leaves the user
+// unchanged. Returns ErrUserStatusTransition if the user's current status
+// cannot change to status.
+func (s *Store) SetUserStatus(id int, status UserStatus, reason string) error {
+	if _, ok := userStatusTransitions[status]; !ok {
+		return ErrUserStatusInvalid
+	}
+
+	return s.update("SetUserStatus", func(tx *Tx) error {
+		var u User
+		if err := loadUser(tx, id, &u); err != nil {
+			return err
+		} else if u.Status == status {
+			return nil
+		} else if !u.Status.CanTransitionTo(status) {
+			return keyError("user", id, ErrUserStatusTransition)
+		}
+
+		prev := u
+		u.Status, u.StatusReason, u.StatusChangedAt = status, reason, time.Now().UTC()
+		changes := diffUser(&prev, &u)
+
+		if err := saveUser(tx, &u); err != nil {
+			return err
+		} else if err := recordUserRevision(tx, id, &u, changes); err != nil {
+			return err
+		}
+		return recordUserEvent(tx, EventUserUpdated, &u, changes)
+	})
+}
+
+// UsersByStatus retrieves the users with the given status ordered by ID.
+// Only users that are not active are indexed so listing active users reads
+// every user.
+func (s *Store) UsersByStatus(status UserStatus) ([]*User, error) {
+	a := []*User{}
+	if err := s.view("UsersByStatus", func(tx *Tx) error {
+		if status == UserActive {
+			return tx.Bucket([]byte("Users")).ForEach(func(_, v []byte) error {
+				tx.recordRead("Users", v)
+
+				u := &User{}
+				if err := decodeUser(tx, v, u); err != nil {
+					return err
+				} else if u.Status == UserActive {
+					a = append(a, u)
+				}
+				return nil
+			})
+		}
+
+		c := tx.Bucket([]byte("UsersByStatus")).Cursor()
+		return keys.Scan(c, keys.String(status.String()), func(k, _ []byte) error {
+			tx.recordRead("UsersByStatus", nil)
+
+			r := keys.NewReader(k)
+			r.ReadString()
+			id := r.ReadInt()
+			if err := r.Err(); err != nil {
+				return err
+			}
+
+			u := &User{}
+			if err := loadUser(tx, id, u); err != nil {
+				return err
+			}
+			a = append(a, u)
+			return nil
+		})
+	}); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// User status related errors.
+var (
+	ErrUserStatusInvalid    = &Error{Code: EINVALID, Message: "invalid user status"}
+	ErrUserStatusTransition = &Error{Code: ECONFLICT, Message: "user status cannot change to the requested status"}
+	ErrUserSuspended        = &Error{Code: EUNAUTHORIZED, Message: "user is suspended"}
+	ErrUserBanned           = &Error{Code: EUNAUTHORIZED, Message: "user is banned"}
+)
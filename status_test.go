@@ -0,0 +1,119 @@
+package main_test
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	main "github.com/benbjohnson/application-development-using-boltdb"
+)
+
+// Ensure status changes follow the transition rules and are recorded.
+func TestStore_SetUserStatus(t *testing.T) {
+	s := OpenStore()
+	defer s.Close()
+
+	if err := s.CreateUser(&main.User{Username: "susy"}); err != nil {
+		t.Fatal(err)
+	} else if err := s.SetUserStatus(1, main.UserSuspended, "spam"); err != nil {
+		t.Fatal(err)
+	}
+
+	if u, err := s.User(1); err != nil {
+		t.Fatal(err)
+	} else if u.Status != main.UserSuspended || u.StatusReason != "spam" || u.StatusChangedAt.IsZero() {
+		t.Fatalf("unexpected user: %#v", u)
+	} else if err := u.CheckStatus(); !errors.Is(err, main.ErrUserSuspended) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// Banned users can only be reinstated.
+	if err := s.SetUserStatus(1, main.UserBanned, "repeat spam"); err != nil {
+		t.Fatal(err)
+	} else if err := s.SetUserStatus(1, main.UserSuspended, ""); !errors.Is(err, main.ErrUserStatusTransition) {
+		t.Fatalf("unexpected error: %v", err)
+	} else if err := s.SetUserStatus(1, main.UserActive, "appeal"); err != nil {
+		t.Fatal(err)
+	} else if u, err := s.User(1); err != nil {
+		t.Fatal(err)
+	} else if u.Status != main.UserActive || u.StatusReason != "appeal" || u.CheckStatus() != nil {
+		t.Fatalf("unexpected user: %#v", u)
+	}
+
+	if err := s.SetUserStatus(1, main.UserStatus(9), ""); !errors.Is(err, main.ErrUserStatusInvalid) {
+		t.Fatalf("unexpected error: %v", err)
+	} else if err := s.SetUserStatus(2, main.UserBanned, ""); !errors.Is(err, main.ErrUserNotFound) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+// Ensure users that are not active cannot authenticate.
+func TestStore_AuthenticateUser_Status(t *testing.T) {
+	s := OpenStore()
+	defer s.Close()
+
+	if err := s.CreateUser(&main.User{Username: "susy"}); err != nil {
+		t.Fatal(err)
+	} else if err := s.SetPassword(1, "hunter22"); err != nil {
+		t.Fatal(err)
+	} else if err := s.SetUserStatus(1, main.UserBanned, "abuse"); err != nil {
+		t.Fatal(err)
+	}
+
+	// The status is only reported once the password matches.
+	if _, err := s.AuthenticateUser("susy", "wrongpass"); !errors.Is(err, main.ErrPasswordInvalid) {
+		t.Fatalf("unexpected error: %v", err)
+	} else if _, err := s.AuthenticateUser("susy", "hunter22"); !errors.Is(err, main.ErrUserBanned) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+// Ensure users can be listed by status.
+func TestStore_UsersByStatus(t *testing.T) {
+	s := OpenStore()
+	defer s.Close()
+
+	for _, name := range []string{"susy", "jim", "bob"} {
+		if err := s.CreateUser(&main.User{Username: name}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.SetUserStatus(3, main.UserSuspended, ""); err != nil {
+		t.Fatal(err)
+	} else if err := s.SetUserStatus(1, main.UserSuspended, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	if a, err := s.UsersByStatus(main.UserSuspended); err != nil {
+		t.Fatal(err)
+	} else if len(a) != 2 || a[0].ID != 1 || a[1].ID != 3 {
+		t.Fatalf("unexpected users: %#v", a)
+	} else if a, err := s.UsersByStatus(main.UserActive); err != nil {
+		t.Fatal(err)
+	} else if len(a) != 1 || a[0].Username != "jim" {
+		t.Fatalf("unexpected users: %#v", a)
+	} else if a, err := s.UsersByStatus(main.UserBanned); err != nil {
+		t.Fatal(err)
+	} else if len(a) != 0 {
+		t.Fatalf("unexpected users: %#v", a)
+	}
+}
+
+// Ensure statuses are encoded as their names in JSON.
+func TestUserStatus_MarshalText(t *testing.T) {
+	buf, err := json.Marshal(main.UserBanned)
+	if err != nil {
+		t.Fatal(err)
+	} else if string(buf) != `"banned"` {
+		t.Fatalf("unexpected json: %s", buf)
+	}
+
+	var status main.UserStatus
+	if err := json.Unmarshal(buf, &status); err != nil {
+		t.Fatal(err)
+	} else if status != main.UserBanned {
+		t.Fatalf("unexpected status: %v", status)
+	} else if err := json.Unmarshal([]byte(`"gone"`), &status); !errors.Is(err, main.ErrUserStatusInvalid) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
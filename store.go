@@ -1,106 +1,747 @@
 package main
 
 import (
-	"encoding/binary"
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/benbjohnson/application-development-using-boltdb/internal"
+	"github.com/benbjohnson/application-development-using-boltdb/keys"
 	"github.com/boltdb/bolt"
 	"github.com/gogo/protobuf/proto"
+	"go.opentelemetry.io/otel/trace"
 )
 
 //go:generate protoc --gogo_out=. internal/internal.proto
 
 // User represents a user in our system.
 type User struct {
-	ID       int
-	Username string
+	ID        int
+	Username  string
+	Tags      []string
+	CreatedAt time.Time
+
+	// Profile fields. See PatchUser.
+	DisplayName string
+	Bio         string
+	AvatarURL   string
+	Locale      string
+
+	// Email address of the user, if known. See AcceptInvite.
+	Email string
+
+	// Account status, the reason given for it, and when it last changed.
+	// See SetUserStatus.
+	Status          UserStatus
+	StatusReason    string
+	StatusChangedAt time.Time
 }
 
 // MarshalBinary encodes a user to binary format.
 func (u *User) MarshalBinary() ([]byte, error) {
-	return proto.Marshal(&internal.User{
-		ID:       proto.Int64(int64(u.ID)),
-		Username: proto.String(u.Username),
-	})
+	pb := &internal.User{
+		ID:          proto.Int64(int64(u.ID)),
+		Username:    proto.String(u.Username),
+		Tags:        u.Tags,
+		CreatedAt:   proto.Int64(encodeTime(u.CreatedAt)),
+		DisplayName: proto.String(u.DisplayName),
+		Bio:         proto.String(u.Bio),
+		AvatarURL:   proto.String(u.AvatarURL),
+		Locale:      proto.String(u.Locale),
+		Email:       proto.String(u.Email),
+	}
+
+	// Status fields are omitted for active users that were never
+	// suspended so their encoding is unchanged.
+	if u.Status != UserActive || !u.StatusChangedAt.IsZero() {
+		pb.Status = proto.Int64(int64(u.Status))
+		pb.StatusReason = proto.String(u.StatusReason)
+		pb.StatusChangedAt = proto.Int64(encodeTime(u.StatusChangedAt))
+	}
+	return proto.Marshal(pb)
 }
 
+// userPBPool holds decoded user messages for reuse by UnmarshalBinary.
+var userPBPool = sync.Pool{New: func() any { return &internal.User{} }}
+
 // UnmarshalBinary decodes a user from binary data.
 func (u *User) UnmarshalBinary(data []byte) error {
-	var pb internal.User
-	if err := proto.Unmarshal(data, &pb); err != nil {
+	pb := userPBPool.Get().(*internal.User)
+	defer userPBPool.Put(pb)
+
+	// Keep the capacity of the tags from the previous use of the message.
+	tags := pb.Tags[:0]
+	pb.Reset()
+	pb.Tags = tags
+	if err := proto.Unmarshal(data, pb); err != nil {
 		return err
 	}
 
 	u.ID = int(pb.GetID())
 	u.Username = pb.GetUsername()
+	if len(pb.Tags) == 0 {
+		u.Tags = nil
+	} else {
+		u.Tags = append([]string(nil), pb.Tags...)
+	}
+	u.CreatedAt = decodeTime(pb.GetCreatedAt())
+	u.DisplayName = pb.GetDisplayName()
+	u.Bio = pb.GetBio()
+	u.AvatarURL = pb.GetAvatarURL()
+	u.Locale = pb.GetLocale()
+	u.Email = pb.GetEmail()
+	u.Status = UserStatus(pb.GetStatus())
+	u.StatusReason = pb.GetStatusReason()
+	u.StatusChangedAt = decodeTime(pb.GetStatusChangedAt())
 
 	return nil
 }
 
+// DefaultLockTimeout is the default duration that Open waits for a file lock.
+const DefaultLockTimeout = 5 * time.Second
+
+// Backoff range used between attempts to acquire the file lock.
+const (
+	minOpenBackoff = 50 * time.Millisecond
+	maxOpenBackoff = 1 * time.Second
+)
+
 // Store represents the data storage layer.
+//
+// A Store is safe for concurrent use by multiple goroutines once Open
+// returns. Its fields must not be changed after that. Methods called before
+// Open or after Close return ErrStoreClosed. Close waits for transactions
+// in progress to finish.
 type Store struct {
 	// Filepath to the data file.
 	Path string
 
-	db *bolt.DB
+	// Opens the data file read-only. Write operations fail and the file
+	// may be shared with other read-only processes.
+	ReadOnly bool
+
+	// Duration that Open waits for another process to release its lock on
+	// the data file. Defaults to DefaultLockTimeout. Use OpenContext to wait
+	// indefinitely.
+	LockTimeout time.Duration
+
+	// Initial size of the memory map of the data file. Remapping blocks
+	// every transaction so set this above the expected file size to avoid
+	// remaps as the file grows.
+	InitialMmapSize int
+
+	// Once the data file is larger than AllocSize, it is grown in steps of
+	// this size. Each step truncates and syncs the file so larger steps
+	// stall large imports less often. Defaults to bolt.DefaultAllocSize.
+	AllocSize int
+
+	// If set, the data file is preallocated to at least this many bytes on
+	// open. See Preallocate.
+	PreallocateSize int64
+
+	// Logger receives structured logs for store events. Logging is
+	// disabled if nil.
+	Logger *slog.Logger
+
+	// Transactions that take longer than this threshold are logged as slow
+	// along with the stack of their caller and the slowest SlowOpsLimit are
+	// kept for SlowOps. SlowOpsLimit defaults to DefaultSlowOpsLimit. Slow
+	// transaction tracking is disabled if zero since capturing the stack of
+	// every transaction has a small cost.
+	SlowTxThreshold time.Duration
+	SlowOpsLimit    int
+
+	// Records the stack of every transaction as it begins. Close then
+	// waits up to TxLeakTimeout for transactions in progress and returns a
+	// *TxLeakError listing the ones never committed or rolled back instead
+	// of blocking forever. TxLeakTimeout defaults to DefaultTxLeakTimeout.
+	// Also enabled by building with the txleakcheck tag.
+	DetectTxLeaks bool
+	TxLeakTimeout time.Duration
+
+	// Maximum duration that a write operation waits for the writer lock
+	// and runs before committing. Operations that exceed it are rolled back
+	// and return a *TimeoutError describing the transaction that held the
+	// lock. Disabled if zero.
+	WriteTimeout time.Duration
+
+	// TracerProvider is used to create spans for store operations.
+	// Defaults to the global OpenTelemetry provider.
+	TracerProvider trace.TracerProvider
+
+	// Metrics records the latency and errors of store operations, if set.
+	Metrics MetricsRecorder
+
+	// Duration that idempotency keys are remembered after first use.
+	// Defaults to DefaultIdempotencyTTL.
+	IdempotencyTTL time.Duration
+
+	// Duration that invites can be accepted after they are created.
+	// Defaults to DefaultInviteTTL.
+	InviteTTL time.Duration
+
+	// Duration that password reset tokens can be used after they are
+	// created. Defaults to DefaultPasswordResetTTL.
+	PasswordResetTTL time.Duration
+
+	// User values larger than OverflowThreshold bytes, after compression,
+	// are split into chunks in the Overflow bucket. Disabled if zero.
+	OverflowThreshold int
+
+	// Compresses user values of at least CompressionThreshold bytes.
+	// Existing values are read regardless of this setting. Use
+	// RecompressAll to rewrite them after changing it.
+	Compression          Compression
+	CompressionThreshold int
+
+	// Prefixes user values and revisions with a CRC-32C checksum that is
+	// verified on every read. Reads of corrupt values return
+	// ErrChecksumMismatch. Existing values are read regardless of this
+	// setting. Use RecompressAll to add checksums to them.
+	Checksums bool
+
+	// Number of revisions kept per user in the UserHistory bucket. History
+	// is not recorded if zero.
+	UserHistoryLimit int
+
+	// Time between removals of expired keys, such as idempotency keys.
+	// Defaults to DefaultReapInterval. Expired keys are only removed by
+	// calling ReapExpired if negative.
+	ReapInterval time.Duration
+
+	// Limits on how long records such as revisions and dead jobs are kept.
+	// Policies are enforced every RetentionInterval, which defaults to
+	// DefaultRetentionInterval. Policies are only enforced by calling
+	// EnforceRetention if the interval is negative.
+	Retention         []RetentionPolicy
+	RetentionInterval time.Duration
+
+	// Duration a dequeued job is hidden from other workers before it is
+	// delivered again. Defaults to DefaultJobVisibilityTimeout.
+	JobVisibilityTimeout time.Duration
+
+	// Number of deliveries before a job is moved to the dead-letter bucket.
+	// Defaults to DefaultJobMaxAttempts.
+	JobMaxAttempts int
+
+	// Records an event in the Outbox bucket for every change to a user so
+	// it can be published by a Relay.
+	Outbox bool
+
+	// Queues an email in the Emails bucket for every invite and password
+	// reset created so it can be sent by an EmailWorker. Emails are
+	// rendered from EmailTemplates, which defaults to DefaultEmailTemplates.
+	QueueEmails    bool
+	EmailTemplates map[string]*EmailTemplate
+
+	// Generates IDs for new records. Defaults to the bucket sequence.
+	IDGenerator IDGenerator
+
+	// If set, a consistent copy of the database is written to SnapshotPath
+	// every SnapshotInterval so it can be served by a Replica.
+	SnapshotPath     string
+	SnapshotInterval time.Duration
+
+	// Number of timestamped snapshots kept next to SnapshotPath for
+	// historical queries with AsOf. Snapshots are not retained if zero.
+	SnapshotRetain int
+
+	// If set, the fragmentation of the data file is checked every
+	// FragmentationInterval. Once a file of at least MinCompactSize bytes
+	// has a larger fraction of unused space than MaxFragmentation,
+	// OnFragmentation is called and the file is compacted if AutoCompact is
+	// set. The threshold and size default to DefaultMaxFragmentation and
+	// DefaultMinCompactSize.
+	FragmentationInterval time.Duration
+	MaxFragmentation      float64
+	MinCompactSize        int64
+	OnFragmentation       func(*Fragmentation)
+	AutoCompact           bool
+
+	// Keeps a copy of every user in memory, loaded on open and updated as
+	// writes commit. User, Users, and UserByName are then served from
+	// memory without a transaction or decoding. Intended for small user
+	// sets. Tenants are not cached.
+	CacheUsers bool
+
+	// Verifies the data file with Verify before the store is used.
+	// This reads every page so it can be slow for large files.
+	VerifyOnOpen bool
+
+	// Buckets and indexes of the store. Defaults to DefaultSchema.
+	// A custom schema must include the buckets and indexes of the default.
+	Schema *Schema
+
+	// Limits enforced at write time. Exceeding a limit returns a
+	// *QuotaError. MaxUsers applies separately to the top level and to
+	// each tenant and may be changed on a TenantStore to give a tenant its
+	// own limit. Limits are disabled if zero.
+	MaxUsers     int
+	MaxValueSize int
+	MaxFileSize  int64
+
+	// Normalization applied to usernames when users are written and when
+	// they are looked up by UserByName. Defaults to NormalizeFold. Use
+	// NormalizeUsernames to migrate existing users after changing it.
+	UsernameNormalization UsernameNormalization
+
+	// Number of times a write transaction that fails with a transient
+	// error, such as a failure to grow the memory map, is retried with
+	// jittered backoff. Defaults to DefaultMaxTxRetries. Retries are
+	// disabled if negative.
+	MaxTxRetries int
+
+	// Number of panics recovered from transaction callbacks before Healthy
+	// reports the store as unhealthy. Defaults to DefaultMaxPanics.
+	MaxPanics int
+
+	// Number of failed logins of a user or IP address within LoginWindow
+	// before further attempts return ErrAccountLocked. These default to
+	// DefaultMaxLoginFailures and DefaultLoginWindow. Lockout is disabled if
+	// MaxLoginFailures is negative.
+	MaxLoginFailures int
+	LoginWindow      time.Duration
+
+	// Duration that IncrCounter waits for other increments so they can be
+	// applied in one transaction. Defaults to DefaultCounterBatchDelay.
+	// Each increment is applied in its own transaction if negative.
+	CounterBatchDelay time.Duration
+
+	// Key used to encrypt secrets at rest, such as TOTP and webhook
+	// secrets. Must be 16, 24, or 32 bytes to select AES-128, AES-192, or
+	// AES-256. Two-factor enrollment is unavailable and webhook secrets are
+	// stored in plain text if empty.
+	SecretKey []byte
+
+	// Prefix of every top-level bucket name, such as "app1:", so that
+	// independent applications can share one data file. The prefix must
+	// end with BucketPrefixSeparator and bucket names must not contain it.
+	// Buckets nested within tenants are not prefixed.
+	BucketPrefix string
+
+	// Options passed to bolt.Open. See WithBoltOptions.
+	boltOptions bolt.Options
+
+	db *database
+
+	// Name of the tenant that operations are scoped to, if any.
+	tenant string
+
+	// If true, writable transactions are rolled back instead of committed.
+	dryRun bool
+
+	// Operation counters for each bucket. Shared with tenant stores.
+	ops *bucketOps
+
+	// Slowest transactions. Shared with tenant stores.
+	slow *slowOps
+
+	closing chan struct{}
+	wg      *sync.WaitGroup
+}
+
+// database is the bolt database of a store. It is shared with the store's
+// tenants so that Compact can replace it and Close can close it for all of
+// them.
+type database struct {
+	*bolt.DB
+
+	// Held for reading by every transaction and for writing while the data
+	// file is replaced or closed.
+	mu     sync.RWMutex
+	closed bool
+
+	// Number of panics recovered from transaction callbacks.
+	panics atomic.Int64
+
+	// Transactions in progress, if leak detection is enabled.
+	txs openTxs
+
+	// Copy of the Users bucket if CacheUsers is set. Writable transactions
+	// hold usersMu so their writes are applied in commit order.
+	users   atomic.Pointer[userCache]
+	usersMu sync.Mutex
+
+	// Held by every writable transaction begun by the store.
+	writer writerLock
+
+	// Set while the store is frozen for maintenance.
+	frozen atomic.Bool
+
+	// Increments waiting to be applied by IncrCounter.
+	counters counterBatches
+}
+
+// close marks the database closed, waits for transactions in progress to
+// finish, and closes the data file.
+func (db *database) close() error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.closed = true
+	return db.DB.Close()
 }
 
 // Open opens and initializes the store.
+//
+// If the data file is locked by another process then Open waits up to
+// LockTimeout for the lock to be released and returns ErrDatabaseLocked if
+// it is not.
 func (s *Store) Open() error {
+	ctx, cancel := context.WithTimeout(context.Background(), s.lockTimeout())
+	defer cancel()
+	return s.OpenContext(ctx)
+}
+
+// OpenContext opens and initializes the store. If the data file is locked by
+// another process then OpenContext retries until the lock is acquired or ctx
+// is done. Returns ErrDatabaseLocked if the ctx deadline is exceeded.
+func (s *Store) OpenContext(ctx context.Context) error {
+	start := time.Now()
+
+	// Reject bucket names that could collide with another prefix.
+	if err := s.validateBucketNames(); err != nil {
+		return err
+	}
+
 	// Open bolt database.
-	db, err := bolt.Open(s.Path, 0666, nil)
+	db, err := s.openDB(ctx)
 	if err != nil {
+		s.logger().Error("open failed", "path", s.Path, "err", err)
 		return err
 	}
-	s.db = db
+	s.db = &database{DB: db}
+	s.ops = &bucketOps{}
+	s.slow = &slowOps{}
+
+	// Check for on-disk corruption before any data is written.
+	if s.VerifyOnOpen {
+		if err := s.Verify(); err != nil {
+			s.logger().Error("verify failed", "path", s.Path, "err", err)
+			s.db.close()
+			return err
+		}
+	}
 
+	// Reserve space before any data is written.
+	if !s.ReadOnly && s.PreallocateSize > 0 {
+		if err := s.Preallocate(s.PreallocateSize); err != nil {
+			s.logger().Error("preallocate failed", "path", s.Path, "err", err)
+			s.db.close()
+			return err
+		}
+	}
+
+	// Read-only stores cannot create buckets so they rely on the writer.
+	if !s.ReadOnly {
+		if err := s.initBuckets(); err != nil {
+			s.logger().Error("init buckets failed", "path", s.Path, "err", err)
+			s.db.close()
+			return err
+		}
+	}
+
+	// Load users into memory once the buckets are up to date.
+	if s.CacheUsers {
+		if err := s.loadUserCache(); err != nil {
+			s.logger().Error("load user cache failed", "path", s.Path, "err", err)
+			s.db.close()
+			return err
+		}
+	}
+
+	// Start background processes.
+	s.closing, s.wg = make(chan struct{}), &sync.WaitGroup{}
+	if s.SnapshotPath != "" && s.SnapshotInterval > 0 {
+		s.wg.Add(1)
+		go func() { defer s.wg.Done(); s.monitorSnapshots() }()
+	}
+	if !s.ReadOnly && s.ReapInterval >= 0 {
+		s.wg.Add(1)
+		go func() { defer s.wg.Done(); s.monitorExpirations() }()
+	}
+	if !s.ReadOnly && len(s.Retention) > 0 && s.RetentionInterval >= 0 {
+		s.wg.Add(1)
+		go func() { defer s.wg.Done(); s.monitorRetention() }()
+	}
+	if !s.ReadOnly && s.FragmentationInterval > 0 {
+		s.wg.Add(1)
+		go func() { defer s.wg.Done(); s.monitorFragmentation() }()
+	}
+
+	s.logger().Info("store opened", "path", s.Path, "duration", time.Since(start))
+	return nil
+}
+
+// initBuckets creates all buckets that do not exist yet, at the top level
+// and for each tenant, and then builds any new indexes.
+func (s *Store) initBuckets() error {
 	// Start a writable transaction.
-	tx, err := s.db.Begin(true)
+	tx, err := s.begin("Open", true)
 	if err != nil {
-		return nil, err
+		return err
 	}
 	defer tx.Rollback()
 
 	// Initialize buckets to guarantee that they exist.
-	tx.CreateBucketIfNotExists([]byte("Users"))
+	tenants, err := tx.CreateBucketIfNotExists([]byte("Tenants"))
+	if err != nil {
+		return err
+	} else if err := createBuckets(tx); err != nil {
+		return err
+	}
+
+	// Bring each tenant up to date with the schema as well.
+	var names []string
+	if err := tenants.ForEach(func(k, _ []byte) error {
+		tx.root = tenants.Bucket(k)
+		names = append(names, string(k))
+		return createBuckets(tx)
+	}); err != nil {
+		return err
+	}
 
 	// Commit the transaction.
-	return tx.Commit()
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	// Fill new indexes and views in batches outside of the transaction above.
+	progress := func(p ReindexProgress) {
+		s.logger().Info("building index", "index", p.Index, "n", p.N, "total", p.Total)
+	}
+	if err := s.buildPendingIndexes(progress); err != nil {
+		return err
+	} else if err := s.buildPendingViews(); err != nil {
+		return err
+	}
+	for _, name := range names {
+		if err := s.Tenant(name).buildPendingIndexes(progress); err != nil {
+			return err
+		} else if err := s.Tenant(name).buildPendingViews(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// createBuckets creates the buckets and indexes of the store's schema within
+// the transaction's root, which is either the top level or a tenant's bucket.
+func createBuckets(tx *Tx) error {
+	return tx.store.schema().create(tx)
 }
 
-// Close shuts down the store.
+// openDB opens the bolt database, retrying with backoff while the file is
+// locked by another process.
+func (s *Store) openDB(ctx context.Context) (*bolt.DB, error) {
+	for attempt, backoff := 0, minOpenBackoff; ; attempt++ {
+		// Wait for the lock for the length of the backoff, but never
+		// past the context deadline.
+		timeout := backoff
+		if deadline, ok := ctx.Deadline(); ok {
+			if remaining := time.Until(deadline); remaining < timeout {
+				timeout = remaining
+			}
+		}
+
+		if timeout > 0 {
+			opts := s.boltOptions
+			opts.Timeout, opts.ReadOnly, opts.InitialMmapSize = timeout, s.ReadOnly, s.InitialMmapSize
+			db, err := bolt.Open(s.Path, 0666, &opts)
+			if err == nil && s.AllocSize > 0 {
+				db.AllocSize = s.AllocSize
+			}
+			if err != bolt.ErrTimeout {
+				return db, err
+			}
+		}
+
+		// Stop retrying once the context is done.
+		select {
+		case <-ctx.Done():
+			if ctx.Err() == context.DeadlineExceeded {
+				return nil, ErrDatabaseLocked
+			}
+			return nil, ctx.Err()
+		default:
+		}
+
+		s.logger().Warn("database locked, retrying", "path", s.Path, "attempt", attempt+1)
+		if backoff *= 2; backoff > maxOpenBackoff {
+			backoff = maxOpenBackoff
+		}
+	}
+}
+
+// lockTimeout returns the configured lock timeout or the default, if unset.
+func (s *Store) lockTimeout() time.Duration {
+	if s.LockTimeout == 0 {
+		return DefaultLockTimeout
+	}
+	return s.LockTimeout
+}
+
+// Close shuts down the store. New transactions fail with ErrStoreClosed
+// once Close is called. Returns ErrStoreClosed if the store is not open or
+// a *TxLeakError if leak detection is enabled and transactions remain open.
 func (s *Store) Close() error {
-	return s.db.Close()
+	if s.db == nil {
+		return ErrStoreClosed
+	}
+
+	// Report leaked transactions since closing would wait on them forever.
+	if s.detectTxLeaks() {
+		if err := s.db.txs.wait(s.txLeakTimeout()); err != nil {
+			s.logger().Error("transactions leaked", "path", s.Path, "err", err)
+			return err
+		}
+	}
+	s.db.mu.Lock()
+	if s.db.closed {
+		s.db.mu.Unlock()
+		return ErrStoreClosed
+	}
+	s.db.closed = true
+	s.db.users.Store(nil)
+	s.db.mu.Unlock()
+
+	// Stop background processes before closing the database.
+	if s.closing != nil {
+		close(s.closing)
+		s.wg.Wait()
+		s.closing = nil
+	}
+
+	if err := s.db.close(); err != nil {
+		s.logger().Error("close failed", "path", s.Path, "err", err)
+		return err
+	}
+	s.logger().Info("store closed", "path", s.Path)
+	return nil
+}
+
+// clone returns a copy of the store that shares its database but not its
+// background processes.
+func (s *Store) clone() *Store {
+	other := *s
+	other.closing, other.wg = nil, nil
+	return &other
+}
+
+// Stats returns statistics for the underlying bolt database. Returns zero
+// statistics if the store is not open.
+func (s *Store) Stats() bolt.Stats {
+	if err := s.rlock(); err != nil {
+		return bolt.Stats{}
+	}
+	defer s.db.mu.RUnlock()
+	return s.db.Stats()
+}
+
+// rlock acquires the database lock for reading. Returns ErrStoreClosed if
+// the store is not open.
+func (s *Store) rlock() error {
+	if s.db == nil {
+		return ErrStoreClosed
+	}
+	s.db.mu.RLock()
+	if s.db.closed {
+		s.db.mu.RUnlock()
+		return ErrStoreClosed
+	}
+	return nil
 }
 
 // User retrieves a user by ID.
 func (s *Store) User(id int) (*User, error) {
+	// Serve from memory if users are cached.
+	if c := s.userCache(); c != nil {
+		return copyUser(c.byID[id]), nil
+	}
+
 	// Start a readable transaction.
-	tx, err := s.db.Begin(false)
+	tx, err := s.begin("User", false)
 	if err != nil {
 		return nil, err
 	}
 	defer tx.Rollback()
 
 	// Read encoded user bytes.
-	v := tx.Bucket([]byte("Users")).Get(itob(id))
+	v := tx.Bucket([]byte("Users")).Get(keys.Int(id))
 	if v == nil {
 		return nil, nil
 	}
+	tx.recordRead("Users", v)
 
 	// Unmarshal bytes into a user.
 	var u User
-	if err := u.UnmarshalBinary(v); err != nil {
+	if err := decodeUser(tx, v, &u); err != nil {
 		return nil, err
 	}
 
 	return &u, nil
 }
 
+// UserInto reads the user with the given id into u, overwriting every field.
+// Unlike User, it does not allocate a new User on each call so it can be
+// used with a reused value on hot read paths. Returns ErrUserNotFound if
+// the user does not exist.
+func (s *Store) UserInto(id int, u *User) error {
+	// Serve from memory if users are cached.
+	if c := s.userCache(); c != nil {
+		cached := c.byID[id]
+		if cached == nil {
+			return keyError("user", id, ErrUserNotFound)
+		}
+		tags := u.Tags[:0]
+		*u = *cached
+		if cached.Tags != nil {
+			u.Tags = append(tags, cached.Tags...)
+		}
+		return nil
+	}
+
+	tx, err := s.begin("UserInto", false)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	return loadUser(tx, id, u)
+}
+
+// UserExists returns true if a user with the given id exists. The user is
+// not decoded so it is cheaper than User for validating IDs.
+func (s *Store) UserExists(id int) (bool, error) {
+	if c := s.userCache(); c != nil {
+		return c.byID[id] != nil, nil
+	}
+
+	var exists bool
+	if err := s.view("UserExists", func(tx *Tx) error {
+		exists = tx.Bucket([]byte("Users")).Get(keys.Int(id)) != nil
+		return nil
+	}); err != nil {
+		return false, err
+	}
+	return exists, nil
+}
+
 // Users retrieves a list of all users.
 func (s *Store) Users() ([]*User, error) {
+	// Serve from memory if users are cached.
+	if c := s.userCache(); c != nil {
+		a := make([]*User, len(c.users))
+		for i, u := range c.users {
+			a[i] = copyUser(u)
+		}
+		return a, nil
+	}
+
 	// Start a readable transaction.
-	tx, err := s.db.Begin(false)
+	tx, err := s.begin("Users", false)
 	if err != nil {
 		return nil, err
 	}
@@ -112,8 +753,10 @@ func (s *Store) Users() ([]*User, error) {
 	// Read all users into a slice.
 	var a []*User
 	for k, v := c.First(); k != nil; k, v = c.Next() {
+		tx.recordRead("Users", v)
+
 		var u User
-		if err := u.UnmarshalBinary(v); err != nil {
+		if err := decodeUser(tx, v, &u); err != nil {
 			return nil, err
 		}
 		a = append(a, &u)
@@ -122,85 +765,273 @@ func (s *Store) Users() ([]*User, error) {
 	return a, nil
 }
 
+// UsersByIDs retrieves the users with the given ids in a single transaction.
+// The returned slice is in the same order as ids and holds nil for each id
+// that does not exist.
+func (s *Store) UsersByIDs(ids []int) ([]*User, error) {
+	a := make([]*User, len(ids))
+
+	// Serve from memory if users are cached.
+	if c := s.userCache(); c != nil {
+		for i, id := range ids {
+			a[i] = copyUser(c.byID[id])
+		}
+		return a, nil
+	}
+
+	if err := s.view("UsersByIDs", func(tx *Tx) error {
+		bkt := tx.Bucket([]byte("Users"))
+		for i, id := range ids {
+			v := bkt.Get(keys.Int(id))
+			if v == nil {
+				continue
+			}
+			tx.recordRead("Users", v)
+
+			u := &User{}
+			if err := decodeUser(tx, v, u); err != nil {
+				return err
+			}
+			a[i] = u
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
 // CreateUser creates a new user in the store.
-// The user's ID is set to u.ID on success.
+// The user's ID and normalized username are set on u on success.
+// Returns ErrUsernameTaken if another user has the normalized username.
 func (s *Store) CreateUser(u *User) error {
-	// Start a writeable transaction.
-	tx, err := s.db.Begin(true)
-	if err != nil {
-		return err
-	}
-	defer tx.Rollback()
+	// Retry with a new transaction if this one fails with a transient error.
+	return s.withRetry("CreateUser", func() error {
+		// Start a writeable transaction.
+		tx, err := s.begin("CreateUser", true)
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
 
+		// Create the user within the transaction. Panics from index and
+		// view functions are returned as errors.
+		if err := tx.call(func(tx *Tx) error { return createUser(tx, u) }); err != nil {
+			return err
+		}
+
+		// Commit transaction and exit.
+		return tx.Commit()
+	})
+}
+
+// createUser assigns a new ID to u and saves it to the Users bucket.
+// The username is normalized first.
+func createUser(tx *Tx, u *User) error {
 	// Retrieve bucket.
 	bkt := tx.Bucket([]byte("Users"))
+	u.Username = tx.store.normalizeUsername(u.Username)
+
+	// Ensure the username is allowed and free and the user limit has not
+	// been reached.
+	if err := checkReservedUsername(tx, u.Username); err != nil {
+		return err
+	} else if err := checkUsernameTaken(tx, u.Username, 0); err != nil {
+		return err
+	} else if err := checkUserQuota(tx); err != nil {
+		return err
+	}
 
-	// The sequence is an autoincrementing integer that is transactionally safe.
-	seq, _ := bkt.NextSequence()
-	u.ID = int(seq)
+	// By default, IDs come from the bucket sequence which is an
+	// autoincrementing integer that is transactionally safe.
+	id, err := tx.store.nextID(bkt)
+	if err != nil {
+		return err
+	}
+	u.ID = id
+
+	// Record the signup time unless one was provided, such as during import.
+	if u.CreatedAt.IsZero() {
+		u.CreatedAt = time.Now().UTC()
+	}
 
 	// Marshal our user into bytes.
-	buf, err := u.MarshalBinary()
+	buf, err := encodeUser(tx, u)
 	if err != nil {
 		return err
 	}
 
-	// Save user to the bucket.
-	if err := bkt.Put(itob(u.ID), buf); err != nil {
+	// Save user to the bucket. This also adds the user to its indexes.
+	if err := putValue(tx, "Users", keys.Int(u.ID), buf); err != nil {
+		return err
+	} else if err := recordUserRevision(tx, u.ID, u, nil); err != nil {
 		return err
 	}
+	return recordUserEvent(tx, EventUserCreated, u, nil)
+}
 
-	// Commit transaction and exit.
-	return tx.Commit()
+// loadUser reads the user with the given id into u.
+// Returns ErrUserNotFound if the user does not exist.
+func loadUser(tx *Tx, id int, u *User) error {
+	v := tx.Bucket([]byte("Users")).Get(keys.Int(id))
+	if v == nil {
+		return keyError("user", id, ErrUserNotFound)
+	}
+	tx.recordRead("Users", v)
+	return decodeUser(tx, v, u)
+}
+
+// saveUser encodes u and writes it to the Users bucket.
+func saveUser(tx *Tx, u *User) error {
+	buf, err := encodeUser(tx, u)
+	if err != nil {
+		return err
+	}
+	return putValue(tx, "Users", keys.Int(u.ID), buf)
+}
+
+// encodeUser marshals u and compresses it using the store's settings.
+func encodeUser(tx *Tx, u *User) ([]byte, error) {
+	buf, err := u.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	return tx.store.encodeValue(buf)
+}
+
+// valueBufPool holds buffers that compressed values are decoded into.
+var valueBufPool = sync.Pool{New: func() any { return new([]byte) }}
+
+// decodeUser reassembles and decompresses v, if needed, and unmarshals it
+// into u. Compressed values are decoded into a pooled buffer, which is safe
+// because unmarshaling copies every field.
+func decodeUser(tx *Tx, v []byte, u *User) error {
+	v, err := readOverflow(tx, v)
+	if err != nil {
+		return err
+	} else if v, err = verifyChecksum(v); err != nil {
+		return err
+	} else if !isCompressed(v) {
+		return u.UnmarshalBinary(v)
+	}
+
+	bufp := valueBufPool.Get().(*[]byte)
+	defer valueBufPool.Put(bufp)
+
+	buf, err := decompressTo(*bufp, v)
+	if err != nil {
+		return err
+	}
+	*bufp = buf
+	return u.UnmarshalBinary(buf)
 }
 
 // SetUsername updates the username for a user.
+// Returns ErrUsernameTaken if another user has the normalized username.
 func (s *Store) SetUsername(id int, username string) error {
-	return s.db.Update(func(tx *bolt.Tx) error {
+	return s.update("SetUsername", func(tx *Tx) error {
 		bkt := tx.Bucket([]byte("Users"))
 
 		// Retrieve encoded user and decode.
 		var u User
-		if v := bkt.Get(itob(id)); v == nil {
-			return ErrUserNotFound
-		} else if err := u.UnmarshalBinary(v); err != nil {
+		if v := bkt.Get(keys.Int(id)); v == nil {
+			return keyError("user", id, ErrUserNotFound)
+		} else if err := decodeUser(tx, v, &u); err != nil {
 			return err
+		} else {
+			tx.recordRead("Users", v)
 		}
 
 		// Update user.
-		u.Username = username
+		prev := u
+		u.Username = s.normalizeUsername(username)
+		if err := checkReservedUsername(tx, u.Username); err != nil {
+			return err
+		} else if err := checkUsernameTaken(tx, u.Username, id); err != nil {
+			return err
+		}
+		changes := diffUser(&prev, &u)
 
 		// Encode and save user.
-		if buf, err := u.MarshalBinary(); err != nil {
+		if buf, err := encodeUser(tx, &u); err != nil {
+			return err
+		} else if err := putValue(tx, "Users", keys.Int(id), buf); err != nil {
 			return err
-		} else if err := bkt.Put(itob(id), buf); err != nil {
+		} else if err := recordUserRevision(tx, id, &u, changes); err != nil {
 			return err
 		}
 
-		return nil
+		return recordUserEvent(tx, EventUserUpdated, &u, changes)
 	})
 }
 
 // DeleteUser removes a user by id.
 func (s *Store) DeleteUser(id int) error {
-	return s.db.Update(func(tx *bolt.Tx) error {
-		return tx.Bucket([]byte("Users")).Delete(itob(id))
+	return s.update("DeleteUser", func(tx *Tx) error {
+		return deleteUser(tx, id)
 	})
 }
 
-// itob encodes v as a big endian integer.
-func itob(v int) []byte {
-	buf := make([]byte, 8)
-	binary.BigEndian.PutUint64(buf, uint64(v))
-	return buf
+// deleteUser removes a user and its index entries.
+// Deleting a user that does not exist is not an error.
+func deleteUser(tx *Tx, id int) error {
+	var u User
+	if err := loadUser(tx, id, &u); errors.Is(err, ErrUserNotFound) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	if err := deleteUserBlobs(tx, id); err != nil {
+		return err
+	} else if err := deleteTOTP(tx, id); err != nil {
+		return err
+	} else if _, err := deleteIdentities(tx, id); err != nil {
+		return err
+	} else if err := deletePassword(tx, id); err != nil {
+		return err
+	} else if err := deleteFollows(tx, id); err != nil {
+		return err
+	} else if err := deleteActivity(tx, id); err != nil {
+		return err
+	} else if err := deletePasswordResets(tx, id); err != nil {
+		return err
+	} else if err := deleteFlagOverrides(tx, id); err != nil {
+		return err
+	} else if err := recordUserEvent(tx, EventUserDeleted, &u, nil); err != nil {
+		return err
+	} else if err := recordUserRevision(tx, id, nil, nil); err != nil {
+		return err
+	}
+
+	return deleteValue(tx, "Users", keys.Int(id))
+}
+
+// encodeTime returns t as nanoseconds since the Unix epoch.
+// The zero time is encoded as zero.
+func encodeTime(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixNano()
 }
 
-// User related errors.
+// decodeTime returns the time for v nanoseconds since the Unix epoch.
+// Zero is decoded as the zero time.
+func decodeTime(v int64) time.Time {
+	if v == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, v).UTC()
+}
+
+// Store related errors.
 var (
-	ErrUserNotFound = Error("user not found")
+	ErrDatabaseLocked = &Error{Code: EUNAVAILABLE, Message: "database locked by another process"}
+	ErrStoreClosed    = &Error{Code: EUNAVAILABLE, Message: "store closed"}
 )
 
-// Error represents an application error.
-type Error string
-
-func (e Error) Error() string { return string(e) }
+// User related errors.
+var (
+	ErrUserNotFound = &Error{Code: ENOTFOUND, Message: "user not found"}
+)
@@ -1,10 +1,18 @@
 package main_test
 
 import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
 	"io/ioutil"
 	"os"
 	"reflect"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	main "github.com/benbjohnson/application-development-using-boltdb"
 )
@@ -37,9 +45,10 @@ func TestStore_Users(t *testing.T) {
 	defer s.Close()
 
 	// Create some users.
-	if err := s.CreateUser(&main.User{Username: "susy"}); err != nil {
+	createdAt := time.Date(2016, time.June, 1, 0, 0, 0, 0, time.UTC)
+	if err := s.CreateUser(&main.User{Username: "susy", CreatedAt: createdAt}); err != nil {
 		t.Fatal(err)
-	} else if err := s.CreateUser(&main.User{Username: "john"}); err != nil {
+	} else if err := s.CreateUser(&main.User{Username: "john", CreatedAt: createdAt}); err != nil {
 		t.Fatal(err)
 	}
 
@@ -47,13 +56,119 @@ func TestStore_Users(t *testing.T) {
 	if a, err := s.Users(); err != nil {
 		t.Fatal(err)
 	} else if !reflect.DeepEqual(a, []*main.User{
-		{ID: 1, Username: "susy"},
-		{ID: 2, Username: "john"},
+		{ID: 1, Username: "susy", CreatedAt: createdAt},
+		{ID: 2, Username: "john", CreatedAt: createdAt},
 	}) {
 		t.Fatalf("unexpected users: %#v", a)
 	}
 }
 
+// Ensure the presence of a user can be checked, from disk and from the cache.
+func TestStore_UserExists(t *testing.T) {
+	s := OpenStore()
+	defer s.Close()
+
+	if err := s.CreateUser(&main.User{Username: "susy"}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, cache := range []bool{false, true} {
+		s.CacheUsers = cache
+		if err := s.Reopen(); err != nil {
+			t.Fatal(err)
+		}
+
+		if ok, err := s.UserExists(1); err != nil {
+			t.Fatal(err)
+		} else if !ok {
+			t.Fatalf("expected user to exist (cache=%v)", cache)
+		} else if ok, err := s.UserExists(2); err != nil {
+			t.Fatal(err)
+		} else if ok {
+			t.Fatalf("unexpected user (cache=%v)", cache)
+		}
+	}
+}
+
+// Ensure users can be retrieved by ID in order, from disk and from the cache.
+func TestStore_UsersByIDs(t *testing.T) {
+	s := OpenStore()
+	defer s.Close()
+
+	createdAt := time.Date(2016, time.June, 1, 0, 0, 0, 0, time.UTC)
+	if err := s.CreateUser(&main.User{Username: "susy", CreatedAt: createdAt}); err != nil {
+		t.Fatal(err)
+	} else if err := s.CreateUser(&main.User{Username: "john", CreatedAt: createdAt}); err != nil {
+		t.Fatal(err)
+	}
+
+	exp := []*main.User{
+		{ID: 2, Username: "john", CreatedAt: createdAt},
+		nil,
+		{ID: 1, Username: "susy", CreatedAt: createdAt},
+		{ID: 2, Username: "john", CreatedAt: createdAt},
+	}
+	for _, cache := range []bool{false, true} {
+		s.CacheUsers = cache
+		if err := s.Reopen(); err != nil {
+			t.Fatal(err)
+		}
+
+		if a, err := s.UsersByIDs([]int{2, 100, 1, 2}); err != nil {
+			t.Fatal(err)
+		} else if !reflect.DeepEqual(a, exp) {
+			t.Fatalf("unexpected users (cache=%v): %#v", cache, a)
+		}
+
+		if a, err := s.UsersByIDs(nil); err != nil {
+			t.Fatal(err)
+		} else if len(a) != 0 {
+			t.Fatalf("unexpected users: %#v", a)
+		}
+	}
+}
+
+// Ensure users can be read into a reused value, from disk and from the cache.
+func TestStore_UserInto(t *testing.T) {
+	s := OpenStore()
+	defer s.Close()
+	s.Compression = main.SnappyCompression
+
+	tags := []string{strings.Repeat("x", 10000)}
+	if err := s.CreateUser(&main.User{Username: "susy", Tags: tags}); err != nil {
+		t.Fatal(err)
+	} else if err := s.CreateUser(&main.User{Username: "john"}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, cache := range []bool{false, true} {
+		s.CacheUsers = cache
+		if err := s.Reopen(); err != nil {
+			t.Fatal(err)
+		}
+
+		// Every field is overwritten by the next read.
+		var u main.User
+		for i := 0; i < 3; i++ {
+			if err := s.UserInto(1, &u); err != nil {
+				t.Fatal(err)
+			} else if u.ID != 1 || u.Username != "susy" || !reflect.DeepEqual(u.Tags, tags) {
+				t.Fatalf("unexpected user: %d/%s", u.ID, u.Username)
+			}
+
+			if err := s.UserInto(2, &u); err != nil {
+				t.Fatal(err)
+			} else if u.ID != 2 || u.Username != "john" || u.Tags != nil {
+				t.Fatalf("unexpected user: %#v", u)
+			}
+		}
+
+		if err := s.UserInto(3, &u); !errors.Is(err, main.ErrUserNotFound) {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+}
+
 // Ensure store can update a user's username.
 func TestStore_SetUsername(t *testing.T) {
 	s := OpenStore()
@@ -83,7 +198,7 @@ func TestStore_SetUsername_ErrUserNotFound(t *testing.T) {
 	defer s.Close()
 
 	// Update username.
-	if err := s.SetUsername(1, "jimbo"); err != main.ErrUserNotFound {
+	if err := s.SetUsername(1, "jimbo"); !errors.Is(err, main.ErrUserNotFound) {
 		t.Fatalf("unexpected error: %v", err)
 	}
 }
@@ -111,6 +226,261 @@ func TestStore_DeleteUser(t *testing.T) {
 	}
 }
 
+// Ensure opening a locked data file returns an error after the lock timeout.
+func TestStore_Open_ErrDatabaseLocked(t *testing.T) {
+	s := OpenStore()
+	defer s.Close()
+
+	other := &main.Store{Path: s.Path, LockTimeout: 100 * time.Millisecond}
+	if err := other.Open(); !errors.Is(err, main.ErrDatabaseLocked) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+// Ensure OpenContext waits for a locked data file to be released.
+func TestStore_OpenContext_Wait(t *testing.T) {
+	s := OpenStore()
+	defer os.Remove(s.Path)
+
+	// Release the lock after a short delay.
+	go func() {
+		time.Sleep(200 * time.Millisecond)
+		s.Store.Close()
+	}()
+
+	other := &main.Store{Path: s.Path}
+	if err := other.OpenContext(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	other.Close()
+}
+
+// Ensure OpenContext stops waiting when its context is canceled.
+func TestStore_OpenContext_Canceled(t *testing.T) {
+	s := OpenStore()
+	defer s.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(100*time.Millisecond, cancel)
+
+	other := &main.Store{Path: s.Path}
+	if err := other.OpenContext(ctx); err != context.Canceled {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+// Ensure methods return an error on a store that is not open.
+func TestStore_ErrStoreClosed(t *testing.T) {
+	s := NewStore()
+	defer os.Remove(s.Path)
+
+	if _, err := s.User(1); !errors.Is(err, main.ErrStoreClosed) {
+		t.Fatalf("unexpected error: %v", err)
+	} else if err := s.SetUsername(1, "susy"); !errors.Is(err, main.ErrStoreClosed) {
+		t.Fatalf("unexpected error: %v", err)
+	} else if err := s.Compact(); !errors.Is(err, main.ErrStoreClosed) {
+		t.Fatalf("unexpected error: %v", err)
+	} else if err := s.Store.Close(); !errors.Is(err, main.ErrStoreClosed) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if err := s.Open(); err != nil {
+		t.Fatal(err)
+	} else if err := s.Store.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.CreateUser(&main.User{Username: "susy"}); !errors.Is(err, main.ErrStoreClosed) {
+		t.Fatalf("unexpected error: %v", err)
+	} else if _, err := s.Tenant("acme").Users(); !errors.Is(err, main.ErrStoreClosed) {
+		t.Fatalf("unexpected error: %v", err)
+	} else if err := s.BulkLoad(func() error { return nil }); !errors.Is(err, main.ErrStoreClosed) {
+		t.Fatalf("unexpected error: %v", err)
+	} else if err := s.Compact(); !errors.Is(err, main.ErrStoreClosed) {
+		t.Fatalf("unexpected error: %v", err)
+	} else if err := s.Healthy(); !errors.Is(err, main.ErrStoreClosed) {
+		t.Fatalf("unexpected error: %v", err)
+	} else if err := s.Store.Close(); !errors.Is(err, main.ErrStoreClosed) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+// Ensure closing a store while it is in use fails operations cleanly.
+func TestStore_Close_Concurrent(t *testing.T) {
+	s := OpenStore()
+	defer os.Remove(s.Path)
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 16)
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; ; j++ {
+				var err error
+				switch j % 4 {
+				case 0:
+					err = s.CreateUser(&main.User{Username: fmt.Sprintf("user%d-%d", i, j)})
+				case 1:
+					_, err = s.User(j)
+				case 2:
+					_, err = s.Users()
+				case 3:
+					err = s.SetUsername(1, fmt.Sprintf("name%d", j))
+					if errors.Is(err, main.ErrUserNotFound) {
+						err = nil
+					}
+				}
+				if err != nil {
+					errs <- err
+					return
+				}
+			}
+		}(i)
+	}
+
+	// Close the store while operations are running. Concurrent calls to
+	// Close must not close it twice.
+	time.Sleep(50 * time.Millisecond)
+	closeErrs := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		go func() { closeErrs <- s.Store.Close() }()
+	}
+	if a, b := <-closeErrs, <-closeErrs; (a == nil) == (b == nil) {
+		t.Fatalf("unexpected close errors: %v, %v", a, b)
+	}
+
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if !errors.Is(err, main.ErrStoreClosed) {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+}
+
+// Ensure decoding arbitrary data never panics and that decoded users
+// survive a round trip.
+func FuzzUser_UnmarshalBinary(f *testing.F) {
+	buf, _ := (&main.User{ID: 1, Username: "susy", Tags: []string{"beta"}, CreatedAt: time.Unix(1466640000, 0)}).MarshalBinary()
+	f.Add(buf)
+	f.Add([]byte{})
+	f.Add([]byte{0x0a, 0xff, 0xff, 0xff, 0xff, 0x0f})
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var u main.User
+		if err := u.UnmarshalBinary(data); err != nil {
+			return
+		}
+
+		var other main.User
+		if buf, err := u.MarshalBinary(); err != nil {
+			t.Fatal(err)
+		} else if err := other.UnmarshalBinary(buf); err != nil {
+			t.Fatal(err)
+		} else if !reflect.DeepEqual(other, u) {
+			t.Fatalf("round trip mismatch: %#v != %#v", other, u)
+		}
+	})
+}
+
+func BenchmarkStore_CreateUser(b *testing.B) {
+	benchmarkSizes(b, func(b *testing.B, s *Store, n int) {
+		for i := 0; i < b.N; i++ {
+			if err := s.CreateUser(&main.User{Username: "susy"}); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func BenchmarkStore_User(b *testing.B) {
+	benchmarkSizes(b, func(b *testing.B, s *Store, n int) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if u, err := s.User(i%n + 1); err != nil {
+				b.Fatal(err)
+			} else if u == nil {
+				b.Fatal("user not found")
+			}
+		}
+	})
+}
+
+func BenchmarkStore_UserInto(b *testing.B) {
+	benchmarkSizes(b, func(b *testing.B, s *Store, n int) {
+		b.ReportAllocs()
+		var u main.User
+		for i := 0; i < b.N; i++ {
+			if err := s.UserInto(i%n+1, &u); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func BenchmarkStore_UsersByIDs(b *testing.B) {
+	benchmarkSizes(b, func(b *testing.B, s *Store, n int) {
+		b.ReportAllocs()
+		ids := make([]int, 50)
+		for i := 0; i < b.N; i++ {
+			for j := range ids {
+				ids[j] = (i*len(ids)+j)%n + 1
+			}
+			if a, err := s.UsersByIDs(ids); err != nil {
+				b.Fatal(err)
+			} else if len(a) != len(ids) {
+				b.Fatalf("unexpected user count: %d", len(a))
+			}
+		}
+	})
+}
+
+func BenchmarkStore_Users(b *testing.B) {
+	benchmarkSizes(b, func(b *testing.B, s *Store, n int) {
+		for i := 0; i < b.N; i++ {
+			if a, err := s.Users(); err != nil {
+				b.Fatal(err)
+			} else if len(a) != n {
+				b.Fatalf("unexpected user count: %d", len(a))
+			}
+		}
+	})
+}
+
+// benchSizes is a comma-separated list of dataset sizes to benchmark against.
+var benchSizes = flag.String("bench.sizes", "1000,10000", "comma-separated user counts for benchmarks")
+
+// benchmarkSizes runs fn as a sub-benchmark against a store preloaded with
+// each configured number of users. Users are named "user<n>" starting at 0.
+func benchmarkSizes(b *testing.B, fn func(b *testing.B, s *Store, n int)) {
+	for _, v := range strings.Split(*benchSizes, ",") {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			b.Fatalf("invalid bench size: %q", v)
+		}
+
+		b.Run(fmt.Sprintf("N=%d", n), func(b *testing.B) {
+			s := OpenStore()
+			defer s.Close()
+
+			if err := s.BulkLoad(func() error {
+				for i := 0; i < n; i++ {
+					if err := s.CreateUser(&main.User{Username: fmt.Sprintf("user%d", i)}); err != nil {
+						return err
+					}
+				}
+				return nil
+			}); err != nil {
+				b.Fatal(err)
+			}
+
+			b.ResetTimer()
+			fn(b, s, n)
+		})
+	}
+}
+
 // Store is a test wrapper for main.Store.
 type Store struct {
 	*main.Store
@@ -125,9 +495,7 @@ func NewStore() *Store {
 	f.Close()
 
 	return &Store{
-		Store: &main.Store{
-			Path: f.Name(),
-		},
+		Store: main.NewStore(f.Name()),
 	}
 }
 
@@ -140,6 +508,14 @@ func OpenStore() *Store {
 	return s
 }
 
+// Reopen closes and reopens the store on the same data file.
+func (s *Store) Reopen() error {
+	if err := s.Store.Close(); err != nil {
+		return err
+	}
+	return s.Open()
+}
+
 // Close closes the store and removes the underlying data file.
 func (s *Store) Close() error {
 	defer os.Remove(s.Path)
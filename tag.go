@@ -0,0 +1,104 @@
+package main
+
+import (
+	"github.com/benbjohnson/application-development-using-boltdb/keys"
+)
+
+// UsersWithTag retrieves all users that have tag, ordered by ID.
+func (s *Store) UsersWithTag(tag string) ([]*User, error) {
+	var a []*User
+	if err := s.view("UsersWithTag", func(tx *Tx) error {
+		// Each index key is the tag followed by the user ID.
+		c := tx.Bucket([]byte("UsersByTag")).Cursor()
+		return keys.Scan(c, keys.String(tag), func(k, _ []byte) error {
+			r := keys.NewReader(k)
+			r.ReadString()
+			id := r.ReadInt()
+			if err := r.Err(); err != nil {
+				return err
+			}
+
+			var u User
+			if err := loadUser(tx, id, &u); err != nil {
+				return err
+			}
+			a = append(a, &u)
+			return nil
+		})
+	}); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// AddTag adds tag to a user. Adding a tag the user already has is a no-op.
+func (s *Store) AddTag(id int, tag string) error {
+	if tag == "" {
+		return ErrTagRequired
+	}
+
+	return s.update("AddTag", func(tx *Tx) error {
+		var u User
+		if err := loadUser(tx, id, &u); err != nil {
+			return err
+		} else if hasTag(u.Tags, tag) {
+			return nil
+		}
+
+		prev := u
+		u.Tags = append(u.Tags, tag)
+
+		changes := diffUser(&prev, &u)
+		if err := saveUser(tx, &u); err != nil {
+			return err
+		} else if err := recordUserRevision(tx, id, &u, changes); err != nil {
+			return err
+		}
+		return recordUserEvent(tx, EventUserUpdated, &u, changes)
+	})
+}
+
+// RemoveTag removes tag from a user. Removing a missing tag is a no-op.
+func (s *Store) RemoveTag(id int, tag string) error {
+	return s.update("RemoveTag", func(tx *Tx) error {
+		var u User
+		if err := loadUser(tx, id, &u); err != nil {
+			return err
+		} else if !hasTag(u.Tags, tag) {
+			return nil
+		}
+
+		// Rebuild the tag list without the removed tag.
+		prev := u
+		other := make([]string, 0, len(u.Tags)-1)
+		for _, t := range u.Tags {
+			if t != tag {
+				other = append(other, t)
+			}
+		}
+		u.Tags = other
+
+		changes := diffUser(&prev, &u)
+		if err := saveUser(tx, &u); err != nil {
+			return err
+		} else if err := recordUserRevision(tx, id, &u, changes); err != nil {
+			return err
+		}
+		return recordUserEvent(tx, EventUserUpdated, &u, changes)
+	})
+}
+
+// hasTag returns true if tags contains tag.
+func hasTag(tags []string, tag string) bool {
+	for _, t := range tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// Tag related errors.
+var (
+	ErrTagRequired = &Error{Code: EINVALID, Message: "tag required"}
+)
@@ -0,0 +1,105 @@
+package main_test
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	main "github.com/benbjohnson/application-development-using-boltdb"
+)
+
+// Ensure users can be retrieved by tag.
+func TestStore_UsersWithTag(t *testing.T) {
+	s := OpenStore()
+	defer s.Close()
+
+	// Create users with some overlapping tags.
+	if err := s.CreateUser(&main.User{Username: "susy", Tags: []string{"admin", "beta"}}); err != nil {
+		t.Fatal(err)
+	} else if err := s.CreateUser(&main.User{Username: "john", Tags: []string{"beta"}}); err != nil {
+		t.Fatal(err)
+	} else if err := s.CreateUser(&main.User{Username: "jane"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if a, err := s.UsersWithTag("beta"); err != nil {
+		t.Fatal(err)
+	} else if !reflect.DeepEqual(usernames(a), []string{"susy", "john"}) {
+		t.Fatalf("unexpected users: %v", usernames(a))
+	}
+
+	if a, err := s.UsersWithTag("admin"); err != nil {
+		t.Fatal(err)
+	} else if !reflect.DeepEqual(usernames(a), []string{"susy"}) {
+		t.Fatalf("unexpected users: %v", usernames(a))
+	}
+
+	// Tags that are a prefix of another tag should not match.
+	if a, err := s.UsersWithTag("bet"); err != nil {
+		t.Fatal(err)
+	} else if len(a) != 0 {
+		t.Fatalf("unexpected users: %v", usernames(a))
+	}
+}
+
+// Ensure tags can be added to and removed from a user.
+func TestStore_AddTag_RemoveTag(t *testing.T) {
+	s := OpenStore()
+	defer s.Close()
+
+	if err := s.CreateUser(&main.User{Username: "susy"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Add a tag twice; the second call is a no-op.
+	if err := s.AddTag(1, "banned"); err != nil {
+		t.Fatal(err)
+	} else if err := s.AddTag(1, "banned"); err != nil {
+		t.Fatal(err)
+	} else if u, _ := s.User(1); !reflect.DeepEqual(u.Tags, []string{"banned"}) {
+		t.Fatalf("unexpected tags: %v", u.Tags)
+	} else if a, _ := s.UsersWithTag("banned"); len(a) != 1 {
+		t.Fatalf("unexpected users: %v", usernames(a))
+	}
+
+	// Remove the tag.
+	if err := s.RemoveTag(1, "banned"); err != nil {
+		t.Fatal(err)
+	} else if u, _ := s.User(1); len(u.Tags) != 0 {
+		t.Fatalf("unexpected tags: %v", u.Tags)
+	} else if a, _ := s.UsersWithTag("banned"); len(a) != 0 {
+		t.Fatalf("unexpected users: %v", usernames(a))
+	}
+
+	// Missing users and empty tags return errors.
+	if err := s.AddTag(2, "beta"); !errors.Is(err, main.ErrUserNotFound) {
+		t.Fatalf("unexpected error: %v", err)
+	} else if err := s.AddTag(1, ""); !errors.Is(err, main.ErrTagRequired) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+// Ensure deleting a user removes it from the tag index.
+func TestStore_DeleteUser_Tags(t *testing.T) {
+	s := OpenStore()
+	defer s.Close()
+
+	if err := s.CreateUser(&main.User{Username: "susy", Tags: []string{"beta"}}); err != nil {
+		t.Fatal(err)
+	} else if err := s.DeleteUser(1); err != nil {
+		t.Fatal(err)
+	} else if a, err := s.UsersWithTag("beta"); err != nil {
+		t.Fatal(err)
+	} else if len(a) != 0 {
+		t.Fatalf("unexpected users: %v", usernames(a))
+	}
+}
+
+// usernames returns the usernames of a list of users.
+func usernames(a []*main.User) []string {
+	other := make([]string, len(a))
+	for i := range a {
+		other[i] = a[i].Username
+	}
+	return other
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/boltdb/bolt"
+)
+
+// TenantStore is a store whose operations are scoped to a single tenant.
+//
+// Every tenant has its own set of buckets nested under the top-level
+// "Tenants" bucket so one data file can serve many isolated customers.
+// A TenantStore shares the database of the store that created it and must
+// not be opened separately.
+type TenantStore struct {
+	*Store
+}
+
+// Tenant returns a store scoped to the named tenant. Operations on the
+// returned store return ErrTenantNotFound if the tenant does not exist.
+func (s *Store) Tenant(name string) *TenantStore {
+	other := s.clone()
+	other.tenant = name
+	return &TenantStore{Store: other}
+}
+
+// Name returns the name of the tenant.
+func (t *TenantStore) Name() string { return t.tenant }
+
+// Close is a no-op. The database is owned by the parent store.
+func (t *TenantStore) Close() error { return nil }
+
+// PageStats returns page statistics for all of the tenant's buckets.
+func (t *TenantStore) PageStats() (bolt.BucketStats, error) {
+	var stats bolt.BucketStats
+	if err := t.view("PageStats", func(tx *Tx) error {
+		stats = tx.root.Stats()
+		return nil
+	}); err != nil {
+		return bolt.BucketStats{}, err
+	}
+	return stats, nil
+}
+
+// Backup writes a copy of the tenant's data to path as a standalone
+// database that can be opened with a Store.
+//
+// Like Snapshot, the copy is written to a temporary file and renamed into
+// place so readers never see a partial backup.
+func (t *TenantStore) Backup(path string) error {
+	return t.view("Backup", func(tx *Tx) error {
+		f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp-")
+		if err != nil {
+			return err
+		}
+		f.Close()
+		defer os.Remove(f.Name())
+
+		db, err := bolt.Open(f.Name(), 0600, &bolt.Options{Timeout: t.lockTimeout()})
+		if err != nil {
+			return err
+		}
+		defer db.Close()
+
+		// Copy each of the tenant's buckets to the top level of the backup.
+		if err := db.Update(func(dst *bolt.Tx) error {
+			return tx.root.ForEach(func(k, v []byte) error {
+				if v != nil {
+					return nil
+				}
+
+				b, err := dst.CreateBucket(k)
+				if err != nil {
+					return err
+				}
+				return copyBucket(b, tx.root.Bucket(k))
+			})
+		}); err != nil {
+			return err
+		} else if err := db.Close(); err != nil {
+			return err
+		}
+
+		return os.Rename(f.Name(), path)
+	})
+}
+
+// copyBucket recursively copies all keys, nested buckets, and the sequence
+// from src into dst.
+func copyBucket(dst, src *bolt.Bucket) error {
+	if err := dst.SetSequence(src.Sequence()); err != nil {
+		return err
+	}
+
+	return src.ForEach(func(k, v []byte) error {
+		if v != nil {
+			return dst.Put(k, v)
+		}
+
+		b, err := dst.CreateBucket(k)
+		if err != nil {
+			return err
+		}
+		return copyBucket(b, src.Bucket(k))
+	})
+}
+
+// CreateTenant creates a new tenant and initializes its buckets.
+func (s *Store) CreateTenant(name string) error {
+	if name == "" {
+		return ErrTenantNameRequired
+	}
+
+	if err := s.update("CreateTenant", func(tx *Tx) error {
+		root, err := tx.topBucket("Tenants").CreateBucket([]byte(name))
+		if err == bolt.ErrBucketExists {
+			return keyError("tenant", name, ErrTenantExists)
+		} else if err != nil {
+			return err
+		}
+		tx.recordWrite("Tenants", nil)
+
+		// Create the tenant's buckets within its root.
+		tx.root = root
+		return createBuckets(tx)
+	}); err != nil {
+		return err
+	}
+
+	// Finish the tenant's indexes and views. Its buckets are empty so this
+	// is quick.
+	if err := s.Tenant(name).buildPendingIndexes(nil); err != nil {
+		return err
+	}
+	return s.Tenant(name).buildPendingViews()
+}
+
+// Tenants returns the names of all tenants, sorted by name.
+func (s *Store) Tenants() ([]string, error) {
+	a := []string{}
+	if err := s.view("Tenants", func(tx *Tx) error {
+		bkt := tx.topBucket("Tenants")
+		if bkt == nil {
+			return nil
+		}
+		return bkt.ForEach(func(k, _ []byte) error {
+			a = append(a, string(k))
+			return nil
+		})
+	}); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// DeleteTenant removes a tenant and all of its data.
+func (s *Store) DeleteTenant(name string) error {
+	return s.update("DeleteTenant", func(tx *Tx) error {
+		if err := tx.topBucket("Tenants").DeleteBucket([]byte(name)); err == bolt.ErrBucketNotFound {
+			return keyError("tenant", name, ErrTenantNotFound)
+		} else if err != nil {
+			return err
+		}
+		tx.recordDelete("Tenants")
+		return nil
+	})
+}
+
+// tenantBucket returns the root bucket of the named tenant or nil if the
+// tenant does not exist.
+func tenantBucket(tx *Tx, name string) *bolt.Bucket {
+	bkt := tx.topBucket("Tenants")
+	if bkt == nil {
+		return nil
+	}
+	return bkt.Bucket([]byte(name))
+}
+
+// Tenant related errors.
+var (
+	ErrTenantNameRequired = &Error{Code: EINVALID, Message: "tenant name required"}
+	ErrTenantExists       = &Error{Code: ECONFLICT, Message: "tenant already exists"}
+	ErrTenantNotFound     = &Error{Code: ENOTFOUND, Message: "tenant not found"}
+)
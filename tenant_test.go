@@ -0,0 +1,181 @@
+package main_test
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"testing"
+
+	main "github.com/benbjohnson/application-development-using-boltdb"
+)
+
+// Ensure tenants can be created, listed, and deleted.
+func TestStore_Tenants(t *testing.T) {
+	s := OpenStore()
+	defer s.Close()
+
+	if err := s.CreateTenant("beta"); err != nil {
+		t.Fatal(err)
+	} else if err := s.CreateTenant("acme"); err != nil {
+		t.Fatal(err)
+	} else if err := s.CreateTenant("acme"); !errors.Is(err, main.ErrTenantExists) {
+		t.Fatalf("unexpected error: %v", err)
+	} else if err := s.CreateTenant(""); !errors.Is(err, main.ErrTenantNameRequired) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if a, err := s.Tenants(); err != nil {
+		t.Fatal(err)
+	} else if !reflect.DeepEqual(a, []string{"acme", "beta"}) {
+		t.Fatalf("unexpected tenants: %v", a)
+	}
+
+	// Delete a tenant and verify it is gone.
+	if err := s.DeleteTenant("acme"); err != nil {
+		t.Fatal(err)
+	} else if err := s.DeleteTenant("acme"); !errors.Is(err, main.ErrTenantNotFound) {
+		t.Fatalf("unexpected error: %v", err)
+	} else if a, err := s.Tenants(); err != nil {
+		t.Fatal(err)
+	} else if !reflect.DeepEqual(a, []string{"beta"}) {
+		t.Fatalf("unexpected tenants: %v", a)
+	}
+}
+
+// Ensure data written to a tenant is isolated from other tenants and from
+// the top level of the store.
+func TestStore_Tenant_Isolation(t *testing.T) {
+	s := OpenStore()
+	defer s.Close()
+
+	if err := s.CreateTenant("acme"); err != nil {
+		t.Fatal(err)
+	} else if err := s.CreateTenant("beta"); err != nil {
+		t.Fatal(err)
+	}
+	acme, beta := s.Tenant("acme"), s.Tenant("beta")
+
+	// Create users in each tenant and at the top level.
+	if err := acme.CreateUser(&main.User{Username: "susy"}); err != nil {
+		t.Fatal(err)
+	} else if err := acme.CreateUser(&main.User{Username: "john"}); err != nil {
+		t.Fatal(err)
+	} else if err := beta.CreateUser(&main.User{Username: "jane"}); err != nil {
+		t.Fatal(err)
+	} else if err := s.CreateUser(&main.User{Username: "root"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// IDs are allocated per tenant and lookups only see the tenant's data.
+	if u, err := beta.User(1); err != nil {
+		t.Fatal(err)
+	} else if u == nil || u.Username != "jane" {
+		t.Fatalf("unexpected user: %#v", u)
+	}
+	if a, err := acme.Users(); err != nil {
+		t.Fatal(err)
+	} else if len(a) != 2 {
+		t.Fatalf("unexpected user count: %d", len(a))
+	}
+	if u, err := beta.UserByName("susy"); err != nil {
+		t.Fatal(err)
+	} else if u != nil {
+		t.Fatalf("unexpected user: %#v", u)
+	}
+	if a, err := s.Users(); err != nil {
+		t.Fatal(err)
+	} else if len(a) != 1 || a[0].Username != "root" {
+		t.Fatalf("unexpected users: %#v", a)
+	}
+
+	// Closing a tenant store does not close the shared database.
+	if err := acme.Close(); err != nil {
+		t.Fatal(err)
+	} else if _, err := beta.User(1); err != nil {
+		t.Fatal(err)
+	}
+
+	// Deleting a tenant removes its data.
+	if err := s.DeleteTenant("acme"); err != nil {
+		t.Fatal(err)
+	} else if _, err := acme.Users(); !errors.Is(err, main.ErrTenantNotFound) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+// Ensure operations on a tenant that does not exist return an error.
+func TestStore_Tenant_ErrTenantNotFound(t *testing.T) {
+	s := OpenStore()
+	defer s.Close()
+
+	if err := s.Tenant("nope").CreateUser(&main.User{Username: "susy"}); !errors.Is(err, main.ErrTenantNotFound) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+// Ensure statistics can be retrieved for a single tenant.
+func TestTenantStore_PageStats(t *testing.T) {
+	s := OpenStore()
+	defer s.Close()
+
+	if err := s.CreateTenant("acme"); err != nil {
+		t.Fatal(err)
+	}
+	acme := s.Tenant("acme")
+	for i := 0; i < 3; i++ {
+		if err := acme.CreateUser(&main.User{Username: fmt.Sprintf("user%d", i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Three users and three username index entries.
+	if stats, err := acme.PageStats(); err != nil {
+		t.Fatal(err)
+	} else if stats.KeyN < 6 {
+		t.Fatalf("unexpected key count: %d", stats.KeyN)
+	}
+}
+
+// Ensure a tenant can be backed up to a standalone data file.
+func TestTenantStore_Backup(t *testing.T) {
+	s := OpenStore()
+	defer s.Close()
+
+	if err := s.CreateTenant("acme"); err != nil {
+		t.Fatal(err)
+	}
+	acme := s.Tenant("acme")
+	if err := acme.CreateUser(&main.User{Username: "susy"}); err != nil {
+		t.Fatal(err)
+	} else if err := s.CreateUser(&main.User{Username: "root"}); err != nil {
+		t.Fatal(err)
+	}
+
+	path := s.Path + ".acme"
+	defer os.Remove(path)
+	if err := acme.Backup(path); err != nil {
+		t.Fatal(err)
+	}
+
+	// Open the backup as its own store and verify only the tenant's data
+	// exists and that new IDs continue from the tenant's sequence.
+	other := &Store{Store: &main.Store{Path: path}}
+	if err := other.Open(); err != nil {
+		t.Fatal(err)
+	}
+	defer other.Close()
+
+	if a, err := other.Users(); err != nil {
+		t.Fatal(err)
+	} else if len(a) != 1 || a[0].Username != "susy" {
+		t.Fatalf("unexpected users: %#v", a)
+	}
+
+	u := &main.User{Username: "john"}
+	if err := other.CreateUser(u); err != nil {
+		t.Fatal(err)
+	} else if u.ID != 2 {
+		t.Fatalf("unexpected ID: %d", u.ID)
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// TimeoutError is returned when a write operation exceeds the store's
+// WriteTimeout, either while waiting for the writer lock or before it
+// commits. It matches ErrTimeout with errors.Is.
+type TimeoutError struct {
+	// Operation that timed out and the timeout it exceeded.
+	Op      string
+	Timeout time.Duration
+
+	// Operation, duration, and call site of the transaction holding the
+	// writer lock when the timeout expired. This is the timed out
+	// transaction itself if it ran too long before committing. The call
+	// site is empty if the holder's stack was not captured.
+	HolderOp       string
+	HolderDuration time.Duration
+	HolderCallSite string
+}
+
+// Error returns the timed out operation and the transaction that blocked it.
+func (e *TimeoutError) Error() string {
+	msg := fmt.Sprintf("%s timed out after %s", e.Op, e.Timeout)
+	if e.HolderOp != "" {
+		msg += fmt.Sprintf(": writer lock held by %s for %s", e.HolderOp, e.HolderDuration.Round(time.Millisecond))
+		if e.HolderCallSite != "" {
+			msg += " at " + e.HolderCallSite
+		}
+	}
+	return msg
+}
+
+// Unwrap returns ErrTimeout.
+func (e *TimeoutError) Unwrap() error { return ErrTimeout }
+
+// writerLock serializes the writable transactions of a database ahead of
+// bolt's own writer lock so that waiting for it can time out and report
+// which transaction holds it.
+type writerLock struct {
+	once sync.Once
+	ch   chan struct{}
+
+	// Transaction holding the lock, once it has begun.
+	holder atomic.Pointer[Tx]
+}
+
+// acquire waits for the lock. Returns a *TimeoutError if timeout passes
+// first. Waits indefinitely if timeout is zero.
+func (l *writerLock) acquire(op string, timeout time.Duration) error {
+	l.once.Do(func() { l.ch = make(chan struct{}, 1) })
+	if timeout <= 0 {
+		l.ch <- struct{}{}
+		return nil
+	}
+
+	t := time.NewTimer(timeout)
+	defer t.Stop()
+	select {
+	case l.ch <- struct{}{}:
+		return nil
+	case <-t.C:
+		e := &TimeoutError{Op: op, Timeout: timeout}
+		if tx := l.holder.Load(); tx != nil {
+			e.HolderOp, e.HolderDuration = tx.op, time.Since(tx.start)
+			e.HolderCallSite, _ = formatCallers(tx.pcs)
+		}
+		return e
+	}
+}
+
+// release releases the lock.
+func (l *writerLock) release() {
+	l.holder.Store(nil)
+	<-l.ch
+}
+
+// checkWriteTimeout returns a *TimeoutError if tx began more than the
+// store's WriteTimeout ago.
+func checkWriteTimeout(tx *Tx) error {
+	timeout := tx.store.WriteTimeout
+	if timeout <= 0 {
+		return nil
+	} else if d := time.Since(tx.start); d > timeout {
+		callSite, _ := formatCallers(tx.pcs)
+		return &TimeoutError{Op: tx.op, Timeout: timeout, HolderOp: tx.op, HolderDuration: d, HolderCallSite: callSite}
+	}
+	return nil
+}
+
+// Timeout related errors.
+var (
+	ErrTimeout = &Error{Code: EUNAVAILABLE, Message: "write timeout"}
+)
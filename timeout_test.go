@@ -0,0 +1,78 @@
+package main_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	main "github.com/benbjohnson/application-development-using-boltdb"
+	"github.com/benbjohnson/application-development-using-boltdb/keys"
+)
+
+// blockingSchema returns the default schema with an index on usernames that
+// signals started and then waits for release while indexing username.
+func blockingSchema(username string, started, release chan struct{}) *main.Schema {
+	return &main.Schema{
+		Buckets: main.DefaultSchema.Buckets,
+		Indexes: append([]*main.Index{{
+			Name:   "UsersByBlock",
+			Source: "Users",
+			Keys: func(_, v []byte) ([][]byte, error) {
+				var u main.User
+				if err := u.UnmarshalBinary(v); err != nil {
+					return nil, err
+				} else if u.Username == username {
+					close(started)
+					<-release
+				}
+				return [][]byte{keys.String(u.Username)}, nil
+			},
+		}}, main.DefaultSchema.Indexes...),
+	}
+}
+
+// Ensure writes blocked behind a stuck writer time out and name it, and that
+// the stuck writer is rolled back.
+func TestStore_WriteTimeout(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+	s := NewStore()
+	s.Schema = blockingSchema("stuck", started, release)
+	s.WriteTimeout = 50 * time.Millisecond
+	if err := s.Open(); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	errc := make(chan error)
+	go func() { errc <- s.CreateUser(&main.User{Username: "stuck"}) }()
+	<-started
+
+	var e *main.TimeoutError
+	if err := s.CreateUser(&main.User{Username: "susy"}); !errors.Is(err, main.ErrTimeout) {
+		t.Fatalf("unexpected error: %v", err)
+	} else if !errors.As(err, &e) {
+		t.Fatalf("unexpected error type: %T", err)
+	} else if e.HolderOp != "CreateUser" || e.HolderDuration < 50*time.Millisecond {
+		t.Fatalf("unexpected holder: %s %s", e.HolderOp, e.HolderDuration)
+	} else if !strings.HasSuffix(strings.Split(e.HolderCallSite, ":")[0], "timeout_test.go") {
+		t.Fatalf("unexpected call site: %s", e.HolderCallSite)
+	} else if main.HTTPStatus(err) != 503 {
+		t.Fatalf("unexpected status: %d", main.HTTPStatus(err))
+	}
+
+	// The stuck writer ran past the timeout so it is rolled back.
+	close(release)
+	if err := <-errc; !errors.Is(err, main.ErrTimeout) {
+		t.Fatalf("unexpected error: %v", err)
+	} else if a, err := s.Users(); err != nil {
+		t.Fatal(err)
+	} else if len(a) != 0 {
+		t.Fatalf("unexpected users: %d", len(a))
+	}
+
+	// Writes succeed once the lock is free.
+	if err := s.CreateUser(&main.User{Username: "susy"}); err != nil {
+		t.Fatal(err)
+	}
+}
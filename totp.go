@@ -0,0 +1,326 @@
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/benbjohnson/application-development-using-boltdb/internal"
+	"github.com/benbjohnson/application-development-using-boltdb/keys"
+	"github.com/gogo/protobuf/proto"
+)
+
+// TOTPPeriod is the duration that each TOTP code is valid for.
+const TOTPPeriod = 30 * time.Second
+
+// TOTP settings. Codes from one period before or after the current one are
+// accepted to allow for clock drift.
+const (
+	totpDigits        = 6
+	totpSkew          = 1
+	totpSecretSize    = 20
+	recoveryCodeCount = 10
+)
+
+// totpEncoding encodes secrets the way authenticator apps expect them.
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// totpRecord stores the two-factor settings of a user. The secret is
+// encrypted with the store's SecretKey and only hashes of the recovery
+// codes are kept.
+type totpRecord struct {
+	Secret        []byte
+	RecoveryCodes [][]byte
+	LastCounter   int64
+	CreatedAt     time.Time
+}
+
+// MarshalBinary encodes a record to binary format.
+func (r *totpRecord) MarshalBinary() ([]byte, error) {
+	return proto.Marshal(&internal.TOTP{
+		Secret:        r.Secret,
+		RecoveryCodes: r.RecoveryCodes,
+		LastCounter:   proto.Int64(r.LastCounter),
+		CreatedAt:     proto.Int64(encodeTime(r.CreatedAt)),
+	})
+}
+
+// UnmarshalBinary decodes a record from binary data.
+func (r *totpRecord) UnmarshalBinary(data []byte) error {
+	var pb internal.TOTP
+	if err := proto.Unmarshal(data, &pb); err != nil {
+		return err
+	}
+
+	r.Secret = pb.GetSecret()
+	r.RecoveryCodes = pb.GetRecoveryCodes()
+	r.LastCounter = pb.GetLastCounter()
+	r.CreatedAt = decodeTime(pb.GetCreatedAt())
+
+	return nil
+}
+
+// EnrollTOTP generates a new TOTP secret and recovery codes for a user.
+// Any previous enrollment is replaced. The secret is returned base32
+// encoded for authenticator apps. Neither the secret nor the recovery codes
+// can be retrieved again so they must be handed to the user immediately.
+func (s *Store) EnrollTOTP(userID int) (secret string, recoveryCodes []string, err error) {
+	if len(s.SecretKey) == 0 {
+		return "", nil, ErrSecretKeyRequired
+	}
+
+	// Generate the secret and the recovery codes.
+	buf := make([]byte, totpSecretSize)
+	if _, err := rand.Read(buf); err != nil {
+		return "", nil, err
+	}
+	r := &totpRecord{CreatedAt: time.Now().UTC()}
+	for i := 0; i < recoveryCodeCount; i++ {
+		code, err := generateRecoveryCode()
+		if err != nil {
+			return "", nil, err
+		}
+		recoveryCodes = append(recoveryCodes, code)
+		r.RecoveryCodes = append(r.RecoveryCodes, hashRecoveryCode(code))
+	}
+	if r.Secret, err = s.encryptSecret(buf); err != nil {
+		return "", nil, err
+	}
+
+	if err := s.update("EnrollTOTP", func(tx *Tx) error {
+		var u User
+		if err := loadUser(tx, userID, &u); err != nil {
+			return err
+		}
+		return saveTOTP(tx, userID, r)
+	}); err != nil {
+		return "", nil, err
+	}
+	return totpEncoding.EncodeToString(buf), recoveryCodes, nil
+}
+
+// TOTPEnabled returns true if a user has enrolled in two-factor
+// authentication.
+func (s *Store) TOTPEnabled(userID int) (bool, error) {
+	var enabled bool
+	if err := s.view("TOTPEnabled", func(tx *Tx) error {
+		enabled = tx.Bucket([]byte("TOTP")).Get(keys.Int(userID)) != nil
+		return nil
+	}); err != nil {
+		return false, err
+	}
+	return enabled, nil
+}
+
+// VerifyTOTP checks code against the user's TOTP secret. Each code is only
+// accepted once. Returns ErrTOTPInvalid if the code does not match and
+// ErrTOTPNotEnrolled if the user has not enrolled. Invalid codes count as
+// login failures of the user so guessing is stopped with ErrAccountLocked.
+func (s *Store) VerifyTOTP(userID int, code string) error {
+	if len(s.SecretKey) == 0 {
+		return ErrSecretKeyRequired
+	}
+	return s.verifySecondFactor("VerifyTOTP", userID, func(r *totpRecord, now time.Time) (bool, error) {
+		secret, err := s.decryptSecret(r.Secret)
+		if err != nil {
+			return false, err
+		}
+
+		// Search the periods around now, skipping codes already used.
+		counter := now.Unix() / int64(TOTPPeriod/time.Second)
+		for c := counter - totpSkew; c <= counter+totpSkew; c++ {
+			if c <= r.LastCounter {
+				continue
+			} else if subtle.ConstantTimeCompare([]byte(totpCode(secret, c)), []byte(code)) == 1 {
+				r.LastCounter = c
+				return true, nil
+			}
+		}
+		return false, nil
+	}, ErrTOTPInvalid)
+}
+
+// ConsumeRecoveryCode checks code against the user's unused recovery codes
+// and removes it on a match. Returns ErrRecoveryCodeInvalid if the code does
+// not match. Invalid codes count as login failures like VerifyTOTP.
+func (s *Store) ConsumeRecoveryCode(userID int, code string) error {
+	hash := hashRecoveryCode(code)
+	return s.verifySecondFactor("ConsumeRecoveryCode", userID, func(r *totpRecord, _ time.Time) (bool, error) {
+		for i, h := range r.RecoveryCodes {
+			if subtle.ConstantTimeCompare(h, hash) == 1 {
+				r.RecoveryCodes = append(r.RecoveryCodes[:i], r.RecoveryCodes[i+1:]...)
+				return true, nil
+			}
+		}
+		return false, nil
+	}, ErrRecoveryCodeInvalid)
+}
+
+// DisableTOTP removes the user's TOTP secret and recovery codes.
+func (s *Store) DisableTOTP(userID int) error {
+	return s.update("DisableTOTP", func(tx *Tx) error {
+		if tx.Bucket([]byte("TOTP")).Get(keys.Int(userID)) == nil {
+			return keyError("user", userID, ErrTOTPNotEnrolled)
+		}
+		return deleteTOTP(tx, userID)
+	})
+}
+
+// verifySecondFactor loads the user's record and calls fn to check a code.
+// A match saves the record as updated by fn. A mismatch records a login
+// failure and returns invalid once the transaction commits.
+func (s *Store) verifySecondFactor(op string, userID int, fn func(r *totpRecord, now time.Time) (bool, error), invalid error) error {
+	subject := userLoginSubject(userID)
+	now := time.Now()
+
+	var ok bool
+	if err := s.update(op, func(tx *Tx) error {
+		if s.maxLoginFailures() >= 0 {
+			if err := s.checkLoginLocked(tx, now, subject); err != nil {
+				return err
+			}
+		}
+
+		v := tx.Bucket([]byte("TOTP")).Get(keys.Int(userID))
+		if v == nil {
+			return keyError("user", userID, ErrTOTPNotEnrolled)
+		}
+		tx.recordRead("TOTP", v)
+
+		var r totpRecord
+		if err := r.UnmarshalBinary(v); err != nil {
+			return err
+		}
+
+		var err error
+		if ok, err = fn(&r, now); err != nil {
+			return err
+		} else if !ok {
+			if s.maxLoginFailures() < 0 {
+				return nil
+			}
+			return s.recordLoginFailure(tx, subject, now)
+		}
+		return saveTOTP(tx, userID, &r)
+	}); err != nil {
+		return err
+	} else if !ok {
+		return invalid
+	}
+	return nil
+}
+
+// saveTOTP writes the two-factor record of a user.
+func saveTOTP(tx *Tx, userID int, r *totpRecord) error {
+	buf, err := r.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	return putValue(tx, "TOTP", keys.Int(userID), buf)
+}
+
+// deleteTOTP removes the two-factor record of a user, if any.
+func deleteTOTP(tx *Tx, userID int) error {
+	return deleteValue(tx, "TOTP", keys.Int(userID))
+}
+
+// TOTPCode returns the code for a base32 encoded secret at time t.
+// Authenticator apps generate the same code.
+func TOTPCode(secret string, t time.Time) (string, error) {
+	buf, err := totpEncoding.DecodeString(strings.ToUpper(secret))
+	if err != nil {
+		return "", err
+	}
+	return totpCode(buf, t.Unix()/int64(TOTPPeriod/time.Second)), nil
+}
+
+// totpCode returns the code for secret and counter as defined by RFC 4226.
+func totpCode(secret []byte, counter int64) string {
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(counter))
+	h := hmac.New(sha1.New, secret)
+	h.Write(msg[:])
+	sum := h.Sum(nil)
+
+	// Dynamically truncate the digest to a 31-bit integer.
+	offset := sum[len(sum)-1] & 0x0F
+	v := binary.BigEndian.Uint32(sum[offset:]) & 0x7FFFFFFF
+	return fmt.Sprintf("%0*d", totpDigits, v%1000000)
+}
+
+// generateRecoveryCode returns a random recovery code such as "a1b2c-3d4e5".
+func generateRecoveryCode() (string, error) {
+	buf := make([]byte, 5)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	s := hex.EncodeToString(buf)
+	return s[:5] + "-" + s[5:], nil
+}
+
+// hashRecoveryCode returns the hash of a recovery code that is persisted.
+func hashRecoveryCode(code string) []byte {
+	h := sha256.Sum256([]byte(strings.ToLower(strings.TrimSpace(code))))
+	return h[:]
+}
+
+// encryptSecret encrypts plaintext with the store's SecretKey using AES-GCM.
+// The random nonce is prepended to the ciphertext.
+func (s *Store) encryptSecret(plaintext []byte) ([]byte, error) {
+	gcm, err := s.secretCipher()
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+// decryptSecret decrypts a value encrypted by encryptSecret.
+func (s *Store) decryptSecret(ciphertext []byte) ([]byte, error) {
+	gcm, err := s.secretCipher()
+	if err != nil {
+		return nil, err
+	} else if len(ciphertext) < gcm.NonceSize() {
+		return nil, ErrSecretDecrypt
+	}
+	nonce, ciphertext := ciphertext[:gcm.NonceSize()], ciphertext[gcm.NonceSize():]
+	plaintext, err := gcm.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return nil, ErrSecretDecrypt
+	}
+	return plaintext, nil
+}
+
+// secretCipher returns an AES-GCM cipher for the store's SecretKey.
+func (s *Store) secretCipher() (cipher.AEAD, error) {
+	if len(s.SecretKey) == 0 {
+		return nil, ErrSecretKeyRequired
+	}
+	block, err := aes.NewCipher(s.SecretKey)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// Two-factor related errors.
+var (
+	ErrSecretKeyRequired   = &Error{Code: EINTERNAL, Message: "secret key required"}
+	ErrSecretDecrypt       = &Error{Code: EINTERNAL, Message: "cannot decrypt secret"}
+	ErrTOTPNotEnrolled     = &Error{Code: ENOTFOUND, Message: "totp not enrolled"}
+	ErrTOTPInvalid         = &Error{Code: EUNAUTHORIZED, Message: "invalid totp code"}
+	ErrRecoveryCodeInvalid = &Error{Code: EUNAUTHORIZED, Message: "invalid recovery code"}
+)
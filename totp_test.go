@@ -0,0 +1,161 @@
+package main_test
+
+import (
+	"bytes"
+	"encoding/base32"
+	"errors"
+	"testing"
+	"time"
+
+	main "github.com/benbjohnson/application-development-using-boltdb"
+	"github.com/benbjohnson/application-development-using-boltdb/keys"
+)
+
+// Ensure codes match the test vectors of RFC 6238.
+func TestTOTPCode(t *testing.T) {
+	const secret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ" // "12345678901234567890"
+	for _, tt := range []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{2000000000, "279037"},
+	} {
+		if code, err := main.TOTPCode(secret, time.Unix(tt.unix, 0)); err != nil {
+			t.Fatal(err)
+		} else if code != tt.code {
+			t.Fatalf("%d: unexpected code: %s", tt.unix, code)
+		}
+	}
+}
+
+// Ensure a user can enroll and verify TOTP codes.
+func TestStore_VerifyTOTP(t *testing.T) {
+	s := NewStore()
+	s.SecretKey = bytes.Repeat([]byte("k"), 32)
+	if err := s.Open(); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	if err := s.CreateUser(&main.User{Username: "susy"}); err != nil {
+		t.Fatal(err)
+	}
+
+	secret, recoveryCodes, err := s.EnrollTOTP(1)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(recoveryCodes) != 10 {
+		t.Fatalf("unexpected recovery codes: %v", recoveryCodes)
+	} else if ok, err := s.TOTPEnabled(1); err != nil || !ok {
+		t.Fatalf("unexpected enabled: %v, %v", ok, err)
+	}
+
+	// The current code is accepted only once.
+	code, err := main.TOTPCode(secret, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	} else if err := s.VerifyTOTP(1, code); err != nil {
+		t.Fatal(err)
+	} else if err := s.VerifyTOTP(1, code); !errors.Is(err, main.ErrTOTPInvalid) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// A stale code is rejected.
+	if code, err := main.TOTPCode(secret, time.Now().Add(-5*time.Minute)); err != nil {
+		t.Fatal(err)
+	} else if err := s.VerifyTOTP(1, code); !errors.Is(err, main.ErrTOTPInvalid) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// The secret is encrypted at rest.
+	raw, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(secret)
+	if err != nil {
+		t.Fatal(err)
+	} else if v := rawValue(t, s, "TOTP", keys.Int(1)); v == nil {
+		t.Fatal("expected totp record")
+	} else if bytes.Contains(v, raw) {
+		t.Fatal("secret stored in plaintext")
+	}
+}
+
+// Ensure each recovery code can only be used once.
+func TestStore_ConsumeRecoveryCode(t *testing.T) {
+	s := NewStore()
+	s.SecretKey = bytes.Repeat([]byte("k"), 16)
+	if err := s.Open(); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	if err := s.CreateUser(&main.User{Username: "susy"}); err != nil {
+		t.Fatal(err)
+	}
+	_, recoveryCodes, err := s.EnrollTOTP(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.ConsumeRecoveryCode(1, recoveryCodes[3]); err != nil {
+		t.Fatal(err)
+	} else if err := s.ConsumeRecoveryCode(1, recoveryCodes[3]); !errors.Is(err, main.ErrRecoveryCodeInvalid) {
+		t.Fatalf("unexpected error: %v", err)
+	} else if err := s.ConsumeRecoveryCode(1, recoveryCodes[4]); err != nil {
+		t.Fatal(err)
+	}
+
+	// Disabling removes the enrollment.
+	if err := s.DisableTOTP(1); err != nil {
+		t.Fatal(err)
+	} else if err := s.ConsumeRecoveryCode(1, recoveryCodes[5]); !errors.Is(err, main.ErrTOTPNotEnrolled) {
+		t.Fatalf("unexpected error: %v", err)
+	} else if ok, err := s.TOTPEnabled(1); err != nil || ok {
+		t.Fatalf("unexpected enabled: %v, %v", ok, err)
+	}
+}
+
+// Ensure repeated invalid codes lock the user out.
+func TestStore_VerifyTOTP_ErrAccountLocked(t *testing.T) {
+	s := NewStore()
+	s.SecretKey = bytes.Repeat([]byte("k"), 32)
+	s.MaxLoginFailures = 2
+	if err := s.Open(); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	if err := s.CreateUser(&main.User{Username: "susy"}); err != nil {
+		t.Fatal(err)
+	} else if _, _, err := s.EnrollTOTP(1); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := s.ConsumeRecoveryCode(1, "bad"); !errors.Is(err, main.ErrRecoveryCodeInvalid) {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if err := s.VerifyTOTP(1, "000000"); !errors.Is(err, main.ErrAccountLocked) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+// Ensure enrollment requires a secret key and an existing user.
+func TestStore_EnrollTOTP_Err(t *testing.T) {
+	s := OpenStore()
+	defer s.Close()
+	if _, _, err := s.EnrollTOTP(1); !errors.Is(err, main.ErrSecretKeyRequired) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	s2 := NewStore()
+	s2.SecretKey = bytes.Repeat([]byte("k"), 32)
+	if err := s2.Open(); err != nil {
+		t.Fatal(err)
+	}
+	defer s2.Close()
+	if _, _, err := s2.EnrollTOTP(1); !errors.Is(err, main.ErrUserNotFound) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"bytes"
+	"time"
+
+	"github.com/benbjohnson/application-development-using-boltdb/keys"
+)
+
+// DefaultReapInterval is the default time between removals of expired keys.
+const DefaultReapInterval = 1 * time.Minute
+
+// reapBatchSize is the number of expired keys removed per transaction.
+const reapBatchSize = 1000
+
+// The "Expirations" bucket orders keys by expiration time. Each entry is
+// keyed by the expiration time, the bucket name, and the key itself.
+//
+// The "ExpirationKeys" bucket maps a bucket name and key back to its
+// expiration time so the previous entry can be removed when a key is
+// overwritten or deleted.
+
+// putWithTTL writes value to key in the named bucket and schedules the key
+// to be removed by the reaper once expiresAt has passed.
+func putWithTTL(tx *Tx, name string, key, value []byte, expiresAt time.Time) error {
+	if err := unscheduleExpiration(tx, name, key); err != nil {
+		return err
+	} else if err := putValue(tx, name, key, value); err != nil {
+		return err
+	}
+
+	tx.recordWrite("Expirations", nil)
+	if err := tx.Bucket([]byte("Expirations")).Put(expirationKey(expiresAt, name, key), nil); err != nil {
+		return err
+	}
+	tx.recordWrite("ExpirationKeys", nil)
+	return tx.Bucket([]byte("ExpirationKeys")).Put(keys.Join(keys.String(name), key), keys.Time(expiresAt))
+}
+
+// deleteWithTTL removes a key written by putWithTTL along with its
+// expiration entries.
+func deleteWithTTL(tx *Tx, name string, key []byte) error {
+	if err := unscheduleExpiration(tx, name, key); err != nil {
+		return err
+	}
+	return deleteValue(tx, name, key)
+}
+
+// deletePrefix removes every key in the named bucket that starts with prefix
+// and returns the number removed. Keys are removed the same way as
+// deleteWithTTL so indexes, views, chunks, and expirations are kept in sync.
+func deletePrefix(tx *Tx, name string, prefix []byte) (int, error) {
+	// Seek again after each delete since the cursor cannot be trusted once
+	// the bucket has been modified.
+	var n int
+	c := tx.Bucket([]byte(name)).Cursor()
+	for k, _ := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, _ = c.Seek(prefix) {
+		if err := deleteWithTTL(tx, name, append([]byte{}, k...)); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, nil
+}
+
+// unscheduleExpiration removes the expiration entries for a key, if any.
+func unscheduleExpiration(tx *Tx, name string, key []byte) error {
+	bkt := tx.Bucket([]byte("ExpirationKeys"))
+	rkey := keys.Join(keys.String(name), key)
+	v := bkt.Get(rkey)
+	if v == nil {
+		return nil
+	}
+	tx.recordRead("ExpirationKeys", v)
+
+	r := keys.NewReader(v)
+	expiresAt := r.ReadTime()
+	if err := r.Err(); err != nil {
+		return err
+	}
+
+	tx.recordDelete("Expirations")
+	if err := tx.Bucket([]byte("Expirations")).Delete(expirationKey(expiresAt, name, key)); err != nil {
+		return err
+	}
+	tx.recordDelete("ExpirationKeys")
+	return bkt.Delete(rkey)
+}
+
+// ReapExpired removes all keys whose expiration time has passed and returns
+// the number of keys removed. Keys are removed in batches across multiple
+// transactions so writers are not blocked for long.
+func (s *Store) ReapExpired() (int, error) {
+	var total int
+	for {
+		n, err := s.reapExpiredBatch(time.Now())
+		total += n
+		if err != nil {
+			return total, err
+		} else if n < reapBatchSize {
+			return total, nil
+		}
+	}
+}
+
+// reapExpiredBatch removes up to reapBatchSize keys that expired before now.
+func (s *Store) reapExpiredBatch(now time.Time) (int, error) {
+	var n int
+	err := s.update("ReapExpired", func(tx *Tx) error {
+		// Collect expired entries first since the buckets cannot be
+		// modified while iterating.
+		type entry struct {
+			name string
+			key  []byte
+		}
+		var expired []entry
+
+		c := tx.Bucket([]byte("Expirations")).Cursor()
+		for k, _ := c.First(); k != nil && len(expired) < reapBatchSize; k, _ = c.Next() {
+			tx.recordRead("Expirations", nil)
+
+			r := keys.NewReader(k)
+			expiresAt := r.ReadTime()
+			name := r.ReadString()
+			if err := r.Err(); err != nil {
+				return err
+			} else if expiresAt.After(now) {
+				break
+			}
+			expired = append(expired, entry{name: name, key: append([]byte{}, r.Remaining()...)})
+		}
+
+		for _, e := range expired {
+			if err := deleteWithTTL(tx, e.name, e.key); err != nil {
+				return err
+			}
+		}
+		n = len(expired)
+		return nil
+	})
+	return n, err
+}
+
+// monitorExpirations periodically removes expired keys until the store is
+// closed.
+func (s *Store) monitorExpirations() {
+	ticker := time.NewTicker(s.reapInterval())
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.closing:
+			return
+		case <-ticker.C:
+			s.reapAll()
+		}
+	}
+}
+
+// reapAll removes expired keys from the store and from every tenant.
+func (s *Store) reapAll() {
+	if s.Frozen() {
+		return
+	}
+
+	if n, err := s.ReapExpired(); err != nil {
+		s.logger().Error("reap failed", "err", err)
+	} else if n > 0 {
+		s.logger().Debug("expired keys removed", "n", n)
+	}
+
+	tenants, err := s.Tenants()
+	if err != nil {
+		s.logger().Error("reap failed", "err", err)
+		return
+	}
+	for _, name := range tenants {
+		if n, err := s.Tenant(name).ReapExpired(); err != nil {
+			s.logger().Error("reap failed", "tenant", name, "err", err)
+		} else if n > 0 {
+			s.logger().Debug("expired keys removed", "tenant", name, "n", n)
+		}
+	}
+}
+
+// reapInterval returns the configured interval or the default, if unset.
+func (s *Store) reapInterval() time.Duration {
+	if s.ReapInterval == 0 {
+		return DefaultReapInterval
+	}
+	return s.ReapInterval
+}
+
+// expirationKey returns the key of an entry in the Expirations bucket.
+func expirationKey(expiresAt time.Time, name string, key []byte) []byte {
+	return keys.Join(keys.Time(expiresAt), keys.String(name), key)
+}
@@ -0,0 +1,103 @@
+package main_test
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	main "github.com/benbjohnson/application-development-using-boltdb"
+)
+
+// Ensure expired keys are removed and unexpired keys are kept.
+func TestStore_ReapExpired(t *testing.T) {
+	s := OpenStore()
+	defer s.Close()
+
+	// Create one key that expires immediately and one that does not.
+	s.IdempotencyTTL = time.Nanosecond
+	if err := s.CreateUserIdempotent("a", &main.User{Username: "susy"}); err != nil {
+		t.Fatal(err)
+	}
+	s.IdempotencyTTL = time.Hour
+	if err := s.CreateUserIdempotent("b", &main.User{Username: "john"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if n, err := s.ReapExpired(); err != nil {
+		t.Fatal(err)
+	} else if n != 1 {
+		t.Fatalf("unexpected reaped count: %d", n)
+	} else if n, err := s.ReapExpired(); err != nil {
+		t.Fatal(err)
+	} else if n != 0 {
+		t.Fatalf("unexpected reaped count: %d", n)
+	}
+
+	// The unexpired key still returns the original user.
+	u := &main.User{Username: "jane"}
+	if err := s.CreateUserIdempotent("b", u); err != nil {
+		t.Fatal(err)
+	} else if u.ID != 2 {
+		t.Fatalf("unexpected user: %#v", u)
+	}
+}
+
+// Ensure overwriting a key replaces its previous expiration.
+func TestStore_ReapExpired_Overwrite(t *testing.T) {
+	s := OpenStore()
+	defer s.Close()
+
+	// Let the key expire and then reuse it with a longer TTL.
+	s.IdempotencyTTL = time.Nanosecond
+	if err := s.CreateUserIdempotent("a", &main.User{Username: "susy"}); err != nil {
+		t.Fatal(err)
+	}
+	s.IdempotencyTTL = time.Hour
+	if err := s.CreateUserIdempotent("a", &main.User{Username: "john"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// The original expiration must not remove the new record.
+	if n, err := s.ReapExpired(); err != nil {
+		t.Fatal(err)
+	} else if n != 0 {
+		t.Fatalf("unexpected reaped count: %d", n)
+	}
+
+	u := &main.User{Username: "jane"}
+	if err := s.CreateUserIdempotent("a", u); err != nil {
+		t.Fatal(err)
+	} else if u.ID != 2 {
+		t.Fatalf("unexpected user: %#v", u)
+	}
+}
+
+// Ensure expired keys are removed in the background.
+func TestStore_ReapInterval(t *testing.T) {
+	s := NewStore()
+	defer s.Close()
+
+	var reaps int64
+	s.ReapInterval = 10 * time.Millisecond
+	s.IdempotencyTTL = time.Nanosecond
+	s.Metrics = metricsFunc(func(op string, writable bool, d time.Duration, err error) {
+		if op == "ReapExpired" {
+			atomic.AddInt64(&reaps, 1)
+		}
+	})
+	if err := s.Open(); err != nil {
+		t.Fatal(err)
+	} else if err := s.CreateUserIdempotent("a", &main.User{Username: "susy"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Wait for a reap that started after the key was created.
+	start := atomic.LoadInt64(&reaps)
+	waitFor(t, func() bool { return atomic.LoadInt64(&reaps) > start+1 })
+
+	if n, err := s.ReapExpired(); err != nil {
+		t.Fatal(err)
+	} else if n != 0 {
+		t.Fatalf("unexpected reaped count: %d", n)
+	}
+}
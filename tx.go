@@ -0,0 +1,370 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Tx represents a transaction on the store.
+//
+// It wraps a bolt transaction so that every transaction started by the
+// store can be timed, traced, and logged when it finishes.
+type Tx struct {
+	*bolt.Tx
+
+	// Bucket of the tenant that the transaction is scoped to, if any.
+	root *bolt.Bucket
+
+	store *Store
+	op    string
+	start time.Time
+	span  trace.Span
+	err   error
+	done  bool
+
+	// Stack of the caller that began the transaction, if captured.
+	pcs []uintptr
+
+	// Users written by the transaction, applied to the user cache on commit.
+	userWrites map[int]*User
+
+	// Buckets accessed and data transferred during the transaction.
+	buckets      []string
+	keysRead     int
+	bytesRead    int
+	keysWritten  int
+	bytesWritten int
+}
+
+// Commit writes all changes to disk.
+//
+// Commit fails with a *TimeoutError if the transaction began more than the
+// store's WriteTimeout ago and with a *QuotaError if the data written would
+// grow the data file beyond the store's MaxFileSize. Transactions of a dry
+// run store are rolled back instead once these checks pass.
+func (tx *Tx) Commit() error {
+	if err := checkWriteTimeout(tx); err != nil {
+		tx.err = err
+		tx.Rollback()
+		return err
+	} else if err := checkFileSize(tx); err != nil {
+		tx.err = err
+		tx.Rollback()
+		return err
+	} else if tx.store.dryRun {
+		return tx.Rollback()
+	}
+
+	err := tx.Tx.Commit()
+	if err == nil {
+		tx.applyUserWrites()
+	}
+	tx.finish(err)
+	return err
+}
+
+// Rollback closes the transaction and ignores all previous updates.
+// Rolling back a transaction that has already finished is a no-op.
+func (tx *Tx) Rollback() error {
+	if tx.done {
+		return nil
+	}
+	err := tx.Tx.Rollback()
+	tx.finish(nil)
+	return err
+}
+
+// Bucket retrieves a bucket by name from the transaction's tenant or from
+// the top level if the transaction is not scoped to a tenant. Top-level
+// names are prefixed with the store's BucketPrefix.
+func (tx *Tx) Bucket(name []byte) *bolt.Bucket {
+	if tx.root != nil {
+		return tx.root.Bucket(name)
+	}
+	return tx.Tx.Bucket(tx.store.bucketName(name))
+}
+
+// CreateBucket creates a bucket in the transaction's tenant or top level.
+func (tx *Tx) CreateBucket(name []byte) (*bolt.Bucket, error) {
+	if tx.root != nil {
+		return tx.root.CreateBucket(name)
+	}
+	return tx.Tx.CreateBucket(tx.store.bucketName(name))
+}
+
+// CreateBucketIfNotExists creates a bucket in the transaction's tenant or
+// top level if it does not already exist.
+func (tx *Tx) CreateBucketIfNotExists(name []byte) (*bolt.Bucket, error) {
+	if tx.root != nil {
+		return tx.root.CreateBucketIfNotExists(name)
+	}
+	return tx.Tx.CreateBucketIfNotExists(tx.store.bucketName(name))
+}
+
+// DeleteBucket deletes a bucket from the transaction's tenant or top level.
+func (tx *Tx) DeleteBucket(name []byte) error {
+	if tx.root != nil {
+		return tx.root.DeleteBucket(name)
+	}
+	return tx.Tx.DeleteBucket(tx.store.bucketName(name))
+}
+
+// topBucket retrieves a top-level bucket by name even if the transaction is
+// scoped to a tenant.
+func (tx *Tx) topBucket(name string) *bolt.Bucket {
+	return tx.Tx.Bucket(tx.store.bucketName([]byte(name)))
+}
+
+// forEachTopBucket calls fn for each top-level bucket that belongs to the
+// store's prefix, passing the name without the prefix.
+func (tx *Tx) forEachTopBucket(fn func(name []byte, b *bolt.Bucket) error) error {
+	return tx.Tx.ForEach(func(name []byte, b *bolt.Bucket) error {
+		if name, ok := tx.store.ownBucketName(name); ok {
+			return fn(name, b)
+		}
+		return nil
+	})
+}
+
+// recordRead records that value v was read from bucket.
+func (tx *Tx) recordRead(bucket string, v []byte) {
+	tx.touch(bucket)
+	tx.keysRead++
+	tx.bytesRead += len(v)
+
+	c := tx.store.ops.counters(bucket)
+	c.gets.Add(1)
+	c.bytesRead.Add(int64(len(v)))
+}
+
+// recordWrite records that value v was written to bucket.
+func (tx *Tx) recordWrite(bucket string, v []byte) {
+	tx.touch(bucket)
+	tx.keysWritten++
+	tx.bytesWritten += len(v)
+
+	c := tx.store.ops.counters(bucket)
+	c.puts.Add(1)
+	c.bytesWritten.Add(int64(len(v)))
+}
+
+// recordDelete records that a key was deleted from bucket.
+func (tx *Tx) recordDelete(bucket string) {
+	tx.touch(bucket)
+	tx.keysWritten++
+
+	tx.store.ops.counters(bucket).deletes.Add(1)
+}
+
+// touch adds bucket to the list of buckets accessed by the transaction.
+func (tx *Tx) touch(bucket string) {
+	for _, name := range tx.buckets {
+		if name == bucket {
+			return
+		}
+	}
+	tx.buckets = append(tx.buckets, bucket)
+}
+
+// finish records the completion of the transaction.
+func (tx *Tx) finish(err error) {
+	if tx.done {
+		return
+	}
+	tx.done = true
+	tx.store.db.txs.remove(tx)
+	defer tx.store.db.mu.RUnlock()
+	if tx.Writable() {
+		defer tx.store.db.writer.release()
+	}
+	if tx.Writable() && tx.store.CacheUsers {
+		defer tx.store.db.usersMu.Unlock()
+	}
+
+	logger, d := tx.store.logger(), time.Since(tx.start)
+	if err != nil {
+		logger.Error("transaction failed", "op", tx.op, "writable", tx.Writable(), "duration", d, "err", err)
+	} else if threshold := tx.store.SlowTxThreshold; threshold > 0 && d >= threshold {
+		callSite, stack := formatCallers(tx.pcs)
+		logger.Warn("slow transaction", "op", tx.op, "writable", tx.Writable(), "duration", d, "caller", callSite, "stack", stack)
+		if tx.store.slow != nil {
+			tx.store.slow.add(SlowOp{
+				Op:       tx.op,
+				Writable: tx.Writable(),
+				Duration: d,
+				Start:    tx.start,
+				CallSite: callSite,
+				Stack:    stack,
+			}, tx.store.slowOpsLimit())
+		}
+	}
+
+	// Annotate and end the span for the transaction.
+	tx.span.SetAttributes(
+		attribute.StringSlice("bolt.buckets", tx.buckets),
+		attribute.Int("bolt.keys_read", tx.keysRead),
+		attribute.Int("bolt.bytes_read", tx.bytesRead),
+		attribute.Int("bolt.keys_written", tx.keysWritten),
+		attribute.Int("bolt.bytes_written", tx.bytesWritten),
+	)
+	if err == nil {
+		err = tx.err
+	}
+	if err != nil {
+		tx.span.RecordError(err)
+		tx.span.SetStatus(codes.Error, err.Error())
+	}
+	tx.span.End()
+
+	if m := tx.store.Metrics; m != nil {
+		m.ObserveTx(tx.op, tx.Writable(), d, err)
+	}
+}
+
+// begin starts a new transaction for the operation named op.
+func (s *Store) begin(op string, writable bool) (*Tx, error) {
+	start := time.Now()
+	_, span := s.tracer().Start(context.Background(), "Store."+op,
+		trace.WithSpanKind(trace.SpanKindInternal),
+		trace.WithAttributes(
+			attribute.String("db.system", "boltdb"),
+			attribute.String("db.operation", op),
+			attribute.Bool("bolt.writable", writable),
+		),
+	)
+
+	if err := s.rlock(); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		span.End()
+		return nil, err
+	}
+	if writable {
+		err := s.db.writer.acquire(op, s.WriteTimeout)
+		if err == nil && s.db.frozen.Load() {
+			s.db.writer.release()
+			err = ErrMaintenance
+		}
+		if err != nil {
+			s.db.mu.RUnlock()
+			s.logger().Error("begin transaction failed", "op", op, "writable", writable, "err", err)
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+			span.End()
+			return nil, err
+		}
+	}
+	if writable && s.CacheUsers {
+		s.db.usersMu.Lock()
+	}
+	btx, err := s.db.Begin(writable)
+	if err != nil {
+		if writable && s.CacheUsers {
+			s.db.usersMu.Unlock()
+		}
+		if writable {
+			s.db.writer.release()
+		}
+		s.db.mu.RUnlock()
+		s.logger().Error("begin transaction failed", "op", op, "writable", writable, "err", err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		span.End()
+		return nil, err
+	}
+	tx := &Tx{Tx: btx, store: s, op: op, start: start, span: span}
+
+	// Capture the stack so slow or leaked transactions can be traced to
+	// their caller.
+	if s.SlowTxThreshold > 0 || s.detectTxLeaks() || (writable && s.WriteTimeout > 0) {
+		tx.pcs = callers()
+	}
+	if s.detectTxLeaks() {
+		s.db.txs.add(tx, tx.pcs)
+	}
+	if writable {
+		s.db.writer.holder.Store(tx)
+	}
+
+	// Scope the transaction to the store's tenant.
+	if s.tenant != "" {
+		span.SetAttributes(attribute.String("tenant", s.tenant))
+		if tx.root = tenantBucket(tx, s.tenant); tx.root == nil {
+			err := keyError("tenant", s.tenant, ErrTenantNotFound)
+			tx.err = err
+			tx.Rollback()
+			return nil, err
+		}
+	}
+	return tx, nil
+}
+
+// view executes fn within a read-only transaction. A panic within fn is
+// returned as a *PanicError.
+func (s *Store) view(op string, fn func(tx *Tx) error) error {
+	tx, err := s.begin(op, false)
+	if err != nil {
+		return wrapError(op, err)
+	}
+	defer tx.Rollback()
+
+	if err := tx.call(fn); err != nil {
+		tx.err = err
+		return wrapError(op, err)
+	}
+	return nil
+}
+
+// update executes fn within a writable transaction.
+// The transaction is committed if fn returns nil and rolled back if it
+// returns an error or panics. Transactions that fail with a transient error
+// are retried with a new transaction so fn may be called more than once.
+func (s *Store) update(op string, fn func(tx *Tx) error) error {
+	return s.withRetry(op, func() error { return s.updateOnce(op, fn) })
+}
+
+// updateOnce executes fn within a single writable transaction.
+func (s *Store) updateOnce(op string, fn func(tx *Tx) error) error {
+	tx, err := s.begin(op, true)
+	if err != nil {
+		return wrapError(op, err)
+	}
+	defer tx.Rollback()
+
+	if err := tx.call(fn); err != nil {
+		tx.err = err
+		return wrapError(op, err)
+	}
+	return wrapError(op, tx.Commit())
+}
+
+// logger returns the store's logger or a logger that discards all output.
+func (s *Store) logger() *slog.Logger {
+	if s.Logger == nil {
+		return slog.New(slog.DiscardHandler)
+	}
+	return s.Logger
+}
+
+// tracer returns a tracer from the store's provider or the global provider.
+func (s *Store) tracer() trace.Tracer {
+	tp := s.TracerProvider
+	if tp == nil {
+		tp = otel.GetTracerProvider()
+	}
+	return tp.Tracer("github.com/benbjohnson/application-development-using-boltdb")
+}
+
+// MetricsRecorder records measurements of store operations.
+type MetricsRecorder interface {
+	// ObserveTx records the duration and result of the transaction
+	// executed for op. The error is nil if the operation succeeded.
+	ObserveTx(op string, writable bool, d time.Duration, err error)
+}
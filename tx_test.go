@@ -0,0 +1,127 @@
+package main_test
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log/slog"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	main "github.com/benbjohnson/application-development-using-boltdb"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// Ensure the store logs when it is opened.
+func TestStore_Logger_Open(t *testing.T) {
+	var buf bytes.Buffer
+	s := NewStore()
+	s.Logger = slog.New(slog.NewTextHandler(&buf, nil))
+	if err := s.Open(); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	if !strings.Contains(buf.String(), `msg="store opened"`) {
+		t.Fatalf("unexpected log output: %s", buf.String())
+	}
+}
+
+// Ensure transactions exceeding the slow threshold are logged.
+func TestStore_Logger_SlowTx(t *testing.T) {
+	var buf bytes.Buffer
+	s := OpenStore()
+	defer s.Close()
+	s.Logger = slog.New(slog.NewTextHandler(&buf, nil))
+
+	// Nothing should be logged while the threshold is disabled.
+	if err := s.CreateUser(&main.User{Username: "susy"}); err != nil {
+		t.Fatal(err)
+	} else if buf.Len() != 0 {
+		t.Fatalf("unexpected log output: %s", buf.String())
+	}
+
+	// Every transaction is slow with a tiny threshold.
+	s.SlowTxThreshold = time.Nanosecond
+	if _, err := s.User(1); err != nil {
+		t.Fatal(err)
+	} else if out := buf.String(); !strings.Contains(out, `msg="slow transaction" op=User writable=false`) {
+		t.Fatalf("unexpected log output: %s", out)
+	}
+}
+
+// Ensure store operations are traced with the injected provider.
+func TestStore_TracerProvider(t *testing.T) {
+	sr := tracetest.NewSpanRecorder()
+	s := OpenStore()
+	defer s.Close()
+	s.TracerProvider = sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr))
+
+	if err := s.CreateUser(&main.User{Username: "susy"}); err != nil {
+		t.Fatal(err)
+	} else if err := s.SetUsername(2, "john"); !errors.Is(err, main.ErrUserNotFound) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	spans := sr.Ended()
+	if len(spans) != 2 {
+		t.Fatalf("unexpected span count: %d", len(spans))
+	}
+
+	// Verify the create span is annotated with the data it wrote: the user
+	// and its username index entry.
+	if span := spans[0]; span.Name() != "Store.CreateUser" {
+		t.Fatalf("unexpected span name: %s", span.Name())
+	} else if attrs := attribute.NewSet(span.Attributes()...); attrs.Len() == 0 {
+		t.Fatal("expected attributes")
+	} else if v, _ := attrs.Value("bolt.keys_written"); v.AsInt64() != 2 {
+		t.Fatalf("unexpected keys written: %v", v.AsInt64())
+	} else if v, _ := attrs.Value("db.operation"); v.AsString() != "CreateUser" {
+		t.Fatalf("unexpected operation: %v", v.AsString())
+	}
+
+	// Verify the failed update records an error status.
+	if span := spans[1]; span.Name() != "Store.SetUsername" {
+		t.Fatalf("unexpected span name: %s", span.Name())
+	} else if span.Status().Code != codes.Error {
+		t.Fatalf("unexpected status: %v", span.Status())
+	}
+}
+
+// Ensure store operations are reported to the metrics recorder.
+func TestStore_Metrics(t *testing.T) {
+	var ops []string
+	s := OpenStore()
+	defer s.Close()
+	s.Metrics = metricsFunc(func(op string, writable bool, d time.Duration, err error) {
+		ops = append(ops, fmt.Sprintf("%s/%v/%v", op, writable, err))
+	})
+
+	if err := s.CreateUser(&main.User{Username: "susy"}); err != nil {
+		t.Fatal(err)
+	} else if _, err := s.User(1); err != nil {
+		t.Fatal(err)
+	} else if err := s.SetUsername(2, "john"); !errors.Is(err, main.ErrUserNotFound) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !reflect.DeepEqual(ops, []string{
+		"CreateUser/true/<nil>",
+		"User/false/<nil>",
+		"SetUsername/true/user 2: user not found",
+	}) {
+		t.Fatalf("unexpected ops: %v", ops)
+	}
+}
+
+// metricsFunc implements main.MetricsRecorder with a function.
+type metricsFunc func(op string, writable bool, d time.Duration, err error)
+
+func (fn metricsFunc) ObserveTx(op string, writable bool, d time.Duration, err error) {
+	fn(op, writable, d, err)
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"maps"
+	"slices"
+
+	"github.com/benbjohnson/application-development-using-boltdb/keys"
+)
+
+// userCache is an immutable copy of the Users bucket. Every commit that
+// changes a user replaces the cache of its database with a new copy.
+type userCache struct {
+	byID   map[int]*User
+	byName map[string]*User // user with the lowest ID for each username
+	users  []*User          // ordered by ID
+}
+
+// newUserCache returns a cache of the users in byID.
+func newUserCache(byID map[int]*User) *userCache {
+	c := &userCache{byID: byID, byName: make(map[string]*User, len(byID))}
+	c.users = slices.SortedFunc(maps.Values(byID), func(a, b *User) int { return a.ID - b.ID })
+	for i := len(c.users) - 1; i >= 0; i-- {
+		c.byName[c.users[i].Username] = c.users[i]
+	}
+	return c
+}
+
+// apply returns a copy of the cache with writes applied. A nil user
+// indicates that the user was deleted.
+func (c *userCache) apply(writes map[int]*User) *userCache {
+	byID := maps.Clone(c.byID)
+	for id, u := range writes {
+		if u == nil {
+			delete(byID, id)
+		} else {
+			byID[id] = u
+		}
+	}
+	return newUserCache(byID)
+}
+
+// copyUser returns a copy of a cached user so callers cannot modify the
+// cache.
+func copyUser(u *User) *User {
+	if u == nil {
+		return nil
+	}
+	other := *u
+	other.Tags = slices.Clone(u.Tags)
+	return &other
+}
+
+// userCache returns the cache of the store's users or nil if users are not
+// cached. Tenants are never cached.
+func (s *Store) userCache() *userCache {
+	if !s.CacheUsers || s.tenant != "" || s.db == nil {
+		return nil
+	}
+	return s.db.users.Load()
+}
+
+// loadUserCache reads every user into the cache of the store's database.
+func (s *Store) loadUserCache() error {
+	byID := make(map[int]*User)
+	if err := s.view("LoadUserCache", func(tx *Tx) error {
+		return scanUsers(tx, false, func(u *User) {
+			byID[u.ID] = u
+		})
+	}); err != nil {
+		return err
+	}
+	s.db.users.Store(newUserCache(byID))
+	return nil
+}
+
+// cacheUserWrite records that v was written to key in the Users bucket so
+// the cache can be updated once the transaction commits. A nil v records a
+// delete.
+func (tx *Tx) cacheUserWrite(key, v []byte) error {
+	if !tx.store.CacheUsers || tx.root != nil {
+		return nil
+	}
+
+	var u *User
+	if v != nil {
+		buf, err := decompress(v)
+		if err != nil {
+			return err
+		}
+		u = &User{}
+		if err := u.UnmarshalBinary(buf); err != nil {
+			return err
+		}
+	}
+
+	if tx.userWrites == nil {
+		tx.userWrites = make(map[int]*User)
+	}
+	tx.userWrites[keys.ParseInt(key)] = u
+	return nil
+}
+
+// applyUserWrites updates the cache with the users written by a committed
+// transaction. Writers hold usersMu from begin to finish so writes are
+// applied in commit order.
+func (tx *Tx) applyUserWrites() {
+	if len(tx.userWrites) == 0 {
+		return
+	} else if c := tx.store.db.users.Load(); c != nil {
+		tx.store.db.users.Store(c.apply(tx.userWrites))
+	}
+}
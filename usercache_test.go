@@ -0,0 +1,86 @@
+package main_test
+
+import (
+	"errors"
+	"testing"
+
+	main "github.com/benbjohnson/application-development-using-boltdb"
+)
+
+// Ensure cached users are loaded on open and kept in sync with writes.
+func TestStore_CacheUsers(t *testing.T) {
+	s := OpenStore()
+	defer s.Close()
+	if err := s.CreateUser(&main.User{Username: "susy"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Reopen with caching so the existing user is loaded.
+	s.CacheUsers = true
+	if err := s.Reopen(); err != nil {
+		t.Fatal(err)
+	} else if u, err := s.User(1); err != nil {
+		t.Fatal(err)
+	} else if u == nil || u.Username != "susy" {
+		t.Fatalf("unexpected user: %#v", u)
+	}
+
+	// Writes are visible once committed.
+	if err := s.CreateUser(&main.User{Username: "jimbo"}); err != nil {
+		t.Fatal(err)
+	} else if err := s.SetUsername(1, "susan"); err != nil {
+		t.Fatal(err)
+	} else if err := s.AddTag(2, "beta"); err != nil {
+		t.Fatal(err)
+	}
+	if u, err := s.UserByName("SUSAN"); err != nil {
+		t.Fatal(err)
+	} else if u == nil || u.ID != 1 {
+		t.Fatalf("unexpected user: %#v", u)
+	} else if u, err := s.UserByName("susy"); err != nil {
+		t.Fatal(err)
+	} else if u != nil {
+		t.Fatalf("unexpected user: %#v", u)
+	} else if a, err := s.Users(); err != nil {
+		t.Fatal(err)
+	} else if len(a) != 2 || a[0].Username != "susan" || a[1].Username != "jimbo" || len(a[1].Tags) != 1 {
+		t.Fatalf("unexpected users: %#v", a)
+	}
+
+	// Callers cannot modify the cache.
+	u, err := s.User(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u.Username = "changed"
+	if u, err := s.User(1); err != nil {
+		t.Fatal(err)
+	} else if u.Username != "susan" {
+		t.Fatalf("unexpected username: %s", u.Username)
+	}
+
+	// Writes that are rolled back are not applied.
+	if err := s.DryRun().DeleteUser(1); err != nil {
+		t.Fatal(err)
+	} else if u, err := s.User(1); err != nil {
+		t.Fatal(err)
+	} else if u == nil {
+		t.Fatal("expected user")
+	} else if err := s.DeleteUser(1); err != nil {
+		t.Fatal(err)
+	} else if u, err := s.User(1); err != nil {
+		t.Fatal(err)
+	} else if u != nil {
+		t.Fatalf("unexpected user: %#v", u)
+	}
+
+	// Reads fail once the store is closed.
+	if err := s.Store.Close(); err != nil {
+		t.Fatal(err)
+	} else if _, err := s.User(2); !errors.Is(err, main.ErrStoreClosed) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := s.Store.Open(); err != nil {
+		t.Fatal(err)
+	}
+}
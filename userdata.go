@@ -0,0 +1,393 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"time"
+
+	"github.com/benbjohnson/application-development-using-boltdb/internal"
+	"github.com/benbjohnson/application-development-using-boltdb/keys"
+	"github.com/gogo/protobuf/proto"
+)
+
+// UserArchive is a copy of every record in the store that refers to a user,
+// as written by ExportUserData. Secrets such as password hashes and TOTP
+// secrets are only reported as present.
+type UserArchive struct {
+	User        *User              `json:"user"`
+	Blobs       []*ArchivedBlob    `json:"blobs"`
+	Revisions   []*UserRevision    `json:"revisions"`
+	Identities  []*Identity        `json:"identities"`
+	InvitesSent []*Invite          `json:"invites_sent"`
+	Following   []int              `json:"following"` // IDs of followed users
+	Followers   []int              `json:"followers"`
+	Activity    []*Activity        `json:"activity"`
+	Rollups     []*Activity        `json:"activity_rollups"`
+	Resets      []*ArchivedReset   `json:"password_resets"`
+	Events      []*Event           `json:"events"` // unpublished outbox events
+	Deliveries  []*WebhookDelivery `json:"webhook_deliveries"`
+	Emails      []*Email           `json:"emails"` // bodies are not exported
+	HasPassword bool               `json:"has_password"`
+	HasTOTP     bool               `json:"has_totp"`
+	ExportedAt  time.Time          `json:"exported_at"`
+}
+
+// ArchivedBlob is a blob of a user along with its content.
+type ArchivedBlob struct {
+	*Blob
+	Data []byte `json:"data"`
+}
+
+// ArchivedReset is a pending password reset of a user. Its token is not
+// kept by the store so it is not exported.
+type ArchivedReset struct {
+	ExpiresAt time.Time `json:"expires_at"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// ExportUserData writes a JSON archive of every record referring to a user
+// to w. Records are read in a single transaction so the archive is
+// consistent; w is written to after the transaction closes.
+func (s *Store) ExportUserData(id int, w io.Writer) error {
+	a := &UserArchive{ExportedAt: time.Now().UTC()}
+	if err := s.view("ExportUserData", func(tx *Tx) error {
+		a.User = &User{}
+		if err := loadUser(tx, id, a.User); err != nil {
+			return err
+		}
+
+		var err error
+		if a.Blobs, err = archiveUserBlobs(tx, id); err != nil {
+			return err
+		} else if a.Revisions, err = userRevisions(tx, id); err != nil {
+			return err
+		} else if a.Identities, err = userIdentities(tx, id); err != nil {
+			return err
+		} else if a.Deliveries, err = userWebhookDeliveries(tx, id); err != nil {
+			return err
+		} else if a.Emails, err = userEmails(tx, a.User.Email); err != nil {
+			return err
+		} else if a.Following, err = edgeIDs(tx, "Following", id); err != nil {
+			return err
+		} else if a.Followers, err = edgeIDs(tx, "Followers", id); err != nil {
+			return err
+		} else if a.Activity, err = userActivity(tx, "Activity", id); err != nil {
+			return err
+		} else if a.Rollups, err = userActivity(tx, "ActivityRollups", id); err != nil {
+			return err
+		}
+
+		resets, err := userPasswordResets(tx, id)
+		if err != nil {
+			return err
+		}
+		for _, r := range resets {
+			a.Resets = append(a.Resets, &ArchivedReset{ExpiresAt: r.ExpiresAt, CreatedAt: r.CreatedAt})
+		}
+
+		// Bodies of pending emails may contain tokens.
+		for _, e := range a.Emails {
+			e.Body = ""
+		}
+
+		a.HasPassword = tx.Bucket([]byte("Passwords")).Get(keys.Int(id)) != nil
+		a.HasTOTP = tx.Bucket([]byte("TOTP")).Get(keys.Int(id)) != nil
+
+		if err := tx.Bucket([]byte("Invites")).ForEach(func(_, v []byte) error {
+			tx.recordRead("Invites", v)
+
+			var i Invite
+			if err := i.UnmarshalBinary(v); err != nil {
+				return err
+			} else if i.InvitedBy == id {
+				a.InvitesSent = append(a.InvitesSent, &i)
+			}
+			return nil
+		}); err != nil {
+			return err
+		}
+
+		return tx.Bucket([]byte("Outbox")).ForEach(func(_, v []byte) error {
+			tx.recordRead("Outbox", v)
+
+			var e Event
+			if err := e.UnmarshalBinary(v); err != nil {
+				return err
+			} else if e.UserID == id {
+				a.Events = append(a.Events, &e)
+			}
+			return nil
+		})
+	}); err != nil {
+		return err
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "\t")
+	return enc.Encode(a)
+}
+
+// archiveUserBlobs returns the blobs of a user along with their content.
+func archiveUserBlobs(tx *Tx, id int) ([]*ArchivedBlob, error) {
+	ubkt := tx.Bucket([]byte("Blobs")).Bucket(keys.Int(id))
+	if ubkt == nil {
+		return nil, nil
+	}
+
+	var a []*ArchivedBlob
+	if err := ubkt.ForEach(func(k, _ []byte) error {
+		r, err := newBlobReader(tx, id, string(k))
+		if err != nil {
+			return err
+		}
+		b := &Blob{Name: string(k)}
+		if err := b.UnmarshalBinary(ubkt.Bucket(k).Get(blobInfoKey)); err != nil {
+			return err
+		}
+
+		// The reader shares the transaction so it is not closed.
+		data, err := io.ReadAll(r)
+		if err != nil {
+			return err
+		}
+		a = append(a, &ArchivedBlob{Blob: b, Data: data})
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// Erasure certifies that the records of a user were erased.
+type Erasure struct {
+	UserID   int
+	Records  int // number of records removed or scrubbed
+	ErasedAt time.Time
+}
+
+// MarshalBinary encodes an erasure to binary format.
+func (e *Erasure) MarshalBinary() ([]byte, error) {
+	return proto.Marshal(&internal.Erasure{
+		UserID:   proto.Int64(int64(e.UserID)),
+		Records:  proto.Int64(int64(e.Records)),
+		ErasedAt: proto.Int64(encodeTime(e.ErasedAt)),
+	})
+}
+
+// UnmarshalBinary decodes an erasure from binary data.
+func (e *Erasure) UnmarshalBinary(data []byte) error {
+	var pb internal.Erasure
+	if err := proto.Unmarshal(data, &pb); err != nil {
+		return err
+	}
+
+	e.UserID = int(pb.GetUserID())
+	e.Records = int(pb.GetRecords())
+	e.ErasedAt = decodeTime(pb.GetErasedAt())
+
+	return nil
+}
+
+// EraseUser irreversibly removes a user and scrubs the records that refer
+// to it. The user is deleted as by DeleteUser and its entire history is
+// removed. Unpublished outbox events for the user lose their data and field
+// values, as do the payloads of logged webhook deliveries for the user.
+// Emails sent to the user's address are removed, invites sent by the user
+// are anonymized, and its idempotency keys and login failures are removed.
+// A deletion event is still published.
+//
+// The returned erasure is also stored as a certificate that can be
+// retrieved with UserErasure. A user that was already deleted can be erased
+// to remove its remaining history. Returns ErrUserNotFound if no records
+// refer to the user.
+func (s *Store) EraseUser(id int) (*Erasure, error) {
+	e := &Erasure{UserID: id}
+	if err := s.update("EraseUser", func(tx *Tx) error {
+		e.Records = 0
+
+		var u User
+		if err := loadUser(tx, id, &u); err == nil {
+			e.Records++
+		} else if !errors.Is(err, ErrUserNotFound) {
+			return err
+		}
+
+		// Scrub the records that refer to the user before deleting it so
+		// its deletion event is kept intact.
+		n, err := scrubUserEvents(tx, id)
+		if err != nil {
+			return err
+		}
+		e.Records += n
+
+		n, err = scrubWebhookDeliveries(tx, id)
+		if err != nil {
+			return err
+		}
+		e.Records += n
+
+		n, err = deleteUserEmails(tx, u.Email)
+		if err != nil {
+			return err
+		}
+		e.Records += n
+
+		n, err = eraseUserHistory(tx, id)
+		if err != nil {
+			return err
+		} else if e.Records += n; e.Records == 0 {
+			return keyError("user", id, ErrUserNotFound)
+		}
+
+		// Delete the user and the revision recorded for the deletion.
+		if err := deleteUser(tx, id); err != nil {
+			return err
+		} else if _, err := eraseUserHistory(tx, id); err != nil {
+			return err
+		}
+
+		// Anonymize invites sent by the user.
+		if err := rewriteValues(tx, "Invites", func(v []byte) ([]byte, error) {
+			var i Invite
+			if err := i.UnmarshalBinary(v); err != nil {
+				return nil, err
+			} else if i.InvitedBy != id {
+				return nil, nil
+			}
+			e.Records++
+			i.InvitedBy = 0
+			return i.MarshalBinary()
+		}); err != nil {
+			return err
+		}
+
+		n, err = deleteIdempotencyRecords(tx, id)
+		if err != nil {
+			return err
+		}
+		e.Records += n
+
+		// Remove flag overrides left by a user deleted before it was erased.
+		if err := deleteFlagOverrides(tx, id); err != nil {
+			return err
+		}
+
+		if err := clearLoginFailures(tx, userLoginSubject(id)); err != nil {
+			return err
+		}
+
+		// Record the certificate.
+		e.ErasedAt = time.Now().UTC()
+		buf, err := e.MarshalBinary()
+		if err != nil {
+			return err
+		}
+		return putValue(tx, "Erasures", keys.Int(id), buf)
+	}); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// UserErasure returns the erasure certificate for a user or nil if the user
+// has not been erased.
+func (s *Store) UserErasure(id int) (*Erasure, error) {
+	var e *Erasure
+	if err := s.view("UserErasure", func(tx *Tx) error {
+		v := tx.Bucket([]byte("Erasures")).Get(keys.Int(id))
+		if v == nil {
+			return nil
+		}
+		tx.recordRead("Erasures", v)
+
+		e = &Erasure{}
+		return e.UnmarshalBinary(v)
+	}); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// scrubUserEvents removes user data and field values from unpublished
+// events for a user and returns the number of events changed.
+func scrubUserEvents(tx *Tx, id int) (int, error) {
+	return scrubEvents(tx, func(e *Event) bool { return e.UserID == id })
+}
+
+// scrubEvents removes user data and field values from the unpublished events
+// for which match returns true and returns the number of events changed.
+func scrubEvents(tx *Tx, match func(e *Event) bool) (int, error) {
+	bkt := tx.Bucket([]byte("Outbox"))
+
+	// Collect events first since the bucket cannot be modified while
+	// iterating.
+	var a []*Event
+	if err := bkt.ForEach(func(_, v []byte) error {
+		tx.recordRead("Outbox", v)
+
+		var e Event
+		if err := e.UnmarshalBinary(v); err != nil {
+			return err
+		} else if match(&e) && (e.Data != nil || len(e.Changes) > 0) {
+			a = append(a, &e)
+		}
+		return nil
+	}); err != nil {
+		return 0, err
+	}
+
+	for _, e := range a {
+		e.Data = nil
+		for i := range e.Changes {
+			e.Changes[i].Old, e.Changes[i].New = "", ""
+		}
+
+		buf, err := e.MarshalBinary()
+		if err != nil {
+			return 0, err
+		}
+		tx.recordWrite("Outbox", buf)
+		if err := bkt.Put(keys.Int(e.ID), buf); err != nil {
+			return 0, err
+		}
+	}
+	return len(a), nil
+}
+
+// eraseUserHistory removes all revisions of a user and returns their count.
+func eraseUserHistory(tx *Tx, id int) (int, error) {
+	bkt := tx.Bucket([]byte("UserHistory"))
+	hbkt := bkt.Bucket(keys.Int(id))
+	if hbkt == nil {
+		return 0, nil
+	}
+
+	n := hbkt.Stats().KeyN
+	tx.recordDelete("UserHistory")
+	return n, bkt.DeleteBucket(keys.Int(id))
+}
+
+// deleteIdempotencyRecords removes the idempotency keys that created a user
+// and returns their count.
+func deleteIdempotencyRecords(tx *Tx, id int) (int, error) {
+	var a [][]byte
+	if err := tx.Bucket([]byte("Idempotency")).ForEach(func(k, v []byte) error {
+		var r idempotencyRecord
+		if err := r.UnmarshalBinary(v); err != nil {
+			return err
+		} else if r.UserID == id {
+			a = append(a, append([]byte{}, k...))
+		}
+		return nil
+	}); err != nil {
+		return 0, err
+	}
+
+	for _, k := range a {
+		if err := deleteWithTTL(tx, "Idempotency", k); err != nil {
+			return 0, err
+		}
+	}
+	return len(a), nil
+}
@@ -0,0 +1,248 @@
+package main_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	main "github.com/benbjohnson/application-development-using-boltdb"
+)
+
+// Ensure a user's records are exported as a JSON archive.
+func TestStore_ExportUserData(t *testing.T) {
+	s := NewStore()
+	s.UserHistoryLimit = 10
+	s.Outbox = true
+	if err := s.Open(); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	if err := s.CreateUser(&main.User{Username: "susy", Bio: "hello", Email: "susy@example.com"}); err != nil {
+		t.Fatal(err)
+	} else if err := s.AddTag(1, "beta"); err != nil {
+		t.Fatal(err)
+	} else if err := s.PutUserBlob(1, "bio.txt", strings.NewReader("my bio")); err != nil {
+		t.Fatal(err)
+	} else if err := s.SetPassword(1, "hunter22"); err != nil {
+		t.Fatal(err)
+	} else if err := s.LinkIdentity(1, "github", "susy"); err != nil {
+		t.Fatal(err)
+	} else if _, err := s.CreateInvite("jimbo@example.com", 1); err != nil {
+		t.Fatal(err)
+	} else if err := s.CreateUser(&main.User{Username: "jimbo"}); err != nil {
+		t.Fatal(err)
+	} else if err := s.Follow(1, 2); err != nil {
+		t.Fatal(err)
+	} else if err := s.RecordActivity(1, time.Date(2000, 1, 1, 0, 30, 0, 0, time.UTC), "login"); err != nil {
+		t.Fatal(err)
+	} else if err := s.RecordActivity(1, time.Now(), "login"); err != nil {
+		t.Fatal(err)
+	} else if _, err := s.RollupActivity(time.Date(2000, 1, 2, 0, 0, 0, 0, time.UTC)); err != nil {
+		t.Fatal(err)
+	}
+	token, err := s.CreatePasswordReset("susy@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := s.ExportUserData(1, &buf); err != nil {
+		t.Fatal(err)
+	}
+
+	var a main.UserArchive
+	if err := json.Unmarshal(buf.Bytes(), &a); err != nil {
+		t.Fatal(err)
+	} else if a.User == nil || a.User.Username != "susy" || a.User.Bio != "hello" {
+		t.Fatalf("unexpected user: %#v", a.User)
+	} else if len(a.Blobs) != 1 || a.Blobs[0].Name != "bio.txt" || string(a.Blobs[0].Data) != "my bio" {
+		t.Fatalf("unexpected blobs: %#v", a.Blobs)
+	} else if len(a.Revisions) != 2 || len(a.Events) != 3 {
+		t.Fatalf("unexpected revisions/events: %d/%d", len(a.Revisions), len(a.Events))
+	} else if len(a.Identities) != 1 || len(a.InvitesSent) != 1 {
+		t.Fatalf("unexpected identities/invites: %d/%d", len(a.Identities), len(a.InvitesSent))
+	} else if len(a.Following) != 1 || a.Following[0] != 2 || len(a.Followers) != 0 {
+		t.Fatalf("unexpected follows: %v/%v", a.Following, a.Followers)
+	} else if len(a.Activity) != 1 || a.Activity[0].Kind != "login" || len(a.Rollups) != 1 || a.Rollups[0].Count != 1 {
+		t.Fatalf("unexpected activity: %#v/%#v", a.Activity, a.Rollups)
+	} else if len(a.Resets) != 1 || a.Resets[0].ExpiresAt.IsZero() {
+		t.Fatalf("unexpected resets: %#v", a.Resets)
+	} else if !a.HasPassword || a.HasTOTP {
+		t.Fatalf("unexpected credentials: %v/%v", a.HasPassword, a.HasTOTP)
+	} else if strings.Contains(buf.String(), "hunter22") || strings.Contains(buf.String(), token) {
+		t.Fatal("secret exported")
+	}
+
+	if err := s.ExportUserData(3, &buf); !errors.Is(err, main.ErrUserNotFound) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+// Ensure erasing a user scrubs every record that refers to it.
+func TestStore_EraseUser(t *testing.T) {
+	s := NewStore()
+	s.UserHistoryLimit = 10
+	s.Outbox = true
+	if err := s.Open(); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	if err := s.CreateUser(&main.User{Username: "susy"}); err != nil {
+		t.Fatal(err)
+	} else if err := s.AddTag(1, "beta"); err != nil {
+		t.Fatal(err)
+	} else if _, err := s.CreateInvite("jimbo@example.com", 1); err != nil {
+		t.Fatal(err)
+	}
+
+	// User, 2 events, 2 revisions, and 1 invite.
+	e, err := s.EraseUser(1)
+	if err != nil {
+		t.Fatal(err)
+	} else if e.UserID != 1 || e.Records != 6 || e.ErasedAt.IsZero() {
+		t.Fatalf("unexpected erasure: %#v", e)
+	} else if other, err := s.UserErasure(1); err != nil {
+		t.Fatal(err)
+	} else if other == nil || other.Records != 6 {
+		t.Fatalf("unexpected certificate: %#v", other)
+	}
+
+	if u, err := s.User(1); err != nil || u != nil {
+		t.Fatalf("unexpected user: %#v, %v", u, err)
+	} else if a, err := s.UserHistory(1); err != nil || len(a) != 0 {
+		t.Fatalf("unexpected history: %d, %v", len(a), err)
+	} else if a, err := s.PendingInvites(); err != nil || len(a) != 1 || a[0].InvitedBy != 0 {
+		t.Fatalf("unexpected invites: %#v, %v", a, err)
+	}
+
+	// Only the deletion event carries the user's ID and no data remains.
+	var p Publisher
+	r := &main.Relay{Store: s.Store, Publisher: &p}
+	if _, err := r.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	events := p.Events()
+	if len(events) != 3 || events[2].Type != main.EventUserDeleted {
+		t.Fatalf("unexpected events: %#v", events)
+	}
+	for _, e := range events {
+		if e.Data != nil || (len(e.Changes) > 0 && e.Changes[0].New != "") {
+			t.Fatalf("unscrubbed event: %#v", e)
+		}
+	}
+
+	// A user without records cannot be erased.
+	if _, err := s.EraseUser(2); !errors.Is(err, main.ErrUserNotFound) {
+		t.Fatalf("unexpected error: %v", err)
+	} else if e, err := s.UserErasure(2); err != nil || e != nil {
+		t.Fatalf("unexpected certificate: %#v, %v", e, err)
+	}
+}
+
+// Ensure webhook deliveries for a user are exported and scrubbed on erasure.
+func TestStore_EraseUser_WebhookDeliveries(t *testing.T) {
+	s := OpenStore()
+	defer s.Close()
+	s.Outbox = true
+
+	if err := s.CreateWebhook(&main.Webhook{URL: "http://localhost/hook"}); err != nil {
+		t.Fatal(err)
+	} else if err := s.CreateUser(&main.User{Username: "susy"}); err != nil {
+		t.Fatal(err)
+	} else if err := s.SetUsername(1, "susan"); err != nil {
+		t.Fatal(err)
+	} else if err := s.CreateUser(&main.User{Username: "jimbo"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Queue deliveries without sending them.
+	r := &main.Relay{Store: s.Store, Publisher: &main.WebhookDispatcher{Store: s.Store}}
+	if _, err := r.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	var a main.UserArchive
+	if err := s.ExportUserData(1, &buf); err != nil {
+		t.Fatal(err)
+	} else if err := json.Unmarshal(buf.Bytes(), &a); err != nil {
+		t.Fatal(err)
+	} else if len(a.Deliveries) != 2 || !strings.Contains(string(a.Deliveries[0].Payload), "susy") {
+		t.Fatalf("unexpected deliveries: %#v", a.Deliveries)
+	}
+
+	// User and 2 deliveries.
+	if e, err := s.EraseUser(1); err != nil {
+		t.Fatal(err)
+	} else if e.Records != 3 {
+		t.Fatalf("unexpected records: %d", e.Records)
+	}
+
+	a2, err := s.WebhookDeliveries(1)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(a2) != 3 {
+		t.Fatalf("unexpected deliveries: %d", len(a2))
+	}
+	for _, d := range a2[:2] {
+		if strings.Contains(string(d.Payload), "sus") || d.Status != main.WebhookPending {
+			t.Fatalf("unscrubbed delivery: %s", d.Payload)
+		}
+	}
+	if !strings.Contains(string(a2[2].Payload), "jimbo") {
+		t.Fatalf("other user scrubbed: %s", a2[2].Payload)
+	}
+}
+
+// Ensure emails sent to a user are exported without bodies and removed on
+// erasure.
+func TestStore_EraseUser_Emails(t *testing.T) {
+	s := OpenStore()
+	defer s.Close()
+
+	if err := s.CreateUser(&main.User{Username: "susy", Email: "susy@example.com"}); err != nil {
+		t.Fatal(err)
+	} else if _, err := s.QueueEmail("Susy@example.com", main.EmailPasswordReset, &main.EmailData{Username: "susy", Token: "secret"}); err != nil {
+		t.Fatal(err)
+	} else if _, err := s.QueueEmail("jimbo@example.com", main.EmailPasswordReset, &main.EmailData{Username: "jimbo"}); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	var a main.UserArchive
+	if err := s.ExportUserData(1, &buf); err != nil {
+		t.Fatal(err)
+	} else if err := json.Unmarshal(buf.Bytes(), &a); err != nil {
+		t.Fatal(err)
+	} else if len(a.Emails) != 1 || a.Emails[0].To != "Susy@example.com" || a.Emails[0].Subject == "" {
+		t.Fatalf("unexpected emails: %#v", a.Emails)
+	} else if strings.Contains(buf.String(), "secret") {
+		t.Fatal("email body exported")
+	}
+
+	// User and 1 email.
+	if e, err := s.EraseUser(1); err != nil {
+		t.Fatal(err)
+	} else if e.Records != 2 {
+		t.Fatalf("unexpected records: %d", e.Records)
+	} else if a, err := s.Emails(""); err != nil {
+		t.Fatal(err)
+	} else if len(a) != 1 || a[0].To != "jimbo@example.com" {
+		t.Fatalf("unexpected emails: %#v", a)
+	}
+
+	// The removed email is no longer sent.
+	var m Mailer
+	w := &main.EmailWorker{Store: s.Store, Mailer: &m}
+	if n, err := w.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	} else if n != 1 {
+		t.Fatalf("unexpected count: %d", n)
+	}
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+
+	"github.com/benbjohnson/application-development-using-boltdb/keys"
+	"golang.org/x/text/cases"
+	"golang.org/x/text/unicode/norm"
+)
+
+// UsernameNormalization determines which usernames are considered equal.
+type UsernameNormalization int
+
+// Username normalizations.
+const (
+	// Usernames are converted to Unicode NFC and case folded so "Susy" and
+	// "susy" are the same username.
+	NormalizeFold UsernameNormalization = iota
+
+	// Usernames are converted to Unicode NFC only.
+	NormalizeNFC
+
+	// Usernames are stored and matched exactly.
+	NormalizeNone
+)
+
+// UserByName retrieves the user with the given username. If multiple users
+// share the username, such as after NormalizeUsernames, then the user with
+// the lowest ID is returned.
+// The username is normalized before matching.
+// Returns nil if no user has the username.
+func (s *Store) UserByName(username string) (*User, error) {
+	username = s.normalizeUsername(username)
+	if c := s.userCache(); c != nil {
+		return copyUser(c.byName[username]), nil
+	}
+
+	var u *User
+	if err := s.view("UserByName", func(tx *Tx) error {
+		// Index keys are the username followed by the user ID so the
+		// first key with the username prefix is the lowest ID.
+		c := tx.Bucket([]byte("UsersByUsername")).Cursor()
+		return keys.Scan(c, keys.String(username), func(k, _ []byte) error {
+			r := keys.NewReader(k)
+			r.ReadString()
+			id := r.ReadInt()
+			if err := r.Err(); err != nil {
+				return err
+			}
+
+			u = &User{}
+			if err := loadUser(tx, id, u); err != nil {
+				return err
+			}
+			return errStop
+		})
+	}); err != nil && !errors.Is(err, errStop) {
+		return nil, err
+	}
+	return u, nil
+}
+
+// UsernameExists returns true if any user has the given username. The
+// username is normalized before matching. Only the username index is read so
+// no user is decoded.
+func (s *Store) UsernameExists(username string) (bool, error) {
+	username = s.normalizeUsername(username)
+	if c := s.userCache(); c != nil {
+		return c.byName[username] != nil, nil
+	}
+
+	var exists bool
+	if err := s.view("UsernameExists", func(tx *Tx) error {
+		prefix := keys.String(username)
+		k, _ := tx.Bucket([]byte("UsersByUsername")).Cursor().Seek(prefix)
+		exists = k != nil && bytes.HasPrefix(k, prefix)
+		return nil
+	}); err != nil {
+		return false, err
+	}
+	return exists, nil
+}
+
+// checkUsernameTaken returns ErrUsernameTaken if a user other than id has
+// the normalized username. Empty usernames are not checked.
+func checkUsernameTaken(tx *Tx, username string, id int) error {
+	if username == "" {
+		return nil
+	}
+
+	c := tx.Bucket([]byte("UsersByUsername")).Cursor()
+	return keys.Scan(c, keys.String(username), func(k, _ []byte) error {
+		r := keys.NewReader(k)
+		r.ReadString()
+		other := r.ReadInt()
+		if err := r.Err(); err != nil {
+			return err
+		} else if other != id {
+			return keyError("username", username, ErrUsernameTaken)
+		}
+		return nil
+	})
+}
+
+// NormalizeUsernames rewrites the usernames of existing users that are not
+// normalized under the current UsernameNormalization and returns the number
+// of users changed. The username index is updated along with each user.
+//
+// Users are rewritten in batches across multiple transactions so other
+// writers are not blocked. Renormalizing is a migration so no revisions or
+// events are recorded.
+func (s *Store) NormalizeUsernames() (int, error) {
+	var n int
+	seek := keys.Int(0)
+	for seek != nil {
+		from, changed := seek, 0
+		if err := s.update("NormalizeUsernames", func(tx *Tx) error {
+			// Find the users of the batch to change. Updates are applied
+			// after iterating since writes can move the cursor.
+			var updates []*User
+			c := tx.Bucket([]byte("Users")).Cursor()
+			k, v := c.Seek(from)
+			for i := 0; k != nil && i < reindexBatchSize; k, v = c.Next() {
+				tx.recordRead("Users", v)
+
+				var u User
+				if err := decodeUser(tx, v, &u); err != nil {
+					return err
+				} else if name := s.normalizeUsername(u.Username); name != u.Username {
+					u.Username = name
+					updates = append(updates, &u)
+				}
+				i++
+			}
+
+			// Save the position of the next batch.
+			seek = nil
+			if k != nil {
+				seek = append([]byte{}, k...)
+			}
+
+			for _, u := range updates {
+				if err := saveUser(tx, u); err != nil {
+					return err
+				}
+			}
+			changed = len(updates)
+			return nil
+		}); err != nil {
+			return n, err
+		}
+		n += changed
+	}
+	return n, nil
+}
+
+// normalizeUsername returns username normalized using the store's settings.
+func (s *Store) normalizeUsername(username string) string {
+	switch s.UsernameNormalization {
+	case NormalizeNone:
+		return username
+	case NormalizeNFC:
+		return norm.NFC.String(username)
+	default:
+		return norm.NFC.String(cases.Fold().String(norm.NFC.String(username)))
+	}
+}
+
+// errStop is returned from iteration callbacks to stop iterating early.
+var errStop = errors.New("stop")
+
+// Username related errors.
+var (
+	ErrUsernameTaken = &Error{Code: ECONFLICT, Message: "username taken"}
+)
@@ -0,0 +1,207 @@
+package main_test
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	main "github.com/benbjohnson/application-development-using-boltdb"
+)
+
+// Ensure a user can be retrieved by username as it changes.
+func TestStore_UserByName(t *testing.T) {
+	s := OpenStore()
+	defer s.Close()
+
+	if err := s.CreateUser(&main.User{Username: "susy"}); err != nil {
+		t.Fatal(err)
+	} else if err := s.CreateUser(&main.User{Username: "susyq"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if u, err := s.UserByName("susy"); err != nil {
+		t.Fatal(err)
+	} else if u == nil || u.ID != 1 {
+		t.Fatalf("unexpected user: %#v", u)
+	}
+
+	// Rename the user; the old name should no longer match.
+	if err := s.SetUsername(1, "jimbo"); err != nil {
+		t.Fatal(err)
+	} else if u, err := s.UserByName("susy"); err != nil {
+		t.Fatal(err)
+	} else if u != nil {
+		t.Fatalf("unexpected user: %#v", u)
+	} else if u, err := s.UserByName("jimbo"); err != nil {
+		t.Fatal(err)
+	} else if u == nil || u.ID != 1 {
+		t.Fatalf("unexpected user: %#v", u)
+	}
+
+	// Delete the user.
+	if err := s.DeleteUser(1); err != nil {
+		t.Fatal(err)
+	} else if u, err := s.UserByName("jimbo"); err != nil {
+		t.Fatal(err)
+	} else if u != nil {
+		t.Fatalf("unexpected user: %#v", u)
+	}
+}
+
+// Ensure the presence of a username can be checked without matching
+// usernames that only share a prefix.
+func TestStore_UsernameExists(t *testing.T) {
+	s := OpenStore()
+	defer s.Close()
+
+	if err := s.CreateUser(&main.User{Username: "susyq"}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, cache := range []bool{false, true} {
+		s.CacheUsers = cache
+		if err := s.Reopen(); err != nil {
+			t.Fatal(err)
+		}
+
+		if ok, err := s.UsernameExists("SusyQ"); err != nil {
+			t.Fatal(err)
+		} else if !ok {
+			t.Fatalf("expected username to exist (cache=%v)", cache)
+		} else if ok, err := s.UsernameExists("susy"); err != nil {
+			t.Fatal(err)
+		} else if ok {
+			t.Fatalf("unexpected username (cache=%v)", cache)
+		}
+	}
+}
+
+// Ensure usernames are matched regardless of case and Unicode form.
+func TestStore_UserByName_Normalized(t *testing.T) {
+	s := OpenStore()
+	defer s.Close()
+
+	u := &main.User{Username: "Zoe\u0301"}
+	if err := s.CreateUser(u); err != nil {
+		t.Fatal(err)
+	} else if u.Username != "zoé" {
+		t.Fatalf("unexpected username: %q", u.Username)
+	}
+
+	for _, name := range []string{"zoé", "ZOÉ", "Zoe\u0301"} {
+		if u, err := s.UserByName(name); err != nil {
+			t.Fatal(err)
+		} else if u == nil || u.ID != 1 {
+			t.Fatalf("%q: unexpected user: %#v", name, u)
+		}
+	}
+
+	if err := s.SetUsername(1, "Susy"); err != nil {
+		t.Fatal(err)
+	} else if u, err := s.UserByName("SUSY"); err != nil {
+		t.Fatal(err)
+	} else if u == nil || u.Username != "susy" {
+		t.Fatalf("unexpected user: %#v", u)
+	}
+}
+
+// Ensure a user cannot be created with a username that is taken once
+// normalized.
+func TestStore_CreateUser_ErrUsernameTaken(t *testing.T) {
+	s := OpenStore()
+	defer s.Close()
+
+	if err := s.CreateUser(&main.User{Username: "Zoe\u0301"}); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"zoé", "ZOÉ"} {
+		if err := s.CreateUser(&main.User{Username: name}); !errors.Is(err, main.ErrUsernameTaken) {
+			t.Fatalf("%q: unexpected error: %v", name, err)
+		}
+	}
+
+	// The name is free again once the user is deleted.
+	if err := s.DeleteUser(1); err != nil {
+		t.Fatal(err)
+	} else if err := s.CreateUser(&main.User{Username: "zoé"}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Ensure a user cannot be renamed to another user's username.
+func TestStore_SetUsername_ErrUsernameTaken(t *testing.T) {
+	s := OpenStore()
+	defer s.Close()
+
+	if err := s.CreateUser(&main.User{Username: "susy"}); err != nil {
+		t.Fatal(err)
+	} else if err := s.CreateUser(&main.User{Username: "jimbo"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.SetUsername(2, "SUSY"); !errors.Is(err, main.ErrUsernameTaken) {
+		t.Fatalf("unexpected error: %v", err)
+	} else if name := "Susy"; !errors.Is(s.PatchUser(2, main.UserPatch{Username: &name}), main.ErrUsernameTaken) {
+		t.Fatal("expected username taken")
+	} else if u, err := s.User(2); err != nil {
+		t.Fatal(err)
+	} else if u.Username != "jimbo" {
+		t.Fatalf("unexpected username: %q", u.Username)
+	}
+
+	// Renaming a user to its own username is allowed.
+	if err := s.SetUsername(1, "Susy"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Ensure existing usernames can be renormalized after the setting changes.
+func TestStore_NormalizeUsernames(t *testing.T) {
+	s := NewStore()
+	s.UsernameNormalization = main.NormalizeNone
+	if err := s.Open(); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	if err := s.CreateUser(&main.User{Username: "Susy"}); err != nil {
+		t.Fatal(err)
+	} else if err := s.CreateUser(&main.User{Username: "john"}); err != nil {
+		t.Fatal(err)
+	} else if u, err := s.UserByName("susy"); err != nil {
+		t.Fatal(err)
+	} else if u != nil {
+		t.Fatalf("unexpected user: %#v", u)
+	}
+
+	s.UsernameNormalization = main.NormalizeFold
+	if err := s.Reopen(); err != nil {
+		t.Fatal(err)
+	} else if n, err := s.NormalizeUsernames(); err != nil {
+		t.Fatal(err)
+	} else if n != 1 {
+		t.Fatalf("unexpected count: %d", n)
+	}
+
+	if u, err := s.UserByName("Susy"); err != nil {
+		t.Fatal(err)
+	} else if u == nil || u.ID != 1 || u.Username != "susy" {
+		t.Fatalf("unexpected user: %#v", u)
+	} else if a, _, err := s.QueryUsers(main.Query{SortBy: "username"}); err != nil {
+		t.Fatal(err)
+	} else if len(a) != 2 || a[0].Username != "john" || a[1].Username != "susy" {
+		t.Fatalf("unexpected users: %v", a)
+	}
+}
+
+func BenchmarkStore_UserByName(b *testing.B) {
+	benchmarkSizes(b, func(b *testing.B, s *Store, n int) {
+		for i := 0; i < b.N; i++ {
+			if u, err := s.UserByName(fmt.Sprintf("user%d", i%n)); err != nil {
+				b.Fatal(err)
+			} else if u == nil {
+				b.Fatal("user not found")
+			}
+		}
+	})
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Verify checks the consistency of the data file's pages and freelist.
+// Returns a *CorruptionError listing every problem found.
+func (s *Store) Verify() error {
+	var errs []error
+	if err := s.view("Verify", func(tx *Tx) error {
+		for err := range tx.Check() {
+			errs = append(errs, err)
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	if len(errs) > 0 {
+		return &CorruptionError{Path: s.Path, Errors: errs}
+	}
+	return nil
+}
+
+// CorruptionError is returned when the data file fails verification.
+type CorruptionError struct {
+	Path string
+
+	// Problems found in the file, such as unreachable or doubly
+	// referenced pages.
+	Errors []error
+}
+
+// Error returns a summary of all problems found.
+func (e *CorruptionError) Error() string {
+	a := make([]string, len(e.Errors))
+	for i, err := range e.Errors {
+		a[i] = err.Error()
+	}
+	return fmt.Sprintf("data file corrupted: %s: %s", e.Path, strings.Join(a, "; "))
+}
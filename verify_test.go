@@ -0,0 +1,86 @@
+package main_test
+
+import (
+	"os"
+	"testing"
+
+	main "github.com/benbjohnson/application-development-using-boltdb"
+	"github.com/boltdb/bolt"
+)
+
+// Ensure a healthy data file passes verification.
+func TestStore_Verify(t *testing.T) {
+	s := OpenStore()
+	defer s.Close()
+
+	if err := s.CreateUser(&main.User{Username: "susy"}); err != nil {
+		t.Fatal(err)
+	} else if err := s.Verify(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Ensure corrupted pages are reported on open when VerifyOnOpen is set.
+func TestStore_Open_VerifyOnOpen(t *testing.T) {
+	s := OpenStore()
+	defer s.Close()
+
+	if err := s.CreateUser(&main.User{Username: "susy"}); err != nil {
+		t.Fatal(err)
+	} else if err := s.Store.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Empty the freelist so free pages are neither reachable nor freed.
+	if err := corruptFreelist(s.Path); err != nil {
+		t.Fatal(err)
+	}
+
+	s.VerifyOnOpen = true
+	if err := s.Open(); err == nil {
+		t.Fatal("expected error")
+	} else if err, ok := err.(*main.CorruptionError); !ok {
+		t.Fatalf("unexpected error: %#v", err)
+	} else if len(err.Errors) == 0 {
+		t.Fatalf("unexpected errors: %v", err.Errors)
+	}
+}
+
+// corruptFreelist rewrites the freelist of the data file at path to be empty.
+func corruptFreelist(path string) error {
+	// Locate the freelist page.
+	db, err := bolt.Open(path, 0600, nil)
+	if err != nil {
+		return err
+	}
+	var freelist int
+	if err := db.View(func(tx *bolt.Tx) error {
+		for i := 2; ; i++ {
+			if p, err := tx.Page(i); err != nil {
+				return err
+			} else if p == nil {
+				return nil
+			} else if p.Type == "freelist" {
+				freelist = i
+			}
+		}
+	}); err != nil {
+		return err
+	}
+	pageSize := db.Info().PageSize
+	if err := db.Close(); err != nil {
+		return err
+	}
+
+	// Page headers are an 8-byte id and 2-byte flags followed by a 2-byte
+	// count of the page ids in the freelist.
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if _, err := f.WriteAt([]byte{0, 0}, int64(freelist*pageSize)+10); err != nil {
+		return err
+	}
+	return f.Close()
+}
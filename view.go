@@ -0,0 +1,219 @@
+package main
+
+import (
+	"bytes"
+
+	"github.com/boltdb/bolt"
+)
+
+// View declares a materialized view derived from the values of a bucket,
+// such as a count of users per day. The view's data is kept in its own
+// bucket so expensive aggregates can be read cheaply at query time.
+//
+// Views are updated incrementally in the same transaction as every change
+// to their source bucket. A new view, or one passed to RebuildView, is
+// built from scratch in batches and is stale until the build finishes.
+type View struct {
+	// Name of the bucket that holds the view's data.
+	Name string
+
+	// Name of the bucket the view is derived from.
+	Source string
+
+	// Updates the view's bucket after the record under key changes from
+	// prev to v. Prev is nil when a record is created and v is nil when it
+	// is deleted. Values are passed after being reassembled and
+	// decompressed. During a build, Apply is called with a nil prev for
+	// every existing record.
+	Apply func(bkt *bolt.Bucket, key, prev, v []byte) error
+}
+
+// ReadView executes fn with the bucket of the view named name within a
+// read-only transaction. Use ViewStale to check whether the view is
+// complete.
+func (s *Store) ReadView(name string, fn func(bkt *bolt.Bucket) error) error {
+	if s.schema().view(name) == nil {
+		return ErrViewNotFound
+	}
+	return s.view("ReadView", func(tx *Tx) error {
+		return fn(tx.Bucket([]byte(name)))
+	})
+}
+
+// ViewStale returns true if the view named name is being built and does
+// not yet reflect every record of its source bucket.
+func (s *Store) ViewStale(name string) (bool, error) {
+	if s.schema().view(name) == nil {
+		return false, ErrViewNotFound
+	}
+
+	var stale bool
+	if err := s.view("ViewStale", func(tx *Tx) error {
+		stale = tx.Bucket([]byte("ViewBuilds")).Get([]byte(name)) != nil
+		return nil
+	}); err != nil {
+		return false, err
+	}
+	return stale, nil
+}
+
+// RebuildView clears the view named name and builds it again from its
+// source bucket. Like ReindexAll, records are applied in batches so other
+// writers are not blocked and an interrupted build resumes on next open.
+func (s *Store) RebuildView(name string) error {
+	if s.schema().view(name) == nil {
+		return ErrViewNotFound
+	}
+
+	if err := s.update("RebuildView", func(tx *Tx) error {
+		if err := tx.DeleteBucket([]byte(name)); err != nil && err != bolt.ErrBucketNotFound {
+			return err
+		} else if _, err := tx.CreateBucket([]byte(name)); err != nil {
+			return err
+		}
+		return tx.Bucket([]byte("ViewBuilds")).Put([]byte(name), []byte{})
+	}); err != nil {
+		return err
+	}
+	return s.buildView(name)
+}
+
+// view returns the view named name or nil if it does not exist.
+func (sc *Schema) view(name string) *View {
+	for _, v := range sc.Views {
+		if v.Name == name {
+			return v
+		}
+	}
+	return nil
+}
+
+// updateViews applies a change to the record under key in the bucket named
+// name to every view derived from it. prev and v are as stored.
+//
+// Records that a pending build has not reached yet are skipped since the
+// build applies their latest value when it gets to them.
+func updateViews(tx *Tx, name string, key, prev, v []byte) error {
+	var views []*View
+	for _, view := range tx.store.schema().Views {
+		if view.Source == name {
+			views = append(views, view)
+		}
+	}
+	if len(views) == 0 {
+		return nil
+	}
+
+	prev, err := decodeValue(tx, prev)
+	if err != nil {
+		return err
+	}
+	v, err = decodeValue(tx, v)
+	if err != nil {
+		return err
+	}
+
+	pending := tx.Bucket([]byte("ViewBuilds"))
+	for _, view := range views {
+		if seek := pending.Get([]byte(view.Name)); seek != nil && bytes.Compare(key, seek) >= 0 {
+			continue
+		}
+
+		tx.touch(view.Name)
+		if err := view.Apply(tx.Bucket([]byte(view.Name)), key, prev, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// buildPendingViews builds every view that has been created or cleared but
+// not yet filled from its source bucket.
+func (s *Store) buildPendingViews() error {
+	var names []string
+	if err := s.view("RebuildView", func(tx *Tx) error {
+		return tx.Bucket([]byte("ViewBuilds")).ForEach(func(k, _ []byte) error {
+			names = append(names, string(k))
+			return nil
+		})
+	}); err != nil {
+		return err
+	}
+
+	for _, name := range names {
+		if err := s.buildView(name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// buildView applies every record of the source bucket to the view named
+// name, one batch per transaction. The key of the next record is saved in
+// the ViewBuilds bucket after each batch so the build can resume and so
+// updateViews knows which records have been applied.
+func (s *Store) buildView(name string) error {
+	var seek []byte
+	for done, first := false, true; !done; first = false {
+		from := seek
+		if err := s.update("RebuildView", func(tx *Tx) error {
+			// Start over from the previous batch if the transaction is retried.
+			seek = from
+			pending := tx.Bucket([]byte("ViewBuilds"))
+
+			// Drop partial views that are no longer in the schema.
+			view := s.schema().view(name)
+			if view == nil {
+				done = true
+				if err := tx.DeleteBucket([]byte(name)); err != nil && err != bolt.ErrBucketNotFound {
+					return err
+				}
+				return pending.Delete([]byte(name))
+			}
+
+			// Resume from the saved position on the first batch.
+			if first {
+				seek = append([]byte{}, pending.Get([]byte(name))...)
+			}
+
+			bkt := tx.Bucket([]byte(view.Name))
+			c := tx.Bucket([]byte(view.Source)).Cursor()
+			k, v := c.First()
+			if len(seek) > 0 {
+				k, v = c.Seek(seek)
+			}
+			for i := 0; k != nil && i < reindexBatchSize; k, v = c.Next() {
+				if v == nil {
+					continue
+				}
+				tx.recordRead(view.Source, v)
+
+				buf, err := decodeValue(tx, v)
+				if err != nil {
+					return err
+				} else if err := view.Apply(bkt, k, nil, buf); err != nil {
+					return err
+				}
+				i++
+			}
+
+			// Save the position of the next batch or finish the build.
+			if k == nil {
+				done = true
+				return pending.Delete([]byte(name))
+			}
+			seek = append([]byte{}, k...)
+			return pending.Put([]byte(name), seek)
+		}); err != nil {
+			return err
+		}
+	}
+
+	s.logger().Info("view built", "view", name)
+	return nil
+}
+
+// View related errors.
+var (
+	ErrViewNotFound = &Error{Code: ENOTFOUND, Message: "view not found"}
+)
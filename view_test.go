@@ -0,0 +1,163 @@
+package main_test
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	main "github.com/benbjohnson/application-development-using-boltdb"
+	"github.com/benbjohnson/application-development-using-boltdb/keys"
+	"github.com/boltdb/bolt"
+)
+
+// tagCountSchema returns the default schema extended with a view that
+// counts the users with each tag.
+func tagCountSchema() *main.Schema {
+	sc := &main.Schema{
+		Buckets: main.DefaultSchema.Buckets,
+		Indexes: main.DefaultSchema.Indexes,
+	}
+	sc.Views = []*main.View{{
+		Name:   "UserCountByTag",
+		Source: "Users",
+		Apply: func(bkt *bolt.Bucket, _, prev, v []byte) error {
+			adjust := func(buf []byte, delta int) error {
+				if buf == nil {
+					return nil
+				}
+				var u main.User
+				if err := u.UnmarshalBinary(buf); err != nil {
+					return err
+				}
+				for _, tag := range u.Tags {
+					var n int
+					if v := bkt.Get([]byte(tag)); v != nil {
+						n = keys.ParseInt(v)
+					}
+					if err := bkt.Put([]byte(tag), keys.Int(n+delta)); err != nil {
+						return err
+					}
+				}
+				return nil
+			}
+			if err := adjust(prev, -1); err != nil {
+				return err
+			}
+			return adjust(v, 1)
+		},
+	}}
+	return sc
+}
+
+// tagCounts returns the counts of the UserCountByTag view.
+func tagCounts(tb testing.TB, s *Store) map[string]int {
+	m := make(map[string]int)
+	if err := s.ReadView("UserCountByTag", func(bkt *bolt.Bucket) error {
+		return bkt.ForEach(func(k, v []byte) error {
+			if n := keys.ParseInt(v); n != 0 {
+				m[string(k)] = n
+			}
+			return nil
+		})
+	}); err != nil {
+		tb.Fatal(err)
+	}
+	return m
+}
+
+// Ensure a view is updated with every change to its source bucket.
+func TestStore_View_Incremental(t *testing.T) {
+	s := NewStore()
+	s.Schema = tagCountSchema()
+	if err := s.Open(); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	if err := s.CreateUser(&main.User{Username: "susy", Tags: []string{"beta", "admin"}}); err != nil {
+		t.Fatal(err)
+	} else if err := s.CreateUser(&main.User{Username: "john", Tags: []string{"beta"}}); err != nil {
+		t.Fatal(err)
+	} else if err := s.AddTag(2, "admin"); err != nil {
+		t.Fatal(err)
+	} else if err := s.RemoveTag(1, "beta"); err != nil {
+		t.Fatal(err)
+	}
+	if m := tagCounts(t, s); !reflect.DeepEqual(m, map[string]int{"beta": 1, "admin": 2}) {
+		t.Fatalf("unexpected counts: %v", m)
+	}
+
+	if err := s.DeleteUser(1); err != nil {
+		t.Fatal(err)
+	} else if m := tagCounts(t, s); !reflect.DeepEqual(m, map[string]int{"beta": 1, "admin": 1}) {
+		t.Fatalf("unexpected counts: %v", m)
+	}
+}
+
+// Ensure a view added to an existing store is built from its source bucket.
+func TestStore_View_Build(t *testing.T) {
+	s := OpenStore()
+	defer s.Close()
+
+	for _, u := range []*main.User{
+		{Username: "susy", Tags: []string{"beta"}},
+		{Username: "john", Tags: []string{"beta", "admin"}},
+		{Username: "jane"},
+	} {
+		if err := s.CreateUser(u); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	s.Schema = tagCountSchema()
+	if err := s.Reopen(); err != nil {
+		t.Fatal(err)
+	} else if stale, err := s.ViewStale("UserCountByTag"); err != nil {
+		t.Fatal(err)
+	} else if stale {
+		t.Fatal("expected view to be built")
+	} else if m := tagCounts(t, s); !reflect.DeepEqual(m, map[string]int{"beta": 2, "admin": 1}) {
+		t.Fatalf("unexpected counts: %v", m)
+	}
+}
+
+// Ensure a view can be rebuilt from scratch.
+func TestStore_RebuildView(t *testing.T) {
+	s := NewStore()
+	s.Schema = tagCountSchema()
+	if err := s.Open(); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	if err := s.CreateUser(&main.User{Username: "susy", Tags: []string{"beta"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Corrupt the view directly and rebuild it.
+	if err := s.Store.Close(); err != nil {
+		t.Fatal(err)
+	} else if db, err := bolt.Open(s.Path, 0600, nil); err != nil {
+		t.Fatal(err)
+	} else if err := db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte("UserCountByTag")).Put([]byte("beta"), keys.Int(10))
+	}); err != nil {
+		t.Fatal(err)
+	} else if err := db.Close(); err != nil {
+		t.Fatal(err)
+	} else if err := s.Open(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.RebuildView("UserCountByTag"); err != nil {
+		t.Fatal(err)
+	} else if m := tagCounts(t, s); !reflect.DeepEqual(m, map[string]int{"beta": 1}) {
+		t.Fatalf("unexpected counts: %v", m)
+	}
+
+	if err := s.RebuildView("nope"); !errors.Is(err, main.ErrViewNotFound) {
+		t.Fatalf("unexpected error: %v", err)
+	} else if _, err := s.ViewStale("nope"); !errors.Is(err, main.ErrViewNotFound) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
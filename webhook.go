@@ -0,0 +1,752 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/benbjohnson/application-development-using-boltdb/internal"
+	"github.com/benbjohnson/application-development-using-boltdb/keys"
+	"github.com/gogo/protobuf/proto"
+)
+
+// Webhook dispatcher defaults.
+const (
+	DefaultWebhookInterval    = 1 * time.Second
+	DefaultWebhookBatchSize   = 100
+	DefaultWebhookMaxAttempts = 8
+	DefaultWebhookTimeout     = 10 * time.Second
+	DefaultWebhookLogTTL      = 7 * 24 * time.Hour
+)
+
+// Webhook delivery statuses.
+const (
+	WebhookPending   = "pending"
+	WebhookDelivered = "delivered"
+	WebhookFailed    = "failed"
+)
+
+// Webhook is an HTTP endpoint that is sent user events.
+type Webhook struct {
+	ID  int
+	URL string
+
+	// Key used to sign payloads. See SignWebhookPayload. The secret is
+	// encrypted at rest with the store's SecretKey, if set, and is otherwise
+	// kept as given since it is needed to sign every delivery.
+	Secret string
+
+	// Event types sent to the endpoint. All events are sent if empty.
+	Events []string
+
+	CreatedAt time.Time
+
+	encryptedSecret []byte
+}
+
+// Validate returns an error if w cannot be saved.
+func (w *Webhook) Validate() error {
+	if w.URL == "" {
+		return ErrWebhookURLRequired
+	} else if u, err := url.Parse(w.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return ErrInvalidWebhookURL
+	}
+	return nil
+}
+
+// Matches returns true if events of the given type are sent to w.
+func (w *Webhook) Matches(typ string) bool {
+	return len(w.Events) == 0 || slices.Contains(w.Events, typ)
+}
+
+// MarshalBinary encodes a webhook to binary format.
+func (w *Webhook) MarshalBinary() ([]byte, error) {
+	return proto.Marshal(&internal.Webhook{
+		ID:        proto.Int64(int64(w.ID)),
+		URL:       proto.String(w.URL),
+		Secret:    proto.String(w.Secret),
+		Events:    w.Events,
+		CreatedAt: proto.Int64(encodeTime(w.CreatedAt)),
+
+		EncryptedSecret: w.encryptedSecret,
+	})
+}
+
+// UnmarshalBinary decodes a webhook from binary data.
+func (w *Webhook) UnmarshalBinary(data []byte) error {
+	var pb internal.Webhook
+	if err := proto.Unmarshal(data, &pb); err != nil {
+		return err
+	}
+
+	w.ID = int(pb.GetID())
+	w.URL = pb.GetURL()
+	w.Secret = pb.GetSecret()
+	w.Events = pb.GetEvents()
+	w.CreatedAt = decodeTime(pb.GetCreatedAt())
+	w.encryptedSecret = pb.GetEncryptedSecret()
+
+	return nil
+}
+
+// WebhookDelivery is an attempt to send an event to a webhook. Deliveries
+// are kept in the "WebhookDeliveries" bucket as a log and are removed by the
+// reaper once they have been delivered or failed for DefaultWebhookLogTTL.
+type WebhookDelivery struct {
+	ID        int
+	WebhookID int
+	EventID   int
+	EventType string
+	Payload   []byte // JSON body sent to the endpoint
+
+	Status        string
+	Attempts      int
+	NextAttemptAt time.Time // time of the next attempt, while pending
+	LastError     string
+	ResponseCode  int // status code of the last response, if any
+
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// MarshalBinary encodes a delivery to binary format.
+func (d *WebhookDelivery) MarshalBinary() ([]byte, error) {
+	return proto.Marshal(&internal.WebhookDelivery{
+		ID:            proto.Int64(int64(d.ID)),
+		WebhookID:     proto.Int64(int64(d.WebhookID)),
+		EventID:       proto.Int64(int64(d.EventID)),
+		EventType:     proto.String(d.EventType),
+		Payload:       d.Payload,
+		Status:        proto.String(d.Status),
+		Attempts:      proto.Int64(int64(d.Attempts)),
+		NextAttemptAt: proto.Int64(encodeTime(d.NextAttemptAt)),
+		LastError:     proto.String(d.LastError),
+		ResponseCode:  proto.Int64(int64(d.ResponseCode)),
+		CreatedAt:     proto.Int64(encodeTime(d.CreatedAt)),
+		UpdatedAt:     proto.Int64(encodeTime(d.UpdatedAt)),
+	})
+}
+
+// UnmarshalBinary decodes a delivery from binary data.
+func (d *WebhookDelivery) UnmarshalBinary(data []byte) error {
+	var pb internal.WebhookDelivery
+	if err := proto.Unmarshal(data, &pb); err != nil {
+		return err
+	}
+
+	d.ID = int(pb.GetID())
+	d.WebhookID = int(pb.GetWebhookID())
+	d.EventID = int(pb.GetEventID())
+	d.EventType = pb.GetEventType()
+	d.Payload = pb.GetPayload()
+	d.Status = pb.GetStatus()
+	d.Attempts = int(pb.GetAttempts())
+	d.NextAttemptAt = decodeTime(pb.GetNextAttemptAt())
+	d.LastError = pb.GetLastError()
+	d.ResponseCode = int(pb.GetResponseCode())
+	d.CreatedAt = decodeTime(pb.GetCreatedAt())
+	d.UpdatedAt = decodeTime(pb.GetUpdatedAt())
+
+	return nil
+}
+
+// CreateWebhook registers a webhook. A random secret is generated if
+// w.Secret is empty. The webhook's ID is set to w.ID on success.
+func (s *Store) CreateWebhook(w *Webhook) error {
+	if err := w.Validate(); err != nil {
+		return err
+	}
+
+	if w.Secret == "" {
+		secret := make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			return err
+		}
+		w.Secret = hex.EncodeToString(secret)
+	}
+
+	return s.update("CreateWebhook", func(tx *Tx) error {
+		bkt := tx.Bucket([]byte("Webhooks"))
+		id, err := s.nextID(bkt)
+		if err != nil {
+			return err
+		}
+		w.ID = id
+		w.CreatedAt = time.Now().UTC()
+
+		buf, err := encodeWebhook(tx, w)
+		if err != nil {
+			return err
+		}
+		tx.recordWrite("Webhooks", buf)
+		return bkt.Put(keys.Int(w.ID), buf)
+	})
+}
+
+// Webhook retrieves a webhook by ID. Returns nil if the webhook does not
+// exist.
+func (s *Store) Webhook(id int) (*Webhook, error) {
+	var w *Webhook
+	if err := s.view("Webhook", func(tx *Tx) error {
+		var err error
+		w, err = loadWebhook(tx, id)
+		return err
+	}); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// Webhooks retrieves a list of all webhooks ordered by ID.
+func (s *Store) Webhooks() ([]*Webhook, error) {
+	var a []*Webhook
+	if err := s.view("Webhooks", func(tx *Tx) error {
+		var err error
+		a, err = webhooks(tx)
+		return err
+	}); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// DeleteWebhook removes a webhook by ID. Pending deliveries to the webhook
+// are marked as failed when they are next attempted. Returns
+// ErrWebhookNotFound if the webhook does not exist.
+func (s *Store) DeleteWebhook(id int) error {
+	return s.update("DeleteWebhook", func(tx *Tx) error {
+		bkt := tx.Bucket([]byte("Webhooks"))
+		if bkt.Get(keys.Int(id)) == nil {
+			return keyError("webhook", id, ErrWebhookNotFound)
+		}
+		tx.recordDelete("Webhooks")
+		return bkt.Delete(keys.Int(id))
+	})
+}
+
+// WebhookDeliveries retrieves the logged deliveries to a webhook ordered by
+// ID.
+func (s *Store) WebhookDeliveries(webhookID int) ([]*WebhookDelivery, error) {
+	a := []*WebhookDelivery{}
+	if err := s.view("WebhookDeliveries", func(tx *Tx) error {
+		return tx.Bucket([]byte("WebhookDeliveries")).ForEach(func(_, v []byte) error {
+			tx.recordRead("WebhookDeliveries", v)
+
+			d, err := decodeWebhookDelivery(tx, v)
+			if err != nil {
+				return err
+			} else if d.WebhookID == webhookID {
+				a = append(a, d)
+			}
+			return nil
+		})
+	}); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// loadWebhook reads a webhook by ID. Returns nil if it does not exist.
+func loadWebhook(tx *Tx, id int) (*Webhook, error) {
+	v := tx.Bucket([]byte("Webhooks")).Get(keys.Int(id))
+	if v == nil {
+		return nil, nil
+	}
+	tx.recordRead("Webhooks", v)
+	return decodeWebhook(tx, v)
+}
+
+// webhooks reads every webhook ordered by ID.
+func webhooks(tx *Tx) ([]*Webhook, error) {
+	a := []*Webhook{}
+	if err := tx.Bucket([]byte("Webhooks")).ForEach(func(_, v []byte) error {
+		tx.recordRead("Webhooks", v)
+
+		w, err := decodeWebhook(tx, v)
+		if err != nil {
+			return err
+		}
+		a = append(a, w)
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// encodeWebhook encodes w for storage. Its secret is encrypted if the store
+// has a SecretKey.
+func encodeWebhook(tx *Tx, w *Webhook) ([]byte, error) {
+	if len(tx.store.SecretKey) == 0 {
+		return w.MarshalBinary()
+	}
+
+	sealed, err := tx.store.encryptSecret([]byte(w.Secret))
+	if err != nil {
+		return nil, err
+	}
+	other := *w
+	other.Secret, other.encryptedSecret = "", sealed
+	return other.MarshalBinary()
+}
+
+// decodeWebhook decodes a stored webhook and decrypts its secret. Webhooks
+// saved before a SecretKey was set keep their secret in plain text.
+func decodeWebhook(tx *Tx, v []byte) (*Webhook, error) {
+	w := &Webhook{}
+	if err := w.UnmarshalBinary(v); err != nil {
+		return nil, err
+	} else if w.encryptedSecret == nil {
+		return w, nil
+	}
+
+	secret, err := tx.store.decryptSecret(w.encryptedSecret)
+	if err != nil {
+		return nil, err
+	}
+	w.Secret, w.encryptedSecret = string(secret), nil
+	return w, nil
+}
+
+// putWebhookDelivery saves a delivery. Pending deliveries are indexed in the
+// "WebhookQueue" bucket by their next attempt; finished deliveries are
+// removed from the queue and expire from the log after ttl.
+func putWebhookDelivery(tx *Tx, d *WebhookDelivery, ttl time.Duration) error {
+	buf, err := d.MarshalBinary()
+	if err != nil {
+		return err
+	}
+
+	if d.Status != WebhookPending {
+		return putWithTTL(tx, "WebhookDeliveries", keys.Int(d.ID), buf, d.UpdatedAt.Add(ttl))
+	}
+
+	tx.recordWrite("WebhookQueue", nil)
+	if err := tx.Bucket([]byte("WebhookQueue")).Put(webhookQueueKey(d), nil); err != nil {
+		return err
+	}
+	return putValue(tx, "WebhookDeliveries", keys.Int(d.ID), buf)
+}
+
+// decodeWebhookDelivery reassembles v, if needed, and unmarshals it into a
+// delivery.
+func decodeWebhookDelivery(tx *Tx, v []byte) (*WebhookDelivery, error) {
+	v, err := readOverflow(tx, v)
+	if err != nil {
+		return nil, err
+	}
+	d := &WebhookDelivery{}
+	if err := d.UnmarshalBinary(v); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// webhookQueueKey returns the key of d in the delivery queue.
+func webhookQueueKey(d *WebhookDelivery) []byte {
+	return keys.Join(keys.Time(d.NextAttemptAt), keys.Int(d.ID))
+}
+
+// userWebhookDeliveries reads the logged deliveries of events for a user
+// ordered by ID.
+func userWebhookDeliveries(tx *Tx, id int) ([]*WebhookDelivery, error) {
+	var a []*WebhookDelivery
+	if err := tx.Bucket([]byte("WebhookDeliveries")).ForEach(func(_, v []byte) error {
+		tx.recordRead("WebhookDeliveries", v)
+
+		d, err := decodeWebhookDelivery(tx, v)
+		if err != nil {
+			return err
+		}
+		var p webhookPayload
+		if err := json.Unmarshal(d.Payload, &p); err != nil {
+			return err
+		} else if p.UserID == id {
+			a = append(a, d)
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// scrubWebhookDeliveries removes the user and field values from the
+// payloads of logged deliveries for a user and returns the number of
+// deliveries changed. Pending deliveries are still sent, with the scrubbed
+// payload, and logged deliveries keep their expiration.
+func scrubWebhookDeliveries(tx *Tx, id int) (int, error) {
+	a, err := userWebhookDeliveries(tx, id)
+	if err != nil {
+		return 0, err
+	}
+
+	var n int
+	for _, d := range a {
+		var p webhookPayload
+		if err := json.Unmarshal(d.Payload, &p); err != nil {
+			return n, err
+		}
+
+		scrubbed := p.User == nil
+		p.User = nil
+		for i := range p.Changes {
+			if p.Changes[i].Old != "" || p.Changes[i].New != "" {
+				scrubbed = false
+			}
+			p.Changes[i].Old, p.Changes[i].New = "", ""
+		}
+		if scrubbed {
+			continue
+		}
+
+		if d.Payload, err = json.Marshal(&p); err != nil {
+			return n, err
+		}
+		buf, err := d.MarshalBinary()
+		if err != nil {
+			return n, err
+		} else if err := putValue(tx, "WebhookDeliveries", keys.Int(d.ID), buf); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, nil
+}
+
+// webhookPayload is the JSON body sent to webhook endpoints.
+type webhookPayload struct {
+	ID        int           `json:"id"`
+	Type      string        `json:"type"`
+	UserID    int           `json:"user_id"`
+	User      *User         `json:"user,omitempty"`
+	Changes   []FieldChange `json:"changes,omitempty"`
+	CreatedAt time.Time     `json:"created_at"`
+}
+
+// SignWebhookPayload returns the value of the X-Webhook-Signature header for
+// a payload sent at t. Endpoints verify a delivery by computing the same
+// value from the header's timestamp and the request body:
+//
+//	t=<unix seconds>,v1=<hex HMAC-SHA256 of "<unix seconds>.<body>">
+func SignWebhookPayload(secret string, t time.Time, body []byte) string {
+	ts := strconv.FormatInt(t.Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(ts))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "t=" + ts + ",v1=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// WebhookDispatcher delivers events to registered webhooks. It is a
+// Publisher so it can be attached to a Relay: each published event is
+// logged as a pending delivery for every matching webhook, and deliveries
+// are sent in the background with retries.
+//
+// Failed deliveries are retried with exponential backoff until MaxAttempts
+// is reached. Deliveries to different webhooks are independent, so one slow
+// or failing endpoint does not hold back the others. Events may be sent more
+// than once, so endpoints should use the event ID in the payload to ignore
+// duplicates. Only one dispatcher should run per store.
+type WebhookDispatcher struct {
+	closing chan struct{}
+	wg      sync.WaitGroup
+
+	// Store to read webhooks and deliveries from.
+	Store *Store
+
+	// Client used to send deliveries. Defaults to a client with a
+	// DefaultWebhookTimeout timeout.
+	Client *http.Client
+
+	// Time between checks for due deliveries.
+	// Defaults to DefaultWebhookInterval.
+	Interval time.Duration
+
+	// Maximum number of deliveries sent per flush.
+	// Defaults to DefaultWebhookBatchSize.
+	BatchSize int
+
+	// Number of attempts before a delivery is marked as failed.
+	// Defaults to DefaultWebhookMaxAttempts.
+	MaxAttempts int
+
+	// Time finished deliveries are kept in the log.
+	// Defaults to DefaultWebhookLogTTL.
+	LogTTL time.Duration
+}
+
+// Publish logs a pending delivery of e for every webhook that matches its
+// type. Deliveries are sent on the next flush.
+func (d *WebhookDispatcher) Publish(ctx context.Context, e *Event) error {
+	user, err := e.User()
+	if err != nil {
+		return err
+	}
+	payload, err := json.Marshal(&webhookPayload{
+		ID:        e.ID,
+		Type:      e.Type,
+		UserID:    e.UserID,
+		User:      user,
+		Changes:   e.Changes,
+		CreatedAt: e.CreatedAt,
+	})
+	if err != nil {
+		return err
+	}
+
+	return d.Store.update("PublishWebhook", func(tx *Tx) error {
+		hooks, err := webhooks(tx)
+		if err != nil {
+			return err
+		}
+
+		now := time.Now().UTC()
+		bkt := tx.Bucket([]byte("WebhookDeliveries"))
+		for _, w := range hooks {
+			if !w.Matches(e.Type) {
+				continue
+			}
+
+			seq, err := bkt.NextSequence()
+			if err != nil {
+				return err
+			}
+			if err := putWebhookDelivery(tx, &WebhookDelivery{
+				ID:            int(seq),
+				WebhookID:     w.ID,
+				EventID:       e.ID,
+				EventType:     e.Type,
+				Payload:       payload,
+				Status:        WebhookPending,
+				NextAttemptAt: now,
+				CreatedAt:     now,
+				UpdatedAt:     now,
+			}, d.logTTL()); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Open starts sending deliveries in the background.
+func (d *WebhookDispatcher) Open() error {
+	d.closing = make(chan struct{})
+	d.wg.Add(1)
+	go func() { defer d.wg.Done(); d.monitor() }()
+	return nil
+}
+
+// Close stops sending deliveries.
+func (d *WebhookDispatcher) Close() error {
+	if d.closing != nil {
+		close(d.closing)
+		d.wg.Wait()
+		d.closing = nil
+	}
+	return nil
+}
+
+// monitor flushes due deliveries on every interval until the dispatcher is
+// closed.
+func (d *WebhookDispatcher) monitor() {
+	interval := d.Interval
+	if interval <= 0 {
+		interval = DefaultWebhookInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-d.closing:
+			return
+		case <-ticker.C:
+			for {
+				n, err := d.Flush(context.Background())
+				if err != nil {
+					d.Store.logger().Error("webhook dispatch failed", "err", err)
+				}
+				if err != nil || n < d.batchSize() {
+					break
+				}
+			}
+		}
+	}
+}
+
+// Flush sends the next batch of due deliveries and returns the number
+// attempted. Failed attempts are rescheduled and are not returned as errors.
+func (d *WebhookDispatcher) Flush(ctx context.Context) (int, error) {
+	// Read a batch of due deliveries along with their webhooks.
+	type item struct {
+		delivery *WebhookDelivery
+		webhook  *Webhook
+	}
+	var items []item
+	if err := d.Store.view("WebhookDue", func(tx *Tx) error {
+		items = nil
+		now := keys.Time(time.Now())
+		c := tx.Bucket([]byte("WebhookQueue")).Cursor()
+		for k, _ := c.First(); k != nil && bytes.Compare(k, now) < 0 && len(items) < d.batchSize(); k, _ = c.Next() {
+			r := keys.NewReader(k)
+			r.ReadTime()
+			id := r.ReadInt()
+			if err := r.Err(); err != nil {
+				return err
+			}
+
+			v := tx.Bucket([]byte("WebhookDeliveries")).Get(keys.Int(id))
+			if v == nil {
+				continue
+			}
+			tx.recordRead("WebhookDeliveries", v)
+
+			dl, err := decodeWebhookDelivery(tx, v)
+			if err != nil {
+				return err
+			}
+			w, err := loadWebhook(tx, dl.WebhookID)
+			if err != nil {
+				return err
+			}
+			items = append(items, item{delivery: dl, webhook: w})
+		}
+		return nil
+	}); err != nil {
+		return 0, err
+	}
+
+	// Send outside of a transaction so slow endpoints don't block writers.
+	for _, it := range items {
+		prev := webhookQueueKey(it.delivery)
+		d.send(ctx, it.webhook, it.delivery)
+
+		if err := d.Store.update("WebhookAck", func(tx *Tx) error {
+			tx.recordDelete("WebhookQueue")
+			if err := tx.Bucket([]byte("WebhookQueue")).Delete(prev); err != nil {
+				return err
+			}
+
+			// Keep the stored payload in case it was scrubbed while sending.
+			v := tx.Bucket([]byte("WebhookDeliveries")).Get(keys.Int(it.delivery.ID))
+			if v == nil {
+				return nil
+			}
+			tx.recordRead("WebhookDeliveries", v)
+			cur, err := decodeWebhookDelivery(tx, v)
+			if err != nil {
+				return err
+			}
+			it.delivery.Payload = cur.Payload
+			return putWebhookDelivery(tx, it.delivery, d.logTTL())
+		}); err != nil {
+			return 0, err
+		}
+	}
+	return len(items), nil
+}
+
+// send attempts a delivery and updates its status, attempts, and next
+// attempt from the result.
+func (d *WebhookDispatcher) send(ctx context.Context, w *Webhook, dl *WebhookDelivery) {
+	now := time.Now().UTC()
+	dl.Attempts++
+	dl.UpdatedAt = now
+
+	err := d.post(ctx, w, dl, now)
+	if err == nil {
+		dl.Status, dl.LastError = WebhookDelivered, ""
+		return
+	}
+
+	dl.LastError = err.Error()
+	if w == nil || dl.Attempts >= d.maxAttempts() {
+		dl.Status = WebhookFailed
+		return
+	}
+	dl.NextAttemptAt = now.Add(jobRetryDelay(dl.Attempts))
+}
+
+// post sends the payload of a delivery to a webhook. Returns an error if the
+// request fails or the response is not a 2xx status.
+func (d *WebhookDispatcher) post(ctx context.Context, w *Webhook, dl *WebhookDelivery, now time.Time) error {
+	if w == nil {
+		return ErrWebhookNotFound
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", w.URL, bytes.NewReader(dl.Payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Webhook-ID", strconv.Itoa(w.ID))
+	req.Header.Set("X-Webhook-Delivery", strconv.Itoa(dl.ID))
+	req.Header.Set("X-Webhook-Event", dl.EventType)
+	req.Header.Set("X-Webhook-Signature", SignWebhookPayload(w.Secret, now, dl.Payload))
+
+	resp, err := d.client().Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	dl.ResponseCode = resp.StatusCode
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook endpoint returned %s", resp.Status)
+	}
+	return nil
+}
+
+// client returns the configured client or a default client, if unset.
+func (d *WebhookDispatcher) client() *http.Client {
+	if d.Client == nil {
+		return &http.Client{Timeout: DefaultWebhookTimeout}
+	}
+	return d.Client
+}
+
+// batchSize returns the configured batch size or the default, if unset.
+func (d *WebhookDispatcher) batchSize() int {
+	if d.BatchSize <= 0 {
+		return DefaultWebhookBatchSize
+	}
+	return d.BatchSize
+}
+
+// maxAttempts returns the configured attempts or the default, if unset.
+func (d *WebhookDispatcher) maxAttempts() int {
+	if d.MaxAttempts <= 0 {
+		return DefaultWebhookMaxAttempts
+	}
+	return d.MaxAttempts
+}
+
+// logTTL returns the configured log TTL or the default, if unset.
+func (d *WebhookDispatcher) logTTL() time.Duration {
+	if d.LogTTL <= 0 {
+		return DefaultWebhookLogTTL
+	}
+	return d.LogTTL
+}
+
+// Webhook related errors.
+var (
+	ErrWebhookURLRequired = &Error{Code: EINVALID, Message: "webhook url required"}
+	ErrInvalidWebhookURL  = &Error{Code: EINVALID, Message: "webhook url must be an absolute http or https url"}
+	ErrWebhookNotFound    = &Error{Code: ENOTFOUND, Message: "webhook not found"}
+)
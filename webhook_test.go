@@ -0,0 +1,272 @@
+package main_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	main "github.com/benbjohnson/application-development-using-boltdb"
+	"github.com/benbjohnson/application-development-using-boltdb/keys"
+)
+
+// Ensure webhooks can be created, listed, and deleted.
+func TestStore_CreateWebhook(t *testing.T) {
+	s := OpenStore()
+	defer s.Close()
+
+	w := &main.Webhook{URL: "https://example.com/hook", Events: []string{"user.created"}}
+	if err := s.CreateWebhook(w); err != nil {
+		t.Fatal(err)
+	} else if w.ID != 1 {
+		t.Fatalf("unexpected id: %d", w.ID)
+	} else if len(w.Secret) != 64 {
+		t.Fatalf("unexpected secret: %q", w.Secret)
+	}
+
+	if other, err := s.Webhook(1); err != nil {
+		t.Fatal(err)
+	} else if other.URL != w.URL || other.Secret != w.Secret || !other.Matches("user.created") || other.Matches("user.deleted") {
+		t.Fatalf("unexpected webhook: %#v", other)
+	} else if a, err := s.Webhooks(); err != nil {
+		t.Fatal(err)
+	} else if len(a) != 1 {
+		t.Fatalf("unexpected webhooks: %d", len(a))
+	}
+
+	if err := s.DeleteWebhook(1); err != nil {
+		t.Fatal(err)
+	} else if err := s.DeleteWebhook(1); !errors.Is(err, main.ErrWebhookNotFound) {
+		t.Fatalf("unexpected error: %v", err)
+	} else if w, err := s.Webhook(1); err != nil {
+		t.Fatal(err)
+	} else if w != nil {
+		t.Fatalf("unexpected webhook: %#v", w)
+	}
+}
+
+// Ensure webhook secrets are encrypted at rest when the store has a key.
+func TestStore_CreateWebhook_SecretKey(t *testing.T) {
+	s := NewStore()
+	if err := s.Open(); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	// Webhooks created before a key is set keep a plain text secret.
+	if err := s.CreateWebhook(&main.Webhook{URL: "https://example.com/a", Secret: "plainsecret"}); err != nil {
+		t.Fatal(err)
+	}
+
+	s.SecretKey = bytes.Repeat([]byte("k"), 32)
+	if err := s.Reopen(); err != nil {
+		t.Fatal(err)
+	} else if err := s.CreateWebhook(&main.Webhook{URL: "https://example.com/b", Secret: "sealedsecret"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if v := rawValue(t, s, "Webhooks", keys.Int(2)); v == nil {
+		t.Fatal("expected webhook")
+	} else if bytes.Contains(v, []byte("sealedsecret")) {
+		t.Fatal("secret stored in plaintext")
+	} else if a, err := s.Webhooks(); err != nil {
+		t.Fatal(err)
+	} else if len(a) != 2 || a[0].Secret != "plainsecret" || a[1].Secret != "sealedsecret" {
+		t.Fatalf("unexpected webhooks: %#v", a)
+	}
+
+	// The secret cannot be read without the key.
+	s.SecretKey = nil
+	if err := s.Reopen(); err != nil {
+		t.Fatal(err)
+	} else if _, err := s.Webhook(2); !errors.Is(err, main.ErrSecretKeyRequired) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+// Ensure webhooks without an absolute http or https URL are rejected.
+func TestStore_CreateWebhook_ErrInvalidWebhookURL(t *testing.T) {
+	s := OpenStore()
+	defer s.Close()
+
+	if err := s.CreateWebhook(&main.Webhook{}); !errors.Is(err, main.ErrWebhookURLRequired) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, u := range []string{"/hook", "ftp://example.com", "https://"} {
+		if err := s.CreateWebhook(&main.Webhook{URL: u}); !errors.Is(err, main.ErrInvalidWebhookURL) {
+			t.Fatalf("unexpected error for %q: %v", u, err)
+		}
+	}
+}
+
+// Ensure matching events are delivered with a valid signature and logged.
+func TestWebhookDispatcher_Flush(t *testing.T) {
+	s := OpenStore()
+	defer s.Close()
+	s.Outbox = true
+
+	var mu sync.Mutex
+	var bodies []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+
+		// Verify the signature against the header's timestamp.
+		sig := r.Header.Get("X-Webhook-Signature")
+		ts, _ := strconv.ParseInt(strings.TrimPrefix(strings.Split(sig, ",")[0], "t="), 10, 64)
+		if sig != main.SignWebhookPayload("secret", time.Unix(ts, 0), body) {
+			t.Errorf("unexpected signature: %s", sig)
+		} else if typ := r.Header.Get("X-Webhook-Event"); typ != "user.created" {
+			t.Errorf("unexpected event header: %s", typ)
+		}
+
+		mu.Lock()
+		bodies = append(bodies, string(body))
+		mu.Unlock()
+	}))
+	defer srv.Close()
+
+	if err := s.CreateWebhook(&main.Webhook{URL: srv.URL, Secret: "secret", Events: []string{"user.created"}}); err != nil {
+		t.Fatal(err)
+	} else if err := s.CreateUser(&main.User{Username: "susy"}); err != nil {
+		t.Fatal(err)
+	} else if err := s.SetUsername(1, "jimbo"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Queue deliveries from the outbox. Only the creation matches.
+	d := &main.WebhookDispatcher{Store: s.Store}
+	r := &main.Relay{Store: s.Store, Publisher: d}
+	if n, err := r.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	} else if n != 2 {
+		t.Fatalf("unexpected count: %d", n)
+	}
+
+	if n, err := d.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	} else if n != 1 {
+		t.Fatalf("unexpected count: %d", n)
+	} else if len(bodies) != 1 {
+		t.Fatalf("unexpected bodies: %v", bodies)
+	}
+
+	var payload struct {
+		Type   string `json:"type"`
+		UserID int    `json:"user_id"`
+		User   struct{ Username string }
+	}
+	if err := json.Unmarshal([]byte(bodies[0]), &payload); err != nil {
+		t.Fatal(err)
+	} else if payload.Type != "user.created" || payload.UserID != 1 || payload.User.Username != "susy" {
+		t.Fatalf("unexpected payload: %s", bodies[0])
+	}
+
+	if a, err := s.WebhookDeliveries(1); err != nil {
+		t.Fatal(err)
+	} else if len(a) != 1 {
+		t.Fatalf("unexpected deliveries: %d", len(a))
+	} else if a[0].Status != main.WebhookDelivered || a[0].Attempts != 1 || a[0].ResponseCode != 200 {
+		t.Fatalf("unexpected delivery: %#v", a[0])
+	}
+
+	// Delivered payloads are not sent again.
+	if n, err := d.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	} else if n != 0 {
+		t.Fatalf("unexpected count: %d", n)
+	}
+}
+
+// Ensure failed deliveries are retried later and fail after MaxAttempts.
+func TestWebhookDispatcher_Flush_Retry(t *testing.T) {
+	s := OpenStore()
+	defer s.Close()
+	s.Outbox = true
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	if err := s.CreateWebhook(&main.Webhook{URL: srv.URL}); err != nil {
+		t.Fatal(err)
+	} else if err := s.CreateUser(&main.User{Username: "susy"}); err != nil {
+		t.Fatal(err)
+	}
+
+	d := &main.WebhookDispatcher{Store: s.Store, MaxAttempts: 2}
+	r := &main.Relay{Store: s.Store, Publisher: d}
+	if _, err := r.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	// The first failure is rescheduled with backoff.
+	if n, err := d.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	} else if n != 1 {
+		t.Fatalf("unexpected count: %d", n)
+	} else if n, err := d.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	} else if n != 0 {
+		t.Fatalf("unexpected count: %d", n)
+	}
+
+	a, err := s.WebhookDeliveries(1)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(a) != 1 {
+		t.Fatalf("unexpected deliveries: %d", len(a))
+	} else if dl := a[0]; dl.Status != main.WebhookPending || dl.Attempts != 1 || dl.ResponseCode != 503 || !dl.NextAttemptAt.After(time.Now()) {
+		t.Fatalf("unexpected delivery: %#v", dl)
+	}
+
+	// The second failure exhausts the attempts.
+	waitFor(t, func() bool {
+		n, err := d.Flush(context.Background())
+		return err == nil && n == 1
+	})
+	if a, err := s.WebhookDeliveries(1); err != nil {
+		t.Fatal(err)
+	} else if dl := a[0]; dl.Status != main.WebhookFailed || dl.Attempts != 2 || dl.LastError == "" {
+		t.Fatalf("unexpected delivery: %#v", dl)
+	}
+}
+
+// Ensure pending deliveries to a deleted webhook fail instead of retrying.
+func TestWebhookDispatcher_Flush_DeletedWebhook(t *testing.T) {
+	s := OpenStore()
+	defer s.Close()
+	s.Outbox = true
+
+	if err := s.CreateWebhook(&main.Webhook{URL: "http://127.0.0.1:1/hook"}); err != nil {
+		t.Fatal(err)
+	} else if err := s.CreateUser(&main.User{Username: "susy"}); err != nil {
+		t.Fatal(err)
+	}
+
+	d := &main.WebhookDispatcher{Store: s.Store}
+	r := &main.Relay{Store: s.Store, Publisher: d}
+	if _, err := r.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	} else if err := s.DeleteWebhook(1); err != nil {
+		t.Fatal(err)
+	}
+
+	if n, err := d.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	} else if n != 1 {
+		t.Fatalf("unexpected count: %d", n)
+	} else if a, err := s.WebhookDeliveries(1); err != nil {
+		t.Fatal(err)
+	} else if a[0].Status != main.WebhookFailed {
+		t.Fatalf("unexpected delivery: %#v", a[0])
+	}
+}